@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/analytics"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/sirupsen/logrus"
+)
+
+// exportLoginEvent append the attempt to the analytics_export of the account, only when one is configured along with
+// the analytics_salt keying its pseudonyms, failing to do so never fails the login
+func exportLoginEvent(account *cfg.IDPAccount, attempt *journal.Entry, err error) {
+	if account.AnalyticsExport == "" {
+		return
+	}
+	if account.AnalyticsSalt == "" {
+		logrus.Warn("analytics_export is set without analytics_salt, the login event is not exported")
+		return
+	}
+
+	if aerr := analytics.Append(account.AnalyticsExport, buildLoginEvent(account, attempt, err, time.Now())); aerr != nil {
+		logrus.WithError(aerr).Debug("unable to export login event")
+	}
+}
+
+// buildLoginEvent the pseudonymous event of the attempt, the user and AlibabaCloud account are hashed with the
+// analytics_salt and the IdP URL and profile are left out
+func buildLoginEvent(account *cfg.IDPAccount, attempt *journal.Entry, err error, now time.Time) *analytics.Event {
+	accountID, roleName := analytics.SplitRoleARN(attempt.Role)
+
+	event := &analytics.Event{
+		Time:     attempt.Time,
+		User:     analytics.Pseudonym(account.AnalyticsSalt, account.Username),
+		Account:  analytics.Pseudonym(account.AnalyticsSalt, accountID),
+		Role:     roleName,
+		Provider: attempt.Provider,
+		Outcome:  journal.OutcomeSuccess,
+		Duration: now.Sub(attempt.Time),
+	}
+
+	if err != nil {
+		event.Outcome = journal.OutcomeFailure
+		event.Stage = attempt.Stage
+		event.ErrorClass = classifyError(err)
+		return event
+	}
+
+	if !attempt.Expires.IsZero() {
+		event.TokenLifetime = attempt.Expires.Sub(now)
+	}
+
+	return event
+}
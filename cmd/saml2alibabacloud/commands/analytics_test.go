@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/analytics"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildLoginEvent(t *testing.T) {
+	now := time.Now()
+	account := &cfg.IDPAccount{Username: "user@example.com", Profile: "production", AnalyticsSalt: "salt"}
+	attempt := &journal.Entry{
+		Time:     now.Add(-2 * time.Second),
+		Provider: "Okta",
+		Role:     "acs:ram::123456789012:role/admin",
+		Expires:  now.Add(time.Hour),
+	}
+
+	event := buildLoginEvent(account, attempt, nil, now)
+	assert.Equal(t, journal.OutcomeSuccess, event.Outcome)
+	assert.Equal(t, analytics.Pseudonym("salt", "user@example.com"), event.User)
+	assert.Equal(t, analytics.Pseudonym("salt", "123456789012"), event.Account)
+	assert.Equal(t, "admin", event.Role)
+	assert.Equal(t, 2*time.Second, event.Duration)
+	assert.Equal(t, time.Hour, event.TokenLifetime)
+	assert.NotContains(t, strings.Join(event.Record(), ","), "user@example.com")
+	assert.NotContains(t, strings.Join(event.Record(), ","), "123456789012")
+
+	attempt.Stage = journal.StageSTS
+	event = buildLoginEvent(account, attempt, errors.New("boom"), now)
+	assert.Equal(t, journal.OutcomeFailure, event.Outcome)
+	assert.Equal(t, journal.StageSTS, event.Stage)
+	assert.Equal(t, "error", event.ErrorClass)
+	assert.Zero(t, event.TokenLifetime)
+}
@@ -0,0 +1,330 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/hook"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultBatchConcurrency the number of jobs run at once when neither the flag nor the file set it
+const defaultBatchConcurrency = 4
+
+// batchFile the jobs of a batch run
+type batchFile struct {
+	Concurrency int         `yaml:"concurrency"`
+	Jobs        []*batchJob `yaml:"jobs"`
+}
+
+// batchJob a profile refreshed with a role of the assertion of a source, either an IdP account or a file
+type batchJob struct {
+	IdpAccount    string `yaml:"idp_account"`
+	AssertionFile string `yaml:"assertion_file"`
+	Role          string `yaml:"role"`
+	Profile       string `yaml:"profile"`
+}
+
+// source the key of the assertion source, jobs sharing it share the assertion
+func (j *batchJob) source() string {
+	if j.AssertionFile != "" {
+		return "assertion_file:" + j.AssertionFile
+	}
+	return "idp_account:" + j.IdpAccount
+}
+
+// batchResult the outcome of a job
+type batchResult struct {
+	Job     *batchJob
+	Expires time.Time
+	Err     error
+}
+
+// loadBatchFile read and check the jobs of the batch file
+func loadBatchFile(filename string) (*batchFile, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading batch file")
+	}
+
+	file := &batchFile{}
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return nil, errors.Wrap(err, "error parsing batch file")
+	}
+
+	if len(file.Jobs) == 0 {
+		return nil, fmt.Errorf("no jobs in %s", filename)
+	}
+
+	profiles := map[string]int{}
+	for i, job := range file.Jobs {
+		n := i + 1
+		if (job.IdpAccount == "") == (job.AssertionFile == "") {
+			return nil, fmt.Errorf("job %d: set either idp_account or assertion_file", n)
+		}
+		if job.Role == "" {
+			return nil, fmt.Errorf("job %d: role is required", n)
+		}
+		if job.Profile == "" {
+			return nil, fmt.Errorf("job %d: profile is required", n)
+		}
+		if other, ok := profiles[job.Profile]; ok {
+			return nil, fmt.Errorf("job %d: profile %s is already refreshed by job %d", n, job.Profile, other)
+		}
+		profiles[job.Profile] = n
+	}
+
+	return file, nil
+}
+
+// Batch refresh the credentials of the profiles listed in the batch file. Each assertion source is only used once,
+// the IdP accounts authenticate one after the other as they may prompt for MFA, while the STS exchanges of up to
+// concurrency jobs run at once
+func Batch(loginFlags *flags.LoginExecFlags, filename string, concurrency int) error {
+	file, err := loadBatchFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if loginFlags.CommonFlags.Offline {
+		return errors.New("batch requires network access and is not available with --offline")
+	}
+
+	if concurrency <= 0 {
+		concurrency = file.Concurrency
+	}
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	// the login details come from the IdP accounts and the keychain, never from prompts
+	loginFlags.CommonFlags.SkipPrompt = true
+
+	var authMu, saveMu, journalMu sync.Mutex
+
+	assertions := newAssertionCache(func(job *batchJob) (*cfg.IDPAccount, string, error) {
+		if job.AssertionFile != "" {
+			return readBatchAssertion(job.AssertionFile)
+		}
+		authMu.Lock()
+		defer authMu.Unlock()
+		return authenticateBatchAccount(loginFlags, job.IdpAccount)
+	})
+
+	results := runBatch(file.Jobs, concurrency, func(job *batchJob) (time.Time, error) {
+		attempt := &journal.Entry{Time: time.Now(), Account: job.IdpAccount, Profile: job.Profile, Role: job.Role, Stage: journal.StageIdP}
+
+		expires, err := refreshBatchProfile(job, assertions, &saveMu, attempt)
+
+		attempt.Expires = expires
+		journalMu.Lock()
+		recordLoginAttempt(attempt, err)
+		journalMu.Unlock()
+
+		return expires, err
+	})
+
+	printBatchResults(results)
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d batch jobs failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// runBatch run the jobs, up to concurrency at once, the results are in the order of the jobs
+func runBatch(jobs []*batchJob, concurrency int, run func(job *batchJob) (time.Time, error)) []*batchResult {
+	results := make([]*batchResult, len(jobs))
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, job *batchJob) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			expires, err := run(job)
+			results[i] = &batchResult{Job: job, Expires: expires, Err: err}
+		}(i, job)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func refreshBatchProfile(job *batchJob, assertions *assertionCache, saveMu *sync.Mutex, attempt *journal.Entry) (time.Time, error) {
+	source, samlAssertion, err := assertions.get(job)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	account := *source
+	account.Profile = job.Profile
+	account.RoleARN = job.Role
+	attempt.Provider = account.Provider
+
+	attempt.Stage = journal.StageRole
+
+	roles, err := permittedRamRoles(samlAssertion, &account)
+	if err != nil {
+		return time.Time{}, err
+	}
+	role, err := saml2alibabacloud.LocateRole(roles, job.Role)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	attempt.Stage = journal.StageSTS
+
+	alibabacloudCreds, err := loginToStsUsingRole(&account, role, samlAssertion)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "error logging into AlibabaCloud role using saml assertion")
+	}
+
+	attempt.Stage = journal.StageSave
+
+	// the profiles share the AlibabaCloud CLI configuration file
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	err = guardOutput(&account, alibabacloudconfig.ConfigFilename())
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "refusing to save credentials")
+	}
+
+	err = alibabacloudconfig.NewSharedCredentials(job.Profile).Save(alibabacloudCreds)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "error saving credentials")
+	}
+
+	return alibabacloudCreds.Expires, nil
+}
+
+// authenticateBatchAccount authenticate with the IdP account, returning the assertion once processed by its hook
+func authenticateBatchAccount(loginFlags *flags.LoginExecFlags, idpAccount string) (*cfg.IDPAccount, string, error) {
+	commonFlags := *loginFlags.CommonFlags
+	commonFlags.IdpAccount = idpAccount
+	accountFlags := *loginFlags
+	accountFlags.CommonFlags = &commonFlags
+
+	account, err := buildIdpAccount(&accountFlags)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error building login details")
+	}
+
+	err = checkClock(account)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, samlAssertion, err := authenticate(account, &accountFlags, &journal.Entry{})
+	if err != nil {
+		return nil, "", err
+	}
+
+	samlAssertion, err = hook.Apply(samlAssertion, account)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error processing saml assertion")
+	}
+
+	err = checkAssertionValidity(samlAssertion, account)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error validating saml assertion")
+	}
+
+	return account, samlAssertion, nil
+}
+
+// readBatchAssertion read a base64 assertion obtained outside of saml2alibabacloud, the default account settings apply
+func readBatchAssertion(filename string) (*cfg.IDPAccount, string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error reading assertion file")
+	}
+
+	samlAssertion := strings.TrimSpace(string(data))
+	if samlAssertion == "" {
+		return nil, "", fmt.Errorf("assertion file %s is empty", filename)
+	}
+
+	account := cfg.NewIDPAccount()
+
+	err = checkAssertionValidity(samlAssertion, account)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error validating saml assertion")
+	}
+
+	return account, samlAssertion, nil
+}
+
+func printBatchResults(results []*batchResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tROLE\tRESULT")
+	for _, result := range results {
+		outcome := "ok, expires " + result.Expires.Local().Format(time.RFC3339)
+		if result.Err != nil {
+			outcome = "failed: " + result.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.Job.Profile, result.Job.Role, outcome)
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("error printing batch results: %v", err)
+	}
+}
+
+// assertionSource the assertion of a source, fetched by the first job needing it
+type assertionSource struct {
+	once      sync.Once
+	account   *cfg.IDPAccount
+	assertion string
+	err       error
+}
+
+// assertionCache fetch the assertion of each source once, whatever the number of jobs using it
+type assertionCache struct {
+	fetch func(job *batchJob) (*cfg.IDPAccount, string, error)
+
+	mu      sync.Mutex
+	sources map[string]*assertionSource
+}
+
+func newAssertionCache(fetch func(job *batchJob) (*cfg.IDPAccount, string, error)) *assertionCache {
+	return &assertionCache{fetch: fetch, sources: map[string]*assertionSource{}}
+}
+
+func (c *assertionCache) get(job *batchJob) (*cfg.IDPAccount, string, error) {
+	c.mu.Lock()
+	src, ok := c.sources[job.source()]
+	if !ok {
+		src = &assertionSource{}
+		c.sources[job.source()] = src
+	}
+	c.mu.Unlock()
+
+	src.once.Do(func() {
+		src.account, src.assertion, src.err = c.fetch(job)
+	})
+
+	return src.account, src.assertion, src.err
+}
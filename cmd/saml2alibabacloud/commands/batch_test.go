@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(content string) string {
+		filename := filepath.Join(dir, "jobs.yaml")
+		assert.Nil(t, ioutil.WriteFile(filename, []byte(content), 0600))
+		return filename
+	}
+
+	file, err := loadBatchFile(write(`
+concurrency: 2
+jobs:
+  - idp_account: service
+    role: acs:ram::1234567890:role/deploy
+    profile: deploy
+  - assertion_file: /run/secrets/assertion
+    role: acs:ram::1234567890:role/audit
+    profile: audit
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, file.Concurrency)
+	assert.Equal(t, &batchJob{IdpAccount: "service", Role: "acs:ram::1234567890:role/deploy", Profile: "deploy"}, file.Jobs[0])
+	assert.Equal(t, "assertion_file:/run/secrets/assertion", file.Jobs[1].source())
+
+	_, err = loadBatchFile(write(`jobs: []`))
+	assert.EqualError(t, err, "no jobs in "+filepath.Join(dir, "jobs.yaml"))
+
+	_, err = loadBatchFile(write(`jobs: [{idp_account: service, assertion_file: assertion, role: r, profile: p}]`))
+	assert.EqualError(t, err, "job 1: set either idp_account or assertion_file")
+
+	_, err = loadBatchFile(write(`jobs: [{idp_account: service, profile: p}]`))
+	assert.EqualError(t, err, "job 1: role is required")
+
+	_, err = loadBatchFile(write(`jobs: [{idp_account: service, role: r}]`))
+	assert.EqualError(t, err, "job 1: profile is required")
+
+	_, err = loadBatchFile(write(`jobs: [{idp_account: a, role: r, profile: p}, {idp_account: b, role: r, profile: p}]`))
+	assert.EqualError(t, err, "job 2: profile p is already refreshed by job 1")
+
+	_, err = loadBatchFile(write(`jobs: [{idp_acount: service, role: r, profile: p}]`))
+	assert.Error(t, err)
+}
+
+func TestRunBatch(t *testing.T) {
+	jobs := []*batchJob{
+		{IdpAccount: "service", Role: "r", Profile: "a"},
+		{IdpAccount: "service", Role: "r", Profile: "b"},
+		{AssertionFile: "assertion", Role: "r", Profile: "c"},
+		{IdpAccount: "other", Role: "r", Profile: "d"},
+	}
+
+	var mu sync.Mutex
+	fetched := map[string]int{}
+	assertions := newAssertionCache(func(job *batchJob) (*cfg.IDPAccount, string, error) {
+		mu.Lock()
+		fetched[job.source()]++
+		mu.Unlock()
+		if job.IdpAccount == "other" {
+			return nil, "", errors.New("authentication failed")
+		}
+		return cfg.NewIDPAccount(), "assertion of " + job.source(), nil
+	})
+
+	running, maxRunning := 0, 0
+	expires := time.Now().Add(time.Hour)
+
+	results := runBatch(jobs, 2, func(job *batchJob) (time.Time, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+
+		_, assertion, err := assertions.get(job)
+		if err != nil {
+			return time.Time{}, err
+		}
+		assert.Equal(t, "assertion of "+job.source(), assertion)
+		return expires, nil
+	})
+
+	assert.Len(t, results, 4)
+	for i, result := range results {
+		assert.Equal(t, jobs[i], result.Job)
+	}
+	assert.Nil(t, results[0].Err)
+	assert.Equal(t, expires, results[1].Expires)
+	assert.EqualError(t, results[3].Err, "authentication failed")
+	assert.Equal(t, 2, maxRunning)
+	assert.Equal(t, map[string]int{"idp_account:service": 1, "assertion_file:assertion": 1, "idp_account:other": 1}, fetched)
+}
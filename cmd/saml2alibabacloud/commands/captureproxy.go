@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"log"
+	"net"
+	"time"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/captureproxy"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/pkg/errors"
+)
+
+// captureProxyTimeout how long the capture proxy waits for the browser to complete the sign in
+const captureProxyTimeout = 5 * time.Minute
+
+// captureProxyCAPath the certificate authority of the capture proxy, shared by every context as the browser trusts it
+var captureProxyCAPath = captureproxy.DefaultCAPath
+
+// captureAssertion run the capture proxy on addr and wait for the browser of the user, signing in to the IdP with
+// whatever MFA it asks for, to post the SAML assertion to the Alibaba Cloud sign in
+func captureAssertion(account *cfg.IDPAccount, addr string) (string, error) {
+	hosts := []string{saml2alibabacloud.PartitionChina.SigninHost, saml2alibabacloud.PartitionInternational.SigninHost}
+
+	ca, caPath, created, err := captureproxy.LoadOrCreateCA(captureProxyCAPath, hosts)
+	if err != nil {
+		return "", err
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", errors.Wrap(err, "error starting capture proxy")
+	}
+
+	if created {
+		log.Printf("Created the certificate authority %s, add it to the trusted authorities of the browser in place of any previous one", caPath)
+	}
+	log.Printf("Set the proxy of the browser to http://%s and sign in to %s, waiting up to %v", l.Addr(), account.URL, captureProxyTimeout)
+
+	samlAssertion, err := captureproxy.New(ca, hosts).Wait(l, captureProxyTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	log.Println("Captured the SAML assertion, the browser can be set back to its usual proxy")
+
+	return samlAssertion, nil
+}
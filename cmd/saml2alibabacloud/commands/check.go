@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"log"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/pkg/errors"
+)
+
+// checkWrittenProfile make sure the profile just written can be used, with the installed AlibabaCloud CLI when there
+// is one, otherwise by calling STS with the credentials directly
+func checkWrittenProfile(account *cfg.IDPAccount, alibabacloudCreds *alibabacloudconfig.AliCloudCredentials) error {
+	cli, err := alibabacloudconfig.DetectCLI()
+	if err != nil {
+		return errors.Wrap(err, "error detecting the AlibabaCloud CLI")
+	}
+
+	if cli == nil {
+		log.Println("AlibabaCloud CLI not found on the PATH, checking the credentials with STS instead")
+
+		valid, err := checkToken(alibabacloudCreds, account)
+		if err != nil {
+			return errors.Wrapf(err, "error checking the credentials of profile %s", account.Profile)
+		}
+		if !valid {
+			return errors.Errorf("the credentials written to profile %s have already expired", account.Profile)
+		}
+		log.Println("Profile", account.Profile, "is healthy")
+		return nil
+	}
+
+	log.Printf("Found AlibabaCloud CLI %s at %s", cli.Version, cli.Path)
+
+	mode, err := alibabacloudconfig.ProfileMode(account.Profile)
+	if err != nil {
+		return errors.Wrap(err, "error reading the AlibabaCloud CLI configuration")
+	}
+
+	for _, problem := range cli.Incompatibilities(mode) {
+		log.Println("WARNING:", problem)
+	}
+
+	arn, err := cli.CheckProfile(account.Profile)
+	if err != nil {
+		return errors.Wrapf(err, "profile %s was written but the AlibabaCloud CLI can't use it", account.Profile)
+	}
+
+	log.Println("Profile", account.Profile, "is healthy, the AlibabaCloud CLI is logged in as:", arn)
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/clockcheck"
+	"github.com/sirupsen/logrus"
+)
+
+// clock_check modes, warn is used when none is configured
+const (
+	clockCheckWarn   = "warn"
+	clockCheckRefuse = "refuse"
+	clockCheckOff    = "off"
+)
+
+// checkClock compare the local clock with the time source of the account before logging in, a drift beyond
+// clock_skew_tolerance gets the assertion or the STS request rejected without saying why
+func checkClock(account *cfg.IDPAccount) error {
+	mode := strings.ToLower(account.ClockCheck)
+	if mode == clockCheckOff {
+		return nil
+	}
+	if mode != "" && mode != clockCheckWarn && mode != clockCheckRefuse {
+		return fmt.Errorf("invalid clock_check: %s, use warn, refuse or off", account.ClockCheck)
+	}
+
+	source := account.ClockSource
+	if source == "" {
+		source = clockcheck.DefaultSource
+	}
+
+	offset, err := clockcheck.Offset(nil, source)
+	if err != nil {
+		// an unreachable time source must not stop the login, STS will say soon enough if it is unreachable too
+		logrus.WithError(err).Debug("unable to check the local clock")
+		return nil
+	}
+
+	return clockDriftError(offset, account, mode)
+}
+
+// clockDriftError report the drift when it is beyond the tolerance, an error in refuse mode, a warning otherwise
+func clockDriftError(offset time.Duration, account *cfg.IDPAccount, mode string) error {
+	tolerance := time.Duration(account.ClockSkewTolerance) * time.Second
+	if tolerance <= 0 {
+		tolerance = cfg.DefaultClockSkewTolerance * time.Second
+	}
+
+	drift := offset
+	direction := "behind"
+	if drift < 0 {
+		drift = -drift
+		direction = "ahead of"
+	}
+
+	logrus.WithField("offset", offset).Debug("checked the local clock")
+
+	if drift <= tolerance {
+		return nil
+	}
+
+	msg := fmt.Sprintf("the local clock is %v %s the time source, the IdP assertion or STS will likely be rejected, please synchronise the clock of this machine", drift.Round(time.Second), direction)
+	if mode == clockCheckRefuse {
+		return fmt.Errorf("%s", msg)
+	}
+
+	log.Println("WARNING:", msg)
+	return nil
+}
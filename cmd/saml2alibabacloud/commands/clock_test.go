@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockDriftError(t *testing.T) {
+	account := &cfg.IDPAccount{ClockSkewTolerance: 60}
+
+	assert.NoError(t, clockDriftError(45*time.Second, account, clockCheckRefuse))
+	assert.NoError(t, clockDriftError(-45*time.Second, account, clockCheckRefuse))
+	assert.NoError(t, clockDriftError(5*time.Minute, account, clockCheckWarn))
+
+	err := clockDriftError(-5*time.Minute, account, clockCheckRefuse)
+	assert.EqualError(t, err, "the local clock is 5m0s ahead of the time source, the IdP assertion or STS will likely be rejected, please synchronise the clock of this machine")
+
+	assert.Error(t, clockDriftError(31*time.Second, &cfg.IDPAccount{}, clockCheckRefuse))
+}
+
+func TestCheckClockInvalidMode(t *testing.T) {
+	assert.NoError(t, checkClock(&cfg.IDPAccount{ClockCheck: "off"}))
+	assert.Error(t, checkClock(&cfg.IDPAccount{ClockCheck: "sometimes"}))
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/pkg/errors"
+)
+
+// cloudShellRegion the region of the Cloud Shell profile when neither the credentials nor the account give one
+const cloudShellRegion = "cn-hangzhou"
+
+// CloudShell print a snippet which, pasted into Cloud Shell, configures the aliyun CLI of the session with the credentials
+// of the profile, so the same role is used there as locally
+func CloudShell(execFlags *flags.LoginExecFlags) error {
+	account, err := buildIdpAccount(execFlags)
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	sharedCreds := alibabacloudconfig.NewSharedCredentials(account.Profile)
+
+	exist, err := sharedCreds.CredsExists()
+	if err != nil {
+		return errors.Wrap(err, "error loading credentials")
+	}
+	if !exist {
+		return fmt.Errorf("no credentials for profile %s, login first", account.Profile)
+	}
+
+	alibabacloudCreds, err := sharedCreds.Load()
+	if err != nil {
+		return errors.Wrap(err, "error loading credentials")
+	}
+	if alibabacloudCreds.Expired() {
+		return fmt.Errorf("the credentials of profile %s have expired, login again first", account.Profile)
+	}
+
+	if alibabacloudCreds.Region == "" {
+		alibabacloudCreds.Region = account.Region
+	}
+
+	partition := saml2alibabacloud.PartitionChina
+	if alibabacloudCreds.Partition != "" {
+		if partition, err = saml2alibabacloud.LookupPartition(alibabacloudCreds.Partition); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Paste the following into the terminal of %s, it holds the credentials of %s until %s", partition.ShellURL, alibabacloudCreds.PrincipalARN, alibabacloudCreds.Expires.Local().Format(time.RFC3339))
+
+	out, err := openOutput(account, execFlags.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return writeCloudShellSnippet(out, account.Profile, alibabacloudCreds)
+}
+
+// writeCloudShellSnippet the commands adding the credentials to the aliyun CLI of Cloud Shell as a profile of the same
+// name and making it the one used by the session, in a single line so it pastes as one command
+func writeCloudShellSnippet(out io.Writer, profile string, alibabacloudCreds *alibabacloudconfig.AliCloudCredentials) error {
+	region := alibabacloudCreds.Region
+	if region == "" {
+		region = cloudShellRegion
+	}
+
+	_, err := fmt.Fprintf(out, "aliyun configure set --profile %s --mode StsToken --region %s --access-key-id %s --access-key-secret %s --sts-token %s && export ALIBABA_CLOUD_PROFILE=%s\n",
+		shellQuote(profile),
+		shellQuote(region),
+		shellQuote(alibabacloudCreds.AliCloudAccessKey),
+		shellQuote(alibabacloudCreds.AliCloudSecretKey),
+		shellQuote(alibabacloudCreds.AliCloudSecurityToken),
+		shellQuote(profile),
+	)
+	return err
+}
+
+// shellQuote the value single quoted for bash, the shell of Cloud Shell
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,20 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCloudShellSnippet(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := writeCloudShellSnippet(out, "prod", &alibabacloudconfig.AliCloudCredentials{
+		AliCloudAccessKey:     "STS.key",
+		AliCloudSecretKey:     "sec'ret",
+		AliCloudSecurityToken: "token",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, `aliyun configure set --profile 'prod' --mode StsToken --region 'cn-hangzhou' --access-key-id 'STS.key' --access-key-secret 'sec'\''ret' --sts-token 'token' && export ALIBABA_CLOUD_PROFILE='prod'`+"\n", out.String())
+}
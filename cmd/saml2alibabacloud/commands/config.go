@@ -0,0 +1,260 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"runtime"
+	"text/tabwriter"
+
+	"github.com/aliyun/saml2alibabacloud/helper/filekeyring"
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// the severities of the lint findings
+const (
+	lintHigh   = "high"
+	lintMedium = "medium"
+)
+
+// lintPasswordEnvs the environment variables which hold a secret in plain text
+var lintPasswordEnvs = []string{"SAML2ALIBABACLOUD_PASSWORD", keyringPasswordEnv, "ONELOGIN_CLIENT_SECRET"}
+
+// lintFinding an insecure setting found by config lint
+type lintFinding struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	// Target the idp account, file or environment variable of the finding
+	Target  string `json:"target"`
+	Message string `json:"message"`
+	// Fixed whether config lint --fix corrected it
+	Fixed bool `json:"fixed"`
+}
+
+// ConfigMigrate rename the old keys of the configuration file, those of saml2aws for example, and report the keys
+// and values which need looking at
+func ConfigMigrate(commonFlags *flags.CommonFlags, dryRun bool) error {
+	cfgm, err := cfg.NewConfigManager(commonFlags.ConfigFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load configuration")
+	}
+
+	notes, err := cfgm.Migrate(dryRun)
+	if err != nil {
+		return errors.Wrap(err, "failed to migrate configuration")
+	}
+
+	if len(notes) == 0 {
+		fmt.Println("The configuration is up to date")
+		return nil
+	}
+
+	migrated := 0
+	for _, note := range notes {
+		status := "warning "
+		if note.Migrated {
+			status = "migrated"
+			migrated++
+		}
+		fmt.Printf("%s  %s\n", status, note)
+	}
+
+	switch {
+	case migrated == 0:
+	case dryRun:
+		log.Printf("%d keys would be migrated, run again without --dry-run to update the configuration file", migrated)
+	default:
+		log.Printf("%d keys migrated, the original configuration file has been kept with a .bak suffix", migrated)
+	}
+
+	return nil
+}
+
+// ConfigLint report the insecure settings of the configuration file and of the environment, and the files holding
+// credentials which others can read, fix restricts them to the user, fails when something is left to correct
+func ConfigLint(commonFlags *flags.CommonFlags, maxSessionDuration int, fix, asJSON bool) error {
+	configFile := commonFlags.ConfigFile
+	if configFile == "" {
+		configFile = cfg.DefaultConfigPath
+	}
+
+	files := append([]string{configFile, alibabacloudconfig.ConfigFilename(), filekeyring.DefaultPath}, statePaths()...)
+
+	findings, err := lintConfig(configFile, files, os.Getenv, maxSessionDuration, fix)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if findings == nil {
+			findings = []*lintFinding{}
+		}
+		if err := enc.Encode(findings); err != nil {
+			return err
+		}
+	} else if len(findings) == 0 {
+		fmt.Println("No insecure settings found")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SEVERITY\tCHECK\tTARGET\tMESSAGE")
+		for _, f := range findings {
+			message := f.Message
+			if f.Fixed {
+				message += " (fixed)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Severity, f.Check, f.Target, message)
+		}
+		w.Flush()
+	}
+
+	left := 0
+	for _, f := range findings {
+		if !f.Fixed {
+			left++
+		}
+	}
+	if left > 0 {
+		return errors.Errorf("%d insecure settings found", left)
+	}
+	return nil
+}
+
+// lintConfig check the idp accounts of configFile, the environment read with getenv and the permissions of files and
+// of those the accounts write to, those which don't exist are skipped
+func lintConfig(configFile string, files []string, getenv func(string) string, maxSessionDuration int, fix bool) ([]*lintFinding, error) {
+	var findings []*lintFinding
+
+	cfgm, err := cfg.NewConfigManager(configFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load configuration")
+	}
+
+	names, err := cfgm.IDPAccountNames()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load configuration")
+	}
+
+	for _, name := range names {
+		account, err := cfgm.LoadIDPAccount(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load idp account %s", name)
+		}
+		findings = append(findings, lintAccount(name, account, maxSessionDuration)...)
+		files = append(files, accountFiles(account)...)
+	}
+
+	for _, env := range lintPasswordEnvs {
+		if getenv(env) != "" {
+			findings = append(findings, &lintFinding{Check: "plain_env_password", Severity: lintMedium, Target: env,
+				Message: "holds a secret in plain text, readable by every process of the session, use the keychain instead"})
+		}
+	}
+
+	for _, file := range files {
+		finding, err := lintFileMode(file, fix)
+		if err != nil {
+			return nil, err
+		}
+		if finding != nil {
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings, nil
+}
+
+// lintAccount the insecure settings of an idp account
+func lintAccount(name string, account *cfg.IDPAccount, maxSessionDuration int) []*lintFinding {
+	var findings []*lintFinding
+
+	if account.SkipVerify {
+		message := "disables the TLS verification of every IdP host"
+		if account.SkipVerifyHosts != "" {
+			message = "disables the TLS verification of " + account.SkipVerifyHosts
+		}
+		findings = append(findings, &lintFinding{Check: "skip_verify", Severity: lintHigh, Target: name, Message: message})
+	}
+
+	if u, err := url.Parse(account.URL); err == nil && u.Scheme == "http" {
+		findings = append(findings, &lintFinding{Check: "insecure_url", Severity: lintHigh, Target: name,
+			Message: fmt.Sprintf("url %s sends the password unencrypted", account.URL)})
+	}
+
+	if account.ClientKeyPIN != "" {
+		findings = append(findings, &lintFinding{Check: "client_key_pin", Severity: lintMedium, Target: name,
+			Message: "the PIN of the client key is kept in plain text next to it"})
+	}
+
+	if maxSessionDuration > 0 && account.SessionDuration > maxSessionDuration {
+		findings = append(findings, &lintFinding{Check: "session_duration", Severity: lintMedium, Target: name,
+			Message: fmt.Sprintf("alibabacloud_session_duration %d is longer than %d seconds", account.SessionDuration, maxSessionDuration)})
+	}
+
+	return findings
+}
+
+// accountFiles the files the idp account writes login events and failure reports to
+func accountFiles(account *cfg.IDPAccount) []string {
+	var files []string
+
+	if account.AnalyticsExport != "" {
+		files = append(files, account.AnalyticsExport)
+	}
+
+	if u, err := url.Parse(account.TelemetryURL); err == nil && u.Scheme == "file" && u.Path != "" {
+		files = append(files, u.Path)
+	}
+
+	return files
+}
+
+// lintFileMode a finding when the group or others can access filename, restricting it to the user with fix, the
+// permissions aren't checked on Windows
+func lintFileMode(filename string, fix bool) (*lintFinding, error) {
+	if runtime.GOOS == "windows" {
+		return nil, nil
+	}
+
+	path, err := homedir.Expand(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error resolving path %s", filename)
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", path)
+	}
+
+	mode := info.Mode().Perm()
+	if mode&0077 == 0 {
+		return nil, nil
+	}
+
+	severity := lintMedium
+	if mode&0004 != 0 {
+		severity = lintHigh
+	}
+
+	finding := &lintFinding{Check: "file_permissions", Severity: severity, Target: path,
+		Message: fmt.Sprintf("mode %04o lets other users read credentials, it should be 0600", mode)}
+
+	if fix {
+		if err := os.Chmod(path, mode&0700); err != nil {
+			return nil, errors.Wrapf(err, "error restricting the permissions of %s", path)
+		}
+		finding.Fixed = true
+	}
+
+	return finding, nil
+}
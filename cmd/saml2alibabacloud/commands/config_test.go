@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lint")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	events := filepath.Join(dir, "events.csv")
+	assert.Nil(t, ioutil.WriteFile(events, []byte("time,account\n"), 0644))
+
+	configFile := filepath.Join(dir, "config")
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte("[default]\nprovider = KeyCloak\nurl = https://id.example.com\nalibabacloud_session_duration = 3600\nanalytics_export = "+events+"\n\n[lab]\nprovider = ADFS\nurl = http://adfs.lab.example.com\nskip_verify = true\nalibabacloud_session_duration = 43200\n"), 0644))
+	sessions := filepath.Join(dir, "sessions.json")
+	assert.Nil(t, ioutil.WriteFile(sessions, []byte("{}"), 0600))
+
+	env := map[string]string{"SAML2ALIBABACLOUD_PASSWORD": "secret"}
+	findings, err := lintConfig(configFile, []string{configFile, sessions, filepath.Join(dir, "missing.json")}, func(key string) string { return env[key] }, 14400, true)
+	assert.Nil(t, err)
+
+	var checks []string
+	for _, f := range findings {
+		checks = append(checks, f.Target+" "+f.Check)
+	}
+	assert.Equal(t, []string{"lab skip_verify", "lab insecure_url", "lab session_duration", "SAML2ALIBABACLOUD_PASSWORD plain_env_password", configFile + " file_permissions", events + " file_permissions"}, checks)
+	assert.Equal(t, lintHigh, findings[4].Severity)
+	assert.True(t, findings[4].Fixed)
+
+	info, err := os.Stat(configFile)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	info, err = os.Stat(events)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// once fixed only the settings of the accounts are left
+	findings, err = lintConfig(configFile, []string{configFile}, func(string) string { return "" }, 14400, false)
+	assert.Nil(t, err)
+	assert.Len(t, findings, 3)
+}
+
+func TestAccountFiles(t *testing.T) {
+	account := &cfg.IDPAccount{AnalyticsExport: "~/events.csv", TelemetryURL: "file:///var/log/saml2alibabacloud/failures.jsonl"}
+	assert.Equal(t, []string{"~/events.csv", "/var/log/saml2alibabacloud/failures.jsonl"}, accountFiles(account))
+
+	assert.Nil(t, accountFiles(&cfg.IDPAccount{TelemetryURL: "https://telemetry.example.com/reports"}))
+}
@@ -4,11 +4,13 @@ import (
 	"log"
 	"os"
 	"path"
+	"strings"
 
 	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
 	"github.com/aliyun/saml2alibabacloud/helper/credentials"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/idn"
 	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider/onelogin"
 	"github.com/pkg/errors"
@@ -33,6 +35,12 @@ func Configure(configFlags *flags.CommonFlags) error {
 		return errors.Wrap(err, "failed to load idp account")
 	}
 
+	defined, err := cfgm.IsIDPAccountDefined(idpAccountName)
+	if err != nil {
+		return errors.Wrap(err, "failed to load idp account")
+	}
+	saved := *account
+
 	// update username and hostname if supplied
 	flags.ApplyFlagOverrides(configFlags, account)
 
@@ -42,11 +50,22 @@ func Configure(configFlags *flags.CommonFlags) error {
 		if err != nil {
 			return errors.Wrap(err, "failed to input configuration")
 		}
+	}
 
-		if credentials.SupportsStorage() {
-			if err := storeCredentials(configFlags, account); err != nil {
-				return err
-			}
+	if defined && !confirmChanges(idpAccountName, &saved, account, !configFlags.SkipPrompt) {
+		log.Printf("Configuration left unchanged for IDP account: %s", idpAccountName)
+		return nil
+	}
+
+	if !configFlags.SkipPrompt && !configFlags.DisableKeychain {
+		if err := applyKeyringFallback(account); err != nil {
+			return err
+		}
+	}
+
+	if !configFlags.SkipPrompt && credentials.SupportsStorage() {
+		if err := storeCredentials(configFlags, account); err != nil {
+			return err
 		}
 	}
 
@@ -60,22 +79,54 @@ func Configure(configFlags *flags.CommonFlags) error {
 	log.Println("")
 	log.Printf("Configuration saved for IDP account: %s", idpAccountName)
 
+	if configFlags.RegisterAliyunProcess {
+		return registerAliyunProcess(idpAccountName, account, configFlags)
+	}
+
 	return nil
 }
 
+// confirmChanges show what changes in the existing idp account, asking whether to save them when interactive
+func confirmChanges(idpAccountName string, saved, account *cfg.IDPAccount, interactive bool) bool {
+	changes := cfg.Diff(saved, account)
+	if len(changes) == 0 {
+		log.Printf("No changes to IDP account: %s", idpAccountName)
+		return true
+	}
+
+	log.Printf("Changes to IDP account %s:", idpAccountName)
+	for _, change := range changes {
+		log.Printf("  %s", change)
+	}
+
+	if !interactive {
+		return true
+	}
+
+	answer := prompter.String("Save these changes? (y/N)", "N")
+	return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+}
+
 func storeCredentials(configFlags *flags.CommonFlags, account *cfg.IDPAccount) error {
 	if configFlags.DisableKeychain {
 		return nil
 	}
+
+	// the keychain entries are looked up with the punycode form of an internationalized hostname
+	serverURL, err := idn.ToASCII(account.URL)
+	if err != nil {
+		return errors.Wrap(err, "error parsing url")
+	}
+
 	if configFlags.Password != "" {
-		if err := credentials.SaveCredentials(account.URL, account.Username, configFlags.Password); err != nil {
+		if err := credentials.SaveCredentials(serverURL, account.Username, configFlags.Password); err != nil {
 			return errors.Wrap(err, "error storing password in keychain")
 		}
 	} else {
 		password := prompter.Password("Password")
 		if password != "" {
 			if confirmPassword := prompter.Password("Confirm"); confirmPassword == password {
-				if err := credentials.SaveCredentials(account.URL, account.Username, password); err != nil {
+				if err := credentials.SaveCredentials(serverURL, account.Username, password); err != nil {
 					return errors.Wrap(err, "error storing password in keychain")
 				}
 			} else {
@@ -91,7 +142,7 @@ func storeCredentials(configFlags *flags.CommonFlags, account *cfg.IDPAccount) e
 			log.Println("OneLogin provider requires --client_id and --client_secret flags to be set.")
 			os.Exit(1)
 		}
-		if err := credentials.SaveCredentials(path.Join(account.URL, OneLoginOAuthPath), configFlags.ClientID, configFlags.ClientSecret); err != nil {
+		if err := credentials.SaveCredentials(path.Join(serverURL, OneLoginOAuthPath), configFlags.ClientID, configFlags.ClientSecret); err != nil {
 			return errors.Wrap(err, "error storing client_id and client_secret in keychain")
 		}
 	}
@@ -0,0 +1,182 @@
+package commands
+
+import (
+	b64 "encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+)
+
+// the flow steps checked by provider-test, in order
+const (
+	stepClient       = "client"
+	stepAuthenticate = "authenticate"
+	stepAssertion    = "assertion"
+	stepRoles        = "roles"
+	stepValidity     = "validity"
+	stepReplay       = "replay"
+)
+
+// conformanceResult the outcome of one flow step with one MFA type
+type conformanceResult struct {
+	MFA    string
+	Step   string
+	Err    error
+	Detail string
+}
+
+// ProviderTest run the provider of the IdP account through its flow for each MFA type and report which steps pass,
+// against the live IdP, optionally recording the exchanges, or replaying a recorded fixture suite
+func ProviderTest(loginFlags *flags.LoginExecFlags, mfas []string, fixtures, record string) error {
+	account, err := buildIdpAccount(loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	if len(mfas) == 0 {
+		mfas = []string{account.MFA}
+	}
+
+	var loginDetails *creds.LoginDetails
+	if fixtures == "" {
+		loginDetails, err = resolveLoginDetails(account, loginFlags)
+		if err != nil {
+			return errors.Wrap(err, "error resolving login details")
+		}
+	} else {
+		// nothing is verified when replaying, the recording only needs a consistent set of details
+		loginDetails = &creds.LoginDetails{
+			URL:      account.URL,
+			Username: account.Username,
+			Password: "fixture",
+			MFAToken: loginFlags.CommonFlags.MFAToken,
+		}
+		if loginDetails.MFAToken == "" {
+			loginDetails.MFAToken = "000000"
+		}
+	}
+
+	if record != "" {
+		if err := os.MkdirAll(record, 0700); err != nil {
+			return errors.Wrap(err, "error creating recording directory")
+		}
+	}
+
+	defer func() { provider.WrapTransport = nil }()
+
+	var results []*conformanceResult
+	for _, mfa := range mfas {
+		results = append(results, runConformance(account, mfa, loginDetails, fixtures, record)...)
+	}
+
+	failed := printConformance(os.Stdout, results)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d provider checks failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// runConformance check each flow step of the provider with a single MFA type, stopping at the first failure
+func runConformance(account *cfg.IDPAccount, mfa string, loginDetails *creds.LoginDetails, fixtures, record string) []*conformanceResult {
+	var results []*conformanceResult
+	check := func(step string, err error, detail string) bool {
+		results = append(results, &conformanceResult{MFA: mfa, Step: step, Err: err, Detail: detail})
+		return err == nil
+	}
+
+	var recorder *provider.Recorder
+	var replayer *provider.Replayer
+
+	switch {
+	case fixtures != "":
+		var err error
+		replayer, err = provider.LoadReplayer(filepath.Join(fixtures, mfa+".json"))
+		if err != nil {
+			check(stepReplay, err, "")
+			return results
+		}
+		provider.WrapTransport = func(http.RoundTripper) http.RoundTripper { return replayer }
+	case record != "":
+		recorder = &provider.Recorder{}
+		provider.WrapTransport = recorder.Wrap
+	}
+
+	testAccount := *account
+	testAccount.MFA = mfa
+
+	details := *loginDetails
+
+	client, err := saml2alibabacloud.NewSAMLClient(&testAccount)
+	if !check(stepClient, err, testAccount.Provider) {
+		return results
+	}
+
+	samlAssertion, err := client.Authenticate(&details)
+	if err == nil && samlAssertion == "" {
+		err = errors.New("no SAML assertion returned")
+	}
+
+	if recorder != nil {
+		if serr := recorder.Save(filepath.Join(record, mfa+".json")); serr != nil && err == nil {
+			err = errors.Wrap(serr, "error saving recording")
+		}
+	}
+
+	if !check(stepAuthenticate, err, "") {
+		return results
+	}
+
+	data, err := b64.StdEncoding.DecodeString(samlAssertion)
+	if !check(stepAssertion, err, fmt.Sprintf("%d bytes", len(data))) {
+		return results
+	}
+
+	roles, err := parseRamRoles(samlAssertion)
+	if !check(stepRoles, err, fmt.Sprintf("%d roles", len(roles))) {
+		return results
+	}
+
+	validity, err := saml2alibabacloud.ExtractAssertionValidity(data)
+	detail := ""
+	if err == nil && !validity.NotOnOrAfter.IsZero() {
+		detail = "expires " + validity.NotOnOrAfter.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if !check(stepValidity, err, detail) {
+		return results
+	}
+
+	if replayer != nil && replayer.Remaining() > 0 {
+		check(stepReplay, fmt.Errorf("%d recorded exchanges were not used", replayer.Remaining()), "")
+	}
+
+	return results
+}
+
+func printConformance(out io.Writer, results []*conformanceResult) int {
+	failed := 0
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MFA\tSTEP\tRESULT\tDETAIL")
+	for _, r := range results {
+		result, detail := "pass", r.Detail
+		if r.Err != nil {
+			failed++
+			result, detail = "FAIL", r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.MFA, r.Step, result, detail)
+	}
+	w.Flush()
+
+	return failed
+}
@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderTestFixtures(t *testing.T) {
+	assertion, err := ioutil.ReadFile("../../../testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	dir, err := ioutil.TempDir("", "fixtures")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	page := `<form method="post"><input name="SAMLResponse" value="` + b64.StdEncoding.EncodeToString(assertion) + `"/></form>`
+	recorder, err := json.Marshal([]*provider.Exchange{
+		{Method: "GET", URL: "https://idp.example.com/saml/sso", Status: 200, Header: http.Header{"Content-Type": {"text/html"}}, Body: page},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "Auto.json"), recorder, 0600))
+	defer func() { provider.WrapTransport = nil }()
+
+	account := &cfg.IDPAccount{URL: "https://idp.example.com/saml/sso", Provider: "Authelia", MFA: "Auto"}
+	loginDetails := &creds.LoginDetails{URL: account.URL, Username: "user", Password: "fixture"}
+
+	results := runConformance(account, "Auto", loginDetails, dir, "")
+	var steps []string
+	for _, r := range results {
+		assert.Nil(t, r.Err, r.Step)
+		steps = append(steps, r.Step)
+	}
+	assert.Equal(t, []string{stepClient, stepAuthenticate, stepAssertion, stepRoles, stepValidity}, steps)
+
+	results = runConformance(account, "TOTP", loginDetails, dir, "")
+	assert.Len(t, results, 1)
+	assert.Equal(t, stepReplay, results[0].Step)
+
+	var out bytes.Buffer
+	assert.Equal(t, 1, printConformance(&out, results))
+	assert.Contains(t, out.String(), "FAIL")
+}
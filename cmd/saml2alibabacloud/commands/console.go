@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/aliyun/saml2alibabacloud"
 	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/flags"
@@ -15,10 +16,7 @@ import (
 	"github.com/skratchdot/open-golang/open"
 )
 
-const (
-	federationURL = "https://signin.aliyun.com/federation"
-	issuer        = "saml2alibabacloud"
-)
+const issuer = "saml2alibabacloud"
 
 // Console open the AlibabaCloud console from the CLI
 func Console(consoleFlags *flags.ConsoleFlags) error {
@@ -28,6 +26,10 @@ func Console(consoleFlags *flags.ConsoleFlags) error {
 		return errors.Wrap(err, "error building login details")
 	}
 
+	if consoleFlags.LoginExecFlags.CommonFlags.Offline {
+		return errors.New("the console sign in requires network access and is not available with --offline")
+	}
+
 	sharedCreds := alibabacloudconfig.NewSharedCredentials(account.Profile)
 
 	// this checks if the credentials file has been created yet
@@ -51,17 +53,23 @@ func Console(consoleFlags *flags.ConsoleFlags) error {
 		return errors.Wrap(err, "error logging in")
 	}
 
+	// the credentials of an assumed role are federated in the partition of the credentials they were assumed with
+	partition, err := credentialsPartition(alibabacloudCreds, account)
+	if err != nil {
+		return err
+	}
+
 	if consoleFlags.LoginExecFlags.ExecProfile != "" {
 		// Assume the desired role before generating env vars
-		alibabacloudCreds, err = assumeRoleWithProfile(alibabacloudCreds, consoleFlags.LoginExecFlags.ExecProfile, consoleFlags.LoginExecFlags.CommonFlags.SessionDuration)
+		alibabacloudCreds, err = assumeRoleWithProfile(alibabacloudCreds, account, consoleFlags.LoginExecFlags.ExecProfile, consoleFlags.LoginExecFlags.CommonFlags.SessionDuration)
 		if err != nil {
 			return errors.Wrap(err,
 				fmt.Sprintf("error acquiring credentials for profile: %s", consoleFlags.LoginExecFlags.ExecProfile))
 		}
 	}
 
-	log.Printf("Presenting credentials for %s to %s", account.Profile, federationURL)
-	return federatedLogin(alibabacloudCreds, consoleFlags)
+	log.Printf("Presenting credentials for %s to %s", account.Profile, partition.FederationURL())
+	return federatedLogin(alibabacloudCreds, partition, consoleFlags)
 }
 
 func loadOrLogin(account *cfg.IDPAccount, sharedCreds *alibabacloudconfig.CredentialsProvider, execFlags *flags.ConsoleFlags) (*alibabacloudconfig.AliCloudCredentials, error) {
@@ -82,7 +90,7 @@ func loadOrLogin(account *cfg.IDPAccount, sharedCreds *alibabacloudconfig.Creden
 		return loginRefreshCredentials(sharedCreds, execFlags.LoginExecFlags)
 	}
 
-	ok, err := checkToken(alibabacloudCreds)
+	ok, err := validateCachedToken(alibabacloudCreds, account, false)
 	if err != nil {
 		return nil, errors.Wrap(err, "error validating token")
 	}
@@ -104,7 +112,7 @@ func loginRefreshCredentials(sharedCreds *alibabacloudconfig.CredentialsProvider
 	return sharedCreds.Load()
 }
 
-func federatedLogin(creds *alibabacloudconfig.AliCloudCredentials, consoleFlags *flags.ConsoleFlags) error {
+func federatedLogin(creds *alibabacloudconfig.AliCloudCredentials, partition *saml2alibabacloud.Partition, consoleFlags *flags.ConsoleFlags) error {
 	jsonBytes, err := json.Marshal(map[string]string{
 		"sessionId":    creds.AliCloudAccessKey,
 		"sessionKey":   creds.AliCloudSecretKey,
@@ -114,7 +122,7 @@ func federatedLogin(creds *alibabacloudconfig.AliCloudCredentials, consoleFlags
 		return err
 	}
 
-	req, err := http.NewRequest("GET", federationURL, nil)
+	req, err := http.NewRequest("GET", partition.FederationURL(), nil)
 	if err != nil {
 		return err
 	}
@@ -149,13 +157,11 @@ func federatedLogin(creds *alibabacloudconfig.AliCloudCredentials, consoleFlags
 		return err
 	}
 
-	destination := "https://home.console.aliyun.com/"
-
 	loginURL := fmt.Sprintf(
 		"%s?Action=login&Issuer=%s&Destination=%s&SigninToken=%s",
-		federationURL,
+		partition.FederationURL(),
 		issuer,
-		url.QueryEscape(destination),
+		url.QueryEscape(partition.ConsoleURL),
 		url.QueryEscape(signinToken),
 	)
 
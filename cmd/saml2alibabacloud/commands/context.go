@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/fingerprint"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/aliyun/saml2alibabacloud/pkg/loginlock"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/aliyun/saml2alibabacloud/pkg/sessioncache"
+	"github.com/sirupsen/logrus"
+)
+
+// the state files of the selected context, see UseContext
+var (
+	sessionsPath = sessioncache.DefaultPath
+	rolesPath    = sessioncache.DefaultRolesPath
+	historyPath  = journal.DefaultPath
+	lockPath     = loginlock.DefaultPath
+)
+
+// UseContext move the configuration and caches to the root of the context given with --context, so the accounts,
+// IdP sessions, remembered roles, history, profile records and configuration backups of one context are never seen
+// from another
+func UseContext(commonFlags *flags.CommonFlags) error {
+	if commonFlags.Context == "" {
+		return nil
+	}
+
+	paths := map[*string]string{
+		&sessionsPath: sessioncache.DefaultPath,
+		&rolesPath:    sessioncache.DefaultRolesPath,
+		&historyPath:  journal.DefaultPath,
+		&lockPath:     loginlock.DefaultPath,
+
+		&provider.FingerprintsPath: fingerprint.DefaultPath,
+	}
+
+	// an explicit --config still wins over the configuration of the context
+	if commonFlags.ConfigFile == "" {
+		paths[&commonFlags.ConfigFile] = cfg.DefaultConfigPath
+	}
+
+	root, err := cfg.ContextRoot(commonFlags.Context)
+	if err != nil {
+		return err
+	}
+	alibabacloudconfig.StateDir = root
+
+	for target, defaultPath := range paths {
+		path, err := cfg.ContextPath(commonFlags.Context, defaultPath)
+		if err != nil {
+			return err
+		}
+		*target = path
+	}
+
+	logrus.WithField("context", commonFlags.Context).WithField("config", commonFlags.ConfigFile).Debug("using context")
+
+	return nil
+}
+
+// statePaths the state files of the selected context, those UseContext moves
+func statePaths() []string {
+	return []string{sessionsPath, rolesPath, historyPath, lockPath, provider.FingerprintsPath}
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	b64 "encoding/base64"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/sts"
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/pkg/errors"
+)
+
+// stsDefaultDuration the session duration STS applies when neither the request nor the assertion sets one
+const stsDefaultDuration = 3600
+
+// printDryRun describe the AssumeRoleWithSAML call login would make for the role, used by login --dry-run
+func printDryRun(out io.Writer, account *cfg.IDPAccount, role *saml2alibabacloud.RamRole, samlAssertion string) error {
+	request, partition, err := buildStsRequest(account, role, samlAssertion)
+	if err != nil {
+		return err
+	}
+
+	data, err := b64.StdEncoding.DecodeString(samlAssertion)
+	if err != nil {
+		return errors.Wrap(err, "error decoding saml assertion")
+	}
+
+	sessionName, err := saml2alibabacloud.ExtractRoleSessionName(data)
+	if err != nil {
+		return errors.Wrap(err, "error parsing saml assertion role session name")
+	}
+	if sessionName == "" {
+		sessionName = "none, STS refuses assertions without the RoleSessionName attribute"
+	}
+
+	duration := string(request.DurationSeconds) + "s"
+	if request.DurationSeconds == "" {
+		assertionDuration, err := saml2alibabacloud.ExtractSessionDuration(data)
+		if err != nil {
+			return errors.Wrap(err, "error parsing saml assertion session duration")
+		}
+		duration = fmt.Sprintf("not set, STS applies its default of %ds", stsDefaultDuration)
+		if assertionDuration > 0 {
+			duration = fmt.Sprintf("not set, STS applies the SessionDuration attribute of the assertion, %ds", assertionDuration)
+		}
+	}
+
+	policy := request.Policy
+	if policy == "" {
+		policy = "none, the permissions of the role apply"
+	}
+
+	fmt.Fprintln(out, "Dry run, the STS call has not been made:")
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  Action:\t%s (%s %s)\n", request.GetActionName(), request.GetProduct(), request.GetVersion())
+	fmt.Fprintf(w, "  Endpoint:\t%s://%s (%s site, region %s)\n", request.Scheme, stsEndpoint(partition.STSRegion), partition.Name, partition.STSRegion)
+	fmt.Fprintf(w, "  Role ARN:\t%s\n", request.RoleArn)
+	fmt.Fprintf(w, "  SAML provider ARN:\t%s\n", request.SAMLProviderArn)
+	fmt.Fprintf(w, "  Duration:\t%s\n", duration)
+	fmt.Fprintf(w, "  Session name:\t%s\n", sessionName)
+	fmt.Fprintf(w, "  Policy:\t%s\n", policy)
+	fmt.Fprintf(w, "  Profile:\t%s, left untouched\n", account.Profile)
+
+	return w.Flush()
+}
+
+// stsEndpoint the STS endpoint the SDK resolves for the region
+func stsEndpoint(region string) string {
+	if endpoint, ok := sts.GetEndpointMap()[region]; ok {
+		return endpoint
+	}
+	if sts.GetEndpointType() == "regional" {
+		return "sts." + region + ".aliyuncs.com"
+	}
+	return "sts.aliyuncs.com"
+}
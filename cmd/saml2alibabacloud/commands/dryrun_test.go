@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	"io/ioutil"
+	"testing"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintDryRun(t *testing.T) {
+	data, err := ioutil.ReadFile("../../../testdata/assertion.xml")
+	assert.NoError(t, err)
+
+	role := &saml2alibabacloud.RamRole{
+		RoleARN:      "acs:ram::123123123123:role/Ali-CloudAdminOps-Build",
+		PrincipalARN: "acs:ram::123123123123:saml-provider/ExampleADFS",
+	}
+
+	var out bytes.Buffer
+	err = printDryRun(&out, &cfg.IDPAccount{Profile: "build"}, role, b64.StdEncoding.EncodeToString(data))
+	assert.NoError(t, err)
+
+	assert.Contains(t, out.String(), "AssumeRoleWithSAML (Sts 2015-04-01)")
+	assert.Contains(t, out.String(), "https://sts.cn-hangzhou.aliyuncs.com (china site, region cn-hangzhou)")
+	assert.Contains(t, out.String(), "acs:ram::123123123123:role/Ali-CloudAdminOps-Build")
+	assert.Contains(t, out.String(), "acs:ram::123123123123:saml-provider/ExampleADFS")
+	assert.Contains(t, out.String(), "SessionDuration attribute of the assertion, 28800s")
+	assert.Contains(t, out.String(), "wolfeidau@example.com")
+	assert.Contains(t, out.String(), "none, the permissions of the role apply")
+	assert.Contains(t, out.String(), "build, left untouched")
+}
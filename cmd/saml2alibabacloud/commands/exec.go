@@ -3,13 +3,17 @@ package commands
 import (
 	"fmt"
 	"log"
+	"net"
+	"time"
 
 	sdkError "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/sts"
 	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/flags"
 	"github.com/aliyun/saml2alibabacloud/pkg/shell"
+	"github.com/aliyun/saml2alibabacloud/pkg/transform"
 	"github.com/pkg/errors"
 )
 
@@ -44,7 +48,7 @@ func Exec(execFlags *flags.LoginExecFlags, cmdline []string) error {
 		return errors.Wrap(err, "error loading credentials")
 	}
 
-	ok, err := checkToken(alibabacloudCreds)
+	ok, err := validateCachedToken(alibabacloudCreds, account, execFlags.CommonFlags.Offline)
 	if err != nil {
 		return errors.Wrap(err, "error validating token")
 	}
@@ -57,21 +61,30 @@ func Exec(execFlags *flags.LoginExecFlags, cmdline []string) error {
 	}
 
 	if execFlags.ExecProfile != "" {
+		if execFlags.CommonFlags.Offline {
+			return errors.New("assuming the exec profile requires network access and is not available with --offline")
+		}
+
 		// Assume the desired role before generating env vars
-		alibabacloudCreds, err = assumeRoleWithProfile(alibabacloudCreds, execFlags.ExecProfile, execFlags.CommonFlags.SessionDuration)
+		alibabacloudCreds, err = assumeRoleWithProfile(alibabacloudCreds, account, execFlags.ExecProfile, execFlags.CommonFlags.SessionDuration)
 		if err != nil {
 			return errors.Wrap(err,
 				fmt.Sprintf("error acquiring credentials for profile: %s", execFlags.ExecProfile))
 		}
 	}
 
-	return shell.ExecShellCmd(cmdline, shell.BuildEnvVars(alibabacloudCreds, account, execFlags))
+	variables, err := transform.Apply(alibabacloudCreds, account)
+	if err != nil {
+		return errors.Wrap(err, "error transforming credentials")
+	}
+
+	return shell.ExecShellCmd(cmdline, append(shell.BuildEnvVars(alibabacloudCreds, account, execFlags), transform.Environ(variables)...))
 }
 
 // assumeRoleWithProfile uses an AlibabaCloud CLI profile (via ~/.aliyun/config.json) and performs (multiple levels of) role assumption
 // This is extremely useful in the case of a central "authentication account" which then requires secondary, and
 // often tertiary, role assumptions to acquire credentials for the target role.
-func assumeRoleWithProfile(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, targetProfile string, sessionDuration int) (*alibabacloudconfig.AliCloudCredentials, error) {
+func assumeRoleWithProfile(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, account *cfg.IDPAccount, targetProfile string, sessionDuration int) (*alibabacloudconfig.AliCloudCredentials, error) {
 
 	// get target profile
 	sharedCreds := alibabacloudconfig.NewSharedCredentials(targetProfile)
@@ -98,8 +111,9 @@ func assumeRoleWithProfile(alibabacloudCreds *alibabacloudconfig.AliCloudCredent
 	if err != nil {
 		return nil, err
 	}
-	client.AppendUserAgent("saml2alibabacloud", "0.0.5")
+	identifyClient(client, account)
 	request := sts.CreateAssumeRoleRequest()
+	identifyRequest(request)
 	request.RoleSessionName = targetCreds.AliCloudSessionToken
 	request.RoleArn = targetCreds.PrincipalARN
 	request.DurationSeconds = requests.NewInteger(sessionDuration)
@@ -119,16 +133,17 @@ func assumeRoleWithProfile(alibabacloudCreds *alibabacloudconfig.AliCloudCredent
 	}, nil
 }
 
-func checkToken(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials) (bool, error) {
+func checkToken(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, account *cfg.IDPAccount) (bool, error) {
 	client, err := sts.NewClientWithStsToken("cn-hangzhou", alibabacloudCreds.AliCloudAccessKey, alibabacloudCreds.AliCloudSecretKey, alibabacloudCreds.AliCloudSecurityToken)
 
 	if err != nil {
 		return false, err
 	}
 
-	client.AppendUserAgent("saml2alibabacloud", "0.0.5")
+	identifyClient(client, account)
 
 	request := sts.CreateGetCallerIdentityRequest()
+	identifyRequest(request)
 
 	_, err = client.GetCallerIdentity(request)
 	if err != nil {
@@ -143,3 +158,29 @@ func checkToken(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials) (bool
 
 	return true, nil
 }
+
+// validateCachedToken check the cached credentials with STS, in offline mode or when STS can't be reached
+// the recorded expiry is trusted instead so work can carry on with credentials which are still valid
+func validateCachedToken(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, account *cfg.IDPAccount, offline bool) (bool, error) {
+	if offline {
+		return !alibabacloudCreds.Expired(), nil
+	}
+
+	ok, err := checkToken(alibabacloudCreds, account)
+	if err != nil && isNetworkError(err) && !alibabacloudCreds.Expired() {
+		log.Printf("Unable to reach AlibabaCloud STS, using cached credentials valid until %s", alibabacloudCreds.Expires.Local().Format(time.RFC3339))
+		return true, nil
+	}
+
+	return ok, err
+}
+
+// isNetworkError the SDK reports connection failures as a timeout once it has run out of retries
+func isNetworkError(err error) bool {
+	if clientErr, ok := err.(*sdkError.ClientError); ok {
+		return clientErr.ErrorCode() == sdkError.TimeoutErrorCode
+	}
+
+	_, ok := errors.Cause(err).(net.Error)
+	return ok
+}
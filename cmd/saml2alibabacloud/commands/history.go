@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/pkg/errors"
+)
+
+// History print the most recent login attempts recorded in the login journal
+func History(limit int, asJSON bool) error {
+	j, err := journal.New(historyPath)
+	if err != nil {
+		return err
+	}
+
+	entries, err := j.Entries()
+	if err != nil {
+		return errors.Wrap(err, "error loading login journal")
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No login attempts recorded")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACCOUNT\tPROVIDER\tPROFILE\tOUTCOME\tSTAGE\tERROR\tDURATION")
+	for _, e := range entries {
+		stage := ""
+		if e.Outcome == journal.OutcomeFailure {
+			stage = e.Stage
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%v\n", e.Time.Local().Format(time.RFC3339), e.Account, e.Provider, e.Profile, e.Outcome, stage, e.ErrorClass, e.Duration)
+	}
+
+	return w.Flush()
+}
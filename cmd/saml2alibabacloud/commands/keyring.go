@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/aliyun/saml2alibabacloud/helper/credentials"
+	"github.com/aliyun/saml2alibabacloud/helper/filekeyring"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+)
+
+// keyringPasswordEnv the variable the passphrase of the keyring file is read from, prompted for when unset
+const keyringPasswordEnv = "SAML2ALIBABACLOUD_KEYRING_PASSWORD"
+
+// applyKeyringFallback fall back to the keyring_fallback of the account when the system keyring can't be used
+func applyKeyringFallback(account *cfg.IDPAccount) error {
+	return credentials.ApplyFallback(account.KeyringFallback, newFileKeyring)
+}
+
+func newFileKeyring() (credentials.Helper, error) {
+	return filekeyring.New(filekeyring.DefaultPath, func() (string, error) {
+		if password := os.Getenv(keyringPasswordEnv); password != "" {
+			return password, nil
+		}
+		return prompter.Password("Passphrase of the saml2alibabacloud keyring file"), nil
+	})
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/pkg/errors"
+)
+
+// profileStatus a profile as listed by list-profiles --json
+type profileStatus struct {
+	*alibabacloudconfig.ProfileStatus
+	Expired   bool   `json:"expired"`
+	Remaining string `json:"remaining,omitempty"`
+}
+
+// ListProfiles print the profiles of the AlibabaCloud CLI configuration with when their credentials expire, with a
+// prompt profile only a short status meant for shell prompts is printed
+func ListProfiles(asJSON bool, prompt string) error {
+	statuses, err := alibabacloudconfig.Profiles(alibabacloudconfig.ConfigFilename())
+	if err != nil {
+		return errors.Wrap(err, "error loading AlibabaCloud CLI profiles")
+	}
+
+	now := time.Now()
+
+	if prompt != "" {
+		for _, status := range statuses {
+			if status.Name == prompt {
+				fmt.Printf("%s %s\n", status.Name, formatRemaining(status, now))
+			}
+		}
+		return nil
+	}
+
+	if asJSON {
+		out := []*profileStatus{}
+		for _, status := range statuses {
+			entry := &profileStatus{ProfileStatus: status, Expired: status.Expired()}
+			if !status.Expired() {
+				entry.Remaining = formatRemaining(status, now)
+			}
+			out = append(out, entry)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No profiles in the AlibabaCloud CLI configuration")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tMODE\tEXPIRES\tREMAINING")
+	for _, status := range statuses {
+		expires := "-"
+		if !status.Expires.IsZero() {
+			expires = status.Expires.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", status.Name, status.Mode, expires, formatRemaining(status, now))
+	}
+
+	return w.Flush()
+}
+
+// formatRemaining how long the credentials of the profile are still valid, to the minute
+func formatRemaining(status *alibabacloudconfig.ProfileStatus, now time.Time) string {
+	if status.Expires.IsZero() {
+		return "unknown"
+	}
+
+	remaining := status.Remaining(now)
+	switch {
+	case remaining <= 0:
+		return "expired"
+	case remaining < time.Minute:
+		return "<1m"
+	}
+
+	return strings.TrimSuffix(remaining.Truncate(time.Minute).String(), "0s")
+}
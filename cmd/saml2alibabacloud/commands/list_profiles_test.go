@@ -0,0 +1,19 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatRemaining(t *testing.T) {
+	now := time.Now()
+
+	assert.Equal(t, "unknown", formatRemaining(&alibabacloudconfig.ProfileStatus{}, now))
+	assert.Equal(t, "expired", formatRemaining(&alibabacloudconfig.ProfileStatus{Expires: now.Add(-time.Second)}, now))
+	assert.Equal(t, "<1m", formatRemaining(&alibabacloudconfig.ProfileStatus{Expires: now.Add(30 * time.Second)}, now))
+	assert.Equal(t, "42m", formatRemaining(&alibabacloudconfig.ProfileStatus{Expires: now.Add(42*time.Minute + 10*time.Second)}, now))
+	assert.Equal(t, "1h12m", formatRemaining(&alibabacloudconfig.ProfileStatus{Expires: now.Add(72 * time.Minute)}, now))
+}
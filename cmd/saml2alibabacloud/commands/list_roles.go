@@ -8,7 +8,10 @@ import (
 
 	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
 	"github.com/aliyun/saml2alibabacloud/helper/credentials"
+	"github.com/aliyun/saml2alibabacloud/pkg/catalog"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/hook"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -29,19 +32,24 @@ func ListRoles(loginFlags *flags.LoginExecFlags) error {
 		os.Exit(1)
 	}
 
-	err = loginDetails.Validate()
+	err = loginDetails.ValidateFor(saml2alibabacloud.AccountRequirements(account))
 	if err != nil {
 		return errors.Wrap(err, "error validating login details")
 	}
 
-	logger.WithField("idpAccount", account).Debug("building provider")
+	mirrorAccount, authDetails, err := resolveIdpMirror(account, loginDetails)
+	if err != nil {
+		return errors.Wrap(err, "error probing IdP mirrors")
+	}
+
+	logger.WithField("idpAccount", mirrorAccount).Debug("building provider")
 
-	provider, err := saml2alibabacloud.NewSAMLClient(account)
+	provider, err := saml2alibabacloud.NewSAMLClient(mirrorAccount)
 	if err != nil {
 		return errors.Wrap(err, "error building IdP client")
 	}
 
-	samlAssertion, err := provider.Authenticate(loginDetails)
+	samlAssertion, err := provider.Authenticate(authDetails)
 	if err != nil {
 		return errors.Wrap(err, "error authenticating to IdP")
 	}
@@ -60,6 +68,11 @@ func ListRoles(loginFlags *flags.LoginExecFlags) error {
 		}
 	}
 
+	samlAssertion, err = hook.Apply(samlAssertion, account)
+	if err != nil {
+		return errors.Wrap(err, "error processing saml assertion")
+	}
+
 	data, err := b64.StdEncoding.DecodeString(samlAssertion)
 	if err != nil {
 		return errors.Wrap(err, "error decoding saml assertion")
@@ -80,14 +93,14 @@ func ListRoles(loginFlags *flags.LoginExecFlags) error {
 		return errors.Wrap(err, "error parsing AlibabaCloud roles")
 	}
 
-	if err := listRoles(alibabacloudRoles, samlAssertion, loginFlags); err != nil {
+	if err := listRoles(alibabacloudRoles, samlAssertion, account, loadRoleCatalog(account)); err != nil {
 		return errors.Wrap(err, "Failed to list roles")
 	}
 
 	return nil
 }
 
-func listRoles(alibabacloudRoles []*saml2alibabacloud.RamRole, samlAssertion string, loginFlags *flags.LoginExecFlags) error {
+func listRoles(alibabacloudRoles []*saml2alibabacloud.RamRole, samlAssertion string, account *cfg.IDPAccount, roleCatalog *catalog.Catalog) error {
 	if len(alibabacloudRoles) == 1 {
 		log.Println("")
 		log.Println("Only one role to assume. Will be automatically assumed on login")
@@ -97,14 +110,9 @@ func listRoles(alibabacloudRoles []*saml2alibabacloud.RamRole, samlAssertion str
 		return errors.New("no roles available")
 	}
 
-	samlAssertionData, err := b64.StdEncoding.DecodeString(samlAssertion)
-	if err != nil {
-		return errors.Wrap(err, "error decoding saml assertion")
-	}
-
-	aud, err := saml2alibabacloud.ExtractDestinationURL(samlAssertionData)
+	_, aud, err := resolvePartition(samlAssertion, account)
 	if err != nil {
-		return errors.Wrap(err, "error parsing destination url")
+		return err
 	}
 
 	alibabacloudAccounts, err := saml2alibabacloud.ParseAlibabaCloudAccounts(aud, samlAssertion)
@@ -118,6 +126,10 @@ func listRoles(alibabacloudRoles []*saml2alibabacloud.RamRole, samlAssertion str
 	for _, account := range alibabacloudAccounts {
 		fmt.Println(account.Name)
 		for _, role := range account.Roles {
+			if annotation := roleCatalog.Annotation(role.RoleARN); annotation != "" {
+				fmt.Printf("%s (%s)\n", role.RoleARN, annotation)
+				continue
+			}
 			fmt.Println(role.RoleARN)
 		}
 		fmt.Println("")
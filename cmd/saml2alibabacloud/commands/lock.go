@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/loginlock"
+	"github.com/sirupsen/logrus"
+)
+
+// heldLock the login lock held by this process, released by the silent prompter before it exits
+var heldLock struct {
+	sync.Mutex
+	lock *loginlock.Lock
+}
+
+// acquireLoginLock wait for the logins started by parallel invocations so only one prompts the user at a time,
+// when the login waited for refreshed the credentials of the profile they are reused and reused is true, the lock is
+// then already released. A --no-write login takes no lock, it would have to create the lock file
+func acquireLoginLock(account *cfg.IDPAccount, sharedCreds *alibabacloudconfig.CredentialsProvider, loginFlags *flags.LoginExecFlags) (lock *loginlock.Lock, reused bool, err error) {
+	if loginFlags.NoWrite {
+		return nil, false, nil
+	}
+
+	before, _ := sharedCreds.Load()
+
+	lock, waited, err := loginlock.Acquire(lockPath)
+	if err != nil {
+		// logging in without the lock beats not logging in
+		logrus.WithError(err).Debug("unable to acquire the login lock")
+		return nil, false, nil
+	}
+
+	heldLock.Lock()
+	heldLock.lock = lock
+	heldLock.Unlock()
+
+	if !waited || loginFlags.Force {
+		return lock, false, nil
+	}
+
+	after, err := sharedCreds.Load()
+	if err != nil || after.Expired() || (before != nil && before.Expires.Equal(after.Expires)) {
+		return lock, false, nil
+	}
+
+	releaseLoginLock(lock)
+
+	log.Printf("Reusing the credentials of profile %s just refreshed by the other login, valid until %s", account.Profile, after.Expires.Local().Format(time.RFC3339))
+
+	return nil, true, nil
+}
+
+// releaseLoginLock let the next waiting login in, failing to do so never fails the login
+func releaseLoginLock(lock *loginlock.Lock) {
+	if lock == nil {
+		return
+	}
+
+	heldLock.Lock()
+	if heldLock.lock == lock {
+		heldLock.lock = nil
+	}
+	heldLock.Unlock()
+
+	if err := lock.Release(); err != nil {
+		logrus.WithError(err).Debug("unable to release the login lock")
+	}
+}
+
+// releaseHeldLoginLock release the login lock held by this process if any, for the paths exiting without unwinding
+func releaseHeldLoginLock() {
+	heldLock.Lock()
+	lock := heldLock.lock
+	heldLock.Unlock()
+
+	releaseLoginLock(lock)
+}
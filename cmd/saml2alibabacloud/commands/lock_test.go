@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/loginlock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSilentPrompterReleasesLoginLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "login.lock")
+	lock, _, err := loginlock.Acquire(path)
+	assert.Nil(t, err)
+	heldLock.lock = lock
+
+	code := 0
+	out := &bytes.Buffer{}
+	sp := &silentPrompter{out: out, exit: func(c int) { code = c }}
+	sp.Password("Password")
+
+	assert.Equal(t, silentExitCode, code)
+	assert.Contains(t, out.String(), `"reason":"interaction_required"`)
+	assert.Nil(t, heldLock.lock)
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
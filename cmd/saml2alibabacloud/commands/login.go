@@ -2,55 +2,245 @@ package commands
 
 import (
 	b64 "encoding/base64"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	sdkError "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/sts"
 	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
 	"github.com/aliyun/saml2alibabacloud/helper/credentials"
 	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/catalog"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
 	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/hook"
+	"github.com/aliyun/saml2alibabacloud/pkg/idn"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 // Login login to ADFS
 func Login(loginFlags *flags.LoginExecFlags) error {
+	attempt := &journal.Entry{
+		Time:    time.Now(),
+		Account: loginFlags.CommonFlags.IdpAccount,
+		Stage:   journal.StageConfig,
+	}
 
-	logger := logrus.WithField("command", "login")
+	if loginFlags.Silent {
+		enableSilent(loginFlags)
+	}
+
+	// the AlibabaCloud CLI parses everything the external command outputs, stderr included
+	if loginFlags.NoWrite && loginFlags.CredentialFormat == processFormat {
+		log.SetOutput(ioutil.Discard)
+		logrus.SetOutput(ioutil.Discard)
+	}
+
+	if loginFlags.NoWrite {
+		provider.PersistFingerprints = false
+	}
+
+	err := login(loginFlags, attempt)
+
+	// --no-write leaves the home directory as it found it, the journal included
+	if !loginFlags.NoWrite {
+		recordLoginAttempt(attempt, err)
+	}
+
+	if err != nil && loginFlags.Silent {
+		reportSilentFailure(os.Stdout, silentReason(err), err.Error())
+	}
+
+	return err
+}
+
+func login(loginFlags *flags.LoginExecFlags, attempt *journal.Entry) (err error) {
+
+	if loginFlags.NoAssume && !loginFlags.ListRolesJSON {
+		return errors.New("--no-assume requires --list-roles-json")
+	}
+
+	if loginFlags.CaptureProxy != "" && loginFlags.Silent {
+		return errors.New("--capture-proxy waits for the browser and can't be used with --silent")
+	}
 
 	account, err := buildIdpAccount(loginFlags)
 	if err != nil {
 		return errors.Wrap(err, "error building login details")
 	}
 
+	attempt.Provider = account.Provider
+	attempt.Profile = account.Profile
+
+	if !loginFlags.NoWrite {
+		defer func() { reportFailure(account, attempt, err) }()
+		defer func() { exportLoginEvent(account, attempt, err) }()
+	}
+
+	applyBackupCount(account)
+
 	sharedCreds := alibabacloudconfig.NewSharedCredentials(account.Profile)
 
+	if loginFlags.CommonFlags.Offline {
+		return loginOffline(account, sharedCreds, loginFlags)
+	}
+
+	err = checkClock(account)
+	if err != nil {
+		return err
+	}
+
+	lock, reused, err := acquireLoginLock(account, sharedCreds, loginFlags)
+	if err != nil || reused {
+		return err
+	}
+	defer releaseLoginLock(lock)
+
+	var samlAssertion string
+	cached := false
+	if loginFlags.CaptureProxy != "" {
+		attempt.Stage = journal.StageIdP
+		samlAssertion, err = captureAssertion(account, loginFlags.CaptureProxy)
+		if err != nil {
+			return errors.Wrap(err, "error capturing saml assertion")
+		}
+	} else {
+		samlAssertion = loadCachedSession(account, loginFlags)
+		cached = samlAssertion != ""
+		if !cached {
+			_, samlAssertion, err = authenticate(account, loginFlags, attempt)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	samlAssertion, err = hook.Apply(samlAssertion, account)
+	if err != nil {
+		return errors.Wrap(err, "error processing saml assertion")
+	}
+
+	if account.RolePipeline != "" {
+		return runRolePipeline(account, samlAssertion, loginFlags, attempt, cached)
+	}
+
+	attempt.Stage = journal.StageRole
+
+	var role *saml2alibabacloud.RamRole
+	if loginFlags.Silent {
+		role, err = selectRamRoleSilently(samlAssertion, account, loginFlags.CommonFlags.IdpAccount)
+	} else if loginFlags.ListRolesJSON {
+		role, err = selectRamRoleJSON(samlAssertion, account, loginFlags.NoAssume, os.Stdin, os.Stdout)
+	} else {
+		role, err = selectRamRole(samlAssertion, account)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to assume role, please check whether you are permitted to assume the given role for the AlibabaCloud STS service")
+	}
+
+	log.Println("Selected role:", role.RoleARN)
+	attempt.Role = role.RoleARN
+
+	err = checkAssertionValidity(samlAssertion, account)
+	if err != nil {
+		return errors.Wrap(err, "error validating saml assertion")
+	}
+
+	if loginFlags.DryRun {
+		return printDryRun(os.Stdout, account, role, samlAssertion)
+	}
+
+	attempt.Stage = journal.StageSTS
+
+	alibabacloudCreds, err := loginToStsUsingRole(account, role, samlAssertion)
+	if err != nil {
+		if cached && loginFlags.NoWrite {
+			return errors.Wrap(err, "error logging into AlibabaCloud role using the cached IdP session, please login again with --force")
+		}
+		if cached {
+			dropCachedSession(account, loginFlags)
+			return errors.Wrap(err, "error logging into AlibabaCloud role using the cached IdP session, it has been discarded, please login again")
+		}
+		return errors.Wrap(err, "error logging into AlibabaCloud role using saml assertion")
+	}
+
+	attempt.Expires = alibabacloudCreds.Expires
+
+	if loginFlags.NoWrite {
+		log.Println("Logged in as:", alibabacloudCreds.PrincipalARN)
+		log.Println("--no-write is set, the credentials have not been saved")
+		return printCredentials(alibabacloudCreds, account, loginFlags)
+	}
+
+	rememberRole(loginFlags.CommonFlags.IdpAccount, role.RoleARN)
+
+	attempt.Stage = journal.StageSave
+
+	err = guardOutput(account, alibabacloudconfig.ConfigFilename())
+	if err != nil {
+		return errors.Wrap(err, "refusing to save credentials")
+	}
+
+	err = saveCredentials(alibabacloudCreds, sharedCreds)
+	if err != nil || !loginFlags.CheckProfile {
+		return err
+	}
+
+	return checkWrittenProfile(account, alibabacloudCreds)
+}
+
+// authenticate resolve the login details and authenticate with the IdP, returning the SAML assertion
+func authenticate(account *cfg.IDPAccount, loginFlags *flags.LoginExecFlags, attempt *journal.Entry) (*creds.LoginDetails, string, error) {
+
+	logger := logrus.WithField("command", "login")
+
+	attempt.Stage = journal.StageConfig
+
 	loginDetails, err := resolveLoginDetails(account, loginFlags)
 	if err != nil {
-		log.Printf("%+v", err)
-		os.Exit(1)
+		return nil, "", errors.Wrap(err, "error resolving login details")
+	}
+
+	requirements := saml2alibabacloud.AccountRequirements(account)
+
+	if loginFlags.Silent && loginDetails.Password == "" && requirements.Password {
+		return nil, "", &silentError{reason: reasonNoSavedPassword, msg: "no password saved in the keychain for " + loginDetails.URL}
+	}
+
+	err = loginDetails.ValidateFor(requirements)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error validating login details")
 	}
 
-	err = loginDetails.Validate()
+	attempt.Stage = journal.StageIdP
+
+	mirrorAccount, authDetails, err := resolveIdpMirror(account, loginDetails)
 	if err != nil {
-		return errors.Wrap(err, "error validating login details")
+		return nil, "", errors.Wrap(err, "error probing IdP mirrors")
 	}
 
-	logger.WithField("idpAccount", account).Debug("building provider")
+	logger.WithField("idpAccount", mirrorAccount).Debug("building provider")
 
-	provider, err := saml2alibabacloud.NewSAMLClient(account)
+	provider, err := saml2alibabacloud.NewSAMLClient(mirrorAccount)
 	if err != nil {
-		return errors.Wrap(err, "error building IdP client")
+		return nil, "", errors.Wrap(err, "error building IdP client")
 	}
 
 	log.Printf("Authenticating as %s ...", loginDetails.Username)
 
-	samlAssertion, err := provider.Authenticate(loginDetails)
+	samlAssertion, err := provider.Authenticate(authDetails)
 	if err != nil {
-		return errors.Wrap(err, "error authenticating to IdP")
+		return nil, "", errors.Wrap(err, "error authenticating to IdP")
 
 	}
 
@@ -58,29 +248,78 @@ func Login(loginFlags *flags.LoginExecFlags) error {
 		log.Println("Response did not contain a valid SAML assertion")
 		log.Println("Please check your username and password is correct")
 		log.Println("To see the output follow the instructions in https://github.com/aliyun/saml2alibabacloud#debugging-issues-with-idps")
-		os.Exit(1)
+		return nil, "", errors.New("no SAML assertion in the IdP response")
 	}
 
-	if !loginFlags.CommonFlags.DisableKeychain {
+	if !loginFlags.CommonFlags.DisableKeychain && !loginFlags.NoWrite {
 		err = credentials.SaveCredentials(loginDetails.URL, loginDetails.Username, loginDetails.Password)
 		if err != nil {
-			return errors.Wrap(err, "error storing password in keychain")
+			return nil, "", errors.Wrap(err, "error storing password in keychain")
 		}
 	}
 
-	role, err := selectRamRole(samlAssertion, account)
+	return loginDetails, samlAssertion, nil
+}
+
+// recordLoginAttempt add the attempt to the login journal, failing to do so never fails the login
+func recordLoginAttempt(attempt *journal.Entry, err error) {
+	attempt.Duration = time.Since(attempt.Time).Round(time.Millisecond)
+	attempt.Outcome = journal.OutcomeSuccess
 	if err != nil {
-		return errors.Wrap(err, "Failed to assume role, please check whether you are permitted to assume the given role for the AlibabaCloud STS service")
+		attempt.Outcome = journal.OutcomeFailure
+		attempt.ErrorClass = classifyError(err)
+		attempt.ErrorCode, attempt.RequestID = stsErrorDetails(err)
 	}
 
-	log.Println("Selected role:", role.RoleARN)
+	j, jerr := journal.New(historyPath)
+	if jerr == nil {
+		jerr = j.Record(attempt)
+	}
+	if jerr != nil {
+		logrus.WithError(jerr).Debug("unable to record login attempt")
+	}
+}
 
-	alibabacloudCreds, err := loginToStsUsingRole(account, role, samlAssertion)
+// classifyError a coarse category of the failure, the stage recorded alongside tells where it happened
+func classifyError(err error) string {
+	if saml2alibabacloud.IsTimeoutError(err) {
+		return "timeout"
+	}
+	if isNetworkError(errors.Cause(err)) {
+		return "network"
+	}
+	if _, ok := errors.Cause(err).(*sdkError.ServerError); ok {
+		return "rejected"
+	}
+	return "error"
+}
+
+// stsErrorDetails the error code and request ID returned by STS, empty when the failure happened elsewhere
+func stsErrorDetails(err error) (string, string) {
+	if serverErr, ok := errors.Cause(err).(*sdkError.ServerError); ok {
+		return serverErr.ErrorCode(), serverErr.RequestId()
+	}
+	return "", ""
+}
+
+// loginOffline serve the cached credentials for the profile as long as they are still valid, without contacting the IdP or STS
+func loginOffline(account *cfg.IDPAccount, sharedCreds *alibabacloudconfig.CredentialsProvider, loginFlags *flags.LoginExecFlags) error {
+	alibabacloudCreds, err := sharedCreds.Load()
 	if err != nil {
-		return errors.Wrap(err, "error logging into AlibabaCloud role using saml assertion")
+		return errors.Wrap(err, "error loading cached credentials")
 	}
 
-	return saveCredentials(alibabacloudCreds, sharedCreds)
+	if alibabacloudCreds.Expired() {
+		return fmt.Errorf("no valid cached credentials for profile %s, login requires network access", account.Profile)
+	}
+
+	log.Printf("Offline mode, using cached credentials for %s valid until %s", alibabacloudCreds.PrincipalARN, alibabacloudCreds.Expires.Local().Format(time.RFC3339))
+
+	if loginFlags.NoWrite {
+		return printCredentials(alibabacloudCreds, account, loginFlags)
+	}
+
+	return nil
 }
 
 func buildIdpAccount(loginFlags *flags.LoginExecFlags) (*cfg.IDPAccount, error) {
@@ -97,11 +336,18 @@ func buildIdpAccount(loginFlags *flags.LoginExecFlags) (*cfg.IDPAccount, error)
 	// update username and hostname if supplied
 	flags.ApplyFlagOverrides(loginFlags.CommonFlags, account)
 
+	account.Profile = cfg.ContextProfile(loginFlags.CommonFlags.Context, account.Profile)
+
 	err = account.Validate()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to validate account")
 	}
 
+	err = account.ToASCII()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to validate account")
+	}
+
 	return account, nil
 }
 
@@ -111,10 +357,15 @@ func resolveLoginDetails(account *cfg.IDPAccount, loginFlags *flags.LoginExecFla
 
 	loginDetails := &creds.LoginDetails{URL: account.URL, Username: account.Username, MFAToken: loginFlags.CommonFlags.MFAToken, DuoMFAOption: loginFlags.DuoMFAOption}
 
-	log.Printf("Using IDP Account %s to access %s %s", loginFlags.CommonFlags.IdpAccount, account.Provider, account.URL)
+	log.Printf("Using IDP Account %s to access %s %s", loginFlags.CommonFlags.IdpAccount, account.Provider, idn.ToUnicode(account.URL))
 
 	var err error
 	if !loginFlags.CommonFlags.DisableKeychain {
+		err = applyKeyringFallback(account)
+		if err != nil {
+			return nil, err
+		}
+
 		err = credentials.LookupCredentials(loginDetails, account.Provider)
 		if err != nil {
 			if !credentials.IsErrCredentialsNotFound(err) {
@@ -145,6 +396,14 @@ func resolveLoginDetails(account *cfg.IDPAccount, loginFlags *flags.LoginExecFla
 		loginDetails.ClientSecret = loginFlags.CommonFlags.ClientSecret
 	}
 
+	// the code of a factor enrolled with mfa enroll-totp is generated from the secret in the keychain
+	if loginDetails.MFAToken == "" && !loginFlags.CommonFlags.DisableKeychain {
+		loginDetails.MFAToken, err = enrolledTOTPCode(loginDetails)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// log.Printf("loginDetails %+v", loginDetails)
 
 	// if skip prompt was passed just pass back the flag values
@@ -152,7 +411,7 @@ func resolveLoginDetails(account *cfg.IDPAccount, loginFlags *flags.LoginExecFla
 		return loginDetails, nil
 	}
 
-	err = saml2alibabacloud.PromptForLoginDetails(loginDetails, account.Provider)
+	err = saml2alibabacloud.PromptForLoginDetails(loginDetails, saml2alibabacloud.AccountRequirements(account))
 	if err != nil {
 		return nil, errors.Wrap(err, "Error occurred accepting input")
 	}
@@ -161,6 +420,16 @@ func resolveLoginDetails(account *cfg.IDPAccount, loginFlags *flags.LoginExecFla
 }
 
 func selectRamRole(samlAssertion string, account *cfg.IDPAccount) (*saml2alibabacloud.RamRole, error) {
+	alibabacloudRoles, err := permittedRamRoles(samlAssertion, account)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveRole(alibabacloudRoles, samlAssertion, account)
+}
+
+// parseRamRoles extract the roles the assertion allows to assume
+func parseRamRoles(samlAssertion string) ([]*saml2alibabacloud.RamRole, error) {
 	data, err := b64.StdEncoding.DecodeString(samlAssertion)
 	if err != nil {
 		return nil, errors.Wrap(err, "error decoding saml assertion")
@@ -174,7 +443,7 @@ func selectRamRole(samlAssertion string, account *cfg.IDPAccount) (*saml2alibaba
 	if len(roles) == 0 {
 		log.Println("No roles to assume")
 		log.Println("Please check you are permitted to assume roles for the AlibabaCloud service")
-		os.Exit(1)
+		return nil, errors.New("no roles to assume")
 	}
 
 	alibabacloudRoles, err := saml2alibabacloud.ParseRamRoles(roles)
@@ -182,7 +451,33 @@ func selectRamRole(samlAssertion string, account *cfg.IDPAccount) (*saml2alibaba
 		return nil, errors.Wrap(err, "error parsing AlibabaCloud roles")
 	}
 
-	return resolveRole(alibabacloudRoles, samlAssertion, account)
+	return alibabacloudRoles, nil
+}
+
+// permittedRamRoles the roles of the assertion left once the role_allow and role_deny of the account are applied,
+// a configured role which isn't permitted is refused rather than assumed
+func permittedRamRoles(samlAssertion string, account *cfg.IDPAccount) ([]*saml2alibabacloud.RamRole, error) {
+	alibabacloudRoles, err := parseRamRoles(samlAssertion)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := roleFilter(account)
+
+	if account.RoleARN != "" && !filter.Permits(account.RoleARN) {
+		return nil, fmt.Errorf("role %s is excluded by the role_allow or role_deny of the IdP account", account.RoleARN)
+	}
+
+	permitted := filter.Filter(alibabacloudRoles)
+	if len(permitted) == 0 {
+		return nil, errors.New("all the roles in the assertion are excluded by the role_allow or role_deny of the IdP account")
+	}
+
+	return permitted, nil
+}
+
+func roleFilter(account *cfg.IDPAccount) *saml2alibabacloud.RoleFilter {
+	return &saml2alibabacloud.RoleFilter{Allow: account.RoleAllowList(), Deny: account.RoleDenyList()}
 }
 
 func resolveRole(alibabacloudRoles []*saml2alibabacloud.RamRole, samlAssertion string, account *cfg.IDPAccount) (*saml2alibabacloud.RamRole, error) {
@@ -197,20 +492,16 @@ func resolveRole(alibabacloudRoles []*saml2alibabacloud.RamRole, samlAssertion s
 		return nil, errors.New("no roles available")
 	}
 
-	samlAssertionData, err := b64.StdEncoding.DecodeString(samlAssertion)
-	if err != nil {
-		return nil, errors.Wrap(err, "error decoding saml assertion")
-	}
-
-	aud, err := saml2alibabacloud.ExtractDestinationURL(samlAssertionData)
+	_, aud, err := resolvePartition(samlAssertion, account)
 	if err != nil {
-		return nil, errors.Wrap(err, "error parsing destination url")
+		return nil, err
 	}
 
 	alibabacloudAccounts, err := saml2alibabacloud.ParseAlibabaCloudAccounts(aud, samlAssertion)
 	if err != nil {
 		return nil, errors.Wrap(err, "error parsing AlibabaCloud role accounts")
 	}
+	alibabacloudAccounts = roleFilter(account).FilterAccounts(alibabacloudAccounts)
 	if len(alibabacloudAccounts) == 0 {
 		return nil, errors.New("no accounts available")
 	}
@@ -221,8 +512,10 @@ func resolveRole(alibabacloudRoles []*saml2alibabacloud.RamRole, samlAssertion s
 		return saml2alibabacloud.LocateRole(alibabacloudRoles, account.RoleARN)
 	}
 
+	chooser := newRoleChooser(account)
+
 	for {
-		role, err = saml2alibabacloud.PromptForRamRoleSelection(alibabacloudAccounts)
+		role, err = chooser.Choose(alibabacloudAccounts)
 		if err == nil {
 			break
 		}
@@ -232,36 +525,222 @@ func resolveRole(alibabacloudRoles []*saml2alibabacloud.RamRole, samlAssertion s
 	return role, nil
 }
 
-func loginToStsUsingRole(account *cfg.IDPAccount, role *saml2alibabacloud.RamRole, samlAssertion string) (*alibabacloudconfig.AliCloudCredentials, error) {
+// resolveIdpMirror probe the configured IdP mirrors and authenticate against the fastest one to respond, with a copy
+// of the account and login details pointing at it since some providers build their URLs from the account, the login
+// details used for the keychain keep the primary URL
+func resolveIdpMirror(account *cfg.IDPAccount, loginDetails *creds.LoginDetails) (*cfg.IDPAccount, *creds.LoginDetails, error) {
+	mirrors := account.Mirrors()
+	if len(mirrors) == 1 {
+		return account, loginDetails, nil
+	}
 
-	client, err := sts.NewClientWithAccessKey("cn-hangzhou", "saml2alibabacloud", "0.0.5")
+	fastest, err := provider.ProbeFastestURL(provider.NewAccountTransport(account), mirrors, provider.DefaultProbeTimeout)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if fastest == account.URL {
+		return account, loginDetails, nil
+	}
+
+	log.Printf("Using IdP mirror %s", idn.ToUnicode(fastest))
+
+	mirrorAccount := *account
+	mirrorAccount.URL = fastest
+
+	authDetails := *loginDetails
+	authDetails.URL = fastest
+
+	return &mirrorAccount, &authDetails, nil
+}
+
+// checkAssertionValidity wait for an assertion issued by an IdP with a clock slightly ahead of ours to become valid,
+// rather than letting STS reject it, and warn when it grants less lifetime than the requested session duration
+func checkAssertionValidity(samlAssertion string, account *cfg.IDPAccount) error {
+	data, err := b64.StdEncoding.DecodeString(samlAssertion)
+	if err != nil {
+		return errors.Wrap(err, "error decoding saml assertion")
+	}
+
+	validity, err := saml2alibabacloud.ExtractAssertionValidity(data)
+	if err != nil {
+		return errors.Wrap(err, "error parsing saml assertion conditions")
+	}
+
+	tolerance := time.Duration(account.ClockSkewTolerance) * time.Second
+	if tolerance <= 0 {
+		tolerance = cfg.DefaultClockSkewTolerance * time.Second
+	}
+
+	if wait := time.Until(validity.NotBefore); !validity.NotBefore.IsZero() && wait > 0 {
+		if wait > tolerance {
+			return fmt.Errorf("assertion is not valid before %s which is %v ahead of the local clock, please check the clock of this machine", validity.NotBefore.Format(time.RFC3339), wait.Round(time.Second))
+		}
+		log.Printf("Assertion is not valid yet, waiting %v for the IdP clock", wait.Round(time.Second))
+		time.Sleep(wait + time.Second)
+	}
+
+	if !validity.SessionNotOnOrAfter.IsZero() {
+		remaining := time.Until(validity.SessionNotOnOrAfter)
+		requested := time.Duration(account.SessionDuration) * time.Second
+		if remaining < requested {
+			log.Printf("Warning: the assertion is only valid until %s, which is less than the requested session duration of %v", validity.SessionNotOnOrAfter.Format(time.RFC3339), requested)
+		}
+	}
+
+	return nil
+}
+
+// roleCatalogTimeout the time allowed for downloading the role catalog and its signature
+const roleCatalogTimeout = 10 * time.Second
+
+// loadRoleCatalog fetch the org published role catalog with the transport of the account, failures are logged and
+// the chooser falls back to plain role names
+func loadRoleCatalog(account *cfg.IDPAccount) *catalog.Catalog {
+	if account.RoleCatalogURL == "" {
+		return nil
+	}
+
+	client := &http.Client{Transport: provider.NewAccountTransport(account), Timeout: roleCatalogTimeout}
+
+	roleCatalog, err := catalog.Fetch(client, account.RoleCatalogURL, account.RoleCatalogPublicKey)
+	if err != nil {
+		log.Printf("Unable to load role catalog, role annotations will not be shown: %v", err)
+		return nil
+	}
+
+	return roleCatalog
+}
+
+// newRoleChooser the role chooser laid out as the role_group, role_sort and role_order of the account say, only
+// reading the login journal when the roles are sorted by their last use
+func newRoleChooser(account *cfg.IDPAccount) *saml2alibabacloud.RoleChooser {
+	var recent []string
+	if account.RoleSort == saml2alibabacloud.RoleSortRecent {
+		recent = recentRoles(historyPath)
+	}
+
+	return saml2alibabacloud.NewRoleChooser(account.RoleGroup, account.RoleSort, account.RoleOrderList(), recent, loadRoleCatalog(account))
+}
+
+// recentRoles the roles of the successful logins of the journal, most recent first, role ARNs are unique so the roles
+// of the other accounts never match those of the assertion
+func recentRoles(filename string) []string {
+	j, err := journal.New(filename)
+	if err != nil {
+		return nil
+	}
+
+	entries, err := j.Entries()
+	if err != nil {
+		logrus.WithError(err).Debug("unable to read the login journal, the roles are sorted alphabetically")
+		return nil
+	}
+
+	var recent []string
+	seen := map[string]bool{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Outcome != journal.OutcomeSuccess || entry.Role == "" || seen[entry.Role] {
+			continue
+		}
+		seen[entry.Role] = true
+		recent = append(recent, entry.Role)
+	}
+
+	return recent
+}
+
+// buildStsRequest the AssumeRoleWithSAML request for the role and the partition whose STS endpoint it is sent to
+func buildStsRequest(account *cfg.IDPAccount, role *saml2alibabacloud.RamRole, samlAssertion string) (*sts.AssumeRoleWithSAMLRequest, *saml2alibabacloud.Partition, error) {
+
+	partition, _, err := resolvePartition(samlAssertion, account)
+	if err != nil {
+		return nil, nil, err
 	}
-	client.AppendUserAgent("saml2alibabacloud", "0.0.5")
 
 	request := sts.CreateAssumeRoleWithSAMLRequest()
 	request.Scheme = "https"
 	request.RoleArn = role.RoleARN
 	request.SAMLAssertion = samlAssertion
 	request.SAMLProviderArn = role.PrincipalARN
+	identifyRequest(request)
+
+	return request, partition, nil
+}
+
+// assumeRoleWithSAML send the request to STS, replaced in tests
+var assumeRoleWithSAML = (*sts.Client).AssumeRoleWithSAML
+
+func loginToStsUsingRole(account *cfg.IDPAccount, role *saml2alibabacloud.RamRole, samlAssertion string) (*alibabacloudconfig.AliCloudCredentials, error) {
+
+	request, partition, err := buildStsRequest(account, role, samlAssertion)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sts.NewClientWithAccessKey(partition.STSRegion, "saml2alibabacloud", "0.0.5")
+	if err != nil {
+		return nil, err
+	}
+	identifyClient(client, account)
+
+	stsTimeout := time.Duration(account.STSTimeout) * time.Second
+	if stsTimeout > 0 {
+		client.SetConnectTimeout(stsTimeout)
+		client.SetReadTimeout(stsTimeout)
+	}
+
+	if account.DoHURL != "" {
+		client.SetTransport(provider.NewDoHTransport(account.DoHURL, stsTimeout))
+	}
 
 	log.Println("Requesting AlibabaCloud credentials using SAML assertion")
 
-	response, err := client.AssumeRoleWithSAML(request)
+	response, err := assumeRoleWithSAML(client, request)
 	if err != nil {
+		if clientErr, ok := err.(*sdkError.ClientError); ok && stsTimeout > 0 && clientErr.ErrorCode() == sdkError.TimeoutErrorCode {
+			return nil, &saml2alibabacloud.TimeoutError{Operation: "STS AssumeRoleWithSAML", Timeout: stsTimeout}
+		}
 		return nil, errors.Wrap(err, "error retrieving STS credentials using SAML")
 	}
 
+	expires, err := time.Parse(time.RFC3339, response.Credentials.Expiration)
+	if err != nil {
+		logrus.WithField("expiration", response.Credentials.Expiration).Debug("unable to parse credentials expiration")
+	}
+
 	return &alibabacloudconfig.AliCloudCredentials{
 		AliCloudAccessKey:     response.Credentials.AccessKeyId,
 		AliCloudSecretKey:     response.Credentials.AccessKeySecret,
 		AliCloudSecurityToken: response.Credentials.SecurityToken,
 		PrincipalARN:          response.AssumedRoleUser.Arn,
 		Region:                account.Region,
+		Partition:             partition.Name,
+		Expires:               expires,
 	}, nil
 }
 
+// identifyClient add the client version and the user agent configured for the account to the user agent of the STS
+// client, the SDK always starts it with its own so only this client is changed
+func identifyClient(client *sts.Client, account *cfg.IDPAccount) {
+	client.AppendUserAgent("saml2alibabacloud", provider.ClientVersion)
+
+	if account.UserAgent != "" {
+		// the SDK sends each entry as product/version
+		parts := strings.SplitN(account.UserAgent, "/", 2)
+		if len(parts) == 1 {
+			parts = append(parts, provider.ClientVersion)
+		}
+		client.AppendUserAgent(parts[0], parts[1])
+	}
+}
+
+// identifyRequest add the client version header to the STS request
+func identifyRequest(request requests.AcsRequest) {
+	request.GetHeaders()[provider.ClientVersionHeader] = provider.ClientVersion
+}
+
 func saveCredentials(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, sharedCreds *alibabacloudconfig.CredentialsProvider) error {
 	err := sharedCreds.Save(alibabacloudCreds)
 	if err != nil {
@@ -271,7 +750,9 @@ func saveCredentials(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials,
 	log.Println("Logged in as:", alibabacloudCreds.PrincipalARN)
 	log.Println("")
 	log.Println("Your new access key pair has been stored in the AlibabaCloud CLI configuration")
-	// log.Printf("Note that it will expire at %v", alibabacloudCreds.Expires)
+	if !alibabacloudCreds.Expires.IsZero() {
+		log.Printf("Note that it will expire at %v", alibabacloudCreds.Expires.Local())
+	}
 	log.Println("To use this credential, call the AlibabaCloud CLI with the --profile option (e.g. aliyun --profile", sharedCreds.Profile, "sts GetCallerIdentity --region=cn-hangzhou).")
 
 	return nil
@@ -6,7 +6,10 @@ import (
 )
 
 func init() {
-	if keyringHelper, err := linuxkeyring.NewKeyringHelper(); err == nil {
-		credentials.CurrentHelper = keyringHelper
+	keyringHelper, err := linuxkeyring.NewKeyringHelper()
+	if err != nil {
+		credentials.HelperError = err
+		return
 	}
+	credentials.CurrentHelper = keyringHelper
 }
@@ -1,12 +1,28 @@
 package commands
 
 import (
+	b64 "encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/sts"
 	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
 	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/aliyun/saml2alibabacloud/pkg/sessioncache"
+	"github.com/aliyun/saml2alibabacloud/pkg/statefile"
+	"github.com/mitchellh/go-homedir"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,3 +59,174 @@ func TestResolveRoleSingleEntry(t *testing.T) {
 	assert.Empty(t, err)
 	assert.Equal(t, got, adminRole)
 }
+
+func TestPermittedRamRoles(t *testing.T) {
+	data, err := ioutil.ReadFile("../../../testdata/assertion.xml")
+	assert.NoError(t, err)
+	samlAssertion := b64.StdEncoding.EncodeToString(data)
+
+	all, err := permittedRamRoles(samlAssertion, &cfg.IDPAccount{})
+	assert.NoError(t, err)
+
+	roles, err := permittedRamRoles(samlAssertion, &cfg.IDPAccount{RoleDeny: "*:role/ali-cloudadminops-build"})
+	assert.NoError(t, err)
+	assert.Len(t, roles, len(all)-1)
+	for _, role := range roles {
+		assert.NotEqual(t, "acs:ram::123123123123:role/Ali-CloudAdminOps-Build", role.RoleARN)
+	}
+
+	_, err = permittedRamRoles(samlAssertion, &cfg.IDPAccount{RoleDeny: "*:role/ali-cloudadminops-build", RoleARN: "acs:ram::123123123123:role/Ali-CloudAdminOps-Build"})
+	assert.EqualError(t, err, "role acs:ram::123123123123:role/Ali-CloudAdminOps-Build is excluded by the role_allow or role_deny of the IdP account")
+
+	_, err = permittedRamRoles(samlAssertion, &cfg.IDPAccount{RoleAllow: "acs:ram::999999999999:role/*"})
+	assert.EqualError(t, err, "all the roles in the assertion are excluded by the role_allow or role_deny of the IdP account")
+}
+
+func TestRecentRoles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	j, err := journal.New(filepath.Join(dir, "history.json"))
+	assert.Nil(t, err)
+	for _, entry := range []*journal.Entry{
+		{Role: "acs:ram::111:role/admin", Outcome: journal.OutcomeSuccess},
+		{Role: "acs:ram::222:role/admin", Outcome: journal.OutcomeSuccess},
+		{Role: "acs:ram::333:role/admin", Outcome: journal.OutcomeFailure},
+		{Role: "acs:ram::111:role/admin", Outcome: journal.OutcomeSuccess},
+	} {
+		assert.Nil(t, j.Record(entry))
+	}
+
+	assert.Equal(t, []string{"acs:ram::111:role/admin", "acs:ram::222:role/admin"}, recentRoles(filepath.Join(dir, "history.json")))
+	assert.Nil(t, recentRoles(filepath.Join(dir, "missing.json")))
+}
+
+func TestIdentifyClient(t *testing.T) {
+	userAgents := make(chan string, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents <- r.Header.Get("User-Agent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"RequestId":"1"}`))
+	}))
+	defer ts.Close()
+
+	send := func(account *cfg.IDPAccount) string {
+		client, err := sts.NewClientWithAccessKey("cn-hangzhou", "saml2alibabacloud", "0.0.5")
+		assert.Nil(t, err)
+		identifyClient(client, account)
+
+		request := sts.CreateGetCallerIdentityRequest()
+		request.Scheme = "http"
+		request.Domain = strings.TrimPrefix(ts.URL, "http://")
+		_, err = client.GetCallerIdentity(request)
+		assert.Nil(t, err)
+		return <-userAgents
+	}
+
+	custom := send(&cfg.IDPAccount{UserAgent: "Mozilla/5.0 (X11; Linux x86_64)"})
+	assert.Contains(t, custom, " saml2alibabacloud/"+provider.ClientVersion)
+	assert.Contains(t, custom, " Mozilla/5.0 (X11; Linux x86_64)")
+
+	// the user agent of an account doesn't leak into the clients of the others
+	plain := send(&cfg.IDPAccount{})
+	assert.Contains(t, plain, " saml2alibabacloud/"+provider.ClientVersion)
+	assert.NotContains(t, plain, "Mozilla")
+	assert.Equal(t, sdk.DefaultUserAgent, plain[:len(sdk.DefaultUserAgent)])
+}
+
+func TestLoginNoWrite(t *testing.T) {
+	home, err := ioutil.TempDir("", "home")
+	assert.Nil(t, err)
+	defer os.RemoveAll(home)
+	seed, err := ioutil.TempDir("", "seed")
+	assert.Nil(t, err)
+	defer os.RemoveAll(seed)
+
+	defer func(home string, disableCache bool) {
+		os.Setenv("HOME", home)
+		homedir.DisableCache = disableCache
+	}(os.Getenv("HOME"), homedir.DisableCache)
+	os.Setenv("HOME", home)
+	homedir.DisableCache = true
+
+	defer func(persist bool) { provider.PersistFingerprints = persist }(provider.PersistFingerprints)
+	defer func(path string) { sessionsPath = path }(sessionsPath)
+	sessionsPath = filepath.Join(seed, "sessions.json")
+
+	defer func(send func(*sts.Client, *sts.AssumeRoleWithSAMLRequest) (*sts.AssumeRoleWithSAMLResponse, error)) {
+		assumeRoleWithSAML = send
+	}(assumeRoleWithSAML)
+	assumeRoleWithSAML = func(*sts.Client, *sts.AssumeRoleWithSAMLRequest) (*sts.AssumeRoleWithSAMLResponse, error) {
+		response := sts.CreateAssumeRoleWithSAMLResponse()
+		response.Credentials.AccessKeyId = "STS.key"
+		response.Credentials.AccessKeySecret = "secret"
+		response.Credentials.SecurityToken = "token"
+		response.Credentials.Expiration = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		return response, nil
+	}
+
+	assertion, err := ioutil.ReadFile("../../../testdata/assertion.xml")
+	assert.Nil(t, err)
+	statefile.DisableKeyring()
+	cache, err := sessioncache.New(sessionsPath)
+	assert.Nil(t, err)
+	assert.Nil(t, cache.Save("default", &sessioncache.Session{URL: "https://id.example.com", Username: "user@example.com", Assertion: b64.StdEncoding.EncodeToString(assertion), Expires: time.Now().Add(time.Hour)}))
+
+	configFile := filepath.Join(seed, "config")
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte("[default]\nprovider = KeyCloak\nurl = https://id.example.com\nusername = user@example.com\nmfa = Auto\n"+
+		"role_arn = acs:ram::123123123123:role/Ali-CloudAdminOps-Build\nrole_deny = acs:ram::123123123123:role/Ali-CloudAdminOps-NonProd\nclock_check = off\nclient_fingerprint = persist\n"+
+		"analytics_export = "+filepath.Join(home, "events.csv")+"\nanalytics_salt = salt\ntelemetry_url = file://"+filepath.Join(home, "failures.jsonl")+"\n"), 0600))
+
+	commonFlags := &flags.CommonFlags{ConfigFile: configFile, IdpAccount: "default", SkipPrompt: true, DisableKeychain: true}
+	output := filepath.Join(seed, "credentials")
+	assert.Nil(t, Login(&flags.LoginExecFlags{CommonFlags: commonFlags, NoWrite: true, OutputFile: output}))
+
+	credentials, err := ioutil.ReadFile(output)
+	assert.Nil(t, err)
+	assert.Contains(t, string(credentials), "export ALIBABA_CLOUD_ACCESS_KEY_ID='STS.key'\n")
+
+	// neither the journal, the remembered role, the lock, the fingerprint nor the exports were written
+	files, err := ioutil.ReadDir(home)
+	assert.Nil(t, err)
+	var created []string
+	for _, f := range files {
+		created = append(created, f.Name())
+	}
+	assert.Empty(t, created)
+}
+
+func TestResolveIdpMirrorAccount(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	var paths []string
+	var mu sync.Mutex
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.Write([]byte("<html></html>"))
+	}))
+	defer mirror.Close()
+
+	account := &cfg.IDPAccount{Provider: "AzureAD", MFA: "Auto", URL: down.URL, URLMirrors: mirror.URL, AppID: "app"}
+	loginDetails := &creds.LoginDetails{URL: down.URL, Username: "user@example.com", Password: "secret"}
+
+	mirrorAccount, authDetails, err := resolveIdpMirror(account, loginDetails)
+	assert.Nil(t, err)
+	assert.Equal(t, mirror.URL, mirrorAccount.URL)
+	assert.Equal(t, mirror.URL, authDetails.URL)
+	assert.Equal(t, down.URL, account.URL)
+	assert.Equal(t, down.URL, loginDetails.URL)
+
+	// AzureAD builds its URLs from the account, the mirror is where it starts the login
+	client, err := saml2alibabacloud.NewSAMLClient(mirrorAccount)
+	assert.Nil(t, err)
+	_, err = client.Authenticate(authDetails)
+	assert.NotNil(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Contains(t, paths, "/applications/redirecttofederatedapplication.aspx")
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"log"
+	"time"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/helper/credentials"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/totp"
+	"github.com/pkg/errors"
+)
+
+// EnrollTOTP enroll an authenticator app factor for the user of the IdP account and store its secret along with the
+// password in the keychain, later logins generate the code from it so they run without any prompt
+func EnrollTOTP(loginFlags *flags.LoginExecFlags) error {
+	account, err := buildIdpAccount(loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	if !loginFlags.CommonFlags.DisableKeychain {
+		if err := applyKeyringFallback(account); err != nil {
+			return err
+		}
+	}
+
+	if loginFlags.CommonFlags.DisableKeychain || !credentials.SupportsStorage() {
+		return errors.New("the TOTP secret is stored in the keychain, which is disabled or not available")
+	}
+
+	enroller, err := saml2alibabacloud.NewTOTPEnroller(account)
+	if err != nil {
+		return err
+	}
+
+	loginDetails, err := resolveLoginDetails(account, loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error resolving login details")
+	}
+
+	log.Printf("Enrolling a TOTP factor for %s ...", loginDetails.Username)
+
+	secret, err := enroller.EnrollTOTP(loginDetails, func(secret string) (string, error) {
+		return totp.Code(secret, time.Now())
+	})
+	if err != nil {
+		return errors.Wrap(err, "error enrolling TOTP factor")
+	}
+
+	err = credentials.SaveCredentials(loginDetails.URL, loginDetails.Username, loginDetails.Password)
+	if err != nil {
+		return errors.Wrap(err, "error storing password in keychain")
+	}
+
+	err = credentials.SaveTOTPSecret(loginDetails.URL, loginDetails.Username, totp.NormalizeSecret(secret))
+	if err != nil {
+		return errors.Wrap(err, "error storing TOTP secret in keychain")
+	}
+
+	log.Println("The TOTP factor is enrolled and verified, its secret is stored in the keychain for later logins")
+
+	return nil
+}
+
+// enrolledTOTPCode the current code of the factor enrolled for the user with mfa enroll-totp, empty without one
+func enrolledTOTPCode(loginDetails *creds.LoginDetails) (string, error) {
+	secret, err := credentials.LookupTOTPSecret(loginDetails.URL, loginDetails.Username)
+	if err != nil {
+		if credentials.IsErrCredentialsNotFound(err) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "error loading saved TOTP secret")
+	}
+
+	return totp.Code(secret, time.Now())
+}
@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/outputguard"
+)
+
+// output_guard modes, warn is used when none is configured
+const (
+	outputGuardWarn   = "warn"
+	outputGuardRefuse = "refuse"
+	outputGuardOff    = "off"
+)
+
+// guardOutput check the file credentials are about to be written to, such as a file inside a git work tree which
+// isn't ignored, refused with output_guard = refuse and a warning otherwise
+func guardOutput(account *cfg.IDPAccount, filename string) error {
+	mode := strings.ToLower(account.OutputGuard)
+	if mode == outputGuardOff {
+		return nil
+	}
+	if mode != "" && mode != outputGuardWarn && mode != outputGuardRefuse {
+		return fmt.Errorf("invalid output_guard: %s, use warn, refuse or off", account.OutputGuard)
+	}
+
+	err := outputguard.Check(filename)
+	if err == nil {
+		return nil
+	}
+	if mode == outputGuardRefuse {
+		return err
+	}
+
+	log.Println("WARNING:", err)
+	return nil
+}
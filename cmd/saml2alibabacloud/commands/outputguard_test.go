@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuardOutput(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "saml2alibabacloud")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	assert.Nil(t, err)
+
+	assert.Nil(t, exec.Command("git", "-C", dir, "init", "--quiet").Run())
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte(".env\n"), 0600))
+
+	account := cfg.NewIDPAccount()
+	assert.Nil(t, guardOutput(account, filepath.Join(dir, ".env")))
+	assert.Nil(t, guardOutput(account, filepath.Join(dir, "credentials.sh")))
+
+	account.OutputGuard = "refuse"
+	assert.Nil(t, guardOutput(account, filepath.Join(dir, ".env")))
+	assert.EqualError(t, guardOutput(account, filepath.Join(dir, "credentials.sh")), filepath.Join(dir, "credentials.sh")+" is inside the git work tree "+dir+" and not ignored, credentials written there are easily committed, add it to .gitignore")
+
+	account.OutputGuard = "off"
+	assert.Nil(t, guardOutput(account, filepath.Join(dir, "credentials.sh")))
+
+	account.OutputGuard = "block"
+	assert.EqualError(t, guardOutput(account, filepath.Join(dir, "credentials.sh")), "invalid output_guard: block, use warn, refuse or off")
+}
@@ -0,0 +1,67 @@
+package commands
+
+import (
+	b64 "encoding/base64"
+
+	"github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// resolvePartition the partition the assertion is exchanged in and the destination the role list is read from, the
+// partition of the account wins, otherwise the first destination on a known sign in host picks it, China by default
+func resolvePartition(samlAssertion string, account *cfg.IDPAccount) (*saml2alibabacloud.Partition, string, error) {
+	samlAssertionData, err := b64.StdEncoding.DecodeString(samlAssertion)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error decoding saml assertion")
+	}
+
+	destinations, err := saml2alibabacloud.ExtractDestinationURLs(samlAssertionData)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error parsing destination url")
+	}
+
+	var partition *saml2alibabacloud.Partition
+	if account.Partition != "" {
+		partition, err = saml2alibabacloud.LookupPartition(account.Partition)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	for _, destination := range destinations {
+		destinationPartition := saml2alibabacloud.DestinationPartition(destination)
+		if destinationPartition == nil {
+			continue
+		}
+		if partition == nil {
+			partition = destinationPartition
+		}
+		if destinationPartition == partition {
+			logrus.WithField("partition", partition.Name).WithField("destination", destination).Debug("resolved partition")
+			return partition, destination, nil
+		}
+	}
+
+	if partition == nil {
+		partition = saml2alibabacloud.PartitionChina
+	}
+
+	// the assertion isn't destined for the partition, leave it to the sign in endpoint to accept or refuse it
+	logrus.WithField("partition", partition.Name).WithField("destination", destinations[0]).Debug("no destination in the partition")
+	return partition, destinations[0], nil
+}
+
+// credentialsPartition the partition the credentials were issued in, falling back to the partition of the account
+func credentialsPartition(creds *alibabacloudconfig.AliCloudCredentials, account *cfg.IDPAccount) (*saml2alibabacloud.Partition, error) {
+	name := creds.Partition
+	if name == "" {
+		name = account.Partition
+	}
+	if name == "" {
+		return saml2alibabacloud.PartitionChina, nil
+	}
+	return saml2alibabacloud.LookupPartition(name)
+}
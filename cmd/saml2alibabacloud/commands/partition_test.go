@@ -0,0 +1,31 @@
+package commands
+
+import (
+	b64 "encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvePartition(t *testing.T) {
+	data, err := ioutil.ReadFile("../../../testdata/assertion.xml")
+	assert.NoError(t, err)
+	international := strings.Replace(string(data), `Recipient="https://signin.aliyun.com/saml-role/sso"`, `Recipient="https://signin.alibabacloud.com/saml-role/sso"`, 1)
+
+	partition, destination, err := resolvePartition(b64.StdEncoding.EncodeToString(data), &cfg.IDPAccount{})
+	assert.NoError(t, err)
+	assert.Equal(t, saml2alibabacloud.PartitionChina, partition)
+	assert.Equal(t, "https://signin.aliyun.com/saml-role/sso", destination)
+
+	partition, destination, err = resolvePartition(b64.StdEncoding.EncodeToString([]byte(international)), &cfg.IDPAccount{Partition: "International"})
+	assert.NoError(t, err)
+	assert.Equal(t, saml2alibabacloud.PartitionInternational, partition)
+	assert.Equal(t, "https://signin.alibabacloud.com/saml-role/sso", destination)
+
+	_, _, err = resolvePartition(b64.StdEncoding.EncodeToString(data), &cfg.IDPAccount{Partition: "mars"})
+	assert.EqualError(t, err, "unknown partition: mars, use china or international")
+}
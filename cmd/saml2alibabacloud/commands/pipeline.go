@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/pkg/errors"
+)
+
+// runRolePipeline assume the roles of the stages of role_pipeline one after the other with the assertion, each in
+// its own partition, and write the credentials of each stage to its profile. The pipeline stops at the first stage
+// failing, the attempt records the first stage and the journal gets an entry for each of the others
+func runRolePipeline(account *cfg.IDPAccount, samlAssertion string, loginFlags *flags.LoginExecFlags, attempt *journal.Entry, cached bool) error {
+	if loginFlags.ListRolesJSON || loginFlags.NoWrite {
+		return errors.New("role_pipeline writes the profile of each stage and can't be used with --list-roles-json or --no-write")
+	}
+
+	stages, err := account.RolePipelineStages()
+	if err != nil {
+		return err
+	}
+
+	for _, stage := range stages {
+		if _, err := saml2alibabacloud.LookupPartition(stage.Partition); err != nil {
+			return errors.Wrapf(err, "invalid role_pipeline stage %s", stage.Profile)
+		}
+	}
+
+	attempt.Stage = journal.StageRole
+
+	roles, err := permittedRamRoles(samlAssertion, account)
+	if err != nil {
+		return errors.Wrap(err, "Failed to assume role, please check whether you are permitted to assume the given role for the AlibabaCloud STS service")
+	}
+
+	err = checkAssertionValidity(samlAssertion, account)
+	if err != nil {
+		return errors.Wrap(err, "error validating saml assertion")
+	}
+
+	for i, stage := range stages {
+		stageAttempt := attempt
+		if i > 0 {
+			stageAttempt = &journal.Entry{Time: time.Now(), Account: attempt.Account, Provider: attempt.Provider}
+		}
+		stageAttempt.Profile = stage.Profile
+		stageAttempt.Role = stage.RoleARN
+
+		err = runPipelineStage(account, stage, roles, samlAssertion, loginFlags, stageAttempt)
+		if i > 0 {
+			recordLoginAttempt(stageAttempt, err)
+		}
+		if err != nil {
+			if cached && stageAttempt.Stage == journal.StageSTS {
+				dropCachedSession(account, loginFlags)
+				return errors.Wrapf(err, "role_pipeline stage %s failed with the cached IdP session, it has been discarded, please login again", stage.Profile)
+			}
+			return errors.Wrapf(err, "role_pipeline stage %s failed", stage.Profile)
+		}
+	}
+
+	return nil
+}
+
+// runPipelineStage assume the role of the stage in its partition and save the credentials to its profile
+func runPipelineStage(account *cfg.IDPAccount, stage *cfg.PipelineStage, roles []*saml2alibabacloud.RamRole, samlAssertion string, loginFlags *flags.LoginExecFlags, attempt *journal.Entry) error {
+	stageAccount := *account
+	stageAccount.Partition = stage.Partition
+	stageAccount.RoleARN = stage.RoleARN
+	stageAccount.Profile = stage.Profile
+
+	attempt.Stage = journal.StageRole
+
+	role, err := saml2alibabacloud.LocateRole(roles, stage.RoleARN)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Selected role: %s in the %s partition for profile %s", role.RoleARN, stage.Partition, stage.Profile)
+
+	if loginFlags.DryRun {
+		return printDryRun(os.Stdout, &stageAccount, role, samlAssertion)
+	}
+
+	attempt.Stage = journal.StageSTS
+
+	alibabacloudCreds, err := loginToStsUsingRole(&stageAccount, role, samlAssertion)
+	if err != nil {
+		return errors.Wrap(err, "error logging into AlibabaCloud role using saml assertion")
+	}
+
+	attempt.Expires = alibabacloudCreds.Expires
+	attempt.Stage = journal.StageSave
+
+	err = guardOutput(&stageAccount, alibabacloudconfig.ConfigFilename())
+	if err != nil {
+		return errors.Wrap(err, "refusing to save credentials")
+	}
+
+	err = saveCredentials(alibabacloudCreds, alibabacloudconfig.NewSharedCredentials(stage.Profile))
+	if err != nil || !loginFlags.CheckProfile {
+		return err
+	}
+
+	return checkWrittenProfile(&stageAccount, alibabacloudCreds)
+}
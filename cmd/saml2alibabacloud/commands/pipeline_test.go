@@ -0,0 +1,20 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunRolePipelineRefused(t *testing.T) {
+	account := &cfg.IDPAccount{RolePipeline: "international acs:ram::123123123123:role/Ali-CloudAdminOps-Build intl, mars acs:ram::123123123123:role/Ali-CloudAdminOps-NonProd cn"}
+
+	err := runRolePipeline(account, "", &flags.LoginExecFlags{NoWrite: true}, &journal.Entry{}, false)
+	assert.EqualError(t, err, "role_pipeline writes the profile of each stage and can't be used with --list-roles-json or --no-write")
+
+	err = runRolePipeline(account, "", &flags.LoginExecFlags{}, &journal.Entry{}, false)
+	assert.EqualError(t, err, "invalid role_pipeline stage cn: unknown partition: mars, use china or international")
+}
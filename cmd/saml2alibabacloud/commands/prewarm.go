@@ -0,0 +1,138 @@
+package commands
+
+import (
+	b64 "encoding/base64"
+	"log"
+	"time"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/aliyun/saml2alibabacloud/pkg/sessioncache"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Prewarm authenticate with the IdP and cache the SAML assertion without calling STS,
+// role logins for the IdP account reuse it until it expires
+func Prewarm(loginFlags *flags.LoginExecFlags) error {
+	attempt := &journal.Entry{
+		Time:    time.Now(),
+		Account: loginFlags.CommonFlags.IdpAccount,
+		Stage:   journal.StageConfig,
+	}
+
+	err := prewarm(loginFlags, attempt)
+
+	recordLoginAttempt(attempt, err)
+
+	return err
+}
+
+func prewarm(loginFlags *flags.LoginExecFlags, attempt *journal.Entry) (err error) {
+	account, err := buildIdpAccount(loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	attempt.Provider = account.Provider
+	attempt.Profile = account.Profile
+
+	defer func() { reportFailure(account, attempt, err) }()
+
+	if loginFlags.CommonFlags.Offline {
+		return errors.New("prewarm requires network access and is not available with --offline")
+	}
+
+	loginDetails, samlAssertion, err := authenticate(account, loginFlags, attempt)
+	if err != nil {
+		return err
+	}
+
+	attempt.Stage = journal.StageSave
+
+	data, err := b64.StdEncoding.DecodeString(samlAssertion)
+	if err != nil {
+		return errors.Wrap(err, "error decoding saml assertion")
+	}
+
+	validity, err := saml2alibabacloud.ExtractAssertionValidity(data)
+	if err != nil {
+		return errors.Wrap(err, "error parsing saml assertion conditions")
+	}
+
+	expires := sessionExpiry(validity)
+	if expires.IsZero() {
+		return errors.New("the assertion has no expiry so the IdP session can't be cached")
+	}
+
+	cache, err := sessioncache.New(sessionsPath)
+	if err != nil {
+		return err
+	}
+
+	err = cache.Save(loginFlags.CommonFlags.IdpAccount, &sessioncache.Session{
+		URL:       account.URL,
+		Username:  loginDetails.Username,
+		Assertion: samlAssertion,
+		Expires:   expires,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error caching IdP session")
+	}
+
+	log.Printf("IdP session for %s cached until %s, logins with this IdP account will not prompt until then", loginDetails.Username, expires.Local().Format(time.RFC3339))
+
+	return nil
+}
+
+// sessionExpiry the earliest of the assertion expiry times, zero when it has none
+func sessionExpiry(validity *saml2alibabacloud.AssertionValidity) time.Time {
+	expires := validity.NotOnOrAfter
+	if !validity.SessionNotOnOrAfter.IsZero() && (expires.IsZero() || validity.SessionNotOnOrAfter.Before(expires)) {
+		expires = validity.SessionNotOnOrAfter
+	}
+	return expires
+}
+
+// loadCachedSession return the assertion cached by prewarm for the IdP account, empty when there is none or a fresh login is forced
+func loadCachedSession(account *cfg.IDPAccount, loginFlags *flags.LoginExecFlags) string {
+	if loginFlags.Force {
+		return ""
+	}
+
+	cache, err := sessioncache.New(sessionsPath)
+	if err != nil {
+		logrus.WithError(err).Debug("unable to open session cache")
+		return ""
+	}
+
+	session, err := cache.Lookup(loginFlags.CommonFlags.IdpAccount, account.Username)
+	if err != nil {
+		logrus.WithError(err).Debug("unable to read session cache")
+		return ""
+	}
+	if session == nil {
+		return ""
+	}
+
+	// the account may have been reconfigured since the prewarm
+	if session.URL != account.URL || (account.Username != "" && session.Username != account.Username) {
+		return ""
+	}
+
+	log.Printf("Using the IdP session of %s cached until %s", session.Username, session.Expires.Local().Format(time.RFC3339))
+
+	return session.Assertion
+}
+
+func dropCachedSession(account *cfg.IDPAccount, loginFlags *flags.LoginExecFlags) {
+	cache, err := sessioncache.New(sessionsPath)
+	if err == nil {
+		err = cache.Delete(loginFlags.CommonFlags.IdpAccount, account.Username)
+	}
+	if err != nil {
+		logrus.WithError(err).Debug("unable to discard cached IdP session")
+	}
+}
@@ -0,0 +1,18 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	notOnOrAfter := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	sessionNotOnOrAfter := time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, notOnOrAfter, sessionExpiry(&saml2alibabacloud.AssertionValidity{NotOnOrAfter: notOnOrAfter}))
+	assert.Equal(t, sessionNotOnOrAfter, sessionExpiry(&saml2alibabacloud.AssertionValidity{NotOnOrAfter: notOnOrAfter, SessionNotOnOrAfter: sessionNotOnOrAfter}))
+	assert.True(t, sessionExpiry(&saml2alibabacloud.AssertionValidity{}).IsZero())
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/pkg/errors"
+)
+
+// processFormat the --credential-format printing the credentials for the AlibabaCloud CLI external mode
+const processFormat = "process"
+
+// registerAliyunProcess point the AlibabaCloud CLI profile of the account at saml2alibabacloud, so the CLI logs in
+// on demand instead of using credentials written by an earlier login
+func registerAliyunProcess(idpAccountName string, account *cfg.IDPAccount, configFlags *flags.CommonFlags) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "error locating the saml2alibabacloud executable")
+	}
+
+	// the configuration of the context is found again from --context
+	configFile := configFlags.ConfigFile
+	if contextConfig, _ := cfg.ContextPath(configFlags.Context, cfg.DefaultConfigPath); configFlags.Context != "" && configFile == contextConfig {
+		configFile = ""
+	}
+
+	command, err := processCommand(executable, idpAccountName, configFlags.Context, configFile)
+	if err != nil {
+		return err
+	}
+
+	if err := alibabacloudconfig.RegisterProcess(alibabacloudconfig.ConfigFilename(), account.Profile, command); err != nil {
+		return errors.Wrap(err, "error registering the AlibabaCloud CLI profile")
+	}
+
+	log.Printf("AlibabaCloud CLI profile %s now runs: %s", account.Profile, command)
+
+	return nil
+}
+
+// processCommand build the command run by the AlibabaCloud CLI, which splits it on white space without any quoting
+func processCommand(executable, idpAccountName, context, configFile string) (string, error) {
+	args := []string{
+		executable,
+		"login",
+		"--idp-account=" + idpAccountName,
+		"--skip-prompt",
+		"--silent",
+		"--no-write",
+		"--credential-format=" + processFormat,
+	}
+	if context != "" {
+		args = append(args, "--context="+context)
+	}
+	if configFile != "" {
+		args = append(args, "--config="+configFile)
+	}
+
+	for _, arg := range args {
+		if strings.ContainsAny(arg, " \t\n") {
+			return "", fmt.Errorf("the AlibabaCloud CLI can't run a command containing spaces: %s", arg)
+		}
+	}
+
+	return strings.Join(args, " "), nil
+}
@@ -0,0 +1,20 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessCommand(t *testing.T) {
+	command, err := processCommand("/usr/local/bin/saml2alibabacloud", "corp", "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "/usr/local/bin/saml2alibabacloud login --idp-account=corp --skip-prompt --silent --no-write --credential-format=process", command)
+
+	command, err = processCommand("/usr/local/bin/saml2alibabacloud", "corp", "acme", "/etc/saml2alibabacloud.cfg")
+	assert.Nil(t, err)
+	assert.Contains(t, command, " --context=acme --config=/etc/saml2alibabacloud.cfg")
+
+	_, err = processCommand("/Applications/My Tools/saml2alibabacloud", "corp", "", "")
+	assert.NotNil(t, err)
+}
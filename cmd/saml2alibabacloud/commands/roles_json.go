@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/catalog"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/pkg/errors"
+)
+
+// roleChoice a role offered to GUI wrappers with login --list-roles-json
+type roleChoice struct {
+	RoleARN      string `json:"role_arn"`
+	PrincipalARN string `json:"principal_arn"`
+	AccountID    string `json:"account_id"`
+	RoleName     string `json:"role_name"`
+	Annotation   string `json:"annotation,omitempty"`
+}
+
+type roleChoices struct {
+	Roles []*roleChoice `json:"roles"`
+}
+
+// roleSelection the answer a GUI wrapper may send on stdin instead of the bare role ARN
+type roleSelection struct {
+	RoleARN string `json:"role_arn"`
+}
+
+// selectRamRoleJSON print the roles as JSON, the role is then either selected as usual or, with noAssume, read
+// from in once the wrapper has picked it
+func selectRamRoleJSON(samlAssertion string, account *cfg.IDPAccount, noAssume bool, in io.Reader, out io.Writer) (*saml2alibabacloud.RamRole, error) {
+	alibabacloudRoles, err := permittedRamRoles(samlAssertion, account)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeRoleChoices(out, alibabacloudRoles, loadRoleCatalog(account)); err != nil {
+		return nil, errors.Wrap(err, "error writing roles")
+	}
+
+	if !noAssume {
+		return resolveRole(alibabacloudRoles, samlAssertion, account)
+	}
+
+	return readRoleSelection(in, alibabacloudRoles)
+}
+
+func writeRoleChoices(out io.Writer, alibabacloudRoles []*saml2alibabacloud.RamRole, roleCatalog *catalog.Catalog) error {
+	choices := &roleChoices{Roles: make([]*roleChoice, len(alibabacloudRoles))}
+	for i, role := range alibabacloudRoles {
+		choice := &roleChoice{
+			RoleARN:      role.RoleARN,
+			PrincipalARN: role.PrincipalARN,
+			Annotation:   roleCatalog.Annotation(role.RoleARN),
+		}
+
+		// acs:ram::<account id>:role/<role name>
+		if parts := strings.SplitN(role.RoleARN, ":", 5); len(parts) == 5 {
+			choice.AccountID = parts[3]
+			choice.RoleName = strings.TrimPrefix(parts[4], "role/")
+		}
+
+		choices.Roles[i] = choice
+	}
+
+	return json.NewEncoder(out).Encode(choices)
+}
+
+// readRoleSelection read the selected role from the first line of in, either a bare role ARN or {"role_arn": "..."}
+func readRoleSelection(in io.Reader, alibabacloudRoles []*saml2alibabacloud.RamRole) (*saml2alibabacloud.RamRole, error) {
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "error reading the selected role")
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, errors.New("no role selected on stdin")
+	}
+
+	roleARN := line
+	if strings.HasPrefix(line, "{") {
+		var selection roleSelection
+		if err := json.Unmarshal([]byte(line), &selection); err != nil {
+			return nil, errors.Wrap(err, "error decoding the selected role")
+		}
+		roleARN = selection.RoleARN
+	}
+
+	return saml2alibabacloud.LocateRole(alibabacloudRoles, roleARN)
+}
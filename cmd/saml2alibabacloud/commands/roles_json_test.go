@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleChoicesJSON(t *testing.T) {
+
+	roles := []*saml2alibabacloud.RamRole{
+		{RoleARN: "acs:ram::000000000001:role/Development", PrincipalARN: "acs:ram::000000000001:saml-provider/idp"},
+		{RoleARN: "acs:ram::000000000002:role/Production", PrincipalARN: "acs:ram::000000000002:saml-provider/idp"},
+	}
+
+	out := &bytes.Buffer{}
+	err := writeRoleChoices(out, roles, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"roles":[{"role_arn":"acs:ram::000000000001:role/Development","principal_arn":"acs:ram::000000000001:saml-provider/idp","account_id":"000000000001","role_name":"Development"},{"role_arn":"acs:ram::000000000002:role/Production","principal_arn":"acs:ram::000000000002:saml-provider/idp","account_id":"000000000002","role_name":"Production"}]}`+"\n", out.String())
+
+	role, err := readRoleSelection(strings.NewReader("acs:ram::000000000002:role/Production\n"), roles)
+	assert.Nil(t, err)
+	assert.Equal(t, roles[1], role)
+
+	role, err = readRoleSelection(strings.NewReader(`{"role_arn":"acs:ram::000000000001:role/Development"}`), roles)
+	assert.Nil(t, err)
+	assert.Equal(t, roles[0], role)
+
+	_, err = readRoleSelection(strings.NewReader(""), roles)
+	assert.EqualError(t, err, "no role selected on stdin")
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/pkg/errors"
+)
+
+// Rollback restore the AlibabaCloud CLI configuration from one of the backups taken before it was rewritten,
+// or list the backups
+func Rollback(list bool, name string) error {
+	filename := alibabacloudconfig.ConfigFilename()
+
+	if list {
+		backups, err := alibabacloudconfig.Backups(filename)
+		if err != nil {
+			return err
+		}
+
+		if len(backups) == 0 {
+			fmt.Println("No configuration backups found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "BACKUP\tTAKEN")
+		for _, b := range backups {
+			fmt.Fprintf(w, "%s\t%s\n", b.Name, b.Time.Local().Format(time.RFC3339))
+		}
+		return w.Flush()
+	}
+
+	backup, err := alibabacloudconfig.Rollback(filename, name)
+	if err != nil {
+		return errors.Wrap(err, "error rolling back AlibabaCloud CLI configuration")
+	}
+
+	log.Printf("Restored %s from the backup taken %s", filename, backup.Time.Local().Format(time.RFC3339))
+	log.Println("The configuration before the rollback has been backed up, use rollback again to undo it")
+
+	return nil
+}
+
+// applyBackupCount configure how many backups of the AlibabaCloud CLI configuration are kept for the account
+func applyBackupCount(account *cfg.IDPAccount) {
+	switch {
+	case account.CredentialBackups < 0:
+		alibabacloudconfig.BackupCount = 0
+	case account.CredentialBackups > 0:
+		alibabacloudconfig.BackupCount = account.CredentialBackups
+	}
+}
@@ -1,47 +1,56 @@
 package commands
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 	"text/template"
 
 	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/transform"
 	"github.com/pkg/errors"
 )
 
-const bashTmpl = `export ALIBABA_CLOUD_ACCESS_KEY_ID="{{ .AliCloudAccessKey }}"
-export ALIBABA_CLOUD_ACCESS_KEY_SECRET="{{ .AliCloudSecretKey }}"
-export ALIBABA_CLOUD_SESSION_TOKEN="{{ .AliCloudSessionToken }}"
-export ALIBABA_CLOUD_SECURITY_TOKEN="{{ .AliCloudSecurityToken }}"
-export ALICLOUD_ACCESS_KEY="{{ .AliCloudAccessKey }}"
-export ALICLOUD_SECRET_KEY="{{ .AliCloudSecretKey }}"
-export ALICLOUD_SECURITY_TOKEN="{{ .AliCloudSecurityToken }}"
-export ALICLOUD_PROFILE="{{ .ProfileName }}"
-export SAML2ALIBABA_CLOUD_PROFILE="{{ .ProfileName }}"
-`
-
-const fishTmpl = `set -gx ALIBABA_CLOUD_ACCESS_KEY_ID {{ .AliCloudAccessKey }}
-set -gx ALIBABA_CLOUD_ACCESS_KEY_SECRET {{ .AliCloudSecretKey }}
-set -gx ALIBABA_CLOUD_SESSION_TOKEN {{ .AliCloudSessionToken }}
-set -gx ALIBABA_CLOUD_SECURITY_TOKEN {{ .AliCloudSecurityToken }}
-set -gx ALICLOUD_ACCESS_KEY {{ .AliCloudAccessKey }}
-set -gx ALICLOUD_SECRET_KEY {{ .AliCloudSecretKey }}
-set -gx ALICLOUD_SECURITY_TOKEN {{ .AliCloudSecurityToken }}
-set -gx ALICLOUD_PROFILE {{ .ProfileName }}
-set -gx SAML2ALIBABA_CLOUD_PROFILE {{ .ProfileName }}
-`
-
-const powershellTmpl = `$env:ALIBABA_CLOUD_ACCESS_KEY_ID='{{ .AliCloudAccessKey }}'
-$env:ALIBABA_CLOUD_ACCESS_KEY_SECRET='{{ .AliCloudSecretKey }}'
-$env:ALIBABA_CLOUD_SESSION_TOKEN='{{ .AliCloudSessionToken }}'
-$env:ALIBABA_CLOUD_SECURITY_TOKEN='{{ .AliCloudSecurityToken }}'
-$env:ALICLOUD_ACCESS_KEY='{{ .AliCloudAccessKey }}'
-$env:ALICLOUD_SECRET_KEY='{{ .AliCloudSecretKey }}'
-$env:ALICLOUD_SECURITY_TOKEN='{{ .AliCloudSecurityToken }}'
-$env:ALICLOUD_PROFILE='{{ .ProfileName }}'
-$env:SAML2ALIBABA_CLOUD_PROFILE='{{ .ProfileName }}'
-`
+const bashTmpl = `export ALIBABA_CLOUD_ACCESS_KEY_ID={{ bashQuote .AliCloudAccessKey }}
+export ALIBABA_CLOUD_ACCESS_KEY_SECRET={{ bashQuote .AliCloudSecretKey }}
+export ALIBABA_CLOUD_SESSION_TOKEN={{ bashQuote .AliCloudSessionToken }}
+export ALIBABA_CLOUD_SECURITY_TOKEN={{ bashQuote .AliCloudSecurityToken }}
+export ALICLOUD_ACCESS_KEY={{ bashQuote .AliCloudAccessKey }}
+export ALICLOUD_SECRET_KEY={{ bashQuote .AliCloudSecretKey }}
+export ALICLOUD_SECURITY_TOKEN={{ bashQuote .AliCloudSecurityToken }}
+export ALICLOUD_PROFILE={{ bashQuote .ProfileName }}
+export SAML2ALIBABA_CLOUD_PROFILE={{ bashQuote .ProfileName }}
+{{ range $name, $value := .Variables }}export {{ $name }}={{ bashQuote $value }}
+{{ end }}`
+
+const fishTmpl = `set -gx ALIBABA_CLOUD_ACCESS_KEY_ID {{ fishQuote .AliCloudAccessKey }}
+set -gx ALIBABA_CLOUD_ACCESS_KEY_SECRET {{ fishQuote .AliCloudSecretKey }}
+set -gx ALIBABA_CLOUD_SESSION_TOKEN {{ fishQuote .AliCloudSessionToken }}
+set -gx ALIBABA_CLOUD_SECURITY_TOKEN {{ fishQuote .AliCloudSecurityToken }}
+set -gx ALICLOUD_ACCESS_KEY {{ fishQuote .AliCloudAccessKey }}
+set -gx ALICLOUD_SECRET_KEY {{ fishQuote .AliCloudSecretKey }}
+set -gx ALICLOUD_SECURITY_TOKEN {{ fishQuote .AliCloudSecurityToken }}
+set -gx ALICLOUD_PROFILE {{ fishQuote .ProfileName }}
+set -gx SAML2ALIBABA_CLOUD_PROFILE {{ fishQuote .ProfileName }}
+{{ range $name, $value := .Variables }}set -gx {{ $name }} {{ fishQuote $value }}
+{{ end }}`
+
+const powershellTmpl = `$env:ALIBABA_CLOUD_ACCESS_KEY_ID={{ powershellQuote .AliCloudAccessKey }}
+$env:ALIBABA_CLOUD_ACCESS_KEY_SECRET={{ powershellQuote .AliCloudSecretKey }}
+$env:ALIBABA_CLOUD_SESSION_TOKEN={{ powershellQuote .AliCloudSessionToken }}
+$env:ALIBABA_CLOUD_SECURITY_TOKEN={{ powershellQuote .AliCloudSecurityToken }}
+$env:ALICLOUD_ACCESS_KEY={{ powershellQuote .AliCloudAccessKey }}
+$env:ALICLOUD_SECRET_KEY={{ powershellQuote .AliCloudSecretKey }}
+$env:ALICLOUD_SECURITY_TOKEN={{ powershellQuote .AliCloudSecurityToken }}
+$env:ALICLOUD_PROFILE={{ powershellQuote .ProfileName }}
+$env:SAML2ALIBABA_CLOUD_PROFILE={{ powershellQuote .ProfileName }}
+{{ range $name, $value := .Variables }}$env:{{ $name }}={{ powershellQuote $value }}
+{{ end }}`
 
 // Script will emit a bash script that will export environment variables
 func Script(execFlags *flags.LoginExecFlags, shell string) error {
@@ -69,16 +78,33 @@ func Script(execFlags *flags.LoginExecFlags, shell string) error {
 		return errors.Wrap(err, "error loading credentials")
 	}
 
+	if execFlags.CommonFlags.Offline && alibabacloudCreds.Expired() {
+		return fmt.Errorf("no valid cached credentials for profile %s, login requires network access", account.Profile)
+	}
+
+	variables, err := transform.Apply(alibabacloudCreds, account)
+	if err != nil {
+		return errors.Wrap(err, "error transforming credentials")
+	}
+
 	// annoymous struct to pass to template
 	data := struct {
 		ProfileName string
 		*alibabacloudconfig.AliCloudCredentials
+		Variables map[string]string
 	}{
 		account.Profile,
 		alibabacloudCreds,
+		variables,
 	}
 
-	err = buildTmpl(shell, data)
+	out, err := openOutput(account, execFlags.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	err = buildTmpl(out, shell, data)
 	if err != nil {
 		return errors.Wrap(err, "error generating template")
 	}
@@ -86,8 +112,95 @@ func Script(execFlags *flags.LoginExecFlags, shell string) error {
 	return nil
 }
 
-func buildTmpl(shell string, data interface{}) error {
-	t := template.New("envvar_script")
+// printCredentials write the credentials to stdout, or the file given with --output-file, without touching the
+// AlibabaCloud CLI configuration, used by login --no-write
+func printCredentials(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, account *cfg.IDPAccount, loginFlags *flags.LoginExecFlags) error {
+	out, err := openOutput(account, loginFlags.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	format := loginFlags.CredentialFormat
+
+	if format == processFormat {
+		return json.NewEncoder(out).Encode(alibabacloudconfig.NewProcessCredentials(alibabacloudCreds))
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(alibabacloudCreds)
+	}
+
+	if format == "" {
+		format = "bash"
+	}
+
+	variables, err := transform.Apply(alibabacloudCreds, account)
+	if err != nil {
+		return errors.Wrap(err, "error transforming credentials")
+	}
+
+	// annoymous struct to pass to template
+	data := struct {
+		ProfileName string
+		*alibabacloudconfig.AliCloudCredentials
+		Variables map[string]string
+	}{
+		account.Profile,
+		alibabacloudCreds,
+		variables,
+	}
+
+	return buildTmpl(out, format, data)
+}
+
+// openOutput the file given with --output-file once guarded, created readable by the user only, or stdout
+func openOutput(account *cfg.IDPAccount, filename string) (io.WriteCloser, error) {
+	if filename == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	if err := guardOutput(account, filename); err != nil {
+		return nil, errors.Wrap(err, "refusing to write credentials")
+	}
+
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating output file")
+	}
+
+	return f, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// scriptFuncs quote the values of the scripts for each shell, so no value, such as one returned by a credential hook,
+// is run as code when the script is evaluated
+var scriptFuncs = template.FuncMap{
+	"bashQuote":       shellQuote,
+	"fishQuote":       fishQuote,
+	"powershellQuote": powershellQuote,
+}
+
+// fishQuote quote value for fish, which only escapes the backslash and the single quote in single quotes
+func fishQuote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'"
+}
+
+// powershellQuote quote value for PowerShell, which doubles the single quotes, its typographic ones included, in a
+// verbatim string
+func powershellQuote(value string) string {
+	return "'" + strings.NewReplacer("'", "''", "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019", "\u201a", "\u201a\u201a", "\u201b", "\u201b\u201b").Replace(value) + "'"
+}
+
+func buildTmpl(out io.Writer, shell string, data interface{}) error {
+	t := template.New("envvar_script").Funcs(scriptFuncs)
 
 	var err error
 
@@ -103,6 +216,6 @@ func buildTmpl(shell string, data interface{}) error {
 	if err != nil {
 		return err
 	}
-	// this is still written to stdout as per convention
-	return t.Execute(os.Stdout, data)
+	// this is still written to stdout as per convention, unless --output-file is given
+	return t.Execute(out, data)
 }
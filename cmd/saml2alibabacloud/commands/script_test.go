@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTmplVariables(t *testing.T) {
+	data := struct {
+		ProfileName string
+		*alibabacloudconfig.AliCloudCredentials
+		Variables map[string]string
+	}{
+		"saml",
+		&alibabacloudconfig.AliCloudCredentials{AliCloudAccessKey: "STS.key"},
+		map[string]string{"OSS_URL": "https://bucket.oss.example.com/object", "ACK_TOKEN": "token"},
+	}
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, buildTmpl(out, "bash", data))
+	assert.True(t, strings.HasSuffix(out.String(), "export SAML2ALIBABA_CLOUD_PROFILE='saml'\nexport ACK_TOKEN='token'\nexport OSS_URL='https://bucket.oss.example.com/object'\n"))
+
+	out.Reset()
+	assert.Nil(t, buildTmpl(out, "fish", data))
+	assert.Contains(t, out.String(), "set -gx ACK_TOKEN 'token'\n")
+
+	out.Reset()
+	assert.Nil(t, buildTmpl(out, "powershell", data))
+	assert.Contains(t, out.String(), "$env:OSS_URL='https://bucket.oss.example.com/object'\n")
+}
+
+func TestBuildTmplHostileVariable(t *testing.T) {
+	hostile := "a\"b $(touch pwned) `id` c'd\\\ne’f"
+	data := struct {
+		ProfileName string
+		*alibabacloudconfig.AliCloudCredentials
+		Variables map[string]string
+	}{
+		"saml",
+		&alibabacloudconfig.AliCloudCredentials{},
+		map[string]string{"HOSTILE": hostile},
+	}
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, buildTmpl(out, "bash", data))
+	assert.Contains(t, out.String(), "export HOSTILE='a\"b $(touch pwned) `id` c'\\''d\\\ne’f'\n")
+
+	dir, err := ioutil.TempDir("", "script")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cmd := exec.Command("sh", "-c", out.String()+`printf %s "$HOSTILE"`)
+	cmd.Dir = dir
+	value, err := cmd.Output()
+	assert.Nil(t, err)
+	assert.Equal(t, hostile, string(value))
+	_, err = os.Stat(filepath.Join(dir, "pwned"))
+	assert.True(t, os.IsNotExist(err))
+
+	out.Reset()
+	assert.Nil(t, buildTmpl(out, "fish", data))
+	assert.Contains(t, out.String(), "set -gx HOSTILE 'a\"b $(touch pwned) `id` c\\'d\\\\\ne’f'\n")
+
+	out.Reset()
+	assert.Nil(t, buildTmpl(out, "powershell", data))
+	assert.Contains(t, out.String(), "$env:HOSTILE='a\"b $(touch pwned) `id` c''d\\\ne’’f'\n")
+}
@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/sessioncache"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// reasons reported by --silent logins, along with the error classes of the login journal
+const (
+	reasonInteractionRequired = "interaction_required"
+	reasonNoSavedPassword     = "no_saved_password"
+	reasonRoleRequired        = "role_required"
+)
+
+// silentExitCode the exit code used when a --silent login would have needed input
+const silentExitCode = 2
+
+// silentError a failure of a --silent login along with the machine readable reason reported for it
+type silentError struct {
+	reason string
+	msg    string
+}
+
+func (e *silentError) Error() string {
+	return e.msg
+}
+
+// silentFailure the line printed on stdout when a --silent login fails
+type silentFailure struct {
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// silentPrompter fails the login as soon as any input is requested, the providers prompt from deep within their
+// flows, sometimes from another goroutine, so the process exits straight away once the login lock is released
+type silentPrompter struct {
+	out  io.Writer
+	exit func(int)
+}
+
+func (sp *silentPrompter) interactionRequired(pr string) {
+	reportSilentFailure(sp.out, reasonInteractionRequired, fmt.Sprintf("input required: %s", pr))
+	releaseHeldLoginLock()
+	sp.exit(silentExitCode)
+}
+
+func (sp *silentPrompter) RequestSecurityCode(pattern string) string {
+	sp.interactionRequired("security code")
+	return ""
+}
+
+func (sp *silentPrompter) ChooseWithDefault(pr string, defaultValue string, options []string) (string, error) {
+	sp.interactionRequired(pr)
+	return "", nil
+}
+
+func (sp *silentPrompter) Choose(pr string, options []string) int {
+	sp.interactionRequired(pr)
+	return 0
+}
+
+func (sp *silentPrompter) StringRequired(pr string) string {
+	sp.interactionRequired(pr)
+	return ""
+}
+
+func (sp *silentPrompter) String(pr string, defaultValue string) string {
+	sp.interactionRequired(pr)
+	return ""
+}
+
+func (sp *silentPrompter) Password(pr string) string {
+	sp.interactionRequired(pr)
+	return ""
+}
+
+// enableSilent never prompt for the login details and fail on any other prompt
+func enableSilent(loginFlags *flags.LoginExecFlags) {
+	loginFlags.CommonFlags.SkipPrompt = true
+	prompter.SetPrompter(&silentPrompter{out: os.Stdout, exit: os.Exit})
+}
+
+// silentReason the machine readable reason of a failed --silent login
+func silentReason(err error) string {
+	if se, ok := errors.Cause(err).(*silentError); ok {
+		return se.reason
+	}
+	return classifyError(err)
+}
+
+func reportSilentFailure(out io.Writer, reason, msg string) {
+	err := json.NewEncoder(out).Encode(&silentFailure{Status: "failed", Reason: reason, Message: msg})
+	if err != nil {
+		logrus.WithError(err).Debug("unable to report silent login failure")
+	}
+}
+
+// selectRamRoleSilently select the configured role, the only role, or the role last assumed with the IdP account
+func selectRamRoleSilently(samlAssertion string, account *cfg.IDPAccount, idpAccount string) (*saml2alibabacloud.RamRole, error) {
+	alibabacloudRoles, err := permittedRamRoles(samlAssertion, account)
+	if err != nil {
+		return nil, err
+	}
+
+	if account.RoleARN != "" {
+		return saml2alibabacloud.LocateRole(alibabacloudRoles, account.RoleARN)
+	}
+
+	if len(alibabacloudRoles) == 1 {
+		return alibabacloudRoles[0], nil
+	}
+
+	roles, err := sessioncache.NewRoles(rolesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	roleARN, err := roles.Recall(idpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	if roleARN != "" {
+		if role, err := saml2alibabacloud.LocateRole(alibabacloudRoles, roleARN); err == nil {
+			return role, nil
+		}
+	}
+
+	return nil, &silentError{reason: reasonRoleRequired, msg: "several roles are available and none is configured or remembered, set role_arn or login once interactively"}
+}
+
+// rememberRole record the role assumed with the IdP account for later --silent logins
+func rememberRole(idpAccount, roleARN string) {
+	roles, err := sessioncache.NewRoles(rolesPath)
+	if err == nil {
+		err = roles.Remember(idpAccount, roleARN)
+	}
+	if err != nil {
+		logrus.WithError(err).Debug("unable to remember role")
+	}
+}
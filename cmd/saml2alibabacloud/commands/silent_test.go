@@ -0,0 +1,22 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	saml2alibabacloud "github.com/aliyun/saml2alibabacloud"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSilentFailure(t *testing.T) {
+
+	err := errors.Wrap(&silentError{reason: reasonRoleRequired, msg: "no role"}, "error selecting role")
+	assert.Equal(t, reasonRoleRequired, silentReason(err))
+	assert.Equal(t, "timeout", silentReason(&saml2alibabacloud.TimeoutError{Operation: "authentication with the IdP", Timeout: time.Second}))
+
+	out := &bytes.Buffer{}
+	reportSilentFailure(out, silentReason(err), err.Error())
+	assert.Equal(t, `{"status":"failed","reason":"role_required","message":"error selecting role: no role"}`+"\n", out.String())
+}
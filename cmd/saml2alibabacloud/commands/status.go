@@ -0,0 +1,219 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/aliyun/saml2alibabacloud/pkg/loginlock"
+	"github.com/aliyun/saml2alibabacloud/pkg/sessioncache"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ossutilExecutables the names ossutil is installed under, it reads the profiles of the AlibabaCloud CLI
+var ossutilExecutables = []string{"ossutil", "ossutil64"}
+
+// statusAccount an IdP account with its cached IdP session, nil when there is none
+type statusAccount struct {
+	Name    string
+	Account *cfg.IDPAccount
+	Session *sessioncache.Session
+}
+
+// statusProfile a profile of the AlibabaCloud CLI with the role of the last successful login which wrote it
+type statusProfile struct {
+	*alibabacloudconfig.ProfileStatus
+	Role string
+}
+
+// statusIntegration a tool using the profiles, with an empty path when it isn't installed
+type statusIntegration struct {
+	Name    string
+	Path    string
+	Version string
+}
+
+// statusReport everything the status command shows
+type statusReport struct {
+	Accounts     []*statusAccount
+	Profiles     []*statusProfile
+	LoginPID     string
+	Integrations []*statusIntegration
+}
+
+// Status print the configured IdP accounts with their cached IdP sessions, the profiles with when their credentials
+// expire, whether a login is in progress and the tools which use the profiles
+func Status(commonFlags *flags.CommonFlags) error {
+	report, err := collectStatus(commonFlags.ConfigFile, commonFlags.Context, alibabacloudconfig.ConfigFilename())
+	if err != nil {
+		return err
+	}
+
+	report.Integrations = detectIntegrations()
+
+	return writeStatus(os.Stdout, report, time.Now())
+}
+
+// collectStatus read the accounts of the configuration file, with the profiles they use in the context, the IdP
+// sessions, the profiles of the AlibabaCloud CLI configuration and the login lock
+func collectStatus(configFile, context, profilesFile string) (*statusReport, error) {
+	report := &statusReport{}
+
+	cfgm, err := cfg.NewConfigManager(configFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load configuration")
+	}
+
+	names, err := cfgm.IDPAccountNames()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load configuration")
+	}
+
+	cache, err := sessioncache.New(sessionsPath)
+	if err != nil {
+		logrus.WithError(err).Debug("unable to open session cache")
+	}
+
+	for _, name := range names {
+		account, err := cfgm.LoadIDPAccount(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load idp account %s", name)
+		}
+		account.Profile = cfg.ContextProfile(context, account.Profile)
+
+		var session *sessioncache.Session
+		if cache != nil {
+			if session, err = cache.Lookup(name, account.Username); err != nil {
+				logrus.WithError(err).Debug("unable to read session cache")
+			}
+		}
+		report.Accounts = append(report.Accounts, &statusAccount{Name: name, Account: account, Session: session})
+	}
+
+	statuses, err := alibabacloudconfig.Profiles(profilesFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading AlibabaCloud CLI profiles")
+	}
+
+	roles := profileRoles(historyPath)
+	for _, status := range statuses {
+		report.Profiles = append(report.Profiles, &statusProfile{ProfileStatus: status, Role: roles[status.Name]})
+	}
+
+	report.LoginPID, _ = loginlock.Holder(lockPath)
+
+	return report, nil
+}
+
+// profileRoles the role of the last successful login of each profile recorded in the journal
+func profileRoles(filename string) map[string]string {
+	roles := map[string]string{}
+
+	j, err := journal.New(filename)
+	if err != nil {
+		return roles
+	}
+
+	entries, err := j.Entries()
+	if err != nil {
+		logrus.WithError(err).Debug("unable to read the login journal")
+		return roles
+	}
+
+	for _, entry := range entries {
+		if entry.Outcome == journal.OutcomeSuccess && entry.Role != "" {
+			roles[entry.Profile] = entry.Role
+		}
+	}
+
+	return roles
+}
+
+// detectIntegrations look for the AlibabaCloud CLI and ossutil on the PATH
+func detectIntegrations() []*statusIntegration {
+	aliyun := &statusIntegration{Name: "aliyun CLI"}
+	if cli, err := alibabacloudconfig.DetectCLI(); err != nil {
+		logrus.WithError(err).Debug("unable to detect the AlibabaCloud CLI")
+	} else if cli != nil {
+		aliyun.Path = cli.Path
+		aliyun.Version = cli.Version
+	}
+
+	ossutil := &statusIntegration{Name: "ossutil"}
+	for _, executable := range ossutilExecutables {
+		if path, err := exec.LookPath(executable); err == nil {
+			ossutil.Path = path
+			break
+		}
+	}
+
+	return []*statusIntegration{aliyun, ossutil}
+}
+
+// writeStatus print the report as tables, one section after the other
+func writeStatus(out io.Writer, report *statusReport, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "IdP accounts:")
+	if len(report.Accounts) == 0 {
+		fmt.Fprintln(w, "  none configured, run saml2alibabacloud configure")
+	} else {
+		fmt.Fprintln(w, "  ACCOUNT\tPROVIDER\tPROFILE\tIDP SESSION")
+		for _, a := range report.Accounts {
+			session := "none"
+			if a.Session != nil {
+				session = fmt.Sprintf("%s until %s", a.Session.Username, a.Session.Expires.Local().Format(time.RFC3339))
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", a.Name, a.Account.Provider, a.Account.Profile, session)
+		}
+	}
+
+	fmt.Fprintln(w, "\nProfiles:")
+	if len(report.Profiles) == 0 {
+		fmt.Fprintln(w, "  none in the AlibabaCloud CLI configuration")
+	} else {
+		fmt.Fprintln(w, "  PROFILE\tMODE\tEXPIRES\tREMAINING\tROLE")
+		for _, p := range report.Profiles {
+			expires := "-"
+			if !p.Expires.IsZero() {
+				expires = p.Expires.Local().Format(time.RFC3339)
+			}
+			role := p.Role
+			if role == "" {
+				role = "-"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", p.Name, p.Mode, expires, formatRemaining(p.ProfileStatus, now), role)
+		}
+	}
+
+	fmt.Fprintln(w, "\nLogin in progress:")
+	if report.LoginPID != "" {
+		fmt.Fprintf(w, "  yes, pid %s\n", report.LoginPID)
+	} else {
+		fmt.Fprintln(w, "  no")
+	}
+
+	if len(report.Integrations) > 0 {
+		fmt.Fprintln(w, "\nIntegrations:")
+		for _, i := range report.Integrations {
+			switch {
+			case i.Path == "":
+				fmt.Fprintf(w, "  %s\tnot installed\n", i.Name)
+			case i.Version != "":
+				fmt.Fprintf(w, "  %s\t%s\t%s\n", i.Name, i.Path, i.Version)
+			default:
+				fmt.Fprintf(w, "  %s\t%s\n", i.Name, i.Path)
+			}
+		}
+	}
+
+	return w.Flush()
+}
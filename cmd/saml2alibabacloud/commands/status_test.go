@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/aliyun/saml2alibabacloud/pkg/sessioncache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "status")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(sessions, history, lock string) {
+		sessionsPath, historyPath, lockPath = sessions, history, lock
+	}(sessionsPath, historyPath, lockPath)
+	sessionsPath = filepath.Join(dir, "sessions.json")
+	historyPath = filepath.Join(dir, "history.json")
+	lockPath = filepath.Join(dir, "login.lock")
+
+	configFile := filepath.Join(dir, "config")
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte("[default]\nprovider = KeyCloak\nurl = https://id.example.com\nalibabacloud_profile = dev\n\n[prod]\nprovider = Okta\nurl = https://example.okta.com\nalibabacloud_profile = prod\n"), 0600))
+
+	cache, err := sessioncache.New(sessionsPath)
+	assert.Nil(t, err)
+	expires := time.Date(2026, 10, 14, 18, 0, 0, 0, time.UTC)
+	assert.Nil(t, cache.Save("prod", &sessioncache.Session{URL: "https://example.okta.com", Username: "user@example.com", Expires: time.Now().Add(time.Hour)}))
+
+	j, err := journal.New(historyPath)
+	assert.Nil(t, err)
+	assert.Nil(t, j.Record(&journal.Entry{Profile: "prod", Role: "acs:ram::111:role/admin", Outcome: journal.OutcomeSuccess}))
+
+	// the login holding the lock must still run
+	pid := strconv.Itoa(os.Getpid())
+	assert.Nil(t, ioutil.WriteFile(lockPath, []byte(pid+"\n"), 0600))
+
+	report, err := collectStatus(configFile, "", filepath.Join(dir, "missing.json"))
+	assert.Nil(t, err)
+	assert.Len(t, report.Accounts, 2)
+	assert.Equal(t, "default", report.Accounts[0].Name)
+	assert.Nil(t, report.Accounts[0].Session)
+	assert.Equal(t, "user@example.com", report.Accounts[1].Session.Username)
+	assert.Equal(t, pid, report.LoginPID)
+
+	report.Accounts[1].Session.Expires = expires
+	report.Profiles = []*statusProfile{{ProfileStatus: &alibabacloudconfig.ProfileStatus{Name: "prod", Mode: "StsToken", Expires: expires}, Role: profileRoles(historyPath)["prod"]}}
+	report.Integrations = []*statusIntegration{{Name: "aliyun CLI", Path: "/usr/local/bin/aliyun", Version: "3.0.204"}, {Name: "ossutil"}}
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, writeStatus(out, report, expires.Add(-90*time.Minute)))
+	assert.Contains(t, out.String(), "prod     Okta      prod     user@example.com until "+expires.Local().Format(time.RFC3339))
+	assert.Contains(t, out.String(), "1h30m      acs:ram::111:role/admin")
+	assert.Contains(t, out.String(), "yes, pid "+pid)
+	assert.Contains(t, out.String(), "ossutil     not installed")
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/aliyun/saml2alibabacloud/pkg/telemetry"
+	"github.com/sirupsen/logrus"
+)
+
+// reportFailure send an anonymized report of the failed attempt to the telemetry_url of the account, only when the
+// user opted in, failing to do so never fails the login
+func reportFailure(account *cfg.IDPAccount, attempt *journal.Entry, err error) {
+	if err == nil || account.TelemetryURL == "" {
+		return
+	}
+
+	reporter, rerr := telemetry.New(account.TelemetryURL)
+	if rerr == nil {
+		rerr = reporter.Send(buildReport(attempt, err))
+	}
+	if rerr != nil {
+		logrus.WithError(rerr).Debug("unable to send telemetry report")
+	}
+}
+
+// buildReport the failure report, the account, profile, user, IdP URL and roles are deliberately left out
+func buildReport(attempt *journal.Entry, err error) *telemetry.Report {
+	errorCode, requestID := stsErrorDetails(err)
+
+	return &telemetry.Report{
+		Time:       attempt.Time.UTC(),
+		Version:    provider.ClientVersion,
+		OS:         runtime.GOOS + "/" + runtime.GOARCH,
+		Provider:   attempt.Provider,
+		Stage:      attempt.Stage,
+		ErrorClass: classifyError(err),
+		ErrorCode:  errorCode,
+		RequestID:  requestID,
+		DurationMS: time.Since(attempt.Time).Milliseconds(),
+	}
+}
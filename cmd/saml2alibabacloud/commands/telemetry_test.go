@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	sdkError "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+	"github.com/aliyun/saml2alibabacloud/pkg/journal"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildReport(t *testing.T) {
+	attempt := &journal.Entry{
+		Time:     time.Now().Add(-time.Second),
+		Account:  "corp",
+		Provider: "Okta",
+		Profile:  "production",
+		Stage:    journal.StageSTS,
+	}
+	stsErr := sdkError.NewServerError(500, `{"RequestId":"7C3F2E1A-6E2B-4E0C-9D4B-3A1F5C2B8E9D","Code":"InternalError","Message":"The request processing has failed due to some unknown error."}`, "")
+
+	report := buildReport(attempt, errors.Wrap(stsErr, "error logging into AlibabaCloud role using saml assertion"))
+
+	assert.Equal(t, "Okta", report.Provider)
+	assert.Equal(t, journal.StageSTS, report.Stage)
+	assert.Equal(t, "rejected", report.ErrorClass)
+	assert.Equal(t, "InternalError", report.ErrorCode)
+	assert.Equal(t, "7C3F2E1A-6E2B-4E0C-9D4B-3A1F5C2B8E9D", report.RequestID)
+	assert.True(t, report.DurationMS >= 1000)
+
+	data, err := json.Marshal(report)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "corp")
+	assert.NotContains(t, string(data), "production")
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto/tls"
 	"log"
 	"net/http"
 	"os"
@@ -10,6 +9,8 @@ import (
 	"github.com/alecthomas/kingpin"
 	"github.com/aliyun/saml2alibabacloud/cmd/saml2alibabacloud/commands"
 	"github.com/aliyun/saml2alibabacloud/pkg/flags"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/statefile"
 	"github.com/sirupsen/logrus"
 )
 
@@ -65,13 +66,15 @@ func main() {
 	// Common (to all commands) settings
 	commonFlags := new(flags.CommonFlags)
 	app.Flag("config", "Path/filename of saml2alibabacloud config file (env: SAML2ALIBABACLOUD_CONFIGFILE)").Envar("SAML2ALIBABACLOUD_CONFIGFILE").StringVar(&commonFlags.ConfigFile)
+	app.Flag("context", "Name of a separate root for the configuration and caches, for example one per customer. (env: SAML2ALIBABACLOUD_CONTEXT)").Envar("SAML2ALIBABACLOUD_CONTEXT").StringVar(&commonFlags.Context)
 	app.Flag("idp-account", "The name of the configured IDP account. (env: SAML2ALIBABACLOUD_IDP_ACCOUNT)").Envar("SAML2ALIBABACLOUD_IDP_ACCOUNT").Short('a').Default("default").StringVar(&commonFlags.IdpAccount)
-	app.Flag("idp-provider", "The configured IDP provider. (env: SAML2ALIBABACLOUD_IDP_PROVIDER)").Envar("SAML2ALIBABACLOUD_IDP_PROVIDER").EnumVar(&commonFlags.IdpProvider, "Akamai", "AzureAD", "ADFS", "ADFS2", "GoogleApps", "Ping", "JumpCloud", "Okta", "OneLogin", "PSU", "KeyCloak", "F5APM", "Shibboleth", "ShibbolethECP", "NetIQ")
+	app.Flag("idp-provider", "The configured IDP provider. (env: SAML2ALIBABACLOUD_IDP_PROVIDER)").Envar("SAML2ALIBABACLOUD_IDP_PROVIDER").EnumVar(&commonFlags.IdpProvider, "Akamai", "AzureAD", "ADFS", "ADFS2", "GoogleApps", "Ping", "JumpCloud", "Okta", "OneLogin", "PSU", "KeyCloak", "F5APM", "Shibboleth", "ShibbolethECP", "NetIQ", "DuoSSO", "CyberArk", "WSO2", "Authentik", "Authelia", "IDCS", "WorkspaceONE", "Gluu", "Casdoor", "Salesforce", "SimpleSAMLphp", "AlibabaCloudIDaaS", "Ipsilon", "LastPass", "Rippling", "Citrix", "ForgeRock", "Entrust", "Dex", "ECP", "Kanidm", "Keeper", "HENNGE", "MachineIdentity")
 	app.Flag("mfa", "The name of the mfa. (env: SAML2ALIBABACLOUD_MFA)").Envar("SAML2ALIBABACLOUD_MFA").StringVar(&commonFlags.MFA)
 	app.Flag("skip-verify", "Skip verification of server certificate. (env: SAML2ALIBABACLOUD_SKIP_VERIFY)").Envar("SAML2ALIBABACLOUD_SKIP_VERIFY").Short('s').BoolVar(&commonFlags.SkipVerify)
 	app.Flag("url", "The URL of the SAML IDP server used to login. (env: SAML2ALIBABACLOUD_URL)").Envar("SAML2ALIBABACLOUD_URL").StringVar(&commonFlags.URL)
 	app.Flag("username", "The username used to login. (env: SAML2ALIBABACLOUD_USERNAME)").Envar("SAML2ALIBABACLOUD_USERNAME").StringVar(&commonFlags.Username)
 	app.Flag("password", "The password used to login. (env: SAML2ALIBABACLOUD_PASSWORD)").Envar("SAML2ALIBABACLOUD_PASSWORD").StringVar(&commonFlags.Password)
+	app.Flag("mfa-device", "The name of the MFA device to use when several are enrolled (supported in Okta, OneLogin, PingFed, PingOne). (env: SAML2ALIBABACLOUD_MFA_DEVICE)").Envar("SAML2ALIBABACLOUD_MFA_DEVICE").StringVar(&commonFlags.MFADevice)
 	app.Flag("mfa-token", "The current MFA token (supported in Keycloak, ADFS, GoogleApps). (env: SAML2ALIBABACLOUD_MFA_TOKEN)").Envar("SAML2ALIBABACLOUD_MFA_TOKEN").StringVar(&commonFlags.MFAToken)
 	app.Flag("role", "The ARN of the role to assume. (env: SAML2ALIBABACLOUD_ROLE)").Envar("SAML2ALIBABACLOUD_ROLE").StringVar(&commonFlags.RoleArn)
 	app.Flag("urn", "The URN used by SAML when you login. (env: SAML2ALIBABACLOUD_URN)").Envar("SAML2ALIBABACLOUD_URN").StringVar(&commonFlags.AlibabaCloudURN)
@@ -79,15 +82,20 @@ func main() {
 	app.Flag("session-duration", "The duration of your AlibabaCloud Session. (env: SAML2ALIBABACLOUD_SESSION_DURATION)").Envar("SAML2ALIBABACLOUD_SESSION_DURATION").IntVar(&commonFlags.SessionDuration)
 	app.Flag("disable-keychain", "Do not use keychain at all.").Envar("SAML2ALIBABACLOUD_DISABLE_KEYCHAIN").BoolVar(&commonFlags.DisableKeychain)
 	app.Flag("region", "AlibabaCloud region to use for API requests, e.g. cn-hangzhou, ap-southeast-1 (env: SAML2ALIBABACLOUD_REGION)").Envar("SAML2ALIBABACLOUD_REGION").Short('r').StringVar(&commonFlags.Region)
+	app.Flag("offline", "Only use still valid cached credentials, no IdP or STS calls are made. (env: SAML2ALIBABACLOUD_OFFLINE)").Envar("SAML2ALIBABACLOUD_OFFLINE").BoolVar(&commonFlags.Offline)
+	app.Flag("web-prompt", "When there is no terminal, prompt in a localhost web page whose single use URL is logged. (env: SAML2ALIBABACLOUD_WEB_PROMPT)").Envar("SAML2ALIBABACLOUD_WEB_PROMPT").BoolVar(&commonFlags.WebPrompt)
 
 	// `configure` command and settings
 	cmdConfigure := app.Command("configure", "Configure a new IDP account.")
 	cmdConfigure.Flag("app-id", "OneLogin app id required for SAML assertion. (env: ONELOGIN_APP_ID)").Envar("ONELOGIN_APP_ID").StringVar(&commonFlags.AppID)
+	cmdConfigure.Flag("app-name", "AzureAD enterprise application name, looked up in My Apps when the app id isn't known. (env: SAML2ALIBABACLOUD_APP_NAME)").Envar("SAML2ALIBABACLOUD_APP_NAME").StringVar(&commonFlags.AppName)
 	cmdConfigure.Flag("client-id", "OneLogin client id, used to generate API access token. (env: ONELOGIN_CLIENT_ID)").Envar("ONELOGIN_CLIENT_ID").StringVar(&commonFlags.ClientID)
 	cmdConfigure.Flag("client-secret", "OneLogin client secret, used to generate API access token. (env: ONELOGIN_CLIENT_SECRET)").Envar("ONELOGIN_CLIENT_SECRET").StringVar(&commonFlags.ClientSecret)
+	cmdConfigure.Flag("tenant-id", "AzureAD tenant ID or domain, or organizations / consumers for multi-tenant apps. (env: SAML2ALIBABACLOUD_TENANT_ID)").Envar("SAML2ALIBABACLOUD_TENANT_ID").StringVar(&commonFlags.TenantID)
 	cmdConfigure.Flag("subdomain", "OneLogin subdomain of your company account. (env: ONELOGIN_SUBDOMAIN)").Envar("ONELOGIN_SUBDOMAIN").StringVar(&commonFlags.Subdomain)
 	cmdConfigure.Flag("profile", "The AlibabaCloud CLI profile to save the temporary credentials. (env: SAML2ALIBABACLOUD_PROFILE)").Envar("SAML2ALIBABACLOUD_PROFILE").Short('p').StringVar(&commonFlags.Profile)
 	cmdConfigure.Flag("resource-id", "F5APM SAML resource ID of your company account. (env: SAML2ALIBABACLOUD_F5APM_RESOURCE_ID)").Envar("SAML2ALIBABACLOUD_F5APM_RESOURCE_ID").StringVar(&commonFlags.ResourceID)
+	cmdConfigure.Flag("register-aliyun-process", "Make the AlibabaCloud CLI profile run saml2alibabacloud whenever it needs credentials.").BoolVar(&commonFlags.RegisterAliyunProcess)
 	configFlags := commonFlags
 
 	// `login` command and settings
@@ -98,7 +106,17 @@ func main() {
 	cmdLogin.Flag("duo-mfa-option", "The MFA option you want to use to authenticate with").Envar("SAML2ALIBABACLOUD_DUO_MFA_OPTION").EnumVar(&loginFlags.DuoMFAOption, "Passcode", "Duo Push")
 	cmdLogin.Flag("client-id", "OneLogin client id, used to generate API access token. (env: ONELOGIN_CLIENT_ID)").Envar("ONELOGIN_CLIENT_ID").StringVar(&commonFlags.ClientID)
 	cmdLogin.Flag("client-secret", "OneLogin client secret, used to generate API access token. (env: ONELOGIN_CLIENT_SECRET)").Envar("ONELOGIN_CLIENT_SECRET").StringVar(&commonFlags.ClientSecret)
+	cmdLogin.Flag("tenant-id", "AzureAD tenant ID or domain, or organizations / consumers for multi-tenant apps. (env: SAML2ALIBABACLOUD_TENANT_ID)").Envar("SAML2ALIBABACLOUD_TENANT_ID").StringVar(&commonFlags.TenantID)
 	cmdLogin.Flag("force", "Refresh credentials even if not expired.").BoolVar(&loginFlags.Force)
+	cmdLogin.Flag("no-write", "Print the credentials to stdout instead of writing the AlibabaCloud CLI configuration or keychain. (env: SAML2ALIBABACLOUD_NO_WRITE)").Envar("SAML2ALIBABACLOUD_NO_WRITE").BoolVar(&loginFlags.NoWrite)
+	cmdLogin.Flag("credential-format", "Format of the credentials printed with --no-write. Options include: bash, powershell, fish, json, process").Default("bash").EnumVar(&loginFlags.CredentialFormat, "bash", "powershell", "fish", "json", "process")
+	cmdLogin.Flag("output-file", "With --no-write, write the credentials to this file instead of stdout.").StringVar(&loginFlags.OutputFile)
+	cmdLogin.Flag("list-roles-json", "Print the roles available to assume as JSON on stdout, for GUI wrappers presenting their own role picker.").BoolVar(&loginFlags.ListRolesJSON)
+	cmdLogin.Flag("no-assume", "With --list-roles-json, wait for the selected role ARN on stdin instead of selecting the role.").BoolVar(&loginFlags.NoAssume)
+	cmdLogin.Flag("silent", "Never prompt, use the cached IdP session, saved password and configured or remembered role, or fail straight away with a JSON reason on stdout.").BoolVar(&loginFlags.Silent)
+	cmdLogin.Flag("check-profile", "After writing the profile, check it with the installed AlibabaCloud CLI, or with STS when the CLI isn't installed. (env: SAML2ALIBABACLOUD_CHECK_PROFILE)").Envar("SAML2ALIBABACLOUD_CHECK_PROFILE").BoolVar(&loginFlags.CheckProfile)
+	cmdLogin.Flag("dry-run", "Authenticate and select the role, then print the STS call that would be made instead of making it.").BoolVar(&loginFlags.DryRun)
+	cmdLogin.Flag("capture-proxy", "Instead of authenticating with the IdP, run a proxy for the browser on this address, such as 127.0.0.1:8990, and capture the SAML assertion it posts to the Alibaba Cloud sign in.").PlaceHolder("ADDRESS").StringVar(&loginFlags.CaptureProxy)
 
 	// `exec` command and settings
 	cmdExec := app.Command("exec", "Exec the supplied command with env vars from STS token.")
@@ -106,6 +124,7 @@ func main() {
 	execFlags.CommonFlags = commonFlags
 	cmdExec.Flag("profile", "The AlibabaCloud CLI profile to save the temporary credentials. (env: SAML2ALIBABACLOUD_PROFILE)").Envar("SAML2ALIBABACLOUD_PROFILE").Short('p').StringVar(&commonFlags.Profile)
 	cmdExec.Flag("exec-profile", "The AlibabaCloud CLI profile to utilize for command execution. Useful to allow the `aliyun` cli to perform secondary role assumption. (env: SAML2ALIBABACLOUD_EXEC_PROFILE)").Envar("SAML2ALIBABACLOUD_EXEC_PROFILE").StringVar(&execFlags.ExecProfile)
+	cmdExec.Flag("silent", "Never prompt, use the cached IdP session, saved password and configured or remembered role, or fail straight away with a JSON reason on stdout.").BoolVar(&execFlags.Silent)
 	cmdLine := buildCmdList(cmdExec.Arg("command", "The command to execute."))
 
 	// `console` command and settings
@@ -133,6 +152,81 @@ func main() {
 		Flag("shell", "Type of shell environment. Options include: bash, powershell, fish").
 		Default("bash").
 		EnumVar(&shell, "bash", "powershell", "fish")
+	cmdScript.Flag("output-file", "Write the script to this file instead of stdout.").StringVar(&scriptFlags.OutputFile)
+
+	// `cloudshell` command and settings
+	cmdCloudShell := app.Command("cloudshell", "Print a command which configures the aliyun CLI of Cloud Shell with the credentials of the profile.")
+	cloudShellFlags := new(flags.LoginExecFlags)
+	cloudShellFlags.CommonFlags = commonFlags
+	cmdCloudShell.Flag("profile", "The AlibabaCloud CLI profile whose credentials are exported. (env: SAML2ALIBABACLOUD_PROFILE)").Envar("SAML2ALIBABACLOUD_PROFILE").Short('p').StringVar(&commonFlags.Profile)
+	cmdCloudShell.Flag("output-file", "Write the command to this file instead of stdout.").StringVar(&cloudShellFlags.OutputFile)
+
+	// `prewarm` command and settings
+	cmdPrewarm := app.Command("prewarm", "Authenticate with the IdP and cache the session for later role logins, STS is not called.")
+	prewarmFlags := new(flags.LoginExecFlags)
+	prewarmFlags.CommonFlags = commonFlags
+	cmdPrewarm.Flag("duo-mfa-option", "The MFA option you want to use to authenticate with").Envar("SAML2ALIBABACLOUD_DUO_MFA_OPTION").EnumVar(&prewarmFlags.DuoMFAOption, "Passcode", "Duo Push")
+
+	// `batch` command and settings
+	cmdBatch := app.Command("batch", "Refresh the credentials of the profiles listed in a YAML file of (assertion source, role, profile) jobs.")
+	batchFlags := new(flags.LoginExecFlags)
+	batchFlags.CommonFlags = commonFlags
+	var batchFile string
+	var batchConcurrency int
+	cmdBatch.Flag("file", "The YAML file listing the jobs.").Required().StringVar(&batchFile)
+	cmdBatch.Flag("concurrency", "Number of jobs run at once, overrides the concurrency of the file, 4 when neither sets it.").IntVar(&batchConcurrency)
+
+	// `provider-test` command and settings
+	cmdProviderTest := app.Command("provider-test", "Run the provider of the IdP account through its login flow and report which steps pass for each MFA type.")
+	providerTestFlags := new(flags.LoginExecFlags)
+	providerTestFlags.CommonFlags = commonFlags
+	var providerTestMFAs []string
+	var providerTestFixtures, providerTestRecord string
+	cmdProviderTest.Flag("test-mfa", "MFA type to test, repeat for several, the configured MFA by default.").StringsVar(&providerTestMFAs)
+	cmdProviderTest.Flag("fixtures", "Directory of a recorded fixture suite to replay instead of contacting the IdP, one <MFA>.json per MFA type.").StringVar(&providerTestFixtures)
+	cmdProviderTest.Flag("record", "Directory to record the IdP exchanges of a live run into, as a fixture suite.").StringVar(&providerTestRecord)
+
+	// `list-profiles` command and settings
+	cmdListProfiles := app.Command("list-profiles", "List the AlibabaCloud CLI profiles with when their credentials expire.")
+	var listProfilesJSON bool
+	var listProfilesPrompt string
+	cmdListProfiles.Flag("json", "Print the profiles as JSON.").BoolVar(&listProfilesJSON)
+	cmdListProfiles.Flag("prompt", "Only print the profile and how long its credentials remain valid, for shell prompts.").PlaceHolder("PROFILE").StringVar(&listProfilesPrompt)
+
+	// `history` command and settings
+	cmdHistory := app.Command("history", "Show the most recent login attempts.")
+	var historyLimit int
+	var historyJSON bool
+	cmdHistory.Flag("limit", "Number of attempts to show.").Default("20").IntVar(&historyLimit)
+	cmdHistory.Flag("json", "Print the attempts as JSON.").BoolVar(&historyJSON)
+
+	// `status` command
+	cmdStatus := app.Command("status", "Show the IdP accounts with their cached IdP sessions, the profiles with when their credentials expire, and the tools using them.")
+
+	// `rollback` command and settings
+	cmdRollback := app.Command("rollback", "Restore the AlibabaCloud CLI configuration from a backup taken before it was rewritten.")
+	var rollbackList bool
+	var rollbackBackup string
+	cmdRollback.Flag("list", "List the available backups.").BoolVar(&rollbackList)
+	cmdRollback.Flag("backup", "Name of the backup to restore, the latest one by default.").StringVar(&rollbackBackup)
+
+	// `mfa` commands and settings
+	cmdMfa := app.Command("mfa", "Manage the MFA factors of the IdP account.")
+	cmdMfaEnrollTOTP := cmdMfa.Command("enroll-totp", "Enroll an authenticator app factor with Okta or KeyCloak and store its secret in the keychain, so logins no longer ask for a code.")
+	mfaFlags := new(flags.LoginExecFlags)
+	mfaFlags.CommonFlags = commonFlags
+
+	// `config` commands and settings
+	cmdConfig := app.Command("config", "Manage the configuration file.")
+	cmdConfigMigrate := cmdConfig.Command("migrate", "Rename the old keys of the configuration file, such as the aws_* keys of saml2aws, and report the deprecated ones.")
+	var configMigrateDryRun bool
+	cmdConfigMigrate.Flag("dry-run", "Report what would be migrated without updating the configuration file.").BoolVar(&configMigrateDryRun)
+	cmdConfigLint := cmdConfig.Command("lint", "Report insecure settings, such as skip_verify, passwords in environment variables, credential files others can read and long sessions, failing when some are found.")
+	var configLintMaxSessionDuration int
+	var configLintFix, configLintJSON bool
+	cmdConfigLint.Flag("max-session-duration", "The longest alibabacloud_session_duration accepted, in seconds.").Default("14400").IntVar(&configLintMaxSessionDuration)
+	cmdConfigLint.Flag("fix", "Restrict the credential files others can read to the user.").BoolVar(&configLintFix)
+	cmdConfigLint.Flag("json", "Print the findings as JSON, for compliance scans.").BoolVar(&configLintJSON)
 
 	// Trigger the parsing of the command line inputs via kingpin
 	command := kingpin.MustParse(app.Parse(os.Args[1:]))
@@ -149,16 +243,31 @@ func main() {
 		errtpl = "%+v\n"
 	}
 
-	// Set the default transport settings so all http clients will pick them up.
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: commonFlags.SkipVerify}
+	// Set the default transport settings so all http clients will pick them up, TLS verification is only skipped
+	// by the IdP clients for the hosts allowed by the account so STS and the console are always verified.
 	http.DefaultTransport.(*http.Transport).Proxy = http.ProxyFromEnvironment
 
 	logrus.WithField("command", command).Debug("Running")
 
+	if commonFlags.WebPrompt && !prompter.HasTerminal() {
+		prompter.SetPrompter(prompter.NewWeb(prompter.DefaultWebTimeout))
+	}
+
+	if commonFlags.DisableKeychain {
+		statefile.DisableKeyring()
+	}
+
+	if err := commands.UseContext(commonFlags); err != nil {
+		log.Printf(errtpl, err)
+		os.Exit(1)
+	}
+
 	var err error
 	switch command {
 	case cmdScript.FullCommand():
 		err = commands.Script(scriptFlags, shell)
+	case cmdCloudShell.FullCommand():
+		err = commands.CloudShell(cloudShellFlags)
 	case cmdLogin.FullCommand():
 		err = commands.Login(loginFlags)
 	case cmdExec.FullCommand():
@@ -169,6 +278,26 @@ func main() {
 		err = commands.ListRoles(listRolesFlags)
 	case cmdConfigure.FullCommand():
 		err = commands.Configure(configFlags)
+	case cmdPrewarm.FullCommand():
+		err = commands.Prewarm(prewarmFlags)
+	case cmdBatch.FullCommand():
+		err = commands.Batch(batchFlags, batchFile, batchConcurrency)
+	case cmdProviderTest.FullCommand():
+		err = commands.ProviderTest(providerTestFlags, providerTestMFAs, providerTestFixtures, providerTestRecord)
+	case cmdListProfiles.FullCommand():
+		err = commands.ListProfiles(listProfilesJSON, listProfilesPrompt)
+	case cmdHistory.FullCommand():
+		err = commands.History(historyLimit, historyJSON)
+	case cmdStatus.FullCommand():
+		err = commands.Status(commonFlags)
+	case cmdRollback.FullCommand():
+		err = commands.Rollback(rollbackList, rollbackBackup)
+	case cmdMfaEnrollTOTP.FullCommand():
+		err = commands.EnrollTOTP(mfaFlags)
+	case cmdConfigMigrate.FullCommand():
+		err = commands.ConfigMigrate(commonFlags, configMigrateDryRun)
+	case cmdConfigLint.FullCommand():
+		err = commands.ConfigLint(commonFlags, configLintMaxSessionDuration, configLintFix, configLintJSON)
 	}
 
 	if err != nil {
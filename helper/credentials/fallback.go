@@ -0,0 +1,79 @@
+package credentials
+
+import (
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+// What to do when the keyring of the system can't be used, see ApplyFallback
+const (
+	// FallbackPrompt nothing is saved, the password is prompted for at each login
+	FallbackPrompt = "prompt"
+	// FallbackFile the credentials are kept in files encrypted with a passphrase
+	FallbackFile = "file"
+	// FallbackFail the login fails
+	FallbackFail = "fail"
+)
+
+// probeURL the entry looked up to check the keyring can be read, it is never stored
+const probeURL = "https://keyring-check.saml2alibabacloud.invalid"
+
+// HelperError why the helper of the platform couldn't be set up, for example no keyring service in the session
+var HelperError error
+
+// fallbackApplied the policy is applied once per run
+var fallbackApplied bool
+
+// Check whether the keyring of the system can be used, looking up an entry which doesn't exist
+func Check() error {
+	if HelperError != nil {
+		return HelperError
+	}
+	if !CurrentHelper.SupportsCredentialStorage() {
+		return errors.New("no keyring is supported on this system")
+	}
+
+	_, _, err := CurrentHelper.Get(probeURL)
+	if err != nil && !IsErrCredentialsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// ApplyFallback check the keyring of the system and, when it can't be used, apply the policy, prompt when empty,
+// newFileHelper opens the encrypted files with the file policy
+func ApplyFallback(policy string, newFileHelper func() (Helper, error)) error {
+	if fallbackApplied {
+		return nil
+	}
+
+	switch policy {
+	case "", FallbackPrompt, FallbackFile, FallbackFail:
+	default:
+		return errors.Errorf("invalid keyring_fallback %s, use prompt, file or fail", policy)
+	}
+
+	err := Check()
+	fallbackApplied = true
+	if err == nil {
+		return nil
+	}
+
+	switch policy {
+	case FallbackFail:
+		return errors.Wrap(err, "the system keyring is unavailable and keyring_fallback is fail")
+	case FallbackFile:
+		helper, herr := newFileHelper()
+		if herr != nil {
+			return errors.Wrap(herr, "the system keyring is unavailable and the keyring file can't be opened")
+		}
+		log.Printf("The system keyring is unavailable (%v), using the encrypted keyring file", err)
+		CurrentHelper = helper
+	default:
+		log.Printf("The system keyring is unavailable (%v), the password will be prompted for and not saved, set keyring_fallback to file or fail to change this", err)
+		CurrentHelper = &defaultHelper{}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package credentials
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// lockedHelper a keyring which can't be read, as a locked keychain without user interaction
+type lockedHelper struct {
+	memoryHelper
+}
+
+func (lockedHelper) Get(serverURL string) (string, string, error) {
+	return "", "", errors.New("User interaction is not allowed.")
+}
+
+func TestApplyFallback(t *testing.T) {
+	defer func() {
+		CurrentHelper = &defaultHelper{}
+		fallbackApplied = false
+	}()
+
+	noFile := func() (Helper, error) { return nil, errors.New("unexpected") }
+
+	// a working keyring is kept whatever the policy
+	working := &memoryHelper{entries: map[string]*Credentials{}}
+	CurrentHelper = working
+	require.Nil(t, ApplyFallback(FallbackFail, noFile))
+	require.Equal(t, working, CurrentHelper)
+
+	fallbackApplied = false
+	CurrentHelper = &lockedHelper{}
+	require.EqualError(t, ApplyFallback(FallbackFail, noFile), "the system keyring is unavailable and keyring_fallback is fail: User interaction is not allowed.")
+
+	fallbackApplied = false
+	CurrentHelper = &lockedHelper{}
+	require.Nil(t, ApplyFallback("", noFile))
+	require.False(t, SupportsStorage())
+
+	fallbackApplied = false
+	CurrentHelper = &lockedHelper{}
+	file := &memoryHelper{entries: map[string]*Credentials{}}
+	require.Nil(t, ApplyFallback(FallbackFile, func() (Helper, error) { return file, nil }))
+	require.Equal(t, file, CurrentHelper)
+
+	// the policy is applied once
+	CurrentHelper = &lockedHelper{}
+	require.Nil(t, ApplyFallback(FallbackFail, noFile))
+
+	fallbackApplied = false
+	require.EqualError(t, ApplyFallback("plaintext", noFile), "invalid keyring_fallback plaintext, use prompt, file or fail")
+}
+
+func TestCheckHelperError(t *testing.T) {
+	HelperError = errors.New("The name org.freedesktop.secrets was not provided by any .service files")
+	defer func() { HelperError = nil }()
+
+	require.Equal(t, HelperError, Check())
+}
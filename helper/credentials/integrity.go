@@ -0,0 +1,63 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+)
+
+// IntegrityKeyURL the entry in the credentials store holding the key which protects the local state files
+const IntegrityKeyURL = "https://saml2alibabacloud/state-integrity-key"
+
+// ErrIntegrityKeyUnavailable returned when there is no credentials store to hold the integrity key
+var ErrIntegrityKeyUnavailable = errors.New("no credentials store available for the state integrity key")
+
+var (
+	integrityKeyMu sync.Mutex
+	integrityKey   []byte
+)
+
+// IntegrityKey return the machine local key used to protect the state files, it is generated and stored on first use
+func IntegrityKey() ([]byte, error) {
+	integrityKeyMu.Lock()
+	defer integrityKeyMu.Unlock()
+
+	if integrityKey != nil {
+		return integrityKey, nil
+	}
+
+	if !CurrentHelper.SupportsCredentialStorage() {
+		return nil, ErrIntegrityKeyUnavailable
+	}
+
+	_, secret, err := CurrentHelper.Get(IntegrityKeyURL)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, err
+		}
+		integrityKey = key
+		return integrityKey, nil
+	}
+	if !IsErrCredentialsNotFound(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	err = CurrentHelper.Add(&Credentials{
+		ServerURL: IntegrityKeyURL,
+		Username:  "saml2alibabacloud",
+		Secret:    base64.StdEncoding.EncodeToString(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	integrityKey = key
+	return integrityKey, nil
+}
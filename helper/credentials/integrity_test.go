@@ -0,0 +1,32 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrityKey(t *testing.T) {
+	helper := &memoryHelper{entries: map[string]*Credentials{}}
+	CurrentHelper = helper
+	defer func() {
+		CurrentHelper = &defaultHelper{}
+		integrityKey = nil
+	}()
+
+	key, err := IntegrityKey()
+	require.Nil(t, err)
+	require.Len(t, key, 32)
+	require.Contains(t, helper.entries, IntegrityKeyURL)
+
+	// a new process reads the stored key back
+	integrityKey = nil
+	again, err := IntegrityKey()
+	require.Nil(t, err)
+	require.Equal(t, key, again)
+}
+
+func TestIntegrityKeyUnavailable(t *testing.T) {
+	_, err := IntegrityKey()
+	require.Equal(t, ErrIntegrityKeyUnavailable, err)
+}
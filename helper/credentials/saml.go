@@ -1,15 +1,28 @@
 package credentials
 
 import (
+	"net/url"
 	"path"
+	"strings"
 
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
 )
 
+// UserServerURL build the key used to store the secret of an additional username for the given server URL.
+// This keeps the entries of, for example, a standard and a privileged identity apart under the same IdP account.
+func UserServerURL(serverURL, username string) string {
+	return strings.TrimSuffix(serverURL, "/") + "/saml2alibabacloud/users/" + url.PathEscape(username)
+}
+
+// TOTPServerURL build the key used to store the TOTP secret enrolled for the username of the given server URL.
+func TOTPServerURL(serverURL, username string) string {
+	return strings.TrimSuffix(serverURL, "/") + "/saml2alibabacloud/totp/" + url.PathEscape(username)
+}
+
 // LookupCredentials lookup an existing set of credentials and validate it.
 func LookupCredentials(loginDetails *creds.LoginDetails, provider string) error {
 
-	username, password, err := CurrentHelper.Get(loginDetails.URL)
+	username, password, err := lookupUserCredentials(loginDetails.URL, loginDetails.Username)
 	if err != nil {
 		return err
 	}
@@ -28,9 +41,39 @@ func LookupCredentials(loginDetails *creds.LoginDetails, provider string) error
 	return nil
 }
 
+func lookupUserCredentials(serverURL, username string) (string, string, error) {
+	if username != "" {
+		storedUsername, password, err := CurrentHelper.Get(UserServerURL(serverURL, username))
+		if err == nil {
+			return storedUsername, password, nil
+		}
+		if !IsErrCredentialsNotFound(err) {
+			return "", "", err
+		}
+	}
+
+	storedUsername, password, err := CurrentHelper.Get(serverURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the entry for the server URL belongs to another identity
+	if username != "" && storedUsername != username {
+		return "", "", ErrCredentialsNotFound
+	}
+
+	return storedUsername, password, nil
+}
+
 // SaveCredentials save the user credentials.
 func SaveCredentials(url, username, password string) error {
 
+	// keep the existing entry for the server URL if it belongs to another identity
+	storedUsername, _, err := CurrentHelper.Get(url)
+	if err == nil && storedUsername != "" && storedUsername != username {
+		url = UserServerURL(url, username)
+	}
+
 	creds := &Credentials{
 		ServerURL: url,
 		Username:  username,
@@ -40,6 +83,21 @@ func SaveCredentials(url, username, password string) error {
 	return CurrentHelper.Add(creds)
 }
 
+// SaveTOTPSecret save the TOTP secret enrolled for the user.
+func SaveTOTPSecret(url, username, secret string) error {
+	return CurrentHelper.Add(&Credentials{
+		ServerURL: TOTPServerURL(url, username),
+		Username:  username,
+		Secret:    secret,
+	})
+}
+
+// LookupTOTPSecret lookup the TOTP secret enrolled for the user.
+func LookupTOTPSecret(url, username string) (string, error) {
+	_, secret, err := CurrentHelper.Get(TOTPServerURL(url, username))
+	return secret, err
+}
+
 // SupportsStorage will return true or false if storage is supported.
 func SupportsStorage() bool {
 	return CurrentHelper.SupportsCredentialStorage()
@@ -0,0 +1,82 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryHelper struct {
+	entries map[string]*Credentials
+}
+
+func (mh *memoryHelper) Add(c *Credentials) error {
+	mh.entries[c.ServerURL] = c
+	return nil
+}
+
+func (mh *memoryHelper) Delete(serverURL string) error {
+	delete(mh.entries, serverURL)
+	return nil
+}
+
+func (mh *memoryHelper) Get(serverURL string) (string, string, error) {
+	c, ok := mh.entries[serverURL]
+	if !ok {
+		return "", "", ErrCredentialsNotFound
+	}
+	return c.Username, c.Secret, nil
+}
+
+func (mh *memoryHelper) SupportsCredentialStorage() bool {
+	return true
+}
+
+func TestMultipleUsernames(t *testing.T) {
+	helper := &memoryHelper{entries: map[string]*Credentials{}}
+	CurrentHelper = helper
+	defer func() { CurrentHelper = &defaultHelper{} }()
+
+	serverURL := "https://id.example.com"
+
+	require.Nil(t, SaveCredentials(serverURL, "user@example.com", "secret"))
+	require.Nil(t, SaveCredentials(serverURL, "admin@example.com", "privileged"))
+	require.Len(t, helper.entries, 2)
+	require.Contains(t, helper.entries, UserServerURL(serverURL, "admin@example.com"))
+
+	loginDetails := &creds.LoginDetails{URL: serverURL, Username: "user@example.com"}
+	require.Nil(t, LookupCredentials(loginDetails, "Okta"))
+	require.Equal(t, "secret", loginDetails.Password)
+
+	loginDetails = &creds.LoginDetails{URL: serverURL, Username: "admin@example.com"}
+	require.Nil(t, LookupCredentials(loginDetails, "Okta"))
+	require.Equal(t, "privileged", loginDetails.Password)
+
+	loginDetails = &creds.LoginDetails{URL: serverURL, Username: "other@example.com"}
+	require.True(t, IsErrCredentialsNotFound(LookupCredentials(loginDetails, "Okta")))
+
+	loginDetails = &creds.LoginDetails{URL: serverURL}
+	require.Nil(t, LookupCredentials(loginDetails, "Okta"))
+	require.Equal(t, "user@example.com", loginDetails.Username)
+}
+
+func TestTOTPSecret(t *testing.T) {
+	helper := &memoryHelper{entries: map[string]*Credentials{}}
+	CurrentHelper = helper
+	defer func() { CurrentHelper = &defaultHelper{} }()
+
+	require.Nil(t, SaveCredentials("https://id.example.com", "wile", "secret"))
+	require.Nil(t, SaveTOTPSecret("https://id.example.com", "wile", "JBSWY3DPEHPK3PXP"))
+
+	secret, err := LookupTOTPSecret("https://id.example.com", "wile")
+	require.Nil(t, err)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", secret)
+
+	_, err = LookupTOTPSecret("https://id.example.com", "roadrunner")
+	require.True(t, IsErrCredentialsNotFound(err))
+
+	loginDetails := &creds.LoginDetails{URL: "https://id.example.com", Username: "wile"}
+	require.Nil(t, LookupCredentials(loginDetails, "Okta"))
+	require.Equal(t, "secret", loginDetails.Password)
+}
@@ -0,0 +1,200 @@
+package filekeyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/aliyun/saml2alibabacloud/helper/credentials"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// DefaultPath the default location of the keyring file
+const DefaultPath = "~/.saml2alibabacloud-keyring"
+
+// the scrypt parameters deriving the key from the passphrase
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	keyLength    = 32
+	saltLength   = 16
+	fileFormatV1 = 1
+)
+
+// sealedFile the on disk format, the entries are encrypted with AES-GCM
+type sealedFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// FileKeyring keep the credentials in a file encrypted with a key derived from a passphrase, for the systems whose
+// keyring can't be used such as headless SSH sessions
+type FileKeyring struct {
+	filename string
+	password func() (string, error)
+
+	salt []byte
+	key  []byte
+}
+
+// New create a keyring stored in filename, DefaultPath if empty, the passphrase is asked to password once the file
+// is first read or written
+func New(filename string, password func() (string, error)) (*FileKeyring, error) {
+	if filename == "" {
+		filename = DefaultPath
+	}
+
+	path, err := homedir.Expand(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving keyring file path")
+	}
+
+	return &FileKeyring{filename: path, password: password}, nil
+}
+
+func (fk *FileKeyring) Add(creds *credentials.Credentials) error {
+	entries, err := fk.load()
+	if err != nil {
+		return err
+	}
+
+	entries[creds.ServerURL] = creds
+
+	return fk.save(entries)
+}
+
+func (fk *FileKeyring) Delete(serverURL string) error {
+	entries, err := fk.load()
+	if err != nil {
+		return err
+	}
+
+	delete(entries, serverURL)
+
+	return fk.save(entries)
+}
+
+func (fk *FileKeyring) Get(serverURL string) (string, string, error) {
+	entries, err := fk.load()
+	if err != nil {
+		return "", "", err
+	}
+
+	creds, ok := entries[serverURL]
+	if !ok {
+		return "", "", credentials.ErrCredentialsNotFound
+	}
+
+	return creds.Username, creds.Secret, nil
+}
+
+func (FileKeyring) SupportsCredentialStorage() bool {
+	return true
+}
+
+// load decrypt the entries of the file, there are none until it is written
+func (fk *FileKeyring) load() (map[string]*credentials.Credentials, error) {
+	entries := map[string]*credentials.Credentials{}
+
+	data, err := ioutil.ReadFile(fk.filename)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading keyring file")
+	}
+
+	var sealed sealedFile
+	if err := json.Unmarshal(data, &sealed); err != nil || sealed.Version != fileFormatV1 {
+		return nil, errors.Errorf("%s is not a saml2alibabacloud keyring file", fk.filename)
+	}
+
+	aead, err := fk.cipher(sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := aead.Open(nil, sealed.Nonce, sealed.Data, nil)
+	if err != nil {
+		fk.key = nil
+		return nil, errors.Errorf("wrong passphrase for the keyring file %s", fk.filename)
+	}
+
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, errors.Wrap(err, "error decoding keyring file")
+	}
+
+	return entries, nil
+}
+
+// save encrypt the entries to the file, with a new nonce each time
+func (fk *FileKeyring) save(entries map[string]*credentials.Credentials) error {
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return errors.Wrap(err, "error encoding keyring file")
+	}
+
+	salt := fk.salt
+	if salt == nil {
+		salt = make([]byte, saltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return errors.Wrap(err, "error generating keyring salt")
+		}
+	}
+
+	aead, err := fk.cipher(salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Wrap(err, "error generating keyring nonce")
+	}
+
+	data, err := json.Marshal(sealedFile{
+		Version: fileFormatV1,
+		Salt:    salt,
+		Nonce:   nonce,
+		Data:    aead.Seal(nil, nonce, plain, nil),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error encoding keyring file")
+	}
+
+	return ioutil.WriteFile(fk.filename, data, 0600)
+}
+
+// cipher the AES-GCM cipher keyed from the passphrase and the salt, the passphrase is asked for once
+func (fk *FileKeyring) cipher(salt []byte) (cipher.AEAD, error) {
+	if fk.key == nil || string(fk.salt) != string(salt) {
+		passphrase, err := fk.password()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading keyring passphrase")
+		}
+		if passphrase == "" {
+			return nil, errors.New("the keyring file needs a passphrase")
+		}
+
+		fk.key, err = scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keyLength)
+		if err != nil {
+			return nil, errors.Wrap(err, "error deriving keyring key")
+		}
+		fk.salt = salt
+	}
+
+	block, err := aes.NewCipher(fk.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,60 @@
+package filekeyring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/helper/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileKeyring(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filekeyring")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "keyring")
+
+	prompts := 0
+	fk, err := New(filename, func() (string, error) {
+		prompts++
+		return "passphrase", nil
+	})
+	require.Nil(t, err)
+
+	serverURL := "https://id.example.com/adfs/ls/IdpInitiatedSignOn.aspx"
+
+	_, _, err = fk.Get(serverURL)
+	require.Equal(t, credentials.ErrCredentialsNotFound, err)
+
+	require.Nil(t, fk.Add(&credentials.Credentials{ServerURL: serverURL, Username: "user@example.com", Secret: "secret"}))
+
+	username, secret, err := fk.Get(serverURL)
+	require.Nil(t, err)
+	require.Equal(t, "user@example.com", username)
+	require.Equal(t, "secret", secret)
+	require.Equal(t, 1, prompts)
+
+	data, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	require.NotContains(t, string(data), "secret")
+	require.NotContains(t, string(data), "user@example.com")
+
+	// another run reads the entries with the passphrase
+	fk, err = New(filename, func() (string, error) { return "passphrase", nil })
+	require.Nil(t, err)
+	username, _, err = fk.Get(serverURL)
+	require.Nil(t, err)
+	require.Equal(t, "user@example.com", username)
+
+	require.Nil(t, fk.Delete(serverURL))
+	_, _, err = fk.Get(serverURL)
+	require.Equal(t, credentials.ErrCredentialsNotFound, err)
+
+	fk, err = New(filename, func() (string, error) { return "wrong", nil })
+	require.Nil(t, err)
+	_, _, err = fk.Get(serverURL)
+	require.EqualError(t, err, "wrong passphrase for the keyring file "+filename)
+}
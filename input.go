@@ -1,10 +1,9 @@
 package saml2alibabacloud
 
 import (
-	"fmt"
 	"log"
-	"sort"
 
+	"github.com/aliyun/saml2alibabacloud/pkg/catalog"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
 	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
@@ -51,25 +50,38 @@ func PromptForConfigurationDetails(idpAccount *cfg.IDPAccount) error {
 	case "F5APM":
 		idpAccount.ResourceID = prompter.String("Resource ID", idpAccount.ResourceID)
 	case "AzureAD":
-		idpAccount.AppID = prompter.String("App ID", idpAccount.AppID)
+		idpAccount.AppID = prompter.String("App ID (empty to look it up by name)", idpAccount.AppID)
+		log.Println("")
+		if idpAccount.AppID == "" {
+			idpAccount.AppName = prompter.String("App Name", idpAccount.AppName)
+			log.Println("")
+		}
+		idpAccount.TenantID = prompter.String("Tenant ID (optional)", idpAccount.TenantID)
+		log.Println("")
+	case "IDCS":
+		idpAccount.AppID = prompter.String("App Name (optional)", idpAccount.AppID)
 		log.Println("")
 	}
 
 	return nil
 }
 
-// PromptForLoginDetails prompt the user to present their username, password
-func PromptForLoginDetails(loginDetails *creds.LoginDetails, provider string) error {
+// PromptForLoginDetails prompt the user to present the login details the provider needs, see AccountRequirements
+func PromptForLoginDetails(loginDetails *creds.LoginDetails, requirements creds.Requirements) error {
 
 	log.Println("To use saved password just hit enter.")
 
-	loginDetails.Username = prompter.String("Username", loginDetails.Username)
+	if requirements.Username {
+		loginDetails.Username = prompter.String("Username", loginDetails.Username)
+	}
 
-	if enteredPassword := prompter.Password("Password"); enteredPassword != "" {
-		loginDetails.Password = enteredPassword
+	if requirements.Password {
+		if enteredPassword := prompter.Password("Password"); enteredPassword != "" {
+			loginDetails.Password = enteredPassword
+		}
+		log.Println("")
 	}
-	log.Println("")
-	if provider == "OneLogin" {
+	if requirements.ClientCredentials {
 		if loginDetails.ClientID == "" {
 			if enteredClientID := prompter.Password("Client ID"); enteredClientID != "" {
 				loginDetails.ClientID = enteredClientID
@@ -87,26 +99,7 @@ func PromptForLoginDetails(loginDetails *creds.LoginDetails, provider string) er
 	return nil
 }
 
-// PromptForRamRoleSelection present a list of roles to the user for selection
-func PromptForRamRoleSelection(accounts []*AlibabaCloudAccount) (*RamRole, error) {
-
-	roles := map[string]*RamRole{}
-	var roleOptions []string
-
-	for _, account := range accounts {
-		for _, role := range account.Roles {
-			name := fmt.Sprintf("%s / %s", account.Name, role.Name)
-			roles[name] = role
-			roleOptions = append(roleOptions, name)
-		}
-	}
-
-	sort.Strings(roleOptions)
-
-	selectedRole, err := prompter.ChooseWithDefault("Please choose the role", roleOptions[0], roleOptions)
-	if err != nil {
-		return nil, errors.Wrap(err, "Role selection failed")
-	}
-
-	return roles[selectedRole], nil
+// PromptForRamRoleSelection present a list of roles to the user for selection, annotated from the role catalog when one is supplied
+func PromptForRamRoleSelection(accounts []*AlibabaCloudAccount, roleCatalog *catalog.Catalog) (*RamRole, error) {
+	return (&RoleChooser{Catalog: roleCatalog}).Choose(accounts)
 }
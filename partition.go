@@ -0,0 +1,70 @@
+package saml2alibabacloud
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Partition an Alibaba Cloud site, the China site and the international one sign in and federate to the console on
+// their own hosts
+type Partition struct {
+	Name       string
+	SigninHost string
+	STSRegion  string // region of the STS endpoint the assertion is exchanged with
+	ConsoleURL string
+	ShellURL   string // Cloud Shell, preconfigured with the aliyun CLI
+}
+
+var (
+	// PartitionChina the China site, aliyun.com
+	PartitionChina = &Partition{
+		Name:       "china",
+		SigninHost: "signin.aliyun.com",
+		STSRegion:  "cn-hangzhou",
+		ConsoleURL: "https://home.console.aliyun.com/",
+		ShellURL:   "https://shell.aliyun.com/",
+	}
+
+	// PartitionInternational the international site, alibabacloud.com
+	PartitionInternational = &Partition{
+		Name:       "international",
+		SigninHost: "signin.alibabacloud.com",
+		STSRegion:  "ap-southeast-1",
+		ConsoleURL: "https://home.console.alibabacloud.com/",
+		ShellURL:   "https://shell.alibabacloud.com/",
+	}
+
+	partitions = []*Partition{PartitionChina, PartitionInternational}
+)
+
+// FederationURL the console federation endpoint of the partition
+func (p *Partition) FederationURL() string {
+	return "https://" + p.SigninHost + "/federation"
+}
+
+// LookupPartition the partition with the given name
+func LookupPartition(name string) (*Partition, error) {
+	for _, p := range partitions {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown partition: %s, use china or international", name)
+}
+
+// DestinationPartition the partition whose sign in host the assertion is destined for, nil for any other host
+func DestinationPartition(destination string) *Partition {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, p := range partitions {
+		if host == p.SigninHost {
+			return p
+		}
+	}
+	return nil
+}
@@ -6,8 +6,10 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	config "github.com/aliyun/aliyun-cli/config"
+	"github.com/aliyun/saml2alibabacloud/pkg/statefile"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -23,14 +25,31 @@ var (
 	logger = logrus.WithField("pkg", "alibabacloudconfig")
 )
 
+// expiryFilename the file stored next to the AlibabaCloud CLI configuration which records when each profile expires,
+// the CLI configuration itself has no field for it
+const expiryFilename = "saml2alibabacloud.json"
+
 // AliCloudCredentials represents the set of attributes used to authenticate to AlibabaCloud with a short lived session
 type AliCloudCredentials struct {
-	AliCloudAccessKey     string `json:"access_key_id"`
-	AliCloudSecretKey     string `json:"access_key_secret"`
-	AliCloudSessionToken  string `json:"ram_session_name"`
-	AliCloudSecurityToken string `json:"sts_token"`
-	PrincipalARN          string `json:"ram_role_arn"`
-	Region                string `json:"region,omitempty"`
+	AliCloudAccessKey     string    `json:"access_key_id"`
+	AliCloudSecretKey     string    `json:"access_key_secret"`
+	AliCloudSessionToken  string    `json:"ram_session_name"`
+	AliCloudSecurityToken string    `json:"sts_token"`
+	PrincipalARN          string    `json:"ram_role_arn"`
+	Region                string    `json:"region,omitempty"`
+	Partition             string    `json:"partition,omitempty"` // the site the credentials were issued by, china or international
+	Expires               time.Time `json:"expires,omitempty"`
+}
+
+// Expired checks if the credentials are expired, credentials without a known expiry are treated as expired
+func (c *AliCloudCredentials) Expired() bool {
+	return c.Expires.IsZero() || !time.Now().Before(c.Expires)
+}
+
+// profileState the metadata saml2alibabacloud keeps for a profile
+type profileState struct {
+	Expires   time.Time `json:"expires,omitempty"`
+	Partition string    `json:"partition,omitempty"`
 }
 
 // CredentialsProvider loads AlibabaCloud CLI credentials file
@@ -80,7 +99,18 @@ func (p *CredentialsProvider) Save(alibabacloudCreds *AliCloudCredentials) error
 		Language:        "en",
 	}
 	configuration.PutProfile(profile)
-	return config.SaveConfiguration(configuration)
+
+	err = backupConfig(ConfigFilename())
+	if err != nil {
+		return err
+	}
+
+	err = saveConfiguration(ConfigFilename(), configuration, map[string]time.Time{p.Profile: alibabacloudCreds.Expires})
+	if err != nil {
+		return err
+	}
+
+	return p.saveState(profileState{Expires: alibabacloudCreds.Expires, Partition: alibabacloudCreds.Partition})
 }
 
 // Load load the AlibabaCloud CLI credentials file
@@ -99,23 +129,80 @@ func (p *CredentialsProvider) Load() (*AliCloudCredentials, error) {
 		return nil, errors.New("profile not found in AlibabaCloud CLI credentials")
 	}
 
+	states, err := p.loadStates()
+	if err != nil {
+		return nil, err
+	}
+
 	return &AliCloudCredentials{
 		AliCloudAccessKey:     profile.AccessKeyId,
 		AliCloudSecretKey:     profile.AccessKeySecret,
 		AliCloudSessionToken:  profile.RoleSessionName,
 		AliCloudSecurityToken: profile.StsToken,
 		PrincipalARN:          profile.RamRoleArn,
+		Partition:             states[p.Profile].Partition,
+		Expires:               states[p.Profile].Expires,
 	}, nil
 }
 
 // Expired checks if the current credentials are expired
 func (p *CredentialsProvider) Expired() bool {
-	// _, err := p.Load()
-	// if err != nil {
-	// 	return true
-	// }
+	creds, err := p.Load()
+	if err != nil {
+		return true
+	}
+
+	return creds.Expired()
+}
+
+func (p *CredentialsProvider) saveState(state profileState) error {
+	states, err := p.loadStates()
+	if err != nil {
+		return err
+	}
+
+	states[p.Profile] = state
+
+	filename, err := p.resolveStateFilename()
+	if err != nil {
+		return err
+	}
+
+	return statefile.Write(filename, states)
+}
+
+// loadStates read the profile metadata, a file failing the integrity check is discarded so
+// its expiry times are never trusted
+func (p *CredentialsProvider) loadStates() (map[string]profileState, error) {
+	filename, err := p.resolveStateFilename()
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]profileState{}
+
+	err = statefile.Read(filename, &states)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return states, nil
+		}
+		if err == statefile.ErrTampered {
+			logger.WithField("filename", filename).Warn("profile metadata failed the integrity check and is ignored, login to refresh it")
+			return map[string]profileState{}, nil
+		}
+		return nil, errors.Wrapf(err, "unable to load file %s", filename)
+	}
+
+	return states, nil
+}
+
+func (p *CredentialsProvider) resolveStateFilename() (string, error) {
+	filename, err := p.resolveFilename()
+	if err != nil {
+		return "", err
+	}
 
-	return true
+	return filepath.Join(stateDir(filename), expiryFilename), nil
 }
 
 // ensureConfigExists verify that the config file exists
@@ -3,6 +3,7 @@ package alibabacloudconfig
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -38,3 +39,35 @@ func TestUpdateSamlConfig(t *testing.T) {
 
 	os.Remove(".credentials")
 }
+
+func TestSaveExpiry(t *testing.T) {
+	os.Remove(".credentials")
+	os.Remove(expiryFilename)
+
+	sharedCreds := &CredentialsProvider{".credentials", "saml"}
+
+	_, err := sharedCreds.CredsExists()
+	assert.Nil(t, err)
+
+	expires := time.Now().Add(time.Hour).Round(time.Second)
+
+	err = sharedCreds.Save(&AliCloudCredentials{
+		AliCloudAccessKey:     "testid",
+		AliCloudSecretKey:     "testsecret",
+		AliCloudSecurityToken: "testtoken",
+		Expires:               expires,
+	})
+	assert.Nil(t, err)
+
+	profile, err := sharedCreds.Load()
+	assert.Nil(t, err)
+	assert.True(t, expires.Equal(profile.Expires))
+	assert.False(t, profile.Expired())
+	assert.False(t, sharedCreds.Expired())
+
+	profile.Expires = time.Now().Add(-time.Minute)
+	assert.True(t, profile.Expired())
+
+	os.Remove(".credentials")
+	os.Remove(expiryFilename)
+}
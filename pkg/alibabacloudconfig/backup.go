@@ -0,0 +1,181 @@
+package alibabacloudconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	config "github.com/aliyun/aliyun-cli/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultBackupCount the number of backups of the AlibabaCloud CLI configuration kept unless configured otherwise
+	DefaultBackupCount = 5
+
+	// backupDir the directory next to the AlibabaCloud CLI configuration holding its backups
+	backupDir = "saml2alibabacloud-backups"
+
+	backupTimeFormat = "20060102T150405.000000000"
+)
+
+// BackupCount the number of backups kept when the AlibabaCloud CLI configuration is rewritten, 0 disables them
+var BackupCount = DefaultBackupCount
+
+// StateDir the directory holding the profile records and the configuration backups, next to the AlibabaCloud CLI
+// configuration when empty, moved with --context
+var StateDir = ""
+
+// Backup a copy of the AlibabaCloud CLI configuration taken before it was rewritten
+type Backup struct {
+	Name string
+	Path string
+	Time time.Time
+}
+
+// ConfigFilename the AlibabaCloud CLI configuration file saml2alibabacloud writes the credentials to
+func ConfigFilename() string {
+	return filepath.Join(config.GetConfigPath(), "config.json")
+}
+
+// backupConfig copy the configuration file before it is rewritten, keeping the latest BackupCount copies
+func backupConfig(filename string) error {
+	if BackupCount <= 0 {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "error reading configuration to back up")
+	}
+
+	dir := filepath.Join(stateDir(filename), backupDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "error creating backup directory")
+	}
+
+	name := fmt.Sprintf("%s.%s", filepath.Base(filename), time.Now().UTC().Format(backupTimeFormat))
+	if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		return errors.Wrap(err, "error writing configuration backup")
+	}
+
+	logger.WithField("backup", name).Debug("configuration backed up")
+
+	backups, err := Backups(filename)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range backups[min(len(backups), BackupCount):] {
+		if err := os.Remove(b.Path); err != nil {
+			return errors.Wrap(err, "error removing old configuration backup")
+		}
+	}
+
+	return nil
+}
+
+// Backups list the backups of the configuration file, newest first
+func Backups(filename string) ([]*Backup, error) {
+	dir := filepath.Join(stateDir(filename), backupDir)
+	prefix := filepath.Base(filename) + "."
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Backup{}, nil
+		}
+		return nil, errors.Wrap(err, "error listing configuration backups")
+	}
+
+	backups := []*Backup{}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), prefix) {
+			continue
+		}
+
+		taken, err := time.Parse(backupTimeFormat, strings.TrimPrefix(f.Name(), prefix))
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, &Backup{Name: f.Name(), Path: filepath.Join(dir, f.Name()), Time: taken})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+
+	return backups, nil
+}
+
+// Rollback restore the configuration file from the named backup, the latest one if name is empty. The current
+// configuration is backed up first so the rollback itself can be undone.
+func Rollback(filename, name string) (*Backup, error) {
+	backups, err := Backups(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(backups) == 0 {
+		return nil, errors.New("no configuration backups found")
+	}
+
+	backup := backups[0]
+	if name != "" {
+		backup = nil
+		for _, b := range backups {
+			if b.Name == name {
+				backup = b
+				break
+			}
+		}
+		if backup == nil {
+			return nil, fmt.Errorf("configuration backup not found: %s", name)
+		}
+	}
+
+	data, err := ioutil.ReadFile(backup.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading configuration backup")
+	}
+
+	// the backup has been read already, it may be pruned when the current configuration is backed up
+	if err := backupConfig(filename); err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+		return nil, errors.Wrap(err, "error restoring configuration backup")
+	}
+
+	// the recorded expiry times belong to the credentials being replaced
+	err = os.Remove(filepath.Join(stateDir(filename), expiryFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "error resetting profile expiry records")
+	}
+
+	return backup, nil
+}
+
+// stateDir the directory of the records and backups of the configuration file
+func stateDir(filename string) string {
+	if StateDir != "" {
+		return StateDir
+	}
+	return filepath.Dir(filename)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
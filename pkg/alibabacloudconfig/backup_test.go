@@ -0,0 +1,85 @@
+package alibabacloudconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alibabacloudconfig")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	BackupCount = 2
+	defer func() { BackupCount = DefaultBackupCount }()
+
+	filename := filepath.Join(dir, "config.json")
+
+	// nothing to back up yet
+	require.Nil(t, backupConfig(filename))
+
+	for _, content := range []string{"v1", "v2", "v3"} {
+		require.Nil(t, ioutil.WriteFile(filename, []byte(content), 0600))
+		require.Nil(t, backupConfig(filename))
+	}
+	require.Nil(t, ioutil.WriteFile(filename, []byte("v4"), 0600))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, expiryFilename), []byte("{}"), 0600))
+
+	backups, err := Backups(filename)
+	require.Nil(t, err)
+	require.Len(t, backups, 2)
+
+	backup, err := Rollback(filename, "")
+	require.Nil(t, err)
+	require.Equal(t, backups[0].Name, backup.Name)
+
+	data, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	require.Equal(t, "v3", string(data))
+
+	_, err = os.Stat(filepath.Join(dir, expiryFilename))
+	require.True(t, os.IsNotExist(err))
+
+	// the rolled back configuration is the latest backup, rolling back again undoes the rollback
+	_, err = Rollback(filename, "")
+	require.Nil(t, err)
+
+	data, err = ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	require.Equal(t, "v4", string(data))
+
+	_, err = Rollback(filename, "config.json.unknown")
+	require.EqualError(t, err, "configuration backup not found: config.json.unknown")
+}
+
+func TestBackupStateDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alibabacloudconfig")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	StateDir = filepath.Join(dir, "context")
+	defer func() { StateDir = "" }()
+
+	filename := filepath.Join(dir, "config.json")
+	require.Nil(t, ioutil.WriteFile(filename, []byte("v1"), 0600))
+	require.Nil(t, backupConfig(filename))
+	require.Nil(t, ioutil.WriteFile(filename, []byte("v2"), 0600))
+
+	// the backups and records of the context are kept out of the directory of the configuration
+	_, err = os.Stat(filepath.Join(dir, backupDir))
+	require.True(t, os.IsNotExist(err))
+
+	backups, err := Backups(filename)
+	require.Nil(t, err)
+	require.Len(t, backups, 1)
+	require.FileExists(t, filepath.Join(StateDir, backupDir, backups[0].Name))
+
+	p := &CredentialsProvider{Filename: filename}
+	stateFilename, err := p.resolveStateFilename()
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(StateDir, expiryFilename), stateFilename)
+}
@@ -0,0 +1,134 @@
+package alibabacloudconfig
+
+import (
+	"bytes"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// cliExecutable the name of the AlibabaCloud CLI executable, replaced in tests
+var cliExecutable = "aliyun"
+
+var (
+	versionRegexp = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+	wordRegexp    = regexp.MustCompile(`\b[A-Za-z]+\b`)
+)
+
+// knownModes the profile modes listed by `aliyun configure --help`, used to tell whether the installed CLI
+// understands the mode of a profile
+var knownModes = []string{"AK", "StsToken", "RamRoleArn", "EcsRamRole", "RsaKeyPair", "RamRoleArnWithRoleName", "ChainableRamRoleArn", ProcessMode, "CredentialsURI", "OIDC"}
+
+// CLI the AlibabaCloud CLI installed on the PATH
+type CLI struct {
+	Path    string
+	Version string
+}
+
+// DetectCLI locate the AlibabaCloud CLI and read its version, nil without an error when it isn't installed
+func DetectCLI() (*CLI, error) {
+	path, err := exec.LookPath(cliExecutable)
+	if err != nil {
+		return nil, nil
+	}
+
+	out, err := exec.Command(path, "version").Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading the version of %s", path)
+	}
+
+	return &CLI{Path: path, Version: strings.TrimSpace(string(out))}, nil
+}
+
+// CheckProfile ask STS who the credentials of the profile belong to, through the CLI so the profile is read exactly
+// the way it will be used, returning the ARN of the identity
+func (c *CLI) CheckProfile(profile string) (string, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(c.Path, "sts", "GetCallerIdentity", "--profile", profile)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(string(out))
+		}
+		return "", errors.Wrapf(err, "aliyun sts GetCallerIdentity failed for profile %s: %s", profile, msg)
+	}
+
+	arn := gjson.GetBytes(out, "Arn").String()
+	if arn == "" {
+		return "", errors.Errorf("aliyun sts GetCallerIdentity returned no identity for profile %s", profile)
+	}
+
+	return arn, nil
+}
+
+// Incompatibilities the known problems using a profile of the given mode with this CLI, empty when there are none
+func (c *CLI) Incompatibilities(mode string) []string {
+	var problems []string
+
+	if major, ok := c.majorVersion(); ok && major < 3 {
+		problems = append(problems, "AlibabaCloud CLI "+c.Version+" predates version 3 and doesn't read "+ConfigFilename()+", please upgrade")
+		return problems
+	}
+
+	if mode != "" && !c.supportsMode(mode) {
+		problems = append(problems, "AlibabaCloud CLI "+c.Version+" doesn't support profiles in "+mode+" mode, please upgrade")
+	}
+
+	return problems
+}
+
+func (c *CLI) majorVersion() (int, bool) {
+	match := versionRegexp.FindStringSubmatch(c.Version)
+	if match == nil {
+		return 0, false
+	}
+	major, err := strconv.Atoi(match[1])
+	return major, err == nil
+}
+
+// supportsMode look for the mode in the help of `aliyun configure`, when the help can't be read or lists none of the
+// known modes the mode is assumed to be supported rather than warning about every profile
+func (c *CLI) supportsMode(mode string) bool {
+	out, _ := exec.Command(c.Path, "configure", "--help").CombinedOutput()
+
+	words := map[string]bool{}
+	for _, w := range wordRegexp.FindAllString(string(out), -1) {
+		words[w] = true
+	}
+
+	if words[mode] {
+		return true
+	}
+
+	for _, known := range knownModes {
+		if words[known] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ProfileMode the mode of the profile in the AlibabaCloud CLI configuration, empty when the profile doesn't exist
+func ProfileMode(profile string) (string, error) {
+	raw, err := readRawConfig(ConfigFilename())
+	if err != nil {
+		return "", err
+	}
+
+	entry := findRawProfile(raw, profile)
+	if entry == nil {
+		return "", nil
+	}
+
+	mode, _ := entry["mode"].(string)
+	return mode, nil
+}
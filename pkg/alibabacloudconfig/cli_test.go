@@ -0,0 +1,63 @@
+package alibabacloudconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const fakeCLI = `#!/bin/sh
+case "$1" in
+version) echo "3.0.10" ;;
+configure) echo "  --mode {AK|StsToken|RamRoleArn|EcsRamRole|RsaKeyPair|RamRoleArnWithRoleName}" ;;
+sts)
+	if [ "$4" = "saml" ]; then
+		echo '{"AccountId": "121234567890", "Arn": "acs:ram::121234567890:assumed-role/admin/user"}'
+	else
+		echo "ERROR: InvalidSecurityToken.Expired" >&2
+		exit 1
+	fi ;;
+esac
+`
+
+func TestDetectCLI(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake CLI is a shell script")
+	}
+
+	dir, err := ioutil.TempDir("", "aliyun")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(executable string) { cliExecutable = executable }(cliExecutable)
+
+	cliExecutable = filepath.Join(dir, "missing")
+	cli, err := DetectCLI()
+	require.Nil(t, err)
+	require.Nil(t, cli)
+
+	cliExecutable = filepath.Join(dir, "aliyun")
+	require.Nil(t, ioutil.WriteFile(cliExecutable, []byte(fakeCLI), 0700))
+
+	cli, err = DetectCLI()
+	require.Nil(t, err)
+	require.Equal(t, "3.0.10", cli.Version)
+
+	arn, err := cli.CheckProfile("saml")
+	require.Nil(t, err)
+	require.Equal(t, "acs:ram::121234567890:assumed-role/admin/user", arn)
+
+	_, err = cli.CheckProfile("expired")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "InvalidSecurityToken.Expired")
+
+	require.Empty(t, cli.Incompatibilities("StsToken"))
+	require.Len(t, cli.Incompatibilities(ProcessMode), 1)
+
+	cli.Version = "2.1.0"
+	require.Len(t, cli.Incompatibilities("StsToken"), 1)
+}
@@ -0,0 +1,95 @@
+package alibabacloudconfig
+
+import (
+	"sort"
+	"time"
+)
+
+// expirationKey the profile field recording when its STS token expires, in unix seconds, the one recent AlibabaCloud
+// CLI versions read themselves, written for the tools reading the configuration directly
+const expirationKey = "sts_expiration"
+
+// ProfileStatus the expiry of a profile of the AlibabaCloud CLI configuration, as recorded when saml2alibabacloud
+// wrote it
+type ProfileStatus struct {
+	Name      string    `json:"name"`
+	Mode      string    `json:"mode"`
+	Expires   time.Time `json:"expires,omitempty"`
+	Partition string    `json:"partition,omitempty"`
+}
+
+// Expired checks if the credentials of the profile are expired, profiles without a known expiry are treated as expired
+func (s *ProfileStatus) Expired() bool {
+	return s.Expires.IsZero() || !time.Now().Before(s.Expires)
+}
+
+// Remaining how long the credentials of the profile are still valid, 0 once they expired or when the expiry isn't known
+func (s *ProfileStatus) Remaining(now time.Time) time.Duration {
+	if s.Expires.IsZero() || !now.Before(s.Expires) {
+		return 0
+	}
+	return s.Expires.Sub(now)
+}
+
+// Profiles the profiles of the AlibabaCloud CLI configuration with their expiry, taken like Load from the integrity
+// checked metadata kept next to the configuration, so every command agrees on when credentials expire
+func Profiles(filename string) ([]*ProfileStatus, error) {
+	raw, err := readRawConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &CredentialsProvider{Filename: filename}
+	states, err := p.loadStates()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []*ProfileStatus
+
+	profiles, _ := raw["profiles"].([]interface{})
+	for _, entry := range profiles {
+		profile, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		status := &ProfileStatus{}
+		status.Name, _ = profile["name"].(string)
+		status.Mode, _ = profile["mode"].(string)
+
+		status.Partition = states[status.Name].Partition
+		status.Expires = states[status.Name].Expires
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	return statuses, nil
+}
+
+// ProfileExpiry the expiry of one profile, zero when the profile or its expiry isn't known
+func ProfileExpiry(filename, profile string) (time.Time, error) {
+	statuses, err := Profiles(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, status := range statuses {
+		if status.Name == profile {
+			return status.Expires, nil
+		}
+	}
+
+	return time.Time{}, nil
+}
+
+// setRawExpiration record the expiry in the sts_expiration field of a profile, removing a stale one when it isn't known
+func setRawExpiration(profile map[string]interface{}, expires time.Time) {
+	if expires.IsZero() {
+		delete(profile, expirationKey)
+		return
+	}
+	profile[expirationKey] = expires.Unix()
+}
@@ -0,0 +1,62 @@
+package alibabacloudconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/aliyun/aliyun-cli/config"
+	"github.com/aliyun/saml2alibabacloud/pkg/statefile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alibabacloudconfig")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.json")
+	require.Nil(t, ioutil.WriteFile(filename, []byte(existingConfig), 0600))
+
+	expires := time.Now().Add(time.Hour).Round(time.Second)
+
+	conf, err := config.LoadConfiguration(filename, ioutil.Discard)
+	require.Nil(t, err)
+	conf.PutProfile(config.Profile{Name: "saml", Mode: config.StsToken, AccessKeyId: "new", StsToken: "new"})
+	require.Nil(t, saveConfiguration(filename, conf, map[string]time.Time{"saml": expires}))
+	require.Nil(t, statefile.Write(filepath.Join(dir, expiryFilename), map[string]profileState{"saml": {Expires: expires, Partition: "china"}}))
+
+	// the expiry is recorded in the profile for the AlibabaCloud CLI
+	raw, err := readRawConfig(filename)
+	require.Nil(t, err)
+	require.Equal(t, float64(expires.Unix()), findRawProfile(raw, "saml")[expirationKey])
+	require.NotContains(t, findRawProfile(raw, "default"), expirationKey)
+
+	statuses, err := Profiles(filename)
+	require.Nil(t, err)
+	require.Len(t, statuses, 2)
+
+	require.Equal(t, "default", statuses[0].Name)
+	require.True(t, statuses[0].Expired())
+	require.Equal(t, time.Duration(0), statuses[0].Remaining(time.Now()))
+
+	require.Equal(t, "saml", statuses[1].Name)
+	require.Equal(t, "StsToken", statuses[1].Mode)
+	require.Equal(t, "china", statuses[1].Partition)
+	require.True(t, expires.Equal(statuses[1].Expires))
+	require.False(t, statuses[1].Expired())
+	require.Equal(t, 30*time.Minute, statuses[1].Remaining(expires.Add(-30*time.Minute)))
+
+	found, err := ProfileExpiry(filename, "saml")
+	require.Nil(t, err)
+	require.True(t, expires.Equal(found))
+
+	// credentials of an unknown expiry remove the stale one
+	require.Nil(t, saveConfiguration(filename, conf, map[string]time.Time{"saml": {}}))
+
+	raw, err = readRawConfig(filename)
+	require.Nil(t, err)
+	require.NotContains(t, findRawProfile(raw, "saml"), expirationKey)
+}
@@ -0,0 +1,158 @@
+package alibabacloudconfig
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	config "github.com/aliyun/aliyun-cli/config"
+	"github.com/pkg/errors"
+)
+
+// ProcessMode the AlibabaCloud CLI profile mode which runs an external command to retrieve the credentials
+const ProcessMode = "External"
+
+// ProcessCredentials the document printed by the external command of a ProcessMode profile
+type ProcessCredentials struct {
+	Mode            string `json:"mode"`
+	AccessKeyID     string `json:"access_key_id"`
+	AccessKeySecret string `json:"access_key_secret"`
+	StsToken        string `json:"sts_token"`
+}
+
+// NewProcessCredentials build the document the AlibabaCloud CLI expects from the external command
+func NewProcessCredentials(alibabacloudCreds *AliCloudCredentials) *ProcessCredentials {
+	return &ProcessCredentials{
+		Mode:            string(config.StsToken),
+		AccessKeyID:     alibabacloudCreds.AliCloudAccessKey,
+		AccessKeySecret: alibabacloudCreds.AliCloudSecretKey,
+		StsToken:        alibabacloudCreds.AliCloudSecurityToken,
+	}
+}
+
+// credentialKeys the profile fields holding static credentials, dropped once the profile runs a command instead
+var credentialKeys = []string{"access_key_id", "access_key_secret", "sts_token", "ram_role_arn", "ram_session_name"}
+
+// RegisterProcess write a profile which makes the AlibabaCloud CLI run command whenever it needs credentials,
+// the other settings of an existing profile such as its region are kept
+func RegisterProcess(filename, profile, command string) error {
+	raw, err := readRawConfig(filename)
+	if err != nil {
+		return err
+	}
+
+	entry := findRawProfile(raw, profile)
+	if entry == nil {
+		entry = map[string]interface{}{
+			"name":          profile,
+			"output_format": "json",
+			"language":      "en",
+		}
+		profiles, _ := raw["profiles"].([]interface{})
+		raw["profiles"] = append(profiles, entry)
+	}
+
+	for _, key := range credentialKeys {
+		delete(entry, key)
+	}
+	entry["mode"] = ProcessMode
+	entry["process_command"] = command
+
+	if current, _ := raw["current"].(string); current == "" {
+		raw["current"] = profile
+	}
+
+	if err := backupConfig(filename); err != nil {
+		return err
+	}
+
+	return writeRawConfig(filename, raw)
+}
+
+// saveConfiguration write the configuration like config.SaveConfiguration, keeping the fields the AlibabaCloud CLI
+// library doesn't know about, such as the process_command of the profiles written by RegisterProcess, and recording
+// the expiry of the profiles in expirations
+func saveConfiguration(filename string, configuration config.Configuration, expirations map[string]time.Time) error {
+	existing, err := readRawConfig(filename)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(configuration)
+	if err != nil {
+		return err
+	}
+
+	updated := map[string]interface{}{}
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return err
+	}
+
+	mergeUnknown(updated, existing)
+
+	profiles, _ := updated["profiles"].([]interface{})
+	for _, p := range profiles {
+		entry, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := entry["name"].(string)
+		old := findRawProfile(existing, name)
+		// the fields of another mode would be stale once the profile has been rewritten
+		if old != nil && old["mode"] == entry["mode"] {
+			mergeUnknown(entry, old)
+		}
+		if expires, ok := expirations[name]; ok {
+			setRawExpiration(entry, expires)
+		}
+	}
+
+	return writeRawConfig(filename, updated)
+}
+
+func mergeUnknown(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+}
+
+func findRawProfile(raw map[string]interface{}, name string) map[string]interface{} {
+	profiles, _ := raw["profiles"].([]interface{})
+	for _, p := range profiles {
+		entry, ok := p.(map[string]interface{})
+		if ok && entry["name"] == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+func readRawConfig(filename string) (map[string]interface{}, error) {
+	raw := map[string]interface{}{}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return raw, nil
+		}
+		return nil, errors.Wrapf(err, "unable to load file %s", filename)
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse file %s", filename)
+	}
+
+	return raw, nil
+}
+
+func writeRawConfig(filename string, raw map[string]interface{}) error {
+	data, err := json.MarshalIndent(raw, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, data, 0600)
+}
@@ -0,0 +1,58 @@
+package alibabacloudconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	config "github.com/aliyun/aliyun-cli/config"
+	"github.com/stretchr/testify/require"
+)
+
+const existingConfig = `{
+	"current": "default",
+	"profiles": [
+		{"name": "default", "mode": "AK", "access_key_id": "ak", "access_key_secret": "secret", "region_id": "cn-hangzhou"},
+		{"name": "saml", "mode": "StsToken", "access_key_id": "old", "access_key_secret": "old", "sts_token": "old", "region_id": "cn-shanghai"}
+	]
+}`
+
+func TestRegisterProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alibabacloudconfig")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	BackupCount = 0
+	defer func() { BackupCount = DefaultBackupCount }()
+
+	filename := filepath.Join(dir, "config.json")
+	require.Nil(t, ioutil.WriteFile(filename, []byte(existingConfig), 0600))
+
+	require.Nil(t, RegisterProcess(filename, "saml", "saml2alibabacloud login --idp-account=default"))
+	require.Nil(t, RegisterProcess(filename, "dev", "saml2alibabacloud login --idp-account=dev"))
+
+	raw, err := readRawConfig(filename)
+	require.Nil(t, err)
+	require.Equal(t, "default", raw["current"])
+
+	saml := findRawProfile(raw, "saml")
+	require.Equal(t, ProcessMode, saml["mode"])
+	require.Equal(t, "saml2alibabacloud login --idp-account=default", saml["process_command"])
+	require.Equal(t, "cn-shanghai", saml["region_id"])
+	require.NotContains(t, saml, "sts_token")
+
+	dev := findRawProfile(raw, "dev")
+	require.Equal(t, "saml2alibabacloud login --idp-account=dev", dev["process_command"])
+
+	// rewriting the configuration through the AlibabaCloud CLI library keeps the process command
+	conf, err := config.LoadConfiguration(filename, ioutil.Discard)
+	require.Nil(t, err)
+	conf.PutProfile(config.Profile{Name: "default", Mode: config.StsToken, AccessKeyId: "new"})
+	require.Nil(t, saveConfiguration(filename, conf, nil))
+
+	raw, err = readRawConfig(filename)
+	require.Nil(t, err)
+	require.Equal(t, "saml2alibabacloud login --idp-account=dev", findRawProfile(raw, "dev")["process_command"])
+	require.Equal(t, "new", findRawProfile(raw, "default")["access_key_id"])
+}
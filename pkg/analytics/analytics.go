@@ -0,0 +1,103 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// Header the columns of the export, written once when the file is created
+var Header = []string{"time", "user", "account", "role", "provider", "outcome", "stage", "error_class", "duration_ms", "token_lifetime_s"}
+
+// Event a pseudonymous login event, the user and AlibabaCloud account are replaced with a keyed hash so the events of
+// one user can be told apart without naming them, the role keeps only its name
+type Event struct {
+	Time          time.Time
+	User          string
+	Account       string
+	Role          string
+	Provider      string
+	Outcome       string
+	Stage         string
+	ErrorClass    string
+	Duration      time.Duration
+	TokenLifetime time.Duration
+}
+
+// Pseudonym the HMAC-SHA256 of value keyed with salt, the analytics_salt shared by the machines of an organization so
+// their rows can be joined while nobody without it can hash a list of usernames or account IDs to reverse them, empty
+// for an empty value
+func Pseudonym(salt, value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(strings.ToLower(value)))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// SplitRoleARN the account ID and role name of a role ARN such as acs:ram::123456789012:role/admin
+func SplitRoleARN(roleARN string) (string, string) {
+	parts := strings.SplitN(roleARN, ":", 5)
+	if len(parts) != 5 {
+		return "", ""
+	}
+	return parts[3], strings.TrimPrefix(parts[4], "role/")
+}
+
+// Record the CSV row of the event
+func (e *Event) Record() []string {
+	return []string{
+		e.Time.UTC().Format(time.RFC3339),
+		e.User,
+		e.Account,
+		e.Role,
+		e.Provider,
+		e.Outcome,
+		e.Stage,
+		e.ErrorClass,
+		strconv.FormatInt(int64(e.Duration/time.Millisecond), 10),
+		strconv.FormatInt(int64(e.TokenLifetime/time.Second), 10),
+	}
+}
+
+// Append add the event to the CSV file, creating it with the header, rows are only ever appended so the file can be
+// collected while logins keep happening
+func Append(filename string, event *Event) error {
+	path, err := homedir.Expand(filename)
+	if err != nil {
+		return errors.Wrap(err, "error resolving analytics export path")
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "error opening analytics export")
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "error opening analytics export")
+	}
+
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		if err := w.Write(Header); err != nil {
+			return errors.Wrap(err, "error writing analytics export")
+		}
+	}
+	if err := w.Write(event.Record()); err != nil {
+		return errors.Wrap(err, "error writing analytics export")
+	}
+	w.Flush()
+
+	return errors.Wrap(w.Error(), "error writing analytics export")
+}
@@ -0,0 +1,54 @@
+package analytics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "analytics")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "logins.csv")
+	event := &Event{
+		Time:          time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		User:          Pseudonym("salt", "user@example.com"),
+		Account:       Pseudonym("salt", "123456789012"),
+		Role:          "admin",
+		Provider:      "Okta",
+		Outcome:       "success",
+		Duration:      1500 * time.Millisecond,
+		TokenLifetime: time.Hour,
+	}
+
+	require.NoError(t, Append(filename, event))
+	require.NoError(t, Append(filename, event))
+
+	data, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	row := "2020-01-02T03:04:05Z," + Pseudonym("salt", "USER@example.com") + "," + Pseudonym("salt", "123456789012") + ",admin,Okta,success,,,1500,3600\n"
+	require.Equal(t, "time,user,account,role,provider,outcome,stage,error_class,duration_ms,token_lifetime_s\n"+row+row, string(data))
+}
+
+func TestSplitRoleARN(t *testing.T) {
+	account, role := SplitRoleARN("acs:ram::123456789012:role/admin")
+	require.Equal(t, "123456789012", account)
+	require.Equal(t, "admin", role)
+
+	account, role = SplitRoleARN("admin")
+	require.Empty(t, account)
+	require.Empty(t, role)
+}
+
+func TestPseudonym(t *testing.T) {
+	require.Equal(t, Pseudonym("salt", "user@example.com"), Pseudonym("salt", "User@Example.com"))
+	require.NotEqual(t, Pseudonym("salt", "user@example.com"), Pseudonym("other", "user@example.com"))
+	require.Len(t, Pseudonym("salt", "123456789012"), 32)
+	require.Empty(t, Pseudonym("salt", ""))
+}
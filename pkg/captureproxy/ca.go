@@ -0,0 +1,164 @@
+package captureproxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// DefaultCAPath the default location of the certificate authority of the proxy, with its key, kept across logins so
+// the browser only has to trust it once
+const DefaultCAPath = "~/.saml2alibabacloud-proxy-ca.pem"
+
+// the certificate authority is trusted by the browser, it is short lived and only able to sign for the sign in hosts
+// so its key, kept next to it, is worth little if it leaks
+const (
+	caValidity   = 90 * 24 * time.Hour
+	leafValidity = 24 * time.Hour
+)
+
+// LoadOrCreateCA load the certificate authority stored in filename, DefaultCAPath if empty, able to sign for the
+// hosts only, creating it when missing and replacing it when it expires soon or was created for other hosts, created
+// tells the caller the browser has to be told to trust it
+func LoadOrCreateCA(filename string, hosts []string) (ca *tls.Certificate, path string, created bool, err error) {
+	if filename == "" {
+		filename = DefaultCAPath
+	}
+
+	path, err = homedir.Expand(filename)
+	if err != nil {
+		return nil, "", false, errors.Wrap(err, "error resolving proxy certificate authority path")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err == nil && !usableCA(data, hosts) {
+		err = os.ErrNotExist
+	}
+	if os.IsNotExist(err) {
+		data, err = newCA(hosts)
+		if err != nil {
+			return nil, "", false, errors.Wrap(err, "error creating proxy certificate authority")
+		}
+		if err = ioutil.WriteFile(path, data, 0600); err != nil {
+			return nil, "", false, errors.Wrap(err, "error saving proxy certificate authority")
+		}
+		created = true
+	} else if err != nil {
+		return nil, "", false, errors.Wrap(err, "error reading proxy certificate authority")
+	}
+
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, "", false, errors.Wrapf(err, "invalid proxy certificate authority %s", path)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, "", false, errors.Wrapf(err, "invalid proxy certificate authority %s", path)
+	}
+
+	return &cert, path, created, nil
+}
+
+// usableCA whether the PEM encoded certificate authority is constrained to the hosts and still valid for a leaf
+func usableCA(data []byte, hosts []string) bool {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+
+	if !cert.PermittedDNSDomainsCritical || len(cert.PermittedDNSDomains) != len(hosts) {
+		return false
+	}
+	for i, host := range hosts {
+		if cert.PermittedDNSDomains[i] != host {
+			return false
+		}
+	}
+
+	return time.Now().Add(leafValidity).Before(cert.NotAfter)
+}
+
+// newCA a self signed certificate authority limited to the hosts and its key, PEM encoded
+func newCA(hosts []string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "saml2alibabacloud capture proxy " + host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         hosts,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...), nil
+}
+
+// leafCertificate a certificate for the host signed by the certificate authority
+func leafCertificate(ca *tls.Certificate, host string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Leaf, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der, ca.Certificate[0]}, PrivateKey: key}, nil
+}
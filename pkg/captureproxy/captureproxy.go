@@ -0,0 +1,248 @@
+package captureproxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// capturedPage answered to the browser in place of the console once the assertion is captured
+const capturedPage = `<!DOCTYPE html>
+<html><head><title>saml2alibabacloud</title></head>
+<body><p>saml2alibabacloud captured the SAML assertion, head back to the terminal to complete the login.</p></body>
+</html>
+`
+
+var logger = logrus.WithField("pkg", "captureproxy")
+
+// tunnelDialTimeout how long connecting to the hosts the browser tunnels to may take
+var tunnelDialTimeout = 30 * time.Second
+
+// Proxy a forward proxy for the browser of the user. The TLS connections to the sign in hosts are intercepted with
+// certificates of the certificate authority of the proxy so the SAMLResponse the IdP makes the browser post to them
+// is captured, whichever the browser and the MFA, every other connection is tunnelled untouched
+type Proxy struct {
+	ca        *tls.Certificate
+	hosts     map[string]bool
+	transport http.RoundTripper
+
+	mu    sync.Mutex
+	certs map[string]*tls.Certificate
+
+	assertions chan string
+}
+
+// New create a proxy intercepting the connections to the hosts with certificates signed by the certificate authority
+func New(ca *tls.Certificate, hosts []string) *Proxy {
+	p := &Proxy{
+		ca:         ca,
+		hosts:      map[string]bool{},
+		transport:  &http.Transport{TLSHandshakeTimeout: 10 * time.Second},
+		certs:      map[string]*tls.Certificate{},
+		assertions: make(chan string, 1),
+	}
+	for _, host := range hosts {
+		p.hosts[strings.ToLower(host)] = true
+	}
+	return p
+}
+
+// Wait serve the browser on the listener until it posts a SAML assertion to one of the sign in hosts, or the timeout
+// expires
+func (p *Proxy) Wait(l net.Listener, timeout time.Duration) (string, error) {
+	srv := &http.Server{Handler: p}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	select {
+	case assertion := <-p.assertions:
+		return assertion, nil
+	case <-time.After(timeout):
+		return "", errors.Errorf("no SAML assertion was posted through the proxy within %v", timeout)
+	}
+}
+
+// ServeHTTP handle a request of the browser, a CONNECT for https and an absolute URL for plain http
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.connect(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "this is the saml2alibabacloud capture proxy, set it as the proxy of the browser", http.StatusBadRequest)
+		return
+	}
+
+	p.handle(w, r)
+}
+
+// handle capture the assertion posted to a sign in host, forward any other request upstream
+func (p *Proxy) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost && p.hosts[strings.ToLower(hostname(r.URL.Host))] {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		if values, err := url.ParseQuery(string(body)); err == nil && values.Get("SAMLResponse") != "" {
+			logger.WithField("url", r.URL.String()).Debug("captured assertion")
+
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(capturedPage))
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+
+			select {
+			case p.assertions <- values.Get("SAMLResponse"):
+			default:
+			}
+			return
+		}
+	}
+
+	p.forward(w, r)
+}
+
+// forward send the request upstream and copy the response back to the browser
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Connection")
+	out.Header.Del("Proxy-Authorization")
+
+	res, err := p.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+
+	for name, values := range res.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, res.Body)
+}
+
+// connect open the tunnel the browser asked for, intercepting it for the sign in hosts
+func (p *Proxy) connect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tunnels are not supported", http.StatusInternalServerError)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		logger.WithError(err).Debug("unable to hijack the connection")
+		return
+	}
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		conn.Close()
+		return
+	}
+
+	host := hostname(r.Host)
+	if !p.hosts[strings.ToLower(host)] {
+		p.tunnel(conn, r.Host)
+		return
+	}
+
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return p.certificate(strings.ToLower(host))
+		},
+	})
+
+	// the connection is served on its own, closing the proxy once the assertion is captured doesn't cut the response
+	go http.Serve(&connListener{conn: tlsConn}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Scheme = "https"
+		r.URL.Host = r.Host
+		p.handle(w, r)
+	}))
+}
+
+// tunnel copy the bytes between the browser and the host
+func (p *Proxy) tunnel(conn net.Conn, hostport string) {
+	upstream, err := net.DialTimeout("tcp", hostport, tunnelDialTimeout)
+	if err != nil {
+		logger.WithError(err).WithField("host", hostport).Debug("unable to open tunnel")
+		conn.Close()
+		return
+	}
+
+	go func() {
+		io.Copy(upstream, conn)
+		upstream.Close()
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		conn.Close()
+	}()
+}
+
+// certificate the certificate presented to the browser for the host, signed by the certificate authority
+func (p *Proxy) certificate(host string) (*tls.Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cert, ok := p.certs[host]; ok {
+		return cert, nil
+	}
+
+	cert, err := leafCertificate(p.ca, host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating certificate for %s", host)
+	}
+	p.certs[host] = cert
+
+	return cert, nil
+}
+
+// hostname the host without its port
+func hostname(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
+
+// connListener hands a single connection to http.Serve
+type connListener struct {
+	conn net.Conn
+	once sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() { conn = l.conn })
+	if conn == nil {
+		return nil, io.EOF
+	}
+	return conn, nil
+}
+
+func (l *connListener) Close() error {
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
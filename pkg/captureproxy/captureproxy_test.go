@@ -0,0 +1,152 @@
+package captureproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCA(t *testing.T) (*tls.Certificate, string) {
+	dir, err := ioutil.TempDir("", "captureproxy")
+	require.Nil(t, err)
+
+	ca, path, created, err := LoadOrCreateCA(filepath.Join(dir, "ca.pem"), []string{"signin.aliyun.com"})
+	require.Nil(t, err)
+	require.True(t, created)
+	require.True(t, ca.Leaf.IsCA)
+
+	return ca, path
+}
+
+func TestLoadOrCreateCA(t *testing.T) {
+	ca, path := newTestCA(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, _, created, err := LoadOrCreateCA(path, []string{"signin.aliyun.com"})
+	require.Nil(t, err)
+	require.False(t, created)
+	require.Equal(t, ca.Certificate, loaded.Certificate)
+
+	// an authority for other hosts is replaced
+	replaced, _, created, err := LoadOrCreateCA(path, []string{"signin.aliyun.com", "signin.alibabacloud.com"})
+	require.Nil(t, err)
+	require.True(t, created)
+	require.NotEqual(t, ca.Certificate, replaced.Certificate)
+}
+
+func TestCAOnlySignsForHosts(t *testing.T) {
+	ca, path := newTestCA(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	require.True(t, ca.Leaf.PermittedDNSDomainsCritical)
+	require.True(t, ca.Leaf.NotAfter.Before(time.Now().Add(caValidity+time.Hour)))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	for host, valid := range map[string]bool{"signin.aliyun.com": true, "www.example.com": false} {
+		leaf, err := leafCertificate(ca, host)
+		require.Nil(t, err)
+
+		cert, err := x509.ParseCertificate(leaf.Certificate[0])
+		require.Nil(t, err)
+
+		_, err = cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots})
+		require.Equal(t, valid, err == nil, host)
+	}
+}
+
+// startProxy serve the proxy on a random port, the client trusts the certificate authorities given as the browser would
+func startProxy(t *testing.T, p *Proxy, roots *x509.CertPool) (net.Listener, *http.Client) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	proxyURL, err := url.Parse("http://" + l.Addr().String())
+	require.Nil(t, err)
+
+	return l, &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL), TLSClientConfig: &tls.Config{RootCAs: roots}},
+	}
+}
+
+func TestWaitCapturesAssertion(t *testing.T) {
+	ca, path := newTestCA(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	p := New(ca, []string{"signin.aliyun.com"})
+	l, client := startProxy(t, p, roots)
+
+	go func() {
+		res, err := client.PostForm("https://signin.aliyun.com/saml-role/sso", url.Values{"SAMLResponse": []string{"PHNhbWw+"}})
+		require.Nil(t, err)
+		defer res.Body.Close()
+
+		body, err := ioutil.ReadAll(res.Body)
+		require.Nil(t, err)
+		require.Equal(t, capturedPage, string(body))
+	}()
+
+	assertion, err := p.Wait(l, 5*time.Second)
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWw+", assertion)
+}
+
+func TestWaitTunnelsOtherHosts(t *testing.T) {
+	ca, path := newTestCA(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("idp"))
+	}))
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	p := New(ca, []string{"signin.aliyun.com"})
+	l, client := startProxy(t, p, roots)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		res, err := client.Get(ts.URL)
+		require.Nil(t, err)
+		defer res.Body.Close()
+
+		body, err := ioutil.ReadAll(res.Body)
+		require.Nil(t, err)
+		require.Equal(t, "idp", string(body))
+	}()
+
+	go p.Wait(l, 5*time.Second)
+	<-done
+}
+
+func TestWaitTimeout(t *testing.T) {
+	ca, path := newTestCA(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	_, err = New(ca, nil).Wait(l, 10*time.Millisecond)
+	require.EqualError(t, err, "no SAML assertion was posted through the proxy within 10ms")
+}
@@ -0,0 +1,163 @@
+package catalog
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+var logger = logrus.WithField("pkg", "catalog")
+
+// ErrInvalidSignature returned when the catalog signature does not match the configured public key
+var ErrInvalidSignature = errors.New("role catalog signature verification failed")
+
+// Entry org published annotations for a single role
+type Entry struct {
+	RoleARN     string `json:"role_arn" yaml:"role_arn"`
+	Description string `json:"description" yaml:"description"`
+	Environment string `json:"environment" yaml:"environment"`
+	Owner       string `json:"owner" yaml:"owner"`
+	RiskLevel   string `json:"risk_level" yaml:"risk_level"`
+}
+
+// Catalog holds the role annotations keyed by role ARN
+type Catalog struct {
+	Roles []*Entry `json:"roles" yaml:"roles"`
+
+	byARN map[string]*Entry
+}
+
+// Lookup return the entry for the given role ARN, nil if the role isn't listed
+func (c *Catalog) Lookup(roleARN string) *Entry {
+	if c == nil {
+		return nil
+	}
+	return c.byARN[roleARN]
+}
+
+// Annotation build a short human readable summary of the role, empty if the role isn't listed
+func (c *Catalog) Annotation(roleARN string) string {
+	entry := c.Lookup(roleARN)
+	if entry == nil {
+		return ""
+	}
+
+	parts := []string{}
+	if entry.Description != "" {
+		parts = append(parts, entry.Description)
+	}
+	if entry.Environment != "" {
+		parts = append(parts, "env: "+entry.Environment)
+	}
+	if entry.Owner != "" {
+		parts = append(parts, "owner: "+entry.Owner)
+	}
+	if entry.RiskLevel != "" {
+		parts = append(parts, "risk: "+entry.RiskLevel)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Parse decode a JSON or YAML catalog document
+func Parse(data []byte) (*Catalog, error) {
+	c := new(Catalog)
+
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, errors.Wrap(err, "error decoding JSON role catalog")
+		}
+	} else {
+		if err := yaml.Unmarshal(data, c); err != nil {
+			return nil, errors.Wrap(err, "error decoding YAML role catalog")
+		}
+	}
+
+	c.byARN = make(map[string]*Entry, len(c.Roles))
+	for _, entry := range c.Roles {
+		if entry.RoleARN == "" {
+			continue
+		}
+		c.byARN[entry.RoleARN] = entry
+	}
+
+	return c, nil
+}
+
+// Verify check the base64 encoded ed25519 signature of the catalog document
+func Verify(data []byte, signature string, publicKey string) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return errors.Wrap(err, "error decoding role catalog public key")
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid role catalog public key size: %d", len(key))
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return errors.Wrap(err, "error decoding role catalog signature")
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(key), data, sig) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Fetch download the catalog from catalogURL, the detached signature is expected at catalogURL + ".sig"
+func Fetch(client *http.Client, catalogURL string, publicKey string) (*Catalog, error) {
+	u, err := url.Parse(catalogURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing role catalog URL")
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("role catalog must be served over https: %s", catalogURL)
+	}
+	if publicKey == "" {
+		return nil, errors.New("role catalog public key is required to verify the catalog")
+	}
+
+	data, err := get(client, catalogURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving role catalog")
+	}
+
+	signature, err := get(client, catalogURL+".sig")
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving role catalog signature")
+	}
+
+	if err := Verify(data, string(signature), publicKey); err != nil {
+		return nil, err
+	}
+
+	logger.WithField("url", catalogURL).Debug("role catalog verified")
+
+	return Parse(data)
+}
+
+func get(client *http.Client, location string) ([]byte, error) {
+	res, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request for url: %s failed status: %s", location, res.Status)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
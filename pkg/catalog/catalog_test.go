@@ -0,0 +1,79 @@
+package catalog
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const yamlCatalog = `roles:
+  - role_arn: acs:ram::000000000001:role/Development
+    description: Day to day development
+    environment: dev
+    owner: platform@example.com
+    risk_level: low
+  - role_arn: acs:ram::000000000001:role/Production
+    environment: prod
+    risk_level: high
+`
+
+func TestParseYAML(t *testing.T) {
+	c, err := Parse([]byte(yamlCatalog))
+	require.Nil(t, err)
+	require.Len(t, c.Roles, 2)
+	require.Equal(t, "Day to day development, env: dev, owner: platform@example.com, risk: low", c.Annotation("acs:ram::000000000001:role/Development"))
+	require.Equal(t, "env: prod, risk: high", c.Annotation("acs:ram::000000000001:role/Production"))
+	require.Equal(t, "", c.Annotation("acs:ram::000000000001:role/Unknown"))
+}
+
+func TestParseJSON(t *testing.T) {
+	c, err := Parse([]byte(`{"roles":[{"role_arn":"acs:ram::000000000001:role/Development","owner":"ops"}]}`))
+	require.Nil(t, err)
+	require.Equal(t, "ops", c.Lookup("acs:ram::000000000001:role/Development").Owner)
+}
+
+func TestNilCatalog(t *testing.T) {
+	var c *Catalog
+	require.Nil(t, c.Lookup("acs:ram::000000000001:role/Development"))
+	require.Equal(t, "", c.Annotation("acs:ram::000000000001:role/Development"))
+}
+
+func TestFetch(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.Nil(t, err)
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(yamlCatalog)))
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/roles.yaml":
+			w.Write([]byte(yamlCatalog))
+		case "/roles.yaml.sig":
+			w.Write([]byte(signature))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	publicKey := base64.StdEncoding.EncodeToString(pub)
+
+	c, err := Fetch(ts.Client(), ts.URL+"/roles.yaml", publicKey)
+	require.Nil(t, err)
+	require.Len(t, c.Roles, 2)
+
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	require.Nil(t, err)
+
+	_, err = Fetch(ts.Client(), ts.URL+"/roles.yaml", base64.StdEncoding.EncodeToString(otherPub))
+	require.Equal(t, ErrInvalidSignature, err)
+}
+
+func TestFetchRequiresHTTPS(t *testing.T) {
+	_, err := Fetch(http.DefaultClient, "http://example.com/roles.yaml", "abc")
+	require.NotNil(t, err)
+}
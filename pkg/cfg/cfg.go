@@ -2,8 +2,12 @@ package cfg
 
 import (
 	"fmt"
+	"log"
 	"net/url"
+	"strings"
+	"time"
 
+	"github.com/aliyun/saml2alibabacloud/pkg/idn"
 	"github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
 	ini "gopkg.in/ini.v1"
@@ -27,26 +31,75 @@ const (
 	// DefaultProfile this is the default profile name used to save the credentials in the `aliyun` cli
 	// see https://www.alibabacloud.com/help/doc-detail/121259.htm
 	DefaultProfile = "saml"
+
+	// DefaultClockSkewTolerance this is the maximum number of seconds an assertion NotBefore may be ahead of the local clock
+	DefaultClockSkewTolerance = 30
 )
 
 // IDPAccount saml IDP account
 type IDPAccount struct {
-	AppID             string `ini:"app_id"` // used by OneLogin and AzureAD
-	URL               string `ini:"url"`
-	Username          string `ini:"username"`
-	Provider          string `ini:"provider"`
-	MFA               string `ini:"mfa"`
-	SkipVerify        bool   `ini:"skip_verify"`
-	Timeout           int    `ini:"timeout"`
-	AlibabaCloudURN   string `ini:"alibabacloud_urn"`
-	SessionDuration   int    `ini:"alibabacloud_session_duration"`
-	Profile           string `ini:"alibabacloud_profile"`
-	ResourceID        string `ini:"resource_id"` // used by F5APM
-	Subdomain         string `ini:"subdomain"`   // used by OneLogin
-	RoleARN           string `ini:"role_arn"`
-	Region            string `ini:"region"`
-	HTTPAttemptsCount string `ini:"http_attempts_count"`
-	HTTPRetryDelay    string `ini:"http_retry_delay"`
+	AppID                string `ini:"app_id"` // used by OneLogin, AzureAD, IDCS and Entrust
+	URL                  string `ini:"url"`
+	Username             string `ini:"username"`
+	Provider             string `ini:"provider"`
+	MFA                  string `ini:"mfa"`
+	SkipVerify           bool   `ini:"skip_verify"`
+	SkipVerifyHosts      string `ini:"skip_verify_hosts"` // comma separated hosts skip_verify applies to, *.example.com for subdomains
+	Timeout              int    `ini:"timeout"`           // overall deadline in seconds for authenticating with the IdP
+	STSTimeout           int    `ini:"sts_timeout"`       // deadline in seconds for the STS exchange
+	AlibabaCloudURN      string `ini:"alibabacloud_urn"`
+	SessionDuration      int    `ini:"alibabacloud_session_duration"`
+	Profile              string `ini:"alibabacloud_profile"`
+	ResourceID           string `ini:"resource_id"` // used by F5APM, and by ForgeRock as the authentication tree
+	Subdomain            string `ini:"subdomain"`   // used by OneLogin
+	RoleARN              string `ini:"role_arn"`
+	Region               string `ini:"region"`
+	Partition            string `ini:"partition"` // china or international, by default the one the assertion is destined for
+	HTTPAttemptsCount    string `ini:"http_attempts_count"`
+	HTTPRetryDelay       string `ini:"http_retry_delay"`
+	RoleCatalogURL       string `ini:"role_catalog_url"`
+	RoleCatalogPublicKey string `ini:"role_catalog_public_key"`
+	ClockSkewTolerance   int    `ini:"clock_skew_tolerance"`
+	ClockCheck           string `ini:"clock_check"`        // warn, refuse or off, what to do when the local clock drifts beyond clock_skew_tolerance
+	ClockSource          string `ini:"clock_source"`       // URL whose Date header the local clock is compared with, STS by default
+	URLMirrors           string `ini:"url_mirrors"`        // comma separated list of alternative IdP URLs
+	UserAgent            string `ini:"user_agent"`         // overrides the User-Agent sent to the IdP and STS
+	TenantID             string `ini:"tenant_id"`          // used by AzureAD, a tenant ID or domain, organizations or consumers
+	MaintenanceWindow    int    `ini:"maintenance_window"` // seconds to wait for an IdP showing a maintenance page, -1 disables
+	RateLimitWindow      int    `ini:"rate_limit_window"`  // seconds to wait for an IdP answering 429 or 503 with Retry-After, -1 disables
+	FallbackProvider     string `ini:"fallback_provider"`  // provider used when the login flow of the primary one breaks
+	AssertionHook        string `ini:"assertion_hook"`     // command transforming the assertion before the STS exchange
+	CredentialHook       string `ini:"credential_hook"`    // command deriving extra variables from the STS credentials before they are output
+	CredentialBackups    int    `ini:"credential_backups"` // backups of the AlibabaCloud CLI configuration to keep, -1 disables
+	RoleAllow            string `ini:"role_allow"`         // comma separated role ARN patterns the roles are limited to
+	RoleDeny             string `ini:"role_deny"`          // comma separated role ARN patterns hidden and refused
+	RoleGroup            string `ini:"role_group"`         // none, account or environment, how the roles of the chooser are grouped
+	RoleSort             string `ini:"role_sort"`          // alphabetical, recent or custom, how the roles of the chooser are sorted
+	RoleOrder            string `ini:"role_order"`         // comma separated role ARN patterns listed first, in this order, with role_sort = custom
+	TelemetryURL         string `ini:"telemetry_url"`      // opt-in endpoint receiving anonymized failure reports
+	AnalyticsExport      string `ini:"analytics_export"`   // CSV file pseudonymous login events are appended to
+	AnalyticsSalt        string `ini:"analytics_salt"`     // secret of the organization keying the pseudonyms of analytics_export
+	CloudflareAccess     string `ini:"cloudflare_access"`  // auto, otp, cloudflared or off, how to login to Cloudflare Access in front of the IdP
+	OutputGuard          string `ini:"output_guard"`       // warn, refuse or off, what to do when credentials are written inside a git work tree without being ignored
+	HomeRealm            string `ini:"home_realm"`         // used by ADFS, the claims provider picked on the home realm discovery page
+	Connector            string `ini:"connector"`          // used by Dex, the connector picked on the connector selection page
+	AppName              string `ini:"app_name"`           // used by AzureAD, the enterprise application looked up in My Apps when app_id is empty
+	AppLabel             string `ini:"app_label"`          // used by Okta, the label of the assigned app the login goes to when the url is the org URL
+	ECPACSURL            string `ini:"ecp_acs_url"`        // used by ECP, the assertion consumer in the AuthnRequest, the Alibaba Cloud SAML sign in by default
+	ECPIssuer            string `ini:"ecp_issuer"`         // used by ECP, the SP entity ID in the AuthnRequest, alibabacloud_urn by default
+	ECPNameIDFormat      string `ini:"ecp_nameid_format"`  // used by ECP, the NameID format requested from the IdP
+	ClientCert           string `ini:"client_cert"`        // used by HENNGE, AzureAD and ADFS, PEM or PFX certificate presented to the IdP for TLS client authentication
+	ClientKey            string `ini:"client_key"`         // used by HENNGE and AzureAD, PEM private key of client_cert
+	ClientKeyPIN         string `ini:"client_key_pin"`     // PIN decrypting client_key when it is encrypted, or the PFX client_cert
+	DoHURL               string `ini:"doh_url"`            // DNS-over-HTTPS server resolving the IdP and STS hosts, the system resolver by default
+	RolePipeline         string `ini:"role_pipeline"`      // comma separated stages, a partition, a role ARN and a profile, each assumed with the assertion
+	KeyringFallback      string `ini:"keyring_fallback"`   // prompt, file or fail, what to do when the system keyring can't be used
+	MFADevice            string `ini:"mfa_device"`         // used by Okta, OneLogin and PingID, the device used when several are enrolled for the factor
+	MFATimeout           int    `ini:"mfa_timeout"`        // seconds a push approval is waited for, the default of the provider when 0
+	MFAPollInterval      int    `ini:"mfa_poll_interval"`  // seconds between the checks of a push approval, the default of the provider when 0
+	TokenURL             string `ini:"token_url"`          // used by MachineIdentity, the OAuth token endpoint of the client credentials grant
+	TokenScope           string `ini:"token_scope"`        // used by MachineIdentity, the scope of the service minting the assertion
+	ClientFingerprint    string `ini:"client_fingerprint"` // persist or off, whether the headers and TLS parameters sent to the IdP are kept the same across runs
 }
 
 func (ia IDPAccount) String() string {
@@ -62,6 +115,9 @@ func (ia IDPAccount) String() string {
 	case "AzureAD":
 		appID = fmt.Sprintf(`
   AppID: %s`, ia.AppID)
+		if ia.TenantID != "" {
+			appID += fmt.Sprintf("\n  TenantID: %s", ia.TenantID)
+		}
 	}
 
 	return fmt.Sprintf(`account {%s%s
@@ -77,6 +133,120 @@ func (ia IDPAccount) String() string {
 }`, appID, policyID, ia.URL, ia.Username, ia.Provider, ia.MFA, ia.SkipVerify, ia.SessionDuration, ia.Profile, ia.RoleARN, ia.Region)
 }
 
+// Mirrors returns the configured URL followed by any alternative IdP URLs
+func (ia *IDPAccount) Mirrors() []string {
+	urls := []string{ia.URL}
+	for _, mirror := range strings.Split(ia.URLMirrors, ",") {
+		mirror = strings.TrimSpace(mirror)
+		if mirror != "" && mirror != ia.URL {
+			urls = append(urls, mirror)
+		}
+	}
+	return urls
+}
+
+// ToASCII convert the internationalized hostnames of the url and url_mirrors to punycode, the form requests,
+// cookies and the keychain use
+func (ia *IDPAccount) ToASCII() error {
+	urls := ia.Mirrors()
+	for i, u := range urls {
+		ascii, err := idn.ToASCII(u)
+		if err != nil {
+			return errors.Wrapf(err, "URL %s parse failed", u)
+		}
+		urls[i] = ascii
+	}
+
+	ia.URL = urls[0]
+	ia.URLMirrors = strings.Join(urls[1:], ",")
+	return nil
+}
+
+// SkipVerifyHostList the hosts whose TLS certificate isn't verified, those listed in skip_verify_hosts, or with
+// skip_verify the hosts of the url and its mirrors, every other host is always verified
+func (ia *IDPAccount) SkipVerifyHostList() []string {
+	hosts := splitList(ia.SkipVerifyHosts)
+	if len(hosts) > 0 || !ia.SkipVerify {
+		return hosts
+	}
+
+	for _, u := range ia.Mirrors() {
+		if parsed, err := url.Parse(u); err == nil && parsed.Hostname() != "" {
+			hosts = append(hosts, parsed.Hostname())
+		}
+	}
+	return hosts
+}
+
+// MFAWaitTimeout how long push approvals are waited for, mfa_timeout or def when it isn't set
+func (ia *IDPAccount) MFAWaitTimeout(def time.Duration) time.Duration {
+	if ia.MFATimeout > 0 {
+		return time.Duration(ia.MFATimeout) * time.Second
+	}
+	return def
+}
+
+// MFAWaitInterval the delay between the checks of a push approval, mfa_poll_interval or def when it isn't set
+func (ia *IDPAccount) MFAWaitInterval(def time.Duration) time.Duration {
+	if ia.MFAPollInterval > 0 {
+		return time.Duration(ia.MFAPollInterval) * time.Second
+	}
+	return def
+}
+
+// RoleAllowList the role ARN patterns of role_allow, when there are some only the matching roles can be used
+func (ia *IDPAccount) RoleAllowList() []string {
+	return splitList(ia.RoleAllow)
+}
+
+// RoleDenyList the role ARN patterns of role_deny, the matching roles are never offered nor assumed
+func (ia *IDPAccount) RoleDenyList() []string {
+	return splitList(ia.RoleDeny)
+}
+
+// RoleOrderList the role ARN patterns of role_order, the matching roles are listed first in the order of the patterns
+func (ia *IDPAccount) RoleOrderList() []string {
+	return splitList(ia.RoleOrder)
+}
+
+// PipelineStage a stage of role_pipeline, the role assumed in the partition and the profile its credentials go to
+type PipelineStage struct {
+	Partition string
+	RoleARN   string
+	Profile   string
+}
+
+// RolePipelineStages the stages of role_pipeline, each a partition, a role ARN and a profile separated by spaces,
+// for example international acs:ram::123456789012:role/admin intl, china acs:ram::210987654321:role/admin cn
+func (ia *IDPAccount) RolePipelineStages() ([]*PipelineStage, error) {
+	var stages []*PipelineStage
+	profiles := map[string]bool{}
+	for _, item := range splitList(ia.RolePipeline) {
+		fields := strings.Fields(item)
+		if len(fields) != 3 {
+			return nil, errors.Errorf("role_pipeline stage %q must be a partition, a role ARN and a profile", item)
+		}
+		if profiles[fields[2]] {
+			return nil, errors.Errorf("role_pipeline writes profile %s more than once", fields[2])
+		}
+		profiles[fields[2]] = true
+		stages = append(stages, &PipelineStage{Partition: fields[0], RoleARN: fields[1], Profile: fields[2]})
+	}
+	return stages, nil
+}
+
+// splitList the non empty items of a comma separated list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // Validate validate the required / expected fields are set
 func (ia *IDPAccount) Validate() error {
 	switch ia.Provider {
@@ -92,6 +262,10 @@ func (ia *IDPAccount) Validate() error {
 			return errors.New("Resource ID empty in idp account")
 		}
 	case "AzureAD":
+		if ia.AppID == "" && ia.AppName == "" {
+			return errors.New("app ID and app name empty in idp account")
+		}
+	case "Entrust":
 		if ia.AppID == "" {
 			return errors.New("app ID empty in idp account")
 		}
@@ -106,6 +280,23 @@ func (ia *IDPAccount) Validate() error {
 		return errors.New("URL parse failed")
 	}
 
+	for _, u := range ia.Mirrors() {
+		if _, err := idn.ToASCII(u); err != nil {
+			return errors.Wrapf(err, "URL %s parse failed", u)
+		}
+	}
+
+	if ia.DoHURL != "" {
+		u, err := url.Parse(ia.DoHURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.Errorf("doh_url %s is not an https URL", ia.DoHURL)
+		}
+	}
+
+	if _, err := ia.RolePipelineStages(); err != nil {
+		return err
+	}
+
 	if ia.Provider == "" {
 		return errors.New("Provider empty in idp account")
 	}
@@ -114,6 +305,16 @@ func (ia *IDPAccount) Validate() error {
 		return errors.New("MFA empty in idp account")
 	}
 
+	if ia.MFATimeout < 0 || ia.MFAPollInterval < 0 {
+		return errors.New("mfa_timeout and mfa_poll_interval can't be negative")
+	}
+
+	switch ia.ClientFingerprint {
+	case "", "off", "persist":
+	default:
+		return errors.Errorf("invalid client_fingerprint %s, use persist or off", ia.ClientFingerprint)
+	}
+
 	if ia.Profile == "" {
 		return errors.New("Profile empty in idp account")
 	}
@@ -197,12 +398,51 @@ func (cm *ConfigManager) LoadIDPAccount(idpAccountName string) (*IDPAccount, err
 	return account, nil
 }
 
+// IsIDPAccountDefined whether the configuration file already has a section for the idp account
+func (cm *ConfigManager) IsIDPAccountDefined(idpAccountName string) (bool, error) {
+
+	cfg, err := ini.LoadSources(ini.LoadOptions{Loose: true}, cm.configPath)
+	if err != nil {
+		return false, errors.Wrap(err, "Unable to load configuration file")
+	}
+
+	_, err = cfg.GetSection(idpAccountName)
+	return err == nil, nil
+}
+
+// IDPAccountNames the names of the idp accounts of the configuration file, in the order they appear
+func (cm *ConfigManager) IDPAccountNames() ([]string, error) {
+
+	cfg, err := ini.LoadSources(ini.LoadOptions{Loose: true}, cm.configPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to load configuration file")
+	}
+
+	var names []string
+	for _, sec := range cfg.Sections() {
+		if sec.Name() == ini.DefaultSection && len(sec.Keys()) == 0 {
+			continue
+		}
+		names = append(names, sec.Name())
+	}
+
+	return names, nil
+}
+
 func readAccount(idpAccountName string, cfg *ini.File) (*IDPAccount, error) {
 
 	account := NewIDPAccount()
 
 	sec := cfg.Section(idpAccountName)
 
+	for _, note := range migrateSection(sec) {
+		if note.Migrated {
+			log.Printf("Warning: %s, run saml2alibabacloud config migrate to update the configuration file", note)
+			continue
+		}
+		log.Printf("Warning: %s", note)
+	}
+
 	err := sec.MapTo(account)
 	if err != nil {
 		return nil, errors.Wrap(err, "Unable to map account")
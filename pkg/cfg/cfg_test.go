@@ -1,9 +1,13 @@
 package cfg
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/mitchellh/go-homedir"
 	"github.com/stretchr/testify/require"
 )
 
@@ -72,3 +76,202 @@ func TestNewConfigManagerSave(t *testing.T) {
 	os.Remove(throwAwayConfig)
 
 }
+
+func TestIDPAccountMirrors(t *testing.T) {
+	account := &IDPAccount{
+		URL:        "https://id.example.com",
+		URLMirrors: "https://id-cn.example.com, https://id.example.com,,https://id-sg.example.com",
+	}
+
+	require.Equal(t, []string{"https://id.example.com", "https://id-cn.example.com", "https://id-sg.example.com"}, account.Mirrors())
+}
+
+func TestIDPAccountToASCII(t *testing.T) {
+	account := &IDPAccount{
+		URL:        "https://登录.例子.中国/adfs/ls/IdpInitiatedSignOn.aspx",
+		URLMirrors: "https://id-cn.example.com, https://登录。例子。中国:8443/adfs/ls/IdpInitiatedSignOn.aspx",
+	}
+
+	require.Nil(t, account.ToASCII())
+	require.Equal(t, "https://xn--w2t382c.xn--fsqu00a.xn--fiqs8s/adfs/ls/IdpInitiatedSignOn.aspx", account.URL)
+	require.Equal(t, "https://id-cn.example.com,https://xn--w2t382c.xn--fsqu00a.xn--fiqs8s:8443/adfs/ls/IdpInitiatedSignOn.aspx", account.URLMirrors)
+
+	account.URLMirrors = "https://例子_.中国"
+	require.EqualError(t, account.ToASCII(), "URL https://例子_.中国 parse failed: invalid hostname 例子_.中国: idna: disallowed rune U+005F")
+}
+
+func TestIDPAccountSkipVerifyHostList(t *testing.T) {
+	account := &IDPAccount{
+		URL:        "https://id.example.com/adfs/ls/IdpInitiatedSignOn.aspx",
+		URLMirrors: "https://id-cn.example.com:8443",
+	}
+
+	require.Empty(t, account.SkipVerifyHostList())
+
+	account.SkipVerify = true
+	require.Equal(t, []string{"id.example.com", "id-cn.example.com"}, account.SkipVerifyHostList())
+
+	account.SkipVerifyHosts = "adfs.corp.example.com, *.internal.example.com"
+	require.Equal(t, []string{"adfs.corp.example.com", "*.internal.example.com"}, account.SkipVerifyHostList())
+}
+
+func TestIDPAccountRolePipelineStages(t *testing.T) {
+	account := &IDPAccount{
+		RolePipeline: "international acs:ram::123456789012:role/admin intl,  china  acs:ram::210987654321:role/admin cn",
+	}
+
+	stages, err := account.RolePipelineStages()
+	require.Nil(t, err)
+	require.Equal(t, []*PipelineStage{
+		{Partition: "international", RoleARN: "acs:ram::123456789012:role/admin", Profile: "intl"},
+		{Partition: "china", RoleARN: "acs:ram::210987654321:role/admin", Profile: "cn"},
+	}, stages)
+
+	account.RolePipeline = "china acs:ram::210987654321:role/admin"
+	_, err = account.RolePipelineStages()
+	require.EqualError(t, err, `role_pipeline stage "china acs:ram::210987654321:role/admin" must be a partition, a role ARN and a profile`)
+
+	account.RolePipeline = "china acs:ram::1:role/a cn, international acs:ram::2:role/b cn"
+	_, err = account.RolePipelineStages()
+	require.EqualError(t, err, "role_pipeline writes profile cn more than once")
+}
+
+func TestIDPAccountMFAWait(t *testing.T) {
+	account := &IDPAccount{}
+	require.Equal(t, time.Minute, account.MFAWaitTimeout(time.Minute))
+	require.Equal(t, time.Second, account.MFAWaitInterval(time.Second))
+
+	account.MFATimeout = 300
+	account.MFAPollInterval = 5
+	require.Equal(t, 5*time.Minute, account.MFAWaitTimeout(time.Minute))
+	require.Equal(t, 5*time.Second, account.MFAWaitInterval(time.Second))
+}
+
+func TestContextPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfg")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", dir)
+	defer os.Setenv("HOME", home)
+
+	path, err := ContextPath("", DefaultConfigPath)
+	require.Nil(t, err)
+	require.Equal(t, DefaultConfigPath, path)
+
+	path, err = ContextPath("acme", DefaultConfigPath)
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(dir, ".saml2alibabacloud-contexts", "acme", "saml2alibabacloud"), path)
+	require.DirExists(t, filepath.Dir(path))
+
+	_, err = ContextPath("../acme", DefaultConfigPath)
+	require.NotNil(t, err)
+	require.NotNil(t, ValidateContext(""))
+}
+
+func TestContextProfile(t *testing.T) {
+	require.Equal(t, DefaultProfile, ContextProfile("", DefaultProfile))
+	require.Equal(t, "saml-acme", ContextProfile("acme", DefaultProfile))
+	require.Equal(t, "prod", ContextProfile("acme", "prod"))
+}
+
+func TestDiff(t *testing.T) {
+	before := &IDPAccount{URL: "https://id.whatever.com", Provider: "Okta", MFA: "Auto", SkipVerify: true, Profile: "saml", TenantID: "contoso"}
+	after := *before
+	after.URL = "https://id.example.com"
+	after.SkipVerify = false
+	after.TenantID = ""
+	after.AppLabel = "Alibaba Cloud"
+
+	require.Empty(t, Diff(before, before))
+
+	changes := Diff(before, &after)
+	require.Equal(t, []FieldChange{
+		{Key: "url", Old: "https://id.whatever.com", New: "https://id.example.com"},
+		{Key: "skip_verify", Old: "true"},
+		{Key: "tenant_id", Old: "contoso"},
+		{Key: "app_label", New: "Alibaba Cloud"},
+	}, changes)
+	require.Equal(t, "~ url = https://id.whatever.com -> https://id.example.com", changes[0].String())
+	require.Equal(t, "- skip_verify = true", changes[1].String())
+	require.Equal(t, "+ app_label = Alibaba Cloud", changes[3].String())
+}
+
+func TestIsIDPAccountDefined(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfg")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cfgm, err := NewConfigManager(filepath.Join(dir, "saml2alibabacloud.ini"))
+	require.Nil(t, err)
+
+	defined, err := cfgm.IsIDPAccountDefined("default")
+	require.Nil(t, err)
+	require.False(t, defined)
+
+	require.Nil(t, cfgm.SaveIDPAccount("default", &IDPAccount{URL: "https://id.whatever.com", MFA: "Auto", Provider: "Okta", Profile: "saml"}))
+
+	defined, err = cfgm.IsIDPAccountDefined("default")
+	require.Nil(t, err)
+	require.True(t, defined)
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfg")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "saml2alibabacloud.ini")
+	original := `[default]
+url                  = https://id.example.com
+provider             = Okta
+mfa                  = Auto
+aws_urn              = urn:amazon:webservices
+aws_session_duration = 7200
+aws_profile          = saml
+alibabacloud_profile = production
+saml_cache           = true
+`
+	require.Nil(t, ioutil.WriteFile(configPath, []byte(original), 0600))
+
+	cfgm, err := NewConfigManager(configPath)
+	require.Nil(t, err)
+
+	// the old keys are read until the file is migrated
+	account, err := cfgm.LoadIDPAccount("default")
+	require.Nil(t, err)
+	require.Equal(t, 7200, account.SessionDuration)
+	require.Equal(t, "production", account.Profile)
+
+	notes, err := cfgm.Migrate(true)
+	require.Nil(t, err)
+	require.Len(t, notes, 5)
+	require.Equal(t, "[default] aws_urn renamed to alibabacloud_urn", notes[0].String())
+	require.Equal(t, "[default] aws_profile removed, alibabacloud_profile is already set", notes[2].String())
+	require.Equal(t, "[default] saml_cache is ignored, the IdP session is cached by saml2alibabacloud prewarm", notes[3].String())
+	require.False(t, notes[3].Migrated)
+	require.Equal(t, "[default] alibabacloud_urn = urn:amazon:webservices is the AWS URN, Alibaba Cloud expects urn:alibaba:cloudcomputing", notes[4].String())
+
+	data, err := ioutil.ReadFile(configPath)
+	require.Nil(t, err)
+	require.Equal(t, original, string(data))
+
+	_, err = cfgm.Migrate(false)
+	require.Nil(t, err)
+
+	backup, err := ioutil.ReadFile(configPath + ".bak")
+	require.Nil(t, err)
+	require.Equal(t, original, string(backup))
+
+	data, err = ioutil.ReadFile(configPath)
+	require.Nil(t, err)
+	require.NotContains(t, string(data), "aws_")
+
+	account, err = cfgm.LoadIDPAccount("default")
+	require.Nil(t, err)
+	require.Equal(t, 7200, account.SessionDuration)
+	require.Equal(t, "production", account.Profile)
+}
@@ -0,0 +1,68 @@
+package cfg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// ContextsPath the directory holding a separate configuration and cache root for each named context
+const ContextsPath = "~/.saml2alibabacloud-contexts"
+
+var contextNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ValidateContext check the context name can be used as a directory name
+func ValidateContext(context string) error {
+	if !contextNameRegexp.MatchString(context) {
+		return fmt.Errorf("invalid context name %q, use letters, digits, '.', '_' and '-'", context)
+	}
+	return nil
+}
+
+// ContextRoot the directory holding the configuration and caches of the named context, created if missing
+func ContextRoot(context string) (string, error) {
+	if err := ValidateContext(context); err != nil {
+		return "", err
+	}
+
+	root, err := homedir.Expand(filepath.Join(ContextsPath, context))
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return "", errors.Wrap(err, "error creating context directory")
+	}
+
+	return root, nil
+}
+
+// ContextProfile the AlibabaCloud CLI profile the credentials of an account are written to in the named context, the
+// DefaultProfile shared by every context is renamed after it so the logins of one context don't overwrite the
+// credentials of another, other profiles are kept as configured
+func ContextProfile(context, profile string) string {
+	if context == "" || profile != DefaultProfile {
+		return profile
+	}
+	return DefaultProfile + "-" + context
+}
+
+// ContextPath the location of a file kept in the home directory by default, such as DefaultConfigPath, within the
+// root of the named context, the file is left where it is when no context is selected
+func ContextPath(context, filename string) (string, error) {
+	if context == "" {
+		return filename, nil
+	}
+
+	root, err := ContextRoot(context)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(root, strings.TrimPrefix(filepath.Base(filename), ".")), nil
+}
@@ -0,0 +1,56 @@
+package cfg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldChange a setting of the idp account with its value before and after a change
+type FieldChange struct {
+	Key string
+	Old string
+	New string
+}
+
+func (fc FieldChange) String() string {
+	switch {
+	case fc.Old == "":
+		return fmt.Sprintf("+ %s = %s", fc.Key, fc.New)
+	case fc.New == "":
+		return fmt.Sprintf("- %s = %s", fc.Key, fc.Old)
+	}
+	return fmt.Sprintf("~ %s = %s -> %s", fc.Key, fc.Old, fc.New)
+}
+
+// Diff the settings of the idp account which differ between before and after, in the order of the configuration file
+func Diff(before, after *IDPAccount) []FieldChange {
+	var changes []FieldChange
+
+	b := reflect.ValueOf(before).Elem()
+	a := reflect.ValueOf(after).Elem()
+	t := b.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("ini"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+
+		old := formatValue(b.Field(i))
+		updated := formatValue(a.Field(i))
+		if old != updated {
+			changes = append(changes, FieldChange{Key: key, Old: old, New: updated})
+		}
+	}
+
+	return changes
+}
+
+// formatValue the value as written in the configuration file, empty for the zero value
+func formatValue(v reflect.Value) string {
+	if v.IsZero() {
+		return ""
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,132 @@
+package cfg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	ini "gopkg.in/ini.v1"
+)
+
+// renamedKey a key read under a new name, renamed since it was introduced or inherited from saml2aws
+type renamedKey struct {
+	Old string
+	New string
+}
+
+// deprecatedValue a value which is still read but no longer does what it used to, or never did here
+type deprecatedValue struct {
+	Key    string
+	Value  string
+	Advice string
+}
+
+// renamedKeys the old keys are read when the new ones aren't set
+var renamedKeys = []renamedKey{
+	{Old: "aws_urn", New: "alibabacloud_urn"},
+	{Old: "aws_session_duration", New: "alibabacloud_session_duration"},
+	{Old: "aws_profile", New: "alibabacloud_profile"},
+}
+
+// droppedKeys keys of saml2aws without an equivalent, with the reason they are ignored
+var droppedKeys = map[string]string{
+	"credentials_file":        "the credentials are saved to the AlibabaCloud CLI configuration",
+	"saml_cache":              "the IdP session is cached by saml2alibabacloud prewarm",
+	"saml_cache_file":         "the IdP session is cached by saml2alibabacloud prewarm",
+	"target_url":              "the provider finds the assertion itself",
+	"disable_remember_device": "the providers remember the device the way the IdP allows",
+	"disable_sessions":        "the providers remember the device the way the IdP allows",
+	"prompter":                "the prompts are always the terminal ones",
+}
+
+// deprecatedValues checked once the keys are renamed
+var deprecatedValues = []deprecatedValue{
+	{Key: "alibabacloud_urn", Value: "urn:amazon:webservices", Advice: "is the AWS URN, Alibaba Cloud expects " + DefaultAlibabaCloudURN},
+}
+
+// MigrationNote a key of the configuration file which was migrated, or which should be looked at
+type MigrationNote struct {
+	Section string
+	Key     string
+	Message string
+	// Migrated whether the key was rewritten, the other notes are warnings
+	Migrated bool
+}
+
+func (n MigrationNote) String() string {
+	return fmt.Sprintf("[%s] %s %s", n.Section, n.Key, n.Message)
+}
+
+// migrateSection rename the old keys of the section in place, the new key wins when both are set
+func migrateSection(sec *ini.Section) []MigrationNote {
+	var notes []MigrationNote
+
+	for _, rename := range renamedKeys {
+		if !sec.HasKey(rename.Old) {
+			continue
+		}
+
+		note := MigrationNote{Section: sec.Name(), Key: rename.Old, Migrated: true}
+		if sec.HasKey(rename.New) {
+			note.Message = fmt.Sprintf("removed, %s is already set", rename.New)
+		} else {
+			note.Message = fmt.Sprintf("renamed to %s", rename.New)
+			sec.Key(rename.New).SetValue(sec.Key(rename.Old).Value())
+		}
+		sec.DeleteKey(rename.Old)
+		notes = append(notes, note)
+	}
+
+	for _, key := range sec.KeyStrings() {
+		if reason, ok := droppedKeys[key]; ok {
+			notes = append(notes, MigrationNote{Section: sec.Name(), Key: key, Message: "is ignored, " + reason})
+		}
+	}
+
+	for _, deprecated := range deprecatedValues {
+		if sec.HasKey(deprecated.Key) && strings.EqualFold(sec.Key(deprecated.Key).Value(), deprecated.Value) {
+			notes = append(notes, MigrationNote{Section: sec.Name(), Key: deprecated.Key, Message: fmt.Sprintf("= %s %s", deprecated.Value, deprecated.Advice)})
+		}
+	}
+
+	return notes
+}
+
+// Migrate rename the old keys of every idp account of the configuration file, keeping the original next to it with a
+// .bak suffix, with dryRun the file is left untouched and only the notes are returned
+func (cm *ConfigManager) Migrate(dryRun bool) ([]MigrationNote, error) {
+
+	cfg, err := ini.LoadSources(ini.LoadOptions{Loose: true}, cm.configPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to load configuration file")
+	}
+
+	var notes []MigrationNote
+	migrated := false
+	for _, sec := range cfg.Sections() {
+		for _, note := range migrateSection(sec) {
+			notes = append(notes, note)
+			migrated = migrated || note.Migrated
+		}
+	}
+
+	if dryRun || !migrated {
+		return notes, nil
+	}
+
+	original, err := ioutil.ReadFile(cm.configPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read configuration file")
+	}
+	err = ioutil.WriteFile(cm.configPath+".bak", original, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to back up configuration file")
+	}
+
+	err = cfg.SaveTo(cm.configPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to save configuration file")
+	}
+	return notes, nil
+}
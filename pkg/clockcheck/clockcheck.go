@@ -0,0 +1,50 @@
+package clockcheck
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultSource the time source used when none is configured, the Date header of STS is what assertions and
+	// signed requests are checked against
+	DefaultSource = "https://sts.aliyuncs.com"
+
+	// timeout how long the check may take, a slow or unreachable source skips it rather than holding up the login
+	timeout = 5 * time.Second
+)
+
+// Offset how far the local clock is behind the source, negative when it is ahead, measured from the Date header of a
+// HEAD request taking half the round trip as the time the header was written
+func Offset(client *http.Client, source string) (time.Duration, error) {
+	if client == nil {
+		client = &http.Client{Timeout: timeout}
+	}
+
+	req, err := http.NewRequest("HEAD", source, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "error building time source request")
+	}
+
+	start := time.Now()
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "error querying time source")
+	}
+	res.Body.Close()
+
+	rtt := time.Since(start)
+
+	date, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		return 0, errors.Wrapf(err, "time source %s returned no valid Date header", source)
+	}
+
+	// the Date header is truncated to the second, its middle is the best estimate
+	remote := date.Add(500 * time.Millisecond)
+
+	return remote.Sub(start.Add(rtt / 2)), nil
+}
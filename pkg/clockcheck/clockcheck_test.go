@@ -0,0 +1,51 @@
+package clockcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTimeSource(offset time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(offset).UTC().Format(http.TimeFormat))
+	}))
+}
+
+func TestOffset(t *testing.T) {
+	ts := newTimeSource(0)
+	defer ts.Close()
+
+	offset, err := Offset(nil, ts.URL)
+	require.NoError(t, err)
+	require.True(t, offset < 2*time.Second && offset > -2*time.Second, "unexpected offset %v", offset)
+}
+
+func TestOffsetDrift(t *testing.T) {
+	ts := newTimeSource(5 * time.Minute)
+	defer ts.Close()
+
+	offset, err := Offset(nil, ts.URL)
+	require.NoError(t, err)
+	require.InDelta(t, (5 * time.Minute).Seconds(), offset.Seconds(), 2)
+
+	ahead := newTimeSource(-5 * time.Minute)
+	defer ahead.Close()
+
+	offset, err = Offset(nil, ahead.URL)
+	require.NoError(t, err)
+	require.InDelta(t, (-5 * time.Minute).Seconds(), offset.Seconds(), 2)
+}
+
+func TestOffsetNoDate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Date"] = nil
+	}))
+	defer ts.Close()
+
+	_, err := Offset(nil, ts.URL)
+	require.Error(t, err)
+}
@@ -14,16 +14,38 @@ type LoginDetails struct {
 	StateToken   string // used by Okta
 }
 
-// Validate validate the login details
+// Requirements the login details a provider needs before it can authenticate
+type Requirements struct {
+	Username          bool
+	Password          bool
+	MFAToken          bool
+	ClientCredentials bool // client id and secret
+}
+
+// DefaultRequirements the login details needed by providers authenticating with a username and password
+var DefaultRequirements = Requirements{Username: true, Password: true}
+
+// Validate validate the login details against DefaultRequirements
 func (ld *LoginDetails) Validate() error {
+	return ld.ValidateFor(DefaultRequirements)
+}
+
+// ValidateFor validate the login details against the requirements of a provider
+func (ld *LoginDetails) ValidateFor(req Requirements) error {
 	if ld.URL == "" {
 		return errors.New("Empty URL")
 	}
-	if ld.Username == "" {
+	if req.Username && ld.Username == "" {
 		return errors.New("Empty username")
 	}
-	if ld.Password == "" {
+	if req.Password && ld.Password == "" {
 		return errors.New("Empty password")
 	}
+	if req.MFAToken && ld.MFAToken == "" {
+		return errors.New("Empty MFA token")
+	}
+	if req.ClientCredentials && (ld.ClientID == "" || ld.ClientSecret == "") {
+		return errors.New("Empty client ID or client secret")
+	}
 	return nil
 }
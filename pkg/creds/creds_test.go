@@ -50,3 +50,20 @@ func TestValidateLoginDetails(t *testing.T) {
 
 	require.Nil(t, err)
 }
+
+func TestValidateForRequirements(t *testing.T) {
+
+	ld := &LoginDetails{URL: "echo assertion"}
+
+	require.Nil(t, ld.ValidateFor(Requirements{}))
+	require.Error(t, ld.ValidateFor(Requirements{Username: true}))
+
+	ld = &LoginDetails{URL: "https://test.com", Username: "test", Password: "test", ClientID: "id"}
+
+	require.Error(t, ld.ValidateFor(Requirements{Username: true, Password: true, ClientCredentials: true}))
+
+	ld.ClientSecret = "secret"
+
+	require.Nil(t, ld.ValidateFor(Requirements{Username: true, Password: true, ClientCredentials: true}))
+	require.Error(t, ld.ValidateFor(Requirements{MFAToken: true}))
+}
@@ -0,0 +1,192 @@
+package fingerprint
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/statefile"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPath the default location of the client fingerprints
+const DefaultPath = "~/.saml2alibabacloud-fingerprints.json"
+
+// defaultAcceptLanguage used when the locale of the environment can't be read
+const defaultAcceptLanguage = "en-US,en;q=0.9"
+
+// defaultAccept the Accept header of a browser navigating to a page
+const defaultAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+// defaultCipherSuites the TLS 1.2 suites offered, in the order of the browsers, TLS 1.3 ones can't be configured
+var defaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+var logger = logrus.WithField("pkg", "fingerprint")
+
+// Fingerprint the headers and TLS parameters presented to an IdP, kept the same across runs so risk engines see
+// the same client at every login
+type Fingerprint struct {
+	UserAgent        string            `json:"user_agent"`
+	AcceptLanguage   string            `json:"accept_language"`
+	Accept           string            `json:"accept"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	CipherSuites     []uint16          `json:"cipher_suites"`
+	CurvePreferences []tls.CurveID     `json:"curve_preferences"`
+	Created          time.Time         `json:"created"`
+}
+
+// Generate a fingerprint with userAgent, the language of the locale read with getenv and explicit TLS parameters,
+// which are recorded so an upgrade of the toolchain doesn't change them
+func Generate(userAgent string, getenv func(string) string) *Fingerprint {
+	suites := make([]uint16, len(defaultCipherSuites))
+	copy(suites, defaultCipherSuites)
+
+	return &Fingerprint{
+		UserAgent:        userAgent,
+		AcceptLanguage:   acceptLanguage(getenv),
+		Accept:           defaultAccept,
+		CipherSuites:     suites,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+		Created:          time.Now().UTC(),
+	}
+}
+
+// acceptLanguage the Accept-Language of the locale, LC_ALL, LC_MESSAGES then LANG such as de_DE.UTF-8
+func acceptLanguage(getenv func(string) string) string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		locale := getenv(env)
+		if i := strings.IndexAny(locale, ".@"); i >= 0 {
+			locale = locale[:i]
+		}
+		if locale == "" || locale == "C" || locale == "POSIX" {
+			continue
+		}
+
+		parts := strings.SplitN(locale, "_", 2)
+		if len(parts) == 1 {
+			return parts[0]
+		}
+		return parts[0] + "-" + parts[1] + "," + parts[0] + ";q=0.9"
+	}
+	return defaultAcceptLanguage
+}
+
+// Apply set the headers of the fingerprint on req, those the provider set itself are kept
+func (f *Fingerprint) Apply(req *http.Request) {
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	if req.Header.Get("Accept-Language") == "" && f.AcceptLanguage != "" {
+		req.Header.Set("Accept-Language", f.AcceptLanguage)
+	}
+	if req.Header.Get("Accept") == "" && f.Accept != "" {
+		req.Header.Set("Accept", f.Accept)
+	}
+	for name, value := range f.Headers {
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, value)
+		}
+	}
+}
+
+// ApplyTLS restrict the TLS parameters of config to those of the fingerprint
+func (f *Fingerprint) ApplyTLS(config *tls.Config) {
+	if len(f.CipherSuites) > 0 {
+		config.CipherSuites = f.CipherSuites
+	}
+	if len(f.CurvePreferences) > 0 {
+		config.CurvePreferences = f.CurvePreferences
+	}
+}
+
+// Store the fingerprints keyed by Key, stored in an integrity protected state file
+type Store struct {
+	filename string
+}
+
+// Key the key of the fingerprint of username at the IdP of url, the risk engine tracks the devices of the user rather
+// than the idp accounts of the configuration, so the accounts of a user at one IdP share a fingerprint, which is kept
+// when an account is renamed or moved to another --context
+func Key(url, username string) string {
+	return url + " " + username
+}
+
+// New create a store in filename, DefaultPath is used if empty
+func New(filename string) (*Store, error) {
+	if filename == "" {
+		filename = DefaultPath
+	}
+
+	path, err := homedir.Expand(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving fingerprint store path")
+	}
+
+	return &Store{filename: path}, nil
+}
+
+// Get the fingerprint of key, generated with generate and saved the first time
+func (s *Store) Get(key string, generate func() *Fingerprint) (*Fingerprint, error) {
+	fingerprints, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if fp, ok := fingerprints[key]; ok && fp != nil {
+		return fp, nil
+	}
+
+	fp := generate()
+	fingerprints[key] = fp
+
+	if err := statefile.Write(s.filename, fingerprints); err != nil {
+		return nil, errors.Wrapf(err, "unable to save file %s", s.filename)
+	}
+
+	logger.WithField("key", key).Debug("generated client fingerprint")
+	return fp, nil
+}
+
+// Lookup the fingerprint of key, nil when none was saved yet
+func (s *Store) Lookup(key string) (*Fingerprint, error) {
+	fingerprints, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return fingerprints[key], nil
+}
+
+// load read the fingerprints, a file failing the integrity check is discarded and new ones are generated
+func (s *Store) load() (map[string]*Fingerprint, error) {
+	fingerprints := map[string]*Fingerprint{}
+
+	err := statefile.Read(s.filename, &fingerprints)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fingerprints, nil
+		}
+		if err == statefile.ErrTampered {
+			logger.WithField("filename", s.filename).Warn("client fingerprints failed the integrity check and are ignored")
+			return map[string]*Fingerprint{}, nil
+		}
+		return nil, errors.Wrapf(err, "unable to load file %s", s.filename)
+	}
+
+	return fingerprints, nil
+}
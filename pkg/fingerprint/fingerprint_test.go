@@ -0,0 +1,96 @@
+package fingerprint
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreGet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fingerprint")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := New(filepath.Join(dir, "fingerprints.json"))
+	require.Nil(t, err)
+
+	generated := 0
+	generate := func() *Fingerprint {
+		generated++
+		return Generate("saml2alibabacloud/test", func(string) string { return "" })
+	}
+
+	fp, err := s.Get(Key("https://id.example.com", "user@example.com"), generate)
+	require.Nil(t, err)
+	require.Equal(t, "saml2alibabacloud/test", fp.UserAgent)
+
+	// another run gets the same fingerprint back
+	s, err = New(filepath.Join(dir, "fingerprints.json"))
+	require.Nil(t, err)
+	again, err := s.Get(Key("https://id.example.com", "user@example.com"), generate)
+	require.Nil(t, err)
+	require.Equal(t, 1, generated)
+	require.Equal(t, fp.CipherSuites, again.CipherSuites)
+	require.Equal(t, fp.Created.Unix(), again.Created.Unix())
+
+	_, err = s.Get(Key("https://id.example.com", "other@example.com"), generate)
+	require.Nil(t, err)
+	require.Equal(t, 2, generated)
+}
+
+func TestStoreLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fingerprint")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := New(filepath.Join(dir, "fingerprints.json"))
+	require.Nil(t, err)
+
+	fp, err := s.Lookup(Key("https://id.example.com", "user@example.com"))
+	require.Nil(t, err)
+	require.Nil(t, fp)
+
+	_, err = os.Stat(filepath.Join(dir, "fingerprints.json"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	env := map[string]string{"LANG": "de_DE.UTF-8"}
+	require.Equal(t, "de-DE,de;q=0.9", acceptLanguage(func(key string) string { return env[key] }))
+
+	env = map[string]string{"LC_ALL": "C", "LANG": "fr"}
+	require.Equal(t, "fr", acceptLanguage(func(key string) string { return env[key] }))
+
+	require.Equal(t, defaultAcceptLanguage, acceptLanguage(func(string) string { return "" }))
+}
+
+func TestApply(t *testing.T) {
+	fp := &Fingerprint{
+		UserAgent:        "Mozilla/5.0",
+		AcceptLanguage:   "en-GB,en;q=0.9",
+		Accept:           defaultAccept,
+		Headers:          map[string]string{"DNT": "1"},
+		CipherSuites:     []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		CurvePreferences: []tls.CurveID{tls.X25519},
+	}
+
+	req, err := http.NewRequest("GET", "https://id.example.com", nil)
+	require.Nil(t, err)
+	req.Header.Set("Accept", "application/json")
+
+	fp.Apply(req)
+	require.Equal(t, "Mozilla/5.0", req.Header.Get("User-Agent"))
+	require.Equal(t, "en-GB,en;q=0.9", req.Header.Get("Accept-Language"))
+	require.Equal(t, "application/json", req.Header.Get("Accept"))
+	require.Equal(t, "1", req.Header.Get("DNT"))
+
+	config := &tls.Config{}
+	fp.ApplyTLS(config)
+	require.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, config.CipherSuites)
+	require.Equal(t, []tls.CurveID{tls.X25519}, config.CurvePreferences)
+}
@@ -7,6 +7,7 @@ import (
 // CommonFlags flags common to all of the `saml2alibabacloud` commands (except `help`)
 type CommonFlags struct {
 	AppID           string
+	AppName         string
 	ClientID        string
 	ClientSecret    string
 	ConfigFile      string
@@ -14,6 +15,7 @@ type CommonFlags struct {
 	IdpProvider     string
 	MFA             string
 	MFAToken        string
+	MFADevice       string
 	URL             string
 	Username        string
 	Password        string
@@ -27,14 +29,29 @@ type CommonFlags struct {
 	ResourceID      string
 	DisableKeychain bool
 	Region          string
+	Offline         bool
+	TenantID        string
+	Context         string
+	WebPrompt       bool
+
+	RegisterAliyunProcess bool
 }
 
 // LoginExecFlags flags for the Login / Exec commands
 type LoginExecFlags struct {
-	CommonFlags  *CommonFlags
-	Force        bool
-	DuoMFAOption string
-	ExecProfile  string
+	CommonFlags      *CommonFlags
+	Force            bool
+	DuoMFAOption     string
+	ExecProfile      string
+	NoWrite          bool
+	CredentialFormat string
+	ListRolesJSON    bool
+	NoAssume         bool
+	Silent           bool
+	CheckProfile     bool
+	OutputFile       string
+	DryRun           bool
+	CaptureProxy     string
 }
 
 type ConsoleFlags struct {
@@ -68,6 +85,10 @@ func ApplyFlagOverrides(commonFlags *CommonFlags, account *cfg.IDPAccount) {
 		account.MFA = commonFlags.MFA
 	}
 
+	if commonFlags.MFADevice != "" {
+		account.MFADevice = commonFlags.MFADevice
+	}
+
 	if commonFlags.AlibabaCloudURN != "" {
 		account.AlibabaCloudURN = commonFlags.AlibabaCloudURN
 	}
@@ -93,4 +114,10 @@ func ApplyFlagOverrides(commonFlags *CommonFlags, account *cfg.IDPAccount) {
 	if commonFlags.Region != "" {
 		account.Region = commonFlags.Region
 	}
+	if commonFlags.TenantID != "" {
+		account.TenantID = commonFlags.TenantID
+	}
+	if commonFlags.AppName != "" {
+		account.AppName = commonFlags.AppName
+	}
 }
@@ -0,0 +1,112 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logrus.WithField("pkg", "hook")
+
+// Processor transforms the base64 encoded SAML assertion between the IdP authentication and the STS exchange,
+// for example to have it re-signed by an internal service or to inject attributes from an entitlement system
+type Processor interface {
+	Process(samlAssertion string, account *cfg.IDPAccount) (string, error)
+}
+
+// ProcessorFunc adapts a function to the Processor interface
+type ProcessorFunc func(samlAssertion string, account *cfg.IDPAccount) (string, error)
+
+// Process call the function
+func (f ProcessorFunc) Process(samlAssertion string, account *cfg.IDPAccount) (string, error) {
+	return f(samlAssertion, account)
+}
+
+var (
+	mu         sync.Mutex
+	processors []Processor
+)
+
+// Register add a processor applied to every assertion, builds embedding saml2alibabacloud use it to hook in Go code
+func Register(p Processor) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	processors = append(processors, p)
+}
+
+// Apply run the registered processors in order, followed by the assertion_hook command of the account if any
+func Apply(samlAssertion string, account *cfg.IDPAccount) (string, error) {
+	mu.Lock()
+	chain := append([]Processor{}, processors...)
+	mu.Unlock()
+
+	if account.AssertionHook != "" {
+		chain = append(chain, Command(account.AssertionHook))
+	}
+
+	for i, p := range chain {
+		processed, err := p.Process(samlAssertion, account)
+		if err != nil {
+			return "", errors.Wrapf(err, "assertion hook %d failed", i+1)
+		}
+
+		processed = strings.TrimSpace(processed)
+		if _, err := base64.StdEncoding.DecodeString(processed); err != nil || processed == "" {
+			return "", fmt.Errorf("assertion hook %d did not return a base64 encoded SAML assertion", i+1)
+		}
+
+		samlAssertion = processed
+	}
+
+	if len(chain) > 0 {
+		logger.WithField("hooks", len(chain)).Debug("assertion processed")
+	}
+
+	return samlAssertion, nil
+}
+
+// Command a processor running the command with sh, the assertion is written to its stdin and the transformed
+// assertion read from its stdout, the account details are passed as environment variables
+func Command(command string) Processor {
+	return ProcessorFunc(func(samlAssertion string, account *cfg.IDPAccount) (string, error) {
+		out, err := Run(command, strings.NewReader(samlAssertion), account)
+		if err != nil {
+			return "", err
+		}
+
+		return string(out), nil
+	})
+}
+
+// Run the command of a hook with sh, writing stdin to it and returning its stdout, its stderr goes to the one of
+// saml2alibabacloud and the account details are passed as environment variables
+func Run(command string, stdin io.Reader, account *cfg.IDPAccount) ([]byte, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = stdin
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"SAML2ALIBABACLOUD_IDP_PROVIDER="+account.Provider,
+		"SAML2ALIBABACLOUD_URL="+account.URL,
+		"SAML2ALIBABACLOUD_USERNAME="+account.Username,
+		"SAML2ALIBABACLOUD_PROFILE="+account.Profile,
+	)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,61 @@
+package hook
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyCommand(t *testing.T) {
+	account := &cfg.IDPAccount{Profile: "saml", AssertionHook: `test "$SAML2ALIBABACLOUD_PROFILE" = saml && base64 -d | sed "s/Response/Processed/" | base64`}
+
+	samlAssertion, err := Apply(base64.StdEncoding.EncodeToString([]byte("<Response/>")), account)
+	require.Nil(t, err)
+
+	data, err := base64.StdEncoding.DecodeString(samlAssertion)
+	require.Nil(t, err)
+	require.Equal(t, "<Processed/>", string(data))
+}
+
+func TestApplyInvalidOutput(t *testing.T) {
+	_, err := Apply("PFJlc3BvbnNlLz4=", &cfg.IDPAccount{AssertionHook: "echo not base64!"})
+	require.EqualError(t, err, "assertion hook 1 did not return a base64 encoded SAML assertion")
+
+	_, err = Apply("PFJlc3BvbnNlLz4=", &cfg.IDPAccount{AssertionHook: "exit 3"})
+	require.EqualError(t, err, "assertion hook 1 failed: exit status 3")
+}
+
+func TestApplyRegistered(t *testing.T) {
+	Register(ProcessorFunc(func(samlAssertion string, account *cfg.IDPAccount) (string, error) {
+		return strings.ToUpper(samlAssertion), nil
+	}))
+	defer func() { processors = nil }()
+
+	samlAssertion, err := Apply("abcd", &cfg.IDPAccount{})
+	require.Nil(t, err)
+	require.Equal(t, "ABCD", samlAssertion)
+
+	samlAssertion, err = Apply("abcd", &cfg.IDPAccount{AssertionHook: "tr 'A-Z' 'a-z'"})
+	require.Nil(t, err)
+	require.Equal(t, "abcd", samlAssertion)
+}
+
+func TestApplyNoHooks(t *testing.T) {
+	samlAssertion, err := Apply("abcd", &cfg.IDPAccount{})
+	require.Nil(t, err)
+	require.Equal(t, "abcd", samlAssertion)
+}
+
+func TestRun(t *testing.T) {
+	account := &cfg.IDPAccount{Username: "user@example.com"}
+
+	out, err := Run(`printf "%s %s" "$SAML2ALIBABACLOUD_USERNAME" "$(cat)"`, strings.NewReader("input"), account)
+	require.Nil(t, err)
+	require.Equal(t, "user@example.com input", string(out))
+
+	_, err = Run("exit 3", strings.NewReader(""), account)
+	require.NotNil(t, err)
+}
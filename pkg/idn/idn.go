@@ -0,0 +1,91 @@
+package idn
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/idna"
+)
+
+// ToASCII the URL with its internationalized hostname converted to punycode, as requests are sent, full width
+// dots and upper case letters of the hostname are mapped the way browsers do
+func ToASCII(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	hostname := u.Hostname()
+	if isASCII(hostname) {
+		return rawURL, nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid hostname %s", hostname)
+	}
+	if ascii == hostname {
+		return rawURL, nil
+	}
+
+	u.Host = joinPort(ascii, u.Port())
+	return u.String(), nil
+}
+
+// ToUnicode the URL with its punycode hostname converted to Unicode for display, unchanged when it can't be
+func ToUnicode(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.Contains(strings.ToLower(u.Host), "xn--") {
+		return rawURL
+	}
+
+	// rebuilding the URL would percent encode the Unicode hostname
+	return strings.Replace(rawURL, u.Host, joinPort(Display(u.Hostname()), u.Port()), 1)
+}
+
+// Host the lower case punycode form of the hostname, or of the *. pattern, for comparing hostnames whichever form
+// they are written in
+func Host(host string) string {
+	if strings.HasPrefix(host, "*.") {
+		return "*." + Host(host[2:])
+	}
+	if isASCII(host) {
+		return strings.ToLower(host)
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return strings.ToLower(host)
+	}
+	return ascii
+}
+
+// Display the Unicode form of the hostname, which may carry a port, unchanged when it isn't valid punycode
+func Display(host string) string {
+	if hostname, port, err := net.SplitHostPort(host); err == nil {
+		return joinPort(Display(hostname), port)
+	}
+	unicode, err := idna.Display.ToUnicode(host)
+	if err != nil {
+		return host
+	}
+	return unicode
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func joinPort(host, port string) string {
+	if port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,43 @@
+package idn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToASCII(t *testing.T) {
+	tests := map[string]string{
+		"https://登录.例子.中国/adfs/ls":                "https://xn--w2t382c.xn--fsqu00a.xn--fiqs8s/adfs/ls",
+		"https://登录。例子。中国/adfs/ls":                "https://xn--w2t382c.xn--fsqu00a.xn--fiqs8s/adfs/ls",
+		"https://例子.中国:8443/sso?app=ram":          "https://xn--fsqu00a.xn--fiqs8s:8443/sso?app=ram",
+		"https://ID.例子.中国/":                       "https://id.xn--fsqu00a.xn--fiqs8s/",
+		"https://xn--fsqu00a.xn--fiqs8s/sso":      "https://xn--fsqu00a.xn--fiqs8s/sso",
+		"https://id.example.com/app/Amazon%20AWS": "https://id.example.com/app/Amazon%20AWS",
+		"echo assertion":                          "echo assertion",
+	}
+	for rawURL, expected := range tests {
+		ascii, err := ToASCII(rawURL)
+		require.Nil(t, err, rawURL)
+		require.Equal(t, expected, ascii, rawURL)
+	}
+
+	_, err := ToASCII("https://例子_.中国/")
+	require.Error(t, err)
+}
+
+func TestToUnicode(t *testing.T) {
+	require.Equal(t, "https://登录.例子.中国/adfs/ls", ToUnicode("https://xn--w2t382c.xn--fsqu00a.xn--fiqs8s/adfs/ls"))
+	require.Equal(t, "https://例子.中国:8443/sso", ToUnicode("https://xn--fsqu00a.xn--fiqs8s:8443/sso"))
+	require.Equal(t, "https://id.example.com/sso", ToUnicode("https://id.example.com/sso"))
+}
+
+func TestHost(t *testing.T) {
+	require.Equal(t, "xn--fsqu00a.xn--fiqs8s", Host("例子.中国"))
+	require.Equal(t, "xn--fsqu00a.xn--fiqs8s", Host("xn--fsqu00a.xn--fiqs8s"))
+	require.Equal(t, "*.xn--fsqu00a.xn--fiqs8s", Host("*.例子.中国"))
+	require.Equal(t, "my_host.example.com", Host("My_Host.example.com"))
+	require.Equal(t, "例子.中国", Display("xn--fsqu00a.xn--fiqs8s"))
+	require.Equal(t, "例子.中国:8443", Display("xn--fsqu00a.xn--fiqs8s:8443"))
+	require.Equal(t, "127.0.0.1:8080", Display("127.0.0.1:8080"))
+}
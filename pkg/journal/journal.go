@@ -0,0 +1,108 @@
+package journal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultPath the default location of the login journal
+	DefaultPath = "~/.saml2alibabacloud-history.json"
+
+	// MaxEntries the number of attempts kept, older ones are dropped
+	MaxEntries = 100
+
+	// OutcomeSuccess the login completed
+	OutcomeSuccess = "success"
+
+	// OutcomeFailure the login failed
+	OutcomeFailure = "failure"
+)
+
+// Stages of the login flow, recorded so a failure shows how far the attempt got
+const (
+	StageConfig = "config"
+	StageIdP    = "idp"
+	StageRole   = "role"
+	StageSTS    = "sts"
+	StageSave   = "save"
+)
+
+// Entry a single login attempt
+type Entry struct {
+	Time       time.Time     `json:"time"`
+	Account    string        `json:"account"`
+	Provider   string        `json:"provider,omitempty"`
+	Profile    string        `json:"profile,omitempty"`
+	Role       string        `json:"role,omitempty"`    // the role ARN assumed
+	Expires    time.Time     `json:"expires,omitempty"` // of the credentials issued by STS
+	Outcome    string        `json:"outcome"`
+	Stage      string        `json:"stage,omitempty"`
+	ErrorClass string        `json:"error_class,omitempty"`
+	ErrorCode  string        `json:"error_code,omitempty"` // returned by STS
+	RequestID  string        `json:"request_id,omitempty"` // of the failed STS request
+	Duration   time.Duration `json:"duration"`
+}
+
+// Journal a ring buffer of the most recent login attempts stored in a local file
+type Journal struct {
+	filename string
+}
+
+// New create a journal stored in filename, DefaultPath is used if empty
+func New(filename string) (*Journal, error) {
+	if filename == "" {
+		filename = DefaultPath
+	}
+
+	path, err := homedir.Expand(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving login journal path")
+	}
+
+	return &Journal{filename: path}, nil
+}
+
+// Record append the entry, dropping the oldest entries beyond MaxEntries
+func (j *Journal) Record(entry *Entry) error {
+	entries, err := j.Entries()
+	if err != nil {
+		return err
+	}
+
+	entries = append(entries, entry)
+	if len(entries) > MaxEntries {
+		entries = entries[len(entries)-MaxEntries:]
+	}
+
+	data, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(j.filename, data, 0600)
+}
+
+// Entries return the recorded attempts, oldest first
+func (j *Journal) Entries() ([]*Entry, error) {
+	data, err := ioutil.ReadFile(j.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Entry{}, nil
+		}
+		return nil, errors.Wrapf(err, "unable to load file %s", j.filename)
+	}
+
+	entries := []*Entry{}
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to decode login journal %s", j.filename)
+	}
+
+	return entries, nil
+}
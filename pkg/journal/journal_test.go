@@ -0,0 +1,34 @@
+package journal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordRingBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	j, err := New(filepath.Join(dir, "history.json"))
+	require.Nil(t, err)
+
+	entries, err := j.Entries()
+	require.Nil(t, err)
+	require.Empty(t, entries)
+
+	for i := 0; i < MaxEntries+5; i++ {
+		require.Nil(t, j.Record(&Entry{Account: fmt.Sprintf("account-%d", i), Outcome: OutcomeSuccess}))
+	}
+
+	entries, err = j.Entries()
+	require.Nil(t, err)
+	require.Len(t, entries, MaxEntries)
+	require.Equal(t, "account-5", entries[0].Account)
+	require.Equal(t, fmt.Sprintf("account-%d", MaxEntries+4), entries[MaxEntries-1].Account)
+}
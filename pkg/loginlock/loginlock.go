@@ -0,0 +1,184 @@
+package loginlock
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPath the default location of the lock held by the login in progress
+const DefaultPath = "~/.saml2alibabacloud-login.lock"
+
+var logger = logrus.WithField("pkg", "loginlock")
+
+var (
+	// pollInterval how often a waiting login checks whether the lock was released
+	pollInterval = 200 * time.Millisecond
+
+	// staleAfter the age after which a lock is assumed to be left over by a login which died without releasing it,
+	// the login holding the lock touches it every refreshInterval however long it waits for the user
+	staleAfter = 10 * time.Minute
+
+	// refreshInterval how often the login holding the lock touches it
+	refreshInterval = 2 * time.Minute
+)
+
+// Lock held by the only login allowed to prompt the user, the lock file is created exclusively so this works the
+// same on every platform
+type Lock struct {
+	filename string
+
+	once sync.Once
+	done chan struct{}
+}
+
+// Acquire take the lock stored in filename, DefaultPath is used if empty, waiting for the login holding it to
+// finish, waited tells whether another login held it so the caller can look for the credentials it left behind
+func Acquire(filename string) (lock *Lock, waited bool, err error) {
+	if filename == "" {
+		filename = DefaultPath
+	}
+
+	path, err := homedir.Expand(filename)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "error resolving login lock path")
+	}
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			lock := &Lock{filename: path, done: make(chan struct{})}
+			go lock.refresh(refreshInterval)
+			return lock, waited, nil
+		}
+		if !os.IsExist(err) {
+			return nil, false, errors.Wrap(err, "error creating login lock")
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			// released between the two calls
+			continue
+		}
+
+		if observed := holder(path); stale(path, info) {
+			logger.WithField("path", path).Debug("removing stale login lock")
+			removeStale(path, observed)
+			continue
+		}
+
+		if !waited {
+			log.Printf("Waiting for another saml2alibabacloud login to finish (pid %s)", holder(path))
+			waited = true
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// removeStale remove the stale lock held by observed, it is first renamed to a name of its own so that of two
+// logins finding the same stale lock only one removes it, and checked again so a lock taken in the meantime by a live
+// login is put back rather than removed
+func removeStale(path, observed string) {
+	claimed := fmt.Sprintf("%s.%d.%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, claimed); err != nil {
+		// another login removed it first
+		return
+	}
+
+	info, err := os.Stat(claimed)
+	if err == nil && holder(claimed) == observed && stale(claimed, info) {
+		os.Remove(claimed)
+		return
+	}
+
+	// linking fails rather than replacing a lock taken since
+	if err := os.Link(claimed, path); err != nil {
+		logger.WithError(err).Debug("unable to restore the login lock of a live login")
+	}
+	os.Remove(claimed)
+}
+
+// Release remove the lock file, letting the next login in, releasing it again does nothing
+func (l *Lock) Release() (err error) {
+	l.once.Do(func() {
+		close(l.done)
+		if rerr := os.Remove(l.filename); rerr != nil && !os.IsNotExist(rerr) {
+			err = errors.Wrap(rerr, "error releasing login lock")
+		}
+	})
+	return err
+}
+
+// refresh touch the lock file until it is released, so a login waiting long for an MFA approval isn't taken for
+// a dead one
+func (l *Lock) refresh(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			if err := os.Chtimes(l.filename, now, now); err != nil {
+				logger.WithError(err).Debug("unable to refresh login lock")
+			}
+		}
+	}
+}
+
+// stale whether the lock file was left over, its login no longer runs or stopped touching it
+func stale(path string, info os.FileInfo) bool {
+	if time.Since(info.ModTime()) > staleAfter {
+		return true
+	}
+
+	pid, err := strconv.Atoi(holder(path))
+	if err != nil || pid <= 0 {
+		// being written, or not written by a login
+		return false
+	}
+	return !processAlive(pid)
+}
+
+// Holder the process id of the login holding the lock stored in filename, DefaultPath is used if empty, false when no
+// login is in progress or the lock was left over by one which died
+func Holder(filename string) (string, bool) {
+	if filename == "" {
+		filename = DefaultPath
+	}
+
+	path, err := homedir.Expand(filename)
+	if err != nil {
+		return "", false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || stale(path, info) {
+		return "", false
+	}
+
+	return holder(path), true
+}
+
+// holder the process id recorded in the lock file
+func holder(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,142 @@
+package loginlock
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "loginlock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "login.lock")
+
+	lock, waited, err := Acquire(path)
+	require.NoError(t, err)
+	require.False(t, waited)
+
+	type result struct {
+		lock   *Lock
+		waited bool
+		err    error
+	}
+	acquired := make(chan result)
+	go func() {
+		second, waited, err := Acquire(path)
+		acquired <- result{second, waited, err}
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired twice")
+	case <-time.After(3 * pollInterval):
+	}
+
+	require.NoError(t, lock.Release())
+	// releasing twice leaves the lock of the other login alone
+	require.NoError(t, lock.Release())
+
+	second := <-acquired
+	require.NoError(t, second.err)
+	require.True(t, second.waited)
+	require.NoError(t, second.lock.Release())
+
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestAcquireStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "loginlock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "login.lock")
+	require.NoError(t, ioutil.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0600))
+
+	old := time.Now().Add(-2 * staleAfter)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	lock, waited, err := Acquire(path)
+	require.NoError(t, err)
+	require.False(t, waited)
+	require.NoError(t, lock.Release())
+}
+
+func TestAcquireDeadHolder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "loginlock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the lock of a login which exited without releasing it is taken at once
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	require.NoError(t, cmd.Run())
+
+	path := filepath.Join(dir, "login.lock")
+	require.NoError(t, ioutil.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0600))
+
+	_, held := Holder(path)
+	require.False(t, held)
+
+	lock, waited, err := Acquire(path)
+	require.NoError(t, err)
+	require.False(t, waited)
+	require.NoError(t, lock.Release())
+}
+
+func TestLockRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "loginlock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(interval time.Duration) { refreshInterval = interval }(refreshInterval)
+	refreshInterval = 10 * time.Millisecond
+
+	path := filepath.Join(dir, "login.lock")
+	lock, _, err := Acquire(path)
+	require.NoError(t, err)
+	defer lock.Release()
+
+	old := time.Now().Add(-2 * staleAfter)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	// the login holding the lock keeps it fresh while it waits for the user
+	require.Eventually(t, func() bool {
+		_, held := Holder(path)
+		return held
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRemoveStaleRace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "loginlock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	require.NoError(t, cmd.Run())
+	dead := strconv.Itoa(cmd.Process.Pid)
+
+	// the stale lock seen by a waiting login was replaced by the one of a live login before it got to remove it
+	path := filepath.Join(dir, "login.lock")
+	live := strconv.Itoa(os.Getpid())
+	require.NoError(t, ioutil.WriteFile(path, []byte(live+"\n"), 0600))
+
+	removeStale(path, dead)
+	require.Equal(t, live, holder(path))
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(dead+"\n"), 0600))
+	removeStale(path, dead)
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
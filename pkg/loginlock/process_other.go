@@ -0,0 +1,19 @@
+// +build !windows
+
+package loginlock
+
+import (
+	"os"
+	"syscall"
+)
+
+// processAlive whether the process with pid still runs, signal 0 only checks it exists, a process of another user
+// is reported alive
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,27 @@
+package loginlock
+
+import (
+	"syscall"
+)
+
+// processQueryLimitedInformation the right to query the exit code of the process of another user
+const processQueryLimitedInformation = 0x1000
+
+// stillActive the exit code of a process still running
+const stillActive = 259
+
+// processAlive whether the process with pid still runs, the handle of an exited process can still be opened as long
+// as another one holds it, so its exit code is checked as well, a process of another user is reported alive
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return err == syscall.ERROR_ACCESS_DENIED
+	}
+	defer syscall.CloseHandle(h)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
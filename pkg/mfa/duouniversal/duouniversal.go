@@ -0,0 +1,272 @@
+package duouniversal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// FactorPush the Duo Push factor
+	FactorPush = "Duo Push"
+	// FactorPasscode the passcode factor, from --mfa-token or prompted
+	FactorPasscode = "Passcode"
+
+	// maxPreludeForms the number of browser detail and health check forms posted before reaching the prompt
+	maxPreludeForms = 3
+
+	preludeForms = "form#plugin_form, form#endpoint-health-form"
+)
+
+var logger = logrus.WithField("pkg", "duouniversal")
+
+// How long the push is waited for and how often its status is checked, unless mfa_timeout and mfa_poll_interval are
+// set
+const (
+	DefaultTimeout      = 2 * time.Minute
+	DefaultPollInterval = 2 * time.Second
+)
+
+// Prompt completes the Duo Universal Prompt, the OIDC redirect replacing the Duo iframe, with the http client of the
+// provider which got redirected to it so the cookies of the IdP are kept for the way back
+type Prompt struct {
+	client   *provider.HTTPClient
+	mfa      string
+	timeout  time.Duration
+	interval time.Duration
+}
+
+// New create a Universal Prompt client, mfa is the MFA setting of the account, PUSH and PASSCODE pick the factor, a
+// push is waited for timeout and its status checked every interval
+func New(client *provider.HTTPClient, mfa string, timeout, interval time.Duration) *Prompt {
+	return &Prompt{client: client, mfa: mfa, timeout: timeout, interval: interval}
+}
+
+// IsPrompt whether the page is served by the Universal Prompt, which lives under /frame/ of the Duo API hostname
+func IsPrompt(u *url.URL) bool {
+	return u != nil && strings.HasPrefix(u.Path, "/frame/")
+}
+
+// Start follow the OIDC authorization URL of Duo given by the IdP, then complete the prompt it redirects to
+func (p *Prompt) Start(authorizeURL string, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	res, err := p.client.Get(authorizeURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving Duo universal prompt")
+	}
+
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build document from response")
+	}
+
+	if !IsPrompt(doc.Url) {
+		return nil, fmt.Errorf("Duo did not redirect to the universal prompt but to %s", doc.Url.String())
+	}
+
+	return p.Complete(doc, loginDetails)
+}
+
+// Complete drive the prompt from its first page, returning the response of the OIDC exit back to the IdP
+func (p *Prompt) Complete(doc *goquery.Document, loginDetails *creds.LoginDetails) (*http.Response, error) {
+
+	// the frameless prompt posts the browser details, and the endpoint health check when the Duo policy requires
+	// one, before redirecting to the prompt itself
+	for i := 0; i < maxPreludeForms && doc.Find(preludeForms).Size() > 0; i++ {
+		res, err := page.SubmitForm(p.client, doc, preludeForms, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error submitting universal prompt form")
+		}
+		doc, err = goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to build document from response")
+		}
+	}
+
+	if msg := strings.TrimSpace(doc.Find(".health-check-error, #endpoint-health-error").First().Text()); msg != "" {
+		return nil, fmt.Errorf("Duo endpoint health check failed: %s", msg)
+	}
+
+	sid := doc.Url.Query().Get("sid")
+	if sid == "" {
+		return nil, fmt.Errorf("unable to locate the Duo session id in %s", doc.Url.String())
+	}
+	xsrf, _ := doc.Find("input[name=\"_xsrf\"]").Attr("value")
+	base := fmt.Sprintf("%s://%s", doc.Url.Scheme, doc.Url.Host)
+
+	data, err := p.getJSON(fmt.Sprintf("%s/frame/v4/auth/prompt/data?post_auth_action=OIDC_EXIT&sid=%s", base, url.QueryEscape(sid)))
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving universal prompt data")
+	}
+
+	device := selectDevice(data)
+	factor := p.resolveFactor(loginDetails)
+
+	logger.WithField("device", device).WithField("factor", factor).Debug("universal prompt")
+
+	promptForm := url.Values{}
+	promptForm.Set("sid", sid)
+	promptForm.Set("device", device)
+	promptForm.Set("factor", factor)
+	promptForm.Set("postAuthDestination", "OIDC_EXIT")
+	promptForm.Set("browser_features", "{}")
+	if factor == FactorPasscode {
+		token := loginDetails.MFAToken
+		if token == "" {
+			token = prompter.StringRequired("Enter passcode")
+		}
+		promptForm.Set("passcode", token)
+	}
+
+	prompt, err := p.postJSON(base+"/frame/v4/prompt", promptForm)
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting Duo authentication")
+	}
+
+	txid := gjson.Get(prompt, "response.txid").String()
+	if txid == "" {
+		return nil, fmt.Errorf("Duo prompt did not return a transaction id")
+	}
+
+	if factor == FactorPush {
+		log.Println("Waiting for approval, please check your phone...")
+	}
+
+	err = p.waitForApproval(base, sid, txid)
+	if err != nil {
+		return nil, err
+	}
+
+	exitForm := url.Values{}
+	exitForm.Set("sid", sid)
+	exitForm.Set("txid", txid)
+	exitForm.Set("factor", factor)
+	exitForm.Set("device_key", device)
+	exitForm.Set("_xsrf", xsrf)
+	exitForm.Set("dampen_choice", "true")
+
+	req, err := http.NewRequest("POST", base+"/frame/v4/oidc/exit", strings.NewReader(exitForm.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building universal prompt exit request")
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	return p.client.Do(req)
+}
+
+// selectDevice the device the factor is sent to, prompted for when the user has several, the first phone of older
+// accounts without a key otherwise
+func selectDevice(data string) string {
+	phones := gjson.Get(data, "response.phones").Array()
+
+	switch len(phones) {
+	case 0:
+		return "phone1"
+	case 1:
+		return phones[0].Get("key").String()
+	}
+
+	labels := []string{}
+	for _, phone := range phones {
+		label := phone.Get("name").String()
+		if number := phone.Get("end_of_number").String(); number != "" {
+			label = fmt.Sprintf("%s (ending in %s)", label, number)
+		}
+		labels = append(labels, label)
+	}
+
+	return phones[prompter.Choose("Select a Duo device", labels)].Get("key").String()
+}
+
+// resolveFactor the factor to use, from the MFA setting, --duo-mfa-option or a prompt
+func (p *Prompt) resolveFactor(loginDetails *creds.LoginDetails) string {
+	switch p.mfa {
+	case "PUSH":
+		return FactorPush
+	case "PASSCODE":
+		return FactorPasscode
+	}
+
+	if loginDetails.DuoMFAOption != "" {
+		return loginDetails.DuoMFAOption
+	}
+
+	options := []string{FactorPush, FactorPasscode}
+	return options[prompter.Choose("Select a DUO MFA Option", options)]
+}
+
+func (p *Prompt) waitForApproval(base, sid, txid string) error {
+	statusForm := url.Values{}
+	statusForm.Set("sid", sid)
+	statusForm.Set("txid", txid)
+
+	deadline := time.Now().Add(p.timeout)
+	for time.Now().Before(deadline) {
+		status, err := p.postJSON(base+"/frame/v4/status", statusForm)
+		if err != nil {
+			return errors.Wrap(err, "error retrieving Duo authentication status")
+		}
+
+		switch gjson.Get(status, "response.status_code").String() {
+		case "allow":
+			return nil
+		case "deny", "timeout", "fraud":
+			return fmt.Errorf("Duo authentication failed: %s", gjson.Get(status, "response.reason").String())
+		}
+
+		if err := p.client.Sleep(p.interval); err != nil {
+			return errors.Wrap(err, "error waiting for the Duo approval")
+		}
+	}
+
+	return fmt.Errorf("Duo authentication was not approved in time")
+}
+
+func (p *Prompt) getJSON(location string) (string, error) {
+	req, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return "", err
+	}
+	return p.doJSON(req)
+}
+
+func (p *Prompt) postJSON(location string, values url.Values) (string, error) {
+	req, err := http.NewRequest("POST", location, strings.NewReader(values.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return p.doJSON(req)
+}
+
+func (p *Prompt) doJSON(req *http.Request) (string, error) {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	resp := string(body)
+	if stat := gjson.Get(resp, "stat").String(); stat != "OK" {
+		return "", fmt.Errorf("Duo returned %s: %s", stat, gjson.Get(resp, "message").String())
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,229 @@
+package duouniversal
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStart(t *testing.T) {
+	pluginPage, err := ioutil.ReadFile("example/plugin.html")
+	require.Nil(t, err)
+	healthPage, err := ioutil.ReadFile("example/health.html")
+	require.Nil(t, err)
+	promptPage, err := ioutil.ReadFile("example/prompt.html")
+	require.Nil(t, err)
+
+	statuses := []string{"pushed", "pushed", "allow"}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/oauth/v1/authorize":
+			http.Redirect(w, r, "/frame/frameless/v4/auth?sid=session-1&tx=frameless-tx", http.StatusFound)
+		case "/frame/frameless/v4/auth":
+			if r.Method == "GET" {
+				w.Write(pluginPage)
+				return
+			}
+			require.Equal(t, "frameless-tx", r.PostForm.Get("tx"))
+			w.Write(healthPage)
+		case "/frame/v4/auth/health_check":
+			require.Equal(t, "skipped", r.PostForm.Get("health_check_result"))
+			http.Redirect(w, r, "/frame/v4/auth/prompt?sid=session-1", http.StatusFound)
+		case "/frame/v4/auth/prompt":
+			w.Write(promptPage)
+		case "/frame/v4/auth/prompt/data":
+			require.Equal(t, "OIDC_EXIT", r.URL.Query().Get("post_auth_action"))
+			w.Write([]byte(`{"stat":"OK","response":{"phones":[{"key":"DPXXXXXXXX","name":"iPhone"}]}}`))
+		case "/frame/v4/prompt":
+			require.Equal(t, FactorPush, r.PostForm.Get("factor"))
+			require.Equal(t, "DPXXXXXXXX", r.PostForm.Get("device"))
+			w.Write([]byte(`{"stat":"OK","response":{"txid":"tx-1"}}`))
+		case "/frame/v4/status":
+			w.Write([]byte(`{"stat":"OK","response":{"status_code":"` + statuses[0] + `"}}`))
+			statuses = statuses[1:]
+		case "/frame/v4/oidc/exit":
+			require.Equal(t, "prompt-xsrf-token", r.PostForm.Get("_xsrf"))
+			require.Equal(t, "tx-1", r.PostForm.Get("txid"))
+			http.Redirect(w, r, "/idp/callback?state=state-1&duo_code=code-"+r.PostForm.Get("device_key"), http.StatusFound)
+		case "/idp/callback":
+			w.Write([]byte(r.URL.Query().Get("duo_code")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := provider.NewHTTPClient(http.DefaultTransport, &provider.HTTPClientOptions{})
+	require.Nil(t, err)
+
+	res, err := New(client, "PUSH", DefaultTimeout, 0).Start(ts.URL+"/oauth/v1/authorize?client_id=DIXXXXXXXX", &creds.LoginDetails{})
+	require.Nil(t, err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.Equal(t, "/idp/callback", res.Request.URL.Path)
+	require.Equal(t, "code-DPXXXXXXXX", string(body))
+}
+
+func TestCompleteDeviceSelection(t *testing.T) {
+	pluginPage, err := ioutil.ReadFile("example/plugin.html")
+	require.Nil(t, err)
+	healthPage, err := ioutil.ReadFile("example/health.html")
+	require.Nil(t, err)
+	promptPage, err := ioutil.ReadFile("example/prompt.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/frame/frameless/v4/auth":
+			if r.Method == "GET" {
+				w.Write(pluginPage)
+				return
+			}
+			w.Write(healthPage)
+		case "/frame/v4/auth/health_check":
+			http.Redirect(w, r, "/frame/v4/auth/prompt?sid=session-1", http.StatusFound)
+		case "/frame/v4/auth/prompt":
+			w.Write(promptPage)
+		case "/frame/v4/auth/prompt/data":
+			w.Write([]byte(`{"stat":"OK","response":{"phones":[{"key":"DPPHONE","name":"iPhone","end_of_number":"1234"},{"key":"DPTOKEN","name":"YubiKey"}]}}`))
+		case "/frame/v4/prompt":
+			require.Equal(t, FactorPasscode, r.PostForm.Get("factor"))
+			require.Equal(t, "123456", r.PostForm.Get("passcode"))
+			w.Write([]byte(`{"stat":"OK","response":{"txid":"tx-1","device":"` + r.PostForm.Get("device") + `"}}`))
+		case "/frame/v4/status":
+			w.Write([]byte(`{"stat":"OK","response":{"status_code":"allow"}}`))
+		case "/frame/v4/oidc/exit":
+			http.Redirect(w, r, "/idp/callback?state=state-1&duo_code=code-"+r.PostForm.Get("device_key"), http.StatusFound)
+		case "/idp/callback":
+			w.Write([]byte(r.URL.Query().Get("duo_code")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("Choose", "Select a Duo device", []string{"iPhone (ending in 1234)", "YubiKey"}).Return(1)
+
+	client, err := provider.NewHTTPClient(http.DefaultTransport, &provider.HTTPClientOptions{})
+	require.Nil(t, err)
+
+	res, err := client.Get(ts.URL + "/frame/frameless/v4/auth?sid=session-1&tx=frameless-tx")
+	require.Nil(t, err)
+	doc, err := goquery.NewDocumentFromResponse(res)
+	require.Nil(t, err)
+	require.True(t, IsPrompt(doc.Url))
+
+	res, err = New(client, "PASSCODE", DefaultTimeout, 0).Complete(doc, &creds.LoginDetails{MFAToken: "123456"})
+	require.Nil(t, err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.Equal(t, "code-DPTOKEN", string(body))
+	pr.Mock.AssertExpectations(t)
+}
+
+func TestCompleteDenied(t *testing.T) {
+	pluginPage, err := ioutil.ReadFile("example/plugin.html")
+	require.Nil(t, err)
+	healthPage, err := ioutil.ReadFile("example/health.html")
+	require.Nil(t, err)
+	promptPage, err := ioutil.ReadFile("example/prompt.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/v1/authorize":
+			http.Redirect(w, r, "/frame/frameless/v4/auth?sid=session-1&tx=frameless-tx", http.StatusFound)
+		case "/frame/frameless/v4/auth":
+			if r.Method == "GET" {
+				w.Write(pluginPage)
+				return
+			}
+			w.Write(healthPage)
+		case "/frame/v4/auth/health_check":
+			http.Redirect(w, r, "/frame/v4/auth/prompt?sid=session-1", http.StatusFound)
+		case "/frame/v4/auth/prompt":
+			w.Write(promptPage)
+		case "/frame/v4/auth/prompt/data":
+			w.Write([]byte(`{"stat":"OK","response":{"phones":[]}}`))
+		case "/frame/v4/prompt":
+			w.Write([]byte(`{"stat":"OK","response":{"txid":"tx-1"}}`))
+		case "/frame/v4/status":
+			w.Write([]byte(`{"stat":"OK","response":{"status_code":"deny","reason":"User declined"}}`))
+		case "/idp/callback":
+			w.Write([]byte(r.URL.Query().Get("duo_code")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := provider.NewHTTPClient(http.DefaultTransport, &provider.HTTPClientOptions{})
+	require.Nil(t, err)
+
+	_, err = New(client, "PUSH", DefaultTimeout, 0).Start(ts.URL+"/oauth/v1/authorize", &creds.LoginDetails{})
+	require.EqualError(t, err, "Duo authentication failed: User declined")
+
+	_, err = New(client, "PUSH", DefaultTimeout, 0).Start(ts.URL+"/idp/callback", &creds.LoginDetails{})
+	require.EqualError(t, err, "Duo did not redirect to the universal prompt but to "+ts.URL+"/idp/callback")
+}
+
+func TestCompleteTimeout(t *testing.T) {
+	pluginPage, err := ioutil.ReadFile("example/plugin.html")
+	require.Nil(t, err)
+	healthPage, err := ioutil.ReadFile("example/health.html")
+	require.Nil(t, err)
+	promptPage, err := ioutil.ReadFile("example/prompt.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/v1/authorize":
+			http.Redirect(w, r, "/frame/frameless/v4/auth?sid=session-1&tx=frameless-tx", http.StatusFound)
+		case "/frame/frameless/v4/auth":
+			if r.Method == "GET" {
+				w.Write(pluginPage)
+				return
+			}
+			w.Write(healthPage)
+		case "/frame/v4/auth/health_check":
+			http.Redirect(w, r, "/frame/v4/auth/prompt?sid=session-1", http.StatusFound)
+		case "/frame/v4/auth/prompt":
+			w.Write(promptPage)
+		case "/frame/v4/auth/prompt/data":
+			w.Write([]byte(`{"stat":"OK","response":{"phones":[]}}`))
+		case "/frame/v4/prompt":
+			w.Write([]byte(`{"stat":"OK","response":{"txid":"tx-1"}}`))
+		case "/frame/v4/status":
+			w.Write([]byte(`{"stat":"OK","response":{"status_code":"pushed"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := provider.NewHTTPClient(http.DefaultTransport, &provider.HTTPClientOptions{})
+	require.Nil(t, err)
+
+	_, err = New(client, "PUSH", 50*time.Millisecond, 10*time.Millisecond).Start(ts.URL+"/oauth/v1/authorize", &creds.LoginDetails{})
+	require.EqualError(t, err, "Duo authentication was not approved in time")
+}
@@ -0,0 +1,208 @@
+package pingid
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// Statuses of the PingID approval
+const (
+	// StatusWaiting the approval is still pending on the device
+	StatusWaiting = "ASYNC_AUTH_WAIT"
+	// StatusOK the sign in was approved
+	StatusOK = "OK"
+	// StatusDeviceClaimTimeout nobody answered on the device
+	StatusDeviceClaimTimeout = "DEVICE_CLAIM_TIMEOUT"
+	// StatusTimeout the approval expired
+	StatusTimeout = "TIMEOUT"
+)
+
+// How long the approval is waited for and how often its status is checked, unless mfa_timeout and
+// mfa_poll_interval are set, PingID expires it well before the timeout
+const (
+	DefaultTimeout      = 10 * time.Minute
+	DefaultPollInterval = 3 * time.Second
+)
+
+// numberSelectors where the pages of PingID display the number to select in the app when number matching is enabled
+var numberSelectors = []string{
+	".number-matching .number",
+	".number-matching-number",
+	"#number-matching-number",
+	"[data-number-matching]",
+	".number-matching",
+}
+
+var logger = logrus.WithField("pkg", "pingid")
+
+// Doer the http client of the provider which reached the PingID page
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// sleeper a client whose waits end with the authentication, like the HTTPClient of the providers
+type sleeper interface {
+	Sleep(d time.Duration) error
+}
+
+// sleep wait interval with the client if it can, a plain sleep otherwise
+func sleep(client Doer, interval time.Duration) error {
+	if s, ok := client.(sleeper); ok {
+		return s.Sleep(interval)
+	}
+	time.Sleep(interval)
+	return nil
+}
+
+// NumberMatching the number the user has to select in the PingID app to approve the sign in, empty for plain swipes
+func NumberMatching(doc *goquery.Document) string {
+	for _, selector := range numberSelectors {
+		s := doc.Find(selector).First()
+		if s.Length() == 0 {
+			continue
+		}
+		value, ok := s.Attr("data-number-matching")
+		if !ok {
+			value = s.Text()
+		}
+		if number := digits(value); number != "" {
+			return number
+		}
+	}
+	return ""
+}
+
+func digits(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+}
+
+// IsDeviceSelection whether the page lets the user choose among the devices paired with PingID
+func IsDeviceSelection(doc *goquery.Document) bool {
+	return doc.Has("form[name=\"device-form\"]").Size() == 1
+}
+
+// SelectDevice build the request of the device selection page choosing the device named preferred, the mfa_device
+// of the account, or prompted for when several devices are paired
+func SelectDevice(doc *goquery.Document, preferred string) (*http.Request, error) {
+	var ids, names []string
+	doc.Find("ul.device-list > li").Each(func(_ int, s *goquery.Selection) {
+		id, _ := s.Attr("data-id")
+		name := strings.TrimSpace(s.Find("div.device-name").First().Text())
+
+		logger.WithField("device name", name).WithField("device id", id).Debug("Select Device")
+		ids = append(ids, id)
+		names = append(names, name)
+	})
+
+	device, err := prompter.ChooseDevice("PingID", preferred, names)
+	if err != nil {
+		return nil, err
+	}
+
+	form, err := page.NewFormFromDocument(doc, "form[name=\"device-form\"]")
+	if err != nil {
+		return nil, errors.Wrap(err, "error extracting select device form")
+	}
+	form.Values.Set("deviceId", ids[device])
+
+	if doc.Url != nil {
+		action, err := url.Parse(form.URL)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing select device form action")
+		}
+		form.URL = doc.Url.ResolveReference(action).String()
+	}
+
+	logger.WithField("value", form.Values.Encode()).Debug("Select Device")
+	return form.BuildRequest()
+}
+
+// WaitForApproval tell the user how to approve the sign in on the device, poll the status form of the page until the
+// approval is answered or timeout expires, checking every interval, then build the request of the response form
+// carrying the status
+func WaitForApproval(client Doer, doc *goquery.Document, timeout, interval time.Duration) (*http.Request, error) {
+	form, err := page.NewFormFromDocument(doc, "#form1")
+	if err != nil {
+		return nil, errors.Wrap(err, "error extracting swipe status form")
+	}
+
+	device := strings.TrimSpace(doc.Find(".device-name").First().Text())
+	if device == "" {
+		device = "your device"
+	}
+	if number := NumberMatching(doc); number != "" {
+		log.Printf("Select %s in the PingID app on %s to approve the sign in", number, device)
+	} else {
+		log.Printf("Approve the sign in with the PingID app on %s", device)
+	}
+
+	// poll status. request must specifically be a GET
+	form.Method = "GET"
+
+	status := StatusWaiting
+	deadline := time.Now().Add(timeout)
+	for status == StatusWaiting {
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for the PingID approval")
+		}
+
+		if err := sleep(client, interval); err != nil {
+			return nil, errors.Wrap(err, "error waiting for the PingID approval")
+		}
+
+		req, err := form.BuildRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "error polling swipe status")
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing body from swipe status response")
+		}
+
+		status = gjson.Get(string(body), "status").String()
+		logger.WithField("status", status).Debug("swipe status")
+		if status == "" {
+			status = StatusWaiting
+		}
+	}
+
+	switch status {
+	case StatusOK:
+	case StatusDeviceClaimTimeout, StatusTimeout:
+		log.Println("The PingID approval timed out")
+	default:
+		log.Printf("The PingID approval ended with %s", status)
+	}
+
+	// now build a request for getting response of MFA
+	form, err = page.NewFormFromDocument(doc, "#reponseView")
+	if err != nil {
+		return nil, errors.Wrap(err, "error extracting swipe response form")
+	}
+	form.Values.Set("status", status)
+
+	return form.BuildRequest()
+}
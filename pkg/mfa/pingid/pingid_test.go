@@ -0,0 +1,107 @@
+package pingid
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/require"
+)
+
+func loadPage(t *testing.T, serverURL string) *goquery.Document {
+	data, err := ioutil.ReadFile("example/numbermatching.html")
+	require.Nil(t, err)
+
+	html := strings.Replace(string(data), "https://authenticator.pingone.com", serverURL, -1)
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	require.Nil(t, err)
+	return doc
+}
+
+func TestNumberMatching(t *testing.T) {
+	require.Equal(t, "47", NumberMatching(loadPage(t, "")))
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<div data-number-matching="12"></div>`))
+	require.Nil(t, err)
+	require.Equal(t, "12", NumberMatching(doc))
+
+	doc, err = goquery.NewDocumentFromReader(strings.NewReader(`<div class="device-name">iPhone X</div>`))
+	require.Nil(t, err)
+	require.Equal(t, "", NumberMatching(doc))
+}
+
+func TestWaitForApproval(t *testing.T) {
+	statuses := []string{`{"status":"ASYNC_AUTH_WAIT"}`, `{}`, `{"status":"OK"}`}
+	checks := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "GET", r.Method)
+		require.Equal(t, "/pingid/ppm/auth/status", r.URL.Path)
+		w.Write([]byte(statuses[checks]))
+		checks++
+	}))
+	defer ts.Close()
+
+	req, err := WaitForApproval(ts.Client(), loadPage(t, ts.URL), DefaultTimeout, 0)
+	require.Nil(t, err)
+	require.Equal(t, 3, checks)
+	require.Equal(t, "GET", req.Method)
+	require.Equal(t, ts.URL+"/pingid/ppm/auth/response", req.URL.String())
+
+	body, err := ioutil.ReadAll(req.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), "status=OK")
+	require.Contains(t, string(body), "csrfToken=8d3c1a3e-2f1e-4b8e-9a64-1d2b1c1f4e55")
+}
+
+func TestWaitForApprovalTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"DEVICE_CLAIM_TIMEOUT"}`))
+	}))
+	defer ts.Close()
+
+	req, err := WaitForApproval(ts.Client(), loadPage(t, ts.URL), DefaultTimeout, 0)
+	require.Nil(t, err)
+
+	body, err := ioutil.ReadAll(req.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), "status=DEVICE_CLAIM_TIMEOUT")
+}
+
+func TestWaitForApprovalMFATimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ASYNC_AUTH_WAIT"}`))
+	}))
+	defer ts.Close()
+
+	_, err := WaitForApproval(ts.Client(), loadPage(t, ts.URL), 20*time.Millisecond, 5*time.Millisecond)
+	require.EqualError(t, err, "timed out waiting for the PingID approval")
+}
+
+func TestSelectDevice(t *testing.T) {
+	data, err := ioutil.ReadFile("example/selectdevice.html")
+	require.Nil(t, err)
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(data)))
+	require.Nil(t, err)
+	doc.Url, _ = url.Parse("https://authenticator.pingone.com/pingid/ppm/auth")
+	require.True(t, IsDeviceSelection(doc))
+
+	req, err := SelectDevice(doc, "android")
+	require.Nil(t, err)
+	require.Equal(t, "https://authenticator.pingone.com/pingid/ppm/devices", req.URL.String())
+
+	body, err := ioutil.ReadAll(req.Body)
+	require.Nil(t, err)
+	values, err := url.ParseQuery(string(body))
+	require.Nil(t, err)
+	require.Equal(t, "3964291169487703000", values.Get("deviceId"))
+
+	_, err = SelectDevice(doc, "Pixel")
+	require.EqualError(t, err, "no PingID device matches mfa_device Pixel, enrolled: iPhone, Android")
+}
@@ -0,0 +1,230 @@
+package webauthn
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	u2fhost "github.com/marshallbrekka/go-u2fhost"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultTimeout how long the security key is waited for to be touched
+const DefaultTimeout = 30 * time.Second
+
+// ErrNoDevice returned when no security key is plugged in
+var ErrNoDevice = errors.New("no security key found, the key might not be plugged in")
+
+// pollInterval how often the security keys are asked for the assertion while waiting for a touch
+var pollInterval = 250 * time.Millisecond
+
+var logger = logrus.WithField("mfa", "webauthn")
+
+// Request a WebAuthn assertion request of the IdP
+type Request struct {
+	// RPID the relying party ID the credentials are scoped to, usually the host of the IdP
+	RPID string
+	// Origin the origin the client data is bound to, https:// followed by the RPID when empty
+	Origin string
+	// Challenge the challenge of the IdP, base64url encoded as it appears in the client data
+	Challenge string
+	// CredentialIDs the credentials the IdP allows, base64 or base64url encoded
+	CredentialIDs []string
+	// Timeout how long to wait for a security key to be touched, DefaultTimeout when zero
+	Timeout time.Duration
+	// UserVerification the user verification the IdP asks for, required can't be satisfied without a PIN
+	UserVerification string
+}
+
+// NotRegisteredError returned when none of the security keys plugged in holds an allowed credential of the relying party
+type NotRegisteredError struct {
+	RPID string
+}
+
+func (e *NotRegisteredError) Error() string {
+	return fmt.Sprintf("none of the security keys plugged in is registered for %s", e.RPID)
+}
+
+// Assertion the signed assertion of the security key, each provider encodes it as its IdP expects
+type Assertion struct {
+	// CredentialID the allowed credential the security key signed with, as found in Request.CredentialIDs
+	CredentialID      string
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+}
+
+// DeviceFinder finds the security keys plugged in, mocked in tests
+type DeviceFinder interface {
+	// FindDevices return the security keys, opened, ErrNoDevice when there are none
+	FindDevices() ([]u2fhost.Device, error)
+}
+
+// HIDDeviceFinder finds the USB security keys through HID
+type HIDDeviceFinder struct{}
+
+// FindDevices open every security key plugged in
+func (HIDDeviceFinder) FindDevices() ([]u2fhost.Device, error) {
+	var devices []u2fhost.Device
+	var err error
+
+	for _, device := range u2fhost.Devices() {
+		if err = device.Open(); err != nil {
+			device.Close()
+			continue
+		}
+		devices = append(devices, device)
+	}
+
+	if len(devices) == 0 {
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open security key")
+		}
+		return nil, ErrNoDevice
+	}
+
+	return devices, nil
+}
+
+// Authenticator gets WebAuthn assertions signed by the security keys, without a browser
+type Authenticator struct {
+	finder DeviceFinder
+}
+
+// New create an Authenticator using the USB security keys
+func New() *Authenticator {
+	return NewWithFinder(HIDDeviceFinder{})
+}
+
+// NewWithFinder create an Authenticator using the security keys of the finder
+func NewWithFinder(finder DeviceFinder) *Authenticator {
+	return &Authenticator{finder: finder}
+}
+
+// Assert ask the security keys to sign the challenge with one of the allowed credentials, waiting for the user to
+// touch the key. The keys are spoken to with CTAP1, which every FIDO2 key supports for the credentials it holds
+// outside of resident keys, so user verification with a PIN isn't possible
+func (a *Authenticator) Assert(req *Request) (*Assertion, error) {
+	if len(req.CredentialIDs) == 0 {
+		return nil, errors.New("the IdP allowed no security key credential, passkeys without an allowed credential aren't supported")
+	}
+	if req.UserVerification == "required" {
+		return nil, errors.New("the IdP requires user verification, security keys can only be used when the user verification is preferred or discouraged")
+	}
+
+	origin := req.Origin
+	if origin == "" {
+		origin = "https://" + req.RPID
+	}
+
+	timeout := req.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	keyHandles := make([]string, len(req.CredentialIDs))
+	for i, id := range req.CredentialIDs {
+		keyHandle, err := toKeyHandle(id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid credential ID %s", id)
+		}
+		keyHandles[i] = keyHandle
+	}
+
+	devices, err := a.finder.FindDevices()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, device := range devices {
+			device.Close()
+		}
+	}()
+
+	// a credential is only held by one of the keys, the others refuse its key handle
+	refused := map[int]bool{}
+	prompted := false
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		for d, device := range devices {
+			for c, keyHandle := range keyHandles {
+				pair := d*len(keyHandles) + c
+				if refused[pair] {
+					continue
+				}
+
+				res, err := device.Authenticate(&u2fhost.AuthenticateRequest{
+					Challenge: req.Challenge,
+					AppId:     req.RPID,
+					Facet:     origin,
+					KeyHandle: keyHandle,
+					WebAuthn:  true,
+				})
+				switch err.(type) {
+				case nil:
+					log.Println("Security key touched, proceeding with authentication")
+					return newAssertion(req.CredentialIDs[c], res)
+				case *u2fhost.TestOfUserPresenceRequiredError, u2fhost.TestOfUserPresenceRequiredError:
+					if !prompted {
+						log.Println("Touch the flashing security key to authenticate...")
+						prompted = true
+					}
+				case *u2fhost.BadKeyHandleError, u2fhost.BadKeyHandleError:
+					logger.WithField("credential", req.CredentialIDs[c]).Debug("credential not on the security key")
+					refused[pair] = true
+				default:
+					return nil, errors.Wrap(err, "error signing with the security key")
+				}
+			}
+		}
+
+		if len(refused) == len(devices)*len(keyHandles) {
+			return nil, &NotRegisteredError{RPID: req.RPID}
+		}
+
+		time.Sleep(pollInterval)
+	}
+
+	return nil, fmt.Errorf("no security key was touched within %s", timeout)
+}
+
+func newAssertion(credentialID string, res *u2fhost.AuthenticateResponse) (*Assertion, error) {
+	clientData, err := base64.RawURLEncoding.DecodeString(res.ClientData)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding client data")
+	}
+	authenticatorData, err := base64.StdEncoding.DecodeString(res.AuthenticatorData)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding authenticator data")
+	}
+	signature, err := base64.StdEncoding.DecodeString(res.SignatureData)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding signature")
+	}
+
+	return &Assertion{
+		CredentialID:      credentialID,
+		ClientDataJSON:    clientData,
+		AuthenticatorData: authenticatorData,
+		Signature:         signature,
+	}, nil
+}
+
+// toKeyHandle the credential ID in the unpadded base64url encoding of the security key library, IdPs send it in
+// either base64 alphabet
+func toKeyHandle(id string) (string, error) {
+	id = strings.TrimRight(id, "=")
+	if !strings.ContainsAny(id, "+/") {
+		return id, nil
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(id)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
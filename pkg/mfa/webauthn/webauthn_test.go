@@ -0,0 +1,81 @@
+package webauthn
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	u2fhost "github.com/marshallbrekka/go-u2fhost"
+	"github.com/stretchr/testify/require"
+)
+
+type mockFinder struct {
+	devices []u2fhost.Device
+}
+
+func (m *mockFinder) FindDevices() ([]u2fhost.Device, error) {
+	if len(m.devices) == 0 {
+		return nil, ErrNoDevice
+	}
+	return m.devices, nil
+}
+
+func authenticateRequest(keyHandle string) *u2fhost.AuthenticateRequest {
+	return &u2fhost.AuthenticateRequest{
+		Challenge: "Y2hhbGxlbmdl",
+		AppId:     "idp.example.com",
+		Facet:     "https://idp.example.com",
+		KeyHandle: keyHandle,
+		WebAuthn:  true,
+	}
+}
+
+func TestAssert(t *testing.T) {
+	pollInterval = 0
+
+	// the first key only holds the second credential, which needs a touch
+	first := &mocks.U2FDevice{}
+	first.On("Authenticate", authenticateRequest("a2V5LTE")).Return(nil, &u2fhost.BadKeyHandleError{})
+	first.On("Authenticate", authenticateRequest("a2V5LT_-")).Return(nil, &u2fhost.TestOfUserPresenceRequiredError{}).Once()
+	first.On("Authenticate", authenticateRequest("a2V5LT_-")).Return(&u2fhost.AuthenticateResponse{
+		KeyHandle:         "a2V5LT_-",
+		ClientData:        base64.RawURLEncoding.EncodeToString([]byte(`{"type":"webauthn.get"}`)),
+		AuthenticatorData: base64.StdEncoding.EncodeToString([]byte("authenticator data")),
+		SignatureData:     base64.StdEncoding.EncodeToString([]byte("signature")),
+	}, nil)
+	first.On("Close").Return()
+
+	assertion, err := NewWithFinder(&mockFinder{[]u2fhost.Device{first}}).Assert(&Request{
+		RPID:          "idp.example.com",
+		Challenge:     "Y2hhbGxlbmdl",
+		CredentialIDs: []string{"a2V5LTE=", "a2V5LT/+"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, "a2V5LT/+", assertion.CredentialID)
+	require.Equal(t, `{"type":"webauthn.get"}`, string(assertion.ClientDataJSON))
+	require.Equal(t, "authenticator data", string(assertion.AuthenticatorData))
+	require.Equal(t, "signature", string(assertion.Signature))
+	first.AssertCalled(t, "Close")
+}
+
+func TestAssertErrors(t *testing.T) {
+	pollInterval = 0
+
+	request := &Request{RPID: "idp.example.com", Challenge: "Y2hhbGxlbmdl", CredentialIDs: []string{"a2V5LTE"}}
+
+	_, err := NewWithFinder(&mockFinder{}).Assert(request)
+	require.Equal(t, ErrNoDevice, err)
+
+	device := &mocks.U2FDevice{}
+	device.On("Authenticate", authenticateRequest("a2V5LTE")).Return(nil, &u2fhost.BadKeyHandleError{})
+	device.On("Close").Return()
+
+	_, err = NewWithFinder(&mockFinder{[]u2fhost.Device{device}}).Assert(request)
+	require.EqualError(t, err, "none of the security keys plugged in is registered for idp.example.com")
+
+	_, err = NewWithFinder(&mockFinder{[]u2fhost.Device{device}}).Assert(&Request{RPID: "idp.example.com"})
+	require.EqualError(t, err, "the IdP allowed no security key credential, passkeys without an allowed credential aren't supported")
+
+	_, err = NewWithFinder(&mockFinder{[]u2fhost.Device{device}}).Assert(&Request{RPID: "idp.example.com", CredentialIDs: []string{"a2V5LTE"}, UserVerification: "required"})
+	require.EqualError(t, err, "the IdP requires user verification, security keys can only be used when the user verification is preferred or discouraged")
+}
@@ -0,0 +1,129 @@
+package yubikey
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// yubicoVendorID the USB vendor ID of Yubico as the uevent of the hidraw devices gives it, HID_ID=0003:00001050:...
+const yubicoVendorID = ":00001050:"
+
+// keyboardDescriptor the start of the report descriptor of a keyboard, Usage Page Generic Desktop and Usage Keyboard
+var keyboardDescriptor = []byte{0x05, 0x01, 0x09, 0x06}
+
+// hidrawClass where the hidraw devices are listed, replaced in tests
+var hidrawClass = "/sys/class/hidraw"
+
+// hidrawDevice a hidraw device, which gets the reports of the interface alongside the input subsystem
+type hidrawDevice struct {
+	f *os.File
+}
+
+// openKeyboard open the hidraw device of the keyboard interface of the first YubiKey
+func openKeyboard() (device, error) {
+	entries, err := ioutil.ReadDir(hidrawClass)
+	if err != nil {
+		return nil, ErrNoDevice
+	}
+
+	for _, entry := range entries {
+		dir := filepath.Join(hidrawClass, entry.Name(), "device")
+
+		uevent, err := ioutil.ReadFile(filepath.Join(dir, "uevent"))
+		if err != nil || !strings.Contains(string(uevent), yubicoVendorID) {
+			continue
+		}
+
+		descriptor, err := ioutil.ReadFile(filepath.Join(dir, "report_descriptor"))
+		if err != nil || !bytes.HasPrefix(descriptor, keyboardDescriptor) {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join("/dev", entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to open the YubiKey keyboard interface, allow the user to read /dev/%s", entry.Name())
+		}
+		logger.WithField("device", entry.Name()).Debug("opened YubiKey keyboard interface")
+
+		return &hidrawDevice{f: f}, nil
+	}
+
+	return nil, ErrNoDevice
+}
+
+func (d *hidrawDevice) ReadReport(timeout time.Duration) ([]byte, error) {
+	// hidraw devices are pollable, the deadline is ignored by kernels where they aren't
+	d.f.SetReadDeadline(time.Now().Add(timeout))
+
+	report := make([]byte, 64)
+	n, err := d.f.Read(report)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading the YubiKey")
+	}
+	return report[:n], nil
+}
+
+func (d *hidrawDevice) Close() error {
+	return d.f.Close()
+}
+
+// quietTerminal turn the echo of the terminal off while the YubiKey types, the returned function discards what it
+// typed there when drain is set and restores the terminal
+func quietTerminal() func(drain bool) {
+	fd := int(os.Stdin.Fd())
+
+	var saved syscall.Termios
+	if err := ioctlTermios(fd, syscall.TCGETS, &saved); err != nil {
+		return func(bool) {}
+	}
+
+	quiet := saved
+	quiet.Lflag &^= syscall.ECHO | syscall.ICANON
+	quiet.Cc[syscall.VMIN] = 0
+	quiet.Cc[syscall.VTIME] = 0
+	if err := ioctlTermios(fd, syscall.TCSETS, &quiet); err != nil {
+		return func(bool) {}
+	}
+
+	return func(drain bool) {
+		if drain {
+			discardLine(fd, drainTimeout)
+		}
+		if err := ioctlTermios(fd, syscall.TCSETS, &saved); err != nil {
+			logger.WithError(err).Debug("unable to restore the terminal")
+		}
+	}
+}
+
+// discardLine read what reaches the terminal until a line was typed or the timeout expires
+func discardLine(fd int, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, 64)
+	for time.Now().Before(deadline) {
+		n, err := syscall.Read(fd, buf)
+		if err != nil {
+			return
+		}
+		if bytes.ContainsAny(buf[:n], "\r\n") {
+			return
+		}
+		if n == 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+}
+
+func ioctlTermios(fd int, req uintptr, termios *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(termios))); errno != 0 {
+		return errno
+	}
+	return nil
+}
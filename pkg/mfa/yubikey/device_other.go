@@ -0,0 +1,13 @@
+// +build !linux
+
+package yubikey
+
+// openKeyboard the keyboard interfaces are held by the system on macOS and Windows, the OTP is prompted for
+func openKeyboard() (device, error) {
+	return nil, ErrNoDevice
+}
+
+// quietTerminal nothing to do as the OTP is never read from the device
+func quietTerminal() func(drain bool) {
+	return func(bool) {}
+}
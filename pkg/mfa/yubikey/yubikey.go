@@ -0,0 +1,145 @@
+package yubikey
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/sirupsen/logrus"
+)
+
+// modhex the alphabet of the Yubico OTP, the keys typing the same characters whatever the keyboard layout
+const modhex = "cbdefghijklnrtuv"
+
+// minOTPLength the length of a Yubico OTP without public ID, 32 modhex characters of ciphertext
+const minOTPLength = 32
+
+// maxOTPLength with the longest public ID, 16 modhex characters
+const maxOTPLength = 48
+
+// ErrNoDevice no YubiKey keyboard interface could be opened
+var ErrNoDevice = errors.New("no readable YubiKey found")
+
+var logger = logrus.WithField("pkg", "yubikey")
+
+// touchTimeout how long to wait for the touch of the YubiKey
+var touchTimeout = 60 * time.Second
+
+// drainTimeout how long to wait for the keystrokes the YubiKey typed in the terminal once the OTP was read
+var drainTimeout = time.Second
+
+// openDevice open the keyboard interface of the YubiKey, replaced in tests
+var openDevice = openKeyboard
+
+// device the keyboard interface of a YubiKey, reading its HID reports
+type device interface {
+	ReadReport(timeout time.Duration) ([]byte, error)
+	Close() error
+}
+
+// OTP the Yubico OTP of the YubiKey, read from its keyboard interface when it can be opened so neither pasting nor
+// the keyboard layout get in the way, otherwise prompted for with the prompt
+func OTP(prompt string) string {
+	otp, err := ReadOTP()
+	if err == nil {
+		return otp
+	}
+	logger.WithError(err).Debug("unable to read the OTP from the YubiKey, prompting for it")
+
+	return prompter.Password(prompt)
+}
+
+// ReadOTP wait for the touch of the YubiKey and read the OTP it types from its keyboard interface. The keystrokes
+// also reaching the terminal aren't echoed and are discarded
+func ReadOTP() (string, error) {
+	dev, err := openDevice()
+	if err != nil {
+		return "", err
+	}
+	defer dev.Close()
+
+	restore := quietTerminal()
+
+	log.Println("Touch your YubiKey")
+
+	otp, err := readKeystrokes(dev, touchTimeout)
+	restore(err == nil)
+	if err != nil {
+		return "", err
+	}
+
+	if !IsOTP(otp) {
+		return "", errors.New("the YubiKey did not type a Yubico OTP")
+	}
+
+	return otp, nil
+}
+
+// IsOTP whether the token looks like a Yubico OTP, an optional public ID followed by 32 modhex characters
+func IsOTP(token string) bool {
+	if len(token) < minOTPLength || len(token) > maxOTPLength {
+		return false
+	}
+	for _, c := range token {
+		if !strings.ContainsRune(modhex, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// readKeystrokes decode the boot keyboard reports of the device until it types Enter
+func readKeystrokes(dev device, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+
+	var typed strings.Builder
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return "", errors.New("timed out waiting for the touch of the YubiKey")
+		}
+
+		report, err := dev.ReadReport(remaining)
+		if err != nil {
+			return "", err
+		}
+
+		c, ok := decodeReport(report)
+		if !ok {
+			continue
+		}
+		if c == '\n' {
+			return typed.String(), nil
+		}
+		typed.WriteRune(c)
+	}
+}
+
+// decodeReport the character a boot keyboard report types, the modifiers byte, a reserved byte then the pressed
+// keys, the reports releasing the keys type nothing
+func decodeReport(report []byte) (rune, bool) {
+	if len(report) < 3 || report[2] == 0 {
+		return 0, false
+	}
+
+	usage := report[2]
+	shift := report[0]&0x22 != 0
+	switch {
+	case usage >= 0x04 && usage <= 0x1d:
+		c := rune('a' + usage - 0x04)
+		if shift {
+			c -= 'a' - 'A'
+		}
+		return c, true
+	case usage >= 0x1e && usage <= 0x26:
+		return rune('1' + usage - 0x1e), true
+	case usage == 0x27:
+		return '0', true
+	case usage == 0x28 || usage == 0x58:
+		return '\n', true
+	}
+
+	return 0, false
+}
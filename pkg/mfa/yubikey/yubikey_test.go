@@ -0,0 +1,90 @@
+package yubikey
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testOTP = "ccccccjlkgjlevhhfrvrdeclhnejbjvdhdgktdglchrk"
+
+// keyUsages the HID usages of the modhex characters
+var keyUsages = map[rune]byte{
+	'c': 0x06, 'b': 0x05, 'd': 0x07, 'e': 0x08, 'f': 0x09, 'g': 0x0a, 'h': 0x0b, 'i': 0x0c,
+	'j': 0x0d, 'k': 0x0e, 'l': 0x0f, 'n': 0x11, 'r': 0x15, 't': 0x17, 'u': 0x18, 'v': 0x19,
+}
+
+// fakeDevice types the OTP as a YubiKey does, each key pressed then released, then Enter
+type fakeDevice struct {
+	reports [][]byte
+	closed  bool
+}
+
+func newFakeDevice(otp string) *fakeDevice {
+	d := &fakeDevice{}
+	for _, c := range otp {
+		d.reports = append(d.reports, []byte{0, 0, keyUsages[c], 0, 0, 0, 0, 0}, make([]byte, 8))
+	}
+	d.reports = append(d.reports, []byte{0, 0, 0x28, 0, 0, 0, 0, 0}, make([]byte, 8))
+	return d
+}
+
+func (d *fakeDevice) ReadReport(timeout time.Duration) ([]byte, error) {
+	if len(d.reports) == 0 {
+		return nil, errors.New("no more reports")
+	}
+	report := d.reports[0]
+	d.reports = d.reports[1:]
+	return report, nil
+}
+
+func (d *fakeDevice) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestReadOTP(t *testing.T) {
+	dev := newFakeDevice(testOTP)
+	openDevice = func() (device, error) { return dev, nil }
+	defer func() { openDevice = openKeyboard }()
+
+	otp, err := ReadOTP()
+	require.Nil(t, err)
+	require.Equal(t, testOTP, otp)
+	require.True(t, dev.closed)
+
+	// a static password isn't an OTP
+	openDevice = func() (device, error) { return newFakeDevice("cbdefghijkl"), nil }
+	_, err = ReadOTP()
+	require.EqualError(t, err, "the YubiKey did not type a Yubico OTP")
+
+	openDevice = func() (device, error) { return nil, ErrNoDevice }
+	_, err = ReadOTP()
+	require.Equal(t, ErrNoDevice, err)
+}
+
+func TestDecodeReport(t *testing.T) {
+	c, ok := decodeReport([]byte{0, 0, 0x04, 0, 0, 0, 0, 0})
+	require.True(t, ok)
+	require.Equal(t, 'a', c)
+
+	c, ok = decodeReport([]byte{0x02, 0, 0x1d, 0, 0, 0, 0, 0})
+	require.True(t, ok)
+	require.Equal(t, 'Z', c)
+
+	c, ok = decodeReport([]byte{0, 0, 0x27, 0, 0, 0, 0, 0})
+	require.True(t, ok)
+	require.Equal(t, '0', c)
+
+	_, ok = decodeReport(make([]byte, 8))
+	require.False(t, ok)
+}
+
+func TestIsOTP(t *testing.T) {
+	require.True(t, IsOTP(testOTP))
+	require.True(t, IsOTP(testOTP[12:]))
+	require.False(t, IsOTP(testOTP[13:]))
+	require.False(t, IsOTP("ccccccjlkgjlevhhfrvrdeclhnejbjvdhdgktdglchra"))
+}
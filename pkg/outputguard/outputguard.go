@@ -0,0 +1,131 @@
+package outputguard
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logrus.WithField("pkg", "outputguard")
+
+// gitCommand the git executable used to check whether a destination is ignored, replaced in tests
+var gitCommand = "git"
+
+// Guard checks a file credentials are about to be written to, returning an error describing why writing there is
+// risky, for example because the file could end up in a commit
+type Guard interface {
+	Check(filename string) error
+}
+
+// GuardFunc adapts a function to the Guard interface
+type GuardFunc func(filename string) error
+
+// Check call the function
+func (f GuardFunc) Check(filename string) error {
+	return f(filename)
+}
+
+var (
+	mu     sync.Mutex
+	guards []Guard
+)
+
+// Register add a guard checking every destination after the git work tree check, builds embedding
+// saml2alibabacloud use it to hook in their own secret scanning
+func Register(g Guard) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	guards = append(guards, g)
+}
+
+// Check run the git work tree check followed by the registered guards, returning the first problem found
+func Check(filename string) error {
+	mu.Lock()
+	chain := append([]Guard{GuardFunc(GitWorkTree)}, guards...)
+	mu.Unlock()
+
+	for _, g := range chain {
+		if err := g.Check(filename); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GitWorkTree refuse a destination inside a git work tree unless the .gitignore rules of the tree ignore it, the
+// destination of a symlink is the one checked
+func GitWorkTree(filename string) error {
+	path, err := resolve(filename)
+	if err != nil {
+		return err
+	}
+
+	root, ok := workTree(filepath.Dir(path))
+	if !ok {
+		return nil
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+
+	err = exec.Command(gitCommand, "-C", root, "check-ignore", "--quiet", "--", rel).Run()
+	if err == nil {
+		logger.WithField("filename", path).WithField("worktree", root).Debug("destination is ignored by git")
+		return nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return fmt.Errorf("%s is inside the git work tree %s and not ignored, credentials written there are easily committed, add it to .gitignore", path, root)
+	}
+
+	return fmt.Errorf("%s is inside the git work tree %s and git could not check it is ignored: %v", path, root, err)
+}
+
+// resolve the absolute path of the file, following a symlink to its destination
+func resolve(filename string) (string, error) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved, nil
+	}
+
+	// a dangling symlink is checked at the destination it is about to create
+	if target, err := os.Readlink(path); err == nil {
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+
+	// the file doesn't exist yet, its directory may still be a symlink
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		return filepath.Join(dir, filepath.Base(path)), nil
+	}
+
+	return path, nil
+}
+
+// workTree the root of the git work tree holding the directory, found by its .git directory or file
+func workTree(dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,70 @@
+package outputguard
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newWorkTree(t *testing.T) string {
+	if _, err := exec.LookPath(gitCommand); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "outputguard")
+	require.Nil(t, err)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.Nil(t, err)
+
+	require.Nil(t, exec.Command(gitCommand, "-C", dir, "init", "--quiet").Run())
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "deploy"), 0700))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.env\n"), 0600))
+
+	return dir
+}
+
+func TestGitWorkTree(t *testing.T) {
+	dir := newWorkTree(t)
+	defer os.RemoveAll(dir)
+
+	require.Nil(t, GitWorkTree(filepath.Join(dir, "deploy", "alibabacloud.env")))
+
+	err := GitWorkTree(filepath.Join(dir, "deploy", "credentials.sh"))
+	require.EqualError(t, err, filepath.Join(dir, "deploy", "credentials.sh")+" is inside the git work tree "+dir+" and not ignored, credentials written there are easily committed, add it to .gitignore")
+
+	outside, err := ioutil.TempDir("", "outputguard")
+	require.Nil(t, err)
+	defer os.RemoveAll(outside)
+
+	require.Nil(t, GitWorkTree(filepath.Join(outside, "credentials.sh")))
+
+	// a symlink out of the work tree is checked at its destination
+	link := filepath.Join(outside, "config.json")
+	require.Nil(t, os.Symlink(filepath.Join(dir, "config.json"), link))
+	require.Error(t, GitWorkTree(link))
+}
+
+func TestCheckRegistered(t *testing.T) {
+	defer func() { guards = nil }()
+
+	outside, err := ioutil.TempDir("", "outputguard")
+	require.Nil(t, err)
+	defer os.RemoveAll(outside)
+
+	filename := filepath.Join(outside, "credentials.sh")
+	require.Nil(t, Check(filename))
+
+	var checked string
+	Register(GuardFunc(func(filename string) error {
+		checked = filename
+		return errors.New("shared drive")
+	}))
+
+	require.EqualError(t, Check(filename), "shared drive")
+	require.Equal(t, filename, checked)
+}
@@ -9,8 +9,14 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
+// MaxSteps the number of pages a login may go through before the provider walking it gives up
+const MaxSteps = 10
+
+var logger = logrus.WithField("pkg", "page")
+
 type Form struct {
 	URL    string
 	Method string
@@ -88,3 +94,48 @@ func NewFormFromResponse(res *http.Response, formFilter string) (*Form, error) {
 	}
 	return NewFormFromDocument(doc, formFilter)
 }
+
+// ResolveURL resolve ref, the action of a form or a link of a page, against the URL of the page
+func ResolveURL(base *url.URL, ref string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(u).String(), nil
+}
+
+// SubmitForm submit the form of the document matching formFilter with client, its action resolved against the URL of
+// the document. fill, if not nil, completes the values with the form and its selection in the document. Forms
+// submitted with GET send their values in the query.
+func SubmitForm(client *provider.HTTPClient, doc *goquery.Document, formFilter string, fill func(form *Form, selection *goquery.Selection)) (*http.Response, error) {
+	form, err := NewFormFromDocument(doc, formFilter)
+	if err != nil {
+		return nil, errors.Wrap(err, "error extracting form")
+	}
+
+	form.URL, err = ResolveURL(doc.Url, form.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving form action")
+	}
+
+	if fill != nil {
+		if formFilter == "" {
+			formFilter = "form[action]"
+		}
+		fill(form, doc.Find(formFilter).First())
+	}
+
+	if form.Method == "GET" {
+		u, err := url.Parse(form.URL)
+		if err != nil {
+			return nil, errors.Wrap(err, "error resolving form action")
+		}
+		u.RawQuery = form.Values.Encode()
+		form.URL = u.String()
+		form.Values = &url.Values{}
+	}
+
+	logger.WithField("url", form.URL).Debug("submitting form")
+
+	return form.Submit(client)
+}
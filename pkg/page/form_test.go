@@ -3,10 +3,13 @@ package page
 import (
 	"bytes"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,3 +32,76 @@ func TestNewFormFromDocument(t *testing.T) {
 	require.Equal(t, "/form_c", form.URL)
 	require.Equal(t, url.Values{"c1": []string{"now"}}, *form.Values)
 }
+
+func TestResolveURL(t *testing.T) {
+	base, err := url.Parse("https://id.example.com/idp/sso/start?app=1")
+	require.Nil(t, err)
+
+	u, err := ResolveURL(base, "login?step=password")
+	require.Nil(t, err)
+	require.Equal(t, "https://id.example.com/idp/sso/login?step=password", u)
+
+	u, err = ResolveURL(base, "https://other.example.com/saml")
+	require.Nil(t, err)
+	require.Equal(t, "https://other.example.com/saml", u)
+
+	_, err = ResolveURL(base, "%zz")
+	require.Error(t, err)
+}
+
+func TestSubmitForm(t *testing.T) {
+	data, err := ioutil.ReadFile("example/login-form.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/idp/sso/start":
+			w.Write(data)
+		case "/idp/sso/login":
+			require.Equal(t, "POST", r.Method)
+			require.Equal(t, "password", r.URL.Query().Get("step"))
+			require.Equal(t, "token-1", r.PostForm.Get("csrf"))
+			require.Equal(t, "user", r.PostForm.Get("username"))
+			require.Equal(t, "secret", r.PostForm.Get("password"))
+			w.Write([]byte("logged in"))
+		case "/idp/consent":
+			require.Equal(t, "GET", r.Method)
+			require.Equal(t, "state-1", r.URL.Query().Get("state"))
+			require.Equal(t, "Yes", r.URL.Query().Get("yes"))
+			w.Write([]byte("consented"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client := &provider.HTTPClient{Client: http.Client{}, Options: &provider.HTTPClientOptions{}}
+
+	res, err := client.Get(ts.URL + "/idp/sso/start")
+	require.Nil(t, err)
+	doc, err := goquery.NewDocumentFromResponse(res)
+	require.Nil(t, err)
+
+	// the relative action is resolved against the page and fill sees the inputs of the form
+	res, err = SubmitForm(client, doc, "#login", func(form *Form, selection *goquery.Selection) {
+		require.Equal(t, 1, selection.Find("input[name=\"password\"]").Size())
+		form.Values.Set("username", "user")
+		form.Values.Set("password", "secret")
+	})
+	require.Nil(t, err)
+	body, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.Equal(t, "logged in", string(body))
+
+	// forms sent with GET carry their values in the query
+	res, err = SubmitForm(client, doc, "#consent", nil)
+	require.Nil(t, err)
+	body, err = ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.Equal(t, "consented", string(body))
+
+	_, err = SubmitForm(client, doc, "#missing", nil)
+	require.EqualError(t, err, "error extracting form: could not find form")
+}
@@ -1,5 +1,11 @@
 package prompter
 
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
 var defaultPrompter Prompter = NewCli()
 
 // Prompter handles prompting user for input
@@ -40,6 +46,33 @@ func Choose(pr string, options []string) int {
 	return defaultPrompter.Choose(pr, options)
 }
 
+// ChooseDevice pick one of the enrolled devices of a factor, the one named preferred, the mfa_device of the account,
+// exactly or as a part of its name ignoring the case, otherwise prompted for when there are several
+func ChooseDevice(factor, preferred string, names []string) (int, error) {
+	if len(names) == 0 {
+		return 0, errors.Errorf("no %s device is enrolled", factor)
+	}
+
+	if preferred != "" {
+		for i, name := range names {
+			if strings.EqualFold(name, preferred) {
+				return i, nil
+			}
+		}
+		for i, name := range names {
+			if strings.Contains(strings.ToLower(name), strings.ToLower(preferred)) {
+				return i, nil
+			}
+		}
+		return 0, errors.Errorf("no %s device matches mfa_device %s, enrolled: %s", factor, preferred, strings.Join(names, ", "))
+	}
+
+	if len(names) == 1 {
+		return 0, nil
+	}
+	return defaultPrompter.Choose("Select which "+factor+" device to use", names), nil
+}
+
 // StringRequired prompt for string which is required
 func StringRequired(pr string) string {
 	return defaultPrompter.StringRequired(pr)
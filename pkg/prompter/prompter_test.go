@@ -0,0 +1,51 @@
+package prompter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// choosePrompter answer the choices with the last option
+type choosePrompter struct {
+	Prompter
+	prompts []string
+}
+
+func (p *choosePrompter) Choose(pr string, options []string) int {
+	p.prompts = append(p.prompts, pr)
+	return len(options) - 1
+}
+
+func TestChooseDevice(t *testing.T) {
+	defer SetPrompter(defaultPrompter)
+	p := &choosePrompter{}
+	SetPrompter(p)
+
+	names := []string{"iPhone", "Pixel 7", "YubiKey 5 NFC"}
+
+	i, err := ChooseDevice("push", "pixel 7", names)
+	require.Nil(t, err)
+	require.Equal(t, 1, i)
+
+	i, err = ChooseDevice("push", "yubikey", names)
+	require.Nil(t, err)
+	require.Equal(t, 2, i)
+
+	_, err = ChooseDevice("push", "Galaxy", names)
+	require.EqualError(t, err, "no push device matches mfa_device Galaxy, enrolled: iPhone, Pixel 7, YubiKey 5 NFC")
+
+	// a single device is used without asking
+	i, err = ChooseDevice("push", "", names[:1])
+	require.Nil(t, err)
+	require.Equal(t, 0, i)
+	require.Empty(t, p.prompts)
+
+	i, err = ChooseDevice("push", "", names)
+	require.Nil(t, err)
+	require.Equal(t, 2, i)
+	require.Equal(t, []string{"Select which push device to use"}, p.prompts)
+
+	_, err = ChooseDevice("push", "", nil)
+	require.EqualError(t, err, "no push device is enrolled")
+}
@@ -0,0 +1,172 @@
+package prompter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultWebTimeout how long the web prompter waits for each answer
+const DefaultWebTimeout = 5 * time.Minute
+
+var webPage = template.Must(template.New("prompt").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>saml2alibabacloud</title></head>
+<body>
+<form method="POST">
+<label for="value">{{.Message}}</label>
+{{if .Options}}<select id="value" name="value" autofocus>{{range .Options}}<option{{if eq . $.Default}} selected{{end}}>{{.}}</option>{{end}}</select>
+{{else}}<input id="value" name="value" type="{{.Type}}" value="{{.Default}}" autocomplete="off" autofocus{{if .Required}} required{{end}}>
+{{end}}<button type="submit">Submit</button>
+</form>
+</body>
+</html>
+`))
+
+// webField a single prompt as rendered by the web prompter
+type webField struct {
+	Message  string
+	Type     string
+	Default  string
+	Options  []string
+	Required bool
+}
+
+// WebPrompter used to prompt in a web page served on localhost, for logins without a terminal such as daemons or
+// remote sessions, every prompt gets its own single use URL which is logged for the user to open
+type WebPrompter struct {
+	timeout time.Duration
+	notify  func(string)
+}
+
+// NewWeb builds a new web prompter, the prompts are answered with their default when the timeout expires
+func NewWeb(timeout time.Duration) *WebPrompter {
+	return &WebPrompter{
+		timeout: timeout,
+		notify: func(pageURL string) {
+			log.Printf("No terminal to prompt on, open %s to answer", pageURL)
+		},
+	}
+}
+
+// HasTerminal whether stdin is a terminal the cli prompter can read from
+func HasTerminal() bool {
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// RequestSecurityCode request a security code to be entered by the user
+func (web *WebPrompter) RequestSecurityCode(pattern string) string {
+	return web.ask(webField{Message: fmt.Sprintf("Security Token [%s]", pattern), Type: "text", Required: true})
+}
+
+// ChooseWithDefault given the choice return the option selected with a default
+func (web *WebPrompter) ChooseWithDefault(pr string, defaultValue string, options []string) (string, error) {
+	selected := web.ask(webField{Message: pr, Default: defaultValue, Options: options, Required: true})
+	for _, option := range options {
+		if selected == option {
+			return option, nil
+		}
+	}
+	return "", errors.New("bad input")
+}
+
+// Choose given the choice return the option selected
+func (web *WebPrompter) Choose(pr string, options []string) int {
+	selected := web.ask(webField{Message: pr, Options: options, Required: true})
+	for i, option := range options {
+		if selected == option {
+			return i
+		}
+	}
+	return 0
+}
+
+// String prompt for string with a default
+func (web *WebPrompter) String(pr string, defaultValue string) string {
+	return web.ask(webField{Message: pr, Type: "text", Default: defaultValue})
+}
+
+// StringRequired prompt for string which is required
+func (web *WebPrompter) StringRequired(pr string) string {
+	return web.ask(webField{Message: pr, Type: "text", Required: true})
+}
+
+// Password prompt for password which is required
+func (web *WebPrompter) Password(pr string) string {
+	return web.ask(webField{Message: pr, Type: "password"})
+}
+
+// ask serve the field on a random loopback port under a random token until it is answered once, any other path is
+// not found and the token no longer works after the answer
+func (web *WebPrompter) ask(field webField) string {
+	token, err := webToken()
+	if err != nil {
+		log.Printf("Unable to prompt for %q: %v", field.Message, err)
+		return field.Default
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Printf("Unable to prompt for %q: %v", field.Message, err)
+		return field.Default
+	}
+
+	path := "/" + token
+	answer := make(chan string, 1)
+	var mu sync.Mutex
+	answered := false
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if answered || r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+
+		value := r.PostFormValue("value")
+		if r.Method != http.MethodPost || (field.Required && value == "") {
+			webPage.Execute(w, field)
+			return
+		}
+
+		answered = true
+		fmt.Fprintln(w, "Thanks, you can close this page.")
+		answer <- value
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	web.notify(fmt.Sprintf("http://%s%s", listener.Addr(), path))
+
+	select {
+	case value := <-answer:
+		return value
+	case <-time.After(web.timeout):
+		log.Printf("No answer for %q after %s", field.Message, web.timeout)
+		return field.Default
+	}
+}
+
+func webToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,71 @@
+package prompter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebPrompter(t *testing.T) {
+	pageURLs := make(chan string, 1)
+	web := NewWeb(time.Minute)
+	web.notify = func(pageURL string) { pageURLs <- pageURL }
+
+	answers := make(chan string, 1)
+	go func() { answers <- web.RequestSecurityCode("000000") }()
+
+	pageURL := <-pageURLs
+	require.True(t, strings.HasPrefix(pageURL, "http://127.0.0.1:"))
+
+	page, err := url.Parse(pageURL)
+	require.Nil(t, err)
+	res, err := http.Get("http://" + page.Host + "/not-the-token")
+	require.Nil(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, err = http.Get(pageURL)
+	require.Nil(t, err)
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	require.Nil(t, err)
+	require.Contains(t, string(body), "Security Token [000000]")
+
+	res, err = http.PostForm(pageURL, url.Values{"value": {"123456"}})
+	require.Nil(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "123456", <-answers)
+
+	res, err = http.PostForm(pageURL, url.Values{"value": {"654321"}})
+	if err == nil {
+		res.Body.Close()
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+	}
+}
+
+func TestWebPrompterChoose(t *testing.T) {
+	pageURLs := make(chan string, 1)
+	web := NewWeb(time.Minute)
+	web.notify = func(pageURL string) { pageURLs <- pageURL }
+
+	answers := make(chan int, 1)
+	go func() { answers <- web.Choose("Select a role", []string{"dev", "prod"}) }()
+
+	res, err := http.PostForm(<-pageURLs, url.Values{"value": {"prod"}})
+	require.Nil(t, err)
+	res.Body.Close()
+	require.Equal(t, 1, <-answers)
+}
+
+func TestWebPrompterTimeout(t *testing.T) {
+	web := NewWeb(10 * time.Millisecond)
+	web.notify = func(string) {}
+
+	require.Equal(t, "default", web.String("Name", "default"))
+}
@@ -16,6 +16,8 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
 	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/pkg/errors"
@@ -25,10 +27,17 @@ import (
 
 var logger = logrus.WithField("provider", "aad")
 
+// processAuthType the login type of the ProcessAuth post completing an MFA proof
+const processAuthType = "22"
+
+// defaultMfaPollInterval the delay between EndAuth polls when the proofs page doesn't set one, replaced in tests
+var defaultMfaPollInterval = time.Second
+
 // Client wrapper around AzureAD enabling authentication and retrieval of assertions
 type Client struct {
-	client     *provider.HTTPClient
-	idpAccount *cfg.IDPAccount
+	client        *provider.HTTPClient
+	idpAccount    *cfg.IDPAccount
+	authenticator *webauthn.Authenticator
 }
 
 // Autogenerate startSAML Response struct
@@ -219,6 +228,8 @@ type passwordLoginResponse struct {
 	FProofIndexedByType                 bool               `json:"fProofIndexedByType"`
 	URLBeginAuth                        string             `json:"urlBeginAuth"`
 	URLEndAuth                          string             `json:"urlEndAuth"`
+	SFidoChallenge                      string             `json:"sFidoChallenge"`
+	ArrFidoAllowList                    []string           `json:"arrFidoAllowList"`
 	ISAMode                             int                `json:"iSAMode"`
 	ITrustedDeviceCheckboxConfig        int                `json:"iTrustedDeviceCheckboxConfig"`
 	IMaxPollAttempts                    int                `json:"iMaxPollAttempts"`
@@ -477,6 +488,7 @@ type mfaRequest struct {
 	FlowToken          string `json:"FlowToken"`
 	SessionID          string `json:"SessionId,omitempty"`
 	AdditionalAuthData string `json:"AdditionalAuthData,omitempty"`
+	PollCount          int    `json:"PollCount,omitempty"`
 }
 
 // mfa response
@@ -492,6 +504,7 @@ type mfaResponse struct {
 	SessionID     string      `json:"SessionId"`
 	CorrelationID string      `json:"CorrelationId"`
 	Timestamp     time.Time   `json:"Timestamp"`
+	Entropy       int         `json:"Entropy"` // the number to enter in Microsoft Authenticator with number matching
 }
 
 // Autogenerate ProcessAuth response
@@ -615,17 +628,25 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
 	tr := &http.Transport{
 		Proxy:           http.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: idpAccount.SkipVerify, Renegotiation: tls.RenegotiateFreelyAsClient},
+		TLSClientConfig: &tls.Config{Renegotiation: tls.RenegotiateFreelyAsClient},
+	}
+
+	// presented to certauth for certificate based authentication
+	certs, err := provider.AccountCertificates(idpAccount)
+	if err != nil {
+		return nil, err
 	}
+	tr.TLSClientConfig.Certificates = certs
 
-	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	client, err := provider.NewHTTPClient(provider.ScopeSkipVerify(tr, idpAccount.SkipVerifyHostList()), provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
 
 	return &Client{
-		client:     client,
-		idpAccount: idpAccount,
+		client:        client,
+		idpAccount:    idpAccount,
+		authenticator: webauthn.New(),
 	}, nil
 }
 
@@ -638,7 +659,7 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 	// idpAccount.URL = https://account.activedirectory.windowsazure.com
 
 	// startSAML
-	startURL := fmt.Sprintf("%s/applications/redirecttofederatedapplication.aspx?Operation=LinkedSignIn&applicationId=%s", ac.idpAccount.URL, ac.idpAccount.AppID)
+	startURL := ac.startURL(ac.idpAccount.AppID)
 	logger.Debugf("start url: %s", startURL)
 
 	res, err := ac.client.Get(startURL)
@@ -661,36 +682,33 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		return samlAssertion, errors.Wrap(err, "startSAML response unmarshal error")
 	}
 
-	// password login
-	loginValues := url.Values{}
-	loginValues.Set(startSAMLResp.SFTName, startSAMLResp.SFT)
-	loginValues.Set("ctx", startSAMLResp.SCtx)
-	loginValues.Set("login", loginDetails.Username)
-	loginValues.Set("passwd", loginDetails.Password)
-
-	// Sometimes AAD response may contain "post url" as a relative url
-	// in this case, prepend the url scheme and host, of the URL we requested
-	var urlPost string
-	if strings.HasPrefix(startSAMLResp.URLPost, "/") {
-		urlPost = res.Request.URL.Scheme + "://" + res.Request.URL.Host + startSAMLResp.URLPost
+	if ac.idpAccount.ClientCert != "" {
+		// certificate based authentication, the client certificate presented to certauth replaces the password
+		res, err = ac.certAuth(&startSAMLResp)
 	} else {
-		urlPost = startSAMLResp.URLPost
+		res, err = ac.passwordLogin(&startSAMLResp, res.Request.URL, loginDetails)
 	}
-
-	passwordLoginRequest, err := http.NewRequest("POST", urlPost, strings.NewReader(loginValues.Encode()))
-
 	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error retrieving login results")
-	}
-	passwordLoginRequest.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	res, err = ac.client.Do(passwordLoginRequest)
-	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error retrieving login results")
+		return samlAssertion, err
 	}
 
 	resBody, _ = ioutil.ReadAll(res.Body)
 	resBodyStr = string(resBody)
 
+	// users onboarding without a password are asked for their Temporary Access Pass instead
+	if config := tapConfig(resBodyStr); config != nil {
+		res, err = ac.processTAP(config, res.Request.URL, startSAMLResp.SFTName, loginDetails.Username)
+		if err != nil {
+			return samlAssertion, err
+		}
+		resBody, _ = ioutil.ReadAll(res.Body)
+		resBodyStr = string(resBody)
+
+		if config := tapConfig(resBodyStr); config != nil {
+			return samlAssertion, tapError(config)
+		}
+	}
+
 	// MFA has been skipped
 	if !strings.HasPrefix(resBodyStr, "<html><head><title>Working...</title>") {
 		// require reprocess
@@ -766,100 +784,15 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 					}
 				}
 			}
-			mfaReq := mfaRequest{AuthMethodID: mfa.AuthMethodID, Method: "BeginAuth", Ctx: loginPasswordResp.SCtx, FlowToken: loginPasswordResp.SFT}
-			mfaReqJson, err := json.Marshal(mfaReq)
-			if err != nil {
-				return samlAssertion, err
+			if mfa.AuthMethodID == fidoAuthMethodID {
+				res, err = ac.processFido(&loginPasswordResp, startSAMLResp.SFTName)
+			} else {
+				res, err = ac.processMfa(mfa.AuthMethodID, &loginPasswordResp, res.Request.URL, startSAMLResp.SFTName, loginDetails.Username)
 			}
-			mfaBeginRequest, err := http.NewRequest("POST", loginPasswordResp.URLBeginAuth, strings.NewReader(string(mfaReqJson)))
 			if err != nil {
-				return samlAssertion, errors.Wrap(err, "error retrieving begin mfa")
-			}
-			mfaBeginRequest.Header.Add("Content-Type", "application/json")
-			res, err = ac.client.Do(mfaBeginRequest)
-			if err != nil {
-				return samlAssertion, errors.Wrap(err, "error retrieving begin mfa")
-			}
-			mfaBeginJson := make([]byte, res.ContentLength)
-			if n, err := res.Body.Read(mfaBeginJson); err != nil && err != io.EOF || n != int(res.ContentLength) {
-				return samlAssertion, errors.Wrap(err, "mfa BeginAuth response error")
-			}
-			var mfaResp mfaResponse
-			if err := json.Unmarshal(mfaBeginJson, &mfaResp); err != nil {
-				return samlAssertion, errors.Wrap(err, "mfa BeginAuth  response unmarshal error")
-			}
-			if !mfaResp.Success {
-				return samlAssertion, fmt.Errorf("mfa BeginAuth is not success %v", mfaResp.Message)
-			}
-
-			//  mfa end
-			for i := 0; ; i++ {
-				mfaReq = mfaRequest{
-					AuthMethodID: mfaResp.AuthMethodID,
-					Method:       "EndAuth",
-					Ctx:          mfaResp.Ctx,
-					FlowToken:    mfaResp.FlowToken,
-					SessionID:    mfaResp.SessionID,
-				}
-				if mfaReq.AuthMethodID == "PhoneAppOTP" || mfaReq.AuthMethodID == "OneWaySMS" {
-					verifyCode := prompter.StringRequired("Enter verification code")
-					mfaReq.AdditionalAuthData = verifyCode
-				}
-				if mfaReq.AuthMethodID == "PhoneAppNotification" && i == 0 {
-					log.Println("Phone approval required.")
-				}
-				mfaReqJson, err := json.Marshal(mfaReq)
-				if err != nil {
-					return samlAssertion, err
-				}
-				mfaEndRequest, err := http.NewRequest("POST", loginPasswordResp.URLEndAuth, strings.NewReader(string(mfaReqJson)))
-				if err != nil {
-					return samlAssertion, errors.Wrap(err, "error retrieving begin mfa")
-				}
-				mfaEndRequest.Header.Add("Content-Type", "application/json")
-				res, err = ac.client.Do(mfaEndRequest)
-				if err != nil {
-					return samlAssertion, errors.Wrap(err, "error retrieving begin mfa")
-				}
-				mfaJson := make([]byte, res.ContentLength)
-				if n, err := res.Body.Read(mfaJson); err != nil && err != io.EOF || n != int(res.ContentLength) {
-					return samlAssertion, errors.Wrap(err, "mfa EndAuth response error")
-				}
-				if err := json.Unmarshal(mfaJson, &mfaResp); err != nil {
-					return samlAssertion, errors.Wrap(err, "mfa EndAuth  response unmarshal error")
-				}
-				if mfaResp.ErrCode != 0 {
-					return samlAssertion, fmt.Errorf("error mfa fail errcode: %d, message: %v", mfaResp.ErrCode, mfaResp.Message)
-				}
-				if mfaResp.Success {
-					break
-				}
-				if !mfaResp.Retry {
-					break
-				}
-				// if mfaResp.Retry == true then
-				// must exist loginPasswordResp.OPerAuthPollingInterval[mfaResp.AuthMethodID]
-				time.Sleep(time.Duration(loginPasswordResp.OPerAuthPollingInterval[mfaResp.AuthMethodID]) * time.Second)
-			}
-			if !mfaResp.Success {
-				return samlAssertion, fmt.Errorf("error mfa fail")
+				return samlAssertion, err
 			}
 
-			// ProcessAuth
-			ProcessAuthValues := url.Values{}
-			ProcessAuthValues.Set(startSAMLResp.SFTName, mfaResp.FlowToken)
-			ProcessAuthValues.Set("request", mfaResp.Ctx)
-			ProcessAuthValues.Set("login", loginDetails.Username)
-
-			ProcessAuthRequest, err := http.NewRequest("POST", loginPasswordResp.URLPost, strings.NewReader(ProcessAuthValues.Encode()))
-			if err != nil {
-				return samlAssertion, errors.Wrap(err, "error retrieving process auth results")
-			}
-			ProcessAuthRequest.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-			res, err = ac.client.Do(ProcessAuthRequest)
-			if err != nil {
-				return samlAssertion, errors.Wrap(err, "error retrieving process auth results")
-			}
 			// data is embeded javascript object
 			// <script><![CDATA[  $Config=......; ]]>
 			resBody, _ = ioutil.ReadAll(res.Body)
@@ -979,6 +912,22 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		return samlAssertion, errors.Wrap(err, "error retrieving oidc login form results")
 	}
 
+	// signed in to My Apps, look the application up and start its federated sign in with the session
+	if ac.idpAccount.AppID == "" {
+		res.Body.Close()
+
+		appID, err := ac.discoverAppID()
+		if err != nil {
+			return samlAssertion, errors.Wrap(err, "error discovering app")
+		}
+		log.Printf("Using the application %s found in My Apps, set app_id to %s to skip the lookup", ac.idpAccount.AppName, appID)
+
+		res, err = ac.client.Get(ac.startURL(appID))
+		if err != nil {
+			return samlAssertion, errors.Wrap(err, "error retrieving federated sign in")
+		}
+	}
+
 	//  get saml assertion
 	oidcResponse, err := ioutil.ReadAll(res.Body)
 	if err != nil {
@@ -1104,6 +1053,187 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 	return samlAssertion, errors.New("failed get SAMLAssertion")
 }
 
+// passwordLogin post the username and password to the login page
+func (ac *Client) passwordLogin(startSAMLResp *startSAMLResponse, pageURL *url.URL, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	loginValues := url.Values{}
+	loginValues.Set(startSAMLResp.SFTName, startSAMLResp.SFT)
+	loginValues.Set("ctx", startSAMLResp.SCtx)
+	loginValues.Set("login", loginDetails.Username)
+	loginValues.Set("passwd", loginDetails.Password)
+
+	// Sometimes AAD response may contain "post url" as a relative url
+	// in this case, prepend the url scheme and host, of the URL we requested
+	var urlPost string
+	if strings.HasPrefix(startSAMLResp.URLPost, "/") {
+		urlPost = pageURL.Scheme + "://" + pageURL.Host + startSAMLResp.URLPost
+	} else {
+		urlPost = startSAMLResp.URLPost
+	}
+	urlPost = withTenant(urlPost, ac.idpAccount.TenantID)
+
+	passwordLoginRequest, err := http.NewRequest("POST", urlPost, strings.NewReader(loginValues.Encode()))
+
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving login results")
+	}
+	passwordLoginRequest.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	res, err := ac.client.Do(passwordLoginRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving login results")
+	}
+
+	return res, nil
+}
+
+// processMfa verify the proof of the user with the BeginAuth / EndAuth flow of AzureAD MFA, returning the response of
+// ProcessAuth
+func (ac *Client) processMfa(authMethodID string, loginPasswordResp *passwordLoginResponse, pageURL *url.URL, sftName, username string) (*http.Response, error) {
+	// the endpoints of the $Config, which AzureAD now sends relative to the page
+	beginAuthURL, err := page.ResolveURL(pageURL, loginPasswordResp.URLBeginAuth)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving begin mfa url")
+	}
+	endAuthURL, err := page.ResolveURL(pageURL, loginPasswordResp.URLEndAuth)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving end mfa url")
+	}
+	processAuthURL, err := page.ResolveURL(pageURL, loginPasswordResp.URLPost)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving process auth url")
+	}
+
+	mfaReq := mfaRequest{AuthMethodID: authMethodID, Method: "BeginAuth", Ctx: loginPasswordResp.SCtx, FlowToken: loginPasswordResp.SFT}
+	mfaReqJson, err := json.Marshal(mfaReq)
+	if err != nil {
+		return nil, err
+	}
+	mfaBeginRequest, err := http.NewRequest("POST", beginAuthURL, strings.NewReader(string(mfaReqJson)))
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving begin mfa")
+	}
+	mfaBeginRequest.Header.Add("Content-Type", "application/json")
+	res, err := ac.client.Do(mfaBeginRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving begin mfa")
+	}
+	mfaBeginJson := make([]byte, res.ContentLength)
+	if n, err := res.Body.Read(mfaBeginJson); err != nil && err != io.EOF || n != int(res.ContentLength) {
+		return nil, errors.Wrap(err, "mfa BeginAuth response error")
+	}
+	var mfaResp mfaResponse
+	if err := json.Unmarshal(mfaBeginJson, &mfaResp); err != nil {
+		return nil, errors.Wrap(err, "mfa BeginAuth  response unmarshal error")
+	}
+	if !mfaResp.Success {
+		return nil, fmt.Errorf("mfa BeginAuth is not success %v", mfaResp.Message)
+	}
+
+	// with number matching the push is approved by entering the number shown here in Microsoft Authenticator
+	entropy := mfaResp.Entropy
+	if entropy > 0 {
+		log.Printf("Enter %d in Microsoft Authenticator to approve the sign in...", entropy)
+	}
+
+	//  mfa end
+	started := time.Now()
+	for i := 0; ; i++ {
+		mfaReq = mfaRequest{
+			AuthMethodID: mfaResp.AuthMethodID,
+			Method:       "EndAuth",
+			Ctx:          mfaResp.Ctx,
+			FlowToken:    mfaResp.FlowToken,
+			SessionID:    mfaResp.SessionID,
+		}
+		if mfaReq.AuthMethodID == "PhoneAppOTP" || mfaReq.AuthMethodID == "OneWaySMS" {
+			verifyCode := prompter.StringRequired("Enter verification code")
+			mfaReq.AdditionalAuthData = verifyCode
+		}
+		if mfaReq.AuthMethodID == "PhoneAppNotification" {
+			if i == 0 && entropy == 0 {
+				log.Println("Phone approval required.")
+			}
+			mfaReq.PollCount = i
+		}
+		mfaReqJson, err := json.Marshal(mfaReq)
+		if err != nil {
+			return nil, err
+		}
+		mfaEndRequest, err := http.NewRequest("POST", endAuthURL, strings.NewReader(string(mfaReqJson)))
+		if err != nil {
+			return nil, errors.Wrap(err, "error retrieving begin mfa")
+		}
+		mfaEndRequest.Header.Add("Content-Type", "application/json")
+		res, err = ac.client.Do(mfaEndRequest)
+		if err != nil {
+			return nil, errors.Wrap(err, "error retrieving begin mfa")
+		}
+		mfaJson := make([]byte, res.ContentLength)
+		if n, err := res.Body.Read(mfaJson); err != nil && err != io.EOF || n != int(res.ContentLength) {
+			return nil, errors.Wrap(err, "mfa EndAuth response error")
+		}
+		if err := json.Unmarshal(mfaJson, &mfaResp); err != nil {
+			return nil, errors.Wrap(err, "mfa EndAuth  response unmarshal error")
+		}
+		if mfaResp.ErrCode != 0 {
+			return nil, fmt.Errorf("error mfa fail errcode: %d, message: %v", mfaResp.ErrCode, mfaResp.Message)
+		}
+		switch mfaResp.ResultValue {
+		case "PhoneAppDenied":
+			return nil, errors.New("the sign in was denied in Microsoft Authenticator")
+		case "PhoneAppNoResponse":
+			return nil, errors.New("the sign in was not approved in Microsoft Authenticator in time")
+		}
+		if mfaResp.Success {
+			break
+		}
+		if !mfaResp.Retry {
+			break
+		}
+		// mfa_timeout replaces the attempts the proofs page allows, which slow phones may not answer within
+		if timeout := ac.idpAccount.MFAWaitTimeout(0); timeout > 0 {
+			if time.Since(started) > timeout {
+				return nil, fmt.Errorf("mfa was not completed within %v", timeout)
+			}
+		} else if loginPasswordResp.IMaxPollAttempts > 0 && i+1 >= loginPasswordResp.IMaxPollAttempts {
+			return nil, fmt.Errorf("mfa was not completed after %d attempts", loginPasswordResp.IMaxPollAttempts)
+		}
+		if err := ac.client.Sleep(ac.idpAccount.MFAWaitInterval(mfaPollInterval(loginPasswordResp, mfaResp.AuthMethodID))); err != nil {
+			return nil, errors.Wrap(err, "error waiting for the mfa approval")
+		}
+	}
+	if !mfaResp.Success {
+		return nil, fmt.Errorf("error mfa fail")
+	}
+
+	// ProcessAuth
+	ProcessAuthValues := url.Values{}
+	ProcessAuthValues.Set(sftName, mfaResp.FlowToken)
+	ProcessAuthValues.Set("request", mfaResp.Ctx)
+	ProcessAuthValues.Set("login", username)
+	ProcessAuthValues.Set("mfaAuthMethod", authMethodID)
+	ProcessAuthValues.Set("type", processAuthType)
+
+	ProcessAuthRequest, err := http.NewRequest("POST", processAuthURL, strings.NewReader(ProcessAuthValues.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving process auth results")
+	}
+	ProcessAuthRequest.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	res, err = ac.client.Do(ProcessAuthRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving process auth results")
+	}
+
+	return res, nil
+}
+
+// mfaPollInterval the delay between the EndAuth polls of the method, as set by the proofs page
+func mfaPollInterval(loginPasswordResp *passwordLoginResponse, authMethodID string) time.Duration {
+	if interval := loginPasswordResp.OPerAuthPollingInterval[authMethodID]; interval > 0 {
+		return time.Duration(interval * float64(time.Second))
+	}
+	return defaultMfaPollInterval
+}
+
 func (ac *Client) reProcess(resBodyStr string) (*http.Response, error) {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(resBodyStr))
 	if err != nil {
@@ -1141,3 +1271,25 @@ func (ac *Client) reProcess(resBodyStr string) (*http.Response, error) {
 	}
 	return res, nil
 }
+
+// withTenant point an AAD login endpoint at the configured tenant, for example
+// https://login.microsoftonline.com/common/login becomes https://login.microsoftonline.com/organizations/login
+func withTenant(loginURL, tenant string) string {
+	if tenant == "" {
+		return loginURL
+	}
+
+	u, err := url.Parse(loginURL)
+	if err != nil || !strings.HasSuffix(u.Hostname(), "login.microsoftonline.com") {
+		return loginURL
+	}
+
+	segments := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if len(segments) != 2 {
+		return loginURL
+	}
+
+	u.Path = "/" + url.PathEscape(tenant) + "/" + segments[1]
+
+	return u.String()
+}
@@ -0,0 +1,193 @@
+package aad
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTenant(t *testing.T) {
+	require.Equal(t, "https://login.microsoftonline.com/common/login", withTenant("https://login.microsoftonline.com/common/login", ""))
+	require.Equal(t, "https://login.microsoftonline.com/organizations/login", withTenant("https://login.microsoftonline.com/common/login", "organizations"))
+	require.Equal(t, "https://login.microsoftonline.com/8273303e-1e63-49f2-9812-43c86b5b11ec/login?sso_reload=true", withTenant("https://login.microsoftonline.com/common/login?sso_reload=true", "8273303e-1e63-49f2-9812-43c86b5b11ec"))
+	require.Equal(t, "https://sts.example.com/adfs/ls", withTenant("https://sts.example.com/adfs/ls", "consumers"))
+}
+
+func TestTapConfig(t *testing.T) {
+	require.Nil(t, tapConfig("<html><head><title>Working...</title></head></html>"))
+	require.Nil(t, tapConfig(`<script>$Config={"pgid":"ConvergedSignIn","urlPost":"/common/login"};</script>`))
+
+	config := tapConfig(`<script>$Config={"pgid":"ConvergedTAP","urlPost":"/common/login","sFT":"flow-token","sCtx":"context","sErrorCode":"130502"};</script>`)
+	require.NotNil(t, config)
+	require.Equal(t, "/common/login", config.URLPost)
+	require.EqualError(t, tapError(config), "the Temporary Access Pass was not accepted, code: 130502, please refer to https://login.microsoftonline.com/error?code=130502 for more details")
+}
+
+func TestProcessTAP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+		require.Equal(t, "/common/login", r.URL.Path)
+		require.Equal(t, "flow-token", r.PostForm.Get("flowToken"))
+		require.Equal(t, "context", r.PostForm.Get("ctx"))
+		require.Equal(t, "user@example.com", r.PostForm.Get("login"))
+		require.Equal(t, "tap-1234", r.PostForm.Get("accesspass"))
+		fmt.Fprint(w, "<html><head><title>Working...</title></head></html>")
+	}))
+	defer ts.Close()
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("Password", "Temporary Access Pass").Return("tap-1234")
+
+	ac, err := New(&cfg.IDPAccount{URL: ts.URL})
+	require.Nil(t, err)
+
+	page, err := http.NewRequest("GET", ts.URL+"/common/login", nil)
+	require.Nil(t, err)
+
+	config := &startSAMLResponse{Pgid: tapPageID, URLPost: "/common/login", SFT: "flow-token", SCtx: "context"}
+	res, err := ac.processTAP(config, page.URL, "flowToken", "user@example.com")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestCertAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aad")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "user@example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	certFile := filepath.Join(dir, "user.crt")
+	keyFile := filepath.Join(dir, "user.key")
+	require.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+		switch r.URL.Path {
+		case "/organizations/certauth":
+			require.Equal(t, "user@example.com", r.TLS.PeerCertificates[0].Subject.CommonName)
+			require.Equal(t, "flow-token", r.PostForm.Get("flowToken"))
+			fmt.Fprint(w, `<html><body><form method="POST" action="/common/login"><input type="hidden" name="ctx" value="context"/><input type="hidden" name="flowtoken" value="flow-token-2"/><input type="hidden" name="certificatetoken" value="certificate-token"/></form></body></html>`)
+		case "/common/login":
+			require.Equal(t, "certificate-token", r.PostForm.Get("certificatetoken"))
+			require.Equal(t, "flow-token-2", r.PostForm.Get("flowtoken"))
+			fmt.Fprint(w, "<html><head><title>Working...</title></head></html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	defer func(u string) { certAuthURL = u }(certAuthURL)
+	certAuthURL = ts.URL + "/%s/certauth"
+
+	ac, err := New(&cfg.IDPAccount{URL: ts.URL, SkipVerify: true, TenantID: "organizations", ClientCert: certFile, ClientKey: keyFile})
+	require.Nil(t, err)
+
+	res, err := ac.certAuth(&startSAMLResponse{SFTName: "flowToken", SFT: "flow-token", SCtx: "context"})
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	_, err = New(&cfg.IDPAccount{URL: ts.URL, ClientCert: certFile})
+	require.EqualError(t, err, "client_cert and client_key must be set together")
+}
+
+func TestProcessMfaNumberMatching(t *testing.T) {
+	defaultMfaPollInterval = 0
+
+	polls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/common/SAS/BeginAuth":
+			fmt.Fprint(w, `{"Success":true,"AuthMethodId":"PhoneAppNotification","Ctx":"context","FlowToken":"flow-token","SessionId":"session","Entropy":42}`)
+		case "/common/SAS/EndAuth":
+			var req mfaRequest
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+			require.Equal(t, "session", req.SessionID)
+			require.Equal(t, polls, req.PollCount)
+			polls++
+			if polls < 3 {
+				fmt.Fprint(w, `{"Success":false,"Retry":true,"ResultValue":"AuthenticationPending","AuthMethodId":"PhoneAppNotification","Ctx":"context","FlowToken":"flow-token","SessionId":"session"}`)
+				return
+			}
+			fmt.Fprint(w, `{"Success":true,"ResultValue":"Success","AuthMethodId":"PhoneAppNotification","Ctx":"context-2","FlowToken":"flow-token-2","SessionId":"session"}`)
+		case "/common/SAS/ProcessAuth":
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "flow-token-2", r.PostForm.Get("flowToken"))
+			require.Equal(t, "context-2", r.PostForm.Get("request"))
+			require.Equal(t, "PhoneAppNotification", r.PostForm.Get("mfaAuthMethod"))
+			require.Equal(t, "22", r.PostForm.Get("type"))
+			fmt.Fprint(w, "<html><head><title>Working...</title></head></html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	ac, err := New(&cfg.IDPAccount{URL: ts.URL})
+	require.Nil(t, err)
+
+	page, err := url.Parse(ts.URL + "/common/login")
+	require.Nil(t, err)
+
+	loginPasswordResp := &passwordLoginResponse{
+		URLBeginAuth: "/common/SAS/BeginAuth",
+		URLEndAuth:   "/common/SAS/EndAuth",
+		URLPost:      "/common/SAS/ProcessAuth",
+		SCtx:         "context",
+		SFT:          "flow-token",
+	}
+
+	res, err := ac.processMfa("PhoneAppNotification", loginPasswordResp, page, "flowToken", "user@example.com")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, 3, polls)
+
+	polls = 0
+	loginPasswordResp.IMaxPollAttempts = 2
+	_, err = ac.processMfa("PhoneAppNotification", loginPasswordResp, page, "flowToken", "user@example.com")
+	require.EqualError(t, err, "mfa was not completed after 2 attempts")
+
+	// mfa_timeout waits longer than the attempts of the proofs page
+	polls = 0
+	ac.idpAccount.MFATimeout = 60
+	_, err = ac.processMfa("PhoneAppNotification", loginPasswordResp, page, "flowToken", "user@example.com")
+	require.Nil(t, err)
+	require.Equal(t, 3, polls)
+}
@@ -0,0 +1,80 @@
+package aad
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+)
+
+// certAuthURL the endpoint asking for the client certificate of the user, by tenant
+var certAuthURL = "https://certauth.login.microsoftonline.com/%s/certauth"
+
+// certAuth present the client certificate to certauth, then post the certificate token it returns back to the
+// login page, returning the response which continues like the password login
+func (ac *Client) certAuth(startSAMLResp *startSAMLResponse) (*http.Response, error) {
+	tenant := ac.idpAccount.TenantID
+	if tenant == "" {
+		tenant = "common"
+	}
+
+	certValues := url.Values{}
+	certValues.Set(startSAMLResp.SFTName, startSAMLResp.SFT)
+	certValues.Set("ctx", startSAMLResp.SCtx)
+
+	certRequest, err := http.NewRequest("POST", fmt.Sprintf(certAuthURL, url.PathEscape(tenant)), strings.NewReader(certValues.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building certificate authentication request")
+	}
+	certRequest.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := ac.client.Do(certRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving certificate authentication results")
+	}
+
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build document from response")
+	}
+
+	form := doc.Find("form").First()
+	action, ok := form.Attr("action")
+	if !ok || form.Find("input[name=\"certificatetoken\"]").Size() == 0 {
+		if msg := strings.TrimSpace(doc.Find("#errorText, #ErrorDescription").First().Text()); msg != "" {
+			return nil, fmt.Errorf("AzureAD certificate authentication failed: %s", msg)
+		}
+		return nil, errors.New("AzureAD certificate authentication failed, check client_cert is issued by an authority trusted by the tenant")
+	}
+
+	actionURL, err := doc.Url.Parse(action)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving certificate token form action")
+	}
+
+	tokenValues := url.Values{}
+	form.Find("input").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok {
+			return
+		}
+		value, _ := s.Attr("value")
+		tokenValues.Set(name, value)
+	})
+
+	tokenRequest, err := http.NewRequest("POST", actionURL.String(), strings.NewReader(tokenValues.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building certificate token request")
+	}
+	tokenRequest.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err = ac.client.Do(tokenRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving certificate token results")
+	}
+
+	return res, nil
+}
@@ -0,0 +1,103 @@
+package aad
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
+	"github.com/pkg/errors"
+)
+
+const (
+	// fidoAuthMethodID the proof of the security keys and passkeys of the user
+	fidoAuthMethodID = "FidoKey"
+
+	// fidoRPID the relying party of the AzureAD security key credentials, whatever the tenant
+	fidoRPID = "login.microsoft.com"
+
+	// fidoLoginType the login type AzureAD expects with a security key assertion
+	fidoLoginType = "23"
+)
+
+// fidoAssertion the assertion as posted by the AzureAD sign in page, base64url encoded
+type fidoAssertion struct {
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle"`
+}
+
+// processFido sign the FIDO2 challenge of the proofs page with a security key and post the assertion, returning the
+// response of the post which continues like the other proofs
+func (ac *Client) processFido(loginPasswordResp *passwordLoginResponse, sftName string) (*http.Response, error) {
+	if loginPasswordResp.SFidoChallenge == "" {
+		return nil, errors.New("AzureAD did not send a security key challenge, the tenant might not allow security keys for this sign in")
+	}
+
+	assertion, err := ac.authenticator.Assert(&webauthn.Request{
+		RPID:          fidoRPID,
+		Challenge:     loginPasswordResp.SFidoChallenge,
+		CredentialIDs: loginPasswordResp.ArrFidoAllowList,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing in with the security key")
+	}
+
+	credentialID, err := toBase64URL(assertion.CredentialID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid security key credential %s", assertion.CredentialID)
+	}
+
+	assertionJSON, err := json.Marshal(fidoAssertion{
+		ID:                credentialID,
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(assertion.ClientDataJSON),
+		AuthenticatorData: base64.RawURLEncoding.EncodeToString(assertion.AuthenticatorData),
+		Signature:         base64.RawURLEncoding.EncodeToString(assertion.Signature),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fidoValues := url.Values{}
+	fidoValues.Set("type", fidoLoginType)
+	fidoValues.Set("ps", fidoLoginType)
+	fidoValues.Set("assertion", string(assertionJSON))
+	fidoValues.Set(sftName, loginPasswordResp.SFT)
+	fidoValues.Set("ctx", loginPasswordResp.SCtx)
+
+	fidoRequest, err := http.NewRequest("POST", loginPasswordResp.URLPost, strings.NewReader(fidoValues.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building security key sign in request")
+	}
+	fidoRequest.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := ac.client.Do(fidoRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving security key sign in results")
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("AzureAD refused the security key assertion with status %s", res.Status)
+	}
+
+	return res, nil
+}
+
+// toBase64URL the credential ID, which AzureAD lists in standard base64, in the unpadded base64url of the assertion
+func toBase64URL(id string) (string, error) {
+	id = strings.TrimRight(id, "=")
+
+	data, err := base64.RawStdEncoding.DecodeString(id)
+	if err != nil {
+		data, err = base64.RawURLEncoding.DecodeString(id)
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,76 @@
+package aad
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
+	u2fhost "github.com/marshallbrekka/go-u2fhost"
+	"github.com/stretchr/testify/require"
+)
+
+type mockFinder struct {
+	device u2fhost.Device
+}
+
+func (m *mockFinder) FindDevices() ([]u2fhost.Device, error) {
+	return []u2fhost.Device{m.device}, nil
+}
+
+func TestProcessFido(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+		require.Equal(t, "/common/login", r.URL.Path)
+		require.Equal(t, "23", r.PostForm.Get("type"))
+		require.Equal(t, "flow-token", r.PostForm.Get("flowToken"))
+		require.Equal(t, "context", r.PostForm.Get("ctx"))
+
+		var assertion fidoAssertion
+		require.Nil(t, json.Unmarshal([]byte(r.PostForm.Get("assertion")), &assertion))
+		require.Equal(t, "a2V5LT_-", assertion.ID)
+		require.Equal(t, base64.RawURLEncoding.EncodeToString([]byte("signature")), assertion.Signature)
+
+		w.Write([]byte("<html><head><title>Working...</title></head></html>"))
+	}))
+	defer ts.Close()
+
+	device := &mocks.U2FDevice{}
+	device.On("Authenticate", &u2fhost.AuthenticateRequest{
+		Challenge: "Y2hhbGxlbmdl",
+		AppId:     fidoRPID,
+		Facet:     "https://" + fidoRPID,
+		KeyHandle: "a2V5LT_-",
+		WebAuthn:  true,
+	}).Return(&u2fhost.AuthenticateResponse{
+		KeyHandle:         "a2V5LT_-",
+		ClientData:        base64.RawURLEncoding.EncodeToString([]byte(`{"type":"webauthn.get"}`)),
+		AuthenticatorData: base64.StdEncoding.EncodeToString([]byte("authenticator data")),
+		SignatureData:     base64.StdEncoding.EncodeToString([]byte("signature")),
+	}, nil)
+	device.On("Close").Return()
+
+	ac, err := New(&cfg.IDPAccount{URL: ts.URL})
+	require.Nil(t, err)
+	ac.authenticator = webauthn.NewWithFinder(&mockFinder{device})
+
+	loginPasswordResp := &passwordLoginResponse{
+		URLPost:          ts.URL + "/common/login",
+		SFT:              "flow-token",
+		SCtx:             "context",
+		SFidoChallenge:   "Y2hhbGxlbmdl",
+		ArrFidoAllowList: []string{"a2V5LT/+"},
+	}
+
+	res, err := ac.processFido(loginPasswordResp, "flowToken")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	loginPasswordResp.SFidoChallenge = ""
+	_, err = ac.processFido(loginPasswordResp, "flowToken")
+	require.EqualError(t, err, "AzureAD did not send a security key challenge, the tenant might not allow security keys for this sign in")
+}
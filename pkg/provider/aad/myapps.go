@@ -0,0 +1,113 @@
+package aad
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// myAppsPath the My Apps page the login starts from when the app ID has to be looked up
+	myAppsPath = "/applications/default.aspx"
+
+	// myAppsListPath the My Apps API listing the applications assigned to the signed in user
+	myAppsListPath = "/responsive/api/applications"
+)
+
+// myApp an application assigned to the user in My Apps
+type myApp struct {
+	AppID       string
+	DisplayName string
+}
+
+// startURL the page the login starts from, the federated sign in of the application, or My Apps when only its name is
+// known
+func (ac *Client) startURL(appID string) string {
+	tenant := ""
+	if ac.idpAccount.TenantID != "" {
+		tenant = "tenantId=" + url.QueryEscape(ac.idpAccount.TenantID)
+	}
+
+	if appID == "" {
+		if tenant == "" {
+			return ac.idpAccount.URL + myAppsPath
+		}
+		return ac.idpAccount.URL + myAppsPath + "?" + tenant
+	}
+
+	startURL := fmt.Sprintf("%s/applications/redirecttofederatedapplication.aspx?Operation=LinkedSignIn&applicationId=%s", ac.idpAccount.URL, appID)
+	if tenant != "" {
+		startURL += "&" + tenant
+	}
+	return startURL
+}
+
+// discoverAppID look up the ID of the application with the configured name among the applications My Apps lists for
+// the signed in user
+func (ac *Client) discoverAppID() (string, error) {
+	res, err := ac.client.Get(ac.idpAccount.URL + myAppsListPath)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving My Apps applications")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+	if !gjson.ValidBytes(body) {
+		return "", fmt.Errorf("My Apps returned an unexpected response, status: %s", res.Status)
+	}
+
+	app, err := matchMyApp(parseMyApps(body), ac.idpAccount.AppName)
+	if err != nil {
+		return "", err
+	}
+
+	logger.WithField("appName", app.DisplayName).WithField("appID", app.AppID).Debug("app discovered")
+
+	return app.AppID, nil
+}
+
+func parseMyApps(body []byte) []myApp {
+	var apps []myApp
+
+	gjson.ParseBytes(body).ForEach(func(_, value gjson.Result) bool {
+		apps = append(apps, myApp{
+			AppID:       value.Get("appId").String(),
+			DisplayName: value.Get("displayName").String(),
+		})
+		return true
+	})
+
+	return apps
+}
+
+// matchMyApp find the application with the display name, ignoring case
+func matchMyApp(apps []myApp, name string) (myApp, error) {
+	var matches []myApp
+	var names []string
+
+	for _, app := range apps {
+		if strings.EqualFold(strings.TrimSpace(app.DisplayName), strings.TrimSpace(name)) {
+			matches = append(matches, app)
+		}
+		names = append(names, app.DisplayName)
+	}
+
+	switch len(matches) {
+	case 0:
+		if len(names) == 0 {
+			return myApp{}, fmt.Errorf("application %s not found, no applications are assigned to the user", name)
+		}
+		return myApp{}, fmt.Errorf("application %s not found, choose one of: %s", name, strings.Join(names, ", "))
+	case 1:
+		return matches[0], nil
+	}
+
+	return myApp{}, fmt.Errorf("application name %s is shared by %d applications, set app_id instead", name, len(matches))
+}
@@ -0,0 +1,59 @@
+package aad
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/stretchr/testify/require"
+)
+
+const myAppsResponse = `[
+  {"appId":"0b4a1c2d-8e5f-4a6b-9c7d-1e2f3a4b5c6d","displayName":"Alibaba Cloud","logoUrl":""},
+  {"appId":"5f6e7d8c-9b0a-4c1d-8e2f-3a4b5c6d7e8f","displayName":"Alibaba Cloud International","logoUrl":""},
+  {"appId":"9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d","displayName":"Expenses","logoUrl":""}
+]`
+
+func TestStartURL(t *testing.T) {
+	ac := &Client{idpAccount: &cfg.IDPAccount{URL: "https://account.activedirectory.windowsazure.com", AppName: "Alibaba Cloud"}}
+
+	require.Equal(t, "https://account.activedirectory.windowsazure.com/applications/default.aspx", ac.startURL(""))
+	require.Equal(t, "https://account.activedirectory.windowsazure.com/applications/redirecttofederatedapplication.aspx?Operation=LinkedSignIn&applicationId=0b4a1c2d", ac.startURL("0b4a1c2d"))
+
+	ac.idpAccount.TenantID = "example.com"
+
+	require.Equal(t, "https://account.activedirectory.windowsazure.com/applications/default.aspx?tenantId=example.com", ac.startURL(""))
+	require.Equal(t, "https://account.activedirectory.windowsazure.com/applications/redirecttofederatedapplication.aspx?Operation=LinkedSignIn&applicationId=0b4a1c2d&tenantId=example.com", ac.startURL("0b4a1c2d"))
+}
+
+func TestDiscoverAppID(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, myAppsListPath, r.URL.Path)
+		fmt.Fprint(w, myAppsResponse)
+	}))
+	defer ts.Close()
+
+	ac, err := New(&cfg.IDPAccount{URL: ts.URL, AppName: "alibaba cloud international"})
+	require.Nil(t, err)
+
+	appID, err := ac.discoverAppID()
+	require.Nil(t, err)
+	require.Equal(t, "5f6e7d8c-9b0a-4c1d-8e2f-3a4b5c6d7e8f", appID)
+
+	ac.idpAccount.AppName = "Alibaba Cloud China"
+
+	_, err = ac.discoverAppID()
+	require.EqualError(t, err, "application Alibaba Cloud China not found, choose one of: Alibaba Cloud, Alibaba Cloud International, Expenses")
+}
+
+func TestMatchMyApp(t *testing.T) {
+	_, err := matchMyApp(nil, "Alibaba Cloud")
+	require.EqualError(t, err, "application Alibaba Cloud not found, no applications are assigned to the user")
+
+	apps := append(parseMyApps([]byte(myAppsResponse)), myApp{AppID: "1c2d3e4f", DisplayName: "Expenses"})
+
+	_, err = matchMyApp(apps, "Expenses")
+	require.EqualError(t, err, "application name Expenses is shared by 2 applications, set app_id instead")
+}
@@ -0,0 +1,82 @@
+package aad
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/pkg/errors"
+)
+
+// tapPageID the page AzureAD returns to users signing in with a Temporary Access Pass
+const tapPageID = "ConvergedTAP"
+
+// extractConfig the $Config object embedded in the javascript of the AzureAD pages, empty when there is none
+func extractConfig(body string) string {
+	if !strings.Contains(body, "$Config") {
+		return ""
+	}
+	startIndex := strings.Index(body, "$Config=") + 8
+	endIndex := startIndex + strings.Index(body[startIndex:], ";")
+	return body[startIndex:endIndex]
+}
+
+// tapConfig the $Config of the page if it asks for a Temporary Access Pass, nil otherwise
+func tapConfig(body string) *startSAMLResponse {
+	configJSON := extractConfig(body)
+	if configJSON == "" {
+		return nil
+	}
+
+	var config startSAMLResponse
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil || config.Pgid != tapPageID {
+		return nil
+	}
+
+	return &config
+}
+
+// processTAP prompt for the Temporary Access Pass AzureAD asks for in place of the password, returning the response
+// of its post which continues like the password login
+func (ac *Client) processTAP(config *startSAMLResponse, pageURL *url.URL, sftName, username string) (*http.Response, error) {
+	accessPass := prompter.Password("Temporary Access Pass")
+	if accessPass == "" {
+		return nil, errors.New("a Temporary Access Pass is required to sign in")
+	}
+
+	urlPost := config.URLPost
+	if strings.HasPrefix(urlPost, "/") {
+		urlPost = pageURL.Scheme + "://" + pageURL.Host + urlPost
+	}
+	urlPost = withTenant(urlPost, ac.idpAccount.TenantID)
+
+	tapValues := url.Values{}
+	tapValues.Set(sftName, config.SFT)
+	tapValues.Set("ctx", config.SCtx)
+	tapValues.Set("login", username)
+	tapValues.Set("accesspass", accessPass)
+
+	tapRequest, err := http.NewRequest("POST", urlPost, strings.NewReader(tapValues.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building temporary access pass request")
+	}
+	tapRequest.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := ac.client.Do(tapRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving temporary access pass results")
+	}
+
+	return res, nil
+}
+
+// tapError the error of the Temporary Access Pass page returned again after the pass was posted
+func tapError(config *startSAMLResponse) error {
+	if config.SErrorCode == "" {
+		return errors.New("the Temporary Access Pass was not accepted")
+	}
+	return fmt.Errorf("the Temporary Access Pass was not accepted, code: %s, please refer to https://login.microsoftonline.com/error?code=%s for more details", config.SErrorCode, config.SErrorCode)
+}
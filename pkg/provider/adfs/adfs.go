@@ -12,6 +12,7 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/duouniversal"
 	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/pkg/errors"
@@ -21,6 +22,7 @@ import (
 type Client struct {
 	client     *provider.HTTPClient
 	idpAccount *cfg.IDPAccount
+	duo        *duouniversal.Prompt
 }
 
 type AuthResponseType int
@@ -31,17 +33,38 @@ const (
 	MFA_PROMPT
 	AZURE_MFA_WAIT
 	AZURE_MFA_SERVER_WAIT
+	DUO_UNIVERSAL_PROMPT
+	CERTIFICATE_AUTH
 )
 
+// maxDuoForms the forms of the Duo adapter posted before giving up, one sends to the prompt and one brings its
+// result back
+const maxDuoForms = 3
+
+// certificateAuthMethod the AuthMethod of the certificate authentication of ADFS, which the chooser page offers in
+// an element of that id
+const certificateAuthMethod = "CertificateAuthentication"
+
+// maxCertForms the forms posted for the certificate authentication before giving up, one to certauth, or port
+// 49443, which asks for the certificate, and the auto posted ones bringing the result back
+const maxCertForms = 3
+
 // New create a new ADFS client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
 	tr := &http.Transport{
 		Proxy:           http.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: idpAccount.SkipVerify, Renegotiation: tls.RenegotiateFreelyAsClient},
+		TLSClientConfig: &tls.Config{Renegotiation: tls.RenegotiateFreelyAsClient},
 	}
 
-	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	// presented to the certificate authentication endpoint, a smart card exported as PFX or a PEM pair
+	certs, err := provider.AccountCertificates(idpAccount)
+	if err != nil {
+		return nil, err
+	}
+	tr.TLSClientConfig.Certificates = certs
+
+	client, err := provider.NewHTTPClient(provider.ScopeSkipVerify(tr, idpAccount.SkipVerifyHostList()), provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
@@ -49,6 +72,7 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 	return &Client{
 		client:     client,
 		idpAccount: idpAccount,
+		duo:        duouniversal.New(client, idpAccount.MFA, idpAccount.MFAWaitTimeout(duouniversal.DefaultTimeout), idpAccount.MFAWaitInterval(duouniversal.DefaultPollInterval)),
 	}, nil
 }
 
@@ -70,6 +94,11 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		return "", errors.Wrap(err, "failed to get adfs page")
 	}
 
+	doc, err = ac.discoverHomeRealm(doc, adfsURL, loginDetails)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to discover home realm")
+	}
+
 	authForm := url.Values{}
 
 	doc.Find("input").Each(func(i int, s *goquery.Selection) {
@@ -93,8 +122,14 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		return samlAssertion, errors.Wrap(err, "failed to submit adfs auth form")
 	}
 
+	duoForms := 0
+	certForms := 0
+
 	for {
 		responseType, samlAssertion, err := checkResponse(doc)
+		if responseType != SAML_RESPONSE && ac.idpAccount.MFA == "Certificate" && doc.Find("#"+certificateAuthMethod).Length() > 0 {
+			responseType = CERTIFICATE_AUTH
+		}
 
 		switch responseType {
 		case SAML_RESPONSE:
@@ -127,7 +162,9 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 					log.Println(instructions)
 				}
 			}
-			time.Sleep(1 * time.Second)
+			if err := ac.client.Sleep(1 * time.Second); err != nil {
+				return samlAssertion, errors.Wrap(err, "error waiting for the mfa approval")
+			}
 			doc, err = ac.submit(authSubmitURL, azureForm)
 			if err != nil {
 				return samlAssertion, errors.Wrap(err, "error retrieving mfa form results")
@@ -138,12 +175,100 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 					return samlAssertion, errors.New(sel.Text())
 				}
 			}
+		case DUO_UNIVERSAL_PROMPT:
+			duoForms++
+			if duoForms > maxDuoForms {
+				return samlAssertion, errors.New("the Duo universal prompt did not complete")
+			}
+			doc, err = ac.duoUniversalPrompt(doc, authSubmitURL, loginDetails)
+			if err != nil {
+				return samlAssertion, errors.Wrap(err, "error verifying Duo MFA")
+			}
+		case CERTIFICATE_AUTH:
+			certForms++
+			if certForms > maxCertForms {
+				return samlAssertion, errors.New("the certificate authentication did not complete, check client_cert is accepted by ADFS")
+			}
+			doc, err = ac.certificateAuth(doc, authSubmitURL)
+			if err != nil {
+				return samlAssertion, errors.Wrap(err, "error authenticating with the client certificate")
+			}
 		case UNKNOWN:
 			return samlAssertion, errors.New("unable to classify response from auth server")
 		}
 	}
 }
 
+// duoUniversalPrompt post the form of the Duo adapter, which redirects to the Duo Universal Prompt when the second
+// factor is still to be done, or carries its result back to ADFS
+func (ac *Client) duoUniversalPrompt(doc *goquery.Document, authSubmitURL string, loginDetails *creds.LoginDetails) (*goquery.Document, error) {
+	duoForm := url.Values{}
+	doc.Find("input").Each(func(i int, s *goquery.Selection) {
+		updatePassthroughFormData(duoForm, s)
+	})
+
+	action, err := formAction(doc, authSubmitURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving Duo adapter form")
+	}
+
+	res, err := ac.post(action, duoForm)
+	if err != nil {
+		return nil, err
+	}
+
+	if duouniversal.IsPrompt(res.Request.URL) {
+		promptDoc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to build document from response")
+		}
+		res, err = ac.duo.Complete(promptDoc, loginDetails)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	doc, err = goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build document from response")
+	}
+	return doc, nil
+}
+
+// certificateAuth choose the certificate authentication, ADFS redirects to its certauth host or port 49443 where
+// client_cert is presented and the auto posted form coming back carries the result
+func (ac *Client) certificateAuth(doc *goquery.Document, authSubmitURL string) (*goquery.Document, error) {
+	if ac.idpAccount.ClientCert == "" {
+		return nil, errors.New("ADFS asks for a certificate, set client_cert")
+	}
+
+	certForm := url.Values{}
+	doc.Find("input").Each(func(i int, s *goquery.Selection) {
+		updatePassthroughFormData(certForm, s)
+	})
+	certForm.Set("AuthMethod", certificateAuthMethod)
+
+	action, err := formAction(doc, authSubmitURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return ac.submit(action, certForm)
+}
+
+// formAction the action of the form of the page resolved against its URL, authSubmitURL when it has none
+func formAction(doc *goquery.Document, authSubmitURL string) (string, error) {
+	formAction, ok := doc.Find("form").Attr("action")
+	if !ok || formAction == "" || doc.Url == nil {
+		return authSubmitURL, nil
+	}
+	ref, err := url.Parse(formAction)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing form action")
+	}
+	return doc.Url.ResolveReference(ref).String(), nil
+}
+
 func (ac *Client) get(url string) (*goquery.Document, error) {
 	res, err := ac.client.Get(url)
 	if err != nil {
@@ -160,6 +285,20 @@ func (ac *Client) get(url string) (*goquery.Document, error) {
 }
 
 func (ac *Client) submit(url string, form url.Values) (*goquery.Document, error) {
+	res, err := ac.post(url, form)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the URL of the page, the Duo adapter redirects to the Duo API hostname
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build document from response")
+	}
+	return doc, nil
+}
+
+func (ac *Client) post(url string, form url.Values) (*http.Response, error) {
 	req, err := http.NewRequest("POST", url, strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, errors.Wrap(err, "error building request")
@@ -172,13 +311,7 @@ func (ac *Client) submit(url string, form url.Values) (*goquery.Document, error)
 		return nil, errors.Wrap(err, "error submitting form")
 
 	}
-	defer res.Body.Close()
-
-	doc, err := goquery.NewDocumentFromReader(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to build document from response")
-	}
-	return doc, nil
+	return res, nil
 }
 
 func checkResponse(doc *goquery.Document) (AuthResponseType, string, error) {
@@ -207,6 +340,10 @@ func checkResponse(doc *goquery.Document) (AuthResponseType, string, error) {
 				responseType = AZURE_MFA_WAIT
 			case "AzureMfaServerAuthentication":
 				responseType = AZURE_MFA_SERVER_WAIT
+			case "DuoAdfsAdapter":
+				responseType = DUO_UNIVERSAL_PROMPT
+			case certificateAuthMethod:
+				responseType = CERTIFICATE_AUTH
 			}
 		}
 		if name == "VerificationCode" {
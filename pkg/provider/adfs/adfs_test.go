@@ -0,0 +1,124 @@
+package adfs
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticateWithDuoUniversalPrompt(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/adfs/ls/IdpInitiatedSignOn.aspx":
+			_, _ = w.Write([]byte(`<html><body><form method="post" action="` + ts.URL + `/adfs/ls/login"><input name="UserName" type="email"/><input name="Password" type="password"/><input name="AuthMethod" type="hidden" value="FormsAuthentication"/></form></body></html>`))
+		case "/adfs/ls/login":
+			_, _ = w.Write([]byte(`<html><body><form method="post" action="/adfs/ls/duo"><input name="AuthMethod" type="hidden" value="DuoAdfsAdapter"/><input name="Context" type="hidden" value="duo-context"/></form></body></html>`))
+		case "/adfs/ls/duo":
+			require.Equal(t, "duo-context", r.PostForm.Get("Context"))
+			if r.PostForm.Get("duo_code") == "" {
+				http.Redirect(w, r, "/oauth/v1/authorize?client_id=DIXXXXXXXX", http.StatusFound)
+				return
+			}
+			require.Equal(t, "duo-code", r.PostForm.Get("duo_code"))
+			_, _ = w.Write([]byte(`<html><body><form method="post" action="https://signin.aliyun.com/saml-role/sso"><input type="hidden" name="SAMLResponse" value="PHNhbWw+"/></form></body></html>`))
+		case "/oauth/v1/authorize":
+			http.Redirect(w, r, "/frame/v4/auth/prompt?sid=session-1", http.StatusFound)
+		case "/frame/v4/auth/prompt":
+			_, _ = w.Write([]byte(`<html><body><input type="hidden" name="_xsrf" value="prompt-xsrf-token"></body></html>`))
+		case "/frame/v4/auth/prompt/data":
+			_, _ = w.Write([]byte(`{"stat":"OK","response":{"phones":[{"key":"DPXXXXXXXX","name":"iPhone"}]}}`))
+		case "/frame/v4/prompt":
+			require.Equal(t, "Duo Push", r.PostForm.Get("factor"))
+			_, _ = w.Write([]byte(`{"stat":"OK","response":{"txid":"tx-1"}}`))
+		case "/frame/v4/status":
+			_, _ = w.Write([]byte(`{"stat":"OK","response":{"status_code":"allow"}}`))
+		case "/frame/v4/oidc/exit":
+			// Duo sends the result back to the adapter, which posts it to ADFS
+			_, _ = w.Write([]byte(`<html><body><form method="post" action="/adfs/ls/duo"><input name="AuthMethod" type="hidden" value="DuoAdfsAdapter"/><input name="Context" type="hidden" value="duo-context"/><input name="duo_code" type="hidden" value="duo-code"/></form></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.URL = ts.URL
+	idpAccount.MFA = "Auto"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	assertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL, Username: "user@example.com", Password: "secret", DuoMFAOption: "Duo Push"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWw+", assertion)
+}
+
+func TestAuthenticateWithCertificate(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/adfs/ls/IdpInitiatedSignOn.aspx":
+			_, _ = w.Write([]byte(`<html><body><form method="post" action="` + ts.URL + `/adfs/ls/login"><input name="UserName" type="email"/><input name="Password" type="password"/><input name="AuthMethod" type="hidden" value="FormsAuthentication"/></form></body></html>`))
+		case "/adfs/ls/login":
+			// the chooser of the additional authentication methods
+			_, _ = w.Write([]byte(`<html><body><form method="post" action="/adfs/ls/login?client-request-id=1"><input name="AuthMethod" type="hidden" value=""/><input name="Context" type="hidden" value="cert-context"/></form><div id="AzureMfaAuthentication"></div><div id="CertificateAuthentication"></div></body></html>`))
+		case "/adfs/ls/certauth":
+			require.Len(t, r.TLS.PeerCertificates, 1)
+			require.Equal(t, "device-0001", r.TLS.PeerCertificates[0].Subject.CommonName)
+			require.Equal(t, "cert-context", r.PostForm.Get("Context"))
+			_, _ = w.Write([]byte(`<html><body><form method="post" action="/adfs/ls/result"><input name="AuthMethod" type="hidden" value="CertificateAuthentication"/><input name="Context" type="hidden" value="cert-result"/></form></body></html>`))
+		case "/adfs/ls/result":
+			require.Equal(t, "cert-result", r.PostForm.Get("Context"))
+			_, _ = w.Write([]byte(`<html><body><form method="post" action="https://signin.aliyun.com/saml-role/sso"><input type="hidden" name="SAMLResponse" value="PHNhbWw+"/></form></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	ts.Config.Handler = redirectCertificateAuth(ts.Config.Handler)
+	ts.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.URL = ts.URL
+	idpAccount.SkipVerify = true
+	idpAccount.MFA = "Certificate"
+
+	// without client_cert the certificate authentication can't be done
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL, Username: "user@example.com", Password: "secret"})
+	require.EqualError(t, err, "error authenticating with the client certificate: ADFS asks for a certificate, set client_cert")
+
+	idpAccount.ClientCert = "../example/device.pfx"
+	idpAccount.ClientKeyPIN = "1234"
+
+	client, err = New(idpAccount)
+	require.Nil(t, err)
+
+	assertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL, Username: "user@example.com", Password: "secret"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWw+", assertion)
+}
+
+// redirectCertificateAuth send the choice of the certificate authentication to certauth like ADFS, keeping the form
+// with a 307
+func redirectCertificateAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/adfs/ls/login" && r.Method == "POST" && r.FormValue("AuthMethod") == "CertificateAuthentication" {
+			http.Redirect(w, r, "/adfs/ls/certauth", http.StatusTemporaryRedirect)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,165 @@
+package adfs
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/pkg/errors"
+)
+
+// maxHomeRealmPages the home realm discovery pages followed before giving up, a claims provider may
+// present its own after the one of the farm
+const maxHomeRealmPages = 3
+
+var hrdSelectionRegexp = regexp.MustCompile(`HRD\.selection\('([^']*)'\)`)
+
+// homeRealm a claims provider offered on the home realm discovery page
+type homeRealm struct {
+	ID   string
+	Name string
+}
+
+// homeRealmPage the home realm discovery form
+type homeRealmPage struct {
+	action string
+	form   url.Values
+	realms []homeRealm
+	email  bool
+}
+
+// parseHomeRealmPage the home realm discovery form of the page, false when it isn't one
+func parseHomeRealmPage(doc *goquery.Document) (*homeRealmPage, bool) {
+	sel := doc.Find(`input[name="HomeRealmSelection"]`)
+	if sel.Length() == 0 {
+		return nil, false
+	}
+
+	formSel := sel.Closest("form")
+	page := &homeRealmPage{
+		action: formSel.AttrOr("action", ""),
+		form:   url.Values{},
+	}
+
+	formSel.Find("input").Each(func(i int, s *goquery.Selection) {
+		name := s.AttrOr("name", "")
+		switch {
+		case name == "HomeRealmSelection":
+		case strings.EqualFold(name, "Email"):
+			page.email = true
+		default:
+			updatePassthroughFormData(page.form, s)
+		}
+	})
+
+	doc.Find("[onclick]").Each(func(i int, s *goquery.Selection) {
+		match := hrdSelectionRegexp.FindStringSubmatch(s.AttrOr("onclick", ""))
+		if match == nil {
+			return
+		}
+		name := strings.TrimSpace(s.AttrOr("aria-label", ""))
+		if name == "" {
+			name = strings.TrimSpace(s.Find(".idpDescription").Text())
+		}
+		if name == "" {
+			name = match[1]
+		}
+		page.realms = append(page.realms, homeRealm{ID: match[1], Name: name})
+	})
+
+	return page, true
+}
+
+// chooseHomeRealm the realm matching the configured home_realm by name or identifier, the only one offered,
+// or the one picked by the user
+func chooseHomeRealm(realms []homeRealm, configured string) (homeRealm, error) {
+	if len(realms) == 0 {
+		return homeRealm{}, errors.New("no home realm offered on the home realm discovery page")
+	}
+
+	if configured != "" {
+		names := make([]string, len(realms))
+		for i, realm := range realms {
+			if strings.EqualFold(realm.ID, configured) || strings.EqualFold(realm.Name, configured) {
+				return realm, nil
+			}
+			names[i] = realm.Name
+		}
+		return homeRealm{}, fmt.Errorf("home realm %s not offered, choose one of: %s", configured, strings.Join(names, ", "))
+	}
+
+	if len(realms) == 1 {
+		return realms[0], nil
+	}
+
+	names := make([]string, len(realms))
+	for i, realm := range realms {
+		names[i] = realm.Name
+	}
+	return realms[prompter.Choose("Select your home realm", names)], nil
+}
+
+// discoverHomeRealm answer the home realm discovery pages until the sign in page of the chosen realm is reached
+func (ac *Client) discoverHomeRealm(doc *goquery.Document, pageURL string, loginDetails *creds.LoginDetails) (*goquery.Document, error) {
+	for i := 0; i < maxHomeRealmPages; i++ {
+		page, ok := parseHomeRealmPage(doc)
+		if !ok {
+			return doc, nil
+		}
+
+		form := page.form
+		if len(page.realms) == 0 && page.email {
+			// discovery by email suffix rather than from a list
+			form.Set("Email", loginDetails.Username)
+		} else {
+			realm, err := chooseHomeRealm(page.realms, ac.idpAccount.HomeRealm)
+			if err != nil {
+				return nil, err
+			}
+			form.Set("HomeRealmSelection", realm.ID)
+		}
+
+		base, err := url.Parse(pageURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing home realm discovery page url")
+		}
+		action, err := base.Parse(page.action)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing home realm discovery form action")
+		}
+
+		doc, pageURL, err = ac.submitFollow(action.String(), form)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to submit home realm discovery form")
+		}
+	}
+
+	return nil, errors.New("too many home realm discovery pages")
+}
+
+// submitFollow submit the form, returning the page along with its URL once redirects are followed
+func (ac *Client) submitFollow(url string, form url.Values) (*goquery.Document, string, error) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error building request")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := ac.client.Do(req)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error submitting form")
+	}
+	defer res.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to build document from response")
+	}
+	return doc, res.Request.URL.String(), nil
+}
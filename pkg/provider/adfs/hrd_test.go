@@ -0,0 +1,100 @@
+package adfs
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+func loadHomeRealmPage(t *testing.T) *goquery.Document {
+	f, err := os.Open("example/hrd.html")
+	require.Nil(t, err)
+	defer f.Close()
+
+	doc, err := goquery.NewDocumentFromReader(f)
+	require.Nil(t, err)
+	return doc
+}
+
+func TestParseHomeRealmPage(t *testing.T) {
+	page, ok := parseHomeRealmPage(loadHomeRealmPage(t))
+	require.True(t, ok)
+	require.Equal(t, "/adfs/ls/IdpInitiatedSignOn.aspx?loginToRp=urn%3aalibaba%3acloudcomputing&client-request-id=3f1c2a4e-0000-0000-8a00-0080000000c1", page.action)
+	require.Equal(t, "hrd-context", page.form.Get("Context"))
+	require.Equal(t, []homeRealm{
+		{ID: "AD AUTHORITY", Name: "Corp employees"},
+		{ID: "http://sts.partner.example/adfs/services/trust", Name: "Partners"},
+	}, page.realms)
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<form action="/adfs/ls"><input name="UserName"/></form>`))
+	require.Nil(t, err)
+	_, ok = parseHomeRealmPage(doc)
+	require.False(t, ok)
+}
+
+func TestChooseHomeRealm(t *testing.T) {
+	realms := []homeRealm{
+		{ID: "AD AUTHORITY", Name: "Corp employees"},
+		{ID: "http://sts.partner.example/adfs/services/trust", Name: "Partners"},
+	}
+
+	realm, err := chooseHomeRealm(realms, "partners")
+	require.Nil(t, err)
+	require.Equal(t, realms[1], realm)
+
+	realm, err = chooseHomeRealm(realms, "ad authority")
+	require.Nil(t, err)
+	require.Equal(t, realms[0], realm)
+
+	_, err = chooseHomeRealm(realms, "Contractors")
+	require.EqualError(t, err, "home realm Contractors not offered, choose one of: Corp employees, Partners")
+
+	realm, err = chooseHomeRealm(realms[:1], "")
+	require.Nil(t, err)
+	require.Equal(t, realms[0], realm)
+}
+
+func TestAuthenticateWithHomeRealmDiscovery(t *testing.T) {
+	hrd, err := ioutil.ReadFile("example/hrd.html")
+	require.Nil(t, err)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET":
+			_, _ = w.Write(hrd)
+		case r.URL.Path == "/adfs/ls/IdpInitiatedSignOn.aspx":
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "http://sts.partner.example/adfs/services/trust", r.PostForm.Get("HomeRealmSelection"))
+			require.Equal(t, "hrd-context", r.PostForm.Get("Context"))
+			_, _ = w.Write([]byte(`<html><body><form method="post" action="` + ts.URL + `/adfs/ls/login"><input name="UserName" type="email"/><input name="Password" type="password"/><input name="AuthMethod" type="hidden" value="FormsAuthentication"/></form></body></html>`))
+		case r.URL.Path == "/adfs/ls/login":
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "user@partner.example", r.PostForm.Get("UserName"))
+			require.Equal(t, "secret", r.PostForm.Get("Password"))
+			_, _ = w.Write([]byte(`<html><body><form method="post" action="https://signin.aliyun.com/saml-role/sso"><input type="hidden" name="SAMLResponse" value="PHNhbWw+"/></form></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.URL = ts.URL
+	idpAccount.HomeRealm = "Partners"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	assertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL, Username: "user@partner.example", Password: "secret"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWw+", assertion)
+}
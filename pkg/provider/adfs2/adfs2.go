@@ -12,6 +12,7 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,10 +27,10 @@ type Client struct {
 // New new adfs2 client with ntlmssp configured
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 	transport := &ntlmssp.Negotiator{
-		RoundTripper: &http.Transport{
+		RoundTripper: provider.ScopeSkipVerify(&http.Transport{
 			Proxy:           http.ProxyFromEnvironment,
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: idpAccount.SkipVerify, Renegotiation: tls.RenegotiateFreelyAsClient},
-		},
+			TLSClientConfig: &tls.Config{Renegotiation: tls.RenegotiateFreelyAsClient},
+		}, idpAccount.SkipVerifyHostList()),
 	}
 
 	jar, err := cookiejar.New(&cookiejar.Options{
@@ -33,6 +33,9 @@ const (
 
 var logger = logrus.WithField("provider", "akamai")
 
+// duoPollInterval the wait between the checks of the status of a duo push
+var duoPollInterval = 3 * time.Second
+
 var (
 	supportedMfaOptions = map[string]MfaUserOption{
 		IdentifierDuoMfa:   {"DUO MFA authentication", "duo"},
@@ -80,7 +83,7 @@ type MfaTokenVerify struct {
 // New creates a new Akamai client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewAccountTransport(idpAccount)
 
 	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
@@ -488,187 +491,182 @@ func verifyMfa(oc *Client, akamaiOrgHost string, loginDetails *creds.LoginDetail
 
 		if loginDetails.DuoMFAOption == "Duo Push" {
 			duoMfaOption = 0
-		} else if loginDetails.DuoMFAOption == "Passcode" {
+		} else if loginDetails.DuoMFAOption == "Passcode" || loginDetails.MFAToken != "" {
 			duoMfaOption = 1
 		} else {
 			duoMfaOption = prompter.Choose("Select a DUO MFA Option", duoMfaOptions)
 		}
 
 		if duoMfaOptions[duoMfaOption] == "Passcode" {
-			//get users DUO MFA Token
-			token = prompter.StringRequired("Enter passcode")
-		}
-
-		// send mfa auth request
-		duoSubmitURL = fmt.Sprintf("https://%s/frame/prompt", duoHost)
-
-		duoForm = url.Values{}
-		duoForm.Add("sid", duoSID)
-		duoForm.Add("device", "phone1")
-		duoForm.Add("factor", duoMfaOptions[duoMfaOption])
-		duoForm.Add("out_of_date", "false")
-		if duoMfaOptions[duoMfaOption] == "Passcode" {
-			duoForm.Add("passcode", token)
+			//get users DUO MFA Token, from a hardware token or generated by Duo Mobile
+			token = loginDetails.MFAToken
+			if token == "" {
+				token = prompter.StringRequired("Enter passcode")
+			}
 		}
 
-		req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
+		duoTxCookie, err := oc.duoTransaction(duoHost, duoSID, duoMfaOptions[duoMfaOption], token)
 		if err != nil {
-			return errors.Wrap(err, "error building duo prompt request")
+			return err
 		}
 
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		// callback to Akamai to verify
 
-		res, err = oc.client.Do(req)
+		mfaVerifyURL := fmt.Sprintf("https://%s/api/v1/mfa/user/%s/token/verify", akamaiOrgHost, mfa)
+		mfaDuoSigResponse := fmt.Sprintf("%s:%s", duoTxCookie, duoSignatures[1])
+		mfaVerifyData := MfaTokenVerify{Category: mfa, Uuid: mfa,
+			DuoSigRequest: duoSignature, DuoSigResponse: mfaDuoSigResponse}
+		mfaVerifyBody := new(bytes.Buffer)
+		err = json.NewEncoder(mfaVerifyBody).Encode(mfaVerifyData)
 		if err != nil {
-			return errors.Wrap(err, "error retrieving duo prompt request")
+			return errors.Wrap(err, "error encoding duo mfa verify req")
 		}
-
-		body, err = ioutil.ReadAll(res.Body)
+		mfaVerifyReq, err := http.NewRequest("POST", mfaVerifyURL, mfaVerifyBody)
 		if err != nil {
-			return errors.Wrap(err, "error retrieving duo prompt response")
-		}
-
-		resp := string(body)
-
-		duoTxStat := gjson.Get(resp, "stat").String()
-		duoTxID := gjson.Get(resp, "response.txid").String()
-		if duoTxStat != "OK" {
-			return errors.Wrap(err, "error authenticating duo mfa device")
+			return errors.Wrap(err, "error creating duo mfa verification request")
 		}
 
-		// get duo cookie
-		duoSubmitURL = fmt.Sprintf("https://%s/frame/status", duoHost)
-
-		duoForm = url.Values{}
-		duoForm.Add("sid", duoSID)
-		duoForm.Add("txid", duoTxID)
+		mfaVerifyReq.Header.Add("Content-Type", "application/json")
+		mfaVerifyReq.Header.Add("Accept", "application/json")
+		mfaVerifyReq.Header.Add("xsrf", string(xsrfToken))
 
-		req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
+		res, err = oc.client.Do(mfaVerifyReq)
 		if err != nil {
-			return errors.Wrap(err, "error building duo status request")
+			return errors.Wrap(err, "error sending duo mfa request to EAA ")
 		}
 
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-		res, err = oc.client.Do(req)
+		body, err = ioutil.ReadAll(res.Body)
 		if err != nil {
-			return errors.Wrap(err, "error sending duo status request")
+			return errors.Wrap(err, "error retrieving duo mfa response ")
 		}
 
-		body, err = ioutil.ReadAll(res.Body)
-		if err != nil {
-			return errors.Wrap(err, "error retrieving duo status response")
+		mfaResStatus := gjson.GetBytes(body, "status").String()
+		if mfaResStatus != "200" {
+			return errors.Wrap(err, "Unable to verify mfa token")
 		}
 
-		resp = string(body)
+		return nil
 
-		duoTxResult := gjson.Get(resp, "response.result").String()
-		duoResultURL := gjson.Get(resp, "response.result_url").String()
+	}
 
-		log.Println(gjson.Get(resp, "response.status").String())
+	return errors.New("no mfa options provided")
 
-		if duoTxResult != "SUCCESS" {
-			//poll as this is likely a push request
-			for {
-				time.Sleep(3 * time.Second)
+}
+
+// duoTransaction submit the factor to the duo frame of sid and wait for its status, a passcode is checked at once
+// while a push is polled until it is answered, returns the cookie signing the duo response
+func (oc *Client) duoTransaction(duoHost, duoSID, factor, passcode string) (string, error) {
+	// send mfa auth request
+	duoSubmitURL := fmt.Sprintf("https://%s/frame/prompt", duoHost)
 
-				req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
-				if err != nil {
-					return errors.Wrap(err, "error building authentication request")
-				}
+	duoForm := url.Values{}
+	duoForm.Add("sid", duoSID)
+	duoForm.Add("device", "phone1")
+	duoForm.Add("factor", factor)
+	duoForm.Add("out_of_date", "false")
+	if factor == "Passcode" {
+		duoForm.Add("passcode", passcode)
+	}
 
-				req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req, err := http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "error building duo prompt request")
+	}
 
-				res, err = oc.client.Do(req)
-				if err != nil {
-					return errors.Wrap(err, "error retrieving verify response")
-				}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-				body, err = ioutil.ReadAll(res.Body)
-				if err != nil {
-					return errors.Wrap(err, "error retrieving body from response")
-				}
+	res, err := oc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving duo prompt request")
+	}
 
-				resp := string(body)
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving duo prompt response")
+	}
 
-				duoTxResult = gjson.Get(resp, "response.result").String()
-				duoResultURL = gjson.Get(resp, "response.result_url").String()
+	resp := string(body)
 
-				log.Println(gjson.Get(resp, "response.status").String())
+	duoTxStat := gjson.Get(resp, "stat").String()
+	duoTxID := gjson.Get(resp, "response.txid").String()
+	if duoTxStat != "OK" {
+		return "", errors.Errorf("error authenticating duo mfa device: %s", gjson.Get(resp, "message").String())
+	}
 
-				if duoTxResult == "FAILURE" {
-					return errors.Wrap(err, "failed to authenticate device")
-				}
+	// get duo cookie
+	duoSubmitURL = fmt.Sprintf("https://%s/frame/status", duoHost)
 
-				if duoTxResult == "SUCCESS" {
-					break
-				}
-			}
-		}
+	duoForm = url.Values{}
+	duoForm.Add("sid", duoSID)
+	duoForm.Add("txid", duoTxID)
 
-		duoRequestURL := fmt.Sprintf("https://%s%s", duoHost, duoResultURL)
-		req, err = http.NewRequest("POST", duoRequestURL, strings.NewReader(duoForm.Encode()))
+	var duoResultURL string
+	for {
+		req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
 		if err != nil {
-			return errors.Wrap(err, "error constructing request object to result url")
+			return "", errors.Wrap(err, "error building duo status request")
 		}
 
 		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
 		res, err = oc.client.Do(req)
 		if err != nil {
-			return errors.Wrap(err, "error retrieving duo result response")
+			return "", errors.Wrap(err, "error sending duo status request")
 		}
 
 		body, err = ioutil.ReadAll(res.Body)
 		if err != nil {
-			return errors.Wrap(err, "duoResultSubmit: error retrieving body from response")
+			return "", errors.Wrap(err, "error retrieving duo status response")
 		}
 
 		resp = string(body)
-		duoTxCookie := gjson.Get(resp, "response.cookie").String()
-		if duoTxCookie == "" {
-			return errors.Wrap(err, "duoResultSubmit: Unable to get response.cookie")
-		}
-
-		// callback to Akamai to verify
 
-		mfaVerifyURL := fmt.Sprintf("https://%s/api/v1/mfa/user/%s/token/verify", akamaiOrgHost, mfa)
-		mfaDuoSigResponse := fmt.Sprintf("%s:%s", duoTxCookie, duoSignatures[1])
-		mfaVerifyData := MfaTokenVerify{Category: mfa, Uuid: mfa,
-			DuoSigRequest: duoSignature, DuoSigResponse: mfaDuoSigResponse}
-		mfaVerifyBody := new(bytes.Buffer)
-		err = json.NewEncoder(mfaVerifyBody).Encode(mfaVerifyData)
-		if err != nil {
-			return errors.Wrap(err, "error encoding duo mfa verify req")
-		}
-		mfaVerifyReq, err := http.NewRequest("POST", mfaVerifyURL, mfaVerifyBody)
-		if err != nil {
-			return errors.Wrap(err, "error creating duo mfa verification request")
-		}
+		duoTxResult := gjson.Get(resp, "response.result").String()
+		duoResultURL = gjson.Get(resp, "response.result_url").String()
+		duoTxStatus := gjson.Get(resp, "response.status").String()
 
-		mfaVerifyReq.Header.Add("Content-Type", "application/json")
-		mfaVerifyReq.Header.Add("Accept", "application/json")
-		mfaVerifyReq.Header.Add("xsrf", string(xsrfToken))
+		log.Println(duoTxStatus)
 
-		res, err = oc.client.Do(mfaVerifyReq)
-		if err != nil {
-			return errors.Wrap(err, "error sending duo mfa request to EAA ")
+		if duoTxResult == "SUCCESS" {
+			break
 		}
 
-		body, err = ioutil.ReadAll(res.Body)
-		if err != nil {
-			return errors.Wrap(err, "error retrieving duo mfa response ")
+		if duoTxResult == "FAILURE" {
+			if factor == "Passcode" {
+				return "", errors.Errorf("duo rejected the passcode: %s", duoTxStatus)
+			}
+			return "", errors.Errorf("failed to authenticate device: %s", duoTxStatus)
 		}
 
-		mfaResStatus := gjson.GetBytes(body, "status").String()
-		if mfaResStatus != "200" {
-			return errors.Wrap(err, "Unable to verify mfa token")
+		//poll as this is likely a push request
+		if err := oc.client.Sleep(duoPollInterval); err != nil {
+			return "", errors.Wrap(err, "error waiting for the duo approval")
 		}
+	}
 
-		return nil
+	duoRequestURL := fmt.Sprintf("https://%s%s", duoHost, duoResultURL)
+	req, err = http.NewRequest("POST", duoRequestURL, strings.NewReader(duoForm.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "error constructing request object to result url")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
+	res, err = oc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving duo result response")
 	}
 
-	return errors.New("no mfa options provided")
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "duoResultSubmit: error retrieving body from response")
+	}
+
+	resp = string(body)
+	duoTxCookie := gjson.Get(resp, "response.cookie").String()
+	if duoTxCookie == "" {
+		return "", errors.New("duoResultSubmit: Unable to get response.cookie")
+	}
 
+	return duoTxCookie, nil
 }
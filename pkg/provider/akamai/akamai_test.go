@@ -0,0 +1,48 @@
+package akamai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuoTransactionPasscode(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+		require.Equal(t, "sid123", r.PostForm.Get("sid"))
+
+		switch r.URL.Path {
+		case "/frame/prompt":
+			require.Equal(t, "Passcode", r.PostForm.Get("factor"))
+			txid := "tx-" + r.PostForm.Get("passcode")
+			w.Write([]byte(`{"stat":"OK","response":{"txid":"` + txid + `"}}`))
+		case "/frame/status":
+			if r.PostForm.Get("txid") != "tx-123456" {
+				w.Write([]byte(`{"stat":"OK","response":{"result":"FAILURE","status":"Incorrect passcode. Please try again."}}`))
+				return
+			}
+			w.Write([]byte(`{"stat":"OK","response":{"result":"SUCCESS","status":"Success. Logging you in...","result_url":"/frame/status/tx-123456"}}`))
+		case "/frame/status/tx-123456":
+			w.Write([]byte(`{"stat":"OK","response":{"cookie":"AUTH|duo-cookie"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{URL: ts.URL, SkipVerify: true})
+	require.Nil(t, err)
+
+	duoHost := strings.TrimPrefix(ts.URL, "https://")
+
+	cookie, err := client.duoTransaction(duoHost, "sid123", "Passcode", "123456")
+	require.Nil(t, err)
+	require.Equal(t, "AUTH|duo-cookie", cookie)
+
+	_, err = client.duoTransaction(duoHost, "sid123", "Passcode", "000000")
+	require.EqualError(t, err, "duo rejected the passcode: Incorrect passcode. Please try again.")
+}
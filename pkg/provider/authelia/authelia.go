@@ -0,0 +1,252 @@
+package authelia
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+var logger = logrus.WithField("provider", "authelia")
+
+// Client wrapper around Authelia protecting a SAML IdP
+type Client struct {
+	client *provider.HTTPClient
+	mfa    string
+}
+
+// New create a new Authelia client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		mfa:    idpAccount.MFA,
+	}, nil
+}
+
+// Authenticate logs into the Authelia portal through its first and second factor API, then follows the SAML flow
+// of the protected IdP and returns a SAML response
+func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := ac.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build document from response")
+	}
+
+	// already authenticated, for example with a remembered session
+	if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+		return samlAssertion, nil
+	}
+
+	portal := portalURL(doc.Url)
+
+	targetURL := doc.Url.Query().Get("rd")
+	if targetURL == "" {
+		targetURL = loginDetails.URL
+	}
+
+	logger.WithField("portal", portal).Debug("authenticating with the Authelia portal")
+
+	redirect, err := ac.firstFactor(portal, targetURL, loginDetails)
+	if err != nil {
+		return "", err
+	}
+
+	// the target only requires the first factor when a redirect is already returned
+	if redirect == "" {
+		redirect, err = ac.secondFactor(portal, targetURL, loginDetails)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if redirect == "" {
+		redirect = targetURL
+	}
+
+	return ac.completeFlow(redirect)
+}
+
+func (ac *Client) firstFactor(portal, targetURL string, loginDetails *creds.LoginDetails) (string, error) {
+	resp, err := ac.call(portal+"api/firstfactor", map[string]interface{}{
+		"username":       loginDetails.Username,
+		"password":       loginDetails.Password,
+		"keepMeLoggedIn": false,
+		"targetURL":      targetURL,
+		"requestMethod":  "GET",
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error authenticating first factor")
+	}
+
+	return gjson.Get(resp, "data.redirect").String(), nil
+}
+
+// secondFactor complete the second factor with the configured method, Auto uses the preferred method of the user
+func (ac *Client) secondFactor(portal, targetURL string, loginDetails *creds.LoginDetails) (string, error) {
+	method := strings.ToLower(ac.mfa)
+	if method == "" || method == "auto" {
+		info, err := ac.get(portal + "api/user/info")
+		if err != nil {
+			return "", errors.Wrap(err, "error retrieving user info")
+		}
+		method = gjson.Get(info, "data.method").String()
+	}
+
+	logger.WithField("method", method).Debug("authenticating second factor")
+
+	var resp string
+	var err error
+
+	switch method {
+	case "totp":
+		token := loginDetails.MFAToken
+		if token == "" {
+			token = prompter.RequestSecurityCode("000000")
+		}
+		resp, err = ac.call(portal+"api/secondfactor/totp", map[string]interface{}{
+			"token":     token,
+			"targetURL": targetURL,
+		})
+	case "mobile_push", "duo":
+		// the request returns once the push has been answered
+		resp, err = ac.call(portal+"api/secondfactor/duo", map[string]interface{}{
+			"targetURL": targetURL,
+		})
+	default:
+		return "", fmt.Errorf("unsupported Authelia second factor method: %s", method)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "error authenticating second factor")
+	}
+
+	return gjson.Get(resp, "data.redirect").String(), nil
+}
+
+// completeFlow follow the protected IdP, submitting the auto posted forms, until the SAML response is found
+func (ac *Client) completeFlow(location string) (string, error) {
+	res, err := ac.client.Get(location)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving SAML flow")
+	}
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		form, err := page.NewFormFromDocument(doc, "form[method=\"post\"], form[method=\"POST\"]")
+		if err != nil {
+			return "", fmt.Errorf("unable to locate SAMLResponse in the page returned by %s", doc.Url.String())
+		}
+
+		action, err := url.Parse(form.URL)
+		if err != nil {
+			return "", errors.Wrap(err, "error resolving form action")
+		}
+		form.URL = doc.Url.ResolveReference(action).String()
+
+		res, err = form.Submit(ac.client)
+		if err != nil {
+			return "", errors.Wrap(err, "error submitting form")
+		}
+	}
+
+	return "", fmt.Errorf("SAML flow did not complete after %d steps", page.MaxSteps)
+}
+
+func (ac *Client) get(location string) (string, error) {
+	req, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+
+	return ac.do(req)
+}
+
+func (ac *Client) call(location string, body interface{}) (string, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", location, bytes.NewReader(data))
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	return ac.do(req)
+}
+
+func (ac *Client) do(req *http.Request) (string, error) {
+	req.Header.Add("Accept", "application/json")
+
+	res, err := ac.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body")
+	}
+
+	resp := string(resBody)
+
+	// failures are reported with a KO status, sometimes along with a 401
+	if status := gjson.Get(resp, "status").String(); status != "OK" {
+		msg := gjson.Get(resp, "message").String()
+		if msg == "" {
+			msg = res.Status
+		}
+		return "", fmt.Errorf("Authelia returned %s: %s", status, msg)
+	}
+
+	return resp, nil
+}
+
+// portalURL the Authelia portal may be served from a sub path, the API lives below it
+func portalURL(u *url.URL) string {
+	p := u.Path
+	if !strings.HasSuffix(p, "/") {
+		p = path.Dir(p)
+		if !strings.HasSuffix(p, "/") {
+			p += "/"
+		}
+	}
+
+	return fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, p)
+}
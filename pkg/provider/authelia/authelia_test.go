@@ -0,0 +1,116 @@
+package authelia
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	portalPage, err := ioutil.ReadFile("example/portal.html")
+	require.Nil(t, err)
+	autopostPage, err := ioutil.ReadFile("example/autopost.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	level := 0
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if r.Method == "POST" && r.Header.Get("Content-Type") == "application/json" {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		}
+
+		switch r.URL.Path {
+		case "/saml/sso":
+			if level < 2 {
+				http.Redirect(w, r, "/auth/?rd="+url.QueryEscape(ts.URL+"/saml/sso"), http.StatusFound)
+				return
+			}
+			w.Write(autopostPage)
+		case "/saml/continue":
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "auth-state", r.PostForm.Get("AuthState"))
+			w.Write(assertionPage)
+		case "/auth/":
+			w.Write(portalPage)
+		case "/auth/api/firstfactor":
+			require.Equal(t, ts.URL+"/saml/sso", body["targetURL"])
+			require.Equal(t, "user", body["username"])
+			require.Equal(t, "secret", body["password"])
+			level = 1
+			w.Write([]byte(`{"status":"OK"}`))
+		case "/auth/api/user/info":
+			require.Equal(t, 1, level)
+			w.Write([]byte(`{"status":"OK","data":{"display_name":"User","method":"totp","has_totp":true,"has_webauthn":false,"has_duo":false}}`))
+		case "/auth/api/secondfactor/totp":
+			require.Equal(t, "123456", body["token"])
+			level = 2
+			w.Write([]byte(`{"status":"OK","data":{"redirect":"` + ts.URL + `/saml/sso"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/saml/sso",
+		Username: "user",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	portalPage, err := ioutil.ReadFile("example/portal.html")
+	require.Nil(t, err)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/saml/sso":
+			http.Redirect(w, r, "/auth/?rd="+url.QueryEscape(ts.URL+"/saml/sso"), http.StatusFound)
+		case "/auth/":
+			w.Write(portalPage)
+		case "/auth/api/firstfactor":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"status":"KO","message":"Authentication failed. Check your credentials."}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/saml/sso",
+		Username: "user",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "error authenticating first factor: Authelia returned KO: Authentication failed. Check your credentials.")
+}
+
+func TestPortalURL(t *testing.T) {
+	u, _ := url.Parse("https://auth.example.com/?rd=https%3A%2F%2Fidp.example.com")
+	require.Equal(t, "https://auth.example.com/", portalURL(u))
+
+	u, _ = url.Parse("https://example.com/authelia/login")
+	require.Equal(t, "https://example.com/authelia/", portalURL(u))
+}
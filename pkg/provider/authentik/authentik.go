@@ -0,0 +1,265 @@
+package authentik
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// maxStages the number of stages a flow may go through before giving up
+const maxStages = 20
+
+var logger = logrus.WithField("provider", "authentik")
+
+// flowPathRegexp matches the flow interface the browser is sent to, capturing the flow slug
+var flowPathRegexp = regexp.MustCompile(`^/if/flow/([^/]+)/?$`)
+
+// Client wrapper around Authentik
+type Client struct {
+	client *provider.HTTPClient
+	mfa    string
+}
+
+// New create a new Authentik client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		mfa:    idpAccount.MFA,
+	}, nil
+}
+
+// Authenticate runs the Authentik authentication and authorization flows through the flow executor API and
+// returns a SAML response
+func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	location := loginDetails.URL
+
+	for step := 0; step < page.MaxSteps; step++ {
+		res, err := ac.client.Get(location)
+		if err != nil {
+			return "", errors.Wrap(err, "error retrieving login page")
+		}
+
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		match := flowPathRegexp.FindStringSubmatch(doc.Url.Path)
+		if match == nil {
+			return "", fmt.Errorf("unexpected page returned by Authentik: %s", doc.Url.String())
+		}
+
+		samlAssertion, next, err := ac.executeFlow(doc.Url, match[1], loginDetails)
+		if err != nil {
+			return "", err
+		}
+		if samlAssertion != "" {
+			return samlAssertion, nil
+		}
+
+		location = next
+	}
+
+	return "", fmt.Errorf("Authentik login did not complete after %d steps", page.MaxSteps)
+}
+
+// executeFlow answer the challenges of the flow until it completes, returning either the SAML response or the
+// location the flow redirects to
+func (ac *Client) executeFlow(flowURL *url.URL, slug string, loginDetails *creds.LoginDetails) (string, string, error) {
+	executorURL := flowURL.ResolveReference(&url.URL{
+		Path:     "/api/v3/flows/executor/" + slug + "/",
+		RawQuery: url.Values{"query": []string{flowURL.RawQuery}}.Encode(),
+	}).String()
+
+	logger.WithField("flow", slug).Debug("executing flow")
+
+	challenge, err := ac.call("GET", executorURL, nil)
+	if err != nil {
+		return "", "", errors.Wrap(err, "error starting flow")
+	}
+
+	for step := 0; step < maxStages; step++ {
+		if err := challengeError(challenge); err != nil {
+			return "", "", err
+		}
+
+		component := gjson.Get(challenge, "component").String()
+		logger.WithField("component", component).Debug("flow challenge")
+
+		var answer map[string]interface{}
+
+		switch component {
+		case "xak-flow-redirect":
+			to, err := page.ResolveURL(flowURL, gjson.Get(challenge, "to").String())
+			return "", to, err
+		case "ak-stage-autosubmit":
+			if samlAssertion := gjson.Get(challenge, "attrs.SAMLResponse").String(); samlAssertion != "" {
+				return samlAssertion, "", nil
+			}
+			return "", "", fmt.Errorf("Authentik autosubmit stage did not contain a SAMLResponse")
+		case "ak-stage-identification":
+			answer = map[string]interface{}{"uid_field": loginDetails.Username}
+			if gjson.Get(challenge, "password_fields").Bool() {
+				answer["password"] = loginDetails.Password
+			}
+		case "ak-stage-password":
+			answer = map[string]interface{}{"password": loginDetails.Password}
+		case "ak-stage-authenticator-validate":
+			answer, err = ac.validateAuthenticator(challenge, loginDetails)
+			if err != nil {
+				return "", "", err
+			}
+		case "ak-stage-consent":
+			answer = map[string]interface{}{"token": gjson.Get(challenge, "token").String()}
+		case "ak-stage-access-denied":
+			return "", "", fmt.Errorf("Authentik denied access: %s", gjson.Get(challenge, "error_message").String())
+		default:
+			return "", "", fmt.Errorf("unsupported Authentik flow stage: %s", component)
+		}
+
+		answer["component"] = component
+
+		challenge, err = ac.call("POST", executorURL, answer)
+		if err != nil {
+			return "", "", errors.Wrapf(err, "error answering %s", component)
+		}
+	}
+
+	return "", "", fmt.Errorf("Authentik flow %s did not complete after %d stages", slug, maxStages)
+}
+
+// validateAuthenticator answer the authenticator validation stage with the device matching the configured MFA,
+// prompting for the device when several are enrolled
+func (ac *Client) validateAuthenticator(challenge string, loginDetails *creds.LoginDetails) (map[string]interface{}, error) {
+	devices := []gjson.Result{}
+	for _, device := range gjson.Get(challenge, "device_challenges").Array() {
+		switch device.Get("device_class").String() {
+		case "totp", "static", "duo":
+			devices = append(devices, device)
+		}
+	}
+
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no supported Authentik authenticator enrolled, TOTP, static tokens or Duo are required")
+	}
+
+	device := devices[0]
+	if len(devices) > 1 {
+		matched := false
+		for _, d := range devices {
+			if strings.EqualFold(d.Get("device_class").String(), ac.mfa) {
+				device, matched = d, true
+				break
+			}
+		}
+		if !matched {
+			options := make([]string, len(devices))
+			for i, d := range devices {
+				options[i] = d.Get("device_class").String()
+			}
+			device = devices[prompter.Choose("Select an authenticator", options)]
+		}
+	}
+
+	if device.Get("device_class").String() == "duo" {
+		// the stage blocks until the push is answered
+		return map[string]interface{}{"duo": device.Get("device_uid").Int()}, nil
+	}
+
+	code := loginDetails.MFAToken
+	if code == "" {
+		code = prompter.RequestSecurityCode("000000")
+	}
+
+	return map[string]interface{}{"code": code}, nil
+}
+
+func (ac *Client) call(method, location string, body interface{}) (string, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	req, err := http.NewRequest(method, location, bytes.NewReader(data))
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Accept", "application/json")
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	// the executor API is protected by the Django CSRF middleware
+	for _, cookie := range ac.client.Jar.Cookies(req.URL) {
+		if cookie.Name == "authentik_csrf" || cookie.Name == "csrftoken" {
+			req.Header.Set("X-authentik-CSRF", cookie.Value)
+			req.Header.Set("X-CSRFToken", cookie.Value)
+		}
+	}
+
+	res, err := ac.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body")
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request for url: %s failed status: %s", location, res.Status)
+	}
+
+	return string(resBody), nil
+}
+
+// challengeError the stage returns the same challenge with response_errors when the answer was rejected
+func challengeError(challenge string) error {
+	messages := []string{}
+	gjson.Get(challenge, "response_errors").ForEach(func(field, errs gjson.Result) bool {
+		for _, e := range errs.Array() {
+			messages = append(messages, e.Get("string").String())
+		}
+		return true
+	})
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("login failed: %s", strings.Join(messages, ", "))
+}
@@ -0,0 +1,133 @@
+package authentik
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+const appPath = "/application/saml/alibaba-cloud/sso/binding/init/"
+
+func TestAuthenticate(t *testing.T) {
+	flowPage, err := ioutil.ReadFile("example/flow.html")
+	require.Nil(t, err)
+	identification, err := ioutil.ReadFile("example/identification.json")
+	require.Nil(t, err)
+	password, err := ioutil.ReadFile("example/password.json")
+	require.Nil(t, err)
+	validate, err := ioutil.ReadFile("example/validate.json")
+	require.Nil(t, err)
+	autosubmit, err := ioutil.ReadFile("example/autosubmit.json")
+	require.Nil(t, err)
+
+	authenticated := false
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case appPath:
+			if !authenticated {
+				http.Redirect(w, r, "/if/flow/default-authentication-flow/?next="+url.QueryEscape(appPath), http.StatusFound)
+				return
+			}
+			http.Redirect(w, r, "/if/flow/default-provider-authorization-implicit-consent/", http.StatusFound)
+		case "/if/flow/default-authentication-flow/", "/if/flow/default-provider-authorization-implicit-consent/":
+			http.SetCookie(w, &http.Cookie{Name: "authentik_csrf", Value: "csrf-token", Path: "/"})
+			w.Write(flowPage)
+		case "/api/v3/flows/executor/default-authentication-flow/":
+			require.Equal(t, "next="+url.QueryEscape(appPath), r.URL.Query().Get("query"))
+			if r.Method == "GET" {
+				w.Write(identification)
+				return
+			}
+
+			require.Equal(t, "csrf-token", r.Header.Get("X-authentik-CSRF"))
+
+			var answer map[string]string
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&answer))
+
+			switch answer["component"] {
+			case "ak-stage-identification":
+				require.Equal(t, "user@example.com", answer["uid_field"])
+				w.Write(password)
+			case "ak-stage-password":
+				require.Equal(t, "secret", answer["password"])
+				w.Write(validate)
+			case "ak-stage-authenticator-validate":
+				require.Equal(t, "123456", answer["code"])
+				authenticated = true
+				w.Write([]byte(`{"type":"redirect","component":"xak-flow-redirect","to":"` + appPath + `"}`))
+			}
+		case "/api/v3/flows/executor/default-provider-authorization-implicit-consent/":
+			require.True(t, authenticated)
+			w.Write(autosubmit)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + appPath,
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	flowPage, err := ioutil.ReadFile("example/flow.html")
+	require.Nil(t, err)
+	identification, err := ioutil.ReadFile("example/identification.json")
+	require.Nil(t, err)
+	password, err := ioutil.ReadFile("example/password.json")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case appPath:
+			http.Redirect(w, r, "/if/flow/default-authentication-flow/?next="+url.QueryEscape(appPath), http.StatusFound)
+		case "/if/flow/default-authentication-flow/":
+			http.SetCookie(w, &http.Cookie{Name: "authentik_csrf", Value: "csrf-token", Path: "/"})
+			w.Write(flowPage)
+		case "/api/v3/flows/executor/default-authentication-flow/":
+			if r.Method == "GET" {
+				w.Write(identification)
+				return
+			}
+
+			var answer map[string]string
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&answer))
+
+			if answer["component"] == "ak-stage-identification" {
+				w.Write(password)
+				return
+			}
+			w.Write([]byte(`{"component":"ak-stage-password","response_errors":{"password":[{"string":"Invalid password","code":"invalid"}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + appPath,
+		Username: "user@example.com",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "login failed: Invalid password")
+}
@@ -0,0 +1,228 @@
+package casdoor
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// nextMfa returned in place of the SAML response when the user has to complete their second factor
+	nextMfa = "NextMfa"
+
+	// totpMfaType the Casdoor name of the authenticator app factor
+	totpMfaType = "app"
+
+	// alibabaCloudSP the entity ID and assertion consumer of Alibaba Cloud role based SSO
+	alibabaCloudSP  = "urn:alibaba:cloudcomputing"
+	alibabaCloudACS = "https://signin.alibabacloud.com/saml-role/sso"
+)
+
+var logger = logrus.WithField("provider", "casdoor")
+
+// Client wrapper around Casdoor
+type Client struct {
+	client *provider.HTTPClient
+	mfa    string
+}
+
+// New create a new Casdoor client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		mfa:    idpAccount.MFA,
+	}, nil
+}
+
+// Authenticate logs into Casdoor through its login API, completing the TOTP second factor when the user has one, and
+// returns the SAML response of the application
+func (cc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	loginURL, err := url.Parse(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing login URL")
+	}
+
+	owner, application, err := parseApplication(loginURL)
+	if err != nil {
+		return "", err
+	}
+
+	base := fmt.Sprintf("%s://%s", loginURL.Scheme, loginURL.Host)
+
+	app, err := cc.call("GET", base+"/api/get-application?id="+url.QueryEscape(owner+"/"+application), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving application")
+	}
+
+	samlRequest := loginURL.Query().Get("SAMLRequest")
+	if samlRequest == "" {
+		samlRequest, err = buildSAMLRequest(loginURL.String())
+		if err != nil {
+			return "", errors.Wrap(err, "error building SAML request")
+		}
+	}
+
+	form := map[string]interface{}{
+		"type":         "saml",
+		"application":  application,
+		"organization": gjson.Get(app, "data.organization").String(),
+		"username":     loginDetails.Username,
+		"password":     loginDetails.Password,
+		"signinMethod": "Password",
+		"autoSignin":   false,
+		"samlRequest":  samlRequest,
+		"relayState":   loginURL.Query().Get("RelayState"),
+	}
+
+	loginAPI := base + "/api/login"
+
+	resp, err := cc.call("POST", loginAPI, form)
+	if err != nil {
+		return "", errors.Wrap(err, "error logging in")
+	}
+
+	if gjson.Get(resp, "data").String() == nextMfa {
+		resp, err = cc.verifyMfa(loginAPI, form, resp, loginDetails)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	samlAssertion := gjson.Get(resp, "data").String()
+	if samlAssertion == "" || samlAssertion == nextMfa {
+		return "", errors.New("no SAML response returned by Casdoor")
+	}
+
+	return samlAssertion, nil
+}
+
+// verifyMfa send the login again along with the TOTP passcode, Auto uses the preferred factor of the user which has
+// to be an authenticator app
+func (cc *Client) verifyMfa(loginAPI string, form map[string]interface{}, resp string, loginDetails *creds.LoginDetails) (string, error) {
+	mfaType := gjson.Get(resp, "data2.mfaType").String()
+	if strings.EqualFold(cc.mfa, "TOTP") {
+		mfaType = totpMfaType
+	}
+
+	logger.WithField("mfaType", mfaType).Debug("verifying second factor")
+
+	if mfaType != totpMfaType {
+		return "", fmt.Errorf("unsupported Casdoor MFA type: %s, set an authenticator app as the preferred MFA method", mfaType)
+	}
+
+	passcode := loginDetails.MFAToken
+	if passcode == "" {
+		passcode = prompter.RequestSecurityCode("000000")
+	}
+
+	form["mfaType"] = mfaType
+	form["passcode"] = passcode
+
+	resp, err := cc.call("POST", loginAPI, form)
+	if err != nil {
+		return "", errors.Wrap(err, "error verifying MFA")
+	}
+
+	return resp, nil
+}
+
+func (cc *Client) call(method, location string, body interface{}) (string, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	req, err := http.NewRequest(method, location, bytes.NewReader(data))
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Accept", "application/json")
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	res, err := cc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body")
+	}
+
+	resp := string(resBody)
+
+	// failures are returned with a 200 and an error status
+	if status := gjson.Get(resp, "status").String(); status != "ok" {
+		msg := gjson.Get(resp, "msg").String()
+		if msg == "" {
+			msg = res.Status
+		}
+		return "", fmt.Errorf("Casdoor returned an error: %s", msg)
+	}
+
+	return resp, nil
+}
+
+// parseApplication the owner and name of the application from its SAML login URL,
+// /login/saml/authorize/<owner>/<application>
+func parseApplication(u *url.URL) (string, string, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("unable to find the application in %s, use the /login/saml/authorize/<owner>/<application> URL", u.String())
+	}
+
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
+
+// buildSAMLRequest an AuthnRequest for Alibaba Cloud encoded for the redirect binding, Alibaba Cloud role based SSO
+// only starts from the IdP so Casdoor is given the request the SP would have sent
+func buildSAMLRequest(destination string) (string, error) {
+	request := fmt.Sprintf(`<samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_%d" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"><saml:Issuer>%s</saml:Issuer></samlp:AuthnRequest>`,
+		time.Now().UnixNano(), time.Now().UTC().Format("2006-01-02T15:04:05Z"), html.EscapeString(destination), alibabaCloudACS, alibabaCloudSP)
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write([]byte(request)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,140 @@
+package casdoor
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	applicationResp, err := ioutil.ReadFile("example/application.json")
+	require.Nil(t, err)
+	mfaResp, err := ioutil.ReadFile("example/mfa.json")
+	require.Nil(t, err)
+	loginResp, err := ioutil.ReadFile("example/login.json")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/get-application":
+			require.Equal(t, "admin/alibabacloud", r.URL.Query().Get("id"))
+			w.Write(applicationResp)
+		case "/api/login":
+			form := map[string]interface{}{}
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&form))
+			require.Equal(t, "saml", form["type"])
+			require.Equal(t, "acme", form["organization"])
+			require.Equal(t, "alibabacloud", form["application"])
+			require.NotEmpty(t, form["samlRequest"])
+			require.Equal(t, "secret", form["password"])
+
+			if form["passcode"] == nil {
+				w.Write(mfaResp)
+				return
+			}
+			require.Equal(t, "123456", form["passcode"])
+			require.Equal(t, "app", form["mfaType"])
+			w.Write(loginResp)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/login/saml/authorize/admin/alibabacloud",
+		Username: "user",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	applicationResp, err := ioutil.ReadFile("example/application.json")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/get-application":
+			w.Write(applicationResp)
+		case "/api/login":
+			w.Write([]byte(`{"status":"error","msg":"password or code is incorrect"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "TOTP"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/login/saml/authorize/admin/alibabacloud",
+		Username: "user",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "error logging in: Casdoor returned an error: password or code is incorrect")
+}
+
+func TestAuthenticateBadPasscode(t *testing.T) {
+	applicationResp, err := ioutil.ReadFile("example/application.json")
+	require.Nil(t, err)
+	mfaResp, err := ioutil.ReadFile("example/mfa.json")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/get-application":
+			w.Write(applicationResp)
+		case "/api/login":
+			form := map[string]interface{}{}
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&form))
+			if form["passcode"] == nil {
+				w.Write(mfaResp)
+				return
+			}
+			w.Write([]byte(`{"status":"error","msg":"passcode is incorrect"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "TOTP"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/login/saml/authorize/admin/alibabacloud",
+		Username: "user",
+		Password: "secret",
+		MFAToken: "000000",
+	})
+	require.EqualError(t, err, "error verifying MFA: Casdoor returned an error: passcode is incorrect")
+}
+
+func TestBuildSAMLRequest(t *testing.T) {
+	samlRequest, err := buildSAMLRequest("https://door.example.com/login/saml/authorize/admin/alibabacloud")
+	require.Nil(t, err)
+
+	deflated, err := base64.StdEncoding.DecodeString(samlRequest)
+	require.Nil(t, err)
+
+	request, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	require.Nil(t, err)
+	require.Contains(t, string(request), "<saml:Issuer>urn:alibaba:cloudcomputing</saml:Issuer>")
+	require.Contains(t, string(request), `AssertionConsumerServiceURL="https://signin.alibabacloud.com/saml-role/sso"`)
+}
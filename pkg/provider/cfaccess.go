@@ -0,0 +1,234 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// cloudflare_access modes, auto uses the one-time PIN when Access offers it and cloudflared otherwise
+const (
+	accessAuto        = "auto"
+	accessOTP         = "otp"
+	accessCloudflared = "cloudflared"
+	accessOff         = "off"
+)
+
+const (
+	// accessLoginPath the path of the Cloudflare Access login page on the team domain
+	accessLoginPath = "/cdn-cgi/access/login"
+
+	// accessCookie the cookie holding the Access token of an application
+	accessCookie = "CF_Authorization"
+
+	// maxAccessSteps the number of Access pages gone through before giving up
+	maxAccessSteps = 5
+)
+
+var (
+	// accessTeamDomain the suffix of the team domains serving the Access login pages, replaced in tests
+	accessTeamDomain = ".cloudflareaccess.com"
+
+	// cloudflaredCommand the cloudflared executable used for identity provider logins, replaced in tests
+	cloudflaredCommand = "cloudflared"
+)
+
+var accessLogger = logrus.WithField("pkg", "cfaccess")
+
+// isAccessLogin check whether the URL is the Cloudflare Access login page of a team domain
+func isAccessLogin(u *url.URL) bool {
+	return u != nil && strings.HasSuffix(strings.ToLower(u.Hostname()), accessTeamDomain) && strings.HasPrefix(u.Path, accessLoginPath)
+}
+
+// passCloudflareAccess complete the Cloudflare Access login when the IdP is published behind Access and the response
+// is its login page, or a redirect to it, then replay the request so the provider carries on with the IdP page
+func (hc *HTTPClient) passCloudflareAccess(req *http.Request, resp *http.Response) (*http.Response, error) {
+	mode := accessAuto
+	if hc.Options != nil && hc.Options.CloudflareAccess != "" {
+		mode = strings.ToLower(hc.Options.CloudflareAccess)
+	}
+	if mode == accessOff {
+		return resp, nil
+	}
+
+	loginURL := accessLoginURL(resp)
+	if loginURL == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	if mode != accessAuto && mode != accessOTP && mode != accessCloudflared {
+		return nil, fmt.Errorf("invalid cloudflare_access: %s, use auto, otp, cloudflared or off", mode)
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return nil, errors.New("Cloudflare Access asked to login in the middle of a form submission, login again")
+	}
+
+	app := &url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host}
+
+	log.Printf("%s is protected by Cloudflare Access, logging in to Access first", app.Host)
+
+	if err := hc.accessLogin(loginURL, app, mode); err != nil {
+		return nil, errors.Wrap(err, "Cloudflare Access login failed")
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+
+	return hc.send(req)
+}
+
+// accessLogin go through the Access login pages, answering the one-time PIN forms or handing the identity provider
+// login over to cloudflared, until Access sends the user back to the application
+func (hc *HTTPClient) accessLogin(loginURL, app *url.URL, mode string) error {
+	// the Access pages are followed whatever the redirect policy of the provider
+	client := &http.Client{Transport: hc.Transport, Jar: hc.Jar}
+
+	if mode == accessCloudflared {
+		return hc.cloudflaredLogin(app)
+	}
+
+	res, err := client.Get(loginURL.String())
+	if err != nil {
+		return errors.Wrap(err, "error retrieving Access login page")
+	}
+
+	emailSent := false
+	codeSubmitted := false
+
+	for step := 0; step < maxAccessSteps; step++ {
+		if !strings.HasSuffix(strings.ToLower(res.Request.URL.Hostname()), accessTeamDomain) {
+			res.Body.Close()
+			accessLogger.WithField("url", res.Request.URL.String()).Debug("back from Cloudflare Access")
+			return nil
+		}
+
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return errors.Wrap(err, "failed to build document from response")
+		}
+
+		switch {
+		case doc.Find("form input[name=\"code\"]").Size() > 0:
+			if codeSubmitted {
+				return fmt.Errorf("the one-time PIN was refused: %s", accessError(doc))
+			}
+			codeSubmitted = true
+			code := prompter.RequestSecurityCode("000000")
+			res, err = submitAccessForm(client, doc, "form:has(input[name=\"code\"])", "code", code)
+		case doc.Find("form input[name=\"email\"]").Size() > 0:
+			if emailSent {
+				return fmt.Errorf("the email was refused: %s", accessError(doc))
+			}
+			if hc.Options == nil || hc.Options.Username == "" {
+				return errors.New("a username is needed to receive the Access one-time PIN")
+			}
+			emailSent = true
+			log.Printf("Cloudflare Access is sending a one-time PIN to %s", hc.Options.Username)
+			res, err = submitAccessForm(client, doc, "form:has(input[name=\"email\"])", "email", hc.Options.Username)
+		case mode == accessAuto:
+			// only identity providers are offered, they need a browser
+			return hc.cloudflaredLogin(app)
+		default:
+			return errors.New("Cloudflare Access doesn't offer a one-time PIN for this application, set cloudflare_access to cloudflared")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("Cloudflare Access login did not complete after %d steps", maxAccessSteps)
+}
+
+// cloudflaredLogin have cloudflared log into Access through the identity provider in a browser, and use the token
+// it fetched as the Access cookie of the application
+func (hc *HTTPClient) cloudflaredLogin(app *url.URL) error {
+	if _, err := exec.LookPath(cloudflaredCommand); err != nil {
+		return errors.New("Cloudflare Access requires an identity provider login, install cloudflared to log in with a browser")
+	}
+
+	log.Printf("Logging in to Cloudflare Access for %s with cloudflared, complete the login in the browser", app.Host)
+
+	var stderr bytes.Buffer
+
+	login := exec.Command(cloudflaredCommand, "access", "login", app.String())
+	login.Stderr = &stderr
+	if err := login.Run(); err != nil {
+		return errors.Wrapf(err, "cloudflared access login failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	out, err := exec.Command(cloudflaredCommand, "access", "token", "-app="+app.String()).Output()
+	if err != nil {
+		return errors.Wrap(err, "cloudflared access token failed")
+	}
+
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return errors.New("cloudflared returned no Access token")
+	}
+
+	hc.Jar.SetCookies(app, []*http.Cookie{{Name: accessCookie, Value: token, Path: "/"}})
+
+	return nil
+}
+
+// accessLoginURL the Access login page the response is, or redirects to, nil when it is neither
+func accessLoginURL(resp *http.Response) *url.URL {
+	if resp.Request != nil && isAccessLogin(resp.Request.URL) {
+		return resp.Request.URL
+	}
+
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if location, err := resp.Location(); err == nil && isAccessLogin(location) {
+			return location
+		}
+	}
+
+	return nil
+}
+
+func submitAccessForm(client *http.Client, doc *goquery.Document, formFilter, name, value string) (*http.Response, error) {
+	formSel := doc.Find(formFilter).First()
+
+	action, err := doc.Url.Parse(formSel.AttrOr("action", ""))
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving Access form action")
+	}
+
+	values := url.Values{}
+	formSel.Find("input[name]").Each(func(i int, s *goquery.Selection) {
+		if val, ok := s.Attr("value"); ok {
+			values.Set(s.AttrOr("name", ""), val)
+		}
+	})
+	values.Set(name, value)
+
+	res, err := client.PostForm(action.String(), values)
+	if err != nil {
+		return nil, errors.Wrap(err, "error submitting Access form")
+	}
+
+	return res, nil
+}
+
+func accessError(doc *goquery.Document) string {
+	msg := strings.TrimSpace(doc.Find(".error, .Error, [role=\"alert\"]").First().Text())
+	if msg == "" {
+		msg = "no reason given"
+	}
+	return msg
+}
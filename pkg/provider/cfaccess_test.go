@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsAccessLogin(t *testing.T) {
+	parse := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		require.Nil(t, err)
+		return u
+	}
+
+	require.True(t, isAccessLogin(parse("https://acme.cloudflareaccess.com/cdn-cgi/access/login/idp.acme.com?kid=abc&redirect_url=%2F")))
+	require.False(t, isAccessLogin(parse("https://acme.cloudflareaccess.com/cdn-cgi/access/callback")))
+	require.False(t, isAccessLogin(parse("https://idp.acme.com/cdn-cgi/access/login")))
+}
+
+func newAccessServers(t *testing.T) (app *httptest.Server, appURL string, access *httptest.Server) {
+	access = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cdn-cgi/access/login/idp":
+			w.Write([]byte(`<html><body><form method="post" action="/cdn-cgi/access/otp-login"><input type="hidden" name="redirect_url" value="` + r.URL.Query().Get("redirect_url") + `"/><input type="email" name="email"/></form></body></html>`))
+		case "/cdn-cgi/access/otp-login":
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "user@example.com", r.PostForm.Get("email"))
+			w.Write([]byte(`<html><body><form method="post" action="/cdn-cgi/access/otp-verify"><input type="hidden" name="redirect_url" value="` + r.PostForm.Get("redirect_url") + `"/><input type="text" name="code"/></form></body></html>`))
+		case "/cdn-cgi/access/otp-verify":
+			require.Nil(t, r.ParseForm())
+			if r.PostForm.Get("code") != "123456" {
+				w.Write([]byte(`<html><body><div class="error">Invalid code</div><form method="post" action="/cdn-cgi/access/otp-verify"><input type="text" name="code"/></form></body></html>`))
+				return
+			}
+			http.Redirect(w, r, appURL+"/cdn-cgi/access/callback?token=granted&redirect_url="+url.QueryEscape(r.PostForm.Get("redirect_url")), http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	app = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cdn-cgi/access/callback" {
+			http.SetCookie(w, &http.Cookie{Name: accessCookie, Value: r.URL.Query().Get("token"), Path: "/"})
+			http.Redirect(w, r, r.URL.Query().Get("redirect_url"), http.StatusFound)
+			return
+		}
+		if cookie, err := r.Cookie(accessCookie); err != nil || cookie.Value != "granted" {
+			http.Redirect(w, r, access.URL+"/cdn-cgi/access/login/idp?redirect_url="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		w.Write([]byte("<html><body>IdP login</body></html>"))
+	}))
+
+	// the application and the team domain are told apart by their hostname
+	appURL = strings.Replace(app.URL, "127.0.0.1", "localhost", 1)
+
+	return app, appURL, access
+}
+
+func TestPassCloudflareAccessOTP(t *testing.T) {
+	accessTeamDomain = "127.0.0.1"
+	defer func() { accessTeamDomain = ".cloudflareaccess.com" }()
+
+	app, appURL, access := newAccessServers(t)
+	defer app.Close()
+	defer access.Close()
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("RequestSecurityCode", "000000").Return("123456").Once()
+
+	client, err := NewHTTPClient(NewDefaultTransport(false), &HTTPClientOptions{Username: "user@example.com"})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest("GET", appURL+"/adfs/ls/IdpInitiatedSignOn.aspx", nil)
+	require.Nil(t, err)
+
+	res, err := client.Do(req)
+	require.Nil(t, err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.Equal(t, "<html><body>IdP login</body></html>", string(body))
+	require.Equal(t, "/adfs/ls/IdpInitiatedSignOn.aspx", res.Request.URL.Path)
+	pr.Mock.AssertExpectations(t)
+
+	// a refused code ends the login
+	pr.Mock.On("RequestSecurityCode", "000000").Return("000000").Once()
+
+	client, err = NewHTTPClient(NewDefaultTransport(false), &HTTPClientOptions{Username: "user@example.com"})
+	require.Nil(t, err)
+
+	req, err = http.NewRequest("GET", appURL+"/adfs/ls/IdpInitiatedSignOn.aspx", nil)
+	require.Nil(t, err)
+
+	_, err = client.Do(req)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Cloudflare Access login failed: the one-time PIN was refused: Invalid code")
+
+	// turned off the Access page is returned as is
+	client, err = NewHTTPClient(NewDefaultTransport(false), &HTTPClientOptions{CloudflareAccess: "off"})
+	require.Nil(t, err)
+
+	req, err = http.NewRequest("GET", appURL+"/adfs/ls/IdpInitiatedSignOn.aspx", nil)
+	require.Nil(t, err)
+
+	res, err = client.Do(req)
+	require.Nil(t, err)
+	res.Body.Close()
+	require.Equal(t, "/cdn-cgi/access/login/idp", res.Request.URL.Path)
+}
+
+func TestPassCloudflareAccessModes(t *testing.T) {
+	accessTeamDomain = "127.0.0.1"
+	cloudflaredCommand = "cloudflared-not-installed"
+	defer func() {
+		accessTeamDomain = ".cloudflareaccess.com"
+		cloudflaredCommand = "cloudflared"
+	}()
+
+	app, appURL, access := newAccessServers(t)
+	defer app.Close()
+	defer access.Close()
+
+	for mode, msg := range map[string]string{
+		"cloudflared": "Cloudflare Access login failed: Cloudflare Access requires an identity provider login, install cloudflared to log in with a browser",
+		"pin":         "invalid cloudflare_access: pin, use auto, otp, cloudflared or off",
+	} {
+		client, err := NewHTTPClient(NewDefaultTransport(false), &HTTPClientOptions{CloudflareAccess: mode, Username: "user@example.com"})
+		require.Nil(t, err)
+
+		req, err := http.NewRequest("GET", appURL+"/adfs/ls/IdpInitiatedSignOn.aspx", nil)
+		require.Nil(t, err)
+
+		_, err = client.Do(req)
+		require.EqualError(t, err, msg)
+	}
+}
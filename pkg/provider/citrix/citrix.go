@@ -0,0 +1,269 @@
+package citrix
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxSteps the number of nFactor forms submitted before giving up, a push is polled with the same form
+	maxSteps = 60
+
+	// requirementsPath the endpoint returning the first factor of the nFactor chain
+	requirementsPath = "/nf/auth/getAuthenticationRequirements.do"
+
+	resultSuccess  = "success"
+	resultMoreInfo = "more-info"
+)
+
+// pushPeriod how long to wait before submitting a factor waiting for a push approval again
+var pushPeriod = 2 * time.Second
+
+var logger = logrus.WithField("provider", "citrix")
+
+// Client wrapper around Citrix Gateway nFactor authentication
+type Client struct {
+	client *provider.HTTPClient
+}
+
+// New create a new Citrix Gateway client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+	}, nil
+}
+
+// authenticateResponse the XML answer of the nFactor endpoints, the next factor to complete or the result
+type authenticateResponse struct {
+	Result       string        `xml:"Result"`
+	RedirectURL  string        `xml:"RedirectURL"`
+	PostBack     string        `xml:"AuthenticationRequirements>PostBack"`
+	Requirements []requirement `xml:"AuthenticationRequirements>Requirements>Requirement"`
+}
+
+type requirement struct {
+	ID        string `xml:"Credential>ID"`
+	Type      string `xml:"Credential>Type"`
+	LabelText string `xml:"Label>Text"`
+	LabelType string `xml:"Label>Type"`
+	Button    string `xml:"Input>Button"`
+	Value     string `xml:"Input>Text>InitialValue"`
+}
+
+// Authenticate logs into the Citrix Gateway by walking its nFactor chain, the LDAP password followed by an OTP or
+// a push factor, and returns the SAML response the gateway posts to Alibaba Cloud
+func (cc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := cc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	// an existing session goes straight to the assertion
+	if samlAssertion, err := extractSAMLResponse(res); err != nil || samlAssertion != "" {
+		return samlAssertion, err
+	}
+
+	logonURL := res.Request.URL
+
+	location, err := logonURL.Parse(requirementsPath)
+	if err != nil {
+		return "", errors.Wrap(err, "error building nFactor URL")
+	}
+
+	authResp, err := cc.post(location.String(), url.Values{})
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving authentication requirements")
+	}
+
+	passwordSubmitted, pushNotified := false, false
+
+	for step := 0; authResp.Result != resultSuccess; step++ {
+		if step == maxSteps {
+			return "", errors.New("login failed: the nFactor chain didn't complete")
+		}
+
+		if authResp.Result != resultMoreInfo {
+			return "", fmt.Errorf("login failed: %s", authResp.message("unexpected nFactor result "+authResp.Result))
+		}
+
+		if msg := authResp.errorMessage(); msg != "" {
+			return "", fmt.Errorf("login failed: %s", msg)
+		}
+
+		form, waiting := fillRequirements(authResp.Requirements, loginDetails, &passwordSubmitted)
+		if waiting {
+			if !pushNotified {
+				log.Println(authResp.message("Approve the sign in from the Citrix SSO app"))
+				pushNotified = true
+			}
+			logger.Debug("waiting for push approval")
+			if err := cc.client.Sleep(pushPeriod); err != nil {
+				return "", errors.Wrap(err, "error waiting for the push approval")
+			}
+		}
+
+		location, err = logonURL.Parse(authResp.PostBack)
+		if err != nil {
+			return "", errors.Wrap(err, "error building nFactor URL")
+		}
+
+		authResp, err = cc.post(location.String(), form)
+		if err != nil {
+			return "", errors.Wrap(err, "error submitting nFactor form")
+		}
+	}
+
+	next := loginDetails.URL
+	if authResp.RedirectURL != "" {
+		redirectURL, err := logonURL.Parse(authResp.RedirectURL)
+		if err != nil {
+			return "", errors.Wrap(err, "error parsing redirect URL")
+		}
+		next = redirectURL.String()
+	}
+
+	res, err = cc.client.Get(next)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving SAML response")
+	}
+
+	samlAssertion, err := extractSAMLResponse(res)
+	if err != nil {
+		return "", err
+	}
+	if samlAssertion == "" {
+		return "", errors.New("no SAML response returned by the Citrix Gateway, check the SAML IdP profile of the Alibaba Cloud app")
+	}
+
+	return samlAssertion, nil
+}
+
+// fillRequirements the form answering the factor, the first password field gets the password and any later one the
+// OTP, a factor without any field is waiting for a push approval
+func fillRequirements(requirements []requirement, loginDetails *creds.LoginDetails, passwordSubmitted *bool) (url.Values, bool) {
+	form := url.Values{}
+	waiting := true
+
+	for _, r := range requirements {
+		if r.ID == "" {
+			continue
+		}
+
+		switch r.Type {
+		case "username":
+			form.Set(r.ID, loginDetails.Username)
+			waiting = false
+		case "password":
+			if *passwordSubmitted {
+				form.Set(r.ID, otp(loginDetails))
+			} else {
+				form.Set(r.ID, loginDetails.Password)
+				*passwordSubmitted = true
+			}
+			waiting = false
+		case "none":
+			if r.Button != "" {
+				form.Set(r.ID, r.Button)
+			}
+		default:
+			form.Set(r.ID, r.Value)
+		}
+	}
+
+	return form, waiting
+}
+
+// otp the code of the OTP factor, taken from --mfa-token when it is given
+func otp(loginDetails *creds.LoginDetails) string {
+	if loginDetails.MFAToken != "" {
+		return loginDetails.MFAToken
+	}
+	return prompter.RequestSecurityCode("000000")
+}
+
+// errorMessage the error label of the factor, set when the previous answer was refused
+func (ar *authenticateResponse) errorMessage() string {
+	for _, r := range ar.Requirements {
+		if r.LabelType == "error" {
+			return strings.TrimSpace(r.LabelText)
+		}
+	}
+	return ""
+}
+
+// message the first label of the factor, the fallback when it has none
+func (ar *authenticateResponse) message(fallback string) string {
+	for _, r := range ar.Requirements {
+		if r.LabelText != "" && r.LabelType != "none" {
+			return strings.TrimSpace(r.LabelText)
+		}
+	}
+	return fallback
+}
+
+func (cc *Client) post(location string, form url.Values) (*authenticateResponse, error) {
+	req, err := http.NewRequest("POST", location, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("X-Citrix-AM-LabelTypes", "none, plain, heading, error, confirmation, nsg-push")
+	req.Header.Add("X-Citrix-AM-CredentialTypes", "none, username, password, savecredentials")
+
+	res, err := cc.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving body")
+	}
+
+	if res.StatusCode >= 400 {
+		return nil, fmt.Errorf("Citrix Gateway returned %s", res.Status)
+	}
+
+	authResp := &authenticateResponse{}
+	if err := xml.Unmarshal(data, authResp); err != nil {
+		return nil, errors.Wrap(err, "error parsing nFactor response")
+	}
+
+	return authResp, nil
+}
+
+// extractSAMLResponse the SAML response posted to Alibaba Cloud by the page, empty when the page has none
+func extractSAMLResponse(res *http.Response) (string, error) {
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build document from response")
+	}
+
+	samlAssertion, _ := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
+
+	return samlAssertion, nil
+}
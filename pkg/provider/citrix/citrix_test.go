@@ -0,0 +1,148 @@
+package citrix
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+const appPath = "/saml/login"
+
+func TestAuthenticateOTP(t *testing.T) {
+	ldapPage, err := ioutil.ReadFile("example/ldap.xml")
+	require.Nil(t, err)
+	otpPage, err := ioutil.ReadFile("example/otp.xml")
+	require.Nil(t, err)
+	successPage, err := ioutil.ReadFile("example/success.xml")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case appPath:
+			if _, err := r.Cookie("NSC_TMAS"); err == nil {
+				w.Write(assertionPage)
+				return
+			}
+			http.Redirect(w, r, "/logon/LogonPoint/tmindex.html", http.StatusFound)
+		case "/logon/LogonPoint/tmindex.html":
+			w.Write([]byte(`<html><body><div id="logonbelt-topshadow"></div></body></html>`))
+		case "/nf/auth/getAuthenticationRequirements.do":
+			w.Write(ldapPage)
+		case "/nf/auth/doAuthentication.do":
+			if r.PostForm.Get("login") != "" {
+				require.Equal(t, "wile", r.PostForm.Get("login"))
+				require.Equal(t, "Log On", r.PostForm.Get("loginBtn"))
+				require.Equal(t, "secret", r.PostForm.Get("passwd"))
+				w.Write(otpPage)
+				return
+			}
+			require.Equal(t, "123456", r.PostForm.Get("passwd1"))
+			http.SetCookie(w, &http.Cookie{Name: "NSC_TMAS", Value: "session", Path: "/"})
+			w.Write(successPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL + appPath + "?app=alibabacloud", Username: "wile", Password: "secret", MFAToken: "123456"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticatePush(t *testing.T) {
+	pushPeriod = 0
+
+	ldapPage, err := ioutil.ReadFile("example/ldap.xml")
+	require.Nil(t, err)
+	pushPage, err := ioutil.ReadFile("example/push.xml")
+	require.Nil(t, err)
+	successPage, err := ioutil.ReadFile("example/success.xml")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	pushPolls := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case appPath:
+			if _, err := r.Cookie("NSC_TMAS"); err == nil {
+				w.Write(assertionPage)
+				return
+			}
+			http.Redirect(w, r, "/logon/LogonPoint/tmindex.html", http.StatusFound)
+		case "/logon/LogonPoint/tmindex.html":
+			w.Write([]byte(`<html><body><div id="logonbelt-topshadow"></div></body></html>`))
+		case "/nf/auth/getAuthenticationRequirements.do":
+			w.Write(ldapPage)
+		case "/nf/auth/doAuthentication.do":
+			if r.PostForm.Get("login") != "" {
+				w.Write(pushPage)
+				return
+			}
+			require.NotEmpty(t, r.PostForm.Get("nsg-push"))
+			pushPolls++
+			if pushPolls < 3 {
+				w.Write(pushPage)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "NSC_TMAS", Value: "session", Path: "/"})
+			w.Write(successPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL + appPath + "?app=alibabacloud", Username: "wile", Password: "secret"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.Equal(t, 3, pushPolls)
+}
+
+func TestAuthenticateInvalidPassword(t *testing.T) {
+	ldapPage, err := ioutil.ReadFile("example/ldap.xml")
+	require.Nil(t, err)
+	errorPage, err := ioutil.ReadFile("example/error.xml")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case appPath:
+			http.Redirect(w, r, "/logon/LogonPoint/tmindex.html", http.StatusFound)
+		case "/logon/LogonPoint/tmindex.html":
+			w.Write([]byte(`<html><body><div id="logonbelt-topshadow"></div></body></html>`))
+		case "/nf/auth/getAuthenticationRequirements.do":
+			w.Write(ldapPage)
+		case "/nf/auth/doAuthentication.do":
+			w.Write(errorPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + appPath + "?app=alibabacloud", Username: "wile", Password: "wrong"})
+	require.EqualError(t, err, "login failed: Incorrect user name or password.")
+}
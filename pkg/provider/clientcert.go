@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// NewClientCertTransport configure a transport for the IdP account like NewAccountTransport, presenting the client
+// certificate of the account when the IdP asks for one
+func NewClientCertTransport(idpAccount *cfg.IDPAccount) (http.RoundTripper, error) {
+	certs, err := AccountCertificates(idpAccount)
+	if err != nil {
+		return nil, err
+	}
+	if certs == nil {
+		return NewAccountTransport(idpAccount), nil
+	}
+
+	tr := newAccountDefaultTransport(idpAccount)
+	tr.TLSClientConfig.Certificates = certs
+
+	return ScopeSkipVerify(tr, idpAccount.SkipVerifyHostList()), nil
+}
+
+// AccountCertificates load the client certificate of the account, none when client_cert isn't set, a PFX
+// client_cert holds its key and needs no client_key
+func AccountCertificates(idpAccount *cfg.IDPAccount) ([]tls.Certificate, error) {
+	if idpAccount.ClientCert == "" && idpAccount.ClientKey == "" {
+		return nil, nil
+	}
+	if idpAccount.ClientCert == "" || (idpAccount.ClientKey == "" && !IsPFX(idpAccount.ClientCert)) {
+		return nil, errors.New("client_cert and client_key must be set together")
+	}
+
+	cert, err := LoadClientCertificate(idpAccount.ClientCert, idpAccount.ClientKey, idpAccount.ClientKeyPIN)
+	if err != nil {
+		return nil, err
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// IsPFX whether the certificate file is a PKCS#12 bundle, by its .pfx or .p12 extension
+func IsPFX(certFile string) bool {
+	switch strings.ToLower(filepath.Ext(certFile)) {
+	case ".pfx", ".p12":
+		return true
+	}
+	return false
+}
+
+// LoadClientCertificate load a PEM certificate and its private key, ~ is expanded in both paths, the pin decrypts
+// the key when it is encrypted, or the PFX bundle when certFile is one and keyFile is empty
+func LoadClientCertificate(certFile, keyFile, pin string) (tls.Certificate, error) {
+	certPath, err := homedir.Expand(certFile)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "error resolving client certificate path")
+	}
+	if keyFile == "" && IsPFX(certFile) {
+		return loadPFX(certPath, pin)
+	}
+	keyPath, err := homedir.Expand(keyFile)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "error resolving client key path")
+	}
+
+	certPEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "error loading client certificate")
+	}
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "error loading client key")
+	}
+
+	if block, _ := pem.Decode(keyPEM); block != nil && x509.IsEncryptedPEMBlock(block) {
+		if pin == "" {
+			return tls.Certificate{}, errors.New("client_key is encrypted, set client_key_pin")
+		}
+		der, err := x509.DecryptPEMBlock(block, []byte(pin))
+		if err != nil {
+			return tls.Certificate{}, errors.Wrap(err, "error decrypting client key")
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der})
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "error loading client certificate")
+	}
+
+	return cert, nil
+}
+
+// loadPFX load the certificates and the private key of a PKCS#12 bundle, the pin being its password
+func loadPFX(path, pin string) (tls.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "error loading client certificate")
+	}
+
+	blocks, err := pkcs12.ToPEM(data, pin)
+	if err == pkcs12.ErrIncorrectPassword {
+		return tls.Certificate{}, errors.New("wrong client_key_pin for the PFX client_cert")
+	}
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "error decoding PFX client certificate")
+	}
+
+	var certPEM, keyPEM []byte
+	for _, block := range blocks {
+		if block.Type == "CERTIFICATE" {
+			certPEM = append(certPEM, pem.EncodeToMemory(block)...)
+		} else {
+			keyPEM = append(keyPEM, pem.EncodeToMemory(block)...)
+		}
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "error loading client certificate")
+	}
+
+	return cert, nil
+}
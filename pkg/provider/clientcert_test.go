@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/stretchr/testify/require"
+)
+
+// writeClientCertificate write a self signed client certificate and its key to dir
+func writeClientCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "device-0001"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	certFile := filepath.Join(dir, "device.crt")
+	keyFile := filepath.Join(dir, "device.key")
+	require.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certFile, keyFile
+}
+
+func TestNewClientCertTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clientcert")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeClientCertificate(t, dir)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tr, err := NewClientCertTransport(&cfg.IDPAccount{URL: ts.URL, SkipVerify: true, ClientCert: certFile, ClientKey: keyFile})
+	require.Nil(t, err)
+
+	res, err := (&http.Client{Transport: tr}).Get(ts.URL)
+	require.Nil(t, err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.Equal(t, "device-0001", string(body))
+
+	// without the certificate the server refuses the handshake
+	tr, err = NewClientCertTransport(&cfg.IDPAccount{URL: ts.URL, SkipVerify: true})
+	require.Nil(t, err)
+	_, err = (&http.Client{Transport: tr}).Get(ts.URL)
+	require.Error(t, err)
+
+	_, err = NewClientCertTransport(&cfg.IDPAccount{ClientCert: certFile})
+	require.EqualError(t, err, "client_cert and client_key must be set together")
+
+	_, err = NewClientCertTransport(&cfg.IDPAccount{ClientCert: certFile, ClientKey: filepath.Join(dir, "missing.key")})
+	require.Error(t, err)
+}
+
+func TestLoadClientCertificateEncrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clientcert")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeClientCertificate(t, dir)
+
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	require.Nil(t, err)
+	block, _ := pem.Decode(keyPEM)
+	encrypted, err := x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte("1234"), x509.PEMCipherAES256)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(encrypted), 0600))
+
+	_, err = LoadClientCertificate(certFile, keyFile, "")
+	require.EqualError(t, err, "client_key is encrypted, set client_key_pin")
+
+	_, err = LoadClientCertificate(certFile, keyFile, "0000")
+	require.Error(t, err)
+
+	cert, err := LoadClientCertificate(certFile, keyFile, "1234")
+	require.Nil(t, err)
+	require.Len(t, cert.Certificate, 1)
+}
+
+func TestLoadClientCertificatePFX(t *testing.T) {
+	_, err := NewClientCertTransport(&cfg.IDPAccount{ClientCert: "example/device.pfx", ClientKeyPIN: "1234"})
+	require.Nil(t, err)
+
+	_, err = LoadClientCertificate("example/device.pfx", "", "0000")
+	require.EqualError(t, err, "wrong client_key_pin for the PFX client_cert")
+
+	cert, err := LoadClientCertificate("example/device.pfx", "", "1234")
+	require.Nil(t, err)
+	require.Len(t, cert.Certificate, 1)
+}
@@ -0,0 +1,298 @@
+package cyberark
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	summaryLoginSuccess       = "LoginSuccess"
+	summaryStartNextChallenge = "StartNextChallenge"
+	summaryNewPackage         = "NewPackage"
+	summaryOobPending         = "OobPending"
+
+	// maxPolls how many times an out of band mechanism is polled before giving up
+	maxPolls = 60
+)
+
+// pollInterval delay between polls of an out of band mechanism, replaced in tests
+var pollInterval = 2 * time.Second
+
+var logger = logrus.WithField("provider", "cyberark")
+
+// Client wrapper around CyberArk Identity (formerly Idaptive)
+type Client struct {
+	client *provider.HTTPClient
+	mfa    string
+}
+
+// Mechanism an authentication mechanism offered for a challenge
+type Mechanism struct {
+	MechanismID      string `json:"MechanismId"`
+	Name             string `json:"Name"`
+	AnswerType       string `json:"AnswerType"`
+	PromptSelectMech string `json:"PromptSelectMech"`
+	PromptMechChosen string `json:"PromptMechChosen"`
+}
+
+// Challenge one step of the authentication, answered with any one of its mechanisms
+type Challenge struct {
+	Mechanisms []*Mechanism `json:"Mechanisms"`
+}
+
+// AuthResult the result of the start and advance authentication calls
+type AuthResult struct {
+	SessionID  string       `json:"SessionId"`
+	Challenges []*Challenge `json:"Challenges"`
+	Summary    string       `json:"Summary"`
+	PodFqdn    string       `json:"PodFqdn"`
+	Redirect   bool         `json:"IsRedirect"`
+}
+
+// AuthResponse envelope of the authentication API responses
+type AuthResponse struct {
+	Success   bool        `json:"success"`
+	Result    *AuthResult `json:"Result"`
+	Message   string      `json:"Message"`
+	ErrorCode string      `json:"ErrorCode"`
+}
+
+// New create a new CyberArk Identity client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		mfa:    idpAccount.MFA,
+	}, nil
+}
+
+// Authenticate logs into CyberArk Identity and returns a SAML response
+func (cc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	appURL, err := url.Parse(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing url")
+	}
+
+	base := fmt.Sprintf("%s://%s", appURL.Scheme, appURL.Host)
+
+	startReq := map[string]string{
+		"User":    loginDetails.Username,
+		"Version": "1.0",
+	}
+	if tenantID := appURL.Query().Get("customerId"); tenantID != "" {
+		startReq["TenantId"] = tenantID
+	}
+
+	auth, err := cc.call(base+"/Security/StartAuthentication", startReq)
+	if err != nil {
+		return "", errors.Wrap(err, "error starting authentication")
+	}
+
+	// the tenant lives on another pod, start again there
+	if auth.Redirect && auth.PodFqdn != "" {
+		base = "https://" + auth.PodFqdn
+		auth, err = cc.call(base+"/Security/StartAuthentication", startReq)
+		if err != nil {
+			return "", errors.Wrap(err, "error starting authentication")
+		}
+	}
+
+	sessionID := auth.SessionID
+	challenges := auth.Challenges
+
+	for i := 0; i < len(challenges); i++ {
+		mechanism, err := cc.selectMechanism(challenges[i], i == 0)
+		if err != nil {
+			return "", err
+		}
+
+		summary, err := cc.answer(base, sessionID, mechanism, loginDetails)
+		if err != nil {
+			return "", err
+		}
+
+		switch summary.Summary {
+		case summaryLoginSuccess:
+			return cc.fetchAssertion(loginDetails.URL)
+		case summaryNewPackage:
+			// the tenant policy replaced the remaining challenges
+			challenges = append(challenges[:i+1], summary.Challenges...)
+		case summaryStartNextChallenge:
+		default:
+			return "", fmt.Errorf("unexpected authentication result: %s", summary.Summary)
+		}
+	}
+
+	return "", fmt.Errorf("authentication did not complete after %d challenges", len(challenges))
+}
+
+// selectMechanism pick the mechanism to answer the challenge with, the password is always used for the first
+// challenge when offered, otherwise the configured MFA or a prompt decides
+func (cc *Client) selectMechanism(challenge *Challenge, first bool) (*Mechanism, error) {
+	if len(challenge.Mechanisms) == 0 {
+		return nil, fmt.Errorf("no authentication mechanisms offered")
+	}
+
+	if len(challenge.Mechanisms) == 1 {
+		return challenge.Mechanisms[0], nil
+	}
+
+	for _, m := range challenge.Mechanisms {
+		if first && m.Name == "UP" {
+			return m, nil
+		}
+		if cc.mfa != "" && cc.mfa != "Auto" && strings.EqualFold(m.Name, cc.mfa) {
+			return m, nil
+		}
+	}
+
+	options := make([]string, len(challenge.Mechanisms))
+	for i, m := range challenge.Mechanisms {
+		options[i] = m.PromptSelectMech
+		if options[i] == "" {
+			options[i] = m.Name
+		}
+	}
+
+	return challenge.Mechanisms[prompter.Choose("Select an MFA mechanism", options)], nil
+}
+
+// answer respond to the mechanism, text answers are sent directly and out of band ones are started and polled
+func (cc *Client) answer(base, sessionID string, mechanism *Mechanism, loginDetails *creds.LoginDetails) (*AuthResult, error) {
+	logger.WithField("mechanism", mechanism.Name).Debug("answering challenge")
+
+	advanceURL := base + "/Security/AdvanceAuthentication"
+
+	if mechanism.AnswerType == "Text" {
+		var answer string
+		switch {
+		case mechanism.Name == "UP":
+			answer = loginDetails.Password
+		case loginDetails.MFAToken != "":
+			answer = loginDetails.MFAToken
+		default:
+			answer = prompter.StringRequired(mechanism.PromptMechChosen)
+		}
+
+		return cc.call(advanceURL, map[string]string{
+			"SessionId":   sessionID,
+			"MechanismId": mechanism.MechanismID,
+			"Action":      "Answer",
+			"Answer":      answer,
+		})
+	}
+
+	result, err := cc.call(advanceURL, map[string]string{
+		"SessionId":   sessionID,
+		"MechanismId": mechanism.MechanismID,
+		"Action":      "StartOOB",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if mechanism.PromptMechChosen != "" {
+		log.Println(mechanism.PromptMechChosen)
+	}
+
+	for i := 0; i < maxPolls && result.Summary == summaryOobPending; i++ {
+		if err := cc.client.Sleep(pollInterval); err != nil {
+			return nil, errors.Wrap(err, "error waiting for the out of band answer")
+		}
+
+		result, err = cc.call(advanceURL, map[string]string{
+			"SessionId":   sessionID,
+			"MechanismId": mechanism.MechanismID,
+			"Action":      "Poll",
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Summary == summaryOobPending {
+		return nil, fmt.Errorf("%s was not approved in time", mechanism.Name)
+	}
+
+	return result, nil
+}
+
+// fetchAssertion open the application with the authenticated session to obtain the SAML response
+func (cc *Client) fetchAssertion(appURL string) (string, error) {
+	res, err := cc.client.Get(appURL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving application")
+	}
+
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build document from response")
+	}
+
+	samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
+	if !ok {
+		return "", fmt.Errorf("unable to locate SAMLResponse in the application response")
+	}
+
+	return samlAssertion, nil
+}
+
+func (cc *Client) call(location string, body interface{}) (*AuthResult, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", location, bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-IDAP-NATIVE-CLIENT", "true")
+
+	res, err := cc.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving body")
+	}
+
+	var authResp AuthResponse
+	err = json.Unmarshal(resBody, &authResp)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding response")
+	}
+
+	if !authResp.Success || authResp.Result == nil {
+		return nil, fmt.Errorf("authentication failed: %s", authResp.Message)
+	}
+
+	return authResp.Result, nil
+}
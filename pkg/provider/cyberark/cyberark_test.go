@@ -0,0 +1,149 @@
+package cyberark
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticateOOB(t *testing.T) {
+	pollInterval = 0
+
+	startPage, err := ioutil.ReadFile("example/start.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	polls := 2
+	authenticated := false
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Security/StartAuthentication":
+			require.Equal(t, "true", r.Header.Get("X-IDAP-NATIVE-CLIENT"))
+			var body map[string]string
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, "user@example.com", body["User"])
+			require.Equal(t, "AAB1234", body["TenantId"])
+			w.Write(startPage)
+		case "/Security/AdvanceAuthentication":
+			var body map[string]string
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, "session-1", body["SessionId"])
+
+			switch body["MechanismId"] {
+			case "mech-up":
+				require.Equal(t, "secret", body["Answer"])
+				w.Write([]byte(`{"success":true,"Result":{"Summary":"StartNextChallenge"}}`))
+			case "mech-otp":
+				if body["Action"] == "Poll" {
+					polls--
+				}
+				if polls > 0 {
+					w.Write([]byte(`{"success":true,"Result":{"Summary":"OobPending"}}`))
+					return
+				}
+				authenticated = true
+				http.SetCookie(w, &http.Cookie{Name: ".ASPXAUTH", Value: "auth"})
+				w.Write([]byte(`{"success":true,"Result":{"Summary":"LoginSuccess"}}`))
+			}
+		case "/run":
+			require.True(t, authenticated)
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "OTP"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/run?appkey=app-1&customerId=AAB1234",
+		Username: "user@example.com",
+		Password: "secret",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateCode(t *testing.T) {
+	startPage, err := ioutil.ReadFile("example/start.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	authenticated := false
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Security/StartAuthentication":
+			w.Write(startPage)
+		case "/Security/AdvanceAuthentication":
+			var body map[string]string
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+
+			switch body["MechanismId"] {
+			case "mech-up":
+				w.Write([]byte(`{"success":true,"Result":{"Summary":"StartNextChallenge"}}`))
+			case "mech-oath":
+				require.Equal(t, "Answer", body["Action"])
+				require.Equal(t, "123456", body["Answer"])
+				authenticated = true
+				w.Write([]byte(`{"success":true,"Result":{"Summary":"LoginSuccess"}}`))
+			}
+		case "/run":
+			require.True(t, authenticated)
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "OATH"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/run?appkey=app-1&customerId=AAB1234",
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	startPage, err := ioutil.ReadFile("example/start.json")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Security/StartAuthentication":
+			w.Write(startPage)
+		case "/Security/AdvanceAuthentication":
+			w.Write([]byte(`{"success":false,"Result":null,"Message":"Authentication (login or challenge) has failed."}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "OATH"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/run?appkey=app-1&customerId=AAB1234",
+		Username: "user@example.com",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "authentication failed: Authentication (login or challenge) has failed.")
+}
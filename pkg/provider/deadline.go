@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+)
+
+// Authentication the deadline of one Authenticate of a provider, the HTTP clients built for its accounts send their
+// requests and wait between polls with its context
+type Authentication struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	accounts []*cfg.IDPAccount
+
+	mu        sync.Mutex
+	abandoned bool
+}
+
+// authentications the authentication in progress of each account
+var authentications = struct {
+	sync.Mutex
+	byAccount map[*cfg.IDPAccount]*Authentication
+}{byAccount: map[*cfg.IDPAccount]*Authentication{}}
+
+// StartAuthentication give the HTTP clients built for accounts a context ending after timeout, End must be called
+// once the authentication returns
+func StartAuthentication(timeout time.Duration, accounts ...*cfg.IDPAccount) *Authentication {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	a := &Authentication{ctx: ctx, cancel: cancel, accounts: accounts}
+
+	authentications.Lock()
+	for _, account := range accounts {
+		authentications.byAccount[account] = a
+	}
+	authentications.Unlock()
+
+	return a
+}
+
+// Context ends at the deadline or once the authentication was ended
+func (a *Authentication) Context() context.Context {
+	return a.ctx
+}
+
+// Abandon give up on the authentication at its deadline, the flow still running in the background fails at its
+// next request or wait rather than going on prompting and polling
+func (a *Authentication) Abandon() {
+	a.mu.Lock()
+	a.abandoned = true
+	a.mu.Unlock()
+
+	a.End()
+}
+
+// End cancel the context of the authentication, the clients of the accounts are no longer bound to it
+func (a *Authentication) End() {
+	a.cancel()
+
+	authentications.Lock()
+	for _, account := range a.accounts {
+		if authentications.byAccount[account] == a {
+			delete(authentications.byAccount, account)
+		}
+	}
+	authentications.Unlock()
+}
+
+func (a *Authentication) isAbandoned() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.abandoned
+}
+
+// currentAuthentication the authentication in progress for the account, nil when there is none
+func currentAuthentication(account *cfg.IDPAccount) *Authentication {
+	if account == nil {
+		return nil
+	}
+
+	authentications.Lock()
+	defer authentications.Unlock()
+	return authentications.byAccount[account]
+}
@@ -0,0 +1,174 @@
+package dex
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	loginFormFilter    = "form:has(input[name=\"password\"])"
+	approvalFormFilter = "form:has(input[name=\"approval\"][value=\"approve\"])"
+	connectorFilter    = "a[href]:has(.dex-btn)"
+)
+
+var logger = logrus.WithField("provider", "dex")
+
+// Client wrapper around Dex
+type Client struct {
+	client    *provider.HTTPClient
+	connector string
+}
+
+// connector a login method offered on the connector selection page of Dex
+type connector struct {
+	ID   string
+	Name string
+	URL  string
+}
+
+// New create a new Dex client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client:    client,
+		connector: idpAccount.Connector,
+	}, nil
+}
+
+// Authenticate logs into Dex through the SAML bridge in front of it, choosing the connector, submitting its login
+// form and granting access to the bridge when asked, and returns the SAML response of the bridge
+func (dc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := dc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	passwordSubmitted := false
+	connectorChosen := false
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		switch {
+		case doc.Find(loginFormFilter).Size() > 0:
+			if passwordSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid username or password"))
+			}
+			passwordSubmitted = true
+			res, err = page.SubmitForm(dc.client, doc, loginFormFilter, func(form *page.Form, _ *goquery.Selection) {
+				form.Values.Set("login", loginDetails.Username)
+				form.Values.Set("password", loginDetails.Password)
+			})
+		case doc.Find(approvalFormFilter).Size() > 0:
+			logger.Debug("granting access to the SAML bridge")
+			res, err = page.SubmitForm(dc.client, doc, approvalFormFilter, nil)
+		case doc.Find(connectorFilter).Size() > 0:
+			if connectorChosen {
+				return "", errors.New("login failed: Dex keeps asking for a connector")
+			}
+			connectorChosen = true
+			res, err = dc.chooseConnector(doc)
+		default:
+			return "", fmt.Errorf("unexpected page returned by Dex: %s", doc.Url.String())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("Dex login did not complete after %d steps", page.MaxSteps)
+}
+
+// chooseConnector follow the connector matching the configured one by ID or name, the only one offered, or the one
+// picked by the user
+func (dc *Client) chooseConnector(doc *goquery.Document) (*http.Response, error) {
+	connectors := parseConnectors(doc)
+
+	var chosen *connector
+	switch {
+	case dc.connector != "":
+		names := make([]string, len(connectors))
+		for i, c := range connectors {
+			if strings.EqualFold(c.ID, dc.connector) || strings.EqualFold(c.Name, dc.connector) {
+				chosen = &connectors[i]
+				break
+			}
+			names[i] = c.Name
+		}
+		if chosen == nil {
+			return nil, fmt.Errorf("connector %s not offered by Dex, choose one of: %s", dc.connector, strings.Join(names, ", "))
+		}
+	case len(connectors) == 1:
+		chosen = &connectors[0]
+	default:
+		names := make([]string, len(connectors))
+		for i, c := range connectors {
+			names[i] = c.Name
+		}
+		chosen = &connectors[prompter.Choose("Select a login method", names)]
+	}
+
+	logger.WithField("connector", chosen.ID).Debug("following connector")
+
+	res, err := dc.client.Get(chosen.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving connector login page")
+	}
+
+	return res, nil
+}
+
+// parseConnectors the connectors of the selection page, Dex links each to /auth/<connector id>
+func parseConnectors(doc *goquery.Document) []connector {
+	var connectors []connector
+	doc.Find(connectorFilter).Each(func(i int, s *goquery.Selection) {
+		u, err := doc.Url.Parse(s.AttrOr("href", ""))
+		if err != nil {
+			return
+		}
+
+		id := path.Base(u.Path)
+		name := strings.TrimSpace(s.Find(".dex-btn-text").Text())
+		name = strings.TrimSpace(strings.TrimPrefix(name, "Log in with"))
+		if name == "" {
+			name = id
+		}
+
+		connectors = append(connectors, connector{ID: id, Name: name, URL: u.String()})
+	})
+	return connectors
+}
+
+func loginError(doc *goquery.Document, fallback string) string {
+	msg := strings.TrimSpace(doc.Find("#login-error").First().Text())
+	if msg == "" {
+		msg = fallback
+	}
+	return msg
+}
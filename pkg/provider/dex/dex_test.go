@@ -0,0 +1,137 @@
+package dex
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	connectorsPage, err := ioutil.ReadFile("example/connectors.html")
+	require.Nil(t, err)
+	passwordPage, err := ioutil.ReadFile("example/password.html")
+	require.Nil(t, err)
+	approvalPage, err := ioutil.ReadFile("example/approval.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	var calls []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+
+		switch r.URL.Path {
+		case "/saml/sso":
+			http.Redirect(w, r, "/dex/auth?req=ffmrfqnq2ogyl7sjsgrctvs3o", http.StatusFound)
+		case "/dex/auth":
+			w.Write(connectorsPage)
+		case "/dex/auth/ldap":
+			require.Equal(t, "ffmrfqnq2ogyl7sjsgrctvs3o", r.URL.Query().Get("req"))
+			w.Write(passwordPage)
+		case "/dex/auth/ldap/login":
+			require.Equal(t, "ffmrfqnq2ogyl7sjsgrctvs3o", r.URL.Query().Get("state"))
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "user", r.PostForm.Get("login"))
+			require.Equal(t, "secret", r.PostForm.Get("password"))
+			http.Redirect(w, r, "/dex/approval?req=ffmrfqnq2ogyl7sjsgrctvs3o", http.StatusSeeOther)
+		case "/dex/approval":
+			if r.Method == "GET" {
+				w.Write(approvalPage)
+				return
+			}
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "approve", r.PostForm.Get("approval"))
+			require.Equal(t, "ffmrfqnq2ogyl7sjsgrctvs3o", r.PostForm.Get("req"))
+			http.Redirect(w, r, "/saml/callback?code=abc", http.StatusSeeOther)
+		case "/saml/callback":
+			w.Write(assertionPage)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.Connector = "Corporate LDAP"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL + "/saml/sso", Username: "user", Password: "secret"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.Equal(t, []string{
+		"GET /saml/sso",
+		"GET /dex/auth",
+		"GET /dex/auth/ldap",
+		"POST /dex/auth/ldap/login",
+		"GET /dex/approval",
+		"POST /dex/approval",
+		"GET /saml/callback",
+	}, calls)
+}
+
+func TestAuthenticateErrors(t *testing.T) {
+	connectorsPage, err := ioutil.ReadFile("example/connectors.html")
+	require.Nil(t, err)
+	passwordPage, err := ioutil.ReadFile("example/password.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/saml/sso":
+			http.Redirect(w, r, "/dex/auth?req=ffmrfqnq2ogyl7sjsgrctvs3o", http.StatusFound)
+		case "/dex/auth":
+			w.Write(connectorsPage)
+		case "/dex/auth/ldap":
+			w.Write(passwordPage)
+		case "/dex/auth/ldap/login":
+			w.Write(bytes.Replace(passwordPage, []byte("<!-- LOGIN ERROR -->"), []byte(`<div id="login-error" class="dex-error-box">Invalid username and password.</div>`), 1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.Connector = "ldap"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + "/saml/sso", Username: "user", Password: "wrong"})
+	require.EqualError(t, err, "login failed: Invalid username and password.")
+
+	idpAccount = cfg.NewIDPAccount()
+	idpAccount.Connector = "github"
+
+	client, err = New(idpAccount)
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + "/saml/sso", Username: "user", Password: "secret"})
+	require.EqualError(t, err, "connector github not offered by Dex, choose one of: Corporate LDAP, Email")
+}
+
+func TestParseConnectors(t *testing.T) {
+	connectorsPage, err := ioutil.ReadFile("example/connectors.html")
+	require.Nil(t, err)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(connectorsPage))
+	require.Nil(t, err)
+	doc.Url, err = url.Parse("https://dex.example.com/dex/auth?req=ffmrfqnq2ogyl7sjsgrctvs3o")
+	require.Nil(t, err)
+
+	require.Equal(t, []connector{
+		{ID: "ldap", Name: "Corporate LDAP", URL: "https://dex.example.com/dex/auth/ldap?req=ffmrfqnq2ogyl7sjsgrctvs3o"},
+		{ID: "local", Name: "Email", URL: "https://dex.example.com/dex/auth/local?req=ffmrfqnq2ogyl7sjsgrctvs3o"},
+	}, parseConnectors(doc))
+}
@@ -0,0 +1,240 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dohContentType the media type of the DNS messages exchanged with a DoH server, RFC 8484
+const dohContentType = "application/dns-message"
+
+// DoHResolver resolve host names with a DNS-over-HTTPS server rather than the resolver of the system, so a network
+// poisoning or blocking the IdP and STS names doesn't get in the way. The DoH server itself is reached through the
+// resolver of the system, unless its URL names it by IP address
+type DoHResolver struct {
+	Endpoint string
+	Dialer   *net.Dialer
+
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*dohAnswer
+}
+
+type dohAnswer struct {
+	addrs   []string
+	expires time.Time
+}
+
+// NewDoHResolver create a resolver querying the DoH server at endpoint, an https URL such as
+// https://223.5.5.5/dns-query
+func NewDoHResolver(endpoint string) *DoHResolver {
+	return &DoHResolver{
+		Endpoint: endpoint,
+		Dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		client: &http.Client{Transport: NewDefaultTransport(false), Timeout: 10 * time.Second},
+		cache:  map[string]*dohAnswer{},
+	}
+}
+
+// NewDoHTransport configure a transport dialing the hosts at the addresses the DoH server resolves them to, a
+// connectTimeout of 0 keeps the default. The transport isn't an *http.Transport so the AlibabaCloud SDK keeps its
+// dialer rather than replacing it with one using the resolver of the system
+func NewDoHTransport(endpoint string, connectTimeout time.Duration) http.RoundTripper {
+	resolver := NewDoHResolver(endpoint)
+	if connectTimeout > 0 {
+		resolver.Dialer.Timeout = connectTimeout
+	}
+
+	tr := NewDefaultTransport(false)
+	tr.DialContext = resolver.DialContext
+
+	return &dohTransport{tr}
+}
+
+type dohTransport struct {
+	*http.Transport
+}
+
+// DialContext connect to the address, resolving its host with the DoH server, the addresses are tried in turn
+func (r *DoHResolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if net.ParseIP(host) != nil {
+		return r.Dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	for _, addr := range addrs {
+		conn, err = r.Dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, err
+}
+
+// LookupHost the IPv4 then IPv6 addresses of the host, cached for the TTL of the answers
+func (r *DoHResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	r.mu.Lock()
+	cached, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	// filtering DoH servers often fail the AAAA queries, the addresses of the other type are enough
+	answer := &dohAnswer{}
+	var ttl uint32
+	var qerr error
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		addrs, qttl, err := r.query(ctx, host, qtype)
+		if err != nil {
+			if qerr == nil {
+				qerr = err
+			}
+			continue
+		}
+		if len(addrs) > 0 && (len(answer.addrs) == 0 || qttl < ttl) {
+			ttl = qttl
+		}
+		answer.addrs = append(answer.addrs, addrs...)
+	}
+
+	if len(answer.addrs) == 0 {
+		if qerr != nil {
+			return nil, errors.Wrapf(qerr, "error resolving %s with DoH server %s", host, r.Endpoint)
+		}
+		return nil, errors.Errorf("DoH server %s has no address for %s", r.Endpoint, host)
+	}
+
+	answer.expires = time.Now().Add(time.Duration(ttl) * time.Second)
+
+	r.mu.Lock()
+	r.cache[host] = answer
+	r.mu.Unlock()
+
+	return answer.addrs, nil
+}
+
+// query ask the DoH server for the records of the type, returning the addresses and the lowest TTL of the answers
+func (r *DoHResolver) query(ctx context.Context, host string, qtype dnsmessage.Type) ([]string, uint32, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "invalid host name")
+	}
+
+	// the ID is 0 so the responses can be cached by HTTP caches, RFC 8484 section 4.1
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error building DNS query")
+	}
+
+	req, err := http.NewRequest("POST", r.Endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error building DoH request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error querying DoH server")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, 0, errors.Errorf("DoH server answered %s", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error reading DoH response")
+	}
+
+	var parser dnsmessage.Parser
+	header, err := parser.Start(body)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "invalid DNS response")
+	}
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, errors.New("no such host")
+	default:
+		return nil, 0, errors.Errorf("DNS error %s", header.RCode)
+	}
+
+	if err = parser.SkipAllQuestions(); err != nil {
+		return nil, 0, errors.Wrap(err, "invalid DNS response")
+	}
+
+	var addrs []string
+	var ttl uint32
+	for {
+		rh, err := parser.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "invalid DNS response")
+		}
+
+		var ip net.IP
+		switch rh.Type {
+		case dnsmessage.TypeA:
+			rr, err := parser.AResource()
+			if err != nil {
+				return nil, 0, errors.Wrap(err, "invalid DNS response")
+			}
+			ip = rr.A[:]
+		case dnsmessage.TypeAAAA:
+			rr, err := parser.AAAAResource()
+			if err != nil {
+				return nil, 0, errors.Wrap(err, "invalid DNS response")
+			}
+			ip = rr.AAAA[:]
+		default:
+			// the CNAME records leading to the addresses
+			if err := parser.SkipAnswer(); err != nil {
+				return nil, 0, errors.Wrap(err, "invalid DNS response")
+			}
+			continue
+		}
+
+		if len(addrs) == 0 || rh.TTL < ttl {
+			ttl = rh.TTL
+		}
+		addrs = append(addrs, ip.String())
+	}
+
+	return addrs, ttl, nil
+}
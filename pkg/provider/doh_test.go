@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newDoHServer a DoH server answering the A queries for the names with 127.0.0.1, and NXDOMAIN for any other name
+func newDoHServer(t *testing.T, names ...string) (*httptest.Server, *int) {
+	queries := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, dohContentType, r.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(t, err)
+
+		var query dnsmessage.Message
+		require.Nil(t, query.Unpack(body))
+		queries++
+
+		question := query.Questions[0]
+		response := dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RCode: dnsmessage.RCodeNameError},
+			Questions: query.Questions,
+		}
+		for _, name := range names {
+			if question.Name.String() == name+"." {
+				response.RCode = dnsmessage.RCodeSuccess
+				if question.Type == dnsmessage.TypeA {
+					response.Answers = []dnsmessage.Resource{{
+						Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+						Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+					}}
+				}
+			}
+		}
+
+		packed, err := response.Pack()
+		require.Nil(t, err)
+		w.Header().Set("Content-Type", dohContentType)
+		w.Write(packed)
+	}))
+	return ts, &queries
+}
+
+func TestDoHResolverLookupHost(t *testing.T) {
+	ts, queries := newDoHServer(t, "idp.example.com")
+	defer ts.Close()
+
+	r := NewDoHResolver(ts.URL)
+	r.client = ts.Client()
+
+	addrs, err := r.LookupHost(context.Background(), "IdP.example.com")
+	require.Nil(t, err)
+	require.Equal(t, []string{"127.0.0.1"}, addrs)
+	require.Equal(t, 2, *queries)
+
+	// the answer is cached for its TTL
+	_, err = r.LookupHost(context.Background(), "idp.example.com")
+	require.Nil(t, err)
+	require.Equal(t, 2, *queries)
+
+	_, err = r.LookupHost(context.Background(), "unknown.example.com")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no such host")
+}
+
+func TestDoHResolverLookupHostAAAAFailure(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(t, err)
+
+		var query dnsmessage.Message
+		require.Nil(t, query.Unpack(body))
+
+		question := query.Questions[0]
+		if question.Type == dnsmessage.TypeAAAA {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		response := dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true},
+			Questions: query.Questions,
+			Answers: []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+				Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+			}},
+		}
+		packed, err := response.Pack()
+		require.Nil(t, err)
+		w.Header().Set("Content-Type", dohContentType)
+		w.Write(packed)
+	}))
+	defer ts.Close()
+
+	r := NewDoHResolver(ts.URL)
+	r.client = ts.Client()
+
+	addrs, err := r.LookupHost(context.Background(), "idp.example.com")
+	require.Nil(t, err)
+	require.Equal(t, []string{"127.0.0.1"}, addrs)
+}
+
+func TestDoHResolverDialContext(t *testing.T) {
+	ts, _ := newDoHServer(t, "idp.example.com")
+	defer ts.Close()
+
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer idp.Close()
+
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(idp.URL, "http://"))
+	require.Nil(t, err)
+
+	r := NewDoHResolver(ts.URL)
+	r.client = ts.Client()
+
+	tr := NewDefaultTransport(false)
+	tr.DialContext = r.DialContext
+
+	res, err := (&http.Client{Transport: tr}).Get("http://idp.example.com:" + port + "/")
+	require.Nil(t, err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.Equal(t, "idp.example.com:"+port, string(body))
+}
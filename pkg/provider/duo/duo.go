@@ -0,0 +1,105 @@
+package duo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/duouniversal"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logrus.WithField("provider", "duo")
+
+// Client wrapper around Duo SSO
+type Client struct {
+	client *provider.HTTPClient
+	prompt *duouniversal.Prompt
+}
+
+// New create a new Duo SSO client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		prompt: duouniversal.New(client, idpAccount.MFA, idpAccount.MFAWaitTimeout(duouniversal.DefaultTimeout), idpAccount.MFAWaitInterval(duouniversal.DefaultPollInterval)),
+	}, nil
+}
+
+// Authenticate logs into Duo SSO, completes the Universal Prompt and returns a SAML response
+func (dc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := dc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	passwordSubmitted := false
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		switch {
+		case duouniversal.IsPrompt(doc.Url):
+			logger.WithField("url", doc.Url.String()).Debug("universal prompt")
+			res, err = dc.prompt.Complete(doc, loginDetails)
+		case doc.Find("input[name=\"password\"]").Size() > 0:
+			if passwordSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc))
+			}
+			passwordSubmitted = true
+			res, err = page.SubmitForm(dc.client, doc, "form:has(input[name=\"password\"])", fillLogin(loginDetails))
+		case doc.Find("input[name=\"username\"]").Size() > 0:
+			res, err = page.SubmitForm(dc.client, doc, "form:has(input[name=\"username\"])", fillLogin(loginDetails))
+		case doc.Find("form[method=\"post\"], form[method=\"POST\"]").Size() > 0:
+			// auto submitted forms bouncing between the SSO and the prompt
+			res, err = page.SubmitForm(dc.client, doc, "form[method=\"post\"], form[method=\"POST\"]", fillLogin(loginDetails))
+		default:
+			return "", fmt.Errorf("unexpected page returned by Duo SSO: %s", doc.Url.String())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("Duo SSO login did not complete after %d steps", page.MaxSteps)
+}
+
+// fillLogin fill in the username and password fields the form contains
+func fillLogin(loginDetails *creds.LoginDetails) func(*page.Form, *goquery.Selection) {
+	return func(form *page.Form, selection *goquery.Selection) {
+		if selection.Find("input[name=\"username\"]").Size() > 0 {
+			form.Values.Set("username", loginDetails.Username)
+		}
+		if selection.Find("input[name=\"password\"]").Size() > 0 {
+			form.Values.Set("password", loginDetails.Password)
+		}
+	}
+}
+
+func loginError(doc *goquery.Document) string {
+	msg := strings.TrimSpace(doc.Find(".error-message, .alert, [role=\"alert\"]").First().Text())
+	if msg == "" {
+		msg = "invalid username or password"
+	}
+	return msg
+}
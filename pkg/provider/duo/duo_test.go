@@ -0,0 +1,131 @@
+package duo
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/duouniversal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/loginpage.html")
+	require.Nil(t, err)
+	pluginPage, err := ioutil.ReadFile("example/plugin.html")
+	require.Nil(t, err)
+	promptPage, err := ioutil.ReadFile("example/prompt.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/saml2/sp/app/sso":
+			w.Write(loginPage)
+		case "/saml2/idp/login":
+			require.Equal(t, "user", r.PostForm.Get("username"))
+			require.Equal(t, "secret", r.PostForm.Get("password"))
+			http.Redirect(w, r, "/frame/frameless/v4/auth?sid=session-1&tx=frameless-tx", http.StatusFound)
+		case "/frame/frameless/v4/auth":
+			if r.Method == "GET" {
+				w.Write(pluginPage)
+				return
+			}
+			http.Redirect(w, r, "/frame/v4/auth/prompt?sid=session-1", http.StatusFound)
+		case "/frame/v4/auth/prompt":
+			w.Write(promptPage)
+		case "/frame/v4/auth/prompt/data":
+			w.Write([]byte(`{"stat":"OK","response":{"phones":[{"key":"DPXXXXXXXX","name":"iPhone"}]}}`))
+		case "/frame/v4/prompt":
+			require.Equal(t, "DPXXXXXXXX", r.PostForm.Get("device"))
+			require.Equal(t, duouniversal.FactorPush, r.PostForm.Get("factor"))
+			w.Write([]byte(`{"stat":"OK","response":{"txid":"tx-1"}}`))
+		case "/frame/v4/status":
+			w.Write([]byte(`{"stat":"OK","response":{"status_code":"allow"}}`))
+		case "/frame/v4/oidc/exit":
+			require.Equal(t, "prompt-xsrf-token", r.PostForm.Get("_xsrf"))
+			require.Equal(t, "tx-1", r.PostForm.Get("txid"))
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	dc, err := New(&cfg.IDPAccount{MFA: "PUSH"})
+	require.Nil(t, err)
+
+	samlAssertion, err := dc.Authenticate(&creds.LoginDetails{URL: ts.URL + "/saml2/sp/app/sso", Username: "user", Password: "secret"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateDenied(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/loginpage.html")
+	require.Nil(t, err)
+	pluginPage, err := ioutil.ReadFile("example/plugin.html")
+	require.Nil(t, err)
+	promptPage, err := ioutil.ReadFile("example/prompt.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/saml2/sp/app/sso":
+			w.Write(loginPage)
+		case "/saml2/idp/login":
+			http.Redirect(w, r, "/frame/frameless/v4/auth?sid=session-1&tx=frameless-tx", http.StatusFound)
+		case "/frame/frameless/v4/auth":
+			if r.Method == "GET" {
+				w.Write(pluginPage)
+				return
+			}
+			http.Redirect(w, r, "/frame/v4/auth/prompt?sid=session-1", http.StatusFound)
+		case "/frame/v4/auth/prompt":
+			w.Write(promptPage)
+		case "/frame/v4/auth/prompt/data":
+			w.Write([]byte(`{"stat":"OK","response":{"phones":[{"key":"DPXXXXXXXX","name":"iPhone"}]}}`))
+		case "/frame/v4/prompt":
+			w.Write([]byte(`{"stat":"OK","response":{"txid":"tx-1"}}`))
+		case "/frame/v4/status":
+			w.Write([]byte(`{"stat":"OK","response":{"status_code":"deny","reason":"User declined"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	dc, err := New(&cfg.IDPAccount{MFA: "PUSH"})
+	require.Nil(t, err)
+
+	_, err = dc.Authenticate(&creds.LoginDetails{URL: ts.URL + "/saml2/sp/app/sso", Username: "user", Password: "secret"})
+	require.EqualError(t, err, "Duo authentication failed: User declined")
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/loginpage.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/saml2/sp/app/sso":
+			w.Write(loginPage)
+		case "/saml2/idp/login":
+			w.Write([]byte(`<html><body><div class="error-message">Incorrect password</div>` + string(loginPage) + `</body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	dc, err := New(&cfg.IDPAccount{MFA: "PUSH"})
+	require.Nil(t, err)
+
+	_, err = dc.Authenticate(&creds.LoginDetails{URL: ts.URL + "/saml2/sp/app/sso", Username: "user", Password: "wrong"})
+	require.EqualError(t, err, "login failed: Incorrect password")
+}
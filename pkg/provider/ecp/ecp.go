@@ -0,0 +1,269 @@
+package ecp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/beevik/etree"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	soapNS     = "http://schemas.xmlsoap.org/soap/envelope/"
+	ecpNS      = "urn:oasis:names:tc:SAML:2.0:profiles:SSO:ecp"
+	protocolNS = "urn:oasis:names:tc:SAML:2.0:protocol"
+
+	statusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+
+	// defaultACSURL the Alibaba Cloud assertion consumer the assertion is requested for
+	defaultACSURL = "https://signin.aliyun.com/saml-role/sso"
+)
+
+var logger = logrus.WithField("provider", "ecp")
+
+// Client wrapper around a SAML ECP endpoint enabling authentication and retrieval of assertions
+type Client struct {
+	client     *provider.HTTPClient
+	idpAccount *cfg.IDPAccount
+}
+
+const authnRequestTpl = `<S:Envelope xmlns:S="http://schemas.xmlsoap.org/soap/envelope/">
+  <S:Body>
+    <samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"
+      ID="{{.ID}}"
+      Version="2.0"
+      IssueInstant="{{.IssueInstant}}"
+      ProtocolBinding="urn:oasis:names:tc:SAML:2.0:bindings:PAOS"
+      AssertionConsumerServiceURL="{{.AssertionConsumerServiceURL}}">
+      <saml:Issuer>{{.Issuer}}</saml:Issuer>{{if .NameIDFormat}}
+      <samlp:NameIDPolicy AllowCreate="true" Format="{{.NameIDFormat}}"/>{{end}}
+    </samlp:AuthnRequest>
+  </S:Body>
+</S:Envelope>`
+
+type authnRequestData struct {
+	ID                          string
+	IssueInstant                string
+	AssertionConsumerServiceURL string
+	Issuer                      string
+	NameIDFormat                string
+}
+
+// New creates a new ECP client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client:     client,
+		idpAccount: idpAccount,
+	}, nil
+}
+
+// Authenticate send an AuthnRequest to the ECP endpoint of the IdP with the username and password, and return the SAML
+// response found in the SOAP reply
+func (c *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+	acsURL := c.acsURL()
+
+	body, err := authnRequest(authnRequestData{
+		ID:                          "_" + uuid.New().String(),
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		AssertionConsumerServiceURL: acsURL,
+		Issuer:                      c.issuer(),
+		NameIDFormat:                c.idpAccount.ECPNameIDFormat,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", loginDetails.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err, "error building ECP request")
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("Accept", "text/xml, application/vnd.paos+xml")
+	req.SetBasicAuth(loginDetails.Username, loginDetails.Password)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error sending ECP request")
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+	logger.WithField("status", res.StatusCode).WithField("body", string(data)).Debug("ECP response")
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return "", errors.New("login failed: the IdP refused the username or password")
+	}
+
+	samlResponse, err := extractResponse(data, acsURL)
+	if err != nil {
+		if res.StatusCode != http.StatusOK {
+			return "", errors.Wrapf(err, "ECP endpoint returned %s", res.Status)
+		}
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(samlResponse)), nil
+}
+
+func (c *Client) acsURL() string {
+	if c.idpAccount.ECPACSURL != "" {
+		return c.idpAccount.ECPACSURL
+	}
+	return defaultACSURL
+}
+
+func (c *Client) issuer() string {
+	if c.idpAccount.ECPIssuer != "" {
+		return c.idpAccount.ECPIssuer
+	}
+	return c.idpAccount.AlibabaCloudURN
+}
+
+// authnRequest render the SOAP envelope carrying the AuthnRequest
+func authnRequest(data authnRequestData) ([]byte, error) {
+	t, err := template.New("authnRequest").Parse(authnRequestTpl)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing authnRequest template")
+	}
+
+	data.Issuer = escape(data.Issuer)
+	data.AssertionConsumerServiceURL = escape(data.AssertionConsumerServiceURL)
+	data.NameIDFormat = escape(data.NameIDFormat)
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, errors.Wrap(err, "error rendering authnRequest")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// extractResponse find the SAML response in the SOAP reply of the IdP, checking the IdP answered with success for the
+// assertion consumer the assertion was requested for
+func extractResponse(data []byte, acsURL string) (string, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return "", errors.Wrap(err, "error parsing the ECP response as XML")
+	}
+	if doc.Root() == nil {
+		return "", errors.New("empty ECP response")
+	}
+
+	if fault := findElement(doc.Root(), soapNS, "Fault"); fault != nil {
+		msg := "no reason given"
+		if s := fault.SelectElement("faultstring"); s != nil && strings.TrimSpace(s.Text()) != "" {
+			msg = strings.TrimSpace(s.Text())
+		}
+		return "", fmt.Errorf("IdP returned a SOAP fault: %s", msg)
+	}
+
+	// the IdP names the consumer it issued the assertion for, which has to be the one requested
+	if header := findElement(doc.Root(), ecpNS, "Response"); header != nil {
+		if consumer := header.SelectAttrValue("AssertionConsumerServiceURL", ""); consumer != acsURL {
+			return "", fmt.Errorf("IdP issued the assertion for %s instead of %s", consumer, acsURL)
+		}
+	}
+
+	found := findElement(doc.Root(), protocolNS, "Response")
+	if found == nil {
+		return "", errors.New("unable to find the SAML Response in the ECP response")
+	}
+
+	if status := findElement(found, protocolNS, "StatusCode"); status == nil || status.SelectAttrValue("Value", "") != statusSuccess {
+		code := "unknown"
+		if status != nil {
+			code = status.SelectAttrValue("Value", code)
+		}
+		if message := findElement(found, protocolNS, "StatusMessage"); message != nil {
+			return "", fmt.Errorf("IdP response did not return success, status: %s, %s", code, strings.TrimSpace(message.Text()))
+		}
+		return "", fmt.Errorf("IdP response did not return success, status: %s", code)
+	}
+
+	// the response is taken out of the envelope, the namespaces declared on its ancestors go with it
+	response := found.Copy()
+	for parent := found.Parent(); parent != nil; parent = parent.Parent() {
+		for _, attr := range parent.Attr {
+			if isNamespaceDecl(attr) && !declares(response, attr) {
+				response.Attr = append(response.Attr, attr)
+			}
+		}
+	}
+
+	out := etree.NewDocument()
+	out.SetRoot(response)
+
+	samlResponse, err := out.WriteToString()
+	if err != nil {
+		return "", errors.Wrap(err, "error serializing the SAML Response")
+	}
+
+	return samlResponse, nil
+}
+
+// findElement the first element, depth first, with the namespace and local name whatever the prefix the IdP uses
+func findElement(e *etree.Element, namespace, tag string) *etree.Element {
+	if e.Tag == tag && namespaceURI(e) == namespace {
+		return e
+	}
+	for _, child := range e.ChildElements() {
+		if found := findElement(child, namespace, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// namespaceURI the namespace the prefix of the element is bound to on it or one of its ancestors
+func namespaceURI(e *etree.Element) string {
+	prefix := e.Space
+	for ; e != nil; e = e.Parent() {
+		for _, attr := range e.Attr {
+			if (prefix != "" && attr.Space == "xmlns" && attr.Key == prefix) || (prefix == "" && attr.Space == "" && attr.Key == "xmlns") {
+				return attr.Value
+			}
+		}
+	}
+	return ""
+}
+
+func isNamespaceDecl(attr etree.Attr) bool {
+	return attr.Space == "xmlns" || (attr.Space == "" && attr.Key == "xmlns")
+}
+
+func declares(e *etree.Element, decl etree.Attr) bool {
+	for _, attr := range e.Attr {
+		if attr.Space == decl.Space && attr.Key == decl.Key {
+			return true
+		}
+	}
+	return false
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
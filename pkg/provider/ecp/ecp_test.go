@@ -0,0 +1,83 @@
+package ecp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	response, err := ioutil.ReadFile("example/response.xml")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(t, err)
+
+		doc := etree.NewDocument()
+		require.Nil(t, doc.ReadFromBytes(body))
+
+		request := findElement(doc.Root(), protocolNS, "AuthnRequest")
+		require.NotNil(t, request)
+		require.Equal(t, "https://signin.aliyun.com/saml-role/sso", request.SelectAttrValue("AssertionConsumerServiceURL", ""))
+		require.Equal(t, "urn:alibaba:cloudcomputing", request.SelectElement("saml:Issuer").Text())
+		require.Equal(t, "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent", request.SelectElement("samlp:NameIDPolicy").SelectAttrValue("Format", ""))
+
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write(response)
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{AlibabaCloudURN: "urn:alibaba:cloudcomputing", ECPNameIDFormat: "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL, Username: "user", Password: "secret"})
+	require.Nil(t, err)
+
+	decoded, err := base64.StdEncoding.DecodeString(samlAssertion)
+	require.Nil(t, err)
+
+	// the response keeps the namespaces declared on the envelope
+	doc := etree.NewDocument()
+	require.Nil(t, doc.ReadFromBytes(decoded))
+	require.Equal(t, "Response", doc.Root().Tag)
+	require.Equal(t, protocolNS, namespaceURI(doc.Root()))
+	require.Equal(t, "urn:oasis:names:tc:SAML:2.0:assertion", namespaceURI(doc.Root().SelectElement("saml:Assertion")))
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL, Username: "user", Password: "wrong"})
+	require.EqualError(t, err, "login failed: the IdP refused the username or password")
+}
+
+func TestExtractResponseErrors(t *testing.T) {
+	fault, err := ioutil.ReadFile("example/fault.xml")
+	require.Nil(t, err)
+	response, err := ioutil.ReadFile("example/response.xml")
+	require.Nil(t, err)
+
+	_, err = extractResponse(fault, defaultACSURL)
+	require.EqualError(t, err, "IdP returned a SOAP fault: Unknown service provider urn:alibaba:cloudcomputing:unknown")
+
+	_, err = extractResponse(response, "https://signin.alibabacloud.com/saml-role/sso")
+	require.EqualError(t, err, "IdP issued the assertion for https://signin.aliyun.com/saml-role/sso instead of https://signin.alibabacloud.com/saml-role/sso")
+
+	denied := bytes.Replace(response,
+		[]byte(`<samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/>`),
+		[]byte(`<samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Responder"/><samlp:StatusMessage>User is not allowed to access the service</samlp:StatusMessage>`), 1)
+
+	_, err = extractResponse(denied, defaultACSURL)
+	require.EqualError(t, err, "IdP response did not return success, status: urn:oasis:names:tc:SAML:2.0:status:Responder, User is not allowed to access the service")
+}
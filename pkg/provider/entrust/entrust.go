@@ -0,0 +1,311 @@
+package entrust
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// the Entrust authenticators
+const (
+	authenticatorPassword = "PASSWORD"
+	authenticatorPush     = "TOKENPUSH"
+	authenticatorGrid     = "GRID"
+)
+
+// the answers to a soft token push returned by Entrust
+const (
+	pushNoResponse = "NO_RESPONSE"
+	pushConfirm    = "CONFIRM"
+	pushConcern    = "CONCERN"
+	pushCancel     = "CANCEL"
+)
+
+// the saml2alibabacloud names of the authenticators
+var mfaAuthenticators = map[string]string{
+	"PUSH": authenticatorPush,
+	"GRID": authenticatorGrid,
+}
+
+// maxPushPolls the number of times a pending push is checked before giving up
+const maxPushPolls = 60
+
+// pushPeriod how long to wait between two polls of a pending push
+var pushPeriod = 2 * time.Second
+
+var logger = logrus.WithField("provider", "entrust")
+
+// Client wrapper around Entrust Identity as a Service
+type Client struct {
+	client *provider.HTTPClient
+	appID  string
+	mfa    string
+}
+
+// New create a new Entrust client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		appID:  idpAccount.AppID,
+		mfa:    idpAccount.MFA,
+	}, nil
+}
+
+// Authenticate logs into Entrust through its authentication API, completing a soft token push or a grid card
+// challenge when a second factor is required, and returns the SAML response of the Alibaba Cloud application
+func (ec *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	u, err := url.Parse(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing url")
+	}
+
+	api := fmt.Sprintf("%s://%s/api/web/v1/authentication/users", u.Scheme, u.Host)
+
+	user := map[string]interface{}{
+		"userId":        loginDetails.Username,
+		"applicationId": ec.appID,
+	}
+
+	resp, _, err := ec.call(api, "", user)
+	if err != nil {
+		return "", errors.Wrap(err, "error looking up user")
+	}
+	if !contains(gjson.Get(resp, "authenticationTypes").Array(), authenticatorPassword) {
+		return "", errors.New("Entrust doesn't offer password authentication to the user for the application")
+	}
+
+	resp, token, err := ec.call(api+"/authenticate/"+authenticatorPassword+"/complete", "", with(user, "response", loginDetails.Password))
+	if err != nil {
+		return "", errors.Wrap(err, "error logging in")
+	}
+
+	for step := 0; !gjson.Get(resp, "authenticationCompleted").Bool(); step++ {
+		if step == 2 {
+			return "", errors.New("login failed: Entrust keeps asking for verification")
+		}
+
+		authenticator, ok := ec.selectAuthenticator(gjson.Get(resp, "secondFactorAuthenticationTypes").Array())
+		if !ok {
+			return "", fmt.Errorf("no supported Entrust authenticator for MFA type %s, set up a soft token or a grid card", ec.mfa)
+		}
+
+		logger.WithField("authenticator", authenticator).Debug("verifying second factor")
+
+		switch authenticator {
+		case authenticatorPush:
+			resp, token, err = ec.verifyPush(api, token, user)
+		case authenticatorGrid:
+			resp, token, err = ec.verifyGrid(api, token, user, loginDetails)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	req, err := http.NewRequest("GET", loginDetails.URL, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Authorization", token)
+
+	res, err := ec.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving SAML response")
+	}
+
+	samlAssertion, err := extractSAMLResponse(res)
+	if err != nil {
+		return "", err
+	}
+	if samlAssertion == "" {
+		return "", errors.New("no SAML response returned by Entrust, check the user is entitled to the Alibaba Cloud application")
+	}
+
+	return samlAssertion, nil
+}
+
+// selectAuthenticator the second factor matching the MFA type, Auto uses the first supported one the user has
+func (ec *Client) selectAuthenticator(types []gjson.Result) (string, bool) {
+	for _, t := range types {
+		for mfa, authenticator := range mfaAuthenticators {
+			if t.String() != authenticator {
+				continue
+			}
+			if strings.EqualFold(ec.mfa, "Auto") || strings.EqualFold(ec.mfa, mfa) {
+				return authenticator, true
+			}
+		}
+	}
+	return "", false
+}
+
+// verifyPush send a push to the Entrust soft token and wait for it to be confirmed
+func (ec *Client) verifyPush(api, token string, user map[string]interface{}) (string, string, error) {
+	resp, token, err := ec.call(api+"/authenticate/"+authenticatorPush, token, user)
+	if err != nil {
+		return "", "", errors.Wrap(err, "error sending push notification")
+	}
+
+	if challenge := gjson.Get(resp, "tokenPushMutualChallenge").String(); challenge != "" {
+		log.Printf("Confirm the sign in from the Entrust Identity app, selecting %s", challenge)
+	} else {
+		log.Println("Confirm the sign in from the Entrust Identity app")
+	}
+
+	for i := 0; i < maxPushPolls; i++ {
+		resp, token, err = ec.call(api+"/authenticate/"+authenticatorPush+"/complete", token, user)
+		if err != nil {
+			return "", "", errors.Wrap(err, "error checking push status")
+		}
+
+		switch status := gjson.Get(resp, "status").String(); status {
+		case pushConfirm:
+			return resp, token, nil
+		case pushConcern:
+			return "", "", errors.New("the sign in was reported as suspicious from the Entrust Identity app")
+		case pushCancel:
+			return "", "", errors.New("the sign in was cancelled from the Entrust Identity app")
+		case pushNoResponse:
+			if err := ec.client.Sleep(pushPeriod); err != nil {
+				return "", "", errors.Wrap(err, "error waiting for the push approval")
+			}
+		default:
+			return "", "", fmt.Errorf("unexpected Entrust push status: %s", status)
+		}
+	}
+
+	return "", "", errors.New("timed out waiting for the push to be confirmed")
+}
+
+// verifyGrid answer the grid card challenge, the contents of the requested cells are given with --mfa-token
+// concatenated in the order of the challenge, or prompted for one by one
+func (ec *Client) verifyGrid(api, token string, user map[string]interface{}, loginDetails *creds.LoginDetails) (string, string, error) {
+	resp, token, err := ec.call(api+"/authenticate/"+authenticatorGrid, token, user)
+	if err != nil {
+		return "", "", errors.Wrap(err, "error retrieving grid challenge")
+	}
+
+	cells := gjson.Get(resp, "gridChallenge.challenge").Array()
+	if len(cells) == 0 {
+		return "", "", errors.New("no cells in the Entrust grid challenge")
+	}
+
+	answer := loginDetails.MFAToken
+	if answer == "" {
+		for _, cell := range cells {
+			answer += strings.TrimSpace(prompter.StringRequired("Grid card " + gridCell(cell)))
+		}
+	}
+
+	resp, token, err = ec.call(api+"/authenticate/"+authenticatorGrid+"/complete", token, with(user, "response", answer))
+	if err != nil {
+		return "", "", errors.Wrap(err, "error verifying grid challenge")
+	}
+
+	return resp, token, nil
+}
+
+// gridCell the label of a challenged cell as printed on the card, a column letter followed by a row number
+func gridCell(cell gjson.Result) string {
+	return fmt.Sprintf("%c%d", 'A'+rune(cell.Get("column").Int()), cell.Get("row").Int()+1)
+}
+
+// call post to the authentication API, returning the response along with the token of the authentication,
+// which Entrust renews in the Authorization header of its responses
+func (ec *Client) call(location, token string, body interface{}) (string, string, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequest("POST", location, bytes.NewReader(data))
+	if err != nil {
+		return "", "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Add("Authorization", token)
+	}
+
+	res, err := ec.client.Do(req)
+	if err != nil {
+		return "", "", errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", "", errors.Wrap(err, "error retrieving body")
+	}
+
+	resp := string(resBody)
+
+	if res.StatusCode >= 400 {
+		msg := gjson.Get(resp, "errorMessage").String()
+		if msg == "" {
+			msg = res.Status
+		}
+		return "", "", fmt.Errorf("Entrust returned an error: %s", msg)
+	}
+
+	if renewed := res.Header.Get("Authorization"); renewed != "" {
+		token = renewed
+	}
+
+	return resp, token, nil
+}
+
+// with a copy of the body with the key set
+func with(body map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	copied := map[string]interface{}{key: value}
+	for k, v := range body {
+		copied[k] = v
+	}
+	return copied
+}
+
+func contains(values []gjson.Result, value string) bool {
+	for _, v := range values {
+		if v.String() == value {
+			return true
+		}
+	}
+	return false
+}
+
+// extractSAMLResponse the SAML response posted to Alibaba Cloud by the page, empty when the page has none
+func extractSAMLResponse(res *http.Response) (string, error) {
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build document from response")
+	}
+
+	samlAssertion, _ := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
+
+	return samlAssertion, nil
+}
@@ -0,0 +1,251 @@
+package entrust
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	appPath = "/api/saml/SAML2/IDPSSO/3c9a8e0f-5b1d-4f7e-9a2c-6d8b0e1f2a3b"
+	api     = "/api/web/v1/authentication/users"
+)
+
+func TestAuthenticatePush(t *testing.T) {
+	pushPeriod = 0
+
+	userResp, err := ioutil.ReadFile("example/user.json")
+	require.Nil(t, err)
+	passwordResp, err := ioutil.ReadFile("example/password.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	pushStatuses := []string{pushNoResponse, pushNoResponse, pushConfirm}
+	var calls []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+
+		body := map[string]string{}
+		if r.Method == "POST" {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, "user@example.com", body["userId"])
+			require.Equal(t, "3c9a8e0f-5b1d-4f7e-9a2c-6d8b0e1f2a3b", body["applicationId"])
+		}
+
+		switch r.URL.Path {
+		case appPath:
+			require.Equal(t, "authenticated", r.Header.Get("Authorization"))
+			w.Write(assertionPage)
+		case api:
+			w.Write(userResp)
+		case api + "/authenticate/PASSWORD/complete":
+			require.Equal(t, "secret", body["response"])
+			w.Header().Set("Authorization", "first-factor")
+			w.Write(passwordResp)
+		case api + "/authenticate/TOKENPUSH":
+			require.Equal(t, "first-factor", r.Header.Get("Authorization"))
+			w.Write([]byte(`{"tokenPushMutualChallenge":"42","authenticationCompleted":false}`))
+		case api + "/authenticate/TOKENPUSH/complete":
+			require.Equal(t, "first-factor", r.Header.Get("Authorization"))
+			status := pushStatuses[0]
+			pushStatuses = pushStatuses[1:]
+			if status == pushConfirm {
+				w.Header().Set("Authorization", "authenticated")
+			}
+			fmt.Fprintf(w, `{"status":"%s","authenticationCompleted":%t}`, status, status == pushConfirm)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.AppID = "3c9a8e0f-5b1d-4f7e-9a2c-6d8b0e1f2a3b"
+	idpAccount.MFA = "Auto"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL + appPath, Username: "user@example.com", Password: "secret"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.Equal(t, []string{
+		api,
+		api + "/authenticate/PASSWORD/complete",
+		api + "/authenticate/TOKENPUSH",
+		api + "/authenticate/TOKENPUSH/complete",
+		api + "/authenticate/TOKENPUSH/complete",
+		api + "/authenticate/TOKENPUSH/complete",
+		appPath,
+	}, calls)
+}
+
+func TestAuthenticateGrid(t *testing.T) {
+	userResp, err := ioutil.ReadFile("example/user.json")
+	require.Nil(t, err)
+	passwordResp, err := ioutil.ReadFile("example/password.json")
+	require.Nil(t, err)
+	gridResp, err := ioutil.ReadFile("example/grid.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		if r.Method == "POST" {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		}
+
+		switch r.URL.Path {
+		case appPath:
+			require.Equal(t, "authenticated", r.Header.Get("Authorization"))
+			w.Write(assertionPage)
+		case api:
+			w.Write(userResp)
+		case api + "/authenticate/PASSWORD/complete":
+			w.Header().Set("Authorization", "first-factor")
+			w.Write(passwordResp)
+		case api + "/authenticate/GRID":
+			require.Equal(t, "first-factor", r.Header.Get("Authorization"))
+			w.Write(gridResp)
+		case api + "/authenticate/GRID/complete":
+			require.Equal(t, "first-factor", r.Header.Get("Authorization"))
+			require.Equal(t, "7K3P9W", body["response"])
+			w.Header().Set("Authorization", "authenticated")
+			w.Write([]byte(`{"authenticationCompleted":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.AppID = "3c9a8e0f-5b1d-4f7e-9a2c-6d8b0e1f2a3b"
+	idpAccount.MFA = "GRID"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL + appPath, Username: "user@example.com", Password: "secret", MFAToken: "7K3P9W"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadGrid(t *testing.T) {
+	userResp, err := ioutil.ReadFile("example/user.json")
+	require.Nil(t, err)
+	passwordResp, err := ioutil.ReadFile("example/password.json")
+	require.Nil(t, err)
+	gridResp, err := ioutil.ReadFile("example/grid.json")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case api:
+			w.Write(userResp)
+		case api + "/authenticate/PASSWORD/complete":
+			w.Header().Set("Authorization", "first-factor")
+			w.Write(passwordResp)
+		case api + "/authenticate/GRID":
+			w.Write(gridResp)
+		case api + "/authenticate/GRID/complete":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorCode":"invalid_response","errorMessage":"The grid response is incorrect."}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.AppID = "3c9a8e0f-5b1d-4f7e-9a2c-6d8b0e1f2a3b"
+	idpAccount.MFA = "GRID"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + appPath, Username: "user@example.com", Password: "secret", MFAToken: "000000"})
+	require.EqualError(t, err, "error verifying grid challenge: Entrust returned an error: The grid response is incorrect.")
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	userResp, err := ioutil.ReadFile("example/user.json")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case api:
+			w.Write(userResp)
+		case api + "/authenticate/PASSWORD/complete":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorCode":"invalid_credentials","errorMessage":"The user ID or password is incorrect."}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.AppID = "3c9a8e0f-5b1d-4f7e-9a2c-6d8b0e1f2a3b"
+	idpAccount.MFA = "Auto"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + appPath, Username: "user@example.com", Password: "wrong"})
+	require.EqualError(t, err, "error logging in: Entrust returned an error: The user ID or password is incorrect.")
+}
+
+func TestAuthenticatePushConcern(t *testing.T) {
+	pushPeriod = 0
+
+	userResp, err := ioutil.ReadFile("example/user.json")
+	require.Nil(t, err)
+	passwordResp, err := ioutil.ReadFile("example/password.json")
+	require.Nil(t, err)
+
+	pushStatuses := []string{pushNoResponse, pushConcern}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case api:
+			w.Write(userResp)
+		case api + "/authenticate/PASSWORD/complete":
+			w.Header().Set("Authorization", "first-factor")
+			w.Write(passwordResp)
+		case api + "/authenticate/TOKENPUSH":
+			w.Write([]byte(`{"tokenPushMutualChallenge":"42","authenticationCompleted":false}`))
+		case api + "/authenticate/TOKENPUSH/complete":
+			fmt.Fprintf(w, `{"status":"%s","authenticationCompleted":false}`, pushStatuses[0])
+			pushStatuses = pushStatuses[1:]
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.AppID = "3c9a8e0f-5b1d-4f7e-9a2c-6d8b0e1f2a3b"
+	idpAccount.MFA = "Auto"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + appPath, Username: "user@example.com", Password: "secret"})
+	require.EqualError(t, err, "the sign in was reported as suspicious from the Entrust Identity app")
+}
+
+func TestGridCell(t *testing.T) {
+	require.Equal(t, "B1", gridCell(gjson.Parse(`{"row":0,"column":1}`)))
+	require.Equal(t, "E4", gridCell(gjson.Parse(`{"row":3,"column":4}`)))
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/fingerprint"
+	"github.com/sirupsen/logrus"
+)
+
+// FingerprintsPath the file the client fingerprints of the accounts are kept in, moved with --context
+var FingerprintsPath = fingerprint.DefaultPath
+
+// PersistFingerprints whether the fingerprint generated at the first login is saved, login --no-write only reads them
+var PersistFingerprints = true
+
+// accountFingerprint the fingerprint presented to the IdP of the account when client_fingerprint is persist, it is
+// generated at the first login of the user at the IdP and nil when it can't be read, the login then goes on with the
+// usual headers
+func accountFingerprint(account *cfg.IDPAccount) *fingerprint.Fingerprint {
+	if account.ClientFingerprint != "persist" {
+		return nil
+	}
+
+	store, err := fingerprint.New(FingerprintsPath)
+	if err != nil {
+		logrus.WithError(err).Warn("unable to open the client fingerprints")
+		return nil
+	}
+
+	userAgent := account.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	generate := func() *fingerprint.Fingerprint {
+		return fingerprint.Generate(userAgent, os.Getenv)
+	}
+
+	var fp *fingerprint.Fingerprint
+	if PersistFingerprints {
+		fp, err = store.Get(fingerprint.Key(account.URL, account.Username), generate)
+	} else {
+		fp, err = store.Lookup(fingerprint.Key(account.URL, account.Username))
+		if err == nil && fp == nil {
+			fp = generate()
+		}
+	}
+	if err != nil {
+		logrus.WithError(err).Warn("unable to load the client fingerprint")
+		return nil
+	}
+
+	return fp
+}
+
+// withFingerprintTLS a copy of tr presenting the TLS parameters of fp, transports of another kind are left alone
+func withFingerprintTLS(tr http.RoundTripper, fp *fingerprint.Fingerprint) http.RoundTripper {
+	switch t := tr.(type) {
+	case *http.Transport:
+		t = t.Clone()
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		fp.ApplyTLS(t.TLSClientConfig)
+		return t
+	case *skipVerifyTransport:
+		return &skipVerifyTransport{
+			verified: withFingerprintTLS(t.verified, fp).(*http.Transport),
+			insecure: withFingerprintTLS(t.insecure, fp).(*http.Transport),
+			hosts:    t.hosts,
+			reported: map[string]bool{},
+		}
+	}
+	return tr
+}
@@ -0,0 +1,328 @@
+package forgerock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// maxSteps the number of callbacks answered before giving up, a push is polled with the same callbacks
+	maxSteps = 60
+
+	// defaultCookieName the SSO token cookie of AM, used when the server info doesn't name another one
+	defaultCookieName = "iPlanetDirectoryPro"
+
+	apiVersion = "resource=2.0, protocol=1.0"
+)
+
+// pollScale the unit of the waitTime of a PollingWaitCallback
+var pollScale = time.Millisecond
+
+// otpPrompts the words of a NameCallback prompt asking for a code rather than the username
+var otpPrompts = []string{"one time", "one-time", "otp", "code", "passcode", "token"}
+
+var logger = logrus.WithField("provider", "forgerock")
+
+// Client wrapper around ForgeRock Access Management
+type Client struct {
+	client *provider.HTTPClient
+	tree   string
+}
+
+// New create a new ForgeRock AM client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		tree:   idpAccount.ResourceID,
+	}, nil
+}
+
+// authResponse the state of the authentication tree, the callbacks to answer and send back along with the authId,
+// or the SSO token once the tree is complete
+type authResponse struct {
+	AuthID    string      `json:"authId,omitempty"`
+	Callbacks []*callback `json:"callbacks,omitempty"`
+	TokenID   string      `json:"tokenId,omitempty"`
+}
+
+type callback struct {
+	Type   string       `json:"type"`
+	Output []*nameValue `json:"output"`
+	Input  []*nameValue `json:"input,omitempty"`
+	ID     *int         `json:"_id,omitempty"`
+}
+
+type nameValue struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// Authenticate logs into ForgeRock AM by answering the callbacks of its authentication tree, the username, password
+// and OTP or push nodes, and returns the SAML response of the IdP initiated SSO URL
+func (fc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	ssoURL, err := url.Parse(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing SSO URL")
+	}
+
+	base, realm, err := parseSSOURL(ssoURL)
+	if err != nil {
+		return "", err
+	}
+
+	authURL := base + "/json/realms/root" + realmPath(realm) + "/authenticate"
+	if fc.tree != "" {
+		authURL += "?" + url.Values{"authIndexType": {"service"}, "authIndexValue": {fc.tree}}.Encode()
+	}
+
+	authResp, err := fc.call(authURL, &authResponse{})
+	if err != nil {
+		return "", errors.Wrap(err, "error starting authentication")
+	}
+
+	passwordSubmitted := false
+
+	for step := 0; authResp.TokenID == ""; step++ {
+		if step == maxSteps {
+			return "", errors.New("login failed: the authentication tree didn't complete")
+		}
+
+		err = fc.answerCallbacks(authResp.Callbacks, loginDetails, &passwordSubmitted)
+		if err != nil {
+			return "", err
+		}
+
+		authResp, err = fc.call(authURL, authResp)
+		if err != nil {
+			return "", errors.Wrap(err, "error submitting callbacks")
+		}
+	}
+
+	cookieName, err := fc.cookieName(base)
+	if err != nil {
+		return "", err
+	}
+
+	fc.client.Jar.SetCookies(ssoURL, []*http.Cookie{{Name: cookieName, Value: authResp.TokenID, Path: "/"}})
+
+	res, err := fc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving SAML response")
+	}
+
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build document from response")
+	}
+
+	samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
+	if !ok {
+		return "", errors.New("no SAML response returned by ForgeRock AM, check the IdP initiated SSO URL and the entity ID of Alibaba Cloud")
+	}
+
+	return samlAssertion, nil
+}
+
+// answerCallbacks fill the inputs of the callbacks, the first PasswordCallback gets the password and any later one,
+// like a NameCallback asking for a code, the OTP, a PollingWaitCallback is waited for and sent back unchanged
+func (fc *Client) answerCallbacks(callbacks []*callback, loginDetails *creds.LoginDetails, passwordSubmitted *bool) error {
+	for _, cb := range callbacks {
+		prompt := cb.output("prompt")
+
+		logger.WithField("type", cb.Type).WithField("prompt", prompt).Debug("answering callback")
+
+		switch cb.Type {
+		case "NameCallback":
+			if isOTPPrompt(prompt) {
+				cb.answer(otp(loginDetails))
+			} else {
+				cb.answer(loginDetails.Username)
+			}
+		case "PasswordCallback":
+			if *passwordSubmitted {
+				cb.answer(otp(loginDetails))
+			} else {
+				cb.answer(loginDetails.Password)
+				*passwordSubmitted = true
+			}
+		case "ConfirmationCallback":
+			cb.answer(cb.outputValue("defaultOption"))
+		case "ChoiceCallback":
+			cb.answer(cb.outputValue("defaultChoice"))
+		case "PollingWaitCallback":
+			log.Println(cb.output("message"))
+			waitTime, _ := strconv.Atoi(cb.output("waitTime"))
+			if err := fc.client.Sleep(pollScale * time.Duration(waitTime)); err != nil {
+				return errors.Wrap(err, "error waiting for the polling callback")
+			}
+		case "TextOutputCallback":
+			log.Println(cb.output("message"))
+		case "HiddenValueCallback":
+		default:
+			return fmt.Errorf("unsupported ForgeRock callback %s, the authentication tree needs a browser", cb.Type)
+		}
+	}
+
+	return nil
+}
+
+// outputValue the value of the named output of the callback
+func (cb *callback) outputValue(name string) interface{} {
+	for _, o := range cb.Output {
+		if o.Name == name {
+			return o.Value
+		}
+	}
+	return nil
+}
+
+// output the value of the named output of the callback as text
+func (cb *callback) output(name string) string {
+	value := cb.outputValue(name)
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// answer set the value of the first input of the callback
+func (cb *callback) answer(value interface{}) {
+	if len(cb.Input) > 0 {
+		cb.Input[0].Value = value
+	}
+}
+
+func isOTPPrompt(prompt string) bool {
+	prompt = strings.ToLower(prompt)
+	for _, word := range otpPrompts {
+		if strings.Contains(prompt, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// otp the code of the OTP node, taken from --mfa-token when it is given
+func otp(loginDetails *creds.LoginDetails) string {
+	if loginDetails.MFAToken != "" {
+		return loginDetails.MFAToken
+	}
+	return prompter.RequestSecurityCode("000000")
+}
+
+// parseSSOURL the deployment URL of AM and the realm of the hosted IdP, taken from the metaAlias of the IdP initiated
+// SSO URL such as https://am.example.com/am/saml2/jsp/idpSSOInit.jsp?metaAlias=/alpha/idp
+func parseSSOURL(ssoURL *url.URL) (string, string, error) {
+	i := strings.Index(ssoURL.Path, "/saml2/")
+	if i == -1 {
+		return "", "", fmt.Errorf("unable to find the AM deployment in %s, use the IdP initiated SSO URL", ssoURL.String())
+	}
+
+	base := fmt.Sprintf("%s://%s%s", ssoURL.Scheme, ssoURL.Host, ssoURL.Path[:i])
+
+	metaAlias := strings.Trim(ssoURL.Query().Get("metaAlias"), "/")
+	realm := ""
+	if j := strings.LastIndex(metaAlias, "/"); j != -1 {
+		realm = metaAlias[:j]
+	}
+
+	return base, realm, nil
+}
+
+// realmPath the path of the realm below the root realm in the REST API
+func realmPath(realm string) string {
+	var path string
+	for _, name := range strings.Split(realm, "/") {
+		if name != "" {
+			path += "/realms/" + url.PathEscape(name)
+		}
+	}
+	return path
+}
+
+// cookieName the name of the SSO token cookie configured for the deployment
+func (fc *Client) cookieName(base string) (string, error) {
+	res, err := fc.client.Get(base + "/json/serverinfo/*")
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving server info")
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body")
+	}
+
+	if name := gjson.GetBytes(data, "cookieName").String(); res.StatusCode == http.StatusOK && name != "" {
+		return name, nil
+	}
+
+	return defaultCookieName, nil
+}
+
+func (fc *Client) call(location string, authReq *authResponse) (*authResponse, error) {
+	data, err := json.Marshal(authReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", location, bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept-API-Version", apiVersion)
+
+	res, err := fc.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving body")
+	}
+
+	if res.StatusCode >= 400 {
+		msg := gjson.GetBytes(resBody, "message").String()
+		if msg == "" {
+			msg = res.Status
+		}
+		return nil, fmt.Errorf("ForgeRock AM returned an error: %s", msg)
+	}
+
+	authResp := &authResponse{}
+	if err := json.Unmarshal(resBody, authResp); err != nil {
+		return nil, errors.Wrap(err, "error parsing authentication response")
+	}
+
+	return authResp, nil
+}
@@ -0,0 +1,174 @@
+package forgerock
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+const ssoPath = "/am/saml2/jsp/idpSSOInit.jsp?metaAlias=/alpha/idp&spEntityID=urn:alibaba:cloudcomputing"
+
+func TestAuthenticateOTP(t *testing.T) {
+	passwordPage, err := ioutil.ReadFile("example/password.json")
+	require.Nil(t, err)
+	otpPage, err := ioutil.ReadFile("example/otp.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/am/saml2/jsp/idpSSOInit.jsp":
+			require.Equal(t, "/alpha/idp", r.URL.Query().Get("metaAlias"))
+			c, err := r.Cookie("session-alpha")
+			require.Nil(t, err)
+			require.Equal(t, "sso-token", c.Value)
+			w.Write(assertionPage)
+		case "/am/json/serverinfo/*":
+			w.Write([]byte(`{"cookieName":"session-alpha","domains":[]}`))
+		case "/am/json/realms/root/realms/alpha/authenticate":
+			require.Equal(t, "resource=2.0, protocol=1.0", r.Header.Get("Accept-API-Version"))
+			require.Equal(t, "AlibabaCloud", r.URL.Query().Get("authIndexValue"))
+
+			authReq := &authResponse{}
+			require.Nil(t, json.NewDecoder(r.Body).Decode(authReq))
+
+			switch authReq.AuthID {
+			case "":
+				w.Write(passwordPage)
+			case "eyJ0eXAiOiJKV1QiLCJhbGciOiJIUzI1NiJ9.password":
+				require.Equal(t, "wile", authReq.Callbacks[0].Input[0].Value)
+				require.Equal(t, "secret", authReq.Callbacks[1].Input[0].Value)
+				w.Write(otpPage)
+			case "eyJ0eXAiOiJKV1QiLCJhbGciOiJIUzI1NiJ9.otp":
+				require.Equal(t, "123456", authReq.Callbacks[1].Input[0].Value)
+				require.Equal(t, float64(0), authReq.Callbacks[2].Input[0].Value)
+				w.Write([]byte(`{"tokenId":"sso-token","successUrl":"/am/console","realm":"/alpha"}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto", ResourceID: "AlibabaCloud"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL + ssoPath, Username: "wile", Password: "secret", MFAToken: "123456"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticatePush(t *testing.T) {
+	pollScale = 0
+
+	passwordPage, err := ioutil.ReadFile("example/password.json")
+	require.Nil(t, err)
+	pushPage, err := ioutil.ReadFile("example/push.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	pushPolls := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/am/saml2/jsp/idpSSOInit.jsp":
+			require.Equal(t, "/alpha/idp", r.URL.Query().Get("metaAlias"))
+			c, err := r.Cookie("session-alpha")
+			require.Nil(t, err)
+			require.Equal(t, "sso-token", c.Value)
+			w.Write(assertionPage)
+		case "/am/json/serverinfo/*":
+			w.Write([]byte(`{"cookieName":"session-alpha","domains":[]}`))
+		case "/am/json/realms/root/realms/alpha/authenticate":
+			require.Equal(t, "resource=2.0, protocol=1.0", r.Header.Get("Accept-API-Version"))
+			require.Equal(t, "AlibabaCloud", r.URL.Query().Get("authIndexValue"))
+
+			authReq := &authResponse{}
+			require.Nil(t, json.NewDecoder(r.Body).Decode(authReq))
+
+			switch authReq.AuthID {
+			case "":
+				w.Write(passwordPage)
+			case "eyJ0eXAiOiJKV1QiLCJhbGciOiJIUzI1NiJ9.password":
+				require.Equal(t, "wile", authReq.Callbacks[0].Input[0].Value)
+				require.Equal(t, "secret", authReq.Callbacks[1].Input[0].Value)
+				w.Write(pushPage)
+			case "eyJ0eXAiOiJKV1QiLCJhbGciOiJIUzI1NiJ9.push":
+				require.Equal(t, "challenge", authReq.Callbacks[1].Input[0].Value)
+				pushPolls++
+				if pushPolls < 3 {
+					w.Write(pushPage)
+					return
+				}
+				w.Write([]byte(`{"tokenId":"sso-token","successUrl":"/am/console","realm":"/alpha"}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto", ResourceID: "AlibabaCloud"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL + ssoPath, Username: "wile", Password: "secret"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.Equal(t, 3, pushPolls)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	passwordPage, err := ioutil.ReadFile("example/password.json")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/am/json/serverinfo/*":
+			w.Write([]byte(`{"cookieName":"session-alpha","domains":[]}`))
+		case "/am/json/realms/root/realms/alpha/authenticate":
+			authReq := &authResponse{}
+			require.Nil(t, json.NewDecoder(r.Body).Decode(authReq))
+			if authReq.AuthID == "" {
+				w.Write(passwordPage)
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":401,"reason":"Unauthorized","message":"Login failure"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto", ResourceID: "AlibabaCloud"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + ssoPath, Username: "wile", Password: "wrong"})
+	require.EqualError(t, err, "error submitting callbacks: ForgeRock AM returned an error: Login failure")
+}
+
+func TestParseSSOURL(t *testing.T) {
+	ssoURL, err := url.Parse("https://am.example.com/openam/saml2/jsp/idpSSOInit.jsp?metaAlias=/idp&spEntityID=urn:alibaba:cloudcomputing")
+	require.Nil(t, err)
+
+	base, realm, err := parseSSOURL(ssoURL)
+	require.Nil(t, err)
+	require.Equal(t, "https://am.example.com/openam", base)
+	require.Equal(t, "", realm)
+	require.Equal(t, "/realms/alpha/realms/emea", realmPath("alpha/emea"))
+
+	ssoURL, err = url.Parse("https://am.example.com/login")
+	require.Nil(t, err)
+
+	_, _, err = parseSSOURL(ssoURL)
+	require.EqualError(t, err, "unable to find the AM deployment in https://am.example.com/login, use the IdP initiated SSO URL")
+}
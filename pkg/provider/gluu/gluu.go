@@ -0,0 +1,171 @@
+package gluu
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+
+	// the JSF forms of oxAuth and Janssen Auth prefix the input names with the id of the form
+	usernameFilter = "input[name$=\":username\"], input[name=\"username\"]"
+	passwordFilter = "input[name$=\":password\"], input[name=\"password\"]"
+
+	loginFormFilter = "form:has(input[name$=\":password\"]), form:has(input[name=\"password\"])"
+
+	// otpFilter the code input of the Casa OTP and SMS steps
+	otpFilter     = "input[name$=\"otpCode\"], input[name$=\":passcode\"], input[name=\"passcode\"]"
+	otpFormFilter = "form:has(input[name$=\"otpCode\"]), form:has(input[name$=\":passcode\"]), form:has(input[name=\"passcode\"])"
+
+	// consentFilter the attribute release page of the Shibboleth IdP bundled with Gluu Server
+	consentFilter = "form:has(input[name=\"_eventId_proceed\"])"
+)
+
+var logger = logrus.WithField("provider", "gluu")
+
+// Client wrapper around Gluu Server and Janssen Auth Server
+type Client struct {
+	client *provider.HTTPClient
+}
+
+// New create a new Gluu Server client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+	}, nil
+}
+
+// Authenticate logs into Gluu Server or Janssen Auth Server, going through the Casa second factor when it is
+// enrolled, and returns a SAML response
+func (gc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := gc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	passwordSubmitted := false
+	otpSubmitted := false
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		switch {
+		case doc.Find(otpFilter).Size() > 0:
+			// a rejected code shows the same step again
+			if otpSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid verification code"))
+			}
+			otpSubmitted = true
+			res, err = gc.submitOTP(doc, loginDetails)
+		case doc.Find(passwordFilter).Size() > 0:
+			if passwordSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid username or password"))
+			}
+			passwordSubmitted = true
+			res, err = gc.submitLogin(doc, loginDetails)
+		case doc.Find(consentFilter).Size() > 0:
+			res, err = gc.submitConsent(doc)
+		case doc.Find("form[method=\"post\"], form[method=\"POST\"]").Size() > 0:
+			res, err = page.SubmitForm(gc.client, doc, "form[method=\"post\"], form[method=\"POST\"]", nil)
+		default:
+			return "", fmt.Errorf("unexpected page returned by Gluu Server: %s", doc.Url.String())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("Gluu Server login did not complete after %d steps", page.MaxSteps)
+}
+
+func (gc *Client) submitLogin(doc *goquery.Document, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	return page.SubmitForm(gc.client, doc, loginFormFilter, func(form *page.Form, selection *goquery.Selection) {
+		setInput(form, selection, usernameFilter, loginDetails.Username)
+		setInput(form, selection, passwordFilter, loginDetails.Password)
+		keepSubmit(form, selection, "")
+	})
+}
+
+// submitOTP enter the code of the Casa OTP or SMS step, taken from --mfa-token when it is given
+func (gc *Client) submitOTP(doc *goquery.Document, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	code := loginDetails.MFAToken
+	if code == "" {
+		code = prompter.RequestSecurityCode("000000")
+	}
+
+	return page.SubmitForm(gc.client, doc, otpFormFilter, func(form *page.Form, selection *goquery.Selection) {
+		setInput(form, selection, otpFilter, code)
+		keepSubmit(form, selection, "")
+	})
+}
+
+// submitConsent release the attributes Alibaba Cloud needs to map the user to a role
+func (gc *Client) submitConsent(doc *goquery.Document) (*http.Response, error) {
+	logger.Debug("approving attribute release")
+
+	return page.SubmitForm(gc.client, doc, consentFilter, func(form *page.Form, selection *goquery.Selection) {
+		keepSubmit(form, selection, "_eventId_proceed")
+	})
+}
+
+// setInput set the value of the first input of the form matching filter
+func setInput(form *page.Form, selection *goquery.Selection, filter, value string) {
+	if name, ok := selection.Find(filter).First().Attr("name"); ok {
+		form.Values.Set(name, value)
+	}
+}
+
+// keepSubmit drop the values of all the submit buttons but the one named, or the first one when no name is given,
+// JSF and the Shibboleth IdP tell which button was pressed from the values they receive
+func keepSubmit(form *page.Form, selection *goquery.Selection, name string) {
+	selection.Find("input[type=\"submit\"], button[type=\"submit\"]").Each(func(i int, s *goquery.Selection) {
+		n, ok := s.Attr("name")
+		if !ok {
+			return
+		}
+		if name == "" {
+			name = n
+		}
+		if n == name {
+			if form.Values.Get(n) == "" {
+				form.Values.Set(n, s.AttrOr("value", "submit"))
+			}
+			return
+		}
+		form.Values.Del(n)
+	})
+}
+
+func loginError(doc *goquery.Document, fallback string) string {
+	msg := strings.TrimSpace(doc.Find(".alert-danger, .ui-messages-error, #messages li, .output--error").First().Text())
+	if msg == "" {
+		msg = fallback
+	}
+	return msg
+}
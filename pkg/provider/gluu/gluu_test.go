@@ -0,0 +1,137 @@
+package gluu
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+	otpPage, err := ioutil.ReadFile("example/otp.html")
+	require.Nil(t, err)
+	consentPage, err := ioutil.ReadFile("example/consent.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch {
+		case r.URL.Path == "/idp/profile/SAML2/Unsolicited/SSO" && r.Method == "GET" && r.URL.Query().Get("execution") == "":
+			http.Redirect(w, r, "/oxauth/authorize.htm?scope=openid", http.StatusFound)
+		case r.URL.Path == "/oxauth/authorize.htm":
+			http.Redirect(w, r, "/oxauth/login.htm", http.StatusFound)
+		case r.URL.Path == "/oxauth/login.htm" && r.Method == "GET":
+			w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), nil, 1))
+		case r.URL.Path == "/oxauth/login.htm":
+			require.Equal(t, "user", r.PostForm.Get("loginForm:username"))
+			require.Equal(t, "secret", r.PostForm.Get("loginForm:password"))
+			require.Equal(t, "Login", r.PostForm.Get("loginForm:loginButton"))
+			require.Equal(t, "view-state", r.PostForm.Get("javax.faces.ViewState"))
+			http.Redirect(w, r, "/oxauth/casa/otp.htm", http.StatusFound)
+		case r.URL.Path == "/oxauth/casa/otp.htm":
+			w.Write(bytes.Replace(otpPage, []byte("{{ERROR}}"), nil, 1))
+		case r.URL.Path == "/oxauth/postlogin.htm":
+			require.Equal(t, "Login", r.PostForm.Get("OtpLoginForm:submit"))
+			require.Empty(t, r.PostForm.Get("OtpLoginForm:alternative"))
+			require.Equal(t, "123456", r.PostForm.Get("OtpLoginForm:otpCode"))
+			http.Redirect(w, r, "/idp/profile/SAML2/Unsolicited/SSO?execution=e1s2", http.StatusFound)
+		case r.URL.Path == "/idp/profile/SAML2/Unsolicited/SSO" && r.Method == "GET":
+			w.Write(consentPage)
+		case r.URL.Path == "/idp/profile/SAML2/Unsolicited/SSO":
+			require.Equal(t, "Accept", r.PostForm.Get("_eventId_proceed"))
+			require.Empty(t, r.PostForm.Get("_eventId_AttributeReleaseRejected"))
+			require.Equal(t, "csrf-token", r.PostForm.Get("csrf_token"))
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/idp/profile/SAML2/Unsolicited/SSO?providerId=urn:alibaba:cloudcomputing",
+		Username: "user",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/idp/profile/SAML2/Unsolicited/SSO":
+			http.Redirect(w, r, "/oxauth/login.htm", http.StatusFound)
+		case r.URL.Path == "/oxauth/login.htm" && r.Method == "GET":
+			w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), nil, 1))
+		case r.URL.Path == "/oxauth/login.htm":
+			w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), []byte(`<div class="alert alert-danger">Failed to authenticate.</div>`), 1))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/idp/profile/SAML2/Unsolicited/SSO?providerId=urn:alibaba:cloudcomputing",
+		Username: "user",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "login failed: Failed to authenticate.")
+}
+
+func TestAuthenticateBadCode(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+	otpPage, err := ioutil.ReadFile("example/otp.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/idp/profile/SAML2/Unsolicited/SSO":
+			http.Redirect(w, r, "/oxauth/login.htm", http.StatusFound)
+		case r.URL.Path == "/oxauth/login.htm" && r.Method == "GET":
+			w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), nil, 1))
+		case r.URL.Path == "/oxauth/login.htm":
+			http.Redirect(w, r, "/oxauth/casa/otp.htm", http.StatusFound)
+		case r.URL.Path == "/oxauth/casa/otp.htm":
+			w.Write(bytes.Replace(otpPage, []byte("{{ERROR}}"), nil, 1))
+		case r.URL.Path == "/oxauth/postlogin.htm":
+			w.Write(bytes.Replace(otpPage, []byte("{{ERROR}}"), []byte(`<div class="alert alert-danger">Wrong code entered</div>`), 1))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/idp/profile/SAML2/Unsolicited/SSO?providerId=urn:alibaba:cloudcomputing",
+		Username: "user",
+		Password: "secret",
+		MFAToken: "000000",
+	})
+	require.EqualError(t, err, "login failed: Wrong code entered")
+}
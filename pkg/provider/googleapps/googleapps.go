@@ -15,6 +15,7 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
 	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/pkg/errors"
@@ -25,13 +26,14 @@ var logger = logrus.WithField("provider", "googleapps")
 
 // Client wrapper around Google Apps.
 type Client struct {
-	client *provider.HTTPClient
+	client        *provider.HTTPClient
+	authenticator *webauthn.Authenticator
 }
 
 // New create a new Google Apps Client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewAccountTransport(idpAccount)
 
 	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
@@ -39,7 +41,8 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 	}
 
 	return &Client{
-		client: client,
+		client:        client,
+		authenticator: webauthn.New(),
 	}, nil
 }
 
@@ -388,14 +391,30 @@ func (kc *Client) loadChallengePage(submitURL string, referer string, authForm u
 
 			return kc.loadResponsePage(secondActionURL, submitURL, responseForm)
 
-		case strings.Contains(secondActionURL, "challenge/sk/"): // handle u2f challenge
+		case strings.Contains(secondActionURL, "challenge/sk/"): // handle security key challenge, WebAuthn or u2f
 			facetComponents, err := url.Parse(secondActionURL)
 			if err != nil {
 				return nil, errors.Wrap(err, "unable to parse action URL for U2F challenge")
 			}
 			facet := facetComponents.Scheme + "://" + facetComponents.Host
 			challengeNonce := responseForm.Get("id-challenge")
+
+			if isWebAuthnChallenge(doc) {
+				response, err := kc.challengeSecurityKey(doc, challengeNonce, facet)
+				if err != nil {
+					return nil, errors.Wrap(err, "Second factor failed.")
+				}
+
+				responseForm.Set("id-assertion", response)
+				responseForm.Set("TrustDevice", "on")
+
+				return kc.loadResponsePage(secondActionURL, submitURL, responseForm)
+			}
+
 			appID, data := extractKeyHandles(doc, challengeNonce)
+			if len(data) == 0 {
+				return kc.skipChallengePage(doc, submitURL, secondActionURL, loginDetails)
+			}
 			u2fClient, err := NewU2FClient(challengeNonce, appID, facet, data[0], &U2FDeviceFinder{})
 			if err != nil {
 				return nil, errors.Wrap(err, "Failed to prompt for second factor.")
@@ -0,0 +1,92 @@
+package googleapps
+
+import (
+	b64 "encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
+	"github.com/pkg/errors"
+)
+
+// securityKeyRPID the relying party of the security keys registered with WebAuthn, those registered with U2F before
+// are scoped to the appid the page gives
+const securityKeyRPID = "google.com"
+
+// securityKeyAssertion the assertion as the challenge/sk page posts it in id-assertion, base64url encoded
+type securityKeyAssertion struct {
+	ID       string              `json:"id"`
+	Type     string              `json:"type"`
+	Response securityKeyResponse `json:"response"`
+}
+
+type securityKeyResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+}
+
+// isWebAuthnChallenge whether the security key page asks for a WebAuthn assertion, naming its relying party, as it
+// does for the accounts enforcing security keys, rather than for a U2F signature
+func isWebAuthnChallenge(doc *goquery.Document) bool {
+	challengeUI, _ := doc.Find("div[jsname=C0oDBd]").Attr("data-challenge-ui")
+	return strings.Contains(challengeUI, `"`+securityKeyRPID+`"`)
+}
+
+// challengeSecurityKey sign the challenge of the security key page, with the credentials registered with WebAuthn
+// first then with those registered with U2F, and return the assertion to post
+func (kc *Client) challengeSecurityKey(doc *goquery.Document, challengeNonce, facet string) (string, error) {
+	appID, keyHandles := extractKeyHandles(doc, challengeNonce)
+	if len(keyHandles) == 0 {
+		return "", errors.New("Google did not send the security keys of the account")
+	}
+
+	challenge, err := b64.StdEncoding.DecodeString(challengeNonce)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid security key challenge")
+	}
+
+	rpIDs := []string{securityKeyRPID}
+	if appID != "" {
+		rpIDs = append(rpIDs, appID)
+	}
+
+	var assertion *webauthn.Assertion
+	for i, rpID := range rpIDs {
+		assertion, err = kc.authenticator.Assert(&webauthn.Request{
+			RPID:          rpID,
+			Origin:        facet,
+			Challenge:     b64.RawURLEncoding.EncodeToString(challenge),
+			CredentialIDs: keyHandles,
+		})
+		if _, ok := err.(*webauthn.NotRegisteredError); ok && i < len(rpIDs)-1 {
+			logger.WithField("rpID", rpID).Debug("no security key registered, trying the next relying party")
+			continue
+		}
+		if err != nil {
+			return "", errors.Wrap(err, "error signing in with the security key")
+		}
+		break
+	}
+
+	credentialID, err := b64.StdEncoding.DecodeString(assertion.CredentialID)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid security key credential %s", assertion.CredentialID)
+	}
+
+	response, err := json.Marshal(securityKeyAssertion{
+		ID:   b64.RawURLEncoding.EncodeToString(credentialID),
+		Type: "public-key",
+		Response: securityKeyResponse{
+			ClientDataJSON:    b64.RawURLEncoding.EncodeToString(assertion.ClientDataJSON),
+			AuthenticatorData: b64.RawURLEncoding.EncodeToString(assertion.AuthenticatorData),
+			Signature:         b64.RawURLEncoding.EncodeToString(assertion.Signature),
+		},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding security key assertion")
+	}
+
+	return string(response), nil
+}
@@ -0,0 +1,106 @@
+package googleapps
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	u2fhost "github.com/marshallbrekka/go-u2fhost"
+	"github.com/stretchr/testify/require"
+)
+
+type mockFinder struct {
+	device u2fhost.Device
+}
+
+func (m *mockFinder) FindDevices() ([]u2fhost.Device, error) {
+	return []u2fhost.Device{m.device}, nil
+}
+
+func TestIsWebAuthnChallenge(t *testing.T) {
+	data, err := ioutil.ReadFile("example/challenge-sk.html")
+	require.Nil(t, err)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+	require.True(t, isWebAuthnChallenge(doc))
+
+	data, err = ioutil.ReadFile("example/challenge-totp.html")
+	require.Nil(t, err)
+	doc, err = goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+	require.False(t, isWebAuthnChallenge(doc))
+}
+
+func TestChallengePageSecurityKey(t *testing.T) {
+	data, err := ioutil.ReadFile("example/challenge-sk.html")
+	require.Nil(t, err)
+
+	var assertion securityKeyAssertion
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+		if r.URL.Path != "/signin/challenge/sk/5" {
+			w.Write(data)
+			return
+		}
+		require.Equal(t, "on", r.PostForm.Get("TrustDevice"))
+		require.Nil(t, json.Unmarshal([]byte(r.PostForm.Get("id-assertion")), &assertion))
+		w.Write([]byte(`<html><body>signed in</body></html>`))
+	}))
+	defer ts.Close()
+
+	device := &mocks.U2FDevice{}
+	for _, keyHandle := range []string{"a2V5LTI", "a2V5LTE"} {
+		device.On("Authenticate", &u2fhost.AuthenticateRequest{
+			Challenge: "Y2hhbGxlbmdl",
+			AppId:     securityKeyRPID,
+			Facet:     ts.URL,
+			KeyHandle: keyHandle,
+			WebAuthn:  true,
+		}).Return(nil, &u2fhost.BadKeyHandleError{})
+	}
+	device.On("Authenticate", &u2fhost.AuthenticateRequest{
+		Challenge: "Y2hhbGxlbmdl",
+		AppId:     "https://www.gstatic.com/securitykey/origins.json",
+		Facet:     ts.URL,
+		KeyHandle: "a2V5LTI",
+		WebAuthn:  true,
+	}).Return(nil, &u2fhost.BadKeyHandleError{})
+	device.On("Authenticate", &u2fhost.AuthenticateRequest{
+		Challenge: "Y2hhbGxlbmdl",
+		AppId:     "https://www.gstatic.com/securitykey/origins.json",
+		Facet:     ts.URL,
+		KeyHandle: "a2V5LTE",
+		WebAuthn:  true,
+	}).Return(&u2fhost.AuthenticateResponse{
+		KeyHandle:         "a2V5LTE",
+		ClientData:        b64.RawURLEncoding.EncodeToString([]byte(`{"type":"webauthn.get"}`)),
+		AuthenticatorData: b64.StdEncoding.EncodeToString([]byte("authenticator data")),
+		SignatureData:     b64.StdEncoding.EncodeToString([]byte("signature")),
+	}, nil)
+	device.On("Close").Return()
+
+	opts := &provider.HTTPClientOptions{IsWithRetries: false}
+	kc := Client{
+		client:        &provider.HTTPClient{Client: http.Client{}, Options: opts},
+		authenticator: webauthn.NewWithFinder(&mockFinder{device}),
+	}
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "test", Password: "test123"}
+
+	doc, err := kc.loadChallengePage(ts.URL+"/signin/challenge/sl/password", "https://accounts.google.com/", url.Values{}, loginDetails)
+	require.Nil(t, err)
+	require.Equal(t, "signed in", doc.Find("body").Text())
+
+	require.Equal(t, "a2V5LTE", assertion.ID)
+	require.Equal(t, "public-key", assertion.Type)
+	require.Equal(t, b64.RawURLEncoding.EncodeToString([]byte("signature")), assertion.Response.Signature)
+}
@@ -0,0 +1,132 @@
+package hennge
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	usernameFormFilter = "form:has(input[name=\"username\"])"
+	passwordFormFilter = "form:has(input[name=\"password\"])"
+	otpFormFilter      = "form:has(input[name=\"otp\"])"
+	deviceErrorFilter  = "#device-certificate-error"
+)
+
+var logger = logrus.WithField("provider", "hennge")
+
+// Client wrapper around HENNGE One
+type Client struct {
+	client     *provider.HTTPClient
+	clientCert bool
+}
+
+// New create a new HENNGE One client, the device certificate of the account is presented to HENNGE when set
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr, err := provider.NewClientCertTransport(idpAccount)
+	if err != nil {
+		return nil, errors.Wrap(err, "error configuring the device certificate")
+	}
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client:     client,
+		clientCert: idpAccount.ClientCert != "",
+	}, nil
+}
+
+// Authenticate logs into HENNGE One with the username and password, then the one-time password HENNGE mails when
+// the access policy asks for it, and returns the SAML response of the Alibaba Cloud service
+func (hc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := hc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	usernameSubmitted := false
+	passwordSubmitted := false
+	otpSubmitted := false
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		switch {
+		case doc.Find(deviceErrorFilter).Size() > 0:
+			if !hc.clientCert {
+				return "", errors.New("HENNGE One requires a device certificate for this service, set client_cert and client_key to the certificate issued for the device")
+			}
+			return "", fmt.Errorf("HENNGE One refused the device certificate: %s", loginError(doc, deviceErrorFilter))
+		case doc.Find(passwordFormFilter).Size() > 0:
+			if passwordSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, ".error-message"))
+			}
+			passwordSubmitted = true
+			// the username is asked on the same page unless HENNGE remembered it
+			withUsername := doc.Find(passwordFormFilter+" input[name=\"username\"]").Size() > 0
+			res, err = page.SubmitForm(hc.client, doc, passwordFormFilter, func(form *page.Form, _ *goquery.Selection) {
+				if withUsername {
+					form.Values.Set("username", loginDetails.Username)
+				}
+				form.Values.Set("password", loginDetails.Password)
+			})
+		case doc.Find(usernameFormFilter).Size() > 0:
+			if usernameSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, ".error-message"))
+			}
+			usernameSubmitted = true
+			res, err = page.SubmitForm(hc.client, doc, usernameFormFilter, func(form *page.Form, _ *goquery.Selection) {
+				form.Values.Set("username", loginDetails.Username)
+			})
+		case doc.Find(otpFormFilter).Size() > 0:
+			if otpSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, ".error-message"))
+			}
+			otpSubmitted = true
+			otp := loginDetails.MFAToken
+			if otp == "" {
+				log.Println("HENNGE One sent a one-time password to your email address")
+				otp = prompter.RequestSecurityCode("000000")
+			}
+			res, err = page.SubmitForm(hc.client, doc, otpFormFilter, func(form *page.Form, _ *goquery.Selection) {
+				form.Values.Set("otp", strings.TrimSpace(otp))
+			})
+		default:
+			return "", fmt.Errorf("unexpected page returned by HENNGE One: %s", doc.Url.String())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("HENNGE One login did not complete after %d steps", page.MaxSteps)
+}
+
+func loginError(doc *goquery.Document, filter string) string {
+	msg := strings.Join(strings.Fields(doc.Find(filter).First().Text()), " ")
+	if msg == "" {
+		msg = "HENNGE One returned the page again"
+	}
+	return msg
+}
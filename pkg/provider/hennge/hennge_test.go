@@ -0,0 +1,156 @@
+package hennge
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+	otpPage, err := ioutil.ReadFile("example/otp.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	var calls []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+		calls = append(calls, r.Method+" "+r.URL.Path)
+
+		switch r.URL.Path {
+		case "/portal/example.co.jp/services/alibabacloud/":
+			http.Redirect(w, r, "/portal/example.co.jp/login", http.StatusFound)
+		case "/portal/example.co.jp/login":
+			if r.Method == "GET" {
+				w.Write(loginPage)
+				return
+			}
+			require.Equal(t, "Zm9vYmFyLWNzcmYtdG9rZW4", r.PostForm.Get("csrf_token"))
+			require.Equal(t, "taro@example.co.jp", r.PostForm.Get("username"))
+			require.Equal(t, "secret", r.PostForm.Get("password"))
+			w.Write(otpPage)
+		case "/portal/example.co.jp/otp":
+			require.Equal(t, "123456", r.PostForm.Get("otp"))
+			w.Write(assertionPage)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("RequestSecurityCode", "000000").Return("123456").Once()
+
+	client, err := New(cfg.NewIDPAccount())
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL + "/portal/example.co.jp/services/alibabacloud/", Username: "taro@example.co.jp", Password: "secret"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.Equal(t, []string{
+		"GET /portal/example.co.jp/services/alibabacloud/",
+		"GET /portal/example.co.jp/login",
+		"POST /portal/example.co.jp/login",
+		"POST /portal/example.co.jp/otp",
+	}, calls)
+	pr.Mock.AssertExpectations(t)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/portal/example.co.jp/services/alibabacloud/":
+			http.Redirect(w, r, "/portal/example.co.jp/login", http.StatusFound)
+		case "/portal/example.co.jp/login":
+			if r.Method == "GET" {
+				w.Write(loginPage)
+				return
+			}
+			w.Write(bytes.Replace(loginPage, []byte("<!-- LOGIN ERROR -->"), []byte(`<div class="error-message">ユーザー名またはパスワードが正しくありません。</div>`), 1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(cfg.NewIDPAccount())
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + "/portal/example.co.jp/services/alibabacloud/", Username: "taro@example.co.jp", Password: "wrong"})
+	require.EqualError(t, err, "login failed: ユーザー名またはパスワードが正しくありません。")
+}
+
+func TestAuthenticateBadOTP(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+	otpPage, err := ioutil.ReadFile("example/otp.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/portal/example.co.jp/services/alibabacloud/":
+			http.Redirect(w, r, "/portal/example.co.jp/login", http.StatusFound)
+		case "/portal/example.co.jp/login":
+			if r.Method == "GET" {
+				w.Write(loginPage)
+				return
+			}
+			w.Write(otpPage)
+		case "/portal/example.co.jp/otp":
+			w.Write(bytes.Replace(otpPage, []byte("<!-- LOGIN ERROR -->"), []byte(`<div class="error-message">ワンタイムパスワードが正しくありません。</div>`), 1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(cfg.NewIDPAccount())
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + "/portal/example.co.jp/services/alibabacloud/", Username: "taro@example.co.jp", Password: "secret", MFAToken: "000000"})
+	require.EqualError(t, err, "login failed: ワンタイムパスワードが正しくありません。")
+}
+
+func TestAuthenticateDeviceCertificate(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+	devicePage, err := ioutil.ReadFile("example/device.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/portal/example.co.jp/services/alibabacloud/":
+			http.Redirect(w, r, "/portal/example.co.jp/login", http.StatusFound)
+		case "/portal/example.co.jp/login":
+			if r.Method == "GET" {
+				w.Write(loginPage)
+				return
+			}
+			w.Write(devicePage)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(cfg.NewIDPAccount())
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + "/portal/example.co.jp/services/alibabacloud/", Username: "taro@example.co.jp", Password: "secret"})
+	require.EqualError(t, err, "HENNGE One requires a device certificate for this service, set client_cert and client_key to the certificate issued for the device")
+}
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log"
@@ -8,11 +9,13 @@ import (
 	"net/http"
 	"runtime"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/cookiejar"
 	"github.com/aliyun/saml2alibabacloud/pkg/dump"
+	"github.com/aliyun/saml2alibabacloud/pkg/fingerprint"
 	"github.com/avast/retry-go"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -24,17 +27,42 @@ type HTTPClient struct {
 	http.Client
 	CheckResponseStatus func(*http.Request, *http.Response) error
 	Options             *HTTPClientOptions
+
+	mu sync.Mutex
+	// authentication the last authentication the client took part in, see StartAuthentication
+	authentication *Authentication
 }
 
 const (
 	DefaultAttemptsCount = 1
 	DefaultRetryDelay    = time.Duration(1) * time.Second
+
+	// ClientVersion the version reported to IdPs and STS
+	ClientVersion = "0.0.5"
+
+	// ClientVersionHeader sent with every request so IdP admins can allowlist the tool regardless of the user agent,
+	// except with a client fingerprint, which an upgrade would otherwise change
+	ClientVersionHeader = "X-Saml2alibabacloud-Version"
 )
 
+// DefaultUserAgent the user agent sent to IdPs unless the account overrides it
+var DefaultUserAgent = fmt.Sprintf("saml2alibabacloud/%s (%s %s)", ClientVersion, runtime.GOOS, runtime.GOARCH)
+
 type HTTPClientOptions struct {
 	IsWithRetries bool //http retry feature switch
 	AttemptsCount uint
 	RetryDelay    time.Duration
+	UserAgent     string // overrides DefaultUserAgent
+
+	MaintenanceWindow time.Duration // how long to wait for an IdP in maintenance, 0 uses the default, negative disables
+	RateLimitWindow   time.Duration // how long to wait for an IdP throttling the requests, 0 uses the default, negative disables
+	CloudflareAccess  string        // how to login to Cloudflare Access in front of the IdP, auto by default
+	Username          string        // the email the Cloudflare Access one-time PIN is sent to
+
+	Fingerprint *fingerprint.Fingerprint // headers and TLS parameters kept the same across runs, headers are sent unless the provider sets them
+
+	// account the client is built for, its requests follow the deadline of the authentication in progress
+	account *cfg.IDPAccount
 }
 
 // NewDefaultTransport configure a transport with the TLS skip verify option
@@ -71,6 +99,21 @@ func BuildHttpClientOpts(account *cfg.IDPAccount) *HTTPClientOptions {
 		opts.RetryDelay = time.Duration(delay) * time.Second
 	}
 
+	opts.UserAgent = account.UserAgent
+	opts.Fingerprint = accountFingerprint(account)
+
+	if account.MaintenanceWindow != 0 {
+		opts.MaintenanceWindow = time.Duration(account.MaintenanceWindow) * time.Second
+	}
+
+	if account.RateLimitWindow != 0 {
+		opts.RateLimitWindow = time.Duration(account.RateLimitWindow) * time.Second
+	}
+
+	opts.CloudflareAccess = account.CloudflareAccess
+	opts.Username = account.Username
+	opts.account = account
+
 	return opts
 }
 
@@ -86,25 +129,57 @@ func NewHTTPClient(tr http.RoundTripper, opts *HTTPClientOptions) (*HTTPClient,
 		return nil, err
 	}
 
+	if opts != nil && opts.Fingerprint != nil {
+		tr = withFingerprintTLS(tr, opts.Fingerprint)
+	}
+
+	if WrapTransport != nil {
+		tr = WrapTransport(tr)
+	}
+
 	client := http.Client{Transport: tr, Jar: jar}
 
-	return &HTTPClient{client, nil, opts}, nil
+	return &HTTPClient{Client: client, Options: opts}, nil
 }
 
 // Do do the request
 func (hc *HTTPClient) Do(req *http.Request) (*http.Response, error) {
 
-	req.Header.Set("User-Agent", fmt.Sprintf("saml2alibabacloud/0.0.5 (%s %s)", runtime.GOOS, runtime.GOARCH))
+	userAgent := DefaultUserAgent
+	if hc.Options != nil && hc.Options.Fingerprint != nil {
+		hc.Options.Fingerprint.Apply(req)
+		if hc.Options.Fingerprint.UserAgent != "" {
+			userAgent = hc.Options.Fingerprint.UserAgent
+		}
+	}
+	if hc.Options != nil && hc.Options.UserAgent != "" {
+		userAgent = hc.Options.UserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if hc.Options == nil || hc.Options.Fingerprint == nil {
+		req.Header.Set(ClientVersionHeader, ClientVersion)
+	}
 
-	var resp *http.Response
-	var err error
+	if ctx := hc.context(); ctx != nil {
+		req = req.WithContext(ctx)
+	}
 
-	if hc.Options.IsWithRetries {
-		resp, err = hc.doWithRetry(req)
-	} else {
-		hc.logHTTPRequest(req)
-		resp, err = hc.Client.Do(req)
+	resp, err := hc.send(req)
+	if err != nil {
+		return resp, err
+	}
+
+	resp, err = hc.waitOutRateLimit(req, resp)
+	if err != nil {
+		return resp, err
+	}
+
+	resp, err = hc.waitOutMaintenance(req, resp)
+	if err != nil {
+		return resp, err
 	}
+
+	resp, err = hc.passCloudflareAccess(req, resp)
 	if err != nil {
 		return resp, err
 	}
@@ -122,6 +197,15 @@ func (hc *HTTPClient) Do(req *http.Request) (*http.Response, error) {
 	return resp, err
 }
 
+func (hc *HTTPClient) send(req *http.Request) (*http.Response, error) {
+	if hc.Options.IsWithRetries {
+		return hc.doWithRetry(req)
+	}
+
+	hc.logHTTPRequest(req)
+	return hc.Client.Do(req)
+}
+
 func (hc *HTTPClient) doWithRetry(req *http.Request) (*http.Response, error) {
 	var resp *http.Response
 	err := retry.Do(
@@ -148,6 +232,44 @@ func (hc *HTTPClient) doWithRetry(req *http.Request) (*http.Response, error) {
 
 }
 
+// context the context of the authentication the client takes part in, nil outside of any, the clients of an
+// authentication abandoned at its deadline keep its canceled context so the flow left behind stops
+func (hc *HTTPClient) context() context.Context {
+	var current *Authentication
+	if hc.Options != nil {
+		current = currentAuthentication(hc.Options.account)
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if hc.authentication != nil && hc.authentication.isAbandoned() {
+		return hc.authentication.ctx
+	}
+	hc.authentication = current
+	if current == nil {
+		return nil
+	}
+	return current.ctx
+}
+
+// Sleep wait between the polls of a flow, returning early with an error when the deadline of the authentication
+// passes
+func (hc *HTTPClient) Sleep(d time.Duration) error {
+	ctx := hc.context()
+	if ctx == nil {
+		time.Sleep(d)
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
 // DisableFollowRedirect disable redirects
 func (hc *HTTPClient) DisableFollowRedirect() {
 	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
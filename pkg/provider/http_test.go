@@ -1,10 +1,15 @@
 package provider
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/stretchr/testify/require"
 )
 
@@ -72,3 +77,111 @@ func TestClientDoResponseCheck(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, 400, res.StatusCode)
 }
+
+func TestClientUserAgent(t *testing.T) {
+	var userAgent, version string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		version = r.Header.Get(ClientVersionHeader)
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+
+	hc, err := NewHTTPClient(NewDefaultTransport(false), &HTTPClientOptions{})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	require.Nil(t, err)
+
+	_, err = hc.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, DefaultUserAgent, userAgent)
+	require.Equal(t, ClientVersion, version)
+
+	hc, err = NewHTTPClient(NewDefaultTransport(false), &HTTPClientOptions{UserAgent: "Mozilla/5.0 corp-build"})
+	require.Nil(t, err)
+
+	_, err = hc.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, "Mozilla/5.0 corp-build", userAgent)
+	require.Equal(t, ClientVersion, version)
+}
+
+func TestClientFingerprint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fingerprint")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(path string) { FingerprintsPath = path }(FingerprintsPath)
+	FingerprintsPath = filepath.Join(dir, "fingerprints.json")
+
+	var headers http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+
+	account := &cfg.IDPAccount{URL: ts.URL, Username: "user@example.com", ClientFingerprint: "persist"}
+
+	opts := BuildHttpClientOpts(account)
+	require.NotNil(t, opts.Fingerprint)
+	require.Equal(t, opts.Fingerprint.Created, BuildHttpClientOpts(account).Fingerprint.Created)
+
+	hc, err := NewHTTPClient(NewAccountTransport(account), opts)
+	require.Nil(t, err)
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	require.Nil(t, err)
+
+	_, err = hc.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, DefaultUserAgent, headers.Get("User-Agent"))
+	require.Equal(t, opts.Fingerprint.AcceptLanguage, headers.Get("Accept-Language"))
+	require.NotEmpty(t, headers.Get("Accept"))
+	require.Empty(t, headers.Get(ClientVersionHeader))
+
+	tr := hc.Client.Transport.(*http.Transport)
+	require.Equal(t, opts.Fingerprint.CurvePreferences, tr.TLSClientConfig.CurvePreferences)
+	require.Nil(t, NewAccountTransport(account).(*http.Transport).TLSClientConfig.CurvePreferences)
+
+	// without client_fingerprint the headers are left alone
+	account.ClientFingerprint = ""
+	require.Nil(t, BuildHttpClientOpts(account).Fingerprint)
+}
+
+func TestClientAuthenticationDeadline(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+
+	account := &cfg.IDPAccount{URL: ts.URL}
+	hc, err := NewHTTPClient(NewDefaultTransport(false), BuildHttpClientOpts(account))
+	require.Nil(t, err)
+
+	authentication := StartAuthentication(time.Minute, account)
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	require.Nil(t, err)
+	_, err = hc.Do(req)
+	require.Nil(t, err)
+
+	// the flow left behind by an abandoned authentication can't send or wait any more
+	authentication.Abandon()
+
+	req, err = http.NewRequest("GET", ts.URL, nil)
+	require.Nil(t, err)
+	_, err = hc.Do(req)
+	require.Error(t, err)
+	require.Error(t, hc.Sleep(time.Minute))
+
+	// a client outside of any authentication isn't bound to a deadline
+	other, err := NewHTTPClient(NewDefaultTransport(false), BuildHttpClientOpts(account))
+	require.Nil(t, err)
+	req, err = http.NewRequest("GET", ts.URL, nil)
+	require.Nil(t, err)
+	_, err = other.Do(req)
+	require.Nil(t, err)
+	require.Nil(t, other.Sleep(time.Millisecond))
+}
@@ -0,0 +1,220 @@
+package idaas
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// the states of the authentication returned by the IDaaS login API
+const (
+	statusSuccess     = "SUCCESS"
+	statusMfaRequired = "MFA_REQUIRED"
+	statusFailed      = "FAILED"
+)
+
+// the IDaaS names of the second factors
+const (
+	factorSMS  = "sms"
+	factorTOTP = "totp"
+)
+
+var logger = logrus.WithField("provider", "idaas")
+
+// Client wrapper around Alibaba Cloud IDaaS
+type Client struct {
+	client *provider.HTTPClient
+	mfa    string
+}
+
+// New create a new Alibaba Cloud IDaaS client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		mfa:    idpAccount.MFA,
+	}, nil
+}
+
+// Authenticate logs into the IDaaS instance through its login API, completing the SMS or OTP app second factor when
+// the instance asks for one, and returns the SAML response of the Alibaba Cloud application
+func (ic *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := ic.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	// an existing session goes straight to the assertion
+	if samlAssertion, err := extractSAMLResponse(res); err != nil || samlAssertion != "" {
+		return samlAssertion, err
+	}
+
+	loginURL := res.Request.URL
+	state := loginURL.Query().Get("state")
+	if state == "" {
+		return "", fmt.Errorf("unable to find the login state in %s, use the SSO URL of the Alibaba Cloud application", loginURL.String())
+	}
+
+	base := fmt.Sprintf("%s://%s", loginURL.Scheme, loginURL.Host)
+
+	resp, err := ic.call(base+"/api/v2/authn/password", map[string]string{
+		"state":    state,
+		"username": loginDetails.Username,
+		"password": loginDetails.Password,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error logging in")
+	}
+
+	if gjson.Get(resp, "status").String() == statusMfaRequired {
+		resp, err = ic.verifyMfa(base, resp, loginDetails)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if status := gjson.Get(resp, "status").String(); status != statusSuccess {
+		return "", fmt.Errorf("unexpected IDaaS authentication status: %s", status)
+	}
+
+	redirectURL, err := loginURL.Parse(gjson.Get(resp, "redirectUrl").String())
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing redirect URL")
+	}
+
+	res, err = ic.client.Get(redirectURL.String())
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving SAML response")
+	}
+
+	samlAssertion, err := extractSAMLResponse(res)
+	if err != nil {
+		return "", err
+	}
+	if samlAssertion == "" {
+		return "", errors.New("no SAML response returned by IDaaS, check the user is authorized to use the Alibaba Cloud application")
+	}
+
+	return samlAssertion, nil
+}
+
+// verifyMfa complete the second factor, Auto uses the first the instance offers the user
+func (ic *Client) verifyMfa(base, resp string, loginDetails *creds.LoginDetails) (string, error) {
+	state := gjson.Get(resp, "state").String()
+
+	factor, ok := ic.selectFactor(gjson.Get(resp, "factors").Array())
+	if !ok {
+		return "", fmt.Errorf("no supported IDaaS MFA factor for MFA type %s, enroll an SMS or OTP app factor", ic.mfa)
+	}
+
+	factorType := factor.Get("type").String()
+
+	logger.WithField("factor", factorType).Debug("verifying second factor")
+
+	if factorType == factorSMS {
+		_, err := ic.call(base+"/api/v2/authn/mfa/sms/send", map[string]string{"state": state})
+		if err != nil {
+			return "", errors.Wrap(err, "error sending SMS code")
+		}
+		log.Printf("IDaaS has texted a verification code to %s", factor.Get("target").String())
+	}
+
+	code := loginDetails.MFAToken
+	if code == "" {
+		code = prompter.RequestSecurityCode("000000")
+	}
+
+	resp, err := ic.call(base+"/api/v2/authn/mfa/verify", map[string]string{
+		"state":  state,
+		"factor": factorType,
+		"code":   code,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error verifying MFA")
+	}
+
+	return resp, nil
+}
+
+func (ic *Client) selectFactor(factors []gjson.Result) (gjson.Result, bool) {
+	for _, factor := range factors {
+		factorType := factor.Get("type").String()
+		if factorType != factorSMS && factorType != factorTOTP {
+			continue
+		}
+		if strings.EqualFold(ic.mfa, "Auto") || strings.EqualFold(ic.mfa, factorType) {
+			return factor, true
+		}
+	}
+	return gjson.Result{}, false
+}
+
+func (ic *Client) call(location string, body interface{}) (string, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", location, bytes.NewReader(data))
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := ic.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body")
+	}
+
+	resp := string(resBody)
+
+	if gjson.Get(resp, "status").String() == statusFailed || res.StatusCode >= 400 {
+		msg := gjson.Get(resp, "errorMessage").String()
+		if msg == "" {
+			msg = res.Status
+		}
+		return "", fmt.Errorf("IDaaS returned an error: %s", msg)
+	}
+
+	return resp, nil
+}
+
+// extractSAMLResponse the SAML response posted to Alibaba Cloud by the page, empty when the page has none
+func extractSAMLResponse(res *http.Response) (string, error) {
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build document from response")
+	}
+
+	samlAssertion, _ := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
+
+	return samlAssertion, nil
+}
@@ -0,0 +1,190 @@
+package idaas
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+const ssoPath = "/login/app/app_mkv7rgt4d7i4u7zqtzev2mxxxx/saml2/sso"
+
+func TestAuthenticateSMS(t *testing.T) {
+	mfaResp, err := ioutil.ReadFile("example/mfa.json")
+	require.Nil(t, err)
+	successResp, err := ioutil.ReadFile("example/success.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	var calls []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+
+		body := map[string]string{}
+		if r.Method == "POST" {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		}
+
+		switch r.URL.Path {
+		case ssoPath:
+			if _, err := r.Cookie("session"); err == nil {
+				w.Write(assertionPage)
+				return
+			}
+			http.Redirect(w, r, "/login?state=login-state", http.StatusFound)
+		case "/login":
+			w.Write([]byte(`<html><body><div id="root"></div></body></html>`))
+		case "/api/v2/authn/password":
+			require.Equal(t, "login-state", body["state"])
+			require.Equal(t, "user", body["username"])
+			require.Equal(t, "secret", body["password"])
+			w.Write(mfaResp)
+		case "/api/v2/authn/mfa/sms/send":
+			require.Equal(t, "mfa-state", body["state"])
+			w.Write([]byte(`{"status":"MFA_REQUIRED","state":"mfa-state"}`))
+		case "/api/v2/authn/mfa/verify":
+			require.Equal(t, "mfa-state", body["state"])
+			require.Equal(t, "123456", body["code"])
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "session", Path: "/"})
+			w.Write(successResp)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + ssoPath,
+		Username: "user",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.Contains(t, calls, "/api/v2/authn/mfa/sms/send")
+}
+
+func TestAuthenticateTOTP(t *testing.T) {
+	mfaResp, err := ioutil.ReadFile("example/mfa.json")
+	require.Nil(t, err)
+	successResp, err := ioutil.ReadFile("example/success.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	var calls []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+
+		body := map[string]string{}
+		if r.Method == "POST" {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		}
+
+		switch r.URL.Path {
+		case ssoPath:
+			if _, err := r.Cookie("session"); err == nil {
+				w.Write(assertionPage)
+				return
+			}
+			http.Redirect(w, r, "/login?state=login-state", http.StatusFound)
+		case "/login":
+			w.Write([]byte(`<html><body><div id="root"></div></body></html>`))
+		case "/api/v2/authn/password":
+			require.Equal(t, "login-state", body["state"])
+			require.Equal(t, "user", body["username"])
+			require.Equal(t, "secret", body["password"])
+			w.Write(mfaResp)
+		case "/api/v2/authn/mfa/verify":
+			require.Equal(t, "mfa-state", body["state"])
+			require.Equal(t, "123456", body["code"])
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "session", Path: "/"})
+			w.Write(successResp)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "TOTP"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + ssoPath,
+		Username: "user",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.NotContains(t, calls, "/api/v2/authn/mfa/sms/send")
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ssoPath:
+			http.Redirect(w, r, "/login?state=login-state", http.StatusFound)
+		case "/login":
+			w.Write([]byte(`<html><body><div id="root"></div></body></html>`))
+		case "/api/v2/authn/password":
+			w.Write([]byte(`{"status":"FAILED","errorMessage":"Incorrect username or password"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "TOTP"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + ssoPath,
+		Username: "user",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "error logging in: IDaaS returned an error: Incorrect username or password")
+}
+
+func TestAuthenticateBadCode(t *testing.T) {
+	mfaResp, err := ioutil.ReadFile("example/mfa.json")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ssoPath:
+			http.Redirect(w, r, "/login?state=login-state", http.StatusFound)
+		case "/login":
+			w.Write([]byte(`<html><body><div id="root"></div></body></html>`))
+		case "/api/v2/authn/password":
+			w.Write(mfaResp)
+		case "/api/v2/authn/mfa/verify":
+			w.Write([]byte(`{"status":"FAILED","errorMessage":"Invalid verification code"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "TOTP"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + ssoPath,
+		Username: "user",
+		Password: "secret",
+		MFAToken: "000000",
+	})
+	require.EqualError(t, err, "error verifying MFA: IDaaS returned an error: Invalid verification code")
+}
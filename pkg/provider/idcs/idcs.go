@@ -0,0 +1,371 @@
+package idcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// maxPolls the number of times a push notification is polled before giving up
+	maxPolls = 60
+
+	tokenScope = "urn:opc:idm:__myscopes__"
+)
+
+// pollInterval delay between two polls of a pending push notification
+var pollInterval = 3 * time.Second
+
+var logger = logrus.WithField("provider", "idcs")
+
+// supportedFactors the IDCS authentication factors handled, named as in the MFA setting of the account
+var supportedFactors = map[string]bool{
+	"TOTP":       true,
+	"SMS":        true,
+	"EMAIL":      true,
+	"PUSH":       true,
+	"BYPASSCODE": true,
+}
+
+// Client wrapper around Oracle Identity Cloud Service
+type Client struct {
+	client *provider.HTTPClient
+	mfa    string
+	appID  string
+}
+
+// New create a new Oracle IDCS client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		mfa:    idpAccount.MFA,
+		appID:  idpAccount.AppID,
+	}, nil
+}
+
+// Authenticate logs into IDCS through the /sso/v1/sdk authentication API, then opens the SAML application and
+// returns a SAML response
+func (ic *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	u, err := url.Parse(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing IDCS URL")
+	}
+	tenantURL := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+
+	token, err := ic.accessToken(tenantURL, loginDetails)
+	if err != nil {
+		return "", err
+	}
+
+	authenticateURL := tenantURL + "/sso/v1/sdk/authenticate"
+	if ic.appID != "" {
+		authenticateURL += "?appName=" + url.QueryEscape(ic.appID)
+	}
+
+	resp, err := ic.call("GET", authenticateURL, token, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error starting authentication")
+	}
+
+	resp, err = ic.call("POST", tenantURL+"/sso/v1/sdk/authenticate", token, map[string]interface{}{
+		"op":         "credSubmit",
+		"authFactor": "USERNAME_PASSWORD",
+		"credentials": map[string]string{
+			"username": loginDetails.Username,
+			"password": loginDetails.Password,
+		},
+		"requestState": gjson.Get(resp, "requestState").String(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error submitting credentials")
+	}
+
+	if gjson.Get(resp, "authnToken").String() == "" {
+		resp, err = ic.verifyMFA(tenantURL+"/sso/v1/sdk/authenticate", token, resp, loginDetails)
+		if err != nil {
+			return "", errors.Wrap(err, "error verifying MFA")
+		}
+	}
+
+	authnToken := gjson.Get(resp, "authnToken").String()
+	if authnToken == "" {
+		return "", fmt.Errorf("IDCS did not return an authentication token, next operations: %s", gjson.Get(resp, "nextOp").Raw)
+	}
+
+	if err := ic.createSession(tenantURL+"/sso/v1/sdk/session", authnToken); err != nil {
+		return "", err
+	}
+
+	return ic.completeFlow(loginDetails.URL)
+}
+
+// accessToken retrieve a token for the authentication API with the client credentials of the sign-in app
+func (ic *Client) accessToken(tenantURL string, loginDetails *creds.LoginDetails) (string, error) {
+	if loginDetails.ClientID == "" || loginDetails.ClientSecret == "" {
+		return "", errors.New("IDCS provider requires the client id and client secret of the sign-in application")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("scope", tokenScope)
+
+	req, err := http.NewRequest("POST", tenantURL+"/oauth2/v1/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "error building token request")
+	}
+	req.SetBasicAuth(loginDetails.ClientID, loginDetails.ClientSecret)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Accept", "application/json")
+
+	res, err := ic.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving access token")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body")
+	}
+
+	token := gjson.GetBytes(body, "access_token").String()
+	if token == "" {
+		return "", fmt.Errorf("unable to retrieve access token: %s", gjson.GetBytes(body, "error_description").String())
+	}
+
+	return token, nil
+}
+
+// verifyMFA complete the factor selected through the MFA setting of the account, prompting when several are offered
+func (ic *Client) verifyMFA(location, token, resp string, loginDetails *creds.LoginDetails) (string, error) {
+	factor, err := ic.selectFactor(resp)
+	if err != nil {
+		return "", err
+	}
+
+	logger.WithField("factor", factor).Debug("verifying MFA")
+
+	requestState := gjson.Get(resp, "requestState").String()
+
+	// factors bound to a device are started by submitting the device first
+	credentials := map[string]string{}
+	if deviceID := gjson.Get(resp, factor+".enrolledDevices.0.deviceId").String(); deviceID != "" {
+		credentials["deviceId"] = deviceID
+	}
+
+	if factor == "SMS" || factor == "EMAIL" || factor == "PUSH" {
+		resp, err = ic.call("POST", location, token, map[string]interface{}{
+			"op":           "credSubmit",
+			"authFactor":   factor,
+			"credentials":  credentials,
+			"requestState": requestState,
+		})
+		if err != nil {
+			return "", err
+		}
+		requestState = gjson.Get(resp, "requestState").String()
+	}
+
+	if factor == "PUSH" {
+		return ic.pollPush(location, token, resp)
+	}
+
+	otpCode := loginDetails.MFAToken
+	if otpCode == "" {
+		otpCode = prompter.RequestSecurityCode("000000")
+	}
+
+	body := map[string]interface{}{
+		"op": "credSubmit",
+		"credentials": map[string]string{
+			"otpCode": otpCode,
+		},
+		"requestState": requestState,
+	}
+	if factor == "TOTP" || factor == "BYPASSCODE" {
+		body["authFactor"] = factor
+	}
+
+	return ic.call("POST", location, token, body)
+}
+
+// pollPush wait for the push notification to be approved in the Oracle Mobile Authenticator
+func (ic *Client) pollPush(location, token, resp string) (string, error) {
+	log.Println("Waiting for approval, please check your Oracle Mobile Authenticator ...")
+
+	var err error
+	for i := 0; i < maxPolls; i++ {
+		if gjson.Get(resp, "status").String() != "pending" {
+			return resp, nil
+		}
+
+		if err := ic.client.Sleep(pollInterval); err != nil {
+			return "", errors.Wrap(err, "error waiting for the push approval")
+		}
+
+		resp, err = ic.call("POST", location, token, map[string]interface{}{
+			"op":           "credSubmit",
+			"requestState": gjson.Get(resp, "requestState").String(),
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", errors.New("timed out waiting for the push notification to be approved")
+}
+
+func (ic *Client) selectFactor(resp string) (string, error) {
+	var offered []string
+	gjson.Get(resp, "nextAuthFactors").ForEach(func(_, value gjson.Result) bool {
+		if supportedFactors[value.String()] {
+			offered = append(offered, value.String())
+		}
+		return true
+	})
+	if len(offered) == 0 {
+		return "", fmt.Errorf("no supported MFA factor offered by IDCS: %s", gjson.Get(resp, "nextAuthFactors").Raw)
+	}
+
+	mfa := strings.ToUpper(ic.mfa)
+	if mfa != "" && mfa != "AUTO" {
+		for _, factor := range offered {
+			if factor == mfa {
+				return factor, nil
+			}
+		}
+		return "", fmt.Errorf("MFA %s isn't offered by IDCS, available factors: %s", ic.mfa, strings.Join(offered, ", "))
+	}
+
+	if len(offered) == 1 {
+		return offered[0], nil
+	}
+
+	return offered[prompter.Choose("Select which MFA option to use", offered)], nil
+}
+
+// createSession exchange the authentication token for an IDCS session cookie
+func (ic *Client) createSession(location, authnToken string) error {
+	form := url.Values{}
+	form.Set("authnToken", authnToken)
+
+	req, err := http.NewRequest("POST", location, strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.Wrap(err, "error building session request")
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := ic.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error creating IDCS session")
+	}
+
+	return res.Body.Close()
+}
+
+// completeFlow open the SAML application with the IDCS session, submitting the auto posted forms, until the SAML
+// response is found
+func (ic *Client) completeFlow(location string) (string, error) {
+	res, err := ic.client.Get(location)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving SAML flow")
+	}
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		form, err := page.NewFormFromDocument(doc, "form[method=\"post\"], form[method=\"POST\"]")
+		if err != nil {
+			return "", fmt.Errorf("unable to locate SAMLResponse in the page returned by %s", doc.Url.String())
+		}
+
+		action, err := url.Parse(form.URL)
+		if err != nil {
+			return "", errors.Wrap(err, "error resolving form action")
+		}
+		form.URL = doc.Url.ResolveReference(action).String()
+
+		res, err = form.Submit(ic.client)
+		if err != nil {
+			return "", errors.Wrap(err, "error submitting form")
+		}
+	}
+
+	return "", fmt.Errorf("SAML flow did not complete after %d steps", page.MaxSteps)
+}
+
+func (ic *Client) call(method, location, token string, body interface{}) (string, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	req, err := http.NewRequest(method, location, bytes.NewReader(data))
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("Accept", "application/json")
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	res, err := ic.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body")
+	}
+
+	resp := string(resBody)
+
+	if gjson.Get(resp, "status").String() == "failed" {
+		msg := gjson.Get(resp, "cause.0.message").String()
+		if msg == "" {
+			msg = res.Status
+		}
+		return "", fmt.Errorf("login failed: %s", msg)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,141 @@
+package idcs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	authenticateResp, err := ioutil.ReadFile("example/authenticate.json")
+	require.Nil(t, err)
+	mfaResp, err := ioutil.ReadFile("example/mfa.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sso/v1/sdk/authenticate" {
+			require.Equal(t, "Bearer access-token", r.Header.Get("Authorization"))
+		}
+
+		switch {
+		case r.URL.Path == "/oauth2/v1/token":
+			id, secret, ok := r.BasicAuth()
+			require.True(t, ok)
+			require.Equal(t, "client-id", id)
+			require.Equal(t, "client-secret", secret)
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+			w.Write([]byte(`{"access_token":"access-token","token_type":"Bearer","expires_in":3600}`))
+		case r.URL.Path == "/sso/v1/sdk/authenticate" && r.Method == "GET":
+			require.Equal(t, "AlibabaCloud", r.URL.Query().Get("appName"))
+			w.Write(authenticateResp)
+		case r.URL.Path == "/sso/v1/sdk/authenticate":
+			var body map[string]interface{}
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			credentials, _ := body["credentials"].(map[string]interface{})
+
+			switch body["requestState"] {
+			case "state-1":
+				require.Equal(t, "user", credentials["username"])
+				require.Equal(t, "secret", credentials["password"])
+				w.Write(mfaResp)
+			case "state-2":
+				require.Equal(t, "SMS", body["authFactor"])
+				require.Equal(t, "a91b2c3d4e5f6071", credentials["deviceId"])
+				w.Write([]byte(`{"status":"success","nextOp":["credSubmit","resendCode"],"requestState":"state-3"}`))
+			case "state-3":
+				require.Equal(t, "123456", credentials["otpCode"])
+				w.Write([]byte(`{"status":"success","authnToken":"authn-token","requestState":"state-4"}`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		case r.URL.Path == "/sso/v1/sdk/session":
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "authn-token", r.PostForm.Get("authnToken"))
+			http.SetCookie(w, &http.Cookie{Name: "ORA_OCIS_1", Value: "session", Path: "/"})
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/fed/v1/idp/initiatesso":
+			if _, err := r.Cookie("ORA_OCIS_1"); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "SMS", AppID: "AlibabaCloud"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:          ts.URL + "/fed/v1/idp/initiatesso?partnerName=AlibabaCloud",
+		Username:     "user",
+		Password:     "secret",
+		MFAToken:     "123456",
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	authenticateResp, err := ioutil.ReadFile("example/authenticate.json")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/oauth2/v1/token":
+			w.Write([]byte(`{"access_token":"access-token","token_type":"Bearer","expires_in":3600}`))
+		case r.URL.Path == "/sso/v1/sdk/authenticate" && r.Method == "GET":
+			w.Write(authenticateResp)
+		case r.URL.Path == "/sso/v1/sdk/authenticate":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"status":"failed","ecId":"q2yTZ1Yq1y4dY2bR","cause":[{"message":"You entered an incorrect user name or password.","code":"AUTH-3001"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto", AppID: "AlibabaCloud"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:          ts.URL + "/fed/v1/idp/initiatesso?partnerName=AlibabaCloud",
+		Username:     "user",
+		Password:     "wrong",
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+	})
+	require.EqualError(t, err, "error submitting credentials: login failed: You entered an incorrect user name or password.")
+}
+
+func TestSelectFactor(t *testing.T) {
+	mfaResp, err := ioutil.ReadFile("example/mfa.json")
+	require.Nil(t, err)
+
+	client := &Client{mfa: "TOTP"}
+	factor, err := client.selectFactor(string(mfaResp))
+	require.Nil(t, err)
+	require.Equal(t, "TOTP", factor)
+
+	client.mfa = "PUSH"
+	_, err = client.selectFactor(string(mfaResp))
+	require.EqualError(t, err, "MFA PUSH isn't offered by IDCS, available factors: TOTP, SMS")
+
+	client.mfa = "Auto"
+	factor, err = client.selectFactor(`{"nextAuthFactors":["BYPASSCODE"]}`)
+	require.Nil(t, err)
+	require.Equal(t, "BYPASSCODE", factor)
+}
@@ -0,0 +1,243 @@
+package ipsilon
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	loginFormFilter = "form:has(input[name=\"login_password\"])"
+
+	// negotiatePath the Kerberos login of the krb plugin, formPath the login form it falls back to
+	negotiatePath = "/login/krb/negotiate"
+	formPath      = "/login/form"
+)
+
+// the executables used for Kerberos, Go has no GSSAPI so the ticket is used through curl, replaced in tests
+var (
+	klistCommand = "klist"
+	curlCommand  = "curl"
+)
+
+var logger = logrus.WithField("provider", "ipsilon")
+
+// Client wrapper around Ipsilon
+type Client struct {
+	client *provider.HTTPClient
+}
+
+// New create a new Ipsilon client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+	}, nil
+}
+
+// Authenticate logs into Ipsilon with the Kerberos ticket of the user when there is one, falling back to the login
+// form, and returns a SAML response
+func (ic *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := ic.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	negotiated := false
+	passwordSubmitted := false
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		negotiateURL, hasNegotiate := findLink(doc, negotiatePath)
+		formURL, hasForm := findLink(doc, formPath)
+
+		switch {
+		case hasNegotiate && !negotiated:
+			negotiated = true
+			res, err = ic.negotiateOrFallback(negotiateURL, formURL)
+		case doc.Find(loginFormFilter).Size() > 0:
+			if passwordSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid username or password"))
+			}
+			passwordSubmitted = true
+			res, err = ic.submitLogin(doc, loginDetails)
+		case hasForm:
+			res, err = ic.follow(formURL)
+		default:
+			return "", fmt.Errorf("unexpected page returned by Ipsilon: %s", doc.Url.String())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("Ipsilon login did not complete after %d steps", page.MaxSteps)
+}
+
+// negotiateOrFallback log in with the Kerberos ticket when the user has one, otherwise or when Ipsilon refuses it
+// go on with the login form
+func (ic *Client) negotiateOrFallback(negotiateURL, formURL *url.URL) (*http.Response, error) {
+	if hasTicket() {
+		location, err := ic.negotiate(negotiateURL)
+		if err == nil {
+			logger.Debug("logged in with the Kerberos ticket")
+			return ic.follow(location)
+		}
+		logger.WithError(err).Debug("Kerberos login failed, falling back to the login form")
+	} else {
+		logger.Debug("no Kerberos ticket, using the login form")
+	}
+
+	if formURL == nil {
+		return nil, errors.New("Kerberos login failed and Ipsilon offers no login form, run kinit first")
+	}
+
+	return ic.follow(formURL)
+}
+
+// negotiate request the Kerberos login page through curl, which reads the ticket cache, sharing the cookies of the
+// login so far, and return where Ipsilon sends the user next
+func (ic *Client) negotiate(negotiateURL *url.URL) (*url.URL, error) {
+	args := []string{"--negotiate", "--user", ":", "--silent", "--show-error", "--include", "--max-redirs", "0"}
+	var cookies []string
+	for _, cookie := range ic.client.Jar.Cookies(negotiateURL) {
+		cookies = append(cookies, cookie.Name+"="+cookie.Value)
+	}
+	if len(cookies) > 0 {
+		args = append(args, "--cookie", strings.Join(cookies, "; "))
+	}
+	args = append(args, negotiateURL.String())
+
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(curlCommand, args...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "curl failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	res, err := lastResponse(out, negotiateURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 300 || res.StatusCode >= 400 {
+		return nil, fmt.Errorf("Kerberos login returned %s", res.Status)
+	}
+
+	ic.client.Jar.SetCookies(negotiateURL, res.Cookies())
+
+	location, err := res.Location()
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving Kerberos login redirect")
+	}
+
+	return location, nil
+}
+
+func (ic *Client) submitLogin(doc *goquery.Document, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	return page.SubmitForm(ic.client, doc, loginFormFilter, func(form *page.Form, _ *goquery.Selection) {
+		// FreeIPA expects the OTP appended to the password
+		form.Values.Set("login_name", loginDetails.Username)
+		form.Values.Set("login_password", loginDetails.Password+loginDetails.MFAToken)
+	})
+}
+
+func (ic *Client) follow(u *url.URL) (*http.Response, error) {
+	logger.WithField("url", u.String()).Debug("following redirect")
+
+	res, err := ic.client.Get(u.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "error following redirect")
+	}
+
+	return res, nil
+}
+
+// hasTicket check for a valid ticket granting ticket in the credentials cache
+func hasTicket() bool {
+	return exec.Command(klistCommand, "-s").Run() == nil
+}
+
+// lastResponse the final response of the output of curl --include, which holds the 401 challenge before it
+func lastResponse(out []byte, u *url.URL) (*http.Response, error) {
+	reader := bufio.NewReader(bytes.NewReader(out))
+	req := &http.Request{Method: "GET", URL: u}
+
+	var last *http.Response
+	for {
+		res, err := http.ReadResponse(reader, req)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			if last != nil {
+				break
+			}
+			return nil, errors.Wrap(err, "error parsing the curl response")
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		last = res
+	}
+
+	if last == nil {
+		return nil, errors.New("no response returned by curl")
+	}
+
+	return last, nil
+}
+
+// findLink the first link of the page to a path ending with suffix, Ipsilon uses links relative to the page
+func findLink(doc *goquery.Document, suffix string) (*url.URL, bool) {
+	var link *url.URL
+	doc.Find("a[href]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		u, err := doc.Url.Parse(s.AttrOr("href", ""))
+		if err == nil && strings.HasSuffix(u.Path, suffix) {
+			link = u
+			return false
+		}
+		return true
+	})
+	return link, link != nil
+}
+
+func loginError(doc *goquery.Document, fallback string) string {
+	msg := strings.TrimSpace(doc.Find(".alert-danger, .error, #error").First().Text())
+	if msg == "" {
+		msg = fallback
+	}
+	return msg
+}
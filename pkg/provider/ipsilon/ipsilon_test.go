@@ -0,0 +1,200 @@
+package ipsilon
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+const ssoPath = "/idp/saml2/SSO/Redirect"
+
+// fakeCurl answers the Kerberos login as Ipsilon does once the ticket is accepted, recording its arguments
+const fakeCurl = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/curl.args"
+printf 'HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: Negotiate\r\nContent-Length: 0\r\n\r\n'
+printf 'HTTP/1.1 303 See Other\r\nLocation: /idp/saml2/SSO/Continue?ipsilon_transaction_id=tx-1234\r\nSet-Cookie: ipsilon_session=krb; Path=/\r\nContent-Length: 0\r\n\r\n'
+`
+
+// fakeKerberos point klist and curl to scripts in a temporary directory, klist succeeding when hasTicket is set
+func fakeKerberos(t *testing.T, hasTicket bool) (string, func()) {
+	dir, err := ioutil.TempDir("", "ipsilon")
+	require.Nil(t, err)
+
+	status := "1"
+	if hasTicket {
+		status = "0"
+	}
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "klist"), []byte("#!/bin/sh\nexit "+status+"\n"), 0700))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "curl"), []byte(fakeCurl), 0700))
+
+	oldKlist, oldCurl := klistCommand, curlCommand
+	klistCommand, curlCommand = filepath.Join(dir, "klist"), filepath.Join(dir, "curl")
+
+	return dir, func() {
+		klistCommand, curlCommand = oldKlist, oldCurl
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAuthenticateKerberos(t *testing.T) {
+	krbPage, err := ioutil.ReadFile("example/krb.html")
+	require.Nil(t, err)
+	formPage, err := ioutil.ReadFile("example/form.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case ssoPath:
+			http.SetCookie(w, &http.Cookie{Name: "ipsilon_transaction", Value: "tx-1234", Path: "/"})
+			http.Redirect(w, r, "/idp/login/krb?ipsilon_transaction_id=tx-1234", http.StatusFound)
+		case "/idp/login/krb":
+			w.Write(krbPage)
+		case "/idp/login/form":
+			if r.Method == "GET" {
+				w.Write(bytes.Replace(formPage, []byte("{{ERROR}}"), nil, 1))
+				return
+			}
+			require.Equal(t, "tx-1234", r.PostForm.Get("ipsilon_transaction_id"))
+			require.Equal(t, "user", r.PostForm.Get("login_name"))
+			require.Equal(t, "secret123456", r.PostForm.Get("login_password"))
+			http.SetCookie(w, &http.Cookie{Name: "ipsilon_session", Value: "form", Path: "/"})
+			http.Redirect(w, r, "/idp/saml2/SSO/Continue?ipsilon_transaction_id=tx-1234", http.StatusSeeOther)
+		case "/idp/saml2/SSO/Continue":
+			if _, err := r.Cookie("ipsilon_session"); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	dir, restore := fakeKerberos(t, true)
+	defer restore()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL + ssoPath, Username: "user"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "curl.args"))
+	require.Nil(t, err)
+	require.Contains(t, string(args), "--negotiate")
+	require.Contains(t, string(args), "ipsilon_transaction=tx-1234")
+	require.Contains(t, string(args), ts.URL+"/idp/login/krb/negotiate?ipsilon_transaction_id=tx-1234")
+}
+
+func TestAuthenticateForm(t *testing.T) {
+	krbPage, err := ioutil.ReadFile("example/krb.html")
+	require.Nil(t, err)
+	formPage, err := ioutil.ReadFile("example/form.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case ssoPath:
+			http.SetCookie(w, &http.Cookie{Name: "ipsilon_transaction", Value: "tx-1234", Path: "/"})
+			http.Redirect(w, r, "/idp/login/krb?ipsilon_transaction_id=tx-1234", http.StatusFound)
+		case "/idp/login/krb":
+			w.Write(krbPage)
+		case "/idp/login/form":
+			if r.Method == "GET" {
+				w.Write(bytes.Replace(formPage, []byte("{{ERROR}}"), nil, 1))
+				return
+			}
+			require.Equal(t, "tx-1234", r.PostForm.Get("ipsilon_transaction_id"))
+			require.Equal(t, "user", r.PostForm.Get("login_name"))
+			require.Equal(t, "secret123456", r.PostForm.Get("login_password"))
+			http.SetCookie(w, &http.Cookie{Name: "ipsilon_session", Value: "form", Path: "/"})
+			http.Redirect(w, r, "/idp/saml2/SSO/Continue?ipsilon_transaction_id=tx-1234", http.StatusSeeOther)
+		case "/idp/saml2/SSO/Continue":
+			if _, err := r.Cookie("ipsilon_session"); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	dir, restore := fakeKerberos(t, false)
+	defer restore()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + ssoPath,
+		Username: "user",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+
+	_, err = os.Stat(filepath.Join(dir, "curl.args"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	krbPage, err := ioutil.ReadFile("example/krb.html")
+	require.Nil(t, err)
+	formPage, err := ioutil.ReadFile("example/form.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case ssoPath:
+			http.SetCookie(w, &http.Cookie{Name: "ipsilon_transaction", Value: "tx-1234", Path: "/"})
+			http.Redirect(w, r, "/idp/login/krb?ipsilon_transaction_id=tx-1234", http.StatusFound)
+		case "/idp/login/krb":
+			w.Write(krbPage)
+		case "/idp/login/form":
+			if r.Method == "GET" {
+				w.Write(bytes.Replace(formPage, []byte("{{ERROR}}"), nil, 1))
+				return
+			}
+			w.Write(bytes.Replace(formPage, []byte("{{ERROR}}"), []byte(`<div class="alert alert-danger"><p>Authentication failed</p></div>`), 1))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	_, restore := fakeKerberos(t, false)
+	defer restore()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + ssoPath,
+		Username: "user",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "login failed: Authentication failed")
+}
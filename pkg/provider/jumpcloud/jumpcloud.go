@@ -54,7 +54,7 @@ type JCMessage struct {
 // New creates a new JumpCloud client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewAccountTransport(idpAccount)
 
 	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
@@ -0,0 +1,257 @@
+package kanidm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// sessionHeader the header carrying the ID of the authentication session between the steps
+const sessionHeader = "X-KANIDM-AUTH-SESSION-ID"
+
+// the Kanidm authentication mechanisms
+const (
+	mechPassword    = "password"
+	mechPasswordMFA = "passwordmfa"
+)
+
+// the Kanidm credentials
+const (
+	credPassword   = "password"
+	credTOTP       = "totp"
+	credBackupCode = "backupcode"
+)
+
+// maxSteps the number of authentication steps gone through before giving up
+const maxSteps = 6
+
+var logger = logrus.WithField("provider", "kanidm")
+
+// Client wrapper around Kanidm enabling authentication and retrieval of assertions
+type Client struct {
+	client *provider.HTTPClient
+}
+
+// New create a new Kanidm client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+	}, nil
+}
+
+// Authenticate logs into Kanidm through its authentication API with the password and the TOTP or backup code the
+// account requires, then returns the SAML response of the Alibaba Cloud application for the session
+func (kc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	u, err := url.Parse(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing url")
+	}
+
+	api := fmt.Sprintf("%s://%s/v1/auth", u.Scheme, u.Host)
+
+	resp, session, err := kc.call(api, "", map[string]interface{}{"init": loginDetails.Username})
+	if err != nil {
+		return "", errors.Wrap(err, "error starting authentication")
+	}
+
+	token := ""
+	passwordSent := false
+	codeSent := false
+
+	for step := 0; token == ""; step++ {
+		if step == maxSteps {
+			return "", errors.New("login failed: Kanidm keeps asking for credentials")
+		}
+
+		state := gjson.Get(resp, "state")
+
+		var next map[string]interface{}
+
+		switch {
+		case state.Get("success").Exists():
+			token = state.Get("success").String()
+			continue
+		case state.Get("denied").Exists():
+			return "", fmt.Errorf("login failed: %s", state.Get("denied").String())
+		case state.Get("choose").Exists():
+			mech, err := chooseMech(state.Get("choose").Array())
+			if err != nil {
+				return "", err
+			}
+			logger.WithField("mech", mech).Debug("authentication mechanism")
+			next = map[string]interface{}{"begin": mech}
+		case state.Get("continue").Exists():
+			allowed := state.Get("continue").Array()
+			switch {
+			case contains(allowed, credPassword) && !passwordSent:
+				passwordSent = true
+				next = map[string]interface{}{"cred": map[string]interface{}{credPassword: loginDetails.Password}}
+			case contains(allowed, credTOTP) && !codeSent:
+				codeSent = true
+				code, err := totp(loginDetails)
+				if err != nil {
+					return "", err
+				}
+				next = map[string]interface{}{"cred": map[string]interface{}{credTOTP: code}}
+			case contains(allowed, credBackupCode) && !codeSent:
+				codeSent = true
+				next = map[string]interface{}{"cred": map[string]interface{}{credBackupCode: prompter.StringRequired("Kanidm backup code")}}
+			default:
+				return "", fmt.Errorf("no supported Kanidm credential, offered: %s", join(allowed))
+			}
+		default:
+			return "", errors.New("unexpected Kanidm authentication state")
+		}
+
+		resp, session, err = kc.call(api, session, next)
+		if err != nil {
+			return "", errors.Wrap(err, "error authenticating")
+		}
+	}
+
+	req, err := http.NewRequest("GET", loginDetails.URL, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	res, err := kc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving SAML response")
+	}
+
+	samlAssertion, err := extractSAMLResponse(res)
+	if err != nil {
+		return "", err
+	}
+	if samlAssertion == "" {
+		return "", errors.New("no SAML response returned for the Kanidm session, check the user belongs to the groups of the Alibaba Cloud application")
+	}
+
+	return samlAssertion, nil
+}
+
+// chooseMech the mechanism to authenticate with, the password with a second factor when Kanidm offers it, as the
+// account policy then requires it
+func chooseMech(offered []gjson.Result) (string, error) {
+	for _, mech := range []string{mechPasswordMFA, mechPassword} {
+		if contains(offered, mech) {
+			return mech, nil
+		}
+	}
+	return "", fmt.Errorf("no supported Kanidm authentication mechanism, offered: %s, passkeys aren't supported", join(offered))
+}
+
+// totp the TOTP code given with --mfa-token or prompted for, Kanidm expects it as a number
+func totp(loginDetails *creds.LoginDetails) (int, error) {
+	code := loginDetails.MFAToken
+	if code == "" {
+		code = prompter.RequestSecurityCode("000000")
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(code))
+	if err != nil {
+		return 0, fmt.Errorf("invalid TOTP code: %s", code)
+	}
+	return n, nil
+}
+
+// call send an authentication step, returning the response along with the ID of the authentication session
+func (kc *Client) call(api, session string, step interface{}) (string, string, error) {
+	data, err := json.Marshal(map[string]interface{}{"step": step})
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequest("POST", api, bytes.NewReader(data))
+	if err != nil {
+		return "", "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Content-Type", "application/json")
+	if session != "" {
+		req.Header.Add(sessionHeader, session)
+	}
+
+	res, err := kc.client.Do(req)
+	if err != nil {
+		return "", "", errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", "", errors.Wrap(err, "error retrieving body")
+	}
+
+	resp := string(resBody)
+
+	if res.StatusCode >= 400 {
+		// errors are a JSON string such as "nomatchingentries"
+		msg := gjson.Parse(resp).String()
+		if msg == "" {
+			msg = res.Status
+		}
+		return "", "", fmt.Errorf("Kanidm returned an error: %s", msg)
+	}
+
+	if id := res.Header.Get(sessionHeader); id != "" {
+		session = id
+	} else if id := gjson.Get(resp, "sessionid").String(); id != "" {
+		session = id
+	}
+
+	return resp, session, nil
+}
+
+func contains(values []gjson.Result, value string) bool {
+	for _, v := range values {
+		if v.String() == value {
+			return true
+		}
+	}
+	return false
+}
+
+func join(values []gjson.Result) string {
+	names := make([]string, 0, len(values))
+	for _, v := range values {
+		names = append(names, v.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// extractSAMLResponse the SAML response posted to Alibaba Cloud by the page, empty when the page has none
+func extractSAMLResponse(res *http.Response) (string, error) {
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build document from response")
+	}
+
+	samlAssertion, _ := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
+
+	return samlAssertion, nil
+}
@@ -0,0 +1,122 @@
+package kanidm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestAuthenticatePasswordMFA(t *testing.T) {
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	var steps []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth":
+			body, err := ioutil.ReadAll(r.Body)
+			require.Nil(t, err)
+			step := gjson.GetBytes(body, "step")
+			steps = append(steps, step.Raw)
+
+			if !step.Get("init").Exists() {
+				require.Equal(t, "2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71", r.Header.Get(sessionHeader))
+			}
+			w.Header().Set(sessionHeader, "2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71")
+
+			switch {
+			case step.Get("init").Exists():
+				fmt.Fprint(w, `{"sessionid":"2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71","state":{"choose":["passkey","passwordmfa"]}}`)
+			case step.Get("begin").Exists():
+				require.Equal(t, mechPasswordMFA, step.Get("begin").String())
+				fmt.Fprint(w, `{"sessionid":"2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71","state":{"continue":["totp","backupcode"]}}`)
+			case step.Get("cred.totp").Exists():
+				require.Equal(t, int64(123456), step.Get("cred.totp").Int())
+				fmt.Fprint(w, `{"sessionid":"2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71","state":{"continue":["password"]}}`)
+			default:
+				require.Equal(t, "secret", step.Get("cred.password").String())
+				fmt.Fprint(w, `{"sessionid":"2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71","state":{"success":"eyJhbGciOiJFUzI1NiJ9.session"}}`)
+			}
+		case "/saml/alibabacloud/sso":
+			require.Equal(t, "Bearer eyJhbGciOiJFUzI1NiJ9.session", r.Header.Get("Authorization"))
+			w.Write(assertionPage)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{URL: ts.URL + "/saml/alibabacloud/sso", Username: "roadrunner", Password: "secret", MFAToken: "123456"})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.Equal(t, []string{
+		`{"init":"roadrunner"}`,
+		`{"begin":"passwordmfa"}`,
+		`{"cred":{"totp":123456}}`,
+		`{"cred":{"password":"secret"}}`,
+	}, steps)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(t, err)
+		step := gjson.GetBytes(body, "step")
+		w.Header().Set(sessionHeader, "2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71")
+
+		switch {
+		case step.Get("init").Exists():
+			fmt.Fprint(w, `{"sessionid":"2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71","state":{"choose":["password"]}}`)
+		case step.Get("begin").Exists():
+			fmt.Fprint(w, `{"sessionid":"2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71","state":{"continue":["password"]}}`)
+		default:
+			fmt.Fprint(w, `{"sessionid":"2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71","state":{"denied":"password incorrect"}}`)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + "/saml/alibabacloud/sso", Username: "roadrunner", Password: "wrong"})
+	require.EqualError(t, err, "login failed: password incorrect")
+}
+
+func TestAuthenticateUnknownUser(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `"nomatchingentries"`)
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + "/saml/alibabacloud/sso", Username: "unknown", Password: "secret"})
+	require.EqualError(t, err, "error starting authentication: Kanidm returned an error: nomatchingentries")
+}
+
+func TestAuthenticatePasskeyOnly(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(sessionHeader, "2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71")
+		fmt.Fprint(w, `{"sessionid":"2b2a4e5b-7c3f-4f0e-9d3c-0a6f3b9e8d71","state":{"choose":["passkey"]}}`)
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + "/saml/alibabacloud/sso", Username: "roadrunner", Password: "secret"})
+	require.EqualError(t, err, "no supported Kanidm authentication mechanism, offered: passkey, passkeys aren't supported")
+}
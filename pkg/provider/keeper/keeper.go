@@ -0,0 +1,267 @@
+package keeper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// maxApprovalPolls the number of times a pending device approval is checked before giving up
+	maxApprovalPolls = 60
+
+	emailFormFilter        = "form:has(input[name=\"email\"])"
+	passwordFormFilter     = "form:has(input[name=\"password\"])"
+	codeFormFilter         = "form:has(input[name=\"code\"])"
+	approvalFormFilter     = "form:has(input[name=\"approval_method\"])"
+	verificationFormFilter = "form:has(input[name=\"verification_code\"])"
+	pendingFilter          = "[data-poll-url]"
+)
+
+// the device approval methods offered by Keeper
+const (
+	approvalPush  = "keeper_push"
+	approvalEmail = "email"
+	approvalAdmin = "admin"
+)
+
+// the saml2alibabacloud names of the device approval methods, in the order Auto tries them
+var mfaApprovals = []struct {
+	MFA    string
+	Method string
+}{
+	{"PUSH", approvalPush},
+	{"EMAIL", approvalEmail},
+	{"ADMIN", approvalAdmin},
+}
+
+// approvalPeriod how long to wait between two polls of a pending device approval
+var approvalPeriod = 2 * time.Second
+
+var logger = logrus.WithField("provider", "keeper")
+
+// Client wrapper around Keeper SSO Connect
+type Client struct {
+	client *provider.HTTPClient
+	mfa    string
+}
+
+// New create a new Keeper client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		mfa:    idpAccount.MFA,
+	}, nil
+}
+
+// Authenticate logs into Keeper SSO Connect, submitting the email, the master password and the two factor code,
+// getting a new device approved when Keeper asks for it, and returns the SAML response of the Alibaba Cloud
+// application
+func (kc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := kc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	emailSubmitted := false
+	passwordSubmitted := false
+	codeSubmitted := false
+	approvalRequested := false
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		switch {
+		case doc.Find(passwordFormFilter).Size() > 0:
+			if passwordSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid master password"))
+			}
+			passwordSubmitted = true
+			res, err = page.SubmitForm(kc.client, doc, passwordFormFilter, func(form *page.Form, _ *goquery.Selection) {
+				form.Values.Set("password", loginDetails.Password)
+			})
+		case doc.Find(emailFormFilter).Size() > 0:
+			if emailSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "unknown email"))
+			}
+			emailSubmitted = true
+			res, err = page.SubmitForm(kc.client, doc, emailFormFilter, func(form *page.Form, _ *goquery.Selection) {
+				form.Values.Set("email", loginDetails.Username)
+			})
+		case doc.Find(codeFormFilter).Size() > 0:
+			if codeSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid two factor code"))
+			}
+			codeSubmitted = true
+			code := loginDetails.MFAToken
+			if code == "" {
+				code = prompter.RequestSecurityCode("000000")
+			}
+			res, err = page.SubmitForm(kc.client, doc, codeFormFilter, func(form *page.Form, _ *goquery.Selection) {
+				form.Values.Set("code", code)
+			})
+		case doc.Find(approvalFormFilter).Size() > 0:
+			if approvalRequested {
+				return "", fmt.Errorf("device approval failed: %s", loginError(doc, "Keeper keeps asking to approve the device"))
+			}
+			approvalRequested = true
+			res, err = kc.requestApproval(doc)
+		case doc.Find(verificationFormFilter).Size() > 0:
+			code := prompter.StringRequired("Device approval code sent by email")
+			res, err = page.SubmitForm(kc.client, doc, verificationFormFilter, func(form *page.Form, _ *goquery.Selection) {
+				form.Values.Set("verification_code", strings.TrimSpace(code))
+			})
+		case doc.Find(pendingFilter).Size() > 0:
+			res, err = kc.waitForApproval(doc)
+		default:
+			return "", fmt.Errorf("unexpected page returned by Keeper: %s", doc.Url.String())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("Keeper login did not complete after %d steps", page.MaxSteps)
+}
+
+// requestApproval ask for the new device to be approved with the method matching the MFA type, Auto uses the first
+// of a Keeper push, an email code and an admin approval offered
+func (kc *Client) requestApproval(doc *goquery.Document) (*http.Response, error) {
+	offered := map[string]bool{}
+	doc.Find(approvalFormFilter + " input[name=\"approval_method\"]").Each(func(i int, s *goquery.Selection) {
+		offered[s.AttrOr("value", "")] = true
+	})
+
+	method := ""
+	for _, a := range mfaApprovals {
+		if offered[a.Method] && (strings.EqualFold(kc.mfa, "Auto") || strings.EqualFold(kc.mfa, a.MFA)) {
+			method = a.Method
+			break
+		}
+	}
+	if method == "" {
+		return nil, fmt.Errorf("no Keeper device approval method for MFA type %s", kc.mfa)
+	}
+
+	switch method {
+	case approvalPush:
+		log.Println("This device needs to be approved, confirm the login from the Keeper app on an approved device")
+	case approvalAdmin:
+		log.Println("This device needs to be approved, waiting for a Keeper administrator to approve it")
+	}
+
+	logger.WithField("method", method).Debug("requesting device approval")
+
+	return page.SubmitForm(kc.client, doc, approvalFormFilter, func(form *page.Form, _ *goquery.Selection) {
+		form.Values.Set("approval_method", method)
+	})
+}
+
+// waitForApproval poll the status of the pending device approval, then continue the login once approved
+func (kc *Client) waitForApproval(doc *goquery.Document) (*http.Response, error) {
+	pending := doc.Find(pendingFilter).First()
+
+	pollURL, err := doc.Url.Parse(pending.AttrOr("data-poll-url", ""))
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving device approval status url")
+	}
+	continueURL, err := doc.Url.Parse(pending.AttrOr("data-continue-url", ""))
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving device approval continue url")
+	}
+
+	for i := 0; i < maxApprovalPolls; i++ {
+		status, err := kc.approvalStatus(pollURL.String())
+		if err != nil {
+			return nil, err
+		}
+
+		switch status {
+		case "approved":
+			logger.Debug("device approved")
+			res, err := kc.client.Get(continueURL.String())
+			if err != nil {
+				return nil, errors.Wrap(err, "error continuing login")
+			}
+			return res, nil
+		case "denied":
+			return nil, errors.New("device approval failed: the approval was denied")
+		case "expired":
+			return nil, errors.New("device approval failed: the approval request expired")
+		case "waiting":
+			if err := kc.client.Sleep(approvalPeriod); err != nil {
+				return nil, errors.Wrap(err, "error waiting for the device approval")
+			}
+		default:
+			return nil, fmt.Errorf("unexpected Keeper device approval status: %s", status)
+		}
+	}
+
+	return nil, errors.New("timed out waiting for the device to be approved")
+}
+
+func (kc *Client) approvalStatus(pollURL string) (string, error) {
+	req, err := http.NewRequest("GET", pollURL, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Accept", "application/json")
+
+	res, err := kc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error checking device approval status")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body")
+	}
+
+	if res.StatusCode >= 400 {
+		msg := gjson.GetBytes(body, "message").String()
+		if msg == "" {
+			msg = res.Status
+		}
+		return "", fmt.Errorf("Keeper returned an error: %s", msg)
+	}
+
+	return gjson.GetBytes(body, "status").String(), nil
+}
+
+func loginError(doc *goquery.Document, fallback string) string {
+	msg := strings.TrimSpace(doc.Find(".error-message, [role=\"alert\"]").First().Text())
+	if msg == "" {
+		msg = fallback
+	}
+	return msg
+}
@@ -0,0 +1,336 @@
+package keeper
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticatePush(t *testing.T) {
+	approvalPeriod = 0
+
+	emailPage, err := ioutil.ReadFile("example/email.html")
+	require.Nil(t, err)
+	passwordPage, err := ioutil.ReadFile("example/password.html")
+	require.Nil(t, err)
+	codePage, err := ioutil.ReadFile("example/code.html")
+	require.Nil(t, err)
+	approvalPage, err := ioutil.ReadFile("example/approval.html")
+	require.Nil(t, err)
+	pendingPage, err := ioutil.ReadFile("example/pending.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	statuses := []string{"waiting", "waiting", "approved"}
+	var calls []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+		calls = append(calls, r.Method+" "+r.URL.Path)
+
+		switch r.URL.Path {
+		case "/sso-connect/saml/alibabacloud":
+			http.Redirect(w, r, "/sso-connect/login", http.StatusFound)
+		case "/sso-connect/login":
+			w.Write(emailPage)
+		case "/sso-connect/login/email":
+			require.Equal(t, "b3f1c9d2e8a74c6f", r.PostForm.Get("session"))
+			require.Equal(t, "user@example.com", r.PostForm.Get("email"))
+			w.Write(passwordPage)
+		case "/sso-connect/login/password":
+			require.Equal(t, "secret", r.PostForm.Get("password"))
+			w.Write(codePage)
+		case "/sso-connect/login/2fa":
+			require.Equal(t, "123456", r.PostForm.Get("code"))
+			w.Write(approvalPage)
+		case "/sso-connect/device/approve":
+			require.Equal(t, approvalPush, r.PostForm.Get("approval_method"))
+			w.Write(pendingPage)
+		case "/sso-connect/device/status":
+			require.Equal(t, "b3f1c9d2e8a74c6f", r.URL.Query().Get("session"))
+			fmt.Fprintf(w, `{"status":"%s"}`, statuses[0])
+			statuses = statuses[1:]
+		case "/sso-connect/device/complete":
+			w.Write(assertionPage)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.MFA = "Auto"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/sso-connect/saml/alibabacloud",
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.Equal(t, []string{
+		"GET /sso-connect/saml/alibabacloud",
+		"GET /sso-connect/login",
+		"POST /sso-connect/login/email",
+		"POST /sso-connect/login/password",
+		"POST /sso-connect/login/2fa",
+		"POST /sso-connect/device/approve",
+		"GET /sso-connect/device/status",
+		"GET /sso-connect/device/status",
+		"GET /sso-connect/device/status",
+		"GET /sso-connect/device/complete",
+	}, calls)
+}
+
+func TestAuthenticateEmailApproval(t *testing.T) {
+	emailPage, err := ioutil.ReadFile("example/email.html")
+	require.Nil(t, err)
+	passwordPage, err := ioutil.ReadFile("example/password.html")
+	require.Nil(t, err)
+	codePage, err := ioutil.ReadFile("example/code.html")
+	require.Nil(t, err)
+	approvalPage, err := ioutil.ReadFile("example/approval.html")
+	require.Nil(t, err)
+	verificationPage, err := ioutil.ReadFile("example/verification.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/sso-connect/saml/alibabacloud":
+			http.Redirect(w, r, "/sso-connect/login", http.StatusFound)
+		case "/sso-connect/login":
+			w.Write(emailPage)
+		case "/sso-connect/login/email":
+			w.Write(passwordPage)
+		case "/sso-connect/login/password":
+			w.Write(codePage)
+		case "/sso-connect/login/2fa":
+			w.Write(approvalPage)
+		case "/sso-connect/device/approve":
+			require.Equal(t, approvalEmail, r.PostForm.Get("approval_method"))
+			w.Write(verificationPage)
+		case "/sso-connect/device/verify":
+			require.Equal(t, "654321", r.PostForm.Get("verification_code"))
+			w.Write(assertionPage)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("StringRequired", "Device approval code sent by email").Return("654321").Once()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.MFA = "EMAIL"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/sso-connect/saml/alibabacloud",
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	pr.Mock.AssertExpectations(t)
+}
+
+func TestAuthenticateDenied(t *testing.T) {
+	approvalPeriod = 0
+
+	emailPage, err := ioutil.ReadFile("example/email.html")
+	require.Nil(t, err)
+	passwordPage, err := ioutil.ReadFile("example/password.html")
+	require.Nil(t, err)
+	codePage, err := ioutil.ReadFile("example/code.html")
+	require.Nil(t, err)
+	approvalPage, err := ioutil.ReadFile("example/approval.html")
+	require.Nil(t, err)
+	pendingPage, err := ioutil.ReadFile("example/pending.html")
+	require.Nil(t, err)
+
+	statuses := []string{"waiting", "denied"}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/sso-connect/saml/alibabacloud":
+			http.Redirect(w, r, "/sso-connect/login", http.StatusFound)
+		case "/sso-connect/login":
+			w.Write(emailPage)
+		case "/sso-connect/login/email":
+			w.Write(passwordPage)
+		case "/sso-connect/login/password":
+			w.Write(codePage)
+		case "/sso-connect/login/2fa":
+			w.Write(approvalPage)
+		case "/sso-connect/device/approve":
+			require.Equal(t, approvalAdmin, r.PostForm.Get("approval_method"))
+			w.Write(pendingPage)
+		case "/sso-connect/device/status":
+			fmt.Fprintf(w, `{"status":"%s"}`, statuses[0])
+			statuses = statuses[1:]
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.MFA = "ADMIN"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/sso-connect/saml/alibabacloud",
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.EqualError(t, err, "device approval failed: the approval was denied")
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	emailPage, err := ioutil.ReadFile("example/email.html")
+	require.Nil(t, err)
+	passwordPage, err := ioutil.ReadFile("example/password.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sso-connect/saml/alibabacloud":
+			http.Redirect(w, r, "/sso-connect/login", http.StatusFound)
+		case "/sso-connect/login":
+			w.Write(emailPage)
+		case "/sso-connect/login/email":
+			w.Write(passwordPage)
+		case "/sso-connect/login/password":
+			w.Write(bytes.Replace(passwordPage, []byte("<!-- LOGIN ERROR -->"), []byte(`<div class="error-message">Incorrect master password</div>`), 1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.MFA = "Auto"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/sso-connect/saml/alibabacloud",
+		Username: "user@example.com",
+		Password: "wrong",
+		MFAToken: "123456",
+	})
+	require.EqualError(t, err, "login failed: Incorrect master password")
+}
+
+func TestAuthenticateBadCode(t *testing.T) {
+	emailPage, err := ioutil.ReadFile("example/email.html")
+	require.Nil(t, err)
+	passwordPage, err := ioutil.ReadFile("example/password.html")
+	require.Nil(t, err)
+	codePage, err := ioutil.ReadFile("example/code.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sso-connect/saml/alibabacloud":
+			http.Redirect(w, r, "/sso-connect/login", http.StatusFound)
+		case "/sso-connect/login":
+			w.Write(emailPage)
+		case "/sso-connect/login/email":
+			w.Write(passwordPage)
+		case "/sso-connect/login/password":
+			w.Write(codePage)
+		case "/sso-connect/login/2fa":
+			w.Write(bytes.Replace(codePage, []byte("<!-- LOGIN ERROR -->"), []byte(`<div class="error-message">Invalid code</div>`), 1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.MFA = "Auto"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/sso-connect/saml/alibabacloud",
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "000000",
+	})
+	require.EqualError(t, err, "login failed: Invalid code")
+}
+
+func TestAuthenticateUnsupportedMFA(t *testing.T) {
+	emailPage, err := ioutil.ReadFile("example/email.html")
+	require.Nil(t, err)
+	passwordPage, err := ioutil.ReadFile("example/password.html")
+	require.Nil(t, err)
+	codePage, err := ioutil.ReadFile("example/code.html")
+	require.Nil(t, err)
+	approvalPage, err := ioutil.ReadFile("example/approval.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sso-connect/saml/alibabacloud":
+			http.Redirect(w, r, "/sso-connect/login", http.StatusFound)
+		case "/sso-connect/login":
+			w.Write(emailPage)
+		case "/sso-connect/login/email":
+			w.Write(passwordPage)
+		case "/sso-connect/login/password":
+			w.Write(codePage)
+		case "/sso-connect/login/2fa":
+			w.Write(approvalPage)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.MFA = "TOTP"
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/sso-connect/saml/alibabacloud",
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.EqualError(t, err, "no Keeper device approval method for MFA type TOTP")
+}
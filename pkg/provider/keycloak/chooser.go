@@ -0,0 +1,180 @@
+package keycloak
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/pkg/errors"
+)
+
+// authExecRegexp the authentication execution an option of the credential chooser submits
+var authExecRegexp = regexp.MustCompile(`\['authenticationExecution'\]\.value\s*=\s*'([^']+)'`)
+
+// mfaKeywords the words of the display names, as in the chooser and its English messages, identifying the credential
+// kinds the mfa of the account may name
+var mfaKeywords = map[string][]string{
+	"OTP":      {"authenticator application", "one-time", "otp"},
+	"WebAuthn": {"security key", "passkey", "webauthn"},
+}
+
+// credentialOption an option of the credential chooser of Keycloak
+type credentialOption struct {
+	AuthExecID  string
+	Name        string
+	Description string
+}
+
+func containsTryAnotherWay(doc *goquery.Document) bool {
+	return doc.Find("form#kc-select-try-another-way-form").Length() > 0
+}
+
+func containsCredentialChooser(doc *goquery.Document) bool {
+	return doc.Find("form#kc-select-credential-form").Length() > 0
+}
+
+// matchesMFA whether the name of the credential is of the kind the mfa of the account names
+func matchesMFA(mfa, name string) bool {
+	name = strings.ToLower(name)
+	for _, keyword := range mfaKeywords[mfa] {
+		if strings.Contains(name, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldTryAnotherWay whether the credential the page asks for should be swapped for another one, with Auto the user is
+// asked to choose whenever the realm offers alternatives, with OTP or WebAuthn only when the page asks for the other one
+func (kc *Client) shouldTryAnotherWay(doc *goquery.Document) bool {
+	if !containsTryAnotherWay(doc) {
+		return false
+	}
+
+	switch kc.mfa {
+	case "OTP":
+		return !containsTotpForm(doc)
+	case "WebAuthn":
+		return !containsWebAuthnForm(doc)
+	default:
+		return true
+	}
+}
+
+// tryAnotherWay post the "Try Another Way" link of the page, which returns the credential chooser
+func (kc *Client) tryAnotherWay(doc *goquery.Document) (*goquery.Document, error) {
+	submitURL, ok := doc.Find("form#kc-select-try-another-way-form").Attr("action")
+	if !ok || submitURL == "" {
+		return nil, errors.New("unable to locate IDP try another way form submit URL")
+	}
+
+	return kc.postForm(submitURL, url.Values{"tryAnotherWay": []string{"on"}})
+}
+
+func extractCredentialOptions(doc *goquery.Document) []credentialOption {
+	var options []credentialOption
+
+	doc.Find("form#kc-select-credential-form .select-auth-box-parent").Each(func(i int, s *goquery.Selection) {
+		onclick, _ := s.Attr("onclick")
+		match := authExecRegexp.FindStringSubmatch(onclick)
+		if match == nil {
+			return
+		}
+		options = append(options, credentialOption{
+			AuthExecID:  match[1],
+			Name:        strings.TrimSpace(s.Find(".select-auth-box-headline").Text()),
+			Description: strings.TrimSpace(s.Find(".select-auth-box-desc").Text()),
+		})
+	})
+
+	return options
+}
+
+// chooseCredential submit the option of the credential chooser the mfa of the account names, prompting for it with Auto
+// or when none matches
+func (kc *Client) chooseCredential(doc *goquery.Document) (*goquery.Document, error) {
+	submitURL, ok := doc.Find("form#kc-select-credential-form").Attr("action")
+	if !ok || submitURL == "" {
+		return nil, errors.New("unable to locate IDP credential chooser form submit URL")
+	}
+
+	options := extractCredentialOptions(doc)
+	if len(options) == 0 {
+		return nil, errors.New("unable to locate the credentials of the IDP credential chooser")
+	}
+
+	selected := -1
+	for i, option := range options {
+		if matchesMFA(kc.mfa, option.Name) {
+			selected = i
+			break
+		}
+	}
+
+	if selected == -1 {
+		names := make([]string, len(options))
+		for i, option := range options {
+			names[i] = option.Name
+			if option.Description != "" {
+				names[i] += " - " + option.Description
+			}
+		}
+		selected = prompter.Choose("Select the credential to sign in with", names)
+	}
+
+	return kc.postForm(submitURL, url.Values{"authenticationExecution": []string{options[selected].AuthExecID}})
+}
+
+// selectOTPCredential add the OTP device to use to the form when the user registered several, prompting for it
+func selectOTPCredential(otpForm url.Values, doc *goquery.Document) {
+	var ids, labels []string
+
+	doc.Find("input[type=radio][name=selectedCredentialId]").Each(func(i int, s *goquery.Selection) {
+		id, ok := s.Attr("value")
+		if !ok {
+			return
+		}
+		label := id
+		if inputID, ok := s.Attr("id"); ok {
+			if text := strings.TrimSpace(doc.Find("label[for='" + inputID + "']").Text()); text != "" {
+				label = text
+			}
+		}
+		ids = append(ids, id)
+		labels = append(labels, label)
+	})
+
+	switch len(ids) {
+	case 0:
+		return
+	case 1:
+		otpForm.Set("selectedCredentialId", ids[0])
+	default:
+		otpForm.Set("selectedCredentialId", ids[prompter.Choose("Select the OTP device", labels)])
+	}
+}
+
+func (kc *Client) postForm(submitURL string, form url.Values) (*goquery.Document, error) {
+
+	req, err := http.NewRequest("POST", submitURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building request")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := kc.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving content")
+	}
+
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading response")
+	}
+
+	return doc, nil
+}
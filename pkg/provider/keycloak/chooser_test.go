@@ -0,0 +1,93 @@
+package keycloak
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/stretchr/testify/require"
+)
+
+func loadDocument(t *testing.T, name string) *goquery.Document {
+	data, err := ioutil.ReadFile(name)
+	require.Nil(t, err)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+	return doc
+}
+
+func TestExtractCredentialOptions(t *testing.T) {
+	doc := loadDocument(t, "example/selectauthenticator.html")
+
+	require.True(t, containsCredentialChooser(doc))
+	require.Equal(t, []credentialOption{
+		{AuthExecID: "a718db5b-6d9e-40a2-a895-4f4505e6f464", Name: "Authenticator Application", Description: "Enter a verification code from authenticator application."},
+		{AuthExecID: "4e0dd3d5-0c6f-4b8c-9d4c-b05c3e2c5e2f", Name: "Security Key", Description: "Use your security key to sign in."},
+	}, extractCredentialOptions(doc))
+}
+
+func TestShouldTryAnotherWay(t *testing.T) {
+	doc := loadDocument(t, "example/otpdevices.html")
+
+	require.True(t, (&Client{mfa: "Auto"}).shouldTryAnotherWay(doc))
+	require.False(t, (&Client{mfa: "OTP"}).shouldTryAnotherWay(doc))
+	require.True(t, (&Client{mfa: "WebAuthn"}).shouldTryAnotherWay(doc))
+	require.False(t, (&Client{mfa: "Auto"}).shouldTryAnotherWay(loadDocument(t, "example/mfapage.html")))
+}
+
+func TestClient_chooseCredential(t *testing.T) {
+	doc := loadDocument(t, "example/selectauthenticator.html")
+
+	var posted url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+		posted = r.PostForm
+		w.Write([]byte("<html></html>"))
+	}))
+	defer ts.Close()
+
+	action, _ := doc.Find("form#kc-select-credential-form").Attr("action")
+	doc.Find("form#kc-select-credential-form").SetAttr("action", strings.Replace(action, "https://id.example.com", ts.URL, 1))
+
+	opts := &provider.HTTPClientOptions{IsWithRetries: false}
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}, Options: opts}, mfa: "WebAuthn"}
+
+	_, err := kc.chooseCredential(doc)
+	require.Nil(t, err)
+	require.Equal(t, "4e0dd3d5-0c6f-4b8c-9d4c-b05c3e2c5e2f", posted.Get("authenticationExecution"))
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("Choose", "Select the credential to sign in with", []string{
+		"Authenticator Application - Enter a verification code from authenticator application.",
+		"Security Key - Use your security key to sign in.",
+	}).Return(0)
+
+	kc.mfa = "Auto"
+	_, err = kc.chooseCredential(doc)
+	require.Nil(t, err)
+	require.Equal(t, "a718db5b-6d9e-40a2-a895-4f4505e6f464", posted.Get("authenticationExecution"))
+}
+
+func TestSelectOTPCredential(t *testing.T) {
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("Choose", "Select the OTP device", []string{"Phone", "Tablet"}).Return(1)
+
+	otpForm := url.Values{}
+	selectOTPCredential(otpForm, loadDocument(t, "example/otpdevices.html"))
+	require.Equal(t, "5d3f0f3c-5a2c-4d47-9d0f-7c9d2b2f6e41", otpForm.Get("selectedCredentialId"))
+
+	otpForm = url.Values{}
+	selectOTPCredential(otpForm, loadDocument(t, "example/mfapage.html"))
+	require.Empty(t, otpForm)
+}
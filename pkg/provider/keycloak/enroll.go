@@ -0,0 +1,97 @@
+package keycloak
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/pkg/errors"
+)
+
+// deviceName the name the enrolled authenticator is listed under in the account console of the user
+const deviceName = "saml2alibabacloud"
+
+// EnrollTOTP complete the Configure OTP required action Keycloak asks for after the password, verifying the secret it
+// shows with the code generated from it, the secret is returned
+func (kc *Client) EnrollTOTP(loginDetails *creds.LoginDetails, code func(secret string) (string, error)) (string, error) {
+
+	authSubmitURL, authForm, err := kc.getLoginForm(loginDetails)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login form from idp")
+	}
+
+	data, err := kc.postLoginForm(authSubmitURL, authForm)
+	if err != nil {
+		return "", errors.Wrap(err, "error submitting login form")
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewBuffer(data))
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing document")
+	}
+
+	form := doc.Find("form#kc-totp-settings-form")
+	if form.Length() == 0 {
+		return "", errors.New("Keycloak didn't ask to set up an authenticator, add the Configure OTP required action to the user first")
+	}
+
+	secret := strings.TrimSpace(doc.Find("#kc-totp-secret-key").Text())
+	if secret == "" {
+		return "", errors.New("unable to locate the TOTP secret on the Keycloak setup page")
+	}
+
+	totpCode, err := code(secret)
+	if err != nil {
+		return "", err
+	}
+
+	enrollForm := url.Values{}
+	form.Find("input").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok {
+			return
+		}
+		switch name {
+		case "totp":
+			enrollForm.Set(name, totpCode)
+		case "userLabel":
+			enrollForm.Set(name, deviceName)
+		default:
+			if val, ok := s.Attr("value"); ok {
+				enrollForm.Set(name, val)
+			}
+		}
+	})
+
+	enrollSubmitURL, ok := form.Attr("action")
+	if !ok {
+		return "", errors.New("unable to locate the Keycloak setup form submit URL")
+	}
+
+	req, err := http.NewRequest("POST", enrollSubmitURL, strings.NewReader(enrollForm.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "error building TOTP setup request")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := kc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error submitting TOTP setup form")
+	}
+
+	doc, err = goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading TOTP setup response")
+	}
+
+	// Keycloak shows the setup page again when the code is refused
+	if doc.Find("form#kc-totp-settings-form").Length() != 0 {
+		return "", errors.New("Keycloak refused the TOTP code, check the OTP policy of the realm uses 6 digits, HmacSHA1 and 30 seconds")
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,71 @@
+package keycloak
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/stretchr/testify/require"
+)
+
+func newEnrollServer(t *testing.T, nextPage string) *httptest.Server {
+	loginPage, err := ioutil.ReadFile("example/loginpage.html")
+	require.Nil(t, err)
+	enrollPage, err := ioutil.ReadFile("example/configuretotp.html")
+	require.Nil(t, err)
+	next, err := ioutil.ReadFile(nextPage)
+	require.Nil(t, err)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write(bytes.Replace(loginPage, []byte("https://id.example.com/auth/realms/master/login-actions/authenticate"), []byte("http://"+r.Host+"/authenticate"), 1))
+		case "/authenticate":
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "test123", r.PostForm.Get("password"))
+			w.Write(bytes.Replace(enrollPage, []byte("https://id.example.com/auth/realms/master/login-actions/required-action"), []byte("http://"+r.Host+"/required-action"), 1))
+		case "/required-action":
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "123456", r.PostForm.Get("totp"))
+			require.Equal(t, "12345678901234567890", r.PostForm.Get("totpSecret"))
+			require.Equal(t, "saml2alibabacloud", r.PostForm.Get("userLabel"))
+			w.Write(next)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestClient_EnrollTOTP(t *testing.T) {
+	ts := newEnrollServer(t, "example/assertion.html")
+	defer ts.Close()
+
+	opts := &provider.HTTPClientOptions{IsWithRetries: false}
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}, Options: opts}}
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "test", Password: "test123"}
+
+	var shown string
+	secret, err := kc.EnrollTOTP(loginDetails, func(secret string) (string, error) {
+		shown = secret
+		return "123456", nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, "GEZD GNBV GY3T QOJQ GEZD GNBV GY3T QOJQ", secret)
+	require.Equal(t, secret, shown)
+}
+
+func TestClient_EnrollTOTPRefused(t *testing.T) {
+	ts := newEnrollServer(t, "example/configuretotp.html")
+	defer ts.Close()
+
+	opts := &provider.HTTPClientOptions{IsWithRetries: false}
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}, Options: opts}}
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "test", Password: "test123"}
+
+	_, err := kc.EnrollTOTP(loginDetails, func(secret string) (string, error) { return "123456", nil })
+	require.EqualError(t, err, "Keycloak refused the TOTP code, check the OTP policy of the realm uses 6 digits, HmacSHA1 and 30 seconds")
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
 	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/pkg/errors"
@@ -19,13 +20,15 @@ import (
 
 // Client wrapper around KeyCloak.
 type Client struct {
-	client *provider.HTTPClient
+	client        *provider.HTTPClient
+	authenticator *webauthn.Authenticator
+	mfa           string
 }
 
 // New create a new KeyCloakClient
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewAccountTransport(idpAccount)
 
 	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
@@ -33,7 +36,9 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 	}
 
 	return &Client{
-		client: client,
+		client:        client,
+		authenticator: webauthn.New(),
+		mfa:           idpAccount.MFA,
 	}, nil
 }
 
@@ -58,6 +63,20 @@ func (kc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		return "", errors.Wrap(err, "error parsing document")
 	}
 
+	if kc.shouldTryAnotherWay(doc) {
+		doc, err = kc.tryAnotherWay(doc)
+		if err != nil {
+			return "", errors.Wrap(err, "error posting try another way form")
+		}
+	}
+
+	if containsCredentialChooser(doc) {
+		doc, err = kc.chooseCredential(doc)
+		if err != nil {
+			return "", errors.Wrap(err, "error posting credential chooser form")
+		}
+	}
+
 	if containsTotpForm(doc) {
 		totpSubmitURL, err := extractSubmitURL(doc)
 		if err != nil {
@@ -70,6 +89,13 @@ func (kc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		}
 	}
 
+	if containsWebAuthnForm(doc) {
+		doc, err = kc.postWebAuthnForm(doc)
+		if err != nil {
+			return "", errors.Wrap(err, "error posting webauthn form")
+		}
+	}
+
 	return extractSamlResponse(doc), nil
 }
 
@@ -134,6 +160,9 @@ func (kc *Client) postTotpForm(totpSubmitURL string, mfaToken string, doc *goque
 
 	otpForm := url.Values{}
 
+	// the device is chosen first, the code to type depends on it
+	selectOTPCredential(otpForm, doc)
+
 	if mfaToken == "" {
 		mfaToken = prompter.RequestSecurityCode("000000")
 	}
@@ -0,0 +1,134 @@
+package keycloak
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
+	"github.com/pkg/errors"
+)
+
+// webAuthnOptionRegexp the options the WebAuthn page passes to its javascript, as object properties since Keycloak 21
+// and as variables before
+var webAuthnOptionRegexp = regexp.MustCompile(`\b(challenge|userVerification|rpId|createTimeout|isUserIdentified)\s*[:=]\s*["']?([^"',;\s}]*)["']?`)
+
+// webAuthnOptions the assertion options of the WebAuthn page of Keycloak
+type webAuthnOptions struct {
+	Challenge        string
+	UserVerification string
+	RPID             string
+	Timeout          time.Duration
+	IsUserIdentified bool
+	CredentialIDs    []string
+}
+
+func containsWebAuthnForm(doc *goquery.Document) bool {
+	return doc.Find("form#webauth").Length() > 0
+}
+
+// extractWebAuthnOptions the options of the WebAuthn page, the allowed credentials are those of the user's
+// authenticators, none for passwordless logins which rely on resident keys
+func extractWebAuthnOptions(doc *goquery.Document) *webAuthnOptions {
+	options := &webAuthnOptions{}
+
+	doc.Find("script").Each(func(i int, s *goquery.Selection) {
+		for _, match := range webAuthnOptionRegexp.FindAllStringSubmatch(s.Text(), -1) {
+			switch match[1] {
+			case "challenge":
+				options.Challenge = match[2]
+			case "userVerification":
+				options.UserVerification = match[2]
+			case "rpId":
+				options.RPID = match[2]
+			case "createTimeout":
+				if seconds, err := strconv.Atoi(match[2]); err == nil {
+					options.Timeout = time.Duration(seconds) * time.Second
+				}
+			case "isUserIdentified":
+				options.IsUserIdentified = match[2] == "true"
+			}
+		}
+	})
+
+	doc.Find("form#authn_select input[name=authn_use_chk]").Each(func(i int, s *goquery.Selection) {
+		if id, ok := s.Attr("value"); ok && id != "" {
+			options.CredentialIDs = append(options.CredentialIDs, id)
+		}
+	})
+
+	return options
+}
+
+// postWebAuthnForm sign the challenge of the WebAuthn page with a security key and post the assertion the way the
+// javascript of the page does
+func (kc *Client) postWebAuthnForm(doc *goquery.Document) (*goquery.Document, error) {
+	submitURL, ok := doc.Find("form#webauth").Attr("action")
+	if !ok || submitURL == "" {
+		return nil, errors.New("unable to locate IDP webauthn form submit URL")
+	}
+
+	page, err := url.Parse(submitURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing webauthn form submit URL")
+	}
+
+	options := extractWebAuthnOptions(doc)
+	if options.Challenge == "" {
+		return nil, errors.New("Keycloak did not send a security key challenge")
+	}
+	if !options.IsUserIdentified && len(options.CredentialIDs) == 0 {
+		return nil, errors.New("passwordless logins with a resident key aren't supported, use the WebAuthn authenticator of the realm as a second factor")
+	}
+	if options.RPID == "" {
+		options.RPID = page.Hostname()
+	}
+
+	assertion, err := kc.authenticator.Assert(&webauthn.Request{
+		RPID:             options.RPID,
+		Origin:           page.Scheme + "://" + page.Host,
+		Challenge:        options.Challenge,
+		CredentialIDs:    options.CredentialIDs,
+		Timeout:          options.Timeout,
+		UserVerification: options.UserVerification,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing in with the security key")
+	}
+
+	webAuthnForm := url.Values{}
+	webAuthnForm.Set("clientDataJSON", base64.RawURLEncoding.EncodeToString(assertion.ClientDataJSON))
+	webAuthnForm.Set("authenticatorData", base64.RawURLEncoding.EncodeToString(assertion.AuthenticatorData))
+	webAuthnForm.Set("signature", base64.RawURLEncoding.EncodeToString(assertion.Signature))
+	webAuthnForm.Set("credentialId", assertion.CredentialID)
+	webAuthnForm.Set("userHandle", "")
+	webAuthnForm.Set("error", "")
+
+	req, err := http.NewRequest("POST", submitURL, strings.NewReader(webAuthnForm.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building webauthn request")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := kc.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving content")
+	}
+
+	doc, err = goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading webauthn form response")
+	}
+
+	if containsWebAuthnForm(doc) {
+		return nil, errors.New("Keycloak refused the security key assertion")
+	}
+
+	return doc, nil
+}
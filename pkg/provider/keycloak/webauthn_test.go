@@ -0,0 +1,123 @@
+package keycloak
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	u2fhost "github.com/marshallbrekka/go-u2fhost"
+	"github.com/stretchr/testify/require"
+)
+
+const exampleWebAuthnURL = "https://id.example.com/auth/realms/master/login-actions/authenticate?session_code=Q9aR0aeaA8hP3d3cBBD6iJFKLLKcdsJp5fBqWJWYPnk&amp;execution=4e0dd3d5-0c6f-4b8c-9d4c-b05c3e2c5e2f&amp;client_id=urn%3Aalibaba%3Acloudcomputing&amp;tab_id=dC4Ef2w7vLs"
+
+type mockFinder struct {
+	device u2fhost.Device
+}
+
+func (m *mockFinder) FindDevices() ([]u2fhost.Device, error) {
+	return []u2fhost.Device{m.device}, nil
+}
+
+func TestExtractWebAuthnOptions(t *testing.T) {
+	data, err := ioutil.ReadFile("example/webauthn.html")
+	require.Nil(t, err)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+
+	require.True(t, containsWebAuthnForm(doc))
+	require.Equal(t, &webAuthnOptions{
+		Challenge:        "Y2hhbGxlbmdl",
+		UserVerification: "preferred",
+		RPID:             "id.example.com",
+		IsUserIdentified: true,
+		CredentialIDs:    []string{"a2V5LTE", "a2V5LT_-"},
+	}, extractWebAuthnOptions(doc))
+
+	legacy, err := goquery.NewDocumentFromReader(strings.NewReader(`<script>
+		let challenge = "Y2hhbGxlbmdl";
+		let userVerification = "not specified";
+		let rpId = "";
+		let createTimeout = 60;
+		let isUserIdentified = false;
+	</script>`))
+	require.Nil(t, err)
+	options := extractWebAuthnOptions(legacy)
+	require.Equal(t, "Y2hhbGxlbmdl", options.Challenge)
+	require.Equal(t, 60*time.Second, options.Timeout)
+	require.False(t, options.IsUserIdentified)
+}
+
+func TestClient_postWebAuthnForm(t *testing.T) {
+	data, err := ioutil.ReadFile("example/webauthn.html")
+	require.Nil(t, err)
+
+	assertion, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+		require.Equal(t, "Q9aR0aeaA8hP3d3cBBD6iJFKLLKcdsJp5fBqWJWYPnk", r.URL.Query().Get("session_code"))
+		require.Equal(t, "a2V5LT_-", r.PostForm.Get("credentialId"))
+		require.Equal(t, base64.RawURLEncoding.EncodeToString([]byte("signature")), r.PostForm.Get("signature"))
+		require.Equal(t, base64.RawURLEncoding.EncodeToString([]byte(`{"type":"webauthn.get"}`)), r.PostForm.Get("clientDataJSON"))
+		w.Write(assertion)
+	}))
+	defer ts.Close()
+
+	page := strings.Replace(string(data), "https://id.example.com/auth", ts.URL+"/auth", 1)
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	require.Nil(t, err)
+
+	device := &mocks.U2FDevice{}
+	device.On("Authenticate", &u2fhost.AuthenticateRequest{
+		Challenge: "Y2hhbGxlbmdl",
+		AppId:     "id.example.com",
+		Facet:     ts.URL,
+		KeyHandle: "a2V5LTE",
+		WebAuthn:  true,
+	}).Return(nil, &u2fhost.BadKeyHandleError{})
+	device.On("Authenticate", &u2fhost.AuthenticateRequest{
+		Challenge: "Y2hhbGxlbmdl",
+		AppId:     "id.example.com",
+		Facet:     ts.URL,
+		KeyHandle: "a2V5LT_-",
+		WebAuthn:  true,
+	}).Return(&u2fhost.AuthenticateResponse{
+		KeyHandle:         "a2V5LT_-",
+		ClientData:        base64.RawURLEncoding.EncodeToString([]byte(`{"type":"webauthn.get"}`)),
+		AuthenticatorData: base64.StdEncoding.EncodeToString([]byte("authenticator data")),
+		SignatureData:     base64.StdEncoding.EncodeToString([]byte("signature")),
+	}, nil)
+	device.On("Close").Return()
+
+	opts := &provider.HTTPClientOptions{IsWithRetries: false}
+	kc := Client{
+		client:        &provider.HTTPClient{Client: http.Client{}, Options: opts},
+		authenticator: webauthn.NewWithFinder(&mockFinder{device}),
+	}
+
+	doc, err = kc.postWebAuthnForm(doc)
+	require.Nil(t, err)
+	require.Equal(t, "abc123", extractSamlResponse(doc))
+}
+
+func TestClient_postWebAuthnFormPasswordless(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<form id="webauth" action="` + exampleWebAuthnURL + `" method="post"></form>
+		<script>authenticateByWebAuthn({ isUserIdentified : false, challenge : 'Y2hhbGxlbmdl', userVerification : 'required', rpId : '' });</script>`))
+	require.Nil(t, err)
+
+	kc := Client{}
+	_, err = kc.postWebAuthnForm(doc)
+	require.EqualError(t, err, "passwordless logins with a resident key aren't supported, use the WebAuthn authenticator of the realm as a second factor")
+}
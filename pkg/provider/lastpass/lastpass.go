@@ -0,0 +1,265 @@
+package lastpass
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// maxPushAttempts the number of times the out of band approval is waited for, LastPass holds each request open
+	maxPushAttempts = 10
+
+	causeOutOfBand = "outofbandrequired"
+)
+
+// codeCauses the login errors asking for a code, the grid multifactor included
+var codeCauses = map[string]bool{
+	"googleauthrequired":    true,
+	"microsoftauthrequired": true,
+	"otprequired":           true,
+	"gridrequired":          true,
+	"yubikeyrequired":       true,
+}
+
+var logger = logrus.WithField("provider", "lastpass")
+
+// Client wrapper around LastPass SSO
+type Client struct {
+	client *provider.HTTPClient
+}
+
+// New create a new LastPass client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+	}, nil
+}
+
+// loginResponse the XML answer of login.php, either ok or an error naming what else it needs
+type loginResponse struct {
+	OK *struct {
+		UID string `xml:"uid,attr"`
+	} `xml:"ok"`
+	Error *struct {
+		Message string `xml:"message,attr"`
+		Cause   string `xml:"cause,attr"`
+		RetryID string `xml:"retryid,attr"`
+	} `xml:"error"`
+}
+
+// Authenticate logs into LastPass with the password hashed the way LastPass expects, completing the authenticator,
+// grid or LastPass Authenticator push second factor, and returns the SAML response of the SSO app
+func (lc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	appURL, err := url.Parse(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing SSO app URL")
+	}
+
+	base := fmt.Sprintf("%s://%s", appURL.Scheme, appURL.Host)
+
+	iterations, err := lc.iterations(base, loginDetails.Username)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"method":             {"cli"},
+		"xml":                {"2"},
+		"username":           {loginDetails.Username},
+		"hash":               {loginHash(loginDetails.Username, loginDetails.Password, iterations)},
+		"iterations":         {strconv.Itoa(iterations)},
+		"outofbandsupported": {"1"},
+	}
+
+	resp, err := lc.login(base, form)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Error != nil && codeCauses[resp.Error.Cause] {
+		resp, err = lc.verifyCode(base, form, resp, loginDetails)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if resp.Error != nil && resp.Error.Cause == causeOutOfBand {
+		resp, err = lc.verifyPush(base, form, resp)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if resp.Error != nil {
+		return "", fmt.Errorf("login failed: %s", errorMessage(resp))
+	}
+
+	logger.WithField("uid", resp.OK.UID).Debug("logged in")
+
+	return lc.launch(appURL.String())
+}
+
+// verifyCode send the login again with the code of the authenticator app, YubiKey or grid
+func (lc *Client) verifyCode(base string, form url.Values, resp *loginResponse, loginDetails *creds.LoginDetails) (*loginResponse, error) {
+	logger.WithField("cause", resp.Error.Cause).Debug("verifying second factor")
+
+	code := loginDetails.MFAToken
+	if code == "" {
+		if resp.Error.Message != "" {
+			log.Println(resp.Error.Message)
+		}
+		code = prompter.RequestSecurityCode("000000")
+	}
+
+	form.Set("otp", code)
+
+	return lc.login(base, form)
+}
+
+// verifyPush wait for the user to approve the login in LastPass Authenticator
+func (lc *Client) verifyPush(base string, form url.Values, resp *loginResponse) (*loginResponse, error) {
+	log.Println("Waiting for approval, please check LastPass Authenticator on your phone")
+
+	form.Set("outofbandrequest", "1")
+
+	for attempt := 0; attempt < maxPushAttempts; attempt++ {
+		if resp.Error.RetryID != "" {
+			form.Set("outofbandretry", "1")
+			form.Set("outofbandretryid", resp.Error.RetryID)
+		}
+
+		var err error
+		resp, err = lc.login(base, form)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Error == nil || resp.Error.Cause != causeOutOfBand {
+			return resp, nil
+		}
+	}
+
+	return nil, errors.New("timed out waiting for the LastPass Authenticator approval")
+}
+
+func (lc *Client) iterations(base, username string) (int, error) {
+	res, err := lc.postForm(base+"/iterations.php", url.Values{"email": {username}})
+	if err != nil {
+		return 0, errors.Wrap(err, "error retrieving password iterations")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, errors.Wrap(err, "error retrieving body")
+	}
+
+	iterations, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, errors.Wrap(err, "error parsing password iterations")
+	}
+
+	return iterations, nil
+}
+
+func (lc *Client) login(base string, form url.Values) (*loginResponse, error) {
+	res, err := lc.postForm(base+"/login.php", form)
+	if err != nil {
+		return nil, errors.Wrap(err, "error logging in")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving body")
+	}
+
+	resp := &loginResponse{}
+	if err := xml.Unmarshal(body, resp); err != nil {
+		return nil, errors.Wrap(err, "error parsing login response")
+	}
+
+	if resp.OK == nil && resp.Error == nil {
+		return nil, fmt.Errorf("unexpected LastPass login response: %s", res.Status)
+	}
+
+	return resp, nil
+}
+
+func (lc *Client) postForm(location string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequest("POST", location, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	return lc.client.Do(req)
+}
+
+// launch open the SSO app with the LastPass session, which answers with the SAML response
+func (lc *Client) launch(appURL string) (string, error) {
+	res, err := lc.client.Get(appURL)
+	if err != nil {
+		return "", errors.Wrap(err, "error launching SSO app")
+	}
+
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build document from response")
+	}
+
+	samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
+	if !ok {
+		return "", errors.New("no SAML response returned by LastPass, check the SSO app URL and that the user is assigned to it")
+	}
+
+	return samlAssertion, nil
+}
+
+// loginHash the hash sent in place of the password, derived from the vault key so the password never leaves the
+// machine, a single iteration is the legacy scheme of old accounts
+func loginHash(username, password string, iterations int) string {
+	username = strings.ToLower(strings.TrimSpace(username))
+
+	if iterations <= 1 {
+		key := sha256.Sum256([]byte(username + password))
+		hash := sha256.Sum256([]byte(hex.EncodeToString(key[:]) + password))
+		return hex.EncodeToString(hash[:])
+	}
+
+	key := pbkdf2.Key([]byte(password), []byte(username), iterations, 32, sha256.New)
+	return hex.EncodeToString(pbkdf2.Key(key, []byte(password), 1, 32, sha256.New))
+}
+
+func errorMessage(resp *loginResponse) string {
+	if resp.Error.Message != "" {
+		return resp.Error.Message
+	}
+	return resp.Error.Cause
+}
@@ -0,0 +1,182 @@
+package lastpass
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+const appPath = "/saml/launch/cp/1234567"
+
+func TestLoginHash(t *testing.T) {
+	require.Equal(t, "c7926fec9eb35adf4e73a45763bc4e7defdf52a5b2eb0305ca8a8bb40ec7f03c", loginHash("User@Example.com", "secret", 100100))
+	require.Equal(t, "b1674e95fa55536535e3ccd03d29a4d490fab9c48f906e3676c6a5184791eb2b", loginHash("user@example.com", "secret", 1))
+}
+
+func TestAuthenticateOTP(t *testing.T) {
+	otpRequired, err := ioutil.ReadFile("example/otp_required.xml")
+	require.Nil(t, err)
+	ok, err := ioutil.ReadFile("example/ok.xml")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/iterations.php":
+			require.Equal(t, "user@example.com", r.PostForm.Get("email"))
+			w.Write([]byte("100100"))
+		case "/login.php":
+			require.Equal(t, "100100", r.PostForm.Get("iterations"))
+			require.Equal(t, "c7926fec9eb35adf4e73a45763bc4e7defdf52a5b2eb0305ca8a8bb40ec7f03c", r.PostForm.Get("hash"))
+			switch r.PostForm.Get("otp") {
+			case "":
+				w.Write(otpRequired)
+			case "123456":
+				http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "session-1234", Path: "/"})
+				w.Write(ok)
+			default:
+				w.Write([]byte(`<response><error message="Google Authenticator authentication failed!" cause="googleauthfailed" /></response>`))
+			}
+		case appPath:
+			if _, err := r.Cookie("PHPSESSID"); err != nil {
+				http.Redirect(w, r, "/?ac=1", http.StatusFound)
+				return
+			}
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + appPath,
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadOTP(t *testing.T) {
+	otpRequired, err := ioutil.ReadFile("example/otp_required.xml")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/iterations.php":
+			w.Write([]byte("100100"))
+		case "/login.php":
+			if r.PostForm.Get("otp") == "" {
+				w.Write(otpRequired)
+				return
+			}
+			w.Write([]byte(`<response><error message="Google Authenticator authentication failed!" cause="googleauthfailed" /></response>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + appPath,
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "000000",
+	})
+	require.EqualError(t, err, "login failed: Google Authenticator authentication failed!")
+}
+
+func TestAuthenticatePush(t *testing.T) {
+	pushRequired, err := ioutil.ReadFile("example/push_required.xml")
+	require.Nil(t, err)
+	ok, err := ioutil.ReadFile("example/ok.xml")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	pushPolls := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/iterations.php":
+			w.Write([]byte("100100"))
+		case "/login.php":
+			switch {
+			case r.PostForm.Get("outofbandrequest") == "":
+				w.Write(pushRequired)
+			case pushPolls == 0:
+				require.Equal(t, "retry-1234", r.PostForm.Get("outofbandretryid"))
+				pushPolls++
+				w.Write(pushRequired)
+			default:
+				http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "session-1234", Path: "/"})
+				w.Write(ok)
+			}
+		case appPath:
+			if _, err := r.Cookie("PHPSESSID"); err != nil {
+				http.Redirect(w, r, "/?ac=1", http.StatusFound)
+				return
+			}
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + appPath,
+		Username: "user@example.com",
+		Password: "secret",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.Equal(t, 1, pushPolls)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/iterations.php":
+			w.Write([]byte("100100"))
+		case "/login.php":
+			w.Write([]byte(`<response><error message="Invalid password!" cause="unknownpassword" /></response>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + appPath,
+		Username: "user@example.com",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "login failed: Invalid password!")
+}
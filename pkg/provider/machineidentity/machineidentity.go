@@ -0,0 +1,273 @@
+package machineidentity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+var logger = logrus.WithField("provider", "machineidentity")
+
+// clientAssertionType the OAuth 2.0 client authentication with a signed JWT, RFC 7523
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// assertionLifetime how long the client assertion is valid, the token endpoint is called right away
+const assertionLifetime = 5 * time.Minute
+
+// Client authenticate an unattended machine with its certificate, to the url directly through TLS client
+// authentication, or with an access token obtained with the client credentials grant and a private key JWT
+type Client struct {
+	client     *provider.HTTPClient
+	idpAccount *cfg.IDPAccount
+	cert       tls.Certificate
+}
+
+// New create a machine identity client, client_cert and its key are required
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+	certs, err := provider.AccountCertificates(idpAccount)
+	if err != nil {
+		return nil, err
+	}
+	if certs == nil {
+		return nil, errors.New("the machine identity needs client_cert and client_key")
+	}
+
+	tr, err := provider.NewClientCertTransport(idpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client:     client,
+		idpAccount: idpAccount,
+		cert:       certs[0],
+	}, nil
+}
+
+// Authenticate get the SAML assertion minted by the url for the machine
+func (mc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+	req, err := http.NewRequest("GET", loginDetails.URL, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error building assertion request")
+	}
+	req.Header.Set("Accept", "application/json, text/html")
+
+	if tokenURL := mc.tokenURL(); tokenURL != "" {
+		token, err := mc.accessToken(tokenURL)
+		if err != nil {
+			return "", errors.Wrap(err, "error getting the access token of the machine")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := mc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving the assertion")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("the assertion was refused, %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	return extractAssertion(body)
+}
+
+// tokenURL the token endpoint of token_url, or of the AzureAD tenant when only tenant_id is set, none when the url
+// authenticates the certificate itself
+func (mc *Client) tokenURL() string {
+	if mc.idpAccount.TokenURL != "" {
+		return mc.idpAccount.TokenURL
+	}
+	if mc.idpAccount.TenantID != "" {
+		return fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", url.PathEscape(mc.idpAccount.TenantID))
+	}
+	return ""
+}
+
+// accessToken get a token for token_scope with the client credentials grant, the client app_id authenticating with
+// an assertion signed by the key of client_cert
+func (mc *Client) accessToken(tokenURL string) (string, error) {
+	if mc.idpAccount.AppID == "" {
+		return "", errors.New("app_id must be set to the client ID of the machine")
+	}
+	if mc.idpAccount.TokenScope == "" {
+		return "", errors.New("token_scope must be set to the scope of the service minting the assertion")
+	}
+
+	assertion, err := clientAssertion(mc.cert, mc.idpAccount.AppID, tokenURL, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", mc.idpAccount.AppID)
+	form.Set("client_assertion_type", clientAssertionType)
+	form.Set("client_assertion", assertion)
+	form.Set("scope", mc.idpAccount.TokenScope)
+
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "error building token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := mc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error requesting the access token")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+
+	token := gjson.GetBytes(body, "access_token").String()
+	if res.StatusCode != http.StatusOK || token == "" {
+		if description := gjson.GetBytes(body, "error_description").String(); description != "" {
+			return "", errors.Errorf("the token endpoint refused the machine: %s", description)
+		}
+		return "", errors.Errorf("the token endpoint refused the machine, %s", res.Status)
+	}
+
+	logger.WithField("expires_in", gjson.GetBytes(body, "expires_in").Int()).Debug("got access token")
+	return token, nil
+}
+
+// clientAssertion the JWT authenticating the client, signed with the key of the certificate whose thumbprint is in
+// the header as the Microsoft identity platform expects
+func clientAssertion(cert tls.Certificate, clientID, audience string, now time.Time) (string, error) {
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok || len(cert.Certificate) == 0 {
+		return "", errors.New("the key of client_cert can't sign")
+	}
+
+	var alg string
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		alg = "RS256"
+	case *ecdsa.PublicKey:
+		alg = "ES256"
+	default:
+		return "", errors.New("the key of client_cert must be RSA or ECDSA")
+	}
+
+	thumbprint := sha1.Sum(cert.Certificate[0])
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", errors.Wrap(err, "error generating the assertion ID")
+	}
+
+	header, err := json.Marshal(map[string]string{
+		"alg": alg,
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": audience,
+		"iss": clientID,
+		"sub": clientID,
+		"jti": hex.EncodeToString(jti),
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"exp": now.Add(assertionLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch key := signer.(type) {
+	case *ecdsa.PrivateKey:
+		// JWS wants the raw r and s, not the ASN.1 encoding
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return "", errors.Wrap(err, "error signing the client assertion")
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature = append(padded(r, size), padded(s, size)...)
+	default:
+		signature, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return "", errors.Wrap(err, "error signing the client assertion")
+		}
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func padded(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// extractAssertion the SAMLResponse of the answer of the url, a JSON object, the form posting it to Alibaba Cloud or
+// the base64 assertion alone like the Shell provider
+func extractAssertion(body []byte) (string, error) {
+	if raw := strings.TrimSpace(string(body)); raw != "" {
+		if _, err := base64.StdEncoding.DecodeString(raw); err == nil {
+			return raw, nil
+		}
+	}
+
+	if gjson.ValidBytes(body) {
+		for _, field := range []string{"SAMLResponse", "saml_response", "assertion"} {
+			if assertion := gjson.GetBytes(body, field).String(); assertion != "" {
+				return assertion, nil
+			}
+		}
+		return "", errors.New("no SAMLResponse in the answer of the url")
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build document from response")
+	}
+	assertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
+	if !ok || assertion == "" {
+		return "", errors.New("no SAMLResponse in the answer of the url")
+	}
+	return assertion, nil
+}
@@ -0,0 +1,155 @@
+package machineidentity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+// writeMachineCertificate write a self signed certificate of the machine and its key to dir
+func writeMachineCertificate(t *testing.T, dir string) (string, string, *ecdsa.PublicKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "build-runner-01"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	certFile := filepath.Join(dir, "machine.crt")
+	keyFile := filepath.Join(dir, "machine.key")
+	require.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certFile, keyFile, &key.PublicKey
+}
+
+// verifyES256 check the signature of the client assertion with the key of the machine
+func verifyES256(t *testing.T, jwt string, pub *ecdsa.PublicKey) string {
+	parts := strings.Split(jwt, ".")
+	require.Len(t, parts, 3)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.Nil(t, err)
+	require.Len(t, signature, 64)
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	require.True(t, ecdsa.Verify(pub, digest[:], r, s))
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	require.Nil(t, err)
+	require.Equal(t, "ES256", gjson.GetBytes(header, "alg").String())
+	require.NotEmpty(t, gjson.GetBytes(header, "x5t").String())
+
+	claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.Nil(t, err)
+	return string(claims)
+}
+
+func TestAuthenticateWithClientCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machineidentity")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile, pub := writeMachineCertificate(t, dir)
+
+	var ts *httptest.Server
+	ts = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/v2.0/token":
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+			require.Equal(t, "machine-client", r.PostForm.Get("client_id"))
+			require.Equal(t, clientAssertionType, r.PostForm.Get("client_assertion_type"))
+			require.Equal(t, "api://saml-minter/.default", r.PostForm.Get("scope"))
+
+			claims := verifyES256(t, r.PostForm.Get("client_assertion"), pub)
+			require.Equal(t, ts.URL+"/oauth2/v2.0/token", gjson.Get(claims, "aud").String())
+			require.Equal(t, "machine-client", gjson.Get(claims, "sub").String())
+
+			w.Write([]byte(`{"token_type":"Bearer","expires_in":3599,"access_token":"machine-token"}`))
+		case "/assertion":
+			if r.Header.Get("Authorization") != "Bearer machine-token" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			require.Equal(t, "build-runner-01", r.TLS.PeerCertificates[0].Subject.CommonName)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"SAMLResponse":"PHNhbWw+"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	idpAccount := &cfg.IDPAccount{
+		URL:        ts.URL + "/assertion",
+		SkipVerify: true,
+		ClientCert: certFile,
+		ClientKey:  keyFile,
+		AppID:      "machine-client",
+		TokenURL:   ts.URL + "/oauth2/v2.0/token",
+		TokenScope: "api://saml-minter/.default",
+	}
+
+	client, err := New(idpAccount)
+	require.Nil(t, err)
+
+	assertion, err := client.Authenticate(&creds.LoginDetails{URL: idpAccount.URL})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWw+", assertion)
+
+	// without a token the certificate alone isn't enough for this service
+	idpAccount.TokenURL = ""
+	client, err = New(idpAccount)
+	require.Nil(t, err)
+	_, err = client.Authenticate(&creds.LoginDetails{URL: idpAccount.URL})
+	require.EqualError(t, err, "the assertion was refused, 401 Unauthorized: unauthorized")
+
+	_, err = New(&cfg.IDPAccount{URL: ts.URL})
+	require.EqualError(t, err, "the machine identity needs client_cert and client_key")
+}
+
+func TestExtractAssertion(t *testing.T) {
+	assertion, err := extractAssertion([]byte(`<html><body><form method="post" action="https://signin.aliyun.com/saml-role/sso"><input type="hidden" name="SAMLResponse" value="PHNhbWw+"/></form></body></html>`))
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWw+", assertion)
+
+	assertion, err = extractAssertion([]byte("PHNhbWw+\n"))
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWw+", assertion)
+
+	_, err = extractAssertion([]byte(`{"error":"denied"}`))
+	require.EqualError(t, err, "no SAMLResponse in the answer of the url")
+}
@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/idn"
+)
+
+const (
+	// DefaultMaintenanceWindow how long a login waits for an IdP showing a maintenance page to come back
+	DefaultMaintenanceWindow = 2 * time.Minute
+
+	// maxMaintenanceInspect the number of body bytes inspected for maintenance markers
+	maxMaintenanceInspect = 64 * 1024
+)
+
+// maintenanceRetryInterval delay between attempts while the IdP is in maintenance, replaced in tests
+var maintenanceRetryInterval = 15 * time.Second
+
+var (
+	titleRegexp = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+	// maintenanceTitles phrases used by outage and maintenance interstitials in the page title
+	maintenanceTitles = []string{
+		"maintenance",
+		"service unavailable",
+		"temporarily unavailable",
+		"we'll be back",
+		"we will be back",
+		"site is down",
+	}
+
+	// maintenanceMarkers error codes identifying outage pages wherever they appear in the body
+	maintenanceMarkers = []string{
+		"AADSTS90033", // AzureAD: a transient error has occurred
+		"AADSTS90036", // AzureAD: an unexpected, non-retryable error, shown during service incidents
+	}
+)
+
+// MaintenanceError returned when the IdP keeps answering with a maintenance page for the whole retry window
+type MaintenanceError struct {
+	URL    string
+	Status string
+	Waited time.Duration
+}
+
+func (e *MaintenanceError) Error() string {
+	if e.Waited > 0 {
+		return fmt.Sprintf("identity provider at %s appears to be down for maintenance (status: %s), still unavailable after waiting %v, try again later", e.URL, e.Status, e.Waited)
+	}
+	return fmt.Sprintf("identity provider at %s appears to be down for maintenance (status: %s), try again later", e.URL, e.Status)
+}
+
+// IsMaintenancePage check whether the response is an outage or maintenance interstitial rather than a page of the
+// login flow. The body is inspected and restored so the response can still be read by the caller.
+func IsMaintenancePage(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		return true
+	}
+
+	if resp.StatusCode != http.StatusOK || resp.Body == nil {
+		return false
+	}
+
+	if !strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+		return false
+	}
+
+	head, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxMaintenanceInspect))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	if err != nil {
+		return false
+	}
+
+	for _, marker := range maintenanceMarkers {
+		if bytes.Contains(head, []byte(marker)) {
+			return true
+		}
+	}
+
+	match := titleRegexp.FindSubmatch(head)
+	if match == nil {
+		return false
+	}
+
+	title := strings.ToLower(string(match[1]))
+	for _, phrase := range maintenanceTitles {
+		if strings.Contains(title, phrase) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// waitOutMaintenance retry the request while the IdP answers with a maintenance page, up to the configured window
+func (hc *HTTPClient) waitOutMaintenance(req *http.Request, resp *http.Response) (*http.Response, error) {
+	window := DefaultMaintenanceWindow
+	if hc.Options != nil && hc.Options.MaintenanceWindow != 0 {
+		window = hc.Options.MaintenanceWindow
+	}
+
+	start := time.Now()
+
+	for IsMaintenancePage(resp) {
+		waited := time.Since(start)
+
+		// requests with a body which can't be replayed are only attempted once
+		if window < 0 || waited+maintenanceRetryInterval > window || (req.Body != nil && req.GetBody == nil) {
+			return resp, &MaintenanceError{URL: req.URL.Host, Status: resp.Status, Waited: waited}
+		}
+
+		log.Printf("%s appears to be down for maintenance (status: %s), retrying in %v", idn.Display(req.URL.Host), resp.Status, maintenanceRetryInterval)
+		resp.Body.Close()
+
+		if err := hc.Sleep(maintenanceRetryInterval); err != nil {
+			return nil, err
+		}
+
+		var err error
+		resp, err = hc.resend(req)
+		if err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, nil
+}
+
+// resend send the request again, replaying its body
+func (hc *HTTPClient) resend(req *http.Request) (*http.Response, error) {
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+
+	return hc.send(req)
+}
@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsMaintenancePage(t *testing.T) {
+	page := func(status int, contentType, body string) *http.Response {
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": []string{contentType}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}
+	}
+
+	require.True(t, IsMaintenancePage(page(503, "text/plain", "")))
+	require.True(t, IsMaintenancePage(page(200, "text/html; charset=utf-8", "<html><head><title>Okta - Scheduled Maintenance</title></head></html>")))
+	require.True(t, IsMaintenancePage(page(200, "text/html", "<html><body>AADSTS90033: A transient error has occurred.</body></html>")))
+	require.False(t, IsMaintenancePage(page(200, "text/html", "<html><head><title>Sign In</title></head><body>Maintenance is planned on Sunday</body></html>")))
+	require.False(t, IsMaintenancePage(page(200, "application/json", `{"title":"maintenance"}`)))
+	require.False(t, IsMaintenancePage(page(500, "text/html", "<title>Service Unavailable</title>")))
+
+	resp := page(200, "text/html", "<html><head><title>Sign In</title></head></html>")
+	require.False(t, IsMaintenancePage(resp))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "<html><head><title>Sign In</title></head></html>", string(body))
+}
+
+func TestClientWaitsOutMaintenance(t *testing.T) {
+	maintenanceRetryInterval = 10 * time.Millisecond
+	defer func() { maintenanceRetryInterval = 15 * time.Second }()
+
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		require.Equal(t, "username=user", string(body))
+
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+
+	hc, err := NewHTTPClient(NewDefaultTransport(false), &HTTPClientOptions{})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest("POST", ts.URL, strings.NewReader("username=user"))
+	require.Nil(t, err)
+
+	res, err := hc.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	require.Equal(t, 3, attempts)
+}
+
+func TestClientMaintenanceWindow(t *testing.T) {
+	maintenanceRetryInterval = 10 * time.Millisecond
+	defer func() { maintenanceRetryInterval = 15 * time.Second }()
+
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	hc, err := NewHTTPClient(NewDefaultTransport(false), &HTTPClientOptions{MaintenanceWindow: 35 * time.Millisecond})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	require.Nil(t, err)
+
+	_, err = hc.Do(req)
+	require.IsType(t, &MaintenanceError{}, err)
+	require.True(t, attempts > 1 && attempts <= 4)
+
+	attempts = 0
+	hc.Options.MaintenanceWindow = -1
+
+	_, err = hc.Do(req)
+	require.IsType(t, &MaintenanceError{}, err)
+	require.Equal(t, 1, attempts)
+}
@@ -26,7 +26,7 @@ type Client struct {
 
 // New creates a new external client
 func New(idpAccount *cfg.IDPAccount, mfa string) (*Client, error) {
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewAccountTransport(idpAccount)
 	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
 		return nil, errors.Wrap(err, "Error building HTTP client")
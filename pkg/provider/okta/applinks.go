@@ -0,0 +1,111 @@
+package okta
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// appLink an app assigned to the user, as listed on the Okta dashboard
+type appLink struct {
+	Label   string
+	AppName string
+	LinkURL string
+}
+
+// isOrgURL check whether the URL is the Okta org rather than the embed link of an app
+func isOrgURL(u *url.URL) bool {
+	return strings.Trim(u.Path, "/") == ""
+}
+
+// discoverApp open an Okta session with the session token, then look up the app with the label among the apps
+// assigned to the user and return its embed link
+func (oc *Client) discoverApp(orgURL *url.URL, sessionToken, label string) (string, error) {
+	org := &url.URL{Scheme: orgURL.Scheme, Host: orgURL.Host, Path: "/"}
+
+	req, err := http.NewRequest("GET", org.ResolveReference(&url.URL{Path: "/login/sessionCookieRedirect"}).String(), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error building session request")
+	}
+	q := req.URL.Query()
+	q.Add("token", sessionToken)
+	q.Add("redirectUrl", org.String())
+	req.URL.RawQuery = q.Encode()
+
+	res, err := oc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error opening Okta session")
+	}
+	res.Body.Close()
+
+	req, err = http.NewRequest("GET", org.ResolveReference(&url.URL{Path: "/api/v1/users/me/appLinks"}).String(), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error building app links request")
+	}
+	req.Header.Add("Accept", "application/json")
+
+	res, err = oc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving app links")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+
+	link, err := matchAppLink(parseAppLinks(body), label)
+	if err != nil {
+		return "", err
+	}
+
+	logger.WithField("label", link.Label).WithField("appName", link.AppName).WithField("url", link.LinkURL).Debug("app discovered")
+
+	return link.LinkURL, nil
+}
+
+func parseAppLinks(body []byte) []appLink {
+	var links []appLink
+
+	gjson.ParseBytes(body).ForEach(func(_, value gjson.Result) bool {
+		links = append(links, appLink{
+			Label:   value.Get("label").String(),
+			AppName: value.Get("appName").String(),
+			LinkURL: value.Get("linkUrl").String(),
+		})
+		return true
+	})
+
+	return links
+}
+
+// matchAppLink find the app with the label, ignoring case, several apps sharing it make the label ambiguous
+func matchAppLink(links []appLink, label string) (appLink, error) {
+	var matches []appLink
+	var labels []string
+
+	for _, link := range links {
+		if strings.EqualFold(strings.TrimSpace(link.Label), strings.TrimSpace(label)) {
+			matches = append(matches, link)
+		}
+		labels = append(labels, link.Label)
+	}
+
+	switch len(matches) {
+	case 0:
+		if len(labels) == 0 {
+			return appLink{}, fmt.Errorf("app %s not found, no apps are assigned to the user", label)
+		}
+		return appLink{}, fmt.Errorf("app %s not found, choose one of: %s", label, strings.Join(labels, ", "))
+	case 1:
+		return matches[0], nil
+	}
+
+	return appLink{}, fmt.Errorf("app label %s is shared by %d apps, set url to the embed link of the app", label, len(matches))
+}
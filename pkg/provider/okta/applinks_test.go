@@ -0,0 +1,78 @@
+package okta
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/stretchr/testify/assert"
+)
+
+const appLinksResponse = `[
+  {"label":"Alibaba Cloud Production","appName":"alibabacloud","linkUrl":"https://example.okta.com/home/alibabacloud/0oa1/272","sortOrder":0},
+  {"label":"Alibaba Cloud Staging","appName":"alibabacloud","linkUrl":"https://example.okta.com/home/alibabacloud/0oa2/272","sortOrder":1},
+  {"label":"Expenses","appName":"example_expenses","linkUrl":"https://example.okta.com/home/example_expenses/0oa3/2","sortOrder":2}
+]`
+
+func TestIsOrgURL(t *testing.T) {
+	for rawURL, org := range map[string]bool{
+		"https://example.okta.com":                            true,
+		"https://example.okta.com/":                           true,
+		"https://example.okta.com/home/alibabacloud/0oa1/272": false,
+	} {
+		u, err := url.Parse(rawURL)
+		assert.Nil(t, err)
+		assert.Equal(t, org, isOrgURL(u), rawURL)
+	}
+}
+
+func TestDiscoverApp(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/sessionCookieRedirect":
+			assert.Equal(t, "session-token", r.URL.Query().Get("token"))
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "session", Path: "/"})
+			http.Redirect(w, r, r.URL.Query().Get("redirectUrl"), http.StatusFound)
+		case "/":
+			fmt.Fprint(w, "<html><body>dashboard</body></html>")
+		case "/api/v1/users/me/appLinks":
+			if cookie, err := r.Cookie("sid"); err != nil || cookie.Value != "session" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, appLinksResponse)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	oc, err := New(&cfg.IDPAccount{AppLabel: "alibaba cloud staging"})
+	assert.Nil(t, err)
+
+	orgURL, err := url.Parse(ts.URL)
+	assert.Nil(t, err)
+
+	appURL, err := oc.discoverApp(orgURL, "session-token", oc.appLabel)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.okta.com/home/alibabacloud/0oa2/272", appURL)
+}
+
+func TestMatchAppLink(t *testing.T) {
+	links := parseAppLinks([]byte(appLinksResponse))
+	assert.Len(t, links, 3)
+
+	_, err := matchAppLink(links, "Alibaba Cloud Dev")
+	assert.EqualError(t, err, "app Alibaba Cloud Dev not found, choose one of: Alibaba Cloud Production, Alibaba Cloud Staging, Expenses")
+
+	_, err = matchAppLink(nil, "Alibaba Cloud Dev")
+	assert.EqualError(t, err, "app Alibaba Cloud Dev not found, no apps are assigned to the user")
+
+	links = append(links, appLink{Label: "Expenses", AppName: "example_expenses", LinkURL: "https://example.okta.com/home/example_expenses/0oa4/2"})
+
+	_, err = matchAppLink(links, "Expenses")
+	assert.EqualError(t, err, "app label Expenses is shared by 2 apps, set url to the embed link of the app")
+}
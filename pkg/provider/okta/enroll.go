@@ -0,0 +1,125 @@
+package okta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// totpFactorType the Okta factor type of authenticator apps
+const totpFactorType = "token:software:totp"
+
+// EnrollRequest represents a factor enroll request
+type EnrollRequest struct {
+	StateToken string `json:"stateToken"`
+	FactorType string `json:"factorType"`
+	Provider   string `json:"provider"`
+}
+
+// EnrollTOTP enroll a Google Authenticator factor, or an Okta Verify one when the policy only allows that, during a
+// login the enrollment policy requires a factor for, activating it with the code generated from its secret, the secret
+// is returned
+func (oc *Client) EnrollTOTP(loginDetails *creds.LoginDetails, code func(secret string) (string, error)) (string, error) {
+
+	oktaURL, err := url.Parse(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error building oktaURL")
+	}
+
+	base := fmt.Sprintf("%s://%s", oktaURL.Scheme, oktaURL.Host)
+
+	resp, err := oc.postJSON(base+"/api/v1/authn", AuthRequest{Username: loginDetails.Username, Password: loginDetails.Password})
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving auth response")
+	}
+
+	if status := gjson.Get(resp, "status").String(); status != "MFA_ENROLL" {
+		return "", fmt.Errorf("Okta only offers to enroll a factor when the enrollment policy requires one at login, the login returned %s, reset the factors of the user first", status)
+	}
+
+	stateToken := gjson.Get(resp, "stateToken").String()
+
+	enrollReq, ok := selectTOTPFactor(stateToken, gjson.Get(resp, "_embedded.factors").Array())
+	if !ok {
+		return "", errors.New("the Okta enrollment policy doesn't offer an authenticator app factor")
+	}
+
+	logger.WithField("provider", enrollReq.Provider).Debug("enrolling TOTP factor")
+
+	resp, err = oc.postJSON(base+"/api/v1/authn/factors", enrollReq)
+	if err != nil {
+		return "", errors.Wrap(err, "error enrolling TOTP factor")
+	}
+
+	secret := gjson.Get(resp, "_embedded.factor._embedded.activation.sharedSecret").String()
+	activateURL := gjson.Get(resp, "_links.next.href").String()
+	if secret == "" || activateURL == "" {
+		return "", fmt.Errorf("unexpected Okta enrollment status: %s", gjson.Get(resp, "status").String())
+	}
+
+	passCode, err := code(secret)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err = oc.postJSON(activateURL, VerifyRequest{StateToken: stateToken, PassCode: passCode})
+	if err != nil {
+		return "", errors.Wrap(err, "error activating TOTP factor, check the clock of this machine")
+	}
+
+	if status := gjson.Get(resp, "status").String(); status != "SUCCESS" {
+		return "", fmt.Errorf("unexpected Okta activation status: %s", status)
+	}
+
+	return secret, nil
+}
+
+// selectTOTPFactor the enroll request of the authenticator app factor, Google Authenticator preferred
+func selectTOTPFactor(stateToken string, factors []gjson.Result) (EnrollRequest, bool) {
+	var enrollReq EnrollRequest
+	for _, factor := range factors {
+		if factor.Get("factorType").String() != totpFactorType {
+			continue
+		}
+		enrollReq = EnrollRequest{StateToken: stateToken, FactorType: totpFactorType, Provider: factor.Get("provider").String()}
+		if enrollReq.Provider == "GOOGLE" {
+			break
+		}
+	}
+	return enrollReq, enrollReq.Provider != ""
+}
+
+func (oc *Client) postJSON(location string, body interface{}) (string, error) {
+	data := new(bytes.Buffer)
+	if err := json.NewEncoder(data).Encode(body); err != nil {
+		return "", errors.Wrap(err, "error encoding request")
+	}
+
+	req, err := http.NewRequest("POST", location, data)
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	res, err := oc.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+
+	return string(resBody), nil
+}
@@ -0,0 +1,75 @@
+package okta
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrollTOTP(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+
+		switch r.URL.Path {
+		case "/api/v1/authn":
+			assert.Equal(t, "wile", body["username"])
+			fmt.Fprint(w, `{"status":"MFA_ENROLL","stateToken":"state-token","_embedded":{"factors":[
+				{"factorType":"push","provider":"OKTA"},
+				{"factorType":"token:software:totp","provider":"OKTA"},
+				{"factorType":"token:software:totp","provider":"GOOGLE"}]}}`)
+		case "/api/v1/authn/factors":
+			assert.Equal(t, "state-token", body["stateToken"])
+			assert.Equal(t, "token:software:totp", body["factorType"])
+			assert.Equal(t, "GOOGLE", body["provider"])
+			fmt.Fprintf(w, `{"status":"MFA_ENROLL_ACTIVATE","stateToken":"state-token",
+				"_embedded":{"factor":{"id":"uft1","_embedded":{"activation":{"sharedSecret":"GEZDGNBVGY3TQOJQ"}}}},
+				"_links":{"next":{"name":"activate","href":"%s/api/v1/authn/factors/uft1/lifecycle/activate"}}}`, ts.URL)
+		case "/api/v1/authn/factors/uft1/lifecycle/activate":
+			if body["passCode"] != "123456" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"errorCode":"E0000068","errorSummary":"Invalid Passcode/Answer"}`)
+				return
+			}
+			fmt.Fprint(w, `{"status":"SUCCESS","sessionToken":"session-token"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	oc, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	assert.Nil(t, err)
+
+	loginDetails := &creds.LoginDetails{URL: ts.URL + "/home/alibabacloud/0oa1/272", Username: "wile", Password: "secret"}
+
+	secret, err := oc.EnrollTOTP(loginDetails, func(secret string) (string, error) {
+		assert.Equal(t, "GEZDGNBVGY3TQOJQ", secret)
+		return "123456", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQ", secret)
+
+	_, err = oc.EnrollTOTP(loginDetails, func(secret string) (string, error) { return "000000", nil })
+	assert.Contains(t, err.Error(), "error activating TOTP factor, check the clock of this machine")
+}
+
+func TestEnrollTOTPNotRequired(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"MFA_REQUIRED","stateToken":"state-token"}`)
+	}))
+	defer ts.Close()
+
+	oc, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	assert.Nil(t, err)
+
+	_, err = oc.EnrollTOTP(&creds.LoginDetails{URL: ts.URL, Username: "wile", Password: "secret"}, nil)
+	assert.EqualError(t, err, "Okta only offers to enroll a factor when the enrollment policy requires one at login, the login returned MFA_REQUIRED, reset the factors of the user first")
+}
@@ -0,0 +1,274 @@
+package okta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// idxAccept the media type of the Okta Identity Engine API
+	idxAccept = "application/ion+json; okta-version=1.0.0"
+
+	// maxIdxSteps the number of remediations gone through before giving up
+	maxIdxSteps = 10
+
+	// maxFastPassPolls the number of times the FastPass challenge is polled before giving up
+	maxFastPassPolls = 60
+
+	// signedNonce the method of Okta Verify used by FastPass
+	signedNonce = "signed_nonce"
+)
+
+// loopbackChallengeTimeout how long Okta Verify is given to sign the challenge, it may ask for a biometric first
+var loopbackChallengeTimeout = 2 * time.Minute
+
+// isIdentityEngine whether the page is the sign-in widget of an Okta Identity Engine org, which is bootstrapped from
+// the Identity Engine API rather than the authentication API
+func isIdentityEngine(body string) bool {
+	return strings.Contains(body, "/idp/idx/")
+}
+
+// orgBaseURL the scheme and host of the Okta org
+func orgBaseURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing url")
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// identityEngine carry on the login in an Okta Identity Engine org from the state token of its sign-in page,
+// completing Okta FastPass through the loopback server of Okta Verify when the app requires it, and return the URL
+// to follow once signed in
+func (oc *Client) identityEngine(orgURL, stateToken string, loginDetails *creds.LoginDetails) (string, error) {
+	resp, err := oc.idxCall(orgURL+"/idp/idx/introspect", map[string]interface{}{"stateToken": stateToken})
+	if err != nil {
+		return "", err
+	}
+
+	challenged := false
+
+	for step := 0; step < maxIdxSteps; step++ {
+		if href := gjson.Get(resp, "success.href").String(); href != "" {
+			return href, nil
+		}
+		if msg := gjson.Get(resp, `messages.value.#[class=="ERROR"].message`).String(); msg != "" {
+			return "", fmt.Errorf("login failed: %s", msg)
+		}
+
+		stateHandle := gjson.Get(resp, "stateHandle").String()
+
+		var remediation gjson.Result
+		var next map[string]interface{}
+
+		switch {
+		case hasRemediation(resp, "device-challenge-poll"):
+			if challenged {
+				return "", errors.New("Okta Verify signed the FastPass challenge but Okta is still waiting for it")
+			}
+			challenged = true
+			if err := oc.fastPass(orgURL, gjson.Get(resp, "authenticatorChallenge.value")); err != nil {
+				return "", err
+			}
+			resp, err = oc.pollFastPass(resp)
+			if err != nil {
+				return "", err
+			}
+			continue
+		case hasRemediation(resp, "select-authenticator-authenticate"):
+			remediation = findRemediation(resp, "select-authenticator-authenticate")
+			authenticator, err := fastPassAuthenticator(remediation)
+			if err != nil {
+				return "", err
+			}
+			next = map[string]interface{}{"authenticator": authenticator}
+		case hasRemediation(resp, "identify"):
+			remediation = findRemediation(resp, "identify")
+			next = map[string]interface{}{"identifier": loginDetails.Username}
+			if remediation.Get(`value.#[name=="credentials"]`).Exists() {
+				next["credentials"] = map[string]string{"passcode": loginDetails.Password}
+			}
+		case hasRemediation(resp, "challenge-authenticator") && gjson.Get(resp, "currentAuthenticatorEnrollment.value.type").String() == "password":
+			remediation = findRemediation(resp, "challenge-authenticator")
+			next = map[string]interface{}{"credentials": map[string]string{"passcode": loginDetails.Password}}
+		default:
+			names := []string{}
+			for _, r := range gjson.Get(resp, "remediation.value.#.name").Array() {
+				names = append(names, r.String())
+			}
+			return "", fmt.Errorf("Okta Identity Engine asked for %s, which isn't supported", strings.Join(names, ", "))
+		}
+
+		logger.WithField("remediation", remediation.Get("name").String()).Debug("identity engine step")
+
+		next["stateHandle"] = stateHandle
+		resp, err = oc.idxCall(remediation.Get("href").String(), next)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("Okta Identity Engine login did not complete after %d steps", maxIdxSteps)
+}
+
+// fastPassAuthenticator the Okta Verify authenticator offered with the FastPass method
+func fastPassAuthenticator(remediation gjson.Result) (map[string]string, error) {
+	for _, option := range remediation.Get(`value.#[name=="authenticator"].options`).Array() {
+		form := option.Get("value.form.value")
+		if form.Get(`#[name=="methodType"].value`).String() != signedNonce {
+			continue
+		}
+		return map[string]string{
+			"id":         form.Get(`#[name=="id"].value`).String(),
+			"methodType": signedNonce,
+		}, nil
+	}
+
+	labels := []string{}
+	for _, label := range remediation.Get(`value.#[name=="authenticator"].options.#.label`).Array() {
+		labels = append(labels, label.String())
+	}
+	return nil, fmt.Errorf("Okta didn't offer Okta FastPass, offered: %s", strings.Join(labels, ", "))
+}
+
+// fastPass hand the challenge of Okta to Okta Verify through the loopback server it runs on this device
+func (oc *Client) fastPass(orgURL string, challenge gjson.Result) error {
+	if method := challenge.Get("challengeMethod").String(); method != "LOOPBACK" {
+		return fmt.Errorf("Okta FastPass through %s needs a browser, only the loopback server of Okta Verify is supported", method)
+	}
+
+	domain := challenge.Get("domain").String()
+	if domain == "" {
+		domain = "http://localhost"
+	}
+
+	probeTimeout := time.Duration(challenge.Get("probeTimeoutMillis").Int()) * time.Millisecond
+	if probeTimeout < 100*time.Millisecond {
+		probeTimeout = 100 * time.Millisecond
+	}
+	probe := &http.Client{Timeout: probeTimeout}
+
+	for _, port := range challenge.Get("ports").Array() {
+		base := fmt.Sprintf("%s:%d", domain, port.Int())
+
+		res, err := probe.Get(base + "/probe")
+		if err != nil {
+			logger.WithField("port", port.Int()).WithError(err).Debug("Okta Verify not listening")
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			continue
+		}
+
+		log.Println("Signing the Okta FastPass challenge with Okta Verify, approve it if Okta Verify asks")
+		return signLoopbackChallenge(base, orgURL, challenge.Get("challengeRequest").String())
+	}
+
+	return errors.New("Okta Verify isn't running on this device, start it and sign in to the org to use Okta FastPass")
+}
+
+func signLoopbackChallenge(base, orgURL, challengeRequest string) error {
+	data, err := json.Marshal(map[string]string{"challengeRequest": challengeRequest})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", base+"/challenge", bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "error building challenge request")
+	}
+	req.Header.Add("Content-Type", "application/json")
+	// Okta Verify only answers the org the challenge comes from
+	req.Header.Add("Origin", orgURL)
+
+	res, err := (&http.Client{Timeout: loopbackChallengeTimeout}).Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error sending the challenge to Okta Verify")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("Okta Verify refused the FastPass challenge: %s %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// pollFastPass wait for Okta to receive the signed challenge from Okta Verify
+func (oc *Client) pollFastPass(resp string) (string, error) {
+	for i := 0; i < maxFastPassPolls; i++ {
+		poll := findRemediation(resp, "device-challenge-poll")
+		if !poll.Exists() {
+			return resp, nil
+		}
+
+		if err := oc.client.Sleep(time.Duration(poll.Get("refresh").Int()) * time.Millisecond); err != nil {
+			return "", errors.Wrap(err, "error waiting for FastPass")
+		}
+
+		var err error
+		resp, err = oc.idxCall(poll.Get("href").String(), map[string]interface{}{"stateHandle": gjson.Get(resp, "stateHandle").String()})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", errors.New("timed out waiting for Okta to receive the Okta FastPass challenge")
+}
+
+func hasRemediation(resp, name string) bool {
+	return findRemediation(resp, name).Exists()
+}
+
+func findRemediation(resp, name string) gjson.Result {
+	return gjson.Get(resp, fmt.Sprintf(`remediation.value.#[name==%q]`, name))
+}
+
+// idxCall post to the Okta Identity Engine API
+func (oc *Client) idxCall(href string, body interface{}) (string, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", href, bytes.NewReader(data))
+	if err != nil {
+		return "", errors.Wrap(err, "error building identity engine request")
+	}
+	req.Header.Add("Accept", idxAccept)
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := oc.client.Do(req)
+	if err != nil && res == nil {
+		return "", errors.Wrap(err, "error calling the Okta Identity Engine")
+	}
+	defer res.Body.Close()
+
+	resBody, readErr := ioutil.ReadAll(res.Body)
+	if readErr != nil {
+		return "", errors.Wrap(readErr, "error retrieving body from response")
+	}
+
+	// failures are answered with a 4xx explaining them in the messages
+	if err != nil {
+		if msg := gjson.GetBytes(resBody, `messages.value.#[class=="ERROR"].message`).String(); msg != "" {
+			return "", fmt.Errorf("login failed: %s", msg)
+		}
+		return "", errors.Wrap(err, "error calling the Okta Identity Engine")
+	}
+
+	return string(resBody), nil
+}
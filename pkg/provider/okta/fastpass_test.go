@@ -0,0 +1,149 @@
+package okta
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+const selectAuthenticator = `{
+  "stateHandle": "02stateHandle",
+  "remediation": {"type": "array", "value": [{
+    "name": "select-authenticator-authenticate",
+    "href": "%[1]s/idp/idx/challenge",
+    "method": "POST",
+    "value": [{
+      "name": "authenticator",
+      "options": [
+        {"label": "Password", "value": {"form": {"value": [{"name": "id", "value": "autPassword"}, {"name": "methodType", "value": "password"}]}}},
+        {"label": "Okta Verify", "value": {"form": {"value": [{"name": "id", "value": "autOktaVerify"}, {"name": "methodType", "value": "signed_nonce"}]}}}
+      ]
+    }, {"name": "stateHandle", "value": "02stateHandle"}]
+  }]}
+}`
+
+const deviceChallengePoll = `{
+  "stateHandle": "02stateHandle",
+  "authenticatorChallenge": {"type": "object", "value": {
+    "challengeMethod": "LOOPBACK",
+    "domain": "http://127.0.0.1",
+    "ports": [%[2]s],
+    "challengeRequest": "eyJraWQiOiJjaGFsbGVuZ2UifQ.request",
+    "probeTimeoutMillis": 100
+  }},
+  "remediation": {"type": "array", "value": [{
+    "name": "device-challenge-poll",
+    "href": "%[1]s/idp/idx/authenticators/poll",
+    "method": "POST",
+    "refresh": 1,
+    "value": [{"name": "stateHandle", "value": "02stateHandle"}]
+  }]}
+}`
+
+const identityEngineSuccess = `{"success": {"name": "success-redirect", "href": "%[1]s/login/token/redirect?stateToken=02stateHandle"}}`
+
+// newFastPassServers an Okta org requiring FastPass and the loopback server of Okta Verify
+func newFastPassServers(t *testing.T) (*httptest.Server, *httptest.Server, *[]string) {
+	var calls []string
+	signed := false
+
+	verify := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "verify "+r.URL.Path)
+		switch r.URL.Path {
+		case "/probe":
+			w.WriteHeader(http.StatusOK)
+		case "/challenge":
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Equal(t, "eyJraWQiOiJjaGFsbGVuZ2UifQ.request", gjson.GetBytes(body, "challengeRequest").String())
+			assert.True(t, strings.HasPrefix(r.Header.Get("Origin"), "http://127.0.0.1:"))
+			signed = true
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+
+	// the first port is closed, Okta Verify listens on the second
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedPort := closed.URL[strings.LastIndex(closed.URL, ":")+1:]
+	closed.Close()
+	ports := closedPort + "," + verify.URL[strings.LastIndex(verify.URL, ":")+1:]
+
+	var org *httptest.Server
+	org = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		body, _ := ioutil.ReadAll(r.Body)
+
+		switch r.URL.Path {
+		case "/idp/idx/introspect":
+			assert.Equal(t, "00stateToken", gjson.GetBytes(body, "stateToken").String())
+			fmt.Fprintf(w, selectAuthenticator, org.URL)
+		case "/idp/idx/challenge":
+			assert.Equal(t, "autOktaVerify", gjson.GetBytes(body, "authenticator.id").String())
+			assert.Equal(t, "signed_nonce", gjson.GetBytes(body, "authenticator.methodType").String())
+			assert.Equal(t, "02stateHandle", gjson.GetBytes(body, "stateHandle").String())
+			fmt.Fprintf(w, deviceChallengePoll, org.URL, ports)
+		case "/idp/idx/authenticators/poll":
+			if !signed {
+				fmt.Fprintf(w, deviceChallengePoll, org.URL, ports)
+				return
+			}
+			fmt.Fprintf(w, identityEngineSuccess, org.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return org, verify, &calls
+}
+
+func TestIdentityEngineFastPass(t *testing.T) {
+	org, verify, calls := newFastPassServers(t)
+	defer org.Close()
+	defer verify.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	assert.Nil(t, err)
+
+	successURL, err := client.identityEngine(org.URL, "00stateToken", &creds.LoginDetails{Username: "user", Password: "secret"})
+	assert.Nil(t, err)
+	assert.Equal(t, org.URL+"/login/token/redirect?stateToken=02stateHandle", successURL)
+	assert.Equal(t, []string{
+		"/idp/idx/introspect",
+		"/idp/idx/challenge",
+		"verify /probe",
+		"verify /challenge",
+		"/idp/idx/authenticators/poll",
+	}, *calls)
+}
+
+func TestIdentityEngineFastPassErrors(t *testing.T) {
+	org, verify, _ := newFastPassServers(t)
+	defer org.Close()
+
+	// Okta Verify isn't running
+	verify.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	assert.Nil(t, err)
+
+	_, err = client.identityEngine(org.URL, "00stateToken", &creds.LoginDetails{Username: "user", Password: "secret"})
+	assert.EqualError(t, err, "Okta Verify isn't running on this device, start it and sign in to the org to use Okta FastPass")
+
+	_, err = fastPassAuthenticator(gjson.Parse(`{"value": [{"name": "authenticator", "options": [{"label": "Password", "value": {"form": {"value": [{"name": "methodType", "value": "password"}]}}}]}]}`))
+	assert.EqualError(t, err, "Okta didn't offer Okta FastPass, offered: Password")
+
+	err = client.fastPass(org.URL, gjson.Parse(`{"challengeMethod": "CUSTOM_URI"}`))
+	assert.EqualError(t, err, "Okta FastPass through CUSTOM_URI needs a browser, only the loopback server of Okta Verify is supported")
+}
+
+func TestIsIdentityEngine(t *testing.T) {
+	assert.True(t, isIdentityEngine(`var stateToken = 'abc'; var baseUrl = '/idp/idx/introspect';`))
+	assert.False(t, isIdentityEngine(`var stateToken = 'abc'; authn('/api/v1/authn');`))
+}
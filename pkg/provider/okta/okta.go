@@ -18,6 +18,8 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/duouniversal"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/yubikey"
 	"github.com/aliyun/saml2alibabacloud/pkg/page"
 	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider"
@@ -54,8 +56,14 @@ var (
 
 // Client is a wrapper representing a Okta SAML client
 type Client struct {
-	client *provider.HTTPClient
-	mfa    string
+	client       *provider.HTTPClient
+	mfa          string
+	mfaDevice    string
+	mfaTimeout   time.Duration
+	duoTimeout   time.Duration
+	pollInterval time.Duration
+	appLabel     string
+	duo          *duouniversal.Prompt
 }
 
 // AuthRequest represents an mfa okta request
@@ -74,7 +82,7 @@ type VerifyRequest struct {
 // New creates a new Okta client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewAccountTransport(idpAccount)
 
 	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
@@ -86,8 +94,14 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 	client.CheckResponseStatus = provider.SuccessOrRedirectResponseValidator
 
 	return &Client{
-		client: client,
-		mfa:    idpAccount.MFA,
+		client:       client,
+		mfa:          idpAccount.MFA,
+		mfaDevice:    idpAccount.MFADevice,
+		mfaTimeout:   idpAccount.MFAWaitTimeout(0),
+		duoTimeout:   idpAccount.MFAWaitTimeout(duouniversal.DefaultTimeout),
+		pollInterval: idpAccount.MFAWaitInterval(pushPollInterval),
+		appLabel:     idpAccount.AppLabel,
+		duo:          duouniversal.New(client, idpAccount.MFA, idpAccount.MFAWaitTimeout(duouniversal.DefaultTimeout), idpAccount.MFAWaitInterval(duouniversal.DefaultPollInterval)),
 	}, nil
 }
 
@@ -147,6 +161,23 @@ func (oc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		}
 	}
 
+	// the url is the org, the app to log into is looked up by its label
+	if oc.appLabel != "" && isOrgURL(oktaURL) {
+		appURL, err := oc.discoverApp(oktaURL, oktaSessionToken, oc.appLabel)
+		if err != nil {
+			return "", errors.Wrap(err, "error discovering app")
+		}
+		loginDetails.URL = appURL
+
+		req, err = http.NewRequest("GET", appURL, nil)
+		if err != nil {
+			return "", errors.Wrap(err, "error building app request")
+		}
+
+		ctx := context.WithValue(context.Background(), ctxKey("login"), loginDetails)
+		return oc.follow(ctx, req, loginDetails)
+	}
+
 	//now call saml endpoint
 	oktaSessionRedirectURL := fmt.Sprintf("https://%s/login/sessionCookieRedirect", oktaOrgHost)
 
@@ -213,6 +244,21 @@ func (oc *Client) follow(ctx context.Context, req *http.Request, loginDetails *c
 		if err != nil {
 			return "", errors.Wrap(err, "error retrieving saml response")
 		}
+		if isIdentityEngine(string(body)) {
+			orgURL, err := orgBaseURL(loginDetails.URL)
+			if err != nil {
+				return "", err
+			}
+			successURL, err := oc.identityEngine(orgURL, stateToken, loginDetails)
+			if err != nil {
+				return "", errors.Wrap(err, "error completing Okta Identity Engine login")
+			}
+			req, err = http.NewRequest("GET", successURL, nil)
+			if err != nil {
+				return "", errors.Wrap(err, "error building app request")
+			}
+			return oc.follow(ctx, req, loginDetails)
+		}
 		loginDetails.StateToken = stateToken
 		return oc.Authenticate(loginDetails)
 	}
@@ -246,6 +292,18 @@ func parseMfaIdentifer(json string, arrayPosition int) string {
 	return fmt.Sprintf("%s %s", mfaProvider, factorType)
 }
 
+// parseMfaDevice the name of the device of a factor, the phone, the authenticator or the account of the TOTP app,
+// its ID when the profile has none
+func parseMfaDevice(json string, arrayPosition int) string {
+	profile := gjson.Get(json, fmt.Sprintf("_embedded.factors.%d.profile", arrayPosition))
+	for _, field := range []string{"name", "phoneNumber", "authenticatorName", "credentialId"} {
+		if name := profile.Get(field).String(); name != "" {
+			return name
+		}
+	}
+	return gjson.Get(json, fmt.Sprintf("_embedded.factors.%d.id", arrayPosition)).String()
+}
+
 func (oc *Client) handleFormRedirect(ctx context.Context, doc *goquery.Document) (context.Context, *http.Request, error) {
 	form, err := page.NewFormFromDocument(doc, "")
 	if err != nil {
@@ -301,14 +359,39 @@ func verifyMfa(oc *Client, oktaOrgHost string, loginDetails *creds.LoginDetails,
 	}
 
 	if strings.ToUpper(oc.mfa) != "AUTO" {
+		// the factor may be enrolled on several devices, the one of mfa_device is used
+		var matching []int
+		var devices []string
 		for idx, val := range mfaOptions {
 			if strings.HasPrefix(strings.ToUpper(val), oc.mfa) {
-				mfaOption = idx
-				break
+				matching = append(matching, idx)
+				devices = append(devices, parseMfaDevice(resp, idx))
+			}
+		}
+		if len(matching) > 0 {
+			device, err := prompter.ChooseDevice(oc.mfa, oc.mfaDevice, devices)
+			if err != nil {
+				return "", err
 			}
+			mfaOption = matching[device]
+		}
+	} else if oc.mfaDevice != "" {
+		var devices []string
+		for idx := range mfaOptions {
+			devices = append(devices, parseMfaDevice(resp, idx))
+		}
+		device, err := prompter.ChooseDevice("MFA", oc.mfaDevice, devices)
+		if err != nil {
+			return "", err
 		}
+		mfaOption = device
 	} else if len(mfaOptions) > 1 {
-		mfaOption = prompter.Choose("Select which MFA option to use", mfaOptions)
+		// several devices of a factor are told apart by their names
+		labels := make([]string, len(mfaOptions))
+		for idx, val := range mfaOptions {
+			labels[idx] = fmt.Sprintf("%s (%s)", val, parseMfaDevice(resp, idx))
+		}
+		mfaOption = prompter.Choose("Select which MFA option to use", labels)
 	}
 
 	factorID := gjson.Get(resp, fmt.Sprintf("_embedded.factors.%d.id", mfaOption)).String()
@@ -331,7 +414,7 @@ func verifyMfa(oc *Client, oktaOrgHost string, loginDetails *creds.LoginDetails,
 	// yay
 	switch mfa := mfaIdentifer; mfa {
 	case IdentifierYubiMfa:
-		verifyCode := prompter.Password("Press the button on your yubikey")
+		verifyCode := yubikey.OTP("Press the button on your yubikey")
 		verifyReq.PassCode = verifyCode
 	}
 
@@ -400,13 +483,38 @@ func verifyMfa(oc *Client, oktaOrgHost string, loginDetails *creds.LoginDetails,
 
 		fmt.Printf("\nWaiting for approval, please check your Okta Verify app ...")
 
-		// loop until success, error, or timeout
+		answer := showNumberChallenge(resp, "")
+		req, err = pushPollRequest(req, stateToken, resp)
+		if err != nil {
+			return "", err
+		}
+
+		rateLimited := 0
+		started := time.Now()
+
+		// loop until success, error, or timeout, Okta expires the push unless mfa_timeout is shorter
 		for {
+			if oc.mfaTimeout > 0 && time.Since(started) > oc.mfaTimeout {
+				fmt.Printf(" Timeout\n")
+				return "", errors.New("User did not accept MFA in time")
+			}
 
 			res, err = oc.client.Do(req)
+			if res != nil && res.StatusCode == http.StatusTooManyRequests && rateLimited < maxRateLimited {
+				res.Body.Close()
+				rateLimited++
+
+				delay := parseRateLimit(res.Header).pollDelay(time.Now(), oc.pollInterval)
+				fmt.Printf("\nOkta rate limit reached, waiting %v before checking again ...", delay.Round(time.Second))
+				if err = rewindAndWait(req, delay); err != nil {
+					return "", err
+				}
+				continue
+			}
 			if err != nil {
 				return "", errors.Wrap(err, "error retrieving verify response")
 			}
+			rateLimited = 0
 
 			body, err = ioutil.ReadAll(res.Body)
 			if err != nil {
@@ -419,11 +527,24 @@ func verifyMfa(oc *Client, oktaOrgHost string, loginDetails *creds.LoginDetails,
 				return gjson.Get(string(body), "sessionToken").String(), nil
 			}
 
+			answer = showNumberChallenge(string(body), answer)
+			req, err = pushPollRequest(req, stateToken, string(body))
+			if err != nil {
+				return "", err
+			}
+
 			// otherwise probably still waiting
 			switch gjson.Get(string(body), "factorResult").String() {
 
 			case "WAITING":
-				time.Sleep(3 * time.Second)
+				rl := parseRateLimit(res.Header)
+				delay := rl.pollDelay(time.Now(), oc.pollInterval)
+				if delay > oc.pollInterval {
+					fmt.Printf("\nOkta rate limit nearly reached (%d of %d requests left), slowing down to one check every %v ...", rl.Remaining, rl.Limit, delay.Round(time.Second))
+				}
+				if err = rewindAndWait(req, delay); err != nil {
+					return "", err
+				}
 				fmt.Printf(".")
 				logger.Debug("Waiting for user to authorize login")
 
@@ -433,6 +554,9 @@ func verifyMfa(oc *Client, oktaOrgHost string, loginDetails *creds.LoginDetails,
 
 			case "REJECTED":
 				fmt.Printf(" Rejected\n")
+				if answer != "" {
+					return "", errors.New("MFA rejected by user, or another number than " + answer + " was tapped")
+				}
 				return "", errors.New("MFA rejected by user")
 
 			default:
@@ -444,6 +568,11 @@ func verifyMfa(oc *Client, oktaOrgHost string, loginDetails *creds.LoginDetails,
 		}
 
 	case IdentifierDuoMfa:
+		// orgs moved to the Duo Universal Prompt get the Duo authorization URL instead of the iframe signature
+		if authorizeURL := gjson.Get(resp, "_embedded.factor._embedded.verification._links.authorize.href").String(); authorizeURL != "" {
+			return oc.duoUniversalPrompt(authorizeURL, oktaVerify, stateToken, loginDetails)
+		}
+
 		duoHost := gjson.Get(resp, "_embedded.factor._embedded.verification.host").String()
 		duoSignature := gjson.Get(resp, "_embedded.factor._embedded.verification.signature").String()
 		duoSiguatres := strings.Split(duoSignature, ":")
@@ -587,9 +716,16 @@ func verifyMfa(oc *Client, oktaOrgHost string, loginDetails *creds.LoginDetails,
 		log.Println(gjson.Get(resp, "response.status").String())
 
 		if duoTxResult != "SUCCESS" {
-			//poll as this is likely a push request
+			//poll as this is likely a push request, until the push is answered or mfa_timeout expires
+			started := time.Now()
 			for {
-				time.Sleep(3 * time.Second)
+				if time.Since(started) > oc.duoTimeout {
+					return "", errors.New("Duo authentication was not approved in time")
+				}
+
+				if err := oc.client.Sleep(oc.pollInterval); err != nil {
+					return "", errors.Wrap(err, "error waiting for the duo approval")
+				}
 
 				req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
 				if err != nil {
@@ -758,3 +894,77 @@ func verifyMfa(oc *Client, oktaOrgHost string, loginDetails *creds.LoginDetails,
 	// catch all
 	return "", errors.New("no mfa options provided")
 }
+
+// duoUniversalPrompt complete the Duo Universal Prompt, which returns to Okta once approved, and verify the factor
+// again for the session token
+func (oc *Client) duoUniversalPrompt(authorizeURL, oktaVerify, stateToken string, loginDetails *creds.LoginDetails) (string, error) {
+	res, err := oc.duo.Start(authorizeURL, loginDetails)
+	if err != nil {
+		return "", errors.Wrap(err, "error verifying Duo MFA")
+	}
+	res.Body.Close()
+
+	verifyBody, err := json.Marshal(VerifyRequest{StateToken: stateToken})
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding verify request")
+	}
+
+	req, err := http.NewRequest("POST", oktaVerify, bytes.NewReader(verifyBody))
+	if err != nil {
+		return "", errors.Wrap(err, "error building verify request")
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	res, err = oc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving verify response")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+
+	sessionToken := gjson.GetBytes(body, "sessionToken").String()
+	if sessionToken == "" {
+		return "", fmt.Errorf("Okta did not accept the Duo authentication, the transaction is %s", gjson.GetBytes(body, "status").String())
+	}
+
+	return sessionToken, nil
+}
+
+// showNumberChallenge print the number to tap in Okta Verify when the org requires number challenge on push, unless
+// it was already shown, and return the number
+func showNumberChallenge(resp, shown string) string {
+	answer := gjson.Get(resp, "_embedded.factor._embedded.challenge.correctAnswer").String()
+	if answer == "" || answer == shown {
+		return shown
+	}
+	fmt.Printf("\nTap %s in Okta Verify to approve the login ...", answer)
+	return answer
+}
+
+// pushPollRequest the request checking on the push, through the poll link Okta gives once the push is sent, so the
+// transaction holding the number challenge is polled rather than the verify link again
+func pushPollRequest(req *http.Request, stateToken, resp string) (*http.Request, error) {
+	href := gjson.Get(resp, "_links.next.href").String()
+	if gjson.Get(resp, "_links.next.name").String() != "poll" || href == "" || href == req.URL.String() {
+		return req, nil
+	}
+
+	body, err := json.Marshal(VerifyRequest{StateToken: stateToken})
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding poll request")
+	}
+
+	poll, err := http.NewRequest("POST", href, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building poll request")
+	}
+	poll.Header.Add("Content-Type", "application/json")
+	poll.Header.Add("Accept", "application/json")
+
+	return poll, nil
+}
@@ -2,8 +2,16 @@ package okta
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -47,3 +55,175 @@ func TestGetStateTokenFromOktaPageBody(t *testing.T) {
 		})
 	}
 }
+
+func TestRateLimitPollDelay(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	header := http.Header{}
+	header.Set("X-Rate-Limit-Limit", "100")
+	header.Set("X-Rate-Limit-Remaining", "50")
+	header.Set("X-Rate-Limit-Reset", "1060")
+
+	rl := parseRateLimit(header)
+	assert.Equal(t, &rateLimit{Limit: 100, Remaining: 50, Reset: time.Unix(1060, 0)}, rl)
+	assert.Equal(t, pushPollInterval, rl.pollDelay(now, pushPollInterval))
+
+	rl.Remaining = 4
+	assert.Equal(t, 15*time.Second, rl.pollDelay(now, pushPollInterval))
+
+	rl.Remaining = 0
+	assert.Equal(t, 61*time.Second, rl.pollDelay(now, pushPollInterval))
+
+	assert.Nil(t, parseRateLimit(http.Header{}))
+	assert.Equal(t, pushPollInterval, parseRateLimit(http.Header{}).pollDelay(now, pushPollInterval))
+}
+
+func TestVerifyMfaPushRateLimited(t *testing.T) {
+	defer func(interval time.Duration) { pushPollInterval = interval }(pushPollInterval)
+	pushPollInterval = time.Millisecond
+
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Contains(t, string(body), "state-token")
+
+		calls++
+		w.Header().Set("X-Rate-Limit-Limit", "100")
+		w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10))
+		switch calls {
+		case 1, 2:
+			w.Header().Set("X-Rate-Limit-Remaining", "50")
+			fmt.Fprint(w, `{"status":"MFA_CHALLENGE","factorResult":"WAITING"}`)
+		case 3:
+			w.Header().Set("X-Rate-Limit-Remaining", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			fmt.Fprint(w, `{"status":"SUCCESS","sessionToken":"session-token"}`)
+		}
+	}))
+	defer ts.Close()
+
+	oc, err := New(&cfg.IDPAccount{MFA: "PUSH"})
+	assert.Nil(t, err)
+
+	resp := `{"stateToken":"state-token","_embedded":{"factors":[{"id":"push","factorType":"push","provider":"OKTA","_links":{"verify":{"href":"` + ts.URL + `/verify"}}}]}}`
+
+	sessionToken, err := verifyMfa(oc, "okta.example.com", &creds.LoginDetails{}, resp)
+	assert.Nil(t, err)
+	assert.Equal(t, "session-token", sessionToken)
+	assert.Equal(t, 4, calls)
+}
+
+func TestVerifyMfaPushNumberChallenge(t *testing.T) {
+	defer func(interval time.Duration) { pushPollInterval = interval }(pushPollInterval)
+	pushPollInterval = time.Millisecond
+
+	var paths []string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Contains(t, string(body), "state-token")
+
+		paths = append(paths, r.URL.Path)
+		waiting := `{"status":"MFA_CHALLENGE","factorResult":"WAITING",` +
+			`"_embedded":{"factor":{"_embedded":{"challenge":{"correctAnswer":42}}}},` +
+			`"_links":{"next":{"name":"poll","href":"` + ts.URL + `/transactions/push/verify"}}}`
+		switch len(paths) {
+		case 1, 2:
+			fmt.Fprint(w, waiting)
+		default:
+			fmt.Fprint(w, `{"status":"SUCCESS","sessionToken":"session-token"}`)
+		}
+	}))
+	defer ts.Close()
+
+	oc, err := New(&cfg.IDPAccount{MFA: "PUSH"})
+	assert.Nil(t, err)
+
+	resp := `{"stateToken":"state-token","_embedded":{"factors":[{"id":"push","factorType":"push","provider":"OKTA","_links":{"verify":{"href":"` + ts.URL + `/verify"}}}]}}`
+
+	sessionToken, err := verifyMfa(oc, "okta.example.com", &creds.LoginDetails{}, resp)
+	assert.Nil(t, err)
+	assert.Equal(t, "session-token", sessionToken)
+	// the push is only sent once, then polled through its transaction
+	assert.Equal(t, []string{"/verify", "/transactions/push/verify", "/transactions/push/verify"}, paths)
+}
+
+func TestShowNumberChallenge(t *testing.T) {
+	resp := `{"factorResult":"WAITING","_embedded":{"factor":{"_embedded":{"challenge":{"correctAnswer":42}}}}}`
+
+	assert.Equal(t, "42", showNumberChallenge(resp, ""))
+	assert.Equal(t, "42", showNumberChallenge(`{"factorResult":"WAITING"}`, "42"))
+	assert.Equal(t, "", showNumberChallenge(`{"factorResult":"WAITING"}`, ""))
+}
+
+func TestVerifyMfaDuoUniversalPrompt(t *testing.T) {
+	verified := false
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/verify":
+			if !verified {
+				fmt.Fprint(w, `{"status":"MFA_CHALLENGE","_embedded":{"factor":{"_embedded":{"verification":{"_links":{"authorize":{"href":"`+ts.URL+`/oauth/v1/authorize?client_id=DIXXXXXXXX"}}}}}}}`)
+				return
+			}
+			fmt.Fprint(w, `{"status":"SUCCESS","sessionToken":"session-token"}`)
+		case "/oauth/v1/authorize":
+			http.Redirect(w, r, "/frame/v4/auth/prompt?sid=session-1", http.StatusFound)
+		case "/frame/v4/auth/prompt":
+			fmt.Fprint(w, `<html><body><input type="hidden" name="_xsrf" value="prompt-xsrf-token"></body></html>`)
+		case "/frame/v4/auth/prompt/data":
+			fmt.Fprint(w, `{"stat":"OK","response":{"phones":[{"key":"DPXXXXXXXX","name":"iPhone"}]}}`)
+		case "/frame/v4/prompt":
+			assert.Equal(t, "123456", r.PostForm.Get("passcode"))
+			fmt.Fprint(w, `{"stat":"OK","response":{"txid":"tx-1"}}`)
+		case "/frame/v4/status":
+			fmt.Fprint(w, `{"stat":"OK","response":{"status_code":"allow"}}`)
+		case "/frame/v4/oidc/exit":
+			http.Redirect(w, r, "/oauth2/v1/authorize/callback?state=state-1&duo_code=duo-code", http.StatusFound)
+		case "/oauth2/v1/authorize/callback":
+			assert.Equal(t, "duo-code", r.URL.Query().Get("duo_code"))
+			verified = true
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	oc, err := New(&cfg.IDPAccount{MFA: "DUO"})
+	assert.Nil(t, err)
+
+	resp := `{"stateToken":"state-token","_embedded":{"factors":[{"id":"duo","factorType":"web","provider":"DUO","_links":{"verify":{"href":"` + ts.URL + `/verify"}}}]}}`
+
+	sessionToken, err := verifyMfa(oc, "okta.example.com", &creds.LoginDetails{DuoMFAOption: "Passcode", MFAToken: "123456"}, resp)
+	assert.Nil(t, err)
+	assert.Equal(t, "session-token", sessionToken)
+}
+
+func TestVerifyMfaDevice(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprint(w, `{"status":"SUCCESS","sessionToken":"session-token"}`)
+	}))
+	defer ts.Close()
+
+	oc, err := New(&cfg.IDPAccount{MFA: "PUSH", MFADevice: "pixel"})
+	assert.Nil(t, err)
+
+	resp := `{"stateToken":"state-token","_embedded":{"factors":[` +
+		`{"id":"push-1","factorType":"push","provider":"OKTA","profile":{"name":"iPhone"},"_links":{"verify":{"href":"` + ts.URL + `/verify/push-1"}}},` +
+		`{"id":"push-2","factorType":"push","provider":"OKTA","profile":{"name":"Pixel 7"},"_links":{"verify":{"href":"` + ts.URL + `/verify/push-2"}}}]}}`
+
+	sessionToken, err := verifyMfa(oc, "okta.example.com", &creds.LoginDetails{}, resp)
+	assert.Nil(t, err)
+	assert.Equal(t, "session-token", sessionToken)
+	assert.Equal(t, "/verify/push-2", paths[0])
+
+	oc.mfaDevice = "Galaxy"
+	_, err = verifyMfa(oc, "okta.example.com", &creds.LoginDetails{}, resp)
+	assert.EqualError(t, err, "no PUSH device matches mfa_device Galaxy, enrolled: iPhone, Pixel 7")
+}
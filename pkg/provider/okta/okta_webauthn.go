@@ -1,10 +1,12 @@
 package okta
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
 	"github.com/marshallbrekka/go-u2fhost"
 )
 
@@ -81,52 +83,31 @@ func (d *FidoClient) ChallengeU2F() (*SignedAssertion, error) {
 	if d.Device == nil {
 		return nil, errors.New("No Device Found")
 	}
-	request := &u2fhost.AuthenticateRequest{
-		Challenge: d.ChallengeNonce,
-		Facet:     "https://" + d.AppID,
-		AppId:     d.AppID,
-		KeyHandle: d.KeyHandle,
-		WebAuthn:  true,
-	}
-	// do the change
-	prompted := false
-	timeout := time.After(time.Second * 25)
-	interval := time.NewTicker(time.Millisecond * 250)
-	var responsePayload *SignedAssertion
-
-	defer func() {
-		d.Device.Close()
-	}()
-	defer interval.Stop()
-	for {
-		select {
-		case <-timeout:
-			return nil, errors.New("Failed to get authentication response after 25 seconds")
-		case <-interval.C:
-			response, err := d.Device.Authenticate(request)
-			if err == nil {
-				responsePayload = &SignedAssertion{
-					StateToken:        d.StateToken,
-					ClientData:        response.ClientData,
-					SignatureData:     response.SignatureData,
-					AuthenticatorData: response.AuthenticatorData,
-				}
-				fmt.Printf("  ==> Touch accepted. Proceeding with authentication\n")
-				return responsePayload, nil
-			}
 
-			switch err.(type) {
-			case *u2fhost.TestOfUserPresenceRequiredError:
-				if !prompted {
-					fmt.Printf("\nTouch the flashing U2F device to authenticate...\n")
-					prompted = true
-				}
-			default:
-				return responsePayload, err
-			}
-		}
+	assertion, err := webauthn.NewWithFinder(openedDevice{d.Device}).Assert(&webauthn.Request{
+		RPID:          d.AppID,
+		Challenge:     d.ChallengeNonce,
+		CredentialIDs: []string{d.KeyHandle},
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	return &SignedAssertion{
+		StateToken:        d.StateToken,
+		ClientData:        base64.RawURLEncoding.EncodeToString(assertion.ClientDataJSON),
+		SignatureData:     base64.StdEncoding.EncodeToString(assertion.Signature),
+		AuthenticatorData: base64.StdEncoding.EncodeToString(assertion.AuthenticatorData),
+	}, nil
+}
+
+// openedDevice hands the device found by the DeviceFinder to the WebAuthn authenticator
+type openedDevice struct {
+	device u2fhost.Device
+}
+
+func (o openedDevice) FindDevices() ([]u2fhost.Device, error) {
+	return []u2fhost.Device{o.device}, nil
 }
 
 // U2FDeviceFinder returns a U2F device
@@ -0,0 +1,92 @@
+package okta
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// rateLimitLowWatermark the fraction of the rate limit left below which push polling slows down
+	rateLimitLowWatermark = 0.2
+
+	// maxRateLimited the number of consecutive rate limited push polls before giving up
+	maxRateLimited = 5
+)
+
+// pushPollInterval delay between two polls of a pending push while the org is well within its rate limit, unless
+// mfa_poll_interval is set
+var pushPollInterval = 3 * time.Second
+
+// rateLimit the Okta rate limit of an API endpoint, from the X-Rate-Limit headers of a response
+type rateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// parseRateLimit read the X-Rate-Limit headers of the response, nil when Okta didn't send them
+func parseRateLimit(header http.Header) *rateLimit {
+	limit, err := strconv.Atoi(header.Get("X-Rate-Limit-Limit"))
+	if err != nil {
+		return nil
+	}
+	remaining, err := strconv.Atoi(header.Get("X-Rate-Limit-Remaining"))
+	if err != nil {
+		return nil
+	}
+	reset, err := strconv.ParseInt(header.Get("X-Rate-Limit-Reset"), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	return &rateLimit{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+}
+
+// pollDelay how long to wait before polling again, interval while the org is well within its limit, once few
+// requests are left until the window resets the remaining ones are spread over what is left of it so the org isn't
+// blocked
+func (rl *rateLimit) pollDelay(now time.Time, interval time.Duration) time.Duration {
+	if rl == nil || rl.Limit <= 0 {
+		return interval
+	}
+
+	untilReset := rl.Reset.Sub(now)
+	if untilReset <= 0 {
+		return interval
+	}
+
+	if rl.Remaining <= 0 {
+		// the window is exhausted, give the clock skew with Okta a second
+		return untilReset + time.Second
+	}
+
+	if float64(rl.Remaining) >= float64(rl.Limit)*rateLimitLowWatermark {
+		return interval
+	}
+
+	if spread := untilReset / time.Duration(rl.Remaining); spread > interval {
+		return spread
+	}
+
+	return interval
+}
+
+// rewindAndWait wait before the request is sent again, restoring its body which the previous attempt consumed
+func rewindAndWait(req *http.Request, delay time.Duration) error {
+	time.Sleep(delay)
+
+	if req.GetBody == nil {
+		return nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return errors.Wrap(err, "error rebuilding verify request")
+	}
+	req.Body = body
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package onelogin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyMFADevice(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var verifyReq VerifyRequest
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&verifyReq))
+		require.Equal(t, "2222", verifyReq.DeviceID)
+		require.Equal(t, "123456", verifyReq.OTPToken)
+		w.Write([]byte(`{"status":{"error":false,"type":"success","message":"Success"},"data":"abc123"}`))
+	}))
+	defer ts.Close()
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("StringRequired", "Enter verification code").Return("123456")
+
+	oc := &Client{
+		Client:    &provider.HTTPClient{Client: http.Client{}, Options: &provider.HTTPClientOptions{}},
+		MFA:       "TOTP",
+		MFADevice: "laptop",
+		Subdomain: "example",
+	}
+
+	resp := `{"status":{"error":false,"type":"success","message":"MFA is required for this user"},
+		"data":[{"state_token":"state-1","callback_url":"` + ts.URL + `/api/1/saml_assertion/verify_factor",
+		"devices":[{"device_id":"1111","device_type":"Google Authenticator","user_display_name":"Phone"},{"device_id":"2222","device_type":"Google Authenticator","user_display_name":"Laptop"}]}]}`
+
+	samlAssertion, err := verifyMFA(oc, "token", "app-1", resp)
+	require.Nil(t, err)
+	require.Equal(t, "abc123", samlAssertion)
+
+	oc.MFADevice = "tablet"
+	_, err = verifyMFA(oc, "token", "app-1", resp)
+	require.EqualError(t, err, "no TOTP device matches mfa_device tablet, enrolled: Phone, Laptop")
+}
@@ -13,6 +13,8 @@ import (
 
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/yubikey"
 	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/pkg/errors"
@@ -26,6 +28,7 @@ const (
 	IdentifierSmsMfa             = "OneLogin SMS"
 	IdentifierTotpMfa            = "Google Authenticator"
 	IdentifierYubiKey            = "Yubico YubiKey"
+	IdentifierWebAuthn           = "WebAuthn"
 
 	MessageMFARequired = "MFA is required for this user"
 	MessageSuccess     = "Success"
@@ -38,12 +41,19 @@ const ProviderName = "OneLogin"
 
 var logger = logrus.WithField("provider", ProviderName)
 
+// How long OneLogin Protect approvals are waited for and checked, unless mfa_timeout and mfa_poll_interval are set
+const (
+	defaultMFATimeout      = time.Minute
+	defaultMFAPollInterval = time.Second
+)
+
 var (
 	supportedMfaOptions = map[string]string{
 		IdentifierOneLoginProtectMfa: "OLP",
 		IdentifierSmsMfa:             "SMS",
 		IdentifierTotpMfa:            "TOTP",
 		IdentifierYubiKey:            "YUBIKEY",
+		IdentifierWebAuthn:           "WEBAUTHN",
 	}
 )
 
@@ -55,8 +65,14 @@ type Client struct {
 	Client *provider.HTTPClient
 	// A predefined MFA name.
 	MFA string
+	// The name of the device of the MFA used when several are enrolled.
+	MFADevice string
+	// How long a push approval is waited for and how often it is checked.
+	MFATimeout, MFAPollInterval time.Duration
 	// Subdomain is the organisation subdomain in OneLogin.
 	Subdomain string
+
+	authenticator *webauthn.Authenticator
 }
 
 // AuthRequest represents an mfa OneLogin request.
@@ -79,12 +95,14 @@ type VerifyRequest struct {
 
 // New creates a new OneLogin client.
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewAccountTransport(idpAccount)
 	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
-	return &Client{AppID: idpAccount.AppID, Client: client, MFA: idpAccount.MFA, Subdomain: idpAccount.Subdomain}, nil
+	return &Client{AppID: idpAccount.AppID, Client: client, MFA: idpAccount.MFA, MFADevice: idpAccount.MFADevice,
+		MFATimeout: idpAccount.MFAWaitTimeout(defaultMFATimeout), MFAPollInterval: idpAccount.MFAWaitInterval(defaultMFAPollInterval),
+		Subdomain: idpAccount.Subdomain, authenticator: webauthn.New()}, nil
 }
 
 // Authenticate logs into OneLogin and returns a SAML response.
@@ -206,6 +224,14 @@ func addContentHeaders(r *http.Request) {
 	r.Header.Add("Accept", "application/json")
 }
 
+// parseMfaDevice the name the user gave the device, its ID when it has none
+func parseMfaDevice(resp string, n int) string {
+	if name := gjson.Get(resp, fmt.Sprintf("data.0.devices.%d.user_display_name", n)).String(); name != "" {
+		return name
+	}
+	return gjson.Get(resp, fmt.Sprintf("data.0.devices.%d.device_id", n)).String()
+}
+
 // verifyMFA is used to either prompt to user for one time password or request approval using push notification.
 // For more details check https://developers.onelogin.com/api-docs/1/saml-assertions/verify-factor
 func verifyMFA(oc *Client, oauthToken, appID, resp string) (string, error) {
@@ -213,23 +239,33 @@ func verifyMFA(oc *Client, oauthToken, appID, resp string) (string, error) {
 	// choose an mfa option if there are multiple enabled
 	var option int
 	var mfaOptions []string
-	var preselected bool
+	// the devices of the pre-selected MFA option (through the --mfa flag), one of them is picked with mfa_device
+	var preselected []int
+	var devices []string
 	for n, id := range gjson.Get(resp, "data.0.devices.#.device_type").Array() {
 		identifier := id.String()
 		if val, ok := supportedMfaOptions[identifier]; ok {
 			mfaOptions = append(mfaOptions, val)
-			// If there is pre-selected MFA option (thorugh the --mfa flag), then set MFA option index and break early.
 			if val == oc.MFA {
-				option = n
-				preselected = true
-				break
+				preselected = append(preselected, n)
+				devices = append(devices, parseMfaDevice(resp, n))
 			}
 		} else {
 			mfaOptions = append(mfaOptions, "UNSUPPORTED: "+identifier)
 		}
 	}
-	if !preselected && len(mfaOptions) > 1 {
-		option = prompter.Choose("Select which MFA option to use", mfaOptions)
+	if len(preselected) > 0 {
+		device, err := prompter.ChooseDevice(oc.MFA, oc.MFADevice, devices)
+		if err != nil {
+			return "", err
+		}
+		option = preselected[device]
+	} else if len(mfaOptions) > 1 {
+		labels := make([]string, len(mfaOptions))
+		for n, val := range mfaOptions {
+			labels[n] = fmt.Sprintf("%s (%s)", val, parseMfaDevice(resp, n))
+		}
+		option = prompter.Choose("Select which MFA option to use", labels)
 	}
 
 	factorID := gjson.Get(resp, fmt.Sprintf("data.0.devices.%d.device_id", option)).String()
@@ -279,8 +315,16 @@ func verifyMFA(oc *Client, oauthToken, appID, resp string) (string, error) {
 	}
 
 	switch mfaIdentifer {
+	case IdentifierWebAuthn:
+		return verifyWebAuthn(oc, oauthToken, appID, mfaDeviceID, stateToken, callbackURL, resp)
+
 	case IdentifierSmsMfa, IdentifierTotpMfa, IdentifierYubiKey:
-		verifyCode := prompter.StringRequired("Enter verification code")
+		var verifyCode string
+		if mfaIdentifer == IdentifierYubiKey {
+			verifyCode = yubikey.OTP("Press the button on your yubikey")
+		} else {
+			verifyCode = prompter.StringRequired("Enter verification code")
+		}
 		var verifyBody bytes.Buffer
 		json.NewEncoder(&verifyBody).Encode(VerifyRequest{AppID: appID, DeviceID: mfaDeviceID, StateToken: stateToken, OTPToken: verifyCode})
 		req, err := http.NewRequest("POST", callbackURL, &verifyBody)
@@ -329,7 +373,7 @@ func verifyMFA(oc *Client, oauthToken, appID, resp string) (string, error) {
 		started := time.Now()
 		// loop until success, error, or timeout
 		for {
-			if time.Since(started) > time.Minute {
+			if time.Since(started) > oc.MFATimeout {
 				log.Println(" Timeout")
 				return "", errors.New("User did not accept MFA in time")
 			}
@@ -354,7 +398,9 @@ func verifyMFA(oc *Client, oauthToken, appID, resp string) (string, error) {
 
 			switch gjson.Get(string(body), "status.type").String() {
 			case TypePending:
-				time.Sleep(time.Second)
+				if err := oc.Client.Sleep(oc.MFAPollInterval); err != nil {
+					return "", errors.Wrap(err, "error waiting for the push approval")
+				}
 				fmt.Print(".")
 
 			case TypeSuccess:
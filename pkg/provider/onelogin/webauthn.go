@@ -0,0 +1,98 @@
+package onelogin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// webAuthnAssertion the assertion of the security key as OneLogin expects it in the otp_token, base64url encoded
+type webAuthnAssertion struct {
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+}
+
+// verifyWebAuthn sign the challenge OneLogin answered the activation of the WebAuthn device with, then verify the
+// factor with the assertion and return the SAML assertion
+func verifyWebAuthn(oc *Client, oauthToken, appID, deviceID, stateToken, callbackURL, resp string) (string, error) {
+	challenge := gjson.Get(resp, "data.0.challenge").String()
+	if challenge == "" {
+		return "", errors.New("OneLogin did not send a security key challenge")
+	}
+
+	rpID := gjson.Get(resp, "data.0.rp_id").String()
+	if rpID == "" {
+		rpID = oc.Subdomain + ".onelogin.com"
+	}
+
+	var credentialIDs []string
+	for _, id := range gjson.Get(resp, "data.0.allow_credentials.#.id").Array() {
+		credentialIDs = append(credentialIDs, id.String())
+	}
+
+	authenticator := oc.authenticator
+	if authenticator == nil {
+		authenticator = webauthn.New()
+	}
+
+	assertion, err := authenticator.Assert(&webauthn.Request{
+		RPID:             rpID,
+		Challenge:        challenge,
+		CredentialIDs:    credentialIDs,
+		Timeout:          time.Duration(gjson.Get(resp, "data.0.timeout").Int()) * time.Millisecond,
+		UserVerification: gjson.Get(resp, "data.0.user_verification").String(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error signing in with the security key")
+	}
+
+	assertionJSON, err := json.Marshal(webAuthnAssertion{
+		ID:                assertion.CredentialID,
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(assertion.ClientDataJSON),
+		AuthenticatorData: base64.RawURLEncoding.EncodeToString(assertion.AuthenticatorData),
+		Signature:         base64.RawURLEncoding.EncodeToString(assertion.Signature),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding security key assertion")
+	}
+
+	var verifyBody bytes.Buffer
+	err = json.NewEncoder(&verifyBody).Encode(VerifyRequest{AppID: appID, DeviceID: deviceID, StateToken: stateToken, OTPToken: string(assertionJSON)})
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding verifyReq")
+	}
+
+	req, err := http.NewRequest("POST", callbackURL, &verifyBody)
+	if err != nil {
+		return "", errors.Wrap(err, "error building security key post request")
+	}
+
+	addContentHeaders(req)
+	addAuthHeader(req, oauthToken)
+	res, err := oc.Client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving security key post response")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body from response")
+	}
+
+	resp = string(body)
+	if gjson.Get(resp, "status.error").Bool() {
+		return "", errors.New(gjson.Get(resp, "status.message").String())
+	}
+
+	return gjson.Get(resp, "data").String(), nil
+}
@@ -0,0 +1,80 @@
+package onelogin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/webauthn"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	u2fhost "github.com/marshallbrekka/go-u2fhost"
+	"github.com/stretchr/testify/require"
+)
+
+type mockFinder struct {
+	device u2fhost.Device
+}
+
+func (m *mockFinder) FindDevices() ([]u2fhost.Device, error) {
+	return []u2fhost.Device{m.device}, nil
+}
+
+func TestVerifyMFAWebAuthn(t *testing.T) {
+	calls := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var verifyReq VerifyRequest
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&verifyReq))
+		require.Equal(t, "bearer: token", r.Header.Get("Authorization"))
+		require.Equal(t, "4321", verifyReq.DeviceID)
+		require.Equal(t, "state-1", verifyReq.StateToken)
+
+		calls++
+		if verifyReq.OTPToken == "" {
+			w.Write([]byte(`{"status":{"error":false,"type":"pending","message":"Authenticate with your security key"},
+				"data":[{"challenge":"Y2hhbGxlbmdl","rp_id":"example.onelogin.com","allow_credentials":[{"id":"a2V5LTE"}],"timeout":30000}]}`))
+			return
+		}
+
+		var assertion webAuthnAssertion
+		require.Nil(t, json.Unmarshal([]byte(verifyReq.OTPToken), &assertion))
+		require.Equal(t, "a2V5LTE", assertion.ID)
+		require.Equal(t, base64.RawURLEncoding.EncodeToString([]byte("signature")), assertion.Signature)
+		w.Write([]byte(`{"status":{"error":false,"type":"success","message":"Success"},"data":"abc123"}`))
+	}))
+	defer ts.Close()
+
+	device := &mocks.U2FDevice{}
+	device.On("Authenticate", &u2fhost.AuthenticateRequest{
+		Challenge: "Y2hhbGxlbmdl",
+		AppId:     "example.onelogin.com",
+		Facet:     "https://example.onelogin.com",
+		KeyHandle: "a2V5LTE",
+		WebAuthn:  true,
+	}).Return(&u2fhost.AuthenticateResponse{
+		KeyHandle:         "a2V5LTE",
+		ClientData:        base64.RawURLEncoding.EncodeToString([]byte(`{"type":"webauthn.get"}`)),
+		AuthenticatorData: base64.StdEncoding.EncodeToString([]byte("authenticator data")),
+		SignatureData:     base64.StdEncoding.EncodeToString([]byte("signature")),
+	}, nil)
+	device.On("Close").Return()
+
+	oc := &Client{
+		Client:        &provider.HTTPClient{Client: http.Client{}, Options: &provider.HTTPClientOptions{}},
+		MFA:           "WEBAUTHN",
+		Subdomain:     "example",
+		authenticator: webauthn.NewWithFinder(&mockFinder{device}),
+	}
+
+	resp := `{"status":{"error":false,"type":"success","message":"MFA is required for this user"},
+		"data":[{"state_token":"state-1","callback_url":"` + ts.URL + `/api/1/saml_assertion/verify_factor",
+		"devices":[{"device_id":"1234","device_type":"Google Authenticator"},{"device_id":"4321","device_type":"WebAuthn"}]}]}`
+
+	samlAssertion, err := verifyMFA(oc, "token", "app-1", resp)
+	require.Nil(t, err)
+	require.Equal(t, "abc123", samlAssertion)
+	require.Equal(t, 2, calls)
+}
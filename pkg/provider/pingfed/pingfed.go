@@ -4,20 +4,18 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/pingid"
 	"github.com/aliyun/saml2alibabacloud/pkg/page"
 	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"github.com/tidwall/gjson"
 )
 
 var logger = logrus.WithField("provider", "pingfed")
@@ -31,7 +29,7 @@ type Client struct {
 // New create a new PingFed client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewAccountTransport(idpAccount)
 
 	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
@@ -95,6 +93,9 @@ func (ac *Client) follow(ctx context.Context, req *http.Request) (string, error)
 	} else if docIsLogin(doc) {
 		logger.WithField("type", "login").Debug("doc detect")
 		handler = ac.handleLogin
+	} else if pingid.IsDeviceSelection(doc) {
+		logger.WithField("type", "select-device").Debug("doc detect")
+		handler = ac.handleSelectDevice
 	} else if docIsOTP(doc) {
 		logger.WithField("type", "otp").Debug("doc detect")
 		handler = ac.handleOTP
@@ -153,51 +154,12 @@ func (ac *Client) handleOTP(ctx context.Context, doc *goquery.Document) (context
 }
 
 func (ac *Client) handleSwipe(ctx context.Context, doc *goquery.Document) (context.Context, *http.Request, error) {
-	form, err := page.NewFormFromDocument(doc, "#form1")
-	if err != nil {
-		return ctx, nil, errors.Wrap(err, "error extracting swipe status form")
-	}
-
-	// poll status. request must specifically be a GET
-	form.Method = "GET"
-	req, err := form.BuildRequest()
-	if err != nil {
-		return ctx, nil, err
-	}
-
-	for {
-		time.Sleep(3 * time.Second)
-
-		res, err := ac.client.Do(req)
-		if err != nil {
-			return ctx, nil, errors.Wrap(err, "error polling swipe status")
-		}
-
-		body, err := ioutil.ReadAll(res.Body)
-		if err != nil {
-			return ctx, nil, errors.Wrap(err, "error parsing body from swipe status response")
-		}
-
-		resp := string(body)
-
-		pingfedMFAStatusResponse := gjson.Get(resp, "status").String()
-
-		//ASYNC_AUTH_WAIT indicates we keep going
-		//OK indicates someone swiped
-		//DEVICE_CLAIM_TIMEOUT indicates nobody swiped
-		//otherwise loop forever?
-
-		if pingfedMFAStatusResponse == "OK" || pingfedMFAStatusResponse == "DEVICE_CLAIM_TIMEOUT" || pingfedMFAStatusResponse == "TIMEOUT" {
-			break
-		}
-	}
+	req, err := pingid.WaitForApproval(ac.client, doc, ac.idpAccount.MFAWaitTimeout(pingid.DefaultTimeout), ac.idpAccount.MFAWaitInterval(pingid.DefaultPollInterval))
+	return ctx, req, err
+}
 
-	// now build a request for getting response of MFA
-	form, err = page.NewFormFromDocument(doc, "#reponseView")
-	if err != nil {
-		return ctx, nil, errors.Wrap(err, "error extracting swipe response form")
-	}
-	req, err = form.BuildRequest()
+func (ac *Client) handleSelectDevice(ctx context.Context, doc *goquery.Document) (context.Context, *http.Request, error) {
+	req, err := pingid.SelectDevice(doc, ac.idpAccount.MFADevice)
 	return ctx, req, err
 }
 
@@ -4,20 +4,18 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/pingid"
 	"github.com/aliyun/saml2alibabacloud/pkg/page"
 	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"github.com/tidwall/gjson"
 )
 
 var logger = logrus.WithField("provider", "pingone")
@@ -43,7 +41,7 @@ func SuccessOrRedirectOrUnauthorizedResponseValidator(req *http.Request, resp *h
 // New create a new PingOne client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewAccountTransport(idpAccount)
 
 	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
@@ -186,51 +184,7 @@ func (ac *Client) handleOTP(ctx context.Context, doc *goquery.Document, _ *http.
 }
 
 func (ac *Client) handleSwipe(ctx context.Context, doc *goquery.Document, _ *http.Response) (context.Context, *http.Request, error) {
-	form, err := page.NewFormFromDocument(doc, "#form1")
-	if err != nil {
-		return ctx, nil, errors.Wrap(err, "error extracting swipe status form")
-	}
-
-	// poll status. request must specifically be a GET
-	form.Method = "GET"
-	req, err := form.BuildRequest()
-	if err != nil {
-		return ctx, nil, err
-	}
-
-	for {
-		time.Sleep(3 * time.Second)
-
-		res, err := ac.client.Do(req)
-		if err != nil {
-			return ctx, nil, errors.Wrap(err, "error polling swipe status")
-		}
-
-		body, err := ioutil.ReadAll(res.Body)
-		if err != nil {
-			return ctx, nil, errors.Wrap(err, "error parsing body from swipe status response")
-		}
-
-		resp := string(body)
-
-		pingfedMFAStatusResponse := gjson.Get(resp, "status").String()
-
-		//ASYNC_AUTH_WAIT indicates we keep going
-		//OK indicates someone swiped
-		//DEVICE_CLAIM_TIMEOUT indicates nobody swiped
-		//otherwise loop forever?
-
-		if pingfedMFAStatusResponse == "OK" || pingfedMFAStatusResponse == "DEVICE_CLAIM_TIMEOUT" || pingfedMFAStatusResponse == "TIMEOUT" {
-			break
-		}
-	}
-
-	// now build a request for getting response of MFA
-	form, err = page.NewFormFromDocument(doc, "#reponseView")
-	if err != nil {
-		return ctx, nil, errors.Wrap(err, "error extracting swipe response form")
-	}
-	req, err = form.BuildRequest()
+	req, err := pingid.WaitForApproval(ac.client, doc, ac.idpAccount.MFAWaitTimeout(pingid.DefaultTimeout), ac.idpAccount.MFAWaitInterval(pingid.DefaultPollInterval))
 	return ctx, req, err
 }
 
@@ -267,33 +221,7 @@ func (ac *Client) handleRefresh(ctx context.Context, doc *goquery.Document, _ *h
 }
 
 func (ac *Client) handleFormSelectDevice(ctx context.Context, doc *goquery.Document, res *http.Response) (context.Context, *http.Request, error) {
-	deviceList := make(map[string]string)
-	var deviceNameList []string
-
-	doc.Find("ul.device-list > li").Each(func(_ int, s *goquery.Selection) {
-		deviceId, _ := s.Attr("data-id")
-		deviceName, _ := s.Find("a > div.device-name").Html()
-
-		logger.WithField("device name", deviceName).WithField("device id", deviceId).Debug("Select Device")
-		deviceList[deviceName] = deviceId
-		deviceNameList = append(deviceNameList, deviceName)
-	})
-
-	var chooseDevice = prompter.Choose("Select which MFA Device to use", deviceNameList)
-
-	form, err := page.NewFormFromDocument(doc, "")
-	if err != nil {
-		return ctx, nil, errors.Wrap(err, "error extracting select device form")
-	}
-
-	form.Values.Set("deviceId", deviceList[deviceNameList[chooseDevice]])
-	form.URL, err = makeAbsoluteURL(form.URL, makeBaseURL(res.Request.URL))
-	if err != nil {
-		return ctx, nil, err
-	}
-
-	logger.WithField("value", form.Values.Encode()).Debug("Select Device")
-	req, err := form.BuildRequest()
+	req, err := pingid.SelectDevice(doc, ac.idpAccount.MFADevice)
 	return ctx, req, err
 }
 
@@ -330,7 +258,7 @@ func docIsFormRedirectToAlibabaCloud(doc *goquery.Document) bool {
 }
 
 func docIsFormSelectDevice(doc *goquery.Document) bool {
-	return doc.Has("form[name=\"device-form\"]").Size() == 1
+	return pingid.IsDeviceSelection(doc)
 }
 
 func docIsRefresh(doc *goquery.Document) bool {
@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultProbeTimeout the overall time allowed for probing the IdP mirrors
+	DefaultProbeTimeout = 10 * time.Second
+
+	// probeStagger delay before the next mirror is probed if the previous ones haven't answered yet
+	probeStagger = 250 * time.Millisecond
+)
+
+type probeResult struct {
+	url string
+	err error
+}
+
+// ProbeFastestURL probe the supplied IdP URLs in parallel, happy eyeballs style, and return the first one to respond.
+// Each URL is started after a short stagger unless an earlier probe fails, any HTTP response counts as reachable.
+func ProbeFastestURL(tr http.RoundTripper, urls []string, timeout time.Duration) (string, error) {
+	if len(urls) == 0 {
+		return "", fmt.Errorf("no IdP URLs to probe")
+	}
+	if len(urls) == 1 {
+		return urls[0], nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	client := &http.Client{
+		Transport: tr,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	results := make(chan probeResult, len(urls))
+	failed := make(chan struct{}, len(urls))
+
+	go func() {
+		for i, u := range urls {
+			if i > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-failed:
+				case <-time.After(probeStagger):
+				}
+			}
+			go func(u string) {
+				err := probe(ctx, client, u)
+				if err != nil {
+					failed <- struct{}{}
+				}
+				results <- probeResult{url: u, err: err}
+			}(u)
+		}
+	}()
+
+	var lastErr error
+	for range urls {
+		select {
+		case res := <-results:
+			if res.err == nil {
+				logrus.WithField("url", res.url).Debug("IdP mirror selected")
+				return res.url, nil
+			}
+			logrus.WithField("url", res.url).WithField("err", res.err).Debug("IdP mirror unreachable")
+			lastErr = res.err
+		case <-ctx.Done():
+			return "", fmt.Errorf("no IdP mirror responded within %v", timeout)
+		}
+	}
+
+	return "", fmt.Errorf("no IdP mirror is reachable: %v", lastErr)
+}
+
+func probe(ctx context.Context, client *http.Client, u string) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
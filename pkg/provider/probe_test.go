@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeFastestURL(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+		w.Write([]byte("OK"))
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer fast.Close()
+
+	u, err := ProbeFastestURL(NewDefaultTransport(false), []string{slow.URL, fast.URL}, DefaultProbeTimeout)
+	require.Nil(t, err)
+	require.Equal(t, fast.URL, u)
+}
+
+func TestProbeFastestURLUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	_, err := ProbeFastestURL(NewDefaultTransport(false), []string{ts.URL, ts.URL + "/other"}, DefaultProbeTimeout)
+	require.Error(t, err)
+}
+
+func TestProbeFastestURLSingle(t *testing.T) {
+	u, err := ProbeFastestURL(NewDefaultTransport(false), []string{"https://id.example.com"}, DefaultProbeTimeout)
+	require.Nil(t, err)
+	require.Equal(t, "https://id.example.com", u)
+}
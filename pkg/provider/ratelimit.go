@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/idn"
+)
+
+// DefaultRateLimitWindow how long a login waits in total for an IdP throttling its requests
+const DefaultRateLimitWindow = time.Minute
+
+// rateLimitRetryDelay delay before the first retry when the IdP doesn't send a Retry-After, doubled at each attempt,
+// replaced in tests
+var rateLimitRetryDelay = 2 * time.Second
+
+// RateLimitError returned when the IdP keeps throttling the requests for the whole retry window
+type RateLimitError struct {
+	URL        string
+	Status     string
+	Waited     time.Duration
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	msg := fmt.Sprintf("identity provider at %s is throttling the requests (status: %s)", e.URL, e.Status)
+	if e.Waited > 0 {
+		msg += fmt.Sprintf(", still throttled after waiting %v", e.Waited)
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", it asks to retry in %v", e.RetryAfter)
+	}
+	return msg + ", try again later"
+}
+
+// RetryAfter the delay the Retry-After header of the response asks for, in seconds or as an HTTP date, false when
+// the header is missing or invalid
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
+// isRateLimited a 429, or a 503 with a Retry-After, the other 503 are maintenance pages
+func isRateLimited(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	_, ok := RetryAfter(resp, time.Now())
+	return resp.StatusCode == http.StatusServiceUnavailable && ok
+}
+
+// waitOutRateLimit retry the request while the IdP throttles it, honouring its Retry-After, up to the configured window.
+// A 503 asking for more than the window is left to the maintenance handling.
+func (hc *HTTPClient) waitOutRateLimit(req *http.Request, resp *http.Response) (*http.Response, error) {
+	window := DefaultRateLimitWindow
+	if hc.Options != nil && hc.Options.RateLimitWindow != 0 {
+		window = hc.Options.RateLimitWindow
+	}
+
+	start := time.Now()
+	backoff := rateLimitRetryDelay
+
+	for isRateLimited(resp) {
+		waited := time.Since(start)
+
+		retryAfter, _ := RetryAfter(resp, time.Now())
+		delay := retryAfter
+		if delay == 0 {
+			delay = backoff
+			backoff *= 2
+		}
+
+		// requests with a body which can't be replayed are only attempted once
+		if window < 0 || waited+delay > window || (req.Body != nil && req.GetBody == nil) {
+			if resp.StatusCode == http.StatusServiceUnavailable {
+				return resp, nil
+			}
+			return resp, &RateLimitError{URL: req.URL.Host, Status: resp.Status, Waited: waited, RetryAfter: retryAfter}
+		}
+
+		log.Printf("%s is throttling the requests (status: %s), retrying in %v", idn.Display(req.URL.Host), resp.Status, delay)
+		resp.Body.Close()
+
+		if err := hc.Sleep(delay); err != nil {
+			return nil, err
+		}
+
+		var err error
+		resp, err = hc.resend(req)
+		if err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	retryAfter := func(value string) (time.Duration, bool) {
+		return RetryAfter(&http.Response{Header: http.Header{"Retry-After": []string{value}}}, now)
+	}
+
+	delay, ok := retryAfter("30")
+	require.True(t, ok)
+	require.Equal(t, 30*time.Second, delay)
+
+	delay, ok = retryAfter("Tue, 01 Jun 2021 12:01:00 GMT")
+	require.True(t, ok)
+	require.Equal(t, time.Minute, delay)
+
+	delay, ok = retryAfter("Tue, 01 Jun 2021 11:59:00 GMT")
+	require.True(t, ok)
+	require.Equal(t, time.Duration(0), delay)
+
+	_, ok = retryAfter("soon")
+	require.False(t, ok)
+	_, ok = retryAfter("")
+	require.False(t, ok)
+}
+
+func TestClientWaitsOutRateLimit(t *testing.T) {
+	rateLimitRetryDelay = 10 * time.Millisecond
+	defer func() { rateLimitRetryDelay = 2 * time.Second }()
+
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+
+	hc, err := NewHTTPClient(NewDefaultTransport(false), &HTTPClientOptions{})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest("POST", ts.URL, strings.NewReader("username=user"))
+	require.Nil(t, err)
+
+	res, err := hc.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	require.Equal(t, 3, attempts)
+}
+
+func TestClientRateLimitWindow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	hc, err := NewHTTPClient(NewDefaultTransport(false), &HTTPClientOptions{})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	require.Nil(t, err)
+
+	_, err = hc.Do(req)
+	require.IsType(t, &RateLimitError{}, err)
+	require.Contains(t, err.Error(), "it asks to retry in 2m0s")
+}
+
+func TestClientRateLimitLeavesLongOutagesToMaintenance(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	hc, err := NewHTTPClient(NewDefaultTransport(false), &HTTPClientOptions{MaintenanceWindow: -1})
+	require.Nil(t, err)
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	require.Nil(t, err)
+
+	_, err = hc.Do(req)
+	require.IsType(t, &MaintenanceError{}, err)
+}
@@ -0,0 +1,159 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// WrapTransport when set wraps the transport of every client built with NewHTTPClient, used to record or replay
+// the IdP exchanges of a login
+var WrapTransport func(http.RoundTripper) http.RoundTripper
+
+// Exchange a recorded request to the IdP along with its response, request bodies are never recorded as they hold
+// the credentials
+type Exchange struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// Recorder keeps a copy of every exchange made through the transports it wraps
+type Recorder struct {
+	mu        sync.Mutex
+	exchanges []*Exchange
+}
+
+// Wrap return a transport sending the requests with tr and recording the responses
+func (r *Recorder) Wrap(tr http.RoundTripper) http.RoundTripper {
+	return &recordingTransport{recorder: r, transport: tr}
+}
+
+type recordingTransport struct {
+	recorder  *Recorder
+	transport http.RoundTripper
+}
+
+// RoundTrip send the request with the underlying transport and record the response
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := rt.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	rt.recorder.mu.Lock()
+	defer rt.recorder.mu.Unlock()
+
+	rt.recorder.exchanges = append(rt.recorder.exchanges, &Exchange{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: res.StatusCode,
+		Header: res.Header,
+		Body:   string(body),
+	})
+
+	return res, nil
+}
+
+// Save write the recorded exchanges to filename
+func (r *Recorder) Save(filename string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r.exchanges, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+// Replayer a transport answering the requests from recorded exchanges, in the order they were recorded, without
+// any network access
+type Replayer struct {
+	mu        sync.Mutex
+	exchanges []*Exchange
+	next      int
+}
+
+// LoadReplayer read the exchanges written by Recorder.Save
+func LoadReplayer(filename string) (*Replayer, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading recorded exchanges")
+	}
+
+	var exchanges []*Exchange
+	if err := json.Unmarshal(data, &exchanges); err != nil {
+		return nil, errors.Wrapf(err, "error decoding recorded exchanges %s", filename)
+	}
+
+	return &Replayer{exchanges: exchanges}, nil
+}
+
+// RoundTrip answer the request with the next recorded exchange, the method and path must match the recording, the
+// query may differ as it often carries generated state
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next >= len(r.exchanges) {
+		return nil, fmt.Errorf("unexpected request %s %s, all %d recorded exchanges have been replayed", req.Method, req.URL.Path, len(r.exchanges))
+	}
+
+	exchange := r.exchanges[r.next]
+
+	recorded, err := url.Parse(exchange.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing recorded URL")
+	}
+	if exchange.Method != req.Method || recorded.Path != req.URL.Path {
+		return nil, fmt.Errorf("request %d doesn't match the recording, expected %s %s, got %s %s", r.next+1, exchange.Method, recorded.Path, req.Method, req.URL.Path)
+	}
+
+	r.next++
+
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	header := exchange.Header
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.Status, http.StatusText(exchange.Status)),
+		StatusCode:    exchange.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(exchange.Body))),
+		ContentLength: int64(len(exchange.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Remaining the number of recorded exchanges which haven't been replayed
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.exchanges) - r.next
+}
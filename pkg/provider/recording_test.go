@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.Redirect(w, r, "/form?state=live", http.StatusFound)
+		case "/form":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<form></form>"))
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "recording")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "Auto.json")
+
+	recorder := &Recorder{}
+	hc, err := NewHTTPClient(recorder.Wrap(NewDefaultTransport(false)), &HTTPClientOptions{})
+	require.Nil(t, err)
+
+	res, err := hc.Get(ts.URL + "/login")
+	require.Nil(t, err)
+	res.Body.Close()
+	require.Nil(t, recorder.Save(filename))
+
+	replayer, err := LoadReplayer(filename)
+	require.Nil(t, err)
+	require.Equal(t, 2, replayer.Remaining())
+
+	// the server is gone, everything comes from the recording
+	ts.Close()
+
+	hc, err = NewHTTPClient(replayer, &HTTPClientOptions{})
+	require.Nil(t, err)
+
+	res, err = hc.Get(ts.URL + "/login")
+	require.Nil(t, err)
+	body, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	require.Equal(t, "<form></form>", string(body))
+	require.Equal(t, "text/html", res.Header.Get("Content-Type"))
+	require.Equal(t, 0, replayer.Remaining())
+
+	_, err = hc.Get(ts.URL + "/login")
+	require.NotNil(t, err)
+}
+
+func TestReplayMismatch(t *testing.T) {
+	replayer := &Replayer{exchanges: []*Exchange{{Method: "GET", URL: "https://idp.example.com/login", Status: 200}}}
+
+	req, err := http.NewRequest("POST", "https://idp.example.com/login", nil)
+	require.Nil(t, err)
+
+	_, err = replayer.RoundTrip(req)
+	require.EqualError(t, err, "request 1 doesn't match the recording, expected GET /login, got POST /login")
+}
@@ -0,0 +1,262 @@
+package rippling
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// the states of the authentication and of the approvals returned by the Rippling login API
+const (
+	statusSuccess        = "SUCCESS"
+	statusMfaRequired    = "MFA_REQUIRED"
+	statusDeviceApproval = "DEVICE_APPROVAL_REQUIRED"
+	statusPending        = "PENDING"
+	statusApproved       = "APPROVED"
+	statusDenied         = "DENIED"
+	statusExpired        = "EXPIRED"
+)
+
+// the Rippling names of the second factors
+const (
+	methodPush = "push"
+	methodTOTP = "totp"
+	methodSMS  = "sms"
+)
+
+// maxApprovalPolls the number of times a pending approval is checked before giving up
+const maxApprovalPolls = 60
+
+// approvalPeriod how long to wait between two polls of a pending approval
+var approvalPeriod = 2 * time.Second
+
+var logger = logrus.WithField("provider", "rippling")
+
+// Client wrapper around Rippling
+type Client struct {
+	client *provider.HTTPClient
+	mfa    string
+}
+
+// New create a new Rippling client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		mfa:    idpAccount.MFA,
+	}, nil
+}
+
+// Authenticate logs into Rippling through its login API, waiting for the sign in to be approved from the Rippling
+// app when the device isn't trusted or a push is the second factor, and returns the SAML response of the RAM app
+func (rc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := rc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	// an existing session goes straight to the assertion
+	if samlAssertion, err := extractSAMLResponse(res); err != nil || samlAssertion != "" {
+		return samlAssertion, err
+	}
+
+	base := fmt.Sprintf("%s://%s", res.Request.URL.Scheme, res.Request.URL.Host)
+
+	resp, err := rc.call(base+"/api/auth/login", map[string]string{
+		"username": loginDetails.Username,
+		"password": loginDetails.Password,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error logging in")
+	}
+
+	for step := 0; gjson.Get(resp, "status").String() != statusSuccess; step++ {
+		if step == 2 {
+			return "", errors.New("login failed: Rippling keeps asking for verification")
+		}
+
+		switch status := gjson.Get(resp, "status").String(); status {
+		case statusMfaRequired:
+			resp, err = rc.verifyMfa(base, resp, loginDetails)
+		case statusDeviceApproval:
+			log.Println("Rippling doesn't recognize this device, approve the sign in from the Rippling app or the email sent to you")
+			resp, err = rc.waitForApproval(base+"/api/auth/device_approval/status", gjson.Get(resp, "token").String())
+		default:
+			return "", fmt.Errorf("unexpected Rippling authentication status: %s", status)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	res, err = rc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving SAML response")
+	}
+
+	samlAssertion, err := extractSAMLResponse(res)
+	if err != nil {
+		return "", err
+	}
+	if samlAssertion == "" {
+		return "", errors.New("no SAML response returned by Rippling, check the user is assigned the Alibaba Cloud app")
+	}
+
+	return samlAssertion, nil
+}
+
+// verifyMfa complete the second factor, Auto uses the first the user has set up
+func (rc *Client) verifyMfa(base, resp string, loginDetails *creds.LoginDetails) (string, error) {
+	token := gjson.Get(resp, "token").String()
+
+	method, ok := rc.selectMethod(gjson.Get(resp, "methods").Array())
+	if !ok {
+		return "", fmt.Errorf("no supported Rippling MFA method for MFA type %s, set up the Rippling app, an authenticator app or SMS", rc.mfa)
+	}
+
+	logger.WithField("method", method).Debug("verifying second factor")
+
+	switch method {
+	case methodPush:
+		_, err := rc.call(base+"/api/auth/mfa/push/send", map[string]string{"token": token})
+		if err != nil {
+			return "", errors.Wrap(err, "error sending push notification")
+		}
+		log.Println("Approve the sign in from the Rippling app")
+		return rc.waitForApproval(base+"/api/auth/mfa/push/status", token)
+	case methodSMS:
+		_, err := rc.call(base+"/api/auth/mfa/sms/send", map[string]string{"token": token})
+		if err != nil {
+			return "", errors.Wrap(err, "error sending SMS code")
+		}
+		log.Println("Rippling has texted a verification code to your phone")
+	}
+
+	code := loginDetails.MFAToken
+	if code == "" {
+		code = prompter.RequestSecurityCode("000000")
+	}
+
+	resp, err := rc.call(base+"/api/auth/mfa/verify", map[string]string{
+		"token":  token,
+		"method": method,
+		"code":   code,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error verifying MFA")
+	}
+
+	return resp, nil
+}
+
+func (rc *Client) selectMethod(methods []gjson.Result) (string, bool) {
+	for _, m := range methods {
+		method := m.String()
+		if method != methodPush && method != methodTOTP && method != methodSMS {
+			continue
+		}
+		if strings.EqualFold(rc.mfa, "Auto") || strings.EqualFold(rc.mfa, method) {
+			return method, true
+		}
+	}
+	return "", false
+}
+
+// waitForApproval poll the status of a push or device approval until it is answered, returning the response of the
+// approved sign in
+func (rc *Client) waitForApproval(location, token string) (string, error) {
+	for i := 0; i < maxApprovalPolls; i++ {
+		resp, err := rc.call(location, map[string]string{"token": token})
+		if err != nil {
+			return "", errors.Wrap(err, "error checking approval status")
+		}
+
+		switch status := gjson.Get(resp, "approval").String(); status {
+		case statusApproved:
+			return resp, nil
+		case statusDenied:
+			return "", errors.New("the sign in was denied from the Rippling app")
+		case statusExpired:
+			return "", errors.New("the approval request expired, login again")
+		case statusPending:
+			if err := rc.client.Sleep(approvalPeriod); err != nil {
+				return "", errors.Wrap(err, "error waiting for the approval")
+			}
+		default:
+			return "", fmt.Errorf("unexpected Rippling approval status: %s", status)
+		}
+	}
+
+	return "", errors.New("timed out waiting for the sign in to be approved")
+}
+
+func (rc *Client) call(location string, body interface{}) (string, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", location, bytes.NewReader(data))
+	if err != nil {
+		return "", errors.Wrap(err, "error building request")
+	}
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := rc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving response")
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body")
+	}
+
+	resp := string(resBody)
+
+	if res.StatusCode >= 400 {
+		msg := gjson.Get(resp, "error").String()
+		if msg == "" {
+			msg = res.Status
+		}
+		return "", fmt.Errorf("Rippling returned an error: %s", msg)
+	}
+
+	return resp, nil
+}
+
+// extractSAMLResponse the SAML response posted to Alibaba Cloud by the page, empty when the page has none
+func extractSAMLResponse(res *http.Response) (string, error) {
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build document from response")
+	}
+
+	samlAssertion, _ := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
+
+	return samlAssertion, nil
+}
@@ -0,0 +1,273 @@
+package rippling
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+const appPath = "/api/platform/sso/sp-initiated/5f3c2a1b9d8e7f6a5b4c3d2e"
+
+func TestAuthenticatePush(t *testing.T) {
+	approvalPeriod = 0
+
+	mfaResp, err := ioutil.ReadFile("example/mfa.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	approvals := []string{"PENDING", "PENDING", "APPROVED"}
+	var calls []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+
+		body := map[string]string{}
+		if r.Method == "POST" {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		}
+
+		switch r.URL.Path {
+		case appPath:
+			if _, err := r.Cookie("session"); err == nil {
+				w.Write(assertionPage)
+				return
+			}
+			http.Redirect(w, r, "/login?next="+appPath, http.StatusFound)
+		case "/login":
+			w.Write([]byte(`<html><body><div id="app"></div></body></html>`))
+		case "/api/auth/login":
+			require.Equal(t, "user@example.com", body["username"])
+			require.Equal(t, "secret", body["password"])
+			w.Write(mfaResp)
+		case "/api/auth/mfa/push/send":
+			require.Equal(t, "mfa-token", body["token"])
+			w.Write([]byte(`{}`))
+		case "/api/auth/mfa/push/status":
+			approval := approvals[0]
+			approvals = approvals[1:]
+			if approval == "APPROVED" {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "session", Path: "/"})
+				w.Write([]byte(`{"status":"SUCCESS","approval":"APPROVED"}`))
+				return
+			}
+			w.Write([]byte(`{"approval":"` + approval + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + appPath,
+		Username: "user@example.com",
+		Password: "secret",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.Contains(t, calls, "/api/auth/mfa/push/send")
+	require.NotContains(t, calls, "/api/auth/mfa/verify")
+}
+
+func TestAuthenticateDeviceApproval(t *testing.T) {
+	approvalPeriod = 0
+
+	deviceResp, err := ioutil.ReadFile("example/device_approval.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	approvals := []string{"PENDING", "APPROVED"}
+	var calls []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+
+		body := map[string]string{}
+		if r.Method == "POST" {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		}
+
+		switch r.URL.Path {
+		case appPath:
+			if _, err := r.Cookie("session"); err == nil {
+				w.Write(assertionPage)
+				return
+			}
+			http.Redirect(w, r, "/login?next="+appPath, http.StatusFound)
+		case "/login":
+			w.Write([]byte(`<html><body><div id="app"></div></body></html>`))
+		case "/api/auth/login":
+			w.Write(deviceResp)
+		case "/api/auth/device_approval/status":
+			approval := approvals[0]
+			approvals = approvals[1:]
+			if approval == "APPROVED" {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "session", Path: "/"})
+				w.Write([]byte(`{"status":"SUCCESS","approval":"APPROVED"}`))
+				return
+			}
+			w.Write([]byte(`{"approval":"` + approval + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "TOTP"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + appPath,
+		Username: "user@example.com",
+		Password: "secret",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.Contains(t, calls, "/api/auth/device_approval/status")
+	require.NotContains(t, calls, "/api/auth/mfa/verify")
+}
+
+func TestAuthenticateTOTP(t *testing.T) {
+	mfaResp, err := ioutil.ReadFile("example/mfa.json")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	var calls []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+
+		body := map[string]string{}
+		if r.Method == "POST" {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		}
+
+		switch r.URL.Path {
+		case appPath:
+			if _, err := r.Cookie("session"); err == nil {
+				w.Write(assertionPage)
+				return
+			}
+			http.Redirect(w, r, "/login?next="+appPath, http.StatusFound)
+		case "/login":
+			w.Write([]byte(`<html><body><div id="app"></div></body></html>`))
+		case "/api/auth/login":
+			w.Write(mfaResp)
+		case "/api/auth/mfa/verify":
+			require.Equal(t, "mfa-token", body["token"])
+			require.Equal(t, "totp", body["method"])
+			require.Equal(t, "123456", body["code"])
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "session", Path: "/"})
+			w.Write([]byte(`{"status":"SUCCESS","approval":"APPROVED"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "TOTP"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + appPath,
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+	require.NotContains(t, calls, "/api/auth/mfa/push/send")
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case appPath:
+			http.Redirect(w, r, "/login?next="+appPath, http.StatusFound)
+		case "/login":
+			w.Write([]byte(`<html><body><div id="app"></div></body></html>`))
+		case "/api/auth/login":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Invalid email or password"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + appPath, Username: "user@example.com", Password: "wrong"})
+	require.EqualError(t, err, "error logging in: Rippling returned an error: Invalid email or password")
+}
+
+func TestAuthenticateDenied(t *testing.T) {
+	approvalPeriod = 0
+
+	mfaResp, err := ioutil.ReadFile("example/mfa.json")
+	require.Nil(t, err)
+
+	approvals := []string{"PENDING", "DENIED"}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case appPath:
+			http.Redirect(w, r, "/login?next="+appPath, http.StatusFound)
+		case "/login":
+			w.Write([]byte(`<html><body><div id="app"></div></body></html>`))
+		case "/api/auth/login":
+			w.Write(mfaResp)
+		case "/api/auth/mfa/push/send":
+			w.Write([]byte(`{}`))
+		case "/api/auth/mfa/push/status":
+			w.Write([]byte(`{"approval":"` + approvals[0] + `"}`))
+			approvals = approvals[1:]
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + appPath, Username: "user@example.com", Password: "secret"})
+	require.EqualError(t, err, "the sign in was denied from the Rippling app")
+}
+
+func TestAuthenticateUnsupportedMFA(t *testing.T) {
+	mfaResp, err := ioutil.ReadFile("example/mfa.json")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case appPath:
+			http.Redirect(w, r, "/login?next="+appPath, http.StatusFound)
+		case "/login":
+			w.Write([]byte(`<html><body><div id="app"></div></body></html>`))
+		case "/api/auth/login":
+			w.Write(mfaResp)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "SMS"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{URL: ts.URL + appPath, Username: "user@example.com", Password: "secret"})
+	require.EqualError(t, err, "no supported Rippling MFA method for MFA type SMS, set up the Rippling app, an authenticator app or SMS")
+}
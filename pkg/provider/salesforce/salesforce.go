@@ -0,0 +1,176 @@
+package salesforce
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	loginFormFilter = "form:has(input[name=\"pw\"])"
+
+	// verificationFilter the code inputs of the identity verification pages, emc for the code sent by email, tc for
+	// the code of Salesforce Authenticator or an authenticator app, smc for the code sent by SMS
+	verificationFilter     = "input[name=\"emc\"], input[name=\"tc\"], input[name=\"smc\"]"
+	verificationFormFilter = "form:has(input[name=\"emc\"]), form:has(input[name=\"tc\"]), form:has(input[name=\"smc\"])"
+)
+
+// redirectRegexp the script Salesforce answers with once logged in, sending the browser on to the start URL
+var redirectRegexp = regexp.MustCompile(`(?:window\.location\.(?:href\s*=|replace\()|location\.href\s*=|handleRedirect\()\s*['"]([^'"]+)['"]`)
+
+var logger = logrus.WithField("provider", "salesforce")
+
+// Client wrapper around Salesforce Identity
+type Client struct {
+	client *provider.HTTPClient
+}
+
+// New create a new Salesforce client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+	}, nil
+}
+
+// Authenticate logs into Salesforce, completing the identity verification challenge when the org asks for one, and
+// returns the SAML response of the connected app
+func (sc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := sc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	passwordSubmitted := false
+	codeSubmitted := false
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		switch {
+		case doc.Find(verificationFilter).Size() > 0:
+			// a rejected code shows the same page again
+			if codeSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid verification code"))
+			}
+			codeSubmitted = true
+			res, err = sc.submitVerification(doc, loginDetails)
+		case doc.Find(loginFormFilter).Size() > 0:
+			if passwordSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid username or password"))
+			}
+			passwordSubmitted = true
+			res, err = sc.submitLogin(doc, loginDetails)
+		default:
+			location, ok := findRedirect(doc)
+			if !ok {
+				return "", fmt.Errorf("unexpected page returned by Salesforce: %s", doc.Url.String())
+			}
+			res, err = sc.follow(doc, location)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("Salesforce login did not complete after %d steps", page.MaxSteps)
+}
+
+func (sc *Client) submitLogin(doc *goquery.Document, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	return page.SubmitForm(sc.client, doc, loginFormFilter, func(form *page.Form, _ *goquery.Selection) {
+		form.Values.Set("username", loginDetails.Username)
+		form.Values.Set("un", loginDetails.Username)
+		form.Values.Set("pw", loginDetails.Password)
+	})
+}
+
+// submitVerification enter the verification code, taken from --mfa-token when it is given
+func (sc *Client) submitVerification(doc *goquery.Document, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	name, _ := doc.Find(verificationFilter).First().Attr("name")
+
+	code := loginDetails.MFAToken
+	if code == "" {
+		switch name {
+		case "emc":
+			log.Println("Salesforce has emailed you a verification code")
+		case "smc":
+			log.Println("Salesforce has texted you a verification code")
+		}
+		code = prompter.RequestSecurityCode("000000")
+	}
+
+	return page.SubmitForm(sc.client, doc, verificationFormFilter, func(form *page.Form, _ *goquery.Selection) {
+		form.Values.Set(name, code)
+	})
+}
+
+func (sc *Client) follow(doc *goquery.Document, location string) (*http.Response, error) {
+	location, err := page.ResolveURL(doc.Url, location)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving redirect")
+	}
+
+	logger.WithField("url", location).Debug("following redirect")
+
+	res, err := sc.client.Get(location)
+	if err != nil {
+		return nil, errors.Wrap(err, "error following redirect")
+	}
+
+	return res, nil
+}
+
+// findRedirect the location a page sends the browser to, by script or meta refresh
+func findRedirect(doc *goquery.Document) (string, bool) {
+	if content, ok := doc.Find("meta[http-equiv=\"Refresh\"], meta[http-equiv=\"refresh\"]").Attr("content"); ok {
+		if i := strings.Index(strings.ToLower(content), "url="); i >= 0 {
+			return strings.Trim(content[i+4:], "'\" "), true
+		}
+	}
+
+	var location string
+	doc.Find("script").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if match := redirectRegexp.FindStringSubmatch(s.Text()); match != nil {
+			location = html.UnescapeString(strings.ReplaceAll(match[1], `\/`, "/"))
+			return false
+		}
+		return true
+	})
+
+	return location, location != ""
+}
+
+func loginError(doc *goquery.Document, fallback string) string {
+	msg := strings.TrimSpace(doc.Find("#error, .loginError, .errorMsg, .message.errorM3 .messageText").First().Text())
+	if msg == "" {
+		msg = fallback
+	}
+	return msg
+}
@@ -0,0 +1,133 @@
+package salesforce
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+	verifyPage, err := ioutil.ReadFile("example/verify.html")
+	require.Nil(t, err)
+	redirectPage, err := ioutil.ReadFile("example/redirect.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch {
+		case r.URL.Path == "/idp/login":
+			require.Equal(t, "0sp5g000000XYZA", r.URL.Query().Get("app"))
+			if _, err := r.Cookie("sid"); err != nil {
+				http.Redirect(w, r, "/?startURL=%2Fidp%2Flogin%3Fapp%3D0sp5g000000XYZA", http.StatusFound)
+				return
+			}
+			w.Write(assertionPage)
+		case r.URL.Path == "/" && r.Method == "GET":
+			w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), nil, 1))
+		case r.URL.Path == "/":
+			require.Equal(t, "user@example.com", r.PostForm.Get("username"))
+			require.Equal(t, "user@example.com", r.PostForm.Get("un"))
+			require.Equal(t, "secret", r.PostForm.Get("pw"))
+			require.Equal(t, "/idp/login?app=0sp5g000000XYZA", r.PostForm.Get("startURL"))
+			http.Redirect(w, r, "/_ui/identity/verification/method/EmailVerificationFinishUi/e", http.StatusFound)
+		case r.URL.Path == "/_ui/identity/verification/method/EmailVerificationFinishUi/e" && r.Method == "GET":
+			w.Write(bytes.Replace(verifyPage, []byte("{{ERROR}}"), nil, 1))
+		case r.URL.Path == "/_ui/identity/verification/method/EmailVerificationFinishUi/e":
+			require.Equal(t, "confirmation-token", r.PostForm.Get("_CONFIRMATIONTOKEN"))
+			require.Equal(t, "12345", r.PostForm.Get("emc"))
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "session", Path: "/"})
+			w.Write(redirectPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/idp/login?app=0sp5g000000XYZA",
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "12345",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/idp/login":
+			http.Redirect(w, r, "/?startURL=%2Fidp%2Flogin%3Fapp%3D0sp5g000000XYZA", http.StatusFound)
+		case r.URL.Path == "/" && r.Method == "GET":
+			w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), nil, 1))
+		case r.URL.Path == "/":
+			w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), []byte(`<div id="error" class="loginError">Please check your username and password. If you still can't log in, contact your Salesforce administrator.</div>`), 1))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/idp/login?app=0sp5g000000XYZA",
+		Username: "user@example.com",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "login failed: Please check your username and password. If you still can't log in, contact your Salesforce administrator.")
+}
+
+func TestAuthenticateBadCode(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+	verifyPage, err := ioutil.ReadFile("example/verify.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/idp/login":
+			http.Redirect(w, r, "/?startURL=%2Fidp%2Flogin%3Fapp%3D0sp5g000000XYZA", http.StatusFound)
+		case r.URL.Path == "/" && r.Method == "GET":
+			w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), nil, 1))
+		case r.URL.Path == "/":
+			http.Redirect(w, r, "/_ui/identity/verification/method/EmailVerificationFinishUi/e", http.StatusFound)
+		case r.URL.Path == "/_ui/identity/verification/method/EmailVerificationFinishUi/e" && r.Method == "GET":
+			w.Write(bytes.Replace(verifyPage, []byte("{{ERROR}}"), nil, 1))
+		case r.URL.Path == "/_ui/identity/verification/method/EmailVerificationFinishUi/e":
+			w.Write(bytes.Replace(verifyPage, []byte("{{ERROR}}"), []byte(`<div id="error" class="loginError">Invalid verification code. Try again.</div>`), 1))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/idp/login?app=0sp5g000000XYZA",
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "00000",
+	})
+	require.EqualError(t, err, "login failed: Invalid verification code. Try again.")
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/mfa/duouniversal"
 	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/pkg/errors"
@@ -25,6 +26,7 @@ import (
 type Client struct {
 	client     *provider.HTTPClient
 	idpAccount *cfg.IDPAccount
+	duo        *duouniversal.Prompt
 }
 
 // New create a new Shibboleth client
@@ -32,10 +34,10 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
 	tr := &http.Transport{
 		Proxy:           http.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: idpAccount.SkipVerify, Renegotiation: tls.RenegotiateFreelyAsClient},
+		TLSClientConfig: &tls.Config{Renegotiation: tls.RenegotiateFreelyAsClient},
 	}
 
-	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	client, err := provider.NewHTTPClient(provider.ScopeSkipVerify(tr, idpAccount.SkipVerifyHostList()), provider.BuildHttpClientOpts(idpAccount))
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
@@ -43,6 +45,7 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 	return &Client{
 		client:     client,
 		idpAccount: idpAccount,
+		duo:        duouniversal.New(client, idpAccount.MFA, idpAccount.MFAWaitTimeout(duouniversal.DefaultTimeout), idpAccount.MFAWaitInterval(duouniversal.DefaultPollInterval)),
 	}, nil
 }
 
@@ -96,8 +99,19 @@ func (sc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		return samlAssertion, errors.Wrap(err, "error retrieving login form results")
 	}
 
-	switch sc.idpAccount.MFA {
-	case "Auto":
+	switch {
+	case duouniversal.IsPrompt(res.Request.URL):
+		// the Duo Universal Prompt plugin redirects to Duo instead of embedding the Duo iframe
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return samlAssertion, errors.Wrap(err, "failed to build document from response")
+		}
+
+		res, err = sc.duo.Complete(doc, loginDetails)
+		if err != nil {
+			return samlAssertion, errors.Wrap(err, "error verifying MFA")
+		}
+	case sc.idpAccount.MFA == "Auto":
 		b, _ := ioutil.ReadAll(res.Body)
 
 		mfaRes, err := verifyMfa(sc, loginDetails.URL, string(b))
@@ -310,7 +324,9 @@ func verifyDuoMfa(oc *Client, duoHost string, parent string, tx string) (string,
 	if duoTxResult != "SUCCESS" {
 		//poll as this is likely a push request
 		for {
-			time.Sleep(3 * time.Second)
+			if err := oc.client.Sleep(3 * time.Second); err != nil {
+				return "", errors.Wrap(err, "error waiting for the duo approval")
+			}
 
 			req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
 			if err != nil {
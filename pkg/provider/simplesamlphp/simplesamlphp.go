@@ -0,0 +1,142 @@
+package simplesamlphp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	loginFormFilter = "form:has(input[name=\"password\"])"
+
+	// otpFilter the code input of the TOTP modules, code for totp and authtotp, otp for the others
+	otpFilter     = "input[name=\"code\"], input[name=\"otp\"]"
+	otpFormFilter = "form:has(input[name=\"code\"]), form:has(input[name=\"otp\"])"
+
+	// consentFilter the form of the consent module accepting the attribute release
+	consentFilter = "form:has(button[name=\"yes\"]), form:has(input[name=\"yes\"])"
+)
+
+var logger = logrus.WithField("provider", "simplesamlphp")
+
+// Client wrapper around SimpleSAMLphp
+type Client struct {
+	client *provider.HTTPClient
+}
+
+// New create a new SimpleSAMLphp client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+	}, nil
+}
+
+// Authenticate logs into SimpleSAMLphp through the username and password form of the stock themes, entering the TOTP
+// code when a TOTP module asks for one, and returns a SAML response
+func (sc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := sc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	passwordSubmitted := false
+	otpSubmitted := false
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		switch {
+		case doc.Find(otpFilter).Size() > 0:
+			// a rejected code shows the same form again
+			if otpSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid verification code"))
+			}
+			otpSubmitted = true
+			res, err = sc.submitOTP(doc, loginDetails)
+		case doc.Find(loginFormFilter).Size() > 0:
+			if passwordSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid username or password"))
+			}
+			passwordSubmitted = true
+			res, err = sc.submitLogin(doc, loginDetails)
+		case doc.Find(consentFilter).Size() > 0:
+			res, err = sc.submitConsent(doc)
+		default:
+			return "", fmt.Errorf("unexpected page returned by SimpleSAMLphp: %s", doc.Url.String())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("SimpleSAMLphp login did not complete after %d steps", page.MaxSteps)
+}
+
+func (sc *Client) submitLogin(doc *goquery.Document, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	return page.SubmitForm(sc.client, doc, loginFormFilter, func(form *page.Form, _ *goquery.Selection) {
+		form.Values.Set("username", loginDetails.Username)
+		form.Values.Set("password", loginDetails.Password)
+	})
+}
+
+// submitOTP enter the TOTP code, taken from --mfa-token when it is given
+func (sc *Client) submitOTP(doc *goquery.Document, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	name, _ := doc.Find(otpFilter).First().Attr("name")
+
+	code := loginDetails.MFAToken
+	if code == "" {
+		code = prompter.RequestSecurityCode("000000")
+	}
+
+	return page.SubmitForm(sc.client, doc, otpFormFilter, func(form *page.Form, _ *goquery.Selection) {
+		form.Values.Set(name, code)
+	})
+}
+
+// submitConsent release the attributes Alibaba Cloud needs to map the user to a role
+func (sc *Client) submitConsent(doc *goquery.Document) (*http.Response, error) {
+	logger.Debug("approving attribute release")
+
+	return page.SubmitForm(sc.client, doc, consentFilter, func(form *page.Form, _ *goquery.Selection) {
+		yes := doc.Find(consentFilter).First().Find("[name=\"yes\"]").First()
+		form.Values.Set("yes", yes.AttrOr("value", "yes"))
+		// leave remembering the consent to the user, the checkbox is unchecked
+		form.Values.Del("saveconsent")
+	})
+}
+
+// loginError the message of the error box, .message-box.error in the 2.x theme, the heading next to the error icon
+// in the 1.x one
+func loginError(doc *goquery.Document, fallback string) string {
+	for _, filter := range []string{".message-box.error h3", ".erroricon ~ h2", ".message-box.error, .error"} {
+		if msg := strings.TrimSpace(doc.Find(filter).First().Text()); msg != "" {
+			return msg
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,137 @@
+package simplesamlphp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+const ssoPath = "/simplesaml/saml2/idp/SSOService.php"
+
+func TestAuthenticate(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+	otpPage, err := ioutil.ReadFile("example/otp.html")
+	require.Nil(t, err)
+	consentPage, err := ioutil.ReadFile("example/consent.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case ssoPath:
+			require.Equal(t, "urn:alibaba:cloudcomputing", r.URL.Query().Get("spentityid"))
+			http.Redirect(w, r, "/simplesaml/module.php/core/loginuserpass.php?AuthState=_auth-state", http.StatusFound)
+		case "/simplesaml/module.php/core/loginuserpass.php":
+			if r.Method == "GET" {
+				w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), nil, 1))
+				return
+			}
+			require.Equal(t, "_auth-state", r.PostForm.Get("AuthState"))
+			require.Equal(t, "user", r.PostForm.Get("username"))
+			require.Equal(t, "secret", r.PostForm.Get("password"))
+			w.Write(bytes.Replace(otpPage, []byte("{{ERROR}}"), nil, 1))
+		case "/simplesaml/module.php/totp/validate.php":
+			require.Equal(t, "_totp-state", r.PostForm.Get("StateId"))
+			require.Equal(t, "123456", r.PostForm.Get("code"))
+			w.Write(consentPage)
+		case "/simplesaml/module.php/consent/getconsent.php":
+			require.Equal(t, "GET", r.Method)
+			require.Equal(t, "_consent-state", r.URL.Query().Get("StateId"))
+			require.Equal(t, "yes", r.URL.Query().Get("yes"))
+			require.Empty(t, r.URL.Query().Get("saveconsent"))
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + ssoPath + "?spentityid=urn:alibaba:cloudcomputing",
+		Username: "user",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ssoPath:
+			http.Redirect(w, r, "/simplesaml/module.php/core/loginuserpass.php?AuthState=_auth-state", http.StatusFound)
+		case "/simplesaml/module.php/core/loginuserpass.php":
+			if r.Method == "GET" {
+				w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), nil, 1))
+				return
+			}
+			w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), []byte(`<div class="message-box error"><h3>Incorrect username or password</h3><p>Either no user with the given username could be found, or the password you gave was wrong.</p></div>`), 1))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + ssoPath + "?spentityid=urn:alibaba:cloudcomputing",
+		Username: "user",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "login failed: Incorrect username or password")
+}
+
+func TestAuthenticateBadCode(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+	otpPage, err := ioutil.ReadFile("example/otp.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ssoPath:
+			http.Redirect(w, r, "/simplesaml/module.php/core/loginuserpass.php?AuthState=_auth-state", http.StatusFound)
+		case "/simplesaml/module.php/core/loginuserpass.php":
+			if r.Method == "GET" {
+				w.Write(bytes.Replace(loginPage, []byte("{{ERROR}}"), nil, 1))
+				return
+			}
+			w.Write(bytes.Replace(otpPage, []byte("{{ERROR}}"), nil, 1))
+		case "/simplesaml/module.php/totp/validate.php":
+			w.Write(bytes.Replace(otpPage, []byte("{{ERROR}}"), []byte(`<div class="message-box error"><h3>Invalid code</h3><p>Either no user with the given username could be found, or the password you gave was wrong.</p></div>`), 1))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + ssoPath + "?spentityid=urn:alibaba:cloudcomputing",
+		Username: "user",
+		Password: "secret",
+		MFAToken: "000000",
+	})
+	require.EqualError(t, err, "login failed: Invalid code")
+}
@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/idn"
+	"github.com/sirupsen/logrus"
+)
+
+// NewAccountTransport configure a transport for the IdP account, TLS verification is only skipped for the hosts
+// allowed by the account, see cfg.IDPAccount.SkipVerifyHostList
+func NewAccountTransport(idpAccount *cfg.IDPAccount) http.RoundTripper {
+	return ScopeSkipVerify(newAccountDefaultTransport(idpAccount), idpAccount.SkipVerifyHostList())
+}
+
+// newAccountDefaultTransport the default transport, resolving the hosts with the DoH server of the account if any,
+// the TLS parameters of its client fingerprint are set by NewHTTPClient
+func newAccountDefaultTransport(idpAccount *cfg.IDPAccount) *http.Transport {
+	tr := NewDefaultTransport(false)
+	if idpAccount.DoHURL != "" {
+		tr.DialContext = NewDoHResolver(idpAccount.DoHURL).DialContext
+	}
+	return tr
+}
+
+// ScopeSkipVerify send the requests to the listed hosts with a copy of tr which doesn't verify their certificate,
+// requests to any other host are verified whatever the TLS configuration of tr
+func ScopeSkipVerify(tr *http.Transport, hosts []string) http.RoundTripper {
+	verified := tr.Clone()
+	if verified.TLSClientConfig == nil {
+		verified.TLSClientConfig = &tls.Config{}
+	}
+	verified.TLSClientConfig.InsecureSkipVerify = false
+
+	if len(hosts) == 0 {
+		return verified
+	}
+
+	insecure := verified.Clone()
+	insecure.TLSClientConfig.InsecureSkipVerify = true
+
+	return &skipVerifyTransport{verified: verified, insecure: insecure, hosts: hosts, reported: map[string]bool{}}
+}
+
+type skipVerifyTransport struct {
+	verified *http.Transport
+	insecure *http.Transport
+	hosts    []string
+
+	mu       sync.Mutex
+	reported map[string]bool
+}
+
+// RoundTrip send the request without verifying the certificate when its host is allowed, reporting it the first
+// time each host is contacted
+func (st *skipVerifyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if req.URL.Scheme != "https" || !MatchHost(st.hosts, host) {
+		return st.verified.RoundTrip(req)
+	}
+
+	st.mu.Lock()
+	if !st.reported[host] {
+		st.reported[host] = true
+		log.Printf("WARNING: TLS certificate verification is disabled for %s", idn.Display(host))
+	}
+	st.mu.Unlock()
+
+	logrus.WithField("host", host).WithField("url", req.URL.String()).Debug("skipping TLS certificate verification")
+
+	return st.insecure.RoundTrip(req)
+}
+
+// MatchHost check whether the host is one of the patterns, *.example.com matches the subdomains of example.com,
+// internationalized hostnames match whether they are written in Unicode or punycode
+func MatchHost(patterns []string, host string) bool {
+	host = idn.Host(host)
+	for _, pattern := range patterns {
+		pattern = idn.Host(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
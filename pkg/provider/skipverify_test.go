@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopeSkipVerify(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	port := ts.URL[strings.LastIndex(ts.URL, ":"):]
+
+	client := &http.Client{Transport: ScopeSkipVerify(NewDefaultTransport(true), []string{"127.0.0.1"})}
+
+	res, err := client.Get("https://127.0.0.1" + port)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// the same server under a name which isn't allowed is verified, even though the transport skipped verification
+	_, err = client.Get("https://localhost" + port)
+	require.Error(t, err)
+
+	client = &http.Client{Transport: ScopeSkipVerify(NewDefaultTransport(true), nil)}
+	_, err = client.Get(ts.URL)
+	require.Error(t, err)
+}
+
+func TestMatchHost(t *testing.T) {
+	hosts := []string{"idp.corp.example.com", "*.internal.example.com"}
+
+	require.True(t, MatchHost(hosts, "IDP.corp.example.com"))
+	require.True(t, MatchHost(hosts, "adfs.internal.example.com"))
+	require.False(t, MatchHost(hosts, "internal.example.com"))
+	require.False(t, MatchHost(hosts, "sts.aliyuncs.com"))
+
+	hosts = []string{"登录.例子.中国", "*.xn--fsqu00a.xn--fiqs8s"}
+
+	require.True(t, MatchHost(hosts, "xn--w2t382c.xn--fsqu00a.xn--fiqs8s"))
+	require.True(t, MatchHost(hosts, "sso.例子.中国"))
+	require.False(t, MatchHost(hosts, "例子.中国"))
+}
@@ -0,0 +1,245 @@
+package workspaceone
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+
+	// maxPolls the number of times a Verify push is polled before giving up
+	maxPolls = 60
+
+	pushFilter     = "form[data-poll-url]"
+	passcodeFilter = "form:has(input[name=\"passcode\"])"
+)
+
+// pollInterval delay between two polls of a pending Verify push
+var pollInterval = 3 * time.Second
+
+var logger = logrus.WithField("provider", "workspaceone")
+
+// Client wrapper around VMware Workspace ONE Access
+type Client struct {
+	client *provider.HTTPClient
+	mfa    string
+}
+
+// New create a new Workspace ONE Access client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		mfa:    idpAccount.MFA,
+	}, nil
+}
+
+// Authenticate logs into Workspace ONE Access, going through the domain selection and Verify steps when they are
+// configured, and returns a SAML response
+func (wc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := wc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	passwordSubmitted := false
+	passcodeSubmitted := false
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		hasPush := doc.Find(pushFilter).Size() > 0
+		hasPasscode := doc.Find(passcodeFilter).Size() > 0
+
+		switch {
+		case hasPush && (!hasPasscode || !strings.EqualFold(wc.mfa, "PASSCODE")):
+			res, err = wc.approvePush(doc)
+		case hasPasscode:
+			if passcodeSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid passcode"))
+			}
+			passcodeSubmitted = true
+			res, err = wc.submitPasscode(doc, loginDetails)
+		case doc.Find("input[name=\"password\"]").Size() > 0:
+			// a failed login shows the password page again
+			if passwordSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc, "invalid username or password"))
+			}
+			passwordSubmitted = true
+			res, err = wc.submitLogin(doc, "form:has(input[name=\"password\"])", loginDetails)
+		case doc.Find("select[name=\"userStoreDomain\"]").Size() > 0:
+			res, err = wc.submitDomain(doc, loginDetails)
+		case doc.Find("input[name=\"username\"]").Size() > 0:
+			res, err = wc.submitLogin(doc, "form:has(input[name=\"username\"])", loginDetails)
+		case doc.Find("form[method=\"post\"], form[method=\"POST\"]").Size() > 0:
+			res, err = page.SubmitForm(wc.client, doc, "form[method=\"post\"], form[method=\"POST\"]", nil)
+		default:
+			return "", fmt.Errorf("unexpected page returned by Workspace ONE Access: %s", doc.Url.String())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("Workspace ONE Access login did not complete after %d steps", page.MaxSteps)
+}
+
+func (wc *Client) submitLogin(doc *goquery.Document, filter string, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	return page.SubmitForm(wc.client, doc, filter, func(form *page.Form, selection *goquery.Selection) {
+		form.Values.Set("username", loginDetails.Username)
+		if selection.Find("input[name=\"password\"]").Size() > 0 {
+			form.Values.Set("password", loginDetails.Password)
+		}
+	})
+}
+
+// submitDomain pick the directory of the user, from the suffix of the username when it names one of the domains
+func (wc *Client) submitDomain(doc *goquery.Document, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	var domains []string
+	doc.Find("select[name=\"userStoreDomain\"] option").Each(func(i int, s *goquery.Selection) {
+		if value, ok := s.Attr("value"); ok && value != "" {
+			domains = append(domains, value)
+		}
+	})
+	if len(domains) == 0 {
+		return nil, errors.New("no domain offered by Workspace ONE Access")
+	}
+
+	domain := selectDomain(domains, loginDetails.Username)
+	if domain == "" {
+		domain = domains[prompter.Choose("Select your domain", domains)]
+	}
+
+	logger.WithField("domain", domain).Debug("selecting domain")
+
+	return page.SubmitForm(wc.client, doc, "form:has(select[name=\"userStoreDomain\"])", func(form *page.Form, selection *goquery.Selection) {
+		form.Values.Set("userStoreDomain", domain)
+		if selection.Find("input[name=\"username\"]").Size() > 0 {
+			form.Values.Set("username", loginDetails.Username)
+		}
+	})
+}
+
+func (wc *Client) submitPasscode(doc *goquery.Document, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	passcode := loginDetails.MFAToken
+	if passcode == "" {
+		passcode = prompter.RequestSecurityCode("000000")
+	}
+
+	return page.SubmitForm(wc.client, doc, passcodeFilter, func(form *page.Form, selection *goquery.Selection) {
+		form.Values.Set("passcode", passcode)
+	})
+}
+
+// approvePush wait for the Verify push sent to Intelligent Hub to be approved, then continue the login
+func (wc *Client) approvePush(doc *goquery.Document) (*http.Response, error) {
+	pollURL, ok := doc.Find(pushFilter).First().Attr("data-poll-url")
+	if !ok {
+		return nil, errors.New("unable to locate the Verify status URL")
+	}
+
+	pollURL, err := page.ResolveURL(doc.Url, pollURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving Verify status URL")
+	}
+
+	log.Println("Waiting for approval, please check your Intelligent Hub app ...")
+
+	for i := 0; i < maxPolls; i++ {
+		status, err := wc.pushStatus(pollURL)
+		if err != nil {
+			return nil, err
+		}
+
+		switch status {
+		case "APPROVED":
+			return page.SubmitForm(wc.client, doc, pushFilter, nil)
+		case "REJECTED", "DENIED":
+			return nil, errors.New("the Verify push was rejected")
+		case "EXPIRED", "TIMEOUT":
+			return nil, errors.New("the Verify push expired before it was approved")
+		}
+
+		if err := wc.client.Sleep(pollInterval); err != nil {
+			return nil, errors.Wrap(err, "error waiting for the Verify push")
+		}
+	}
+
+	return nil, errors.New("timed out waiting for the Verify push to be approved")
+}
+
+func (wc *Client) pushStatus(pollURL string) (string, error) {
+	req, err := http.NewRequest("GET", pollURL, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error building Verify status request")
+	}
+	req.Header.Add("Accept", "application/json")
+
+	res, err := wc.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving Verify status")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving body")
+	}
+
+	return strings.ToUpper(gjson.GetBytes(body, "status").String()), nil
+}
+
+// selectDomain the domain matching the suffix of a user@domain username, empty when it can't be told
+func selectDomain(domains []string, username string) string {
+	if i := strings.LastIndex(username, "@"); i >= 0 {
+		suffix := username[i+1:]
+		for _, domain := range domains {
+			if strings.EqualFold(domain, suffix) {
+				return domain
+			}
+		}
+	}
+
+	if len(domains) == 1 {
+		return domains[0]
+	}
+
+	return ""
+}
+
+func loginError(doc *goquery.Document, fallback string) string {
+	msg := strings.TrimSpace(doc.Find(".error-message, #errorMessage, .alert-danger").First().Text())
+	if msg == "" {
+		msg = fallback
+	}
+	return msg
+}
@@ -0,0 +1,160 @@
+package workspaceone
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticatePush(t *testing.T) {
+	pollInterval = time.Millisecond
+	defer func() { pollInterval = 3 * time.Second }()
+
+	domainPage, err := ioutil.ReadFile("example/domain.html")
+	require.Nil(t, err)
+	passwordPage, err := ioutil.ReadFile("example/password.html")
+	require.Nil(t, err)
+	verifyPage, err := ioutil.ReadFile("example/verify.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	polls := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/SAAS/API/1.0/GET/apps/launch/app/7b0c1d4e":
+			http.Redirect(w, r, "/SAAS/auth/login?dest=app", http.StatusFound)
+		case "/SAAS/auth/login":
+			w.Write(domainPage)
+		case "/SAAS/auth/login/userstore":
+			require.Equal(t, "corp.acme.com", r.PostForm.Get("userStoreDomain"))
+			require.Equal(t, "roadrunner@corp.acme.com", r.PostForm.Get("username"))
+			w.Write(bytes.Replace(passwordPage, []byte("{{ERROR}}"), nil, 1))
+		case "/SAAS/auth/login/embeddedauthbroker/callback":
+			require.Equal(t, "corp.acme.com", r.PostForm.Get("userStoreDomain"))
+			require.Equal(t, "secret", r.PostForm.Get("password"))
+			w.Write(verifyPage)
+		case "/SAAS/auth/login/verify/status":
+			require.Equal(t, "9f3e2a1b", r.URL.Query().Get("transactionId"))
+			polls++
+			if polls < 2 {
+				w.Write([]byte(`{"status":"PENDING"}`))
+				return
+			}
+			w.Write([]byte(`{"status":"APPROVED"}`))
+		case "/SAAS/auth/login/verify/push":
+			require.Equal(t, 2, polls)
+			require.Equal(t, "9f3e2a1b", r.PostForm.Get("verifyTransactionId"))
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/SAAS/API/1.0/GET/apps/launch/app/7b0c1d4e",
+		Username: "roadrunner@corp.acme.com",
+		Password: "secret",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticatePasscode(t *testing.T) {
+	domainPage, err := ioutil.ReadFile("example/domain.html")
+	require.Nil(t, err)
+	passwordPage, err := ioutil.ReadFile("example/password.html")
+	require.Nil(t, err)
+	verifyPage, err := ioutil.ReadFile("example/verify.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/SAAS/API/1.0/GET/apps/launch/app/7b0c1d4e":
+			http.Redirect(w, r, "/SAAS/auth/login?dest=app", http.StatusFound)
+		case "/SAAS/auth/login":
+			w.Write(domainPage)
+		case "/SAAS/auth/login/userstore":
+			w.Write(bytes.Replace(passwordPage, []byte("{{ERROR}}"), nil, 1))
+		case "/SAAS/auth/login/embeddedauthbroker/callback":
+			w.Write(verifyPage)
+		case "/SAAS/auth/login/verify/passcode":
+			require.Equal(t, "123456", r.PostForm.Get("passcode"))
+			w.Write(assertionPage)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "PASSCODE"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/SAAS/API/1.0/GET/apps/launch/app/7b0c1d4e",
+		Username: "roadrunner@corp.acme.com",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	domainPage, err := ioutil.ReadFile("example/domain.html")
+	require.Nil(t, err)
+	passwordPage, err := ioutil.ReadFile("example/password.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/SAAS/API/1.0/GET/apps/launch/app/7b0c1d4e":
+			http.Redirect(w, r, "/SAAS/auth/login?dest=app", http.StatusFound)
+		case "/SAAS/auth/login":
+			w.Write(domainPage)
+		case "/SAAS/auth/login/userstore":
+			w.Write(bytes.Replace(passwordPage, []byte("{{ERROR}}"), nil, 1))
+		case "/SAAS/auth/login/embeddedauthbroker/callback":
+			w.Write(bytes.Replace(passwordPage, []byte("{{ERROR}}"), []byte("Incorrect username or password."), 1))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/SAAS/API/1.0/GET/apps/launch/app/7b0c1d4e",
+		Username: "roadrunner@corp.acme.com",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "login failed: Incorrect username or password.")
+}
+
+func TestSelectDomain(t *testing.T) {
+	domains := []string{"corp.acme.com", "partners.acme.com"}
+
+	require.Equal(t, "partners.acme.com", selectDomain(domains, "wile@Partners.acme.com"))
+	require.Equal(t, "", selectDomain(domains, "roadrunner"))
+	require.Equal(t, "corp.acme.com", selectDomain(domains[:1], "roadrunner"))
+}
@@ -0,0 +1,134 @@
+package wso2
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/page"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logrus.WithField("provider", "wso2")
+
+// Client wrapper around WSO2 Identity Server
+type Client struct {
+	client *provider.HTTPClient
+	mfa    string
+}
+
+// New create a new WSO2 Identity Server client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewAccountTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, provider.BuildHttpClientOpts(idpAccount))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client: client,
+		mfa:    idpAccount.MFA,
+	}, nil
+}
+
+// Authenticate logs into WSO2 Identity Server and returns a SAML response
+func (wc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	res, err := wc.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	tokenSubmitted := false
+
+	for step := 0; step < page.MaxSteps; step++ {
+		doc, err := goquery.NewDocumentFromResponse(res)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build document from response")
+		}
+
+		if samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		// failed attempts redirect back to the login or TOTP page with the failure flagged in the query
+		if doc.Url.Query().Get("authFailure") == "true" {
+			return "", fmt.Errorf("login failed: %s", loginError(doc))
+		}
+
+		switch {
+		case doc.Find("input[name=\"token\"]").Size() > 0:
+			if tokenSubmitted {
+				return "", fmt.Errorf("login failed: %s", loginError(doc))
+			}
+			tokenSubmitted = true
+			res, err = wc.submitToken(doc, loginDetails)
+		case doc.Find("input[name=\"password\"]").Size() > 0:
+			res, err = wc.submitLogin(doc, "form:has(input[name=\"password\"])", loginDetails)
+		case doc.Find("input[name=\"username\"]").Size() > 0:
+			// identifier first authenticator
+			res, err = wc.submitLogin(doc, "form:has(input[name=\"username\"])", loginDetails)
+		case doc.Find("input[name=\"consent\"]").Size() > 0:
+			res, err = wc.submitConsent(doc)
+		case doc.Find("form[method=\"post\"], form[method=\"POST\"]").Size() > 0:
+			res, err = page.SubmitForm(wc.client, doc, "form[method=\"post\"], form[method=\"POST\"]", nil)
+		default:
+			return "", fmt.Errorf("unexpected page returned by WSO2 Identity Server: %s", doc.Url.String())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("WSO2 Identity Server login did not complete after %d steps", page.MaxSteps)
+}
+
+func (wc *Client) submitLogin(doc *goquery.Document, filter string, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	return page.SubmitForm(wc.client, doc, filter, func(form *page.Form, selection *goquery.Selection) {
+		form.Values.Set("username", loginDetails.Username)
+		if selection.Find("input[name=\"password\"]").Size() > 0 {
+			form.Values.Set("password", loginDetails.Password)
+		}
+	})
+}
+
+func (wc *Client) submitToken(doc *goquery.Document, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	token := loginDetails.MFAToken
+	if token == "" {
+		token = prompter.RequestSecurityCode("000000")
+	}
+
+	return page.SubmitForm(wc.client, doc, "form:has(input[name=\"token\"])", func(form *page.Form, selection *goquery.Selection) {
+		form.Values.Set("token", token)
+	})
+}
+
+// submitConsent approve sharing the requested attributes with Alibaba Cloud, mandatory claims are listed as checkboxes
+func (wc *Client) submitConsent(doc *goquery.Document) (*http.Response, error) {
+	logger.Debug("approving consent")
+
+	return page.SubmitForm(wc.client, doc, "form:has(input[name=\"consent\"])", func(form *page.Form, selection *goquery.Selection) {
+		form.Values.Set("consent", "approve")
+		selection.Find("input[type=\"checkbox\"]").Each(func(i int, s *goquery.Selection) {
+			if name, ok := s.Attr("name"); ok {
+				form.Values.Set(name, "on")
+			}
+		})
+	})
+}
+
+func loginError(doc *goquery.Document) string {
+	msg := strings.TrimSpace(doc.Find("#error-msg, .ui.negative.message, .alert-danger").First().Text())
+	if msg == "" {
+		msg = "invalid username, password or verification code"
+	}
+	return msg
+}
@@ -0,0 +1,99 @@
+package wso2
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+	totpPage, err := ioutil.ReadFile("example/totp.html")
+	require.Nil(t, err)
+	consentPage, err := ioutil.ReadFile("example/consent.html")
+	require.Nil(t, err)
+	assertionPage, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/samlsso":
+			http.Redirect(w, r, "/authenticationendpoint/login.do?sessionDataKey=session-data-key", http.StatusFound)
+		case "/authenticationendpoint/login.do":
+			w.Write(loginPage)
+		case "/authenticationendpoint/totp.do":
+			w.Write(totpPage)
+		case "/authenticationendpoint/consent.do":
+			w.Write(consentPage)
+		case "/commonauth":
+			switch {
+			case r.PostForm.Get("password") != "":
+				require.Equal(t, "user@example.com", r.PostForm.Get("username"))
+				require.Equal(t, "secret", r.PostForm.Get("password"))
+				require.Equal(t, "session-data-key", r.PostForm.Get("sessionDataKey"))
+				http.Redirect(w, r, "/authenticationendpoint/totp.do?sessionDataKey=session-data-key", http.StatusFound)
+			case r.PostForm.Get("token") != "":
+				require.Equal(t, "123456", r.PostForm.Get("token"))
+				http.Redirect(w, r, "/authenticationendpoint/consent.do?sessionDataKeyConsent=consent-key", http.StatusFound)
+			case r.PostForm.Get("sessionDataKeyConsent") != "":
+				require.Equal(t, "approve", r.PostForm.Get("consent"))
+				require.Equal(t, "on", r.PostForm.Get("consent_http://wso2.org/claims/role"))
+				w.Write(assertionPage)
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	samlAssertion, err := client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/samlsso?spEntityID=alibabacloud",
+		Username: "user@example.com",
+		Password: "secret",
+		MFAToken: "123456",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+", samlAssertion)
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	loginPage, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/samlsso":
+			http.Redirect(w, r, "/authenticationendpoint/login.do?sessionDataKey=session-data-key", http.StatusFound)
+		case "/authenticationendpoint/login.do":
+			w.Write(loginPage)
+		case "/commonauth":
+			http.Redirect(w, r, "/authenticationendpoint/login.do?authFailure=true&authFailureMsg=login.fail.message", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(&cfg.IDPAccount{MFA: "Auto"})
+	require.Nil(t, err)
+
+	_, err = client.Authenticate(&creds.LoginDetails{
+		URL:      ts.URL + "/samlsso?spEntityID=alibabacloud",
+		Username: "user@example.com",
+		Password: "wrong",
+	})
+	require.EqualError(t, err, "login failed: invalid username, password or verification code")
+}
@@ -0,0 +1,75 @@
+package sessioncache
+
+import (
+	"os"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/statefile"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// DefaultRolesPath the default location of the roles remembered for each IdP account
+const DefaultRolesPath = "~/.saml2alibabacloud-roles.json"
+
+// Roles the role last assumed with each IdP account, stored in an integrity protected state file
+type Roles struct {
+	filename string
+}
+
+// NewRoles create the remembered roles stored in filename, DefaultRolesPath is used if empty
+func NewRoles(filename string) (*Roles, error) {
+	if filename == "" {
+		filename = DefaultRolesPath
+	}
+
+	path, err := homedir.Expand(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving remembered roles path")
+	}
+
+	return &Roles{filename: path}, nil
+}
+
+// Remember record the role last assumed with the IdP account
+func (r *Roles) Remember(idpAccount, roleARN string) error {
+	roles, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	if roles[idpAccount] == roleARN {
+		return nil
+	}
+
+	roles[idpAccount] = roleARN
+
+	return statefile.Write(r.filename, roles)
+}
+
+// Recall return the role last assumed with the IdP account, empty if there is none
+func (r *Roles) Recall(idpAccount string) (string, error) {
+	roles, err := r.load()
+	if err != nil {
+		return "", err
+	}
+
+	return roles[idpAccount], nil
+}
+
+func (r *Roles) load() (map[string]string, error) {
+	roles := map[string]string{}
+
+	err := statefile.Read(r.filename, &roles)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return roles, nil
+		}
+		if err == statefile.ErrTampered {
+			logger.WithField("filename", r.filename).Warn("remembered roles failed the integrity check and are ignored")
+			return map[string]string{}, nil
+		}
+		return nil, errors.Wrapf(err, "unable to load file %s", r.filename)
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,142 @@
+package sessioncache
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/statefile"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPath the default location of the IdP session cache
+const DefaultPath = "~/.saml2alibabacloud-sessions.json"
+
+var logger = logrus.WithField("pkg", "sessioncache")
+
+// Session a SAML assertion obtained from the IdP, reusable for role logins until it expires
+type Session struct {
+	URL       string    `json:"url"`
+	Username  string    `json:"username"`
+	Assertion string    `json:"assertion"`
+	Expires   time.Time `json:"expires"`
+}
+
+// Valid checks the session hasn't expired yet, keeping a margin for the STS exchange
+func (s *Session) Valid() bool {
+	return time.Now().Add(30 * time.Second).Before(s.Expires)
+}
+
+// Cache the IdP sessions keyed by IdP account name and username, like the passwords in the keyring, stored in an
+// integrity protected state file
+type Cache struct {
+	filename string
+}
+
+// New create a cache stored in filename, DefaultPath is used if empty
+func New(filename string) (*Cache, error) {
+	if filename == "" {
+		filename = DefaultPath
+	}
+
+	path, err := homedir.Expand(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving session cache path")
+	}
+
+	return &Cache{filename: path}, nil
+}
+
+// key the entry of the session of username with the IdP account, the username is escaped so it never holds a /
+func key(idpAccount, username string) string {
+	return idpAccount + "/" + url.PathEscape(username)
+}
+
+// Save store the session of its username with the IdP account
+func (c *Cache) Save(idpAccount string, session *Session) error {
+	sessions, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	sessions[key(idpAccount, session.Username)] = session
+
+	return statefile.Write(c.filename, sessions)
+}
+
+// Lookup return the still valid session of username with the IdP account, nil if there is none. Without username,
+// when the account doesn't configure one, the only session of the account is returned.
+func (c *Cache) Lookup(idpAccount, username string) (*Session, error) {
+	sessions, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions[find(sessions, idpAccount, username)], nil
+}
+
+// Delete remove the session of username with the IdP account, without username the only session of the account
+func (c *Cache) Delete(idpAccount, username string) error {
+	sessions, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	name := find(sessions, idpAccount, username)
+	if _, ok := sessions[name]; !ok {
+		return nil
+	}
+
+	delete(sessions, name)
+
+	return statefile.Write(c.filename, sessions)
+}
+
+// find the entry of the session of username with the IdP account, without username the entry of the only session of
+// the account, empty when there isn't exactly one
+func find(sessions map[string]*Session, idpAccount, username string) string {
+	if username != "" {
+		return key(idpAccount, username)
+	}
+
+	found := ""
+	for name := range sessions {
+		if !strings.HasPrefix(name, idpAccount+"/") || strings.Contains(name[len(idpAccount)+1:], "/") {
+			continue
+		}
+		if found != "" {
+			return ""
+		}
+		found = name
+	}
+
+	return found
+}
+
+// load read the sessions dropping expired ones, a file failing the integrity check is discarded
+func (c *Cache) load() (map[string]*Session, error) {
+	sessions := map[string]*Session{}
+
+	err := statefile.Read(c.filename, &sessions)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sessions, nil
+		}
+		if err == statefile.ErrTampered {
+			logger.WithField("filename", c.filename).Warn("session cache failed the integrity check and is ignored")
+			return map[string]*Session{}, nil
+		}
+		return nil, errors.Wrapf(err, "unable to load file %s", c.filename)
+	}
+
+	for name, session := range sessions {
+		if session == nil || !session.Valid() {
+			delete(sessions, name)
+		}
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,79 @@
+package sessioncache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessioncache")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := New(filepath.Join(dir, "sessions.json"))
+	require.Nil(t, err)
+
+	session, err := c.Lookup("default", "user")
+	require.Nil(t, err)
+	require.Nil(t, session)
+
+	require.Nil(t, c.Save("default", &Session{URL: "https://id.example.com", Username: "user", Assertion: "PHNhbWw+", Expires: time.Now().Add(time.Hour)}))
+	require.Nil(t, c.Save("expired", &Session{Username: "user", Assertion: "PHNhbWw+", Expires: time.Now().Add(-time.Minute)}))
+
+	session, err = c.Lookup("default", "user")
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWw+", session.Assertion)
+
+	session, err = c.Lookup("expired", "user")
+	require.Nil(t, err)
+	require.Nil(t, session)
+
+	// the session of another user of the same account isn't reused
+	session, err = c.Lookup("default", "other")
+	require.Nil(t, err)
+	require.Nil(t, session)
+
+	// without username the only session of the account is found, none once there are several
+	session, err = c.Lookup("default", "")
+	require.Nil(t, err)
+	require.Equal(t, "user", session.Username)
+
+	require.Nil(t, c.Save("default", &Session{URL: "https://id.example.com", Username: "other", Assertion: "PHNhbWw+", Expires: time.Now().Add(time.Hour)}))
+	session, err = c.Lookup("default", "")
+	require.Nil(t, err)
+	require.Nil(t, session)
+
+	require.Nil(t, c.Delete("default", "user"))
+	session, err = c.Lookup("default", "user")
+	require.Nil(t, err)
+	require.Nil(t, session)
+
+	session, err = c.Lookup("default", "other")
+	require.Nil(t, err)
+	require.Equal(t, "other", session.Username)
+}
+
+func TestRememberRecall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessioncache")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	r, err := NewRoles(filepath.Join(dir, "roles.json"))
+	require.Nil(t, err)
+
+	roleARN, err := r.Recall("default")
+	require.Nil(t, err)
+	require.Equal(t, "", roleARN)
+
+	require.Nil(t, r.Remember("default", "acs:ram::000000000001:role/Development"))
+	require.Nil(t, r.Remember("default", "acs:ram::000000000001:role/Production"))
+
+	roleARN, err = r.Recall("default")
+	require.Nil(t, err)
+	require.Equal(t, "acs:ram::000000000001:role/Production", roleARN)
+}
@@ -0,0 +1,132 @@
+package statefile
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/aliyun/saml2alibabacloud/helper/credentials"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrTampered returned when a state file fails the integrity check, it was modified or copied from another machine
+	ErrTampered = errors.New("state file failed the integrity check")
+
+	logger = logrus.WithField("pkg", "statefile")
+
+	// integrityKey resolves the HMAC key, replaced in tests
+	integrityKey = credentials.IntegrityKey
+
+	// keyringDisabled the keyring must not be used, the files are neither signed nor checked
+	keyringDisabled = false
+)
+
+// DisableKeyring stop using the OS keyring for the integrity key, as asked with --disable-keychain. The files are then
+// written without an HMAC and read without checking it.
+func DisableKeyring() {
+	keyringDisabled = true
+}
+
+// envelope the on disk format, the HMAC covers the file name and the data
+type envelope struct {
+	HMAC string          `json:"hmac,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Write encode v as JSON and write it to filename protected by an HMAC keyed from the OS keyring.
+// Without a keyring the file is written unprotected.
+func Write(filename string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	env := envelope{Data: data}
+
+	key, err := lookupKey()
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		env.HMAC = sign(key, filename, data)
+	}
+
+	out, err := json.MarshalIndent(env, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, out, 0600)
+}
+
+// Read load filename into v after checking its HMAC, returns ErrTampered when the check fails.
+// Errors opening the file are returned as is so callers can check os.IsNotExist.
+func Read(filename string, v interface{}) error {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil || env.Data == nil {
+		return ErrTampered
+	}
+
+	key, err := lookupKey()
+	if err != nil {
+		return err
+	}
+
+	// the data is signed in its compact form, the file itself is indented
+	var data bytes.Buffer
+	if err := json.Compact(&data, env.Data); err != nil {
+		return ErrTampered
+	}
+
+	switch {
+	case keyringDisabled:
+		logger.WithField("filename", filename).Debug("keyring disabled, state file integrity not checked")
+	case key != nil:
+		expected := sign(key, filename, data.Bytes())
+		if !hmac.Equal([]byte(expected), []byte(env.HMAC)) {
+			return ErrTampered
+		}
+	case env.HMAC != "":
+		// protected on a machine with a keyring but there is nothing to check it against here
+		return ErrTampered
+	}
+
+	return errors.Wrapf(json.Unmarshal(data.Bytes(), v), "unable to decode state file %s", filename)
+}
+
+// lookupKey return the integrity key, nil if there is no keyring on this machine or it is disabled
+func lookupKey() ([]byte, error) {
+	if keyringDisabled {
+		return nil, nil
+	}
+
+	key, err := integrityKey()
+	if err == credentials.ErrIntegrityKeyUnavailable {
+		logger.Debug("no keyring available, state files are not integrity protected")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving state integrity key")
+	}
+
+	return key, nil
+}
+
+func sign(key []byte, filename string, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(filepath.Base(filename)))
+	mac.Write([]byte{0})
+	mac.Write(data)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,124 @@
+package statefile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/helper/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+type state struct {
+	Profile string `json:"profile"`
+}
+
+// withKey inject the integrity key so the tests never reach the keyring of the machine, nil acts as a machine
+// without keyring, the returned func restores the previous key
+func withKey(key []byte) func() {
+	previous := integrityKey
+	setKey(key)
+	return func() { integrityKey = previous }
+}
+
+func setKey(key []byte) {
+	integrityKey = func() ([]byte, error) {
+		if key == nil {
+			return nil, credentials.ErrIntegrityKeyUnavailable
+		}
+		return key, nil
+	}
+}
+
+func tempFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "statefile")
+	require.Nil(t, err)
+	return filepath.Join(dir, "state.json"), func() { os.RemoveAll(dir) }
+}
+
+func TestReadWrite(t *testing.T) {
+	defer withKey([]byte("0123456789abcdef0123456789abcdef"))()
+	filename, cleanup := tempFile(t)
+	defer cleanup()
+
+	require.Nil(t, Write(filename, &state{Profile: "saml"}))
+
+	var s state
+	require.Nil(t, Read(filename, &s))
+	require.Equal(t, "saml", s.Profile)
+}
+
+func TestReadTampered(t *testing.T) {
+	defer withKey([]byte("0123456789abcdef0123456789abcdef"))()
+	filename, cleanup := tempFile(t)
+	defer cleanup()
+
+	require.Nil(t, Write(filename, &state{Profile: "saml"}))
+
+	data, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(filename, []byte(strings.Replace(string(data), "saml", "prod", 1)), 0600))
+
+	var s state
+	require.Equal(t, ErrTampered, Read(filename, &s))
+}
+
+func TestReadOtherMachine(t *testing.T) {
+	defer withKey([]byte("0123456789abcdef0123456789abcdef"))()
+	filename, cleanup := tempFile(t)
+	defer cleanup()
+
+	require.Nil(t, Write(filename, &state{Profile: "saml"}))
+
+	setKey([]byte("fedcba9876543210fedcba9876543210"))
+
+	var s state
+	require.Equal(t, ErrTampered, Read(filename, &s))
+
+	setKey(nil)
+	require.Equal(t, ErrTampered, Read(filename, &s))
+}
+
+func TestReadWriteWithoutKeyring(t *testing.T) {
+	defer withKey(nil)()
+	filename, cleanup := tempFile(t)
+	defer cleanup()
+
+	require.Nil(t, Write(filename, &state{Profile: "saml"}))
+
+	var s state
+	require.Nil(t, Read(filename, &s))
+	require.Equal(t, "saml", s.Profile)
+
+	// once a keyring is available unprotected files are rejected
+	setKey([]byte("0123456789abcdef0123456789abcdef"))
+	require.Equal(t, ErrTampered, Read(filename, &s))
+}
+
+func TestReadWriteKeyringDisabled(t *testing.T) {
+	defer withKey([]byte("0123456789abcdef0123456789abcdef"))()
+	filename, cleanup := tempFile(t)
+	defer cleanup()
+
+	require.Nil(t, Write(filename, &state{Profile: "saml"}))
+
+	DisableKeyring()
+	defer func() { keyringDisabled = false }()
+
+	// with --disable-keychain the key must not even be looked up
+	integrityKey = func() ([]byte, error) {
+		t.Fatal("integrity key looked up with the keyring disabled")
+		return nil, nil
+	}
+
+	var s state
+	require.Nil(t, Read(filename, &s))
+	require.Equal(t, "saml", s.Profile)
+
+	require.Nil(t, Write(filename, &state{Profile: "prod"}))
+	data, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	require.NotContains(t, string(data), "hmac")
+}
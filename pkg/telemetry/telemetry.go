@@ -0,0 +1,134 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sendTimeout how long a report may take to send, telemetry never holds up the login
+const sendTimeout = 3 * time.Second
+
+// Report an anonymous failure report, nothing naming the user, the IdP account, the IdP or the roles is included,
+// only what is needed to aggregate recurring failures
+type Report struct {
+	Time       time.Time `json:"time"`
+	Version    string    `json:"version"`
+	OS         string    `json:"os"`
+	Provider   string    `json:"provider,omitempty"`
+	Stage      string    `json:"stage,omitempty"`
+	ErrorClass string    `json:"error_class"`
+	ErrorCode  string    `json:"error_code,omitempty"` // returned by STS, such as InternalError
+	RequestID  string    `json:"request_id,omitempty"` // of the failed STS request, what Alibaba Cloud support asks for
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Reporter deliver the reports to the endpoint the user opted in to
+type Reporter interface {
+	Send(report *Report) error
+}
+
+// reporters the reporter built for each endpoint scheme
+var reporters = map[string]func(endpoint *url.URL) (Reporter, error){
+	"https": newHTTPReporter,
+	"http":  newHTTPReporter,
+	"file":  newFileReporter,
+}
+
+// Register add a reporter for the endpoints with the given scheme
+func Register(scheme string, factory func(endpoint *url.URL) (Reporter, error)) {
+	reporters[scheme] = factory
+}
+
+// New the reporter for the endpoint, an https URL the reports are posted to, or a file:// path they are appended to
+func New(endpoint string) (Reporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing telemetry endpoint")
+	}
+
+	factory, ok := reporters[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported telemetry endpoint %s, use an https:// or file:// URL", u.Host)
+	}
+
+	return factory(u)
+}
+
+type httpReporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+func newHTTPReporter(endpoint *url.URL) (Reporter, error) {
+	// the reports are only sent in clear to the local machine, a collector forwarding them for example
+	if endpoint.Scheme == "http" && !isLoopback(endpoint.Hostname()) {
+		return nil, fmt.Errorf("telemetry endpoint %s must use https", endpoint.Host)
+	}
+
+	return &httpReporter{endpoint: endpoint.String(), client: &http.Client{Timeout: sendTimeout}}, nil
+}
+
+// Send post the report as JSON
+func (hr *httpReporter) Send(report *Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	res, err := hr.client.Post(hr.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "error sending telemetry report")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint returned %s", res.Status)
+	}
+
+	return nil
+}
+
+type fileReporter struct {
+	filename string
+}
+
+func newFileReporter(endpoint *url.URL) (Reporter, error) {
+	if endpoint.Path == "" {
+		return nil, errors.New("telemetry file endpoint has no path")
+	}
+
+	return &fileReporter{filename: endpoint.Path}, nil
+}
+
+// Send append the report as a line of JSON, ready to be shared with support
+func (fr *fileReporter) Send(report *Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fr.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "error opening telemetry file")
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
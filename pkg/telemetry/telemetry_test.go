@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var report = &Report{
+	Time:       time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC),
+	Version:    "0.0.5",
+	OS:         "linux/amd64",
+	Provider:   "Okta",
+	Stage:      "sts",
+	ErrorClass: "rejected",
+	ErrorCode:  "InternalError",
+	RequestID:  "7C3F2E1A-6E2B-4E0C-9D4B-3A1F5C2B8E9D",
+	DurationMS: 1234,
+}
+
+func TestHTTPReporter(t *testing.T) {
+	var received Report
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "POST", r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	reporter, err := New(ts.URL + "/reports")
+	require.NoError(t, err)
+	require.NoError(t, reporter.Send(report))
+	require.Equal(t, *report, received)
+}
+
+func TestHTTPReporterRejected(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	reporter, err := New(ts.URL)
+	require.NoError(t, err)
+	require.Error(t, reporter.Send(report))
+}
+
+func TestFileReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telemetry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "reports.jsonl")
+
+	reporter, err := New("file://" + filepath.ToSlash(filename))
+	require.NoError(t, err)
+	require.NoError(t, reporter.Send(report))
+	require.NoError(t, reporter.Send(report))
+
+	data, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"request_id":"7C3F2E1A-6E2B-4E0C-9D4B-3A1F5C2B8E9D"`)
+}
+
+func TestNewRejectsUnsafeEndpoints(t *testing.T) {
+	_, err := New("http://telemetry.example.com/reports")
+	require.Error(t, err)
+
+	_, err = New("ftp://telemetry.example.com/reports")
+	require.Error(t, err)
+
+	_, err = New("http://127.0.0.1:8125/reports")
+	require.NoError(t, err)
+}
@@ -0,0 +1,52 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Period the number of seconds a code is valid for
+	Period = 30
+
+	// Digits the length of a code
+	Digits = 6
+)
+
+// encoding the base32 encoding authenticator apps show the secrets in
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NormalizeSecret the secret without the spaces, dashes and padding the IdPs add to make it readable
+func NormalizeSecret(secret string) string {
+	secret = strings.ToUpper(secret)
+	secret = strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret)
+	return secret
+}
+
+// Code the RFC 6238 code of the base32 secret at the given time, using HMAC-SHA1, 6 digits and a 30s period like the
+// authenticator apps
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(NormalizeSecret(secret))
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding TOTP secret")
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(t.Unix()/Period))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%1000000), nil
+}
@@ -0,0 +1,31 @@
+package totp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// the SHA1 test vectors of RFC 6238, truncated to 6 digits
+func TestCode(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	for unix, expected := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		code, err := Code(secret, time.Unix(unix, 0))
+		require.Nil(t, err)
+		require.Equal(t, expected, code)
+	}
+
+	code, err := Code("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", time.Unix(59, 0))
+	require.Nil(t, err)
+	require.Equal(t, "287082", code)
+
+	_, err = Code("not base32!", time.Now())
+	require.Error(t, err)
+}
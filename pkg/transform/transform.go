@@ -0,0 +1,119 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/hook"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logrus.WithField("pkg", "transform")
+
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Transformer exchanges the STS credentials for ecosystem specific ones before they are output, for example an ACK
+// cluster token, an ACR pull token or a signed OSS URL, returned as environment variables
+type Transformer interface {
+	Transform(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, account *cfg.IDPAccount) (map[string]string, error)
+}
+
+// TransformerFunc adapts a function to the Transformer interface
+type TransformerFunc func(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, account *cfg.IDPAccount) (map[string]string, error)
+
+// Transform call the function
+func (f TransformerFunc) Transform(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, account *cfg.IDPAccount) (map[string]string, error) {
+	return f(alibabacloudCreds, account)
+}
+
+var (
+	mu           sync.Mutex
+	transformers []Transformer
+)
+
+// Register add a transformer applied to every credentials output, builds embedding saml2alibabacloud use it to hook
+// in Go code
+func Register(t Transformer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	transformers = append(transformers, t)
+}
+
+// Apply run the registered transformers in order, followed by the credential_hook command of the account if any,
+// and return the variables they derived, a variable set by a later transformer replaces the earlier one
+func Apply(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, account *cfg.IDPAccount) (map[string]string, error) {
+	mu.Lock()
+	chain := append([]Transformer{}, transformers...)
+	mu.Unlock()
+
+	if account.CredentialHook != "" {
+		chain = append(chain, Command(account.CredentialHook))
+	}
+
+	variables := map[string]string{}
+
+	for i, t := range chain {
+		derived, err := t.Transform(alibabacloudCreds, account)
+		if err != nil {
+			return nil, errors.Wrapf(err, "credential hook %d failed", i+1)
+		}
+
+		for name, value := range derived {
+			if !variableName.MatchString(name) {
+				return nil, fmt.Errorf("credential hook %d returned %q, which isn't a valid environment variable name", i+1, name)
+			}
+			variables[name] = value
+		}
+	}
+
+	if len(chain) > 0 {
+		logger.WithField("hooks", len(chain)).WithField("variables", len(variables)).Debug("credentials transformed")
+	}
+
+	return variables, nil
+}
+
+// Environ the variables in the NAME=value format of the environment of a command, sorted by name
+func Environ(variables map[string]string) []string {
+	environ := []string{}
+	for name, value := range variables {
+		environ = append(environ, name+"="+value)
+	}
+	sort.Strings(environ)
+	return environ
+}
+
+// Command a transformer running the command with sh, the credentials are written to its stdin as JSON and a JSON
+// object of the variables derived from them read from its stdout, the account details are passed as environment
+// variables
+func Command(command string) Transformer {
+	return TransformerFunc(func(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, account *cfg.IDPAccount) (map[string]string, error) {
+		input, err := json.Marshal(alibabacloudCreds)
+		if err != nil {
+			return nil, errors.Wrap(err, "error encoding credentials")
+		}
+
+		out, err := hook.Run(command, bytes.NewReader(input), account)
+		if err != nil {
+			return nil, err
+		}
+
+		variables := map[string]string{}
+		if len(bytes.TrimSpace(out)) == 0 {
+			return variables, nil
+		}
+		if err := json.Unmarshal(out, &variables); err != nil {
+			return nil, errors.New("the output isn't a JSON object of string values")
+		}
+
+		return variables, nil
+	})
+}
@@ -0,0 +1,59 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/alibabacloudconfig"
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyCommand(t *testing.T) {
+	account := &cfg.IDPAccount{Profile: "saml", CredentialHook: `test "$SAML2ALIBABACLOUD_PROFILE" = saml && sed 's/.*"access_key_id":"\([^"]*\)".*/{"ACR_USERNAME":"\1"}/'`}
+
+	variables, err := Apply(&alibabacloudconfig.AliCloudCredentials{AliCloudAccessKey: "STS.key"}, account)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"ACR_USERNAME": "STS.key"}, variables)
+
+	variables, err = Apply(&alibabacloudconfig.AliCloudCredentials{}, &cfg.IDPAccount{CredentialHook: "cat >/dev/null"})
+	require.Nil(t, err)
+	require.Empty(t, variables)
+}
+
+func TestApplyInvalidOutput(t *testing.T) {
+	creds := &alibabacloudconfig.AliCloudCredentials{}
+
+	_, err := Apply(creds, &cfg.IDPAccount{CredentialHook: "echo not json"})
+	require.EqualError(t, err, "credential hook 1 failed: the output isn't a JSON object of string values")
+
+	_, err = Apply(creds, &cfg.IDPAccount{CredentialHook: `echo '{"ACK TOKEN":"token"}'`})
+	require.EqualError(t, err, `credential hook 1 returned "ACK TOKEN", which isn't a valid environment variable name`)
+
+	_, err = Apply(creds, &cfg.IDPAccount{CredentialHook: "exit 3"})
+	require.EqualError(t, err, "credential hook 1 failed: exit status 3")
+}
+
+func TestApplyRegistered(t *testing.T) {
+	Register(TransformerFunc(func(alibabacloudCreds *alibabacloudconfig.AliCloudCredentials, account *cfg.IDPAccount) (map[string]string, error) {
+		return map[string]string{"OSS_URL": "https://bucket.oss.example.com/?token=" + alibabacloudCreds.AliCloudSecurityToken, "ACK_TOKEN": "registered"}, nil
+	}))
+	defer func() { transformers = nil }()
+
+	creds := &alibabacloudconfig.AliCloudCredentials{AliCloudSecurityToken: "token"}
+
+	variables, err := Apply(creds, &cfg.IDPAccount{})
+	require.Nil(t, err)
+	require.Equal(t, "https://bucket.oss.example.com/?token=token", variables["OSS_URL"])
+
+	variables, err = Apply(creds, &cfg.IDPAccount{CredentialHook: `echo '{"ACK_TOKEN":"command"}'`})
+	require.Nil(t, err)
+	require.Equal(t, []string{"ACK_TOKEN=command", "OSS_URL=https://bucket.oss.example.com/?token=token"}, Environ(variables))
+}
+
+func TestApplyNoHooks(t *testing.T) {
+	variables, err := Apply(&alibabacloudconfig.AliCloudCredentials{}, &cfg.IDPAccount{})
+	require.Nil(t, err)
+	require.Empty(t, variables)
+	require.Empty(t, strings.Join(Environ(variables), ""))
+}
@@ -30,3 +30,27 @@ func TestParseRoles(t *testing.T) {
 	assert.Nil(t, ramRoles)
 
 }
+
+func TestRoleFilter(t *testing.T) {
+	admin := &RamRole{RoleARN: "acs:ram::456456456456:role/admin"}
+	breakGlass := &RamRole{RoleARN: "acs:ram::456456456456:role/BreakGlassAdmin"}
+	reader := &RamRole{RoleARN: "acs:ram::123123123123:role/reader"}
+	roles := []*RamRole{admin, breakGlass, reader}
+
+	var noFilter *RoleFilter
+	assert.Equal(t, roles, noFilter.Filter(roles))
+
+	deny := &RoleFilter{Deny: []string{"acs:ram::*:role/breakglass*"}}
+	assert.Equal(t, []*RamRole{admin, reader}, deny.Filter(roles))
+
+	allow := &RoleFilter{Allow: []string{"acs:ram::456456456456:role/*"}, Deny: []string{"*:role/breakglass*"}}
+	assert.Equal(t, []*RamRole{admin}, allow.Filter(roles))
+
+	accounts := allow.FilterAccounts([]*AlibabaCloudAccount{
+		{Name: "production", Roles: []*RamRole{admin, breakGlass}},
+		{Name: "sandbox", Roles: []*RamRole{reader}},
+	})
+	assert.Len(t, accounts, 1)
+	assert.Equal(t, "production", accounts[0].Name)
+	assert.Equal(t, []*RamRole{admin}, accounts[0].Roles)
+}
@@ -0,0 +1,188 @@
+package saml2alibabacloud
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/aliyun/saml2alibabacloud/pkg/catalog"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/pkg/errors"
+)
+
+// Groupings of the role chooser
+const (
+	RoleGroupNone        = "none"
+	RoleGroupAccount     = "account"
+	RoleGroupEnvironment = "environment"
+)
+
+// Sort orders of the role chooser
+const (
+	RoleSortAlphabetical = "alphabetical"
+	RoleSortRecent       = "recent"
+	RoleSortCustom       = "custom"
+)
+
+// noEnvironment the group of the roles the role catalog gives no environment
+const noEnvironment = "(no environment)"
+
+// RoleChooser how the roles are laid out in the role selection prompt, the zero value lists every role alphabetically
+type RoleChooser struct {
+	// Group with account or environment the group is chosen first, then the role within it
+	Group string
+	// Sort alphabetical, recent to list the roles used most recently first, or custom to list those matching Order first
+	Sort string
+	// Order the role ARN patterns of the custom sort, * matching any characters
+	Order []string
+	// Recent the role ARNs used most recently first
+	Recent []string
+	// Catalog annotates the roles and gives their environment
+	Catalog *catalog.Catalog
+}
+
+// roleOption a role as offered by the chooser
+type roleOption struct {
+	Name  string
+	Group string
+	Rank  int
+	Role  *RamRole
+}
+
+// NewRoleChooser the chooser of the role_group and role_sort of an account, unknown values use the defaults
+func NewRoleChooser(group, sortOrder string, order, recent []string, roleCatalog *catalog.Catalog) *RoleChooser {
+	rc := &RoleChooser{Group: group, Sort: sortOrder, Order: order, Recent: recent, Catalog: roleCatalog}
+
+	switch rc.Group {
+	case "", RoleGroupNone, RoleGroupAccount, RoleGroupEnvironment:
+	default:
+		log.Printf("Unknown role_group %q, the roles are not grouped", rc.Group)
+		rc.Group = RoleGroupNone
+	}
+
+	switch rc.Sort {
+	case "", RoleSortAlphabetical, RoleSortRecent, RoleSortCustom:
+	default:
+		log.Printf("Unknown role_sort %q, the roles are sorted alphabetically", rc.Sort)
+		rc.Sort = RoleSortAlphabetical
+	}
+
+	return rc
+}
+
+// rank the position of the role in the sort order, lower first, roles of the same rank are sorted alphabetically
+func (rc *RoleChooser) rank(roleARN string) int {
+	var patterns []string
+	switch rc.Sort {
+	case RoleSortRecent:
+		for i, recent := range rc.Recent {
+			if recent == roleARN {
+				return i
+			}
+		}
+		return len(rc.Recent)
+	case RoleSortCustom:
+		patterns = rc.Order
+	}
+
+	for i, pattern := range patterns {
+		if matchPattern(pattern, roleARN) {
+			return i
+		}
+	}
+	return len(patterns)
+}
+
+// options the roles of the accounts sorted for the chooser
+func (rc *RoleChooser) options(accounts []*AlibabaCloudAccount) []*roleOption {
+	var options []*roleOption
+
+	for _, account := range accounts {
+		for _, role := range account.Roles {
+			option := &roleOption{Name: fmt.Sprintf("%s / %s", account.Name, role.Name), Rank: rc.rank(role.RoleARN), Role: role}
+			if annotation := rc.Catalog.Annotation(role.RoleARN); annotation != "" {
+				option.Name = fmt.Sprintf("%s (%s)", option.Name, annotation)
+			}
+
+			switch rc.Group {
+			case RoleGroupAccount:
+				option.Group = account.Name
+			case RoleGroupEnvironment:
+				option.Group = noEnvironment
+				if entry := rc.Catalog.Lookup(role.RoleARN); entry != nil && entry.Environment != "" {
+					option.Group = entry.Environment
+				}
+			}
+
+			options = append(options, option)
+		}
+	}
+
+	sort.SliceStable(options, func(i, j int) bool {
+		if options[i].Rank != options[j].Rank {
+			return options[i].Rank < options[j].Rank
+		}
+		return options[i].Name < options[j].Name
+	})
+
+	return options
+}
+
+// groups the groups of the sorted options, ranked by their best ranked role then sorted alphabetically
+func groups(options []*roleOption) []string {
+	ranks := map[string]int{}
+	var names []string
+
+	for _, option := range options {
+		if _, ok := ranks[option.Group]; !ok {
+			ranks[option.Group] = option.Rank
+			names = append(names, option.Group)
+		}
+	}
+
+	sort.SliceStable(names, func(i, j int) bool {
+		if ranks[names[i]] != ranks[names[j]] {
+			return ranks[names[i]] < ranks[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	return names
+}
+
+// Choose prompt for the role, first for its group when the roles are grouped in more than one
+func (rc *RoleChooser) Choose(accounts []*AlibabaCloudAccount) (*RamRole, error) {
+	options := rc.options(accounts)
+	if len(options) == 0 {
+		return nil, errors.New("no role to choose from")
+	}
+
+	if names := groups(options); len(names) > 1 {
+		selectedGroup, err := prompter.ChooseWithDefault(fmt.Sprintf("Please choose the %s", rc.Group), names[0], names)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s selection failed", rc.Group)
+		}
+
+		var grouped []*roleOption
+		for _, option := range options {
+			if option.Group == selectedGroup {
+				grouped = append(grouped, option)
+			}
+		}
+		options = grouped
+	}
+
+	roles := map[string]*RamRole{}
+	roleOptions := make([]string, len(options))
+	for i, option := range options {
+		roles[option.Name] = option.Role
+		roleOptions[i] = option.Name
+	}
+
+	selectedRole, err := prompter.ChooseWithDefault("Please choose the role", roleOptions[0], roleOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "Role selection failed")
+	}
+
+	return roles[selectedRole], nil
+}
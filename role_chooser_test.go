@@ -0,0 +1,72 @@
+package saml2alibabacloud
+
+import (
+	"testing"
+
+	"github.com/aliyun/saml2alibabacloud/mocks"
+	"github.com/aliyun/saml2alibabacloud/pkg/catalog"
+	"github.com/aliyun/saml2alibabacloud/pkg/prompter"
+	"github.com/stretchr/testify/require"
+)
+
+func chooserAccounts() []*AlibabaCloudAccount {
+	return []*AlibabaCloudAccount{
+		{Name: "prod", Roles: []*RamRole{
+			{RoleARN: "acs:ram::111:role/admin", Name: "admin"},
+			{RoleARN: "acs:ram::111:role/reader", Name: "reader"},
+		}},
+		{Name: "dev", Roles: []*RamRole{
+			{RoleARN: "acs:ram::222:role/admin", Name: "admin"},
+		}},
+	}
+}
+
+func optionNames(options []*roleOption) []string {
+	var names []string
+	for _, option := range options {
+		names = append(names, option.Name)
+	}
+	return names
+}
+
+func TestRoleChooserSort(t *testing.T) {
+	rc := NewRoleChooser("", "", nil, nil, nil)
+	require.Equal(t, []string{"dev / admin", "prod / admin", "prod / reader"}, optionNames(rc.options(chooserAccounts())))
+
+	rc = NewRoleChooser("", RoleSortRecent, nil, []string{"acs:ram::111:role/reader", "acs:ram::999:role/other"}, nil)
+	require.Equal(t, []string{"prod / reader", "dev / admin", "prod / admin"}, optionNames(rc.options(chooserAccounts())))
+
+	rc = NewRoleChooser("", RoleSortCustom, []string{"acs:ram::111:role/*", "*:role/admin"}, nil, nil)
+	require.Equal(t, []string{"prod / admin", "prod / reader", "dev / admin"}, optionNames(rc.options(chooserAccounts())))
+
+	rc = NewRoleChooser("by-team", "newest", nil, nil, nil)
+	require.Equal(t, RoleGroupNone, rc.Group)
+	require.Equal(t, RoleSortAlphabetical, rc.Sort)
+}
+
+func TestRoleChooserGroups(t *testing.T) {
+	roleCatalog, err := catalog.Parse([]byte(`roles:
+  - role_arn: acs:ram::111:role/admin
+    environment: production
+  - role_arn: acs:ram::222:role/admin
+    environment: development
+`))
+	require.Nil(t, err)
+
+	rc := NewRoleChooser(RoleGroupEnvironment, "", nil, nil, roleCatalog)
+	require.Equal(t, []string{"(no environment)", "development", "production"}, groups(rc.options(chooserAccounts())))
+
+	rc = NewRoleChooser(RoleGroupAccount, RoleSortRecent, nil, []string{"acs:ram::111:role/reader"}, nil)
+	require.Equal(t, []string{"prod", "dev"}, groups(rc.options(chooserAccounts())))
+}
+
+func TestRoleChooserChoose(t *testing.T) {
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("ChooseWithDefault", "Please choose the account", "dev", []string{"dev", "prod"}).Return("prod", nil)
+	pr.Mock.On("ChooseWithDefault", "Please choose the role", "prod / admin", []string{"prod / admin", "prod / reader"}).Return("prod / reader", nil)
+
+	role, err := NewRoleChooser(RoleGroupAccount, "", nil, nil, nil).Choose(chooserAccounts())
+	require.Nil(t, err)
+	require.Equal(t, "acs:ram::111:role/reader", role.RoleARN)
+}
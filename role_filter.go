@@ -0,0 +1,63 @@
+package saml2alibabacloud
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RoleFilter the role ARN patterns an IdP account is limited to and excluded from, * matches any characters and the
+// deny list wins over the allow list
+type RoleFilter struct {
+	Allow []string
+	Deny  []string
+}
+
+// Permits check whether the role may be offered and assumed, a nil filter permits every role
+func (rf *RoleFilter) Permits(roleARN string) bool {
+	if rf == nil {
+		return true
+	}
+	if matchAny(rf.Deny, roleARN) {
+		return false
+	}
+	return len(rf.Allow) == 0 || matchAny(rf.Allow, roleARN)
+}
+
+// Filter the permitted roles
+func (rf *RoleFilter) Filter(ramRoles []*RamRole) []*RamRole {
+	var permitted []*RamRole
+	for _, ramRole := range ramRoles {
+		if rf.Permits(ramRole.RoleARN) {
+			permitted = append(permitted, ramRole)
+		}
+	}
+	return permitted
+}
+
+// FilterAccounts the accounts with their permitted roles, accounts left without any are dropped
+func (rf *RoleFilter) FilterAccounts(alibabacloudAccounts []*AlibabaCloudAccount) []*AlibabaCloudAccount {
+	var permitted []*AlibabaCloudAccount
+	for _, account := range alibabacloudAccounts {
+		roles := rf.Filter(account.Roles)
+		if len(roles) > 0 {
+			permitted = append(permitted, &AlibabaCloudAccount{Name: account.Name, Roles: roles})
+		}
+	}
+	return permitted
+}
+
+func matchAny(patterns []string, roleARN string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, roleARN) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern match the ARN against a pattern where * stands for any characters, RAM role names are case insensitive
+func matchPattern(pattern, roleARN string) bool {
+	expr := strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1)
+	matched, err := regexp.MatchString("(?i)^"+expr+"$", roleARN)
+	return err == nil && matched
+}
@@ -3,6 +3,8 @@ package saml2alibabacloud
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/beevik/etree"
 )
@@ -10,6 +12,8 @@ import (
 const (
 	assertionTag          = "Assertion"
 	attributeStatementTag = "AttributeStatement"
+	authnStatementTag     = "AuthnStatement"
+	conditionsTag         = "Conditions"
 	attributeTag          = "Attribute"
 	attributeValueTag     = "AttributeValue"
 	responseTag           = "Response"
@@ -74,6 +78,71 @@ func ExtractSessionDuration(data []byte) (int64, error) {
 	return 0, nil
 }
 
+// ExtractRoleSessionName the RoleSessionName attribute of the assertion, the name STS gives the session of the role
+func ExtractRoleSessionName(data []byte) (string, error) {
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return "", err
+	}
+
+	assertionElement := doc.FindElement(".//Assertion")
+	if assertionElement == nil {
+		return "", ErrMissingAssertion
+	}
+
+	attributeStatement := assertionElement.FindElement(childPath(assertionElement.Space, attributeStatementTag))
+	if attributeStatement == nil {
+		return "", ErrMissingElement{Tag: attributeStatementTag}
+	}
+
+	for _, attribute := range attributeStatement.FindElements(childPath(assertionElement.Space, attributeTag)) {
+		if attribute.SelectAttrValue("Name", "") != "https://www.aliyun.com/SAML-Role/Attributes/RoleSessionName" {
+			continue
+		}
+		for _, attrValue := range attribute.FindElements(childPath(assertionElement.Space, attributeValueTag)) {
+			return strings.TrimSpace(attrValue.Text()), nil
+		}
+	}
+
+	return "", nil
+}
+
+// ExtractDestinationURLs find every URL the assertion may be posted to, the Destination of the Response followed by
+// the Recipient of each SubjectConfirmationData, some IdPs list the sign in endpoints of several partitions
+func ExtractDestinationURLs(data []byte) ([]string, error) {
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+
+	rootElement := doc.Root()
+	if rootElement == nil {
+		return nil, ErrMissingElement{Tag: responseTag}
+	}
+
+	var destinations []string
+	seen := map[string]bool{}
+	add := func(destination string) {
+		if destination != "" && !seen[destination] {
+			seen[destination] = true
+			destinations = append(destinations, destination)
+		}
+	}
+
+	add(rootElement.SelectAttrValue("Destination", ""))
+	for _, element := range doc.FindElements(".//SubjectConfirmationData") {
+		add(element.SelectAttrValue("Recipient", ""))
+	}
+
+	if len(destinations) == 0 {
+		return nil, ErrMissingElement{Tag: responseTag}
+	}
+
+	return destinations, nil
+}
+
 // ExtractDestinationURL will find the Destination URL to POST the SAML assertion to.
 // This is necessary to support custom endpoints such as AlibabaCloud International without requiring
 // hardcoded endpoints on the saml2alibabacloud side.
@@ -148,6 +217,67 @@ func ExtractRamRoles(data []byte) ([]string, error) {
 	return ramRoles, nil
 }
 
+// AssertionValidity the window in which the assertion and the session it grants are valid
+type AssertionValidity struct {
+	NotBefore    time.Time
+	NotOnOrAfter time.Time
+	// SessionNotOnOrAfter falls back to NotOnOrAfter when the IdP doesn't set it on the AuthnStatement
+	SessionNotOnOrAfter time.Time
+}
+
+// ExtractAssertionValidity this will extract the NotBefore / NotOnOrAfter conditions from the assertion,
+// times which are not present in the assertion are left as the zero value
+func ExtractAssertionValidity(data []byte) (*AssertionValidity, error) {
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+
+	assertionElement := doc.FindElement(".//Assertion")
+	if assertionElement == nil {
+		return nil, ErrMissingAssertion
+	}
+
+	validity := &AssertionValidity{}
+
+	var err error
+
+	conditions := assertionElement.FindElement(childPath(assertionElement.Space, conditionsTag))
+	if conditions != nil {
+		validity.NotBefore, err = parseAssertionTime(conditions.SelectAttrValue("NotBefore", ""))
+		if err != nil {
+			return nil, err
+		}
+		validity.NotOnOrAfter, err = parseAssertionTime(conditions.SelectAttrValue("NotOnOrAfter", ""))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	validity.SessionNotOnOrAfter = validity.NotOnOrAfter
+
+	authnStatement := assertionElement.FindElement(childPath(assertionElement.Space, authnStatementTag))
+	if authnStatement != nil {
+		sessionNotOnOrAfter, err := parseAssertionTime(authnStatement.SelectAttrValue("SessionNotOnOrAfter", ""))
+		if err != nil {
+			return nil, err
+		}
+		if !sessionNotOnOrAfter.IsZero() {
+			validity.SessionNotOnOrAfter = sessionNotOnOrAfter
+		}
+	}
+
+	return validity, nil
+}
+
+func parseAssertionTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 func childPath(space, tag string) string {
 	if space == "" {
 		return "./" + tag
@@ -1,14 +1,44 @@
 package saml2alibabacloud
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"net"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/authelia"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/authentik"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/casdoor"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/citrix"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider/custom"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/cyberark"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/dex"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/duo"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/ecp"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/entrust"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/forgerock"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/gluu"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/hennge"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/idaas"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/idcs"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/ipsilon"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/kanidm"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/keeper"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/lastpass"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/machineidentity"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider/netiq"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/rippling"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/salesforce"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/simplesamlphp"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/workspaceone"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider/wso2"
 
 	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
 	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/aliyun/saml2alibabacloud/pkg/provider"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider/aad"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider/adfs"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider/adfs2"
@@ -24,6 +54,7 @@ import (
 	"github.com/aliyun/saml2alibabacloud/pkg/provider/shell"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider/shibboleth"
 	"github.com/aliyun/saml2alibabacloud/pkg/provider/shibbolethecp"
+	"github.com/pkg/errors"
 )
 
 // ProviderList list of providers with their MFAs
@@ -31,22 +62,73 @@ type ProviderList map[string][]string
 
 // MFAsByProvider a list of providers with their respective supported MFAs
 var MFAsByProvider = ProviderList{
-	"AzureAD":       []string{"Auto", "PhoneAppOTP", "PhoneAppNotification", "OneWaySMS"},
-	"ADFS":          []string{"Auto", "VIP", "Azure"},
-	"ADFS2":         []string{"Auto", "RSA"}, // nothing automatic about ADFS 2.x
-	"Ping":          []string{"Auto"},        // automatically detects PingID
-	"PingOne":       []string{"Auto"},        // automatically detects PingID
-	"JumpCloud":     []string{"Auto"},
-	"Okta":          []string{"Auto", "PUSH", "DUO", "SMS", "TOTP", "OKTA", "FIDO", "YUBICO TOKEN:HARDWARE"}, // automatically detects DUO, SMS, ToTP, and FIDO
-	"OneLogin":      []string{"Auto", "OLP", "SMS", "TOTP", "YUBIKEY"},                                       // automatically detects OneLogin Protect, SMS and ToTP
-	"KeyCloak":      []string{"Auto"},                                                                        // automatically detects ToTP
-	"GoogleApps":    []string{"Auto"},                                                                        // automatically detects ToTP
-	"Shibboleth":    []string{"Auto"},
-	"F5APM":         []string{"Auto"},
-	"Akamai":        []string{"Auto", "DUO", "SMS", "EMAIL", "TOTP"},
-	"ShibbolethECP": []string{"auto", "phone", "push", "passcode"},
-	"NetIQ":         []string{"Auto", "Privileged"},
-	"Custom":        []string{"Auto"},
+	"AzureAD":           []string{"Auto", "PhoneAppOTP", "PhoneAppNotification", "OneWaySMS", "FidoKey"},
+	"ADFS":              []string{"Auto", "VIP", "Azure", "Certificate"},
+	"ADFS2":             []string{"Auto", "RSA"}, // nothing automatic about ADFS 2.x
+	"Ping":              []string{"Auto"},        // automatically detects PingID
+	"PingOne":           []string{"Auto"},        // automatically detects PingID
+	"JumpCloud":         []string{"Auto"},
+	"Okta":              []string{"Auto", "PUSH", "DUO", "SMS", "TOTP", "OKTA", "FIDO", "YUBICO TOKEN:HARDWARE"}, // automatically detects DUO, SMS, ToTP, and FIDO
+	"OneLogin":          []string{"Auto", "OLP", "SMS", "TOTP", "YUBIKEY", "WEBAUTHN"},                           // automatically detects OneLogin Protect, SMS, ToTP and WebAuthn
+	"KeyCloak":          []string{"Auto", "OTP", "WebAuthn"},                                                     // automatically detects ToTP and WebAuthn, Auto prompts when the realm offers both
+	"GoogleApps":        []string{"Auto"},                                                                        // automatically detects ToTP
+	"Shibboleth":        []string{"Auto"},
+	"F5APM":             []string{"Auto"},
+	"Akamai":            []string{"Auto", "DUO", "SMS", "EMAIL", "TOTP"},
+	"ShibbolethECP":     []string{"auto", "phone", "push", "passcode"},
+	"NetIQ":             []string{"Auto", "Privileged"},
+	"Custom":            []string{"Auto"},
+	"DuoSSO":            []string{"Auto", "PUSH", "PASSCODE"},                           // Universal Prompt, Auto uses --duo-mfa-option or prompts
+	"CyberArk":          []string{"Auto", "OTP", "OATH", "SMS", "EMAIL", "PF"},          // Auto prompts when more than one mechanism is offered
+	"WSO2":              []string{"Auto", "TOTP"},                                       // TOTP is detected automatically
+	"Authentik":         []string{"Auto", "TOTP", "STATIC", "DUO"},                      // Auto uses the only enrolled authenticator or prompts
+	"Authelia":          []string{"Auto", "TOTP", "DUO"},                                // Auto uses the preferred second factor of the user
+	"IDCS":              []string{"Auto", "TOTP", "SMS", "EMAIL", "PUSH", "BYPASSCODE"}, // Auto prompts when more than one factor is offered
+	"WorkspaceONE":      []string{"Auto", "PUSH", "PASSCODE"},                           // Auto approves the Verify push when offered
+	"Gluu":              []string{"Auto"},                                               // automatically detects the Casa OTP and SMS steps
+	"Casdoor":           []string{"Auto", "TOTP"},                                       // Auto uses the preferred MFA method of the user
+	"Salesforce":        []string{"Auto"},                                               // prompts for the email, SMS or authenticator code Salesforce asks for
+	"SimpleSAMLphp":     []string{"Auto"},                                               // enters the code of the TOTP modules when they ask for one
+	"AlibabaCloudIDaaS": []string{"Auto", "SMS", "TOTP"},                                // Auto uses the first SMS or OTP app factor of the user
+	"Ipsilon":           []string{"Auto"},                                               // uses the Kerberos ticket when there is one, a FreeIPA OTP is appended to the password
+	"LastPass":          []string{"Auto"},                                               // handles authenticator codes, the grid and LastPass Authenticator push
+	"Rippling":          []string{"Auto", "PUSH", "TOTP", "SMS"},                        // device approval is waited for, Auto uses the first second factor the user has set up
+	"Citrix":            []string{"Auto"},                                               // walks the nFactor chain, the LDAP password followed by an OTP or a push
+	"ForgeRock":         []string{"Auto"},                                               // answers the callbacks of the authentication tree, OTP and push nodes included
+	"Entrust":           []string{"Auto", "PUSH", "GRID"},                               // app_id is the Entrust application ID
+	"Dex":               []string{"Auto"},
+	"ECP":               []string{"Auto"},                           // the url is the SOAP ECP endpoint of any ECP capable IdP
+	"Kanidm":            []string{"Auto"},                           // the password with the TOTP or backup code the account policy requires
+	"Keeper":            []string{"Auto", "PUSH", "EMAIL", "ADMIN"}, // the method approving a new device, the two factor code comes from --mfa-token or a prompt
+	"HENNGE":            []string{"Auto"},                           // the one-time password mailed by HENNGE comes from --mfa-token or a prompt
+	"MachineIdentity":   []string{"Auto"},                           // the certificate of the machine, no user is involved
+}
+
+// RequirementsByProvider the login details each provider needs, providers which aren't listed need
+// creds.DefaultRequirements
+var RequirementsByProvider = map[string]creds.Requirements{
+	"Shell":           {},                                                        // the URL is the command to run
+	"MachineIdentity": {},                                                        // the machine authenticates with client_cert
+	"OneLogin":        {Username: true, Password: true, ClientCredentials: true}, // API credentials are needed for the token
+	"IDCS":            {Username: true, Password: true, ClientCredentials: true}, // API credentials are needed for the token
+}
+
+// ProviderRequirements the login details needed by the provider
+func ProviderRequirements(provider string) creds.Requirements {
+	if req, ok := RequirementsByProvider[provider]; ok {
+		return req
+	}
+	return creds.DefaultRequirements
+}
+
+// AccountRequirements the login details needed by the provider of the account, AzureAD needs no password when the
+// account signs in with a client certificate
+func AccountRequirements(account *cfg.IDPAccount) creds.Requirements {
+	req := ProviderRequirements(account.Provider)
+	if account.Provider == "AzureAD" && account.ClientCert != "" {
+		req.Password = false
+	}
+	return req
 }
 
 // Names get a list of provider names
@@ -89,8 +171,169 @@ type SAMLClient interface {
 	Authenticate(loginDetails *creds.LoginDetails) (string, error)
 }
 
-// NewSAMLClient create a new SAML client
+// TOTPEnroller implemented by the providers able to enroll an authenticator app factor for the user
+type TOTPEnroller interface {
+	// EnrollTOTP enroll the factor, verifying it with the code generated from its secret, and return the secret
+	EnrollTOTP(loginDetails *creds.LoginDetails, code func(secret string) (string, error)) (string, error)
+}
+
+// TimeoutError returned when an operation did not complete within the configured deadline
+type TimeoutError struct {
+	Operation string
+	Timeout   time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s did not complete within %v", e.Operation, e.Timeout)
+}
+
+// IsTimeoutError returns true if the error was caused by a configured deadline being exceeded
+func IsTimeoutError(err error) bool {
+	_, ok := errors.Cause(err).(*TimeoutError)
+	return ok
+}
+
+// deadlineClient enforces the account timeout as an overall deadline for the full Authenticate flow, the HTTP clients
+// built for accounts follow it so the flow stops once the deadline passes
+type deadlineClient struct {
+	client   SAMLClient
+	timeout  time.Duration
+	accounts []*cfg.IDPAccount
+}
+
+type authenticateResult struct {
+	samlAssertion string
+	err           error
+}
+
+func (dc *deadlineClient) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+	authentication := provider.StartAuthentication(dc.timeout, dc.accounts...)
+	defer authentication.End()
+	ctx := authentication.Context()
+
+	done := make(chan authenticateResult, 1)
+	go func() {
+		samlAssertion, err := dc.client.Authenticate(loginDetails)
+		done <- authenticateResult{samlAssertion, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil && ctx.Err() == context.DeadlineExceeded {
+			return "", &TimeoutError{Operation: "authentication with the IdP", Timeout: dc.timeout}
+		}
+		return res.samlAssertion, res.err
+	case <-ctx.Done():
+		authentication.Abandon()
+		return "", &TimeoutError{Operation: "authentication with the IdP", Timeout: dc.timeout}
+	}
+}
+
+// flowBreakageMarkers error fragments reported by the providers when the IdP pages no longer look as expected
+var flowBreakageMarkers = []string{
+	"unable to locate",
+	"unable to find",
+	"could not find",
+	"failed to build document",
+	"error parsing",
+	"error decoding",
+	"unexpected",
+	"no form",
+}
+
+// IsFlowBreakage returns true if the error looks like the login flow itself broke, for example after the IdP changed
+// its pages, rather than the IdP rejecting the credentials or being unreachable
+func IsFlowBreakage(err error) bool {
+	if err == nil || IsTimeoutError(err) {
+		return false
+	}
+
+	switch errors.Cause(err).(type) {
+	case net.Error, *provider.MaintenanceError, *provider.RateLimitError:
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, marker := range flowBreakageMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fallbackClient switches to the fallback provider when the primary one fails with a broken flow
+type fallbackClient struct {
+	primary  SAMLClient
+	fallback SAMLClient
+	name     string
+}
+
+func (fc *fallbackClient) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+	samlAssertion, err := fc.primary.Authenticate(loginDetails)
+	if !IsFlowBreakage(err) {
+		return samlAssertion, err
+	}
+
+	log.Printf("Login flow failed (%v), retrying with the %s provider", err, fc.name)
+
+	return fc.fallback.Authenticate(loginDetails)
+}
+
+// NewSAMLClient create a new SAML client, when the account has a timeout configured it is applied to the whole Authenticate flow
 func NewSAMLClient(idpAccount *cfg.IDPAccount) (SAMLClient, error) {
+	client, err := newProviderClient(idpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []*cfg.IDPAccount{idpAccount}
+
+	if idpAccount.FallbackProvider != "" && idpAccount.FallbackProvider != idpAccount.Provider {
+		fallbackAccount := *idpAccount
+		fallbackAccount.Provider = idpAccount.FallbackProvider
+
+		// MFA names differ between providers, let the fallback detect the factor when the configured one is unknown to it
+		if invalidMFA(fallbackAccount.Provider, fallbackAccount.MFA) {
+			fallbackAccount.MFA = "Auto"
+		}
+
+		fallback, err := newProviderClient(&fallbackAccount)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building fallback provider")
+		}
+
+		client = &fallbackClient{primary: client, fallback: fallback, name: fallbackAccount.Provider}
+		accounts = append(accounts, &fallbackAccount)
+	}
+
+	if idpAccount.Timeout > 0 {
+		if idpAccount.MFATimeout > idpAccount.Timeout {
+			log.Printf("Warning: mfa_timeout (%ds) is longer than timeout (%ds), the login stops after %ds even while a push approval is still waited for", idpAccount.MFATimeout, idpAccount.Timeout, idpAccount.Timeout)
+		}
+		return &deadlineClient{client: client, timeout: time.Duration(idpAccount.Timeout) * time.Second, accounts: accounts}, nil
+	}
+
+	return client, nil
+}
+
+// NewTOTPEnroller create the client enrolling a TOTP factor with the provider of the account
+func NewTOTPEnroller(idpAccount *cfg.IDPAccount) (TOTPEnroller, error) {
+	client, err := newProviderClient(idpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	enroller, ok := client.(TOTPEnroller)
+	if !ok {
+		return nil, fmt.Errorf("enrolling a TOTP factor isn't supported by the %s provider, only by Okta and KeyCloak", idpAccount.Provider)
+	}
+
+	return enroller, nil
+}
+
+func newProviderClient(idpAccount *cfg.IDPAccount) (SAMLClient, error) {
 	switch idpAccount.Provider {
 	case "AzureAD":
 		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
@@ -171,6 +414,123 @@ func NewSAMLClient(idpAccount *cfg.IDPAccount) (SAMLClient, error) {
 		return netiq.New(idpAccount, idpAccount.MFA)
 	case "Custom":
 		return custom.New(idpAccount)
+	case "MachineIdentity":
+		return machineidentity.New(idpAccount)
+	case "DuoSSO":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return duo.New(idpAccount)
+	case "CyberArk":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return cyberark.New(idpAccount)
+	case "WSO2":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return wso2.New(idpAccount)
+	case "Authentik":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return authentik.New(idpAccount)
+	case "Authelia":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return authelia.New(idpAccount)
+	case "IDCS":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return idcs.New(idpAccount)
+	case "WorkspaceONE":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return workspaceone.New(idpAccount)
+	case "Gluu":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return gluu.New(idpAccount)
+	case "Casdoor":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return casdoor.New(idpAccount)
+	case "Salesforce":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return salesforce.New(idpAccount)
+	case "SimpleSAMLphp":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return simplesamlphp.New(idpAccount)
+	case "AlibabaCloudIDaaS":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return idaas.New(idpAccount)
+	case "Ipsilon":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return ipsilon.New(idpAccount)
+	case "LastPass":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return lastpass.New(idpAccount)
+	case "Rippling":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return rippling.New(idpAccount)
+	case "Citrix":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return citrix.New(idpAccount)
+	case "ForgeRock":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return forgerock.New(idpAccount)
+	case "Entrust":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return entrust.New(idpAccount)
+	case "Dex":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return dex.New(idpAccount)
+	case "ECP":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return ecp.New(idpAccount)
+	case "Kanidm":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return kanidm.New(idpAccount)
+	case "Keeper":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return keeper.New(idpAccount)
+	case "HENNGE":
+		if invalidMFA(idpAccount.Provider, idpAccount.MFA) {
+			return nil, fmt.Errorf("invalid MFA type: %v for %v provider", idpAccount.MFA, idpAccount.Provider)
+		}
+		return hennge.New(idpAccount)
 	default:
 		return nil, fmt.Errorf("invalid provider: %v", idpAccount.Provider)
 	}
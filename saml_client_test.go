@@ -2,7 +2,11 @@ package saml2alibabacloud
 
 import (
 	"testing"
+	"time"
 
+	"github.com/aliyun/saml2alibabacloud/pkg/cfg"
+	"github.com/aliyun/saml2alibabacloud/pkg/creds"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -10,7 +14,7 @@ func TestProviderList_Keys(t *testing.T) {
 
 	names := MFAsByProvider.Names()
 
-	require.Len(t, names, 16)
+	require.Len(t, names, 40)
 
 }
 
@@ -21,3 +25,88 @@ func TestProviderList_Mfas(t *testing.T) {
 	require.Len(t, mfas, 1)
 
 }
+
+type slowClient struct {
+	delay time.Duration
+}
+
+func (sc *slowClient) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+	time.Sleep(sc.delay)
+	return "assertion", nil
+}
+
+func TestDeadlineClient(t *testing.T) {
+
+	dc := &deadlineClient{client: &slowClient{delay: time.Second}, timeout: 10 * time.Millisecond}
+	_, err := dc.Authenticate(&creds.LoginDetails{})
+	require.True(t, IsTimeoutError(err))
+
+	dc = &deadlineClient{client: &slowClient{}, timeout: time.Second}
+	samlAssertion, err := dc.Authenticate(&creds.LoginDetails{})
+	require.Nil(t, err)
+	require.Equal(t, "assertion", samlAssertion)
+}
+
+type failingClient struct {
+	err   error
+	calls int
+}
+
+func (fc *failingClient) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+	fc.calls++
+	return "", fc.err
+}
+
+func TestIsFlowBreakage(t *testing.T) {
+	require.True(t, IsFlowBreakage(errors.Wrap(errors.New("unable to locate IDP authentication form submit URL"), "error authenticating to IdP")))
+	require.False(t, IsFlowBreakage(errors.New("authentication failed: invalid username or password")))
+	require.False(t, IsFlowBreakage(&TimeoutError{Operation: "authentication with the IdP", Timeout: time.Second}))
+	require.False(t, IsFlowBreakage(nil))
+}
+
+func TestFallbackClient(t *testing.T) {
+	breakage := &failingClient{err: errors.New("unable to locate SAMLResponse")}
+	rejected := &failingClient{err: errors.New("invalid password")}
+
+	fc := &fallbackClient{primary: breakage, fallback: &slowClient{}, name: "Okta"}
+	samlAssertion, err := fc.Authenticate(&creds.LoginDetails{})
+	require.Nil(t, err)
+	require.Equal(t, "assertion", samlAssertion)
+
+	fallback := &failingClient{}
+	fc = &fallbackClient{primary: rejected, fallback: fallback, name: "Okta"}
+	_, err = fc.Authenticate(&creds.LoginDetails{})
+	require.EqualError(t, err, "invalid password")
+	require.Equal(t, 0, fallback.calls)
+}
+
+func TestNewSAMLClientFallback(t *testing.T) {
+	client, err := NewSAMLClient(&cfg.IDPAccount{Provider: "KeyCloak", MFA: "Auto", FallbackProvider: "Okta"})
+	require.Nil(t, err)
+	require.IsType(t, &fallbackClient{}, client)
+
+	_, err = NewSAMLClient(&cfg.IDPAccount{Provider: "KeyCloak", MFA: "Auto", FallbackProvider: "Nope"})
+	require.EqualError(t, err, "error building fallback provider: invalid provider: Nope")
+}
+
+func TestProviderRequirements(t *testing.T) {
+	require.Equal(t, creds.DefaultRequirements, ProviderRequirements("KeyCloak"))
+	require.Equal(t, creds.Requirements{}, ProviderRequirements("Shell"))
+	require.True(t, ProviderRequirements("OneLogin").ClientCredentials)
+	require.True(t, AccountRequirements(&cfg.IDPAccount{Provider: "AzureAD"}).Password)
+	require.False(t, AccountRequirements(&cfg.IDPAccount{Provider: "AzureAD", ClientCert: "user.crt"}).Password)
+
+	shell := &creds.LoginDetails{URL: "echo assertion"}
+	require.Nil(t, shell.ValidateFor(ProviderRequirements("Shell")))
+	require.Error(t, shell.ValidateFor(ProviderRequirements("Okta")))
+}
+
+func TestNewTOTPEnroller(t *testing.T) {
+	for _, provider := range []string{"Okta", "KeyCloak"} {
+		_, err := NewTOTPEnroller(&cfg.IDPAccount{Provider: provider, MFA: "Auto"})
+		require.Nil(t, err)
+	}
+
+	_, err := NewTOTPEnroller(&cfg.IDPAccount{Provider: "Ping", MFA: "Auto"})
+	require.EqualError(t, err, "enrolling a TOTP factor isn't supported by the Ping provider, only by Okta and KeyCloak")
+}
@@ -2,7 +2,9 @@ package saml2alibabacloud
 
 import (
 	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,3 +44,45 @@ func TestExtractDestinationURL2(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "https://signin.aliyun.com/saml-role/sso", destination)
 }
+
+func TestExtractDestinationURLs(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	multiple := strings.Replace(string(data), `Recipient="https://signin.aliyun.com/saml-role/sso"`, `Recipient="https://signin.alibabacloud.com/saml-role/sso"`, 1)
+
+	destinations, err := ExtractDestinationURLs(data)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://signin.aliyun.com/saml-role/sso"}, destinations)
+
+	destinations, err = ExtractDestinationURLs([]byte(multiple))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://signin.aliyun.com/saml-role/sso", "https://signin.alibabacloud.com/saml-role/sso"}, destinations)
+}
+
+func TestDestinationPartition(t *testing.T) {
+	assert.Equal(t, PartitionChina, DestinationPartition("https://signin.aliyun.com/saml-role/sso"))
+	assert.Equal(t, PartitionInternational, DestinationPartition("https://SIGNIN.alibabacloud.com/saml-role/sso"))
+	assert.Nil(t, DestinationPartition("https://signin.example.com/saml-role/sso"))
+	assert.Equal(t, "https://signin.alibabacloud.com/federation", PartitionInternational.FederationURL())
+}
+
+func TestExtractAssertionValidity(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	validity, err := ExtractAssertionValidity(data)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2016, 9, 10, 2, 54, 39, 371000000, time.UTC), validity.NotBefore)
+	assert.Equal(t, time.Date(2016, 9, 10, 3, 54, 39, 371000000, time.UTC), validity.NotOnOrAfter)
+	assert.Equal(t, validity.NotOnOrAfter, validity.SessionNotOnOrAfter)
+}
+
+func TestExtractRoleSessionName(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	name, err := ExtractRoleSessionName(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "wolfeidau@example.com", name)
+}